@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/robotin/screenshot/internal/a11y"
+	"github.com/robotin/screenshot/internal/xwin"
+)
+
+// a11yPath returns the accessibility tree sidecar for an image:
+// shot.png -> shot.a11y.json
+func a11yPath(imagePath string) string {
+	return strings.TrimSuffix(imagePath, filepath.Ext(imagePath)) + ".a11y.json"
+}
+
+// dumpA11y reads the accessibility tree of a captured window
+func dumpA11y(id uint64) (*a11y.Tree, error) {
+	conn, err := xwin.Connect(display)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	win, err := conn.Window(uint32(id))
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := a11y.Connect()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	return client.Dump(*win)
+}
+
+// writeA11y saves an accessibility tree as indented JSON
+func writeA11y(path string, tree *a11y.Tree) error {
+	data, err := json.MarshalIndent(tree, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to save accessibility tree: %w", err)
+	}
+	return nil
+}
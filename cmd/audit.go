@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/robotin/screenshot/internal/audit"
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/config"
+	"github.com/robotin/screenshot/internal/paths"
+	"github.com/robotin/screenshot/internal/strategy"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditLogPath string
+	auditExpect  string
+)
+
+// auditTrail is the audit log, nil if none is configured
+var auditTrail *audit.Log
+
+// auditDestination is where this process's captures go when deliver
+// doesn't record it: stdout, a daemon's clients, a session bundle
+var auditDestination string
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Work with the capture audit log",
+}
+
+var auditVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that the audit log has not been tampered with",
+	Long: `Check that every record of the audit log (audit_log in the policy or
+the config) matches its hash and links to the one before it, and print
+the number of records and the hash of the last one.
+
+A changed, removed or inserted record breaks the chain. Removing records
+from the end, or replacing the whole log, doesn't: keep the printed head
+hash somewhere else and pass it with --expect later, which fails unless
+that record is still in the log.
+
+Exits 1 if the log doesn't verify.
+
+Examples:
+  screenshot audit verify
+  screenshot audit verify --log /var/log/robotin-screenshot/audit.jsonl --expect 5d41402abc4b...`,
+	Args: cobra.NoArgs,
+	RunE: runAuditVerify,
+}
+
+func init() {
+	auditVerifyCmd.Flags().StringVar(&auditLogPath, "log", "", "Audit log to check (default: audit_log from the policy or the config)")
+	auditVerifyCmd.Flags().StringVar(&auditExpect, "expect", "", "Fail unless a record with this hash is in the log")
+	auditCmd.AddCommand(auditVerifyCmd)
+	rootCmd.AddCommand(auditCmd)
+}
+
+func runAuditVerify(cmd *cobra.Command, args []string) error {
+	path := auditLogPath
+	if path == "" {
+		var err error
+		if path, err = configuredAuditLog(); err != nil {
+			return err
+		}
+		if path == "" {
+			return fmt.Errorf("no audit log is configured (audit_log in %s or the config); pass --log", config.PolicyPath)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+	s, err := audit.Verify(f, auditExpect)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	fmt.Printf("%s: %d records, chain intact\nhead %s\n", path, s.Records, s.Head)
+	return nil
+}
+
+// configuredAuditLog returns the audit log path from the policy, else
+// the config, empty if there is none
+func configuredAuditLog() (string, error) {
+	policy, err := loadPolicy()
+	if err != nil {
+		return "", err
+	}
+	if policy.AuditLog != "" {
+		return policy.AuditLog, nil
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return "", err
+	}
+	if cfg.AuditLog == "" {
+		return "", nil
+	}
+	return paths.ExpandHome(cfg.AuditLog)
+}
+
+// openAuditTrail sets up auditTrail if an audit log is configured and
+// returns the capturer's audit function, nil if there is none
+func openAuditTrail() (func(strategy.CaptureOptions, error) error, error) {
+	path, err := configuredAuditLog()
+	if err != nil || path == "" {
+		return nil, err
+	}
+	auditTrail = audit.Open(path)
+	return func(opts strategy.CaptureOptions, err error) error {
+		return appendAudit(audit.Record{
+			Event:       audit.EventCapture,
+			What:        capture.Describe(opts),
+			Destination: auditDestination,
+			Result:      auditResult(err),
+		})
+	}, nil
+}
+
+// auditDelivery records where a saved capture went: its file and, if it
+// was uploaded, the upload (or why the upload failed)
+func auditDelivery(item resultItem, localPath string, target string, uploadErr error) error {
+	if auditTrail == nil {
+		return nil
+	}
+	dest := localPath
+	if abs, err := filepath.Abs(localPath); err == nil {
+		dest = abs
+	}
+	if item.URL != "" {
+		dest += ", uploaded to " + item.URL
+	} else if target != "" {
+		dest += ", upload to " + target
+	}
+	what := ""
+	if item.Monitor != nil {
+		what = fmt.Sprintf("monitor %d", *item.Monitor)
+	}
+	return appendAudit(audit.Record{Event: audit.EventDeliver, What: what, Destination: dest, Result: auditResult(uploadErr)})
+}
+
+// appendAudit adds a record made by this command
+func appendAudit(r audit.Record) error {
+	r.Command = auditCommand()
+	if err := auditTrail.Append(r); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// auditResult is an event's result for its error
+func auditResult(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return audit.ResultOK
+}
+
+// auditCommand is the command line, with the values of flags holding
+// secrets (tokens, webhook secrets) hidden
+func auditCommand() string {
+	args := make([]string, len(os.Args))
+	copy(args, os.Args)
+	for i := 1; i < len(args); i++ {
+		name, _, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !strings.HasPrefix(args[i], "--") || !isSecretFlag(name) {
+			continue
+		}
+		if hasValue {
+			args[i] = "--" + name + "=***"
+		} else if i+1 < len(args) {
+			i++
+			args[i] = "***"
+		}
+	}
+	return strings.Join(args, " ")
+}
+
+// isSecretFlag reports whether a flag's value is a secret
+func isSecretFlag(name string) bool {
+	return strings.Contains(name, "token") || strings.Contains(name, "secret") || strings.Contains(name, "password")
+}
@@ -0,0 +1,115 @@
+//go:build !noupload && !minimal
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/robotin/screenshot/internal/upload"
+	"github.com/spf13/cobra"
+)
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Manage logins for upload providers",
+	Long: `Log in to upload providers so captures can be uploaded to your account.
+
+Providers that support it use the OAuth device flow: open the printed URL
+on any device, enter the code, and approve. Others print a URL to open and
+ask you to paste the code shown after approval.
+
+Tokens are stored in the config directory (readable only by you) and
+refreshed automatically.`,
+}
+
+var authLoginCmd = &cobra.Command{
+	Use:   "login <provider>",
+	Short: "Log in to an upload provider",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := upload.LookupOAuth(args[0])
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
+		defer cancel()
+
+		tok, err := p.Login(ctx, promptLogin)
+		if err != nil {
+			return fmt.Errorf("login failed: %w", err)
+		}
+
+		if account := tok.Extra["account"]; account != "" {
+			fmt.Printf("Logged in to %s as %s\n", p.Name, account)
+		} else {
+			fmt.Printf("Logged in to %s\n", p.Name)
+		}
+		return nil
+	},
+}
+
+var authLogoutCmd = &cobra.Command{
+	Use:   "logout <provider>",
+	Short: "Forget the stored login for a provider",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := upload.LookupOAuth(args[0])
+		if err != nil {
+			return err
+		}
+		if err := upload.Logout(p.Name); err != nil {
+			return err
+		}
+		fmt.Printf("Logged out of %s\n", p.Name)
+		return nil
+	},
+}
+
+var authStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show which providers are logged in",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, name := range upload.OAuthProviders() {
+			tok, err := upload.LoadToken(name)
+			switch {
+			case err != nil:
+				fmt.Printf("%-10s error: %v\n", name, err)
+			case tok == nil:
+				fmt.Printf("%-10s not logged in\n", name)
+			case tok.Extra["account"] != "":
+				fmt.Printf("%-10s logged in as %s\n", name, tok.Extra["account"])
+			default:
+				fmt.Printf("%-10s logged in\n", name)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	authCmd.AddCommand(authLoginCmd, authLogoutCmd, authStatusCmd)
+	rootCmd.AddCommand(authCmd)
+}
+
+// promptLogin shows the authorization URL. With a device code the user
+// just enters it on that page; otherwise the pasted code is read from stdin.
+func promptLogin(url, code string) (string, error) {
+	if code != "" {
+		fmt.Printf("Open %s\nand enter the code: %s\n\nWaiting for approval...\n", url, code)
+		return "", nil
+	}
+
+	fmt.Printf("Open this URL and approve access:\n\n  %s\n\nPaste the code shown after approval: ", url)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read code: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
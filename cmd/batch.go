@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// runPerMonitor captures every monitor into its own file (<base>_m<N><ext>).
+// With --all-or-nothing, files are written to temporary names and only
+// renamed into place once every monitor succeeded; otherwise nothing is left
+// behind, and the monitors after the one that failed are skipped. Per-item
+// status is always available via --json.
+func runPerMonitor(capturer *capture.Capturer, opts strategy.CaptureOptions, enc capture.EncodeOptions, outputPath string, d *delivery) error {
+	monitors, err := capturer.ListMonitors()
+	if err != nil {
+		return err
+	}
+
+	ext := filepath.Ext(outputPath)
+	base := strings.TrimSuffix(outputPath, ext)
+
+	res := captureResult{OK: true}
+	var written []string // final or temporary paths that exist on disk
+	focus, pointer := captureContext(opts.Display)
+
+	for i, m := range monitors {
+		index := m.Index
+		path := fmt.Sprintf("%s_m%d%s", base, index, ext)
+
+		monOpts := opts
+		monOpts.Monitor = index
+		monOpts.Region = nil
+
+		monEnc := enc
+		if pngMeta {
+			monEnc.DPI = m.DPI()
+		}
+		img, attempts, err := capturer.CaptureAttempts(monOpts)
+		out := img
+		var (
+			fit      *capture.Fit
+			fallback *capture.Fallback
+		)
+		if err == nil {
+			monEnc, path = resolveFormat(img, monEnc, path)
+			if out, monEnc, fit, err = fitSize(img, monEnc); err == nil {
+				pngPath := capture.FallbackPath(path)
+				if fallback, err = capture.SaveFallback(out, stagingPath(path), stagingPath(pngPath), monEnc, &capture.Stats{}); fallback != nil {
+					path, monEnc.Format = pngPath, capture.FormatPNG
+					warnFallback(path, fallback)
+				}
+			}
+		}
+
+		if err != nil {
+			item := failedItem(path, err)
+			item.Monitor = &index
+			item.Attempts = attempts
+			res.Items = append(res.Items, item)
+			res.OK = false
+			if allOrNothing {
+				for _, m := range monitors[i+1:] {
+					index := m.Index
+					res.Items = append(res.Items, resultItem{
+						Path:    fmt.Sprintf("%s_m%d%s", base, index, ext),
+						Monitor: &index,
+						Status:  statusSkipped,
+					})
+				}
+				break
+			}
+			continue
+		}
+
+		written = append(written, stagingPath(path))
+		item := newResultItem(path, img, monEnc)
+		item.Monitor = &index
+		item.Focus, item.Pointer = focus, pointer
+		withFit(&item, out, fit)
+		item.Fallback = fallback
+		item.Attempts = attempts
+		res.Items = append(res.Items, item)
+	}
+
+	if allOrNothing {
+		if res.OK {
+			res.OK, res.Error = commitStaged(written, res.Items)
+		}
+		if !res.OK {
+			rollback(written, res.Items)
+		}
+	}
+
+	// Deliver the files that were kept
+	for i := range res.Items {
+		if res.Items[i].Status != statusOK {
+			continue
+		}
+		if err := d.deliver(&res.Items[i], res.Items[i].Path); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+	}
+
+	if jsonOutput {
+		if err := printResult(res); err != nil {
+			return err
+		}
+	} else {
+		for _, item := range res.Items {
+			switch item.Status {
+			case statusOK:
+				infof("Screenshot saved: %s", item.Path)
+				infoAnalysis(item)
+				if item.URL != "" {
+					infof("Uploaded: %s", item.URL)
+				}
+			case statusRolledBack:
+				fmt.Fprintf(os.Stderr, "Rolled back: %s\n", item.Path)
+			case statusSkipped:
+				fmt.Fprintf(os.Stderr, "Skipped: %s\n", item.Path)
+			default:
+				fmt.Fprintf(os.Stderr, "Failed: %s: %s\n", item.Path, item.Error)
+			}
+		}
+	}
+
+	if !res.OK {
+		return fmt.Errorf("per-monitor capture incomplete")
+	}
+	return nil
+}
+
+// stagingPath returns where an item is written before commit. Without
+// --all-or-nothing files go straight to their final path.
+func stagingPath(path string) string {
+	if !allOrNothing {
+		return path
+	}
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".partial")
+}
+
+// commitStaged renames staged files to their final paths. On failure the
+// already renamed files are moved back so rollback can remove them.
+func commitStaged(staged []string, items []resultItem) (bool, string) {
+	for i, tmp := range staged {
+		if err := os.Rename(tmp, items[i].Path); err != nil {
+			for j := 0; j < i; j++ {
+				os.Rename(items[j].Path, staged[j])
+			}
+			return false, fmt.Sprintf("failed to commit %s: %v", items[i].Path, err)
+		}
+	}
+	return true, ""
+}
+
+// rollback removes staged files and marks their items as rolled back
+func rollback(staged []string, items []resultItem) {
+	for _, tmp := range staged {
+		os.Remove(tmp)
+	}
+	for i := range items {
+		if items[i].Status == statusOK {
+			items[i].Status = statusRolledBack
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/robotin/screenshot/internal/annotate"
+	"github.com/robotin/screenshot/internal/heatmap"
+	"github.com/robotin/screenshot/internal/notify"
+	"github.com/spf13/cobra"
+)
+
+// burninCellSize is the size of the cells static areas are found in
+const burninCellSize = 32
+
+var (
+	burninMinStatic   time.Duration
+	burninMinContrast uint8
+	burninOutput      string
+)
+
+var burninCmd = &cobra.Command{
+	Use:   "burnin",
+	Short: "Report static high-contrast areas at risk of burning in",
+	Long: `Analyze the interval captures in the history, as heatmap does, and
+report the areas of the screen that have shown the same high-contrast
+content (text, logos, borders) for at least --min-static: on signage and
+kiosk displays, especially OLED and plasma, those are the areas that
+burn in.
+
+Exits with status 1 when there are such areas, so it can run from cron
+or a monitoring system; --webhook also sends them as a "burn-in" event.
+-o writes the latest capture with the areas outlined.
+
+Examples:
+  screenshot burnin --since 24h --min-static 4h
+  screenshot burnin --tag lobby -o burnin.png --webhook https://ops.example.com/hook
+  screenshot burnin --min-contrast 64 --json`,
+	Args: cobra.NoArgs,
+	RunE: runBurnin,
+}
+
+func init() {
+	burninCmd.Flags().DurationVar(&heatmapSince, "since", 24*time.Hour, "Analyze captures taken within this long")
+	burninCmd.Flags().DurationVar(&burninMinStatic, "min-static", 4*time.Hour, "Report areas unchanged for at least this long")
+	burninCmd.Flags().Uint8Var(&burninMinContrast, "min-contrast", 96, "Smallest luminance range (0-255) within an area to report it")
+	burninCmd.Flags().Uint8Var(&heatmapThreshold, "threshold", 0, "Per-channel difference (0-255) still treated as equal")
+	burninCmd.Flags().StringVar(&heatmapTag, "tag", "", "Only use captures with this tag")
+	burninCmd.Flags().StringVarP(&burninOutput, "output", "o", "", "Write the latest capture with the areas outlined")
+	burninCmd.Flags().StringVar(&webhookURL, "webhook", "", "POST a burn-in event to this URL when areas are found")
+	burninCmd.Flags().StringVar(&webhookSecret, "webhook-secret", "", "HMAC secret for signing webhook events (default: $SCREENSHOT_WEBHOOK_SECRET)")
+	burninCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the result as JSON")
+	rootCmd.AddCommand(burninCmd)
+}
+
+// burninArea is a reported area in --json output
+type burninArea struct {
+	X        int       `json:"x"`
+	Y        int       `json:"y"`
+	Width    int       `json:"width"`
+	Height   int       `json:"height"`
+	Since    time.Time `json:"since"`
+	StaticMS int64     `json:"static_ms"`
+	Contrast uint8     `json:"contrast"`
+}
+
+// burninResult is the burnin --json output
+type burninResult struct {
+	Captures int          `json:"captures"`
+	Skipped  int          `json:"skipped"`
+	Width    int          `json:"width"`
+	Height   int          `json:"height"`
+	From     time.Time    `json:"from"`
+	To       time.Time    `json:"to"`
+	Areas    []burninArea `json:"areas"`
+	Output   string       `json:"output,omitempty"`
+}
+
+func runBurnin(cmd *cobra.Command, args []string) error {
+	entries, err := heatmapEntries()
+	if err != nil {
+		return err
+	}
+	series, err := loadHeatmapSeries(entries)
+	if err != nil {
+		return err
+	}
+	m, times := series.m, series.times
+	last := times[len(times)-1]
+
+	// The last capture that is at least --min-static old: areas must not
+	// have changed since
+	cutoff := last.Add(-burninMinStatic)
+	since := -1
+	for i, t := range times {
+		if !t.After(cutoff) {
+			since = i
+		}
+	}
+	if since < 0 {
+		return fmt.Errorf("the captures cover %s, less than --min-static %s; keep capturing or lower it",
+			last.Sub(times[0]).Round(time.Second), burninMinStatic)
+	}
+
+	regions := m.BurnIn(series.latest, heatmap.BurnInOptions{
+		CellSize:    burninCellSize,
+		MinContrast: burninMinContrast,
+		StaticSince: since,
+	})
+
+	res := burninResult{
+		Captures: len(times),
+		Skipped:  series.skipped,
+		Width:    m.Width,
+		Height:   m.Height,
+		From:     times[0],
+		To:       last,
+		Areas:    []burninArea{},
+		Output:   burninOutput,
+	}
+	var ops []annotate.Op
+	for _, r := range regions {
+		b := r.Bounds
+		static := last.Sub(times[r.Since])
+		res.Areas = append(res.Areas, burninArea{b.Min.X, b.Min.Y, b.Dx(), b.Dy(), times[r.Since], static.Milliseconds(), r.Contrast})
+		ops = append(ops,
+			annotate.Op{Rect: fmt.Sprintf("%d,%d,%d,%d", b.Min.X, b.Min.Y, b.Dx(), b.Dy())},
+			annotate.Op{Text: static.Round(time.Minute).String(), At: fmt.Sprintf("%d,%d", b.Min.X+4, b.Min.Y+4), Background: "black"})
+	}
+
+	if burninOutput != "" {
+		img, err := annotate.Apply(series.latest, ops)
+		if err != nil {
+			return err
+		}
+		if err := writePNG(burninOutput, img); err != nil {
+			return err
+		}
+	}
+	if len(regions) > 0 {
+		sendBurninAlert(res)
+	}
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("Analyzed %d captures (%dx%d) from %s to %s\n", res.Captures, res.Width, res.Height,
+			res.From.Format(time.DateTime), res.To.Format(time.DateTime))
+		if len(res.Areas) == 0 {
+			fmt.Printf("No burn-in risk: no high-contrast area unchanged for %s\n", burninMinStatic)
+		} else {
+			fmt.Printf("Burn-in risk: %d high-contrast areas unchanged for %s or more\n", len(res.Areas), burninMinStatic)
+			for _, a := range res.Areas {
+				fmt.Printf("  %d,%d %dx%d: unchanged for %s, contrast %d\n", a.X, a.Y, a.Width, a.Height,
+					(time.Duration(a.StaticMS) * time.Millisecond).Round(time.Minute), a.Contrast)
+			}
+		}
+		if burninOutput != "" {
+			infof("Report saved: %s", burninOutput)
+		}
+	}
+
+	if len(regions) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// sendBurninAlert posts the areas found to --webhook, if set. Delivery
+// failures are reported but don't change the result.
+func sendBurninAlert(res burninResult) {
+	hook := newWebhook()
+	if hook == nil {
+		return
+	}
+
+	var tags []string
+	if heatmapTag != "" {
+		tags = []string{heatmapTag}
+	}
+	ev := notify.NewEvent(res.Output, "", "", res.Width, res.Height, tags)
+	ev.Type = notify.EventBurnIn
+	for _, a := range res.Areas {
+		ev.Regions = append(ev.Regions, notify.Region{X: a.X, Y: a.Y, Width: a.Width, Height: a.Height, StaticSeconds: a.StaticMS / 1000})
+	}
+	if res.Output != "" {
+		ev.Format = "png"
+		if err := ev.Checksum(res.Output); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	debugf("sending %s event to webhook", ev.Type)
+	if err := hook.Send(ctx, ev); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+}
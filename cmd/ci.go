@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/strategy"
+	"github.com/spf13/cobra"
+)
+
+// ciOutputDir is where --ci saves generated names, in the working
+// directory so artifact upload steps find them
+const ciOutputDir = "screenshots"
+
+// xvfbStartTimeout bounds how long Xvfb may take to come up
+const xvfbStartTimeout = 10 * time.Second
+
+var xvfbSizeRe = regexp.MustCompile(`^(\d+)x(\d+)$`)
+
+var (
+	ciMode   bool
+	xvfbSize string
+
+	// xvfb is the X server started by --xvfb, stopped on exit
+	xvfb *exec.Cmd
+)
+
+// setupCI applies --ci and --xvfb before a command runs: --ci prints
+// JSON where the command can and keeps no history, which CI machines
+// don't need
+func setupCI(cmd *cobra.Command) error {
+	if ciMode {
+		if f := cmd.Flags().Lookup("json"); f != nil && !f.Changed {
+			jsonOutput = true
+		}
+		noHistory = true
+	}
+	if xvfbSize == "" {
+		return nil
+	}
+	if display != "" || os.Getenv("DISPLAY") != "" {
+		debugf("not starting Xvfb: a display is set")
+		return nil
+	}
+	return startXvfb(xvfbSize)
+}
+
+// startXvfb starts a private Xvfb with one screen of size WIDTHxHEIGHT
+// on a free display, and points $DISPLAY (also for workflow commands)
+// at it. Xvfb picks the display itself and reports it on a pipe once it
+// accepts connections, so parallel jobs can't race for the same one.
+func startXvfb(size string) error {
+	if !xvfbSizeRe.MatchString(size) {
+		return fmt.Errorf("invalid --xvfb size %q (expected WIDTHxHEIGHT, e.g. 1920x1080)", size)
+	}
+	path, err := exec.LookPath("Xvfb")
+	if err != nil {
+		return fmt.Errorf("--xvfb needs Xvfb (apt install xvfb): %w", err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	cmd := exec.Command(path, "-displayfd", "3", "-screen", "0", size+"x24", "-nolisten", "tcp")
+	cmd.ExtraFiles = []*os.File{w}
+	cmd.SysProcAttr = xvfbAttr()
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return fmt.Errorf("failed to start Xvfb: %w", err)
+	}
+
+	number := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(r).ReadString('\n')
+		number <- strings.TrimSpace(line)
+	}()
+	select {
+	case n := <-number:
+		if n == "" {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return fmt.Errorf("Xvfb exited without opening a display")
+		}
+		xvfb = cmd
+		os.Setenv("DISPLAY", ":"+n)
+		fmt.Fprintf(os.Stderr, "Started Xvfb on :%s (%s)\n", n, size)
+		return nil
+	case <-time.After(xvfbStartTimeout):
+		cmd.Process.Kill()
+		cmd.Wait()
+		return fmt.Errorf("Xvfb did not start within %s", xvfbStartTimeout)
+	}
+}
+
+// stopXvfb stops the X server started by --xvfb, if any
+func stopXvfb() {
+	if xvfb != nil {
+		xvfb.Process.Signal(os.Interrupt)
+		xvfb.Wait()
+		xvfb = nil
+	}
+}
+
+// ciError reports a failure as a GitHub Actions error annotation, which
+// other CI systems print as a plain line
+func ciError(err error) {
+	msg := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(err.Error())
+	fmt.Fprintf(os.Stderr, "::error title=screenshot::%s\n", msg)
+}
+
+// ciFilename names a capture after what was captured instead of the
+// time, so reruns produce the same artifact names
+func ciFilename(opts strategy.CaptureOptions, format capture.Format) string {
+	name := "screenshot"
+	switch {
+	case targetWindow != nil:
+		name = "window"
+		if s := capture.Slug(targetWindow.Class, 48); s != "" {
+			name += "-" + s
+		}
+	case opts.Region != nil:
+		r := *opts.Region
+		name = fmt.Sprintf("region-%d-%d-%d-%d", r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+	case opts.Monitor >= 0:
+		name = fmt.Sprintf("monitor-%d", opts.Monitor)
+	}
+	return name + format.Extension()
+}
@@ -0,0 +1,555 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/robotin/screenshot/internal/anonymize"
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/config"
+	"github.com/robotin/screenshot/internal/paths"
+	"github.com/robotin/screenshot/internal/schedule"
+	"github.com/robotin/screenshot/internal/strategy"
+	"github.com/robotin/screenshot/internal/upload"
+	"github.com/robotin/screenshot/internal/xwin"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	configEffective bool
+	configDryRun    bool
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show and upgrade the configuration file",
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show [-- FLAGS...]",
+	Short: "Print the configuration, or every setting in effect and where it comes from",
+	Long: `Print the configuration file (--config, $SCREENSHOT_CONFIG or
+~/.config/robotin-screenshot/config.yaml) as it is read: validated, and
+upgraded to the current version.
+
+--effective prints every setting instead, with the value in effect and
+where it comes from: a flag, an environment variable, the config file or
+the built-in default. Flags after -- are applied as if given to a
+capture. Settings only the config file has follow the flags.
+
+Examples:
+  screenshot config show
+  screenshot config show --effective
+  screenshot config show --effective -- --format jpeg --output-dir /tmp
+  screenshot config show --effective --json`,
+	RunE: runConfigShow,
+}
+
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the configuration file to the current version",
+	Long: `Rewrite the configuration file in the current format, keeping its
+comments, and save the original next to it as config.yaml.vN.bak. The
+changes are listed; --dry-run prints the upgraded file instead of
+writing it.
+
+Older files keep working, upgraded in memory each time they are read;
+migrating makes that permanent and silences the warning.`,
+	Args: cobra.NoArgs,
+	RunE: runConfigMigrate,
+}
+
+func init() {
+	configShowCmd.Flags().BoolVar(&configEffective, "effective", false, "Print every setting in effect and where it comes from")
+	configShowCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the settings as JSON (with --effective)")
+	configMigrateCmd.Flags().BoolVar(&configDryRun, "dry-run", false, "Print the upgraded file instead of writing it")
+	configCmd.AddCommand(configShowCmd, configMigrateCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+// flagConfigKeys are the config keys flags override
+var flagConfigKeys = map[string]string{
+	"output-dir":       "output_dir",
+	"backend-priority": "backend_priority",
+	"normalize-dpi":    "dpi.normalize",
+	"panic-key":        "panic_key",
+	"indicator":        "indicator.enabled",
+	"spool":            "uploads.spool",
+	"format":           "format",
+	"upload":           "upload",
+}
+
+// flagEnvVars are the environment variables flags default to besides
+// their $SCREENSHOT_ ones
+var flagEnvVars = map[string]string{
+	"display": "DISPLAY",
+}
+
+// effectiveSetting is a setting as config show --effective prints it
+type effectiveSetting struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+
+	// Key is the environment variable or config key the value comes
+	// from
+	Key string `json:"key,omitempty"`
+}
+
+func runConfigShow(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		if !configEffective {
+			return fmt.Errorf("flags after -- only apply to --effective")
+		}
+		if err := rootCmd.ParseFlags(args); err != nil {
+			return fmt.Errorf("invalid flags: %w", err)
+		}
+		if rest := rootCmd.Flags().Args(); len(rest) > 0 {
+			return fmt.Errorf("unexpected argument %q after --", rest[0])
+		}
+	}
+	if configEffective {
+		if err := applyEnv(rootCmd); err != nil {
+			return err
+		}
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if !configEffective {
+		if jsonOutput {
+			return fmt.Errorf("--json only applies to --effective")
+		}
+		return showConfigFile(cfg)
+	}
+
+	settings := effectiveSettings(cfg)
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return stdoutError(enc.Encode(settings))
+	}
+	w := bufio.NewWriter(os.Stdout)
+	if cfg.File != "" {
+		fmt.Fprintf(w, "# Config file: %s (version %d)\n", cfg.File, cfg.Version)
+	} else {
+		fmt.Fprintln(w, "# No config file")
+	}
+	width := 0
+	for _, s := range settings {
+		width = max(width, len(s.Name))
+	}
+	for _, s := range settings {
+		value := s.Value
+		if value == "" {
+			value = "-"
+		}
+		source := s.Source
+		if s.Key != "" {
+			source += " " + s.Key
+		}
+		fmt.Fprintf(w, "%-*s  %-24s  %s\n", width, s.Name, value, source)
+	}
+	return stdoutError(w.Flush())
+}
+
+// showConfigFile prints the configuration file as it is read
+func showConfigFile(cfg *config.Config) error {
+	if cfg.File == "" {
+		infof("No config file (see screenshot config show --help)")
+		return nil
+	}
+	data, err := os.ReadFile(cfg.File)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	m, err := config.Migrate(data)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("# %s\n", cfg.File)
+	_, err = os.Stdout.Write(m.Data)
+	return stdoutError(err)
+}
+
+// effectiveSettings lists every flag with the value in effect and where
+// it comes from, then the settings only the config file has
+func effectiveSettings(cfg *config.Config) []effectiveSetting {
+	var settings []effectiveSetting
+	seen := map[string]bool{}
+	add := func(f *pflag.Flag) {
+		if seen[f.Name] || f.Hidden || f.Name == "help" {
+			return
+		}
+		seen[f.Name] = true
+		s := effectiveSetting{Name: "--" + f.Name, Value: f.Value.String(), Source: "flag"}
+		if isSecretFlag(f.Name) && s.Value != "" {
+			s.Value = "***"
+		}
+		if env, ok := envFlags[f.Name]; ok {
+			s.Source, s.Key = "env", "$"+env
+			settings = append(settings, s)
+			return
+		}
+		if f.Changed {
+			settings = append(settings, s)
+			return
+		}
+		if env, ok := flagEnvVars[f.Name]; ok {
+			if v, ok := os.LookupEnv(env); ok {
+				s.Value, s.Source, s.Key = v, "env", "$"+env
+				settings = append(settings, s)
+				return
+			}
+		}
+		if key, ok := flagConfigKeys[f.Name]; ok {
+			if v, ok := cfg.Lookup(key); ok {
+				s.Value, s.Source, s.Key = v, "config", key
+				settings = append(settings, s)
+				return
+			}
+		}
+		s.Value, s.Source = f.DefValue, "default"
+		settings = append(settings, s)
+	}
+	rootCmd.PersistentFlags().VisitAll(add)
+	rootCmd.Flags().VisitAll(add)
+
+	linked := map[string]bool{}
+	for _, key := range flagConfigKeys {
+		linked[key] = true
+	}
+	for _, s := range cfg.Settings() {
+		if !linked[s.Key] && s.Key != "version" {
+			settings = append(settings, effectiveSetting{Name: s.Key, Value: s.Value, Source: "config"})
+		}
+	}
+	return settings
+}
+
+func runConfigMigrate(cmd *cobra.Command, args []string) error {
+	path := configPath
+	if path == "" {
+		var err error
+		if path, err = config.Path(); err != nil {
+			return err
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	m, err := config.Migrate(data)
+	var errs *config.Errors
+	if errors.As(err, &errs) {
+		errs.File = path
+	}
+	if err != nil {
+		return err
+	}
+	for _, change := range m.Changes {
+		fmt.Fprintf(os.Stderr, "%s\n", change)
+	}
+	if configDryRun {
+		_, err := os.Stdout.Write(m.Data)
+		return stdoutError(err)
+	}
+	if m.From == m.To {
+		infof("%s is already version %d", path, m.To)
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	backup := fmt.Sprintf("%s.v%d.bak", path, m.From)
+	if err := os.WriteFile(backup, data, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to back up config: %w", err)
+	}
+	if err := writeConfig(path, m.Data, info.Mode().Perm()); err != nil {
+		return err
+	}
+	infof("Migrated %s from version %d to %d (original saved as %s)", path, m.From, m.To, backup)
+	return nil
+}
+
+// writeConfig replaces the configuration file at path, through a
+// temporary file so a failed write leaves the old one
+func writeConfig(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".config-*.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
+
+// userConfig caches the configuration file once loaded
+var userConfig *config.Config
+
+// loadConfig loads the configuration file (--config, $SCREENSHOT_CONFIG
+// or the default location) on first use. Values upgraded from an older
+// version are reported, once.
+func loadConfig() (*config.Config, error) {
+	if userConfig != nil {
+		return userConfig, nil
+	}
+	c, err := config.Load(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Migrations) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %s is a version %d config, upgraded as it is read (run screenshot config migrate to update it):\n  %s\n",
+			c.File, c.Version, strings.Join(c.Migrations, "\n  "))
+	}
+	userConfig = c
+	return c, nil
+}
+
+// loadSchedule looks up a named schedule in the config
+func loadSchedule(name string) (*schedule.Schedule, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	s, ok := cfg.Schedules[name]
+	if !ok {
+		return nil, fmt.Errorf("no schedule named %q in the config", name)
+	}
+	// Validated when the config was loaded
+	return s.Parse()
+}
+
+// machinePolicy caches the policy file once loaded
+var machinePolicy *config.Policy
+
+// loadPolicy loads the administrator's policy file on first use and
+// applies the upload restrictions, which cover every command
+func loadPolicy() (*config.Policy, error) {
+	if machinePolicy != nil {
+		return machinePolicy, nil
+	}
+	p, err := config.LoadPolicy()
+	if err != nil {
+		return nil, err
+	}
+	upload.Disallow(p.DisallowUploads)
+	machinePolicy = p
+	return p, nil
+}
+
+// newCapturer creates a capturer that uses the --backend backend or
+// tries backends in the configured order (--backend-priority, else
+// backend_priority), stitches mixed-DPI desktops per --normalize-dpi
+// (else dpi.normalize), corrects red/blue swapped frames per --swap-rb,
+// records frames with --record-frames, and applies the configured
+// exclusion zones and protected windows, the policy's masks and capture
+// rate limit, the audit log, and the check for black video with
+// --overlay-fallback
+func newCapturer() (*capture.Capturer, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	policy, err := loadPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	var c *capture.Capturer
+	if backendName != "" {
+		c, err = capture.NewWithBackend(backendName)
+	} else {
+		order := cfg.BackendPriority
+		if backendPriority != nil {
+			order = backendPriority
+		}
+		c, err = capture.NewWithPriority(order)
+	}
+	if err != nil {
+		return nil, err
+	}
+	normalize := cfg.DPI.Normalize
+	if normalizeDPI != "" {
+		normalize = normalizeDPI
+	}
+	if _, _, err := config.ParseNormalize(normalize); err != nil {
+		return nil, err
+	}
+	if normalize != "" {
+		c.SetScales(func(monitors []strategy.Monitor) ([]float64, error) {
+			return cfg.DPI.Scales(normalize, monitors)
+		})
+	}
+
+	mode, err := capture.ParseSwapMode(swapRB)
+	if err != nil {
+		return nil, err
+	}
+	c.SetSwapRB(mode)
+	if recordFrames != "" {
+		// Recorded frames are raw, before any masking
+		if len(policy.Mask) > 0 {
+			return nil, fmt.Errorf("--record-frames is not allowed: the policy (%s) masks areas of every capture", config.PolicyPath)
+		}
+		if err := c.RecordFrames(recordFrames); err != nil {
+			return nil, err
+		}
+	}
+	debugf("backends: %v", c.ListStrategies())
+	if len(cfg.Exclude) > 0 || len(policy.Mask) > 0 {
+		c.SetExclusions(func(monitors []strategy.Monitor) []image.Rectangle {
+			return append(cfg.Exclusions(monitors), policy.Masks(monitors)...)
+		})
+	}
+	c.SetMinInterval(policy.MinInterval, filepath.Join(paths.RuntimeDir(), "last-capture"))
+	c.SetEvents(eventBus)
+	auditFn, err := openAuditTrail()
+	if err != nil {
+		return nil, err
+	}
+	if auditFn != nil {
+		c.SetAudit(auditFn)
+	}
+	if len(cfg.ProtectedWindows.Classes) > 0 {
+		c.SetProtectedPolicy(capture.ProtectedPolicy{
+			Windows: func() ([]capture.ProtectedWindow, error) {
+				return protectedWindows(cfg.ProtectedWindows)
+			},
+			Abort: cfg.ProtectedWindows.Action == config.ProtectAbort,
+		})
+	}
+	if err := setOverlayPolicy(c); err != nil {
+		return nil, err
+	}
+	switch {
+	case anonymizeShare:
+		c.SetAnonymizer(func(monitors []strategy.Monitor) anonymize.Profile {
+			p := anonymizeProfile(cfg.Anonymize, monitors)
+			if blurFaces {
+				p.Faces, p.BlurFaces = true, true
+			}
+			return p
+		})
+	case blurFaces:
+		c.SetAnonymizer(func([]strategy.Monitor) anonymize.Profile {
+			return anonymize.Profile{Faces: true, BlurFaces: true, Radius: cfg.Anonymize.Radius}
+		})
+	}
+	return c, nil
+}
+
+// anonymizeWarn reports a failure to find panels and windows for
+// --anonymize only once per run
+var anonymizeWarn sync.Once
+
+// anonymizeProfile builds the --anonymize profile: the configured areas,
+// plus the panels (the screen outside the work area and dock windows) and
+// the desktop around windows as the window manager reports them. Without
+// a window manager only the configured areas and faces are hidden.
+func anonymizeProfile(a config.Anonymize, monitors []strategy.Monitor) anonymize.Profile {
+	blur, redact := a.Areas(monitors)
+	p := anonymize.Profile{Blur: blur, Redact: redact, Faces: a.FacesOn(), Radius: a.Radius}
+	if !a.PanelsOn() && !a.DesktopOn() {
+		return p
+	}
+
+	warn := func(err error) {
+		anonymizeWarn.Do(func() {
+			fmt.Fprintf(os.Stderr, "Warning: --anonymize can't find panels and the desktop (%v); only configured areas and faces are hidden\n", err)
+		})
+	}
+	conn, err := xwin.Connect(display)
+	if err != nil {
+		warn(err)
+		return p
+	}
+	defer conn.Close()
+	work, err := conn.WorkArea()
+	if err != nil {
+		warn(err)
+		return p
+	}
+	windows, err := conn.Windows()
+	if err != nil {
+		warn(err)
+		return p
+	}
+
+	if a.PanelsOn() {
+		for _, m := range monitors {
+			b := m.Bounds
+			for _, r := range []image.Rectangle{
+				image.Rect(b.Min.X, b.Min.Y, b.Max.X, work.Min.Y),
+				image.Rect(b.Min.X, work.Max.Y, b.Max.X, b.Max.Y),
+				image.Rect(b.Min.X, b.Min.Y, work.Min.X, b.Max.Y),
+				image.Rect(work.Max.X, b.Min.Y, b.Max.X, b.Max.Y),
+			} {
+				if r = r.Intersect(b); !r.Empty() {
+					p.Redact = append(p.Redact, r)
+				}
+			}
+		}
+		for _, w := range windows {
+			if w.Type == "dock" && !w.Hidden {
+				p.Redact = append(p.Redact, w.Bounds)
+			}
+		}
+	}
+	if a.DesktopOn() {
+		p.Blur = append(p.Blur, work)
+		for _, w := range windows {
+			if w.Type != "desktop" && w.Type != "dock" && !w.Hidden {
+				p.Keep = append(p.Keep, w.Bounds)
+			}
+		}
+	}
+	return p
+}
+
+// protectedWindows returns the visible windows matching the configured
+// protected classes
+func protectedWindows(p config.ProtectedWindows) ([]capture.ProtectedWindow, error) {
+	conn, err := xwin.Connect(display)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	windows, err := conn.Windows()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []capture.ProtectedWindow
+	for _, w := range windows {
+		if !w.Hidden && p.Matches(w.Class, w.Instance) {
+			debugf("protected window %#x (%s) at %v", w.ID, w.Class, w.Bounds)
+			found = append(found, capture.ProtectedWindow{Class: w.Class, Bounds: w.Bounds})
+		}
+	}
+	return found, nil
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"github.com/robotin/screenshot/internal/history"
+	"github.com/robotin/screenshot/internal/xwin"
+)
+
+// captureContext returns the focused window and the pointer position on
+// display, for telling later which application a capture shows. Either is
+// nil when unknown: no X server, or no EWMH window manager for the focus.
+func captureContext(display string) (*history.Focus, *history.Point) {
+	conn, err := xwin.Connect(display)
+	if err != nil {
+		debugf("capture context: %v", err)
+		return nil, nil
+	}
+	defer conn.Close()
+
+	var focus *history.Focus
+	if w, err := conn.ActiveWindow(); err != nil {
+		debugf("capture context: %v", err)
+	} else if w != nil {
+		focus = &history.Focus{Window: w.ID, Class: w.Class, Title: w.Title, PID: w.PID}
+	}
+	var pointer *history.Point
+	if p, err := conn.Pointer(); err != nil {
+		debugf("capture context: %v", err)
+	} else {
+		pointer = &history.Point{X: p.X, Y: p.Y}
+	}
+	return focus, pointer
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/history"
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// thumbnailName is added to the file name of --thumbnail outputs
+const thumbnailName = "thumb"
+
+var derivedNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+var (
+	crops         []string
+	thumbnailSize string
+)
+
+// derivedOutputs parses --crop and --thumbnail. Crops are named
+// NAME=x,y,width,height, or crop1, crop2, ... in order.
+func derivedOutputs() ([]capture.Derived, error) {
+	var derived []capture.Derived
+	seen := map[string]bool{}
+	for i, c := range crops {
+		name, spec, ok := strings.Cut(c, "=")
+		if !ok {
+			name, spec = fmt.Sprintf("crop%d", i+1), c
+		}
+		if !derivedNameRe.MatchString(name) || name == thumbnailName {
+			return nil, fmt.Errorf("invalid --crop name %q (letters, digits, '.', '-' and '_', not %q)", name, thumbnailName)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate --crop name %q", name)
+		}
+		seen[name] = true
+		rect, err := strategy.ParseRegion(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --crop %q: %w", c, err)
+		}
+		derived = append(derived, capture.Derived{Name: name, Crop: *rect})
+	}
+	if thumbnailSize != "" {
+		size, err := parseSize(thumbnailSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --thumbnail: %w", err)
+		}
+		derived = append(derived, capture.Derived{Name: thumbnailName, Thumbnail: size})
+	}
+	return derived, nil
+}
+
+// derivedArea returns the screen area a capture with opts covers, after
+// checking the crops lie inside it, so nothing is saved if one doesn't
+func derivedArea(capturer *capture.Capturer, opts strategy.CaptureOptions, derived []capture.Derived) (image.Rectangle, error) {
+	monitors, err := capturer.ListMonitors()
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	area := capture.Area(opts, monitors)
+	for _, d := range derived {
+		if !d.Crop.Empty() && !d.Crop.In(area) {
+			return area, fmt.Errorf("--crop %s (%d,%d,%d,%d) is outside the captured area (%d,%d,%d,%d)",
+				d.Name, d.Crop.Min.X, d.Crop.Min.Y, d.Crop.Dx(), d.Crop.Dy(), area.Min.X, area.Min.Y, area.Dx(), area.Dy())
+		}
+	}
+	return area, nil
+}
+
+// derivedItems describes the derived outputs of the capture saved at path
+func derivedItems(path string, derived []capture.Derived, images []image.Image, enc capture.EncodeOptions) []resultItem {
+	items := make([]resultItem, len(derived))
+	for i, d := range derived {
+		items[i] = newResultItem(capture.DerivedPath(path, d.Name), images[i], enc)
+		items[i].DerivedFrom = path
+		if !d.Crop.Empty() {
+			items[i].Region = &history.Region{X: d.Crop.Min.X, Y: d.Crop.Min.Y, Width: d.Crop.Dx(), Height: d.Crop.Dy()}
+		}
+	}
+	return items
+}
+
+// parseSize parses a WxH size with positive dimensions
+func parseSize(s string) (image.Point, error) {
+	w, h, ok := strings.Cut(s, "x")
+	if !ok {
+		return image.Point{}, fmt.Errorf("%q is not WxH", s)
+	}
+	x, err1 := strconv.Atoi(w)
+	y, err2 := strconv.Atoi(h)
+	if err1 != nil || err2 != nil || x < 1 || y < 1 {
+		return image.Point{}, fmt.Errorf("%q is not WxH", s)
+	}
+	return image.Pt(x, y), nil
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	"github.com/robotin/screenshot/internal/annotate"
+	"github.com/robotin/screenshot/internal/diff"
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffOutput    string
+	diffHTML      string
+	diffThreshold uint8
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <before> <after>",
+	Short: "Compare two captures",
+	Long: `Compare two images of the same size pixel by pixel and report how much
+changed and where.
+
+With -o, writes the "after" image dimmed with changed pixels in red. With
+--html, writes a standalone HTML page embedding both images with a
+before/after swipe slider, for sharing visual regressions with reviewers.
+
+Examples:
+  screenshot diff before.png after.png
+  screenshot diff before.png after.png -o changes.png --threshold 8
+  screenshot diff before.png after.png --html review.html`,
+	Args: cobra.ExactArgs(2),
+	RunE: runDiff,
+}
+
+func init() {
+	diffCmd.Flags().StringVarP(&diffOutput, "output", "o", "", "Write a highlight image of the changes")
+	diffCmd.Flags().StringVar(&diffHTML, "html", "", "Write a standalone HTML before/after slider page")
+	diffCmd.Flags().Uint8Var(&diffThreshold, "threshold", 0, "Per-channel difference (0-255) still treated as equal")
+	diffCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the result as JSON")
+	rootCmd.AddCommand(diffCmd)
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	before, err := loadImage(args[0])
+	if err != nil {
+		return err
+	}
+	after, err := loadImage(args[1])
+	if err != nil {
+		return err
+	}
+
+	res, err := diff.Compare(before, after, diff.Options{Threshold: diffThreshold})
+	if err != nil {
+		return err
+	}
+	summary := diffSummary(res)
+
+	if diffOutput != "" {
+		red, _ := annotate.ParseColor("red")
+		if err := writePNG(diffOutput, diff.Highlight(after, res, red)); err != nil {
+			return err
+		}
+	}
+
+	if diffHTML != "" {
+		f, err := os.Create(diffHTML)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", diffHTML, err)
+		}
+		err = diff.WriteSliderHTML(f, diff.SliderPage{
+			Title:      filepath.Base(args[0]) + " vs " + filepath.Base(args[1]),
+			Summary:    summary,
+			BeforeName: filepath.Base(args[0]),
+			AfterName:  filepath.Base(args[1]),
+			Before:     before,
+			After:      after,
+		})
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", diffHTML, err)
+		}
+	}
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	}
+
+	fmt.Println(summary)
+	if diffOutput != "" {
+		infof("Highlight saved: %s", diffOutput)
+	}
+	if diffHTML != "" {
+		infof("Comparison page saved: %s", diffHTML)
+	}
+	return nil
+}
+
+// diffSummary describes a diff result in one line
+func diffSummary(res *diff.Result) string {
+	if res.Changed == 0 {
+		return fmt.Sprintf("Identical (%dx%d)", res.Width, res.Height)
+	}
+	b := res.Bounds
+	return fmt.Sprintf("Changed: %d pixels (%.2f%%) within %d,%d,%d,%d",
+		res.Changed, res.Ratio*100, b.Min.X, b.Min.Y, b.Dx(), b.Dy())
+}
+
+// loadImage decodes a PNG, JPEG or QOI file
+func loadImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return img, nil
+}
+
+// writePNG saves an image as PNG
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/robotin/screenshot/internal/strategy"
+	"github.com/spf13/cobra"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check whether captures can work here and explain what's missing",
+	Long: `Check the environment: the display server, which capture backends can
+run, whether the selected backend finds monitors, and known limitations
+of the platform (such as ChromeOS's Linux container, where only the
+container's own X11 windows can be captured). Exits with status 1 if a
+capture can't work.
+
+Examples:
+  screenshot doctor
+  screenshot doctor -d :1
+  screenshot doctor --json`,
+	Args: cobra.NoArgs,
+	RunE: runDoctor,
+}
+
+func init() {
+	doctorCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the checks as JSON")
+	doctorCmd.Flags().StringVarP(&display, "display", "d", "", "X11 display (default: $DISPLAY or :0)")
+	rootCmd.AddCommand(doctorCmd)
+}
+
+// doctorCheck is one finding of the doctor or selftest command
+type doctorCheck struct {
+	Name string `json:"name"`
+
+	// Status is ok, warn (captures work with limitations) or fail
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	if display != "" {
+		os.Setenv("DISPLAY", display)
+	}
+
+	return printChecks(doctorChecks())
+}
+
+// printChecks prints doctor or selftest checks, as text or with --json,
+// and exits with status 1 if one failed
+func printChecks(checks []doctorCheck) error {
+	failed := false
+	for _, c := range checks {
+		failed = failed || c.Status == "fail"
+	}
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(checks); err != nil {
+			return err
+		}
+	} else {
+		for _, c := range checks {
+			fmt.Printf("[%-4s] %-9s %s\n", c.Status, c.Name, strings.Join(wrapWords(c.Detail, 62), "\n"+strings.Repeat(" ", 17)))
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// doctorChecks runs the checks in order
+func doctorChecks() []doctorCheck {
+	var checks []doctorCheck
+	add := func(name, status, format string, args ...any) {
+		checks = append(checks, doctorCheck{Name: name, Status: status, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	add("platform", "ok", "%s/%s, %s", runtime.GOOS, runtime.GOARCH, sessionDescription())
+
+	if strategy.InCrostini() {
+		add("crostini", "warn", "ChromeOS Linux container: only this container's X11 app windows can be "+
+			"captured (the crostini backend paints them on black). The ChromeOS desktop, "+
+			"browser, Android apps and Wayland apps stay black; use ChromeOS's own "+
+			"screenshot tool (Ctrl+Show windows) for those.")
+	}
+
+	var available []string
+	for _, reg := range strategy.Registered() {
+		if reg.Explicit {
+			continue
+		}
+		if s, err := strategy.Lookup(reg.Name); err == nil && s.Available() {
+			available = append(available, reg.Name)
+		}
+	}
+	switch {
+	case len(available) > 0:
+		add("backends", "ok", "available: %s", strings.Join(available, ", "))
+	case backendName != "":
+		add("backends", "warn", "none can run automatically, using --backend %s", backendName)
+	default:
+		add("backends", "fail", "no capture backend can run here (is $DISPLAY right? Without X, "+
+			"run as root for kms or join the video group for fbdev)")
+		return checks
+	}
+
+	auditDestination = "doctor"
+	capturer, err := newCapturer()
+	if err != nil {
+		add("capture", "fail", "%v", err)
+		return checks
+	}
+	s, err := capturer.GetStrategy()
+	if err != nil {
+		add("capture", "fail", "%v", err)
+		return checks
+	}
+	monitors, err := capturer.ListMonitors()
+	if err != nil {
+		add("capture", "fail", "%s backend: %v", s.Name(), err)
+		return checks
+	}
+	names := make([]string, len(monitors))
+	for i, m := range monitors {
+		names[i] = fmt.Sprintf("%s %dx%d", m.Name, m.Bounds.Dx(), m.Bounds.Dy())
+	}
+	add("capture", "ok", "%s backend, %d monitor(s): %s", s.Name(), len(monitors), strings.Join(names, ", "))
+
+	if os.Getenv("WAYLAND_DISPLAY") != "" && s.Name() == "x11" {
+		add("wayland", "warn", "Wayland session: through XWayland only X11 app windows are visible, "+
+			"native Wayland windows may come out black")
+	}
+	return checks
+}
+
+// sessionDescription summarizes the display server environment
+func sessionDescription() string {
+	var parts []string
+	if t := os.Getenv("XDG_SESSION_TYPE"); t != "" {
+		parts = append(parts, t+" session")
+	}
+	if d := os.Getenv("DISPLAY"); d != "" {
+		parts = append(parts, "DISPLAY="+d)
+	}
+	if d := os.Getenv("WAYLAND_DISPLAY"); d != "" {
+		parts = append(parts, "WAYLAND_DISPLAY="+d)
+	}
+	if len(parts) == 0 {
+		return "no display server in the environment"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// wrapWords splits text into lines of at most width characters, breaking
+// at spaces
+func wrapWords(text string, width int) []string {
+	var lines []string
+	line := ""
+	for _, w := range strings.Fields(text) {
+		if line != "" && len(line)+1+len(w) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += w
+	}
+	return append(lines, line)
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// envFlags are the flags set from the environment, by flag name, with the
+// variable each came from
+var envFlags = map[string]string{}
+
+// flagEnvVar returns the environment variable a flag is read from:
+// --output-dir from $SCREENSHOT_OUTPUT_DIR
+func flagEnvVar(name string) string {
+	return "SCREENSHOT_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyEnv sets the flags of cmd not given on the command line from their
+// environment variables, as if they had been. Command line flags win over
+// the environment, which wins over the config file. Empty variables are
+// ignored.
+//
+// Only capture flags (the root command's) and the global flags are read
+// from the environment. A subcommand's own flags often share a name with a
+// capture flag but not its meaning (history export --format, recover -o),
+// so $SCREENSHOT_FORMAT must not reach them.
+func applyEnv(cmd *cobra.Command) error {
+	root := cmd.Root()
+	flags := cmd.Flags()
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || f.Name == "help" {
+			return
+		}
+		if cmd != root && root.PersistentFlags().Lookup(f.Name) != f {
+			return
+		}
+		name := flagEnvVar(f.Name)
+		v := os.Getenv(name)
+		if v == "" {
+			return
+		}
+		if e := flags.Set(f.Name, v); e != nil {
+			err = fmt.Errorf("$%s: %w", name, e)
+			return
+		}
+		envFlags[f.Name] = name
+	})
+	return err
+}
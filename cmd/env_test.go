@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// findCommand looks up a command and merges in the global flags, as
+// parsing its command line would
+func findCommand(t *testing.T, args ...string) *cobra.Command {
+	t.Helper()
+	cmd, _, err := rootCmd.Find(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.ParseFlags(nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Flags().VisitAll(func(f *pflag.Flag) {
+			if f.Changed {
+				f.Value.Set(f.DefValue)
+				f.Changed = false
+			}
+		})
+		clear(envFlags)
+	})
+	return cmd
+}
+
+func TestApplyEnvSubcommandFlags(t *testing.T) {
+	t.Setenv("SCREENSHOT_FORMAT", "jpeg")
+	t.Setenv("SCREENSHOT_OUTPUT", "elsewhere.png")
+	t.Setenv("SCREENSHOT_LOG", "other.log")
+
+	for _, args := range [][]string{{"history", "export"}, {"recover"}, {"heatmap"}, {"audit", "verify"}} {
+		cmd := findCommand(t, args...)
+		if err := applyEnv(cmd); err != nil {
+			t.Fatalf("%s: %v", cmd.CommandPath(), err)
+		}
+		for _, name := range []string{"format", "output", "log"} {
+			if f := cmd.Flags().Lookup(name); f != nil && f.Changed {
+				t.Errorf("%s --%s was set from the environment to %q", cmd.CommandPath(), name, f.Value)
+			}
+		}
+	}
+}
+
+func TestApplyEnvGlobalFlags(t *testing.T) {
+	t.Setenv("SCREENSHOT_BACKEND", "synthetic")
+
+	cmd := findCommand(t, "history", "export")
+	if err := applyEnv(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if f := cmd.Flags().Lookup("backend"); !f.Changed || f.Value.String() != "synthetic" {
+		t.Errorf("--backend is %q, want synthetic from $SCREENSHOT_BACKEND", f.Value)
+	}
+}
+
+func TestApplyEnvCaptureFlags(t *testing.T) {
+	t.Setenv("SCREENSHOT_FORMAT", "jpeg")
+	t.Setenv("SCREENSHOT_QUALITY", "70")
+
+	cmd := findCommand(t)
+	if err := cmd.Flags().Set("quality", "50"); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyEnv(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if format != "jpeg" || envFlags["format"] != "SCREENSHOT_FORMAT" {
+		t.Errorf("--format is %q, want jpeg from $SCREENSHOT_FORMAT", format)
+	}
+	// The command line wins
+	if quality != 50 {
+		t.Errorf("--quality is %d, want 50 from the command line", quality)
+	}
+}
+
+func TestApplyEnvInvalid(t *testing.T) {
+	t.Setenv("SCREENSHOT_QUALITY", "high")
+
+	if err := applyEnv(findCommand(t)); err == nil {
+		t.Error("invalid $SCREENSHOT_QUALITY was accepted")
+	}
+}
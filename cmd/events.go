@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/robotin/screenshot/internal/events"
+)
+
+// eventsJSONL is the --events format that prints one JSON event per line
+const eventsJSONL = "jsonl"
+
+var (
+	eventsFormat string
+
+	// eventBus carries the lifecycle events of every capture in the run
+	eventBus = &events.Bus{}
+)
+
+// setupEvents applies --events: events go to stderr, so they never mix
+// with image data or --json on stdout. With --json alone, progress events
+// of slow operations go there too, in place of progress bars.
+func setupEvents() error {
+	switch eventsFormat {
+	case "":
+		if jsonOutput {
+			write := events.JSONLines(os.Stderr)
+			eventBus.Subscribe(func(e events.Event) {
+				if e.Type == events.Progress {
+					write(e)
+				}
+			})
+		}
+	case eventsJSONL:
+		eventBus.Subscribe(events.JSONLines(os.Stderr))
+	default:
+		return fmt.Errorf("unknown --events format %q (supported: %s)", eventsFormat, eventsJSONL)
+	}
+	return nil
+}
+
+// publishWritten reports a saved capture
+func publishWritten(item resultItem) {
+	eventBus.Publish(events.Event{Type: events.FileWritten, Path: item.Path, Width: item.Width, Height: item.Height})
+}
+
+// publishUpload reports how uploading a capture ended: uploaded (item.URL
+// set), queued to retry, or failed with err
+func publishUpload(item resultItem, err error) {
+	e := events.Event{Type: events.UploadFinished, Path: item.Path, URL: item.URL, Queued: item.Queued}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	eventBus.Publish(e)
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"sync"
+
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/feedback"
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// captureFeedback returns the capturer's feedback function for --flash
+// and --sound. Each kind of failure is reported once, so interval mode
+// doesn't repeat the same warning every capture.
+func captureFeedback(flash, sound bool) func(area image.Rectangle) {
+	var flashWarn, soundWarn sync.Once
+	return func(area image.Rectangle) {
+		// Start the sound first so it plays during the flash
+		if sound {
+			if err := feedback.Shutter(); err != nil {
+				soundWarn.Do(func() { fmt.Fprintf(os.Stderr, "Warning: %v\n", err) })
+			}
+		}
+		if flash {
+			if err := feedback.Flash(display, area); err != nil {
+				flashWarn.Do(func() { fmt.Fprintf(os.Stderr, "Warning: flash failed: %v\n", err) })
+			}
+		}
+	}
+}
+
+// osd shows where a capture went on the monitor it was taken on, and
+// opens it if the OSD is clicked. Failures are only warnings: the capture
+// itself succeeded.
+func osd(capturer *capture.Capturer, opts strategy.CaptureOptions, location string) {
+	monitors, err := capturer.ListMonitors()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: OSD not shown: %v\n", err)
+		return
+	}
+	clicked, err := feedback.OSD(display, osdMonitor(monitors, opts), location)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: OSD not shown: %v\n", err)
+		return
+	}
+	if clicked {
+		if err := openFile(location); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to open %s: %v\n", location, err)
+		}
+	}
+}
+
+// osdMonitor returns the bounds of the monitor holding the middle of the
+// captured region, the captured monitor, or else the primary one
+func osdMonitor(monitors []strategy.Monitor, opts strategy.CaptureOptions) image.Rectangle {
+	if len(monitors) == 0 {
+		return image.Rectangle{}
+	}
+	for _, m := range monitors {
+		if opts.Region != nil {
+			r := *opts.Region
+			if r.Min.Add(r.Size().Div(2)).In(m.Bounds) {
+				return m.Bounds
+			}
+		} else if m.Index == opts.Monitor {
+			return m.Bounds
+		}
+	}
+	for _, m := range monitors {
+		if m.Primary {
+			return m.Bounds
+		}
+	}
+	return monitors[0].Bounds
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"image"
+	"path/filepath"
+	"strings"
+
+	"github.com/robotin/screenshot/internal/capture"
+)
+
+// autoFormat returns the --format auto thresholds from the config
+func autoFormat() (capture.AutoFormat, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return capture.AutoFormat{}, err
+	}
+	a := capture.AutoFormat{MaxColors: cfg.AutoFormat.MaxColors, PhotoShare: cfg.AutoFormat.PhotoShare}
+	if cfg.AutoFormat.Photo != "" {
+		// Validated when the config was loaded
+		if a.Photo, err = capture.ParseFormat(cfg.AutoFormat.Photo); err != nil {
+			return a, err
+		}
+	}
+	return a, nil
+}
+
+// resolveFormat picks the format of a --format auto capture, giving path
+// the extension to match. Other captures are left as they are.
+func resolveFormat(img image.Image, enc capture.EncodeOptions, path string) (capture.EncodeOptions, string) {
+	if enc.Format != capture.FormatAuto {
+		return enc, path
+	}
+	enc.Format = capture.ChooseFormat(img, enc.Auto)
+	debugf("--format auto chose %s", enc.Format)
+	if _, ok := capture.FormatFromPath(path); ok {
+		path = strings.TrimSuffix(path, filepath.Ext(path)) + enc.Format.Extension()
+	}
+	return enc, path
+}
+
+var (
+	// maxSizeFlag is --max-size as given, e.g. 500KB
+	maxSizeFlag string
+
+	// maxSize is --max-size in bytes, 0 for no limit
+	maxSize int64
+)
+
+// fitSize makes a capture about to be saved fit --max-size, returning
+// the image and options to save with and what it took, nil without a
+// limit
+func fitSize(img image.Image, enc capture.EncodeOptions) (image.Image, capture.EncodeOptions, *capture.Fit, error) {
+	if maxSize <= 0 {
+		return img, enc, nil, nil
+	}
+	out, enc, fit, err := capture.FitSize(img, enc, maxSize)
+	if err != nil {
+		return nil, enc, nil, err
+	}
+	if fit.Scale < 1 {
+		infof("Scaled to %.0f%% to fit in %s", 100*fit.Scale, maxSizeFlag)
+	}
+	debugf("--max-size: quality %d, scale %g, %d bytes", fit.Quality, fit.Scale, fit.Bytes)
+	return out, enc, &fit, nil
+}
+
+// withFit records in item what --max-size did to its image
+func withFit(item *resultItem, img image.Image, fit *capture.Fit) {
+	if fit == nil {
+		return
+	}
+	item.img = img
+	item.Width, item.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	item.Fit = fit
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/history"
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// copyClipboard is --clipboard
+var copyClipboard bool
+
+// frame is the one capture of a single-capture run. Every output is made
+// from its pixels: the file, --crop and --thumbnail, --clipboard, the
+// upload and webhook, the --locate overlay and the menu's actions, so
+// all of them show the same instant. Outputs must not draw on img; those
+// that change pixels (overlays, thumbnails) work on copies.
+type frame struct {
+	img      image.Image
+	opts     strategy.CaptureOptions
+	attempts int
+	stats    capture.Stats
+
+	// focus and pointer are what the user was working in as it was taken
+	focus   *history.Focus
+	pointer *history.Point
+
+	// fitted is the image saved under --max-size, and fit what it took
+	fitted image.Image
+	fit    *capture.Fit
+}
+
+// captureFrame takes the capture all outputs of a run are made from
+func captureFrame(capturer *capture.Capturer, opts strategy.CaptureOptions) (*frame, error) {
+	focus, pointer := captureContext(opts.Display)
+	img, attempts, cs, err := capturer.CaptureTimed(opts)
+	if err != nil {
+		return nil, fmt.Errorf("capture failed after %d attempt(s): %w", attempts, err)
+	}
+	debugf("captured %dx%d in %d attempt(s)", img.Bounds().Dx(), img.Bounds().Dy(), attempts)
+	return &frame{img: img, opts: opts, attempts: attempts, stats: cs, focus: focus, pointer: pointer}, nil
+}
+
+// result builds the --json result for the frame saved at path
+func (f *frame) result(path string, enc capture.EncodeOptions) captureResult {
+	res := singleResult(path, f.img, enc, f.attempts)
+	res.Items[0].Region = capturedRegion(f.opts)
+	res.Items[0].Focus, res.Items[0].Pointer = f.focus, f.pointer
+	withFit(&res.Items[0], f.fitted, f.fit)
+	return res
+}
+
+// fitSize makes the frame's file fit --max-size, returning the image and
+// options to save it with
+func (f *frame) fitSize(enc capture.EncodeOptions) (image.Image, capture.EncodeOptions, error) {
+	out, enc, fit, err := fitSize(f.img, enc)
+	f.fitted, f.fit = out, fit
+	return out, enc, err
+}
+
+// toClipboard puts the frame on the clipboard as PNG, whatever format
+// the file is saved in
+func (f *frame) toClipboard() error {
+	return copyToClipboard(f.img)
+}
+
+// copyToClipboard puts an image on the clipboard as PNG using wl-copy or
+// xclip
+func copyToClipboard(img image.Image) error {
+	var cmd *exec.Cmd
+	switch {
+	case os.Getenv("WAYLAND_DISPLAY") != "" && hasCommand("wl-copy"):
+		cmd = exec.Command("wl-copy", "--type", "image/png")
+	case hasCommand("xclip"):
+		cmd = exec.Command("xclip", "-selection", "clipboard", "-t", "image/png", "-i")
+	default:
+		return errors.New("copying needs xclip (X11) or wl-copy (Wayland)")
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(png.Encode(w, img))
+	}()
+	cmd.Stdin = r
+	err := cmd.Run()
+	r.Close()
+	if err != nil {
+		return fmt.Errorf("failed to copy to clipboard: %w", err)
+	}
+	return nil
+}
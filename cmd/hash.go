@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/robotin/screenshot/internal/imghash"
+	"github.com/spf13/cobra"
+)
+
+var (
+	hashType        string
+	hashAgainst     string
+	hashMaxDistance int
+)
+
+var hashCmd = &cobra.Command{
+	Use:   "hash",
+	Short: "Print a hash of a screen area",
+	Long: `Capture an area and print a hash of its pixels instead of encoding an
+image, so scripts can cheaply poll whether it changed.
+
+Hash types (--type):
+  exact   FNV-1a of the pixels: changes with any pixel (default)
+  ahash   Average hash (perceptual, 64 bits)
+  dhash   Difference hash (perceptual, robust to scaling and color shifts)
+  phash   DCT hash (perceptual, robust to compression and small edits)
+
+With --against, exit with status 1 when the area's hash differs from the
+given one by more than --max-distance bits (0 for exact hashes; around 5
+suits perceptual ones).
+
+Examples:
+  screenshot hash --region 0,0,400,300
+  screenshot hash -m 1 --type dhash --json
+  h=$(screenshot hash --region 10,10,200,50)
+  while screenshot hash --region 10,10,200,50 --against "$h"; do sleep 1; done`,
+	Args: cobra.NoArgs,
+	RunE: runHash,
+}
+
+func init() {
+	hashCmd.Flags().StringVar(&region, "region", "", "Region to hash: x,y,width,height")
+	hashCmd.Flags().StringVarP(&monitor, "monitor", "m", "", "Monitor to hash: index, output name or virtual monitor (default: all)")
+	hashCmd.Flags().StringVar(&window, "window", "", "Window to hash: active, an X window ID, or a title/class pattern")
+	hashCmd.Flags().StringVar(&hashType, "type", string(imghash.Exact), "Hash type: exact, ahash, dhash or phash")
+	hashCmd.Flags().StringVar(&hashAgainst, "against", "", "Exit with status 1 if the hash differs from this one")
+	hashCmd.Flags().IntVar(&hashMaxDistance, "max-distance", 0, "Differing bits allowed by --against")
+	hashCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print every hash type as JSON")
+	hashCmd.Flags().StringVarP(&display, "display", "d", "", "X11 display (default: $DISPLAY or :0)")
+	rootCmd.AddCommand(hashCmd)
+}
+
+func runHash(cmd *cobra.Command, args []string) error {
+	t, err := imghash.ParseType(hashType)
+	if err != nil {
+		return err
+	}
+	var against uint64
+	if hashAgainst != "" {
+		if against, err = imghash.Parse(hashAgainst); err != nil {
+			return err
+		}
+	}
+	if display != "" {
+		os.Setenv("DISPLAY", display)
+	}
+
+	auditDestination = "hash"
+	capturer, err := newCapturer()
+	if err != nil {
+		return err
+	}
+	opts, err := buildCaptureOptions(capturer)
+	if err != nil {
+		return err
+	}
+	img, err := capturer.Capture(opts)
+	if err != nil {
+		return fmt.Errorf("capture failed: %w", err)
+	}
+	sum := imghash.Sum(img, t)
+
+	if jsonOutput {
+		out := map[string]any{
+			"width":  img.Bounds().Dx(),
+			"height": img.Bounds().Dy(),
+		}
+		for _, t := range imghash.Types {
+			out[string(t)] = imghash.Format(imghash.Sum(img, t))
+		}
+		if hashAgainst != "" {
+			out["distance"] = imghash.Distance(sum, against)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			return err
+		}
+	} else {
+		fmt.Println(imghash.Format(sum))
+	}
+
+	if hashAgainst != "" && imghash.Distance(sum, against) > hashMaxDistance {
+		os.Exit(1)
+	}
+	return nil
+}
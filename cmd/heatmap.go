@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/robotin/screenshot/internal/diff"
+	"github.com/robotin/screenshot/internal/heatmap"
+	"github.com/robotin/screenshot/internal/history"
+	"github.com/robotin/screenshot/internal/upload"
+	"github.com/spf13/cobra"
+)
+
+// heatmapCellSize is the size of the areas ranked as most active
+const heatmapCellSize = 64
+
+var (
+	heatmapSince     time.Duration
+	heatmapOutput    string
+	heatmapThreshold uint8
+	heatmapTag       string
+	heatmapTop       int
+)
+
+var heatmapCmd = &cobra.Command{
+	Use:   "heatmap",
+	Short: "Show which screen areas changed most over recent captures",
+	Long: `Compare consecutive captures in the history (usually taken with
+--interval) from the last --since and render a heat-map of how often each
+pixel changed, over the latest capture: blue areas changed rarely, red ones
+as often as the busiest. Areas that never changed keep the dimmed capture;
+on a kiosk or dashboard they are where burn-in is most likely.
+
+Also prints the share of the screen that never changed and the most active
+areas. Only captures saved locally and still on disk are used; when
+captures of several sizes are found, the most common size is analyzed.
+--tag keeps captures taken with that --tag.
+
+Examples:
+  screenshot heatmap --since 8h
+  screenshot heatmap --since 24h --tag lobby-display -o lobby-heat.png
+  screenshot heatmap --since 2h --threshold 8 --json`,
+	Args: cobra.NoArgs,
+	RunE: runHeatmap,
+}
+
+func init() {
+	heatmapCmd.Flags().DurationVar(&heatmapSince, "since", 24*time.Hour, "Analyze captures taken within this long")
+	heatmapCmd.Flags().StringVarP(&heatmapOutput, "output", "o", "heatmap.png", "Heat-map image to write")
+	heatmapCmd.Flags().Uint8Var(&heatmapThreshold, "threshold", 0, "Per-channel difference (0-255) still treated as equal")
+	heatmapCmd.Flags().StringVar(&heatmapTag, "tag", "", "Only use captures with this tag")
+	heatmapCmd.Flags().IntVar(&heatmapTop, "top", 5, "Number of most active areas to list")
+	heatmapCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the result as JSON")
+	rootCmd.AddCommand(heatmapCmd)
+}
+
+// heatmapArea is an active area in --json output
+type heatmapArea struct {
+	X      int     `json:"x"`
+	Y      int     `json:"y"`
+	Width  int     `json:"width"`
+	Height int     `json:"height"`
+	Ratio  float64 `json:"ratio"`
+}
+
+// heatmapResult is the heatmap --json output
+type heatmapResult struct {
+	Captures  int           `json:"captures"`
+	Skipped   int           `json:"skipped"`
+	Intervals int           `json:"intervals"`
+	Width     int           `json:"width"`
+	Height    int           `json:"height"`
+	From      time.Time     `json:"from"`
+	To        time.Time     `json:"to"`
+	Static    float64       `json:"static_ratio"`
+	Hottest   []heatmapArea `json:"hottest"`
+	Output    string        `json:"output"`
+}
+
+func runHeatmap(cmd *cobra.Command, args []string) error {
+	entries, err := heatmapEntries()
+	if err != nil {
+		return err
+	}
+
+	series, err := loadHeatmapSeries(entries)
+	if err != nil {
+		return err
+	}
+	m := series.m
+
+	if err := writePNG(heatmapOutput, m.Render(series.latest)); err != nil {
+		return err
+	}
+
+	res := heatmapResult{
+		Captures:  len(series.times),
+		Skipped:   series.skipped,
+		From:      series.times[0],
+		To:        series.times[len(series.times)-1],
+		Intervals: m.Intervals,
+		Width:     m.Width,
+		Height:    m.Height,
+		Static:    m.Static(),
+		Hottest:   []heatmapArea{},
+		Output:    heatmapOutput,
+	}
+	for _, c := range m.Hottest(heatmapCellSize, heatmapTop) {
+		b := c.Bounds
+		res.Hottest = append(res.Hottest, heatmapArea{b.Min.X, b.Min.Y, b.Dx(), b.Dy(), c.Ratio})
+	}
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	}
+
+	fmt.Printf("Analyzed %d captures (%dx%d) from %s to %s\n", res.Captures, res.Width, res.Height,
+		res.From.Format(time.DateTime), res.To.Format(time.DateTime))
+	if res.Skipped > 0 {
+		fmt.Printf("Skipped %d captures that were missing, unreadable or of another size\n", res.Skipped)
+	}
+	fmt.Printf("Never changed: %.1f%% of the screen\n", res.Static*100)
+	if len(res.Hottest) > 0 {
+		fmt.Println("Most active areas:")
+		for _, a := range res.Hottest {
+			fmt.Printf("  %d,%d %dx%d: changed in %.0f%% of intervals\n", a.X, a.Y, a.Width, a.Height, a.Ratio*100)
+		}
+	}
+	infof("Heat-map saved: %s", heatmapOutput)
+	return nil
+}
+
+// heatmapSeries is a run of captures of the same size, diffed into a
+// heat-map
+type heatmapSeries struct {
+	m *heatmap.Map
+
+	// latest is the last capture and times the capture times, indexed by
+	// capture number
+	latest image.Image
+	times  []time.Time
+
+	// skipped counts captures that couldn't be read or had another size
+	skipped int
+}
+
+// loadHeatmapSeries decodes entries in order and adds the changes
+// between consecutive ones to a heat-map
+func loadHeatmapSeries(entries []history.Entry) (*heatmapSeries, error) {
+	if len(entries) < 2 {
+		return nil, fmt.Errorf("need at least 2 captures from the last %s in the history, found %d", heatmapSince, len(entries))
+	}
+
+	s := &heatmapSeries{}
+	for _, e := range entries {
+		img, err := loadImage(e.Path)
+		if err != nil {
+			debugf("heatmap: skipping %s: %v", e.Path, err)
+			s.skipped++
+			continue
+		}
+		b := img.Bounds()
+		if s.m == nil {
+			s.m = heatmap.New(b.Dx(), b.Dy())
+		}
+		if b.Dx() != s.m.Width || b.Dy() != s.m.Height {
+			debugf("heatmap: skipping %s: %dx%d, not %dx%d", e.Path, b.Dx(), b.Dy(), s.m.Width, s.m.Height)
+			s.skipped++
+			continue
+		}
+		if s.latest != nil {
+			d, err := diff.Compare(s.latest, img, diff.Options{Threshold: heatmapThreshold})
+			if err != nil {
+				return nil, err
+			}
+			if err := s.m.Add(d); err != nil {
+				return nil, err
+			}
+		}
+		s.latest = img
+		s.times = append(s.times, e.Time)
+	}
+	if s.m == nil || s.m.Intervals == 0 {
+		return nil, errors.New("no two captures of the same size could be read")
+	}
+	return s, nil
+}
+
+// heatmapEntries returns the history entries to analyze, oldest first:
+// local, untrashed captures from the last --since with --tag, of the
+// most common size
+func heatmapEntries() ([]history.Entry, error) {
+	db, err := history.Open()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := db.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	since := time.Now().Add(-heatmapSince)
+	var found []history.Entry
+	sizes := map[image.Point]int{}
+	for _, e := range entries {
+		if e.TrashedAt != nil || e.Time.Before(since) {
+			continue
+		}
+		if heatmapTag != "" && !slices.Contains(e.Tags, heatmapTag) {
+			continue
+		}
+		if _, _, remote := upload.SplitObjectURI(e.Path); remote {
+			continue
+		}
+		if _, err := os.Stat(e.Path); err != nil {
+			continue
+		}
+		found = append(found, e)
+		sizes[image.Pt(e.Width, e.Height)]++
+	}
+
+	// Entries without a recorded size are kept and checked when decoded
+	var common image.Point
+	best := 0
+	for size, n := range sizes {
+		if size != (image.Point{}) && (n > best || n == best && size.X*size.Y > common.X*common.Y) {
+			common, best = size, n
+		}
+	}
+	if common == (image.Point{}) {
+		return found, nil
+	}
+	return slices.DeleteFunc(found, func(e history.Entry) bool {
+		size := image.Pt(e.Width, e.Height)
+		return size != common && size != (image.Point{})
+	}), nil
+}
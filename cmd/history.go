@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robotin/screenshot/internal/history"
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyFormat  string
+	historyOutput  string
+	historyTag     string
+	historySince   string
+	historyUntil   string
+	historyMonitor int
+	historyOCR     bool
+
+	historyLimit      int
+	historyThumbnails bool
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Work with the capture history",
+}
+
+var historyExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the capture history as CSV or Parquet",
+	Long: `Write the capture history as a table, one row per capture: id, time,
+host, path, format, width, height, monitor, tags (comma separated), upload
+target, provider and URL, when it was undone (trashed_at), and the focused
+window's class, title and pid and the pointer position at capture time.
+
+The format is csv or parquet (--format, or the -o file extension; CSV by
+default). Parquet files load directly into DuckDB, Spark, pandas and
+other analytics tools.
+
+--since and --until take a date (2024-05-01), a time (2024-05-01T14:00:00,
+local unless it has a zone) or a duration back from now (8h, 7d). --ocr adds
+an ocr_text column with the text tesseract finds in each capture that is
+still on disk.
+
+Examples:
+  screenshot history export > history.csv
+  screenshot history export --since 7d --tag kiosk -o week.parquet
+  screenshot history export --since 2024-05-01 --until 2024-06-01 --monitor 0 --ocr -o may.csv`,
+	Args: cobra.NoArgs,
+	RunE: runHistoryExport,
+}
+
+var historyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List recent captures",
+	Long: `List the captures in the history, newest first: id, time, size and
+path, marking the ones that were undone.
+
+--thumbnails adds the path of a small PNG preview of each capture, from a
+cache in the state directory. Captures get theirs when they are taken;
+older ones are made from the file the first time they are listed, so
+no capture is decoded twice. Older captures whose file is remote or
+can't be decoded (SVG, HEIF, PDF) have none.
+
+--since, --until, --tag and --monitor filter as in history export.
+
+Examples:
+  screenshot history list -n 10
+  screenshot history list --since 24h --thumbnails
+  screenshot history list --tag kiosk --json`,
+	Args: cobra.NoArgs,
+	RunE: runHistoryList,
+}
+
+func init() {
+	historyListCmd.Flags().IntVarP(&historyLimit, "limit", "n", 20, "Most captures to list (0 for all)")
+	historyListCmd.Flags().BoolVar(&historyThumbnails, "thumbnails", false, "Add the path of each capture's cached thumbnail")
+	historyListCmd.Flags().StringVar(&historyTag, "tag", "", "Only list captures with this tag")
+	historyListCmd.Flags().StringVar(&historySince, "since", "", "Only list captures taken at or after this date, time or duration ago")
+	historyListCmd.Flags().StringVar(&historyUntil, "until", "", "Only list captures taken before this date, time or duration ago")
+	historyListCmd.Flags().IntVar(&historyMonitor, "monitor", -1, "Only list captures of this monitor index")
+	historyListCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the captures as JSON")
+	historyCmd.AddCommand(historyListCmd)
+
+	historyExportCmd.Flags().StringVar(&historyFormat, "format", "", "Export format: csv or parquet (default: from the -o extension, else csv)")
+	historyExportCmd.Flags().StringVarP(&historyOutput, "output", "o", "", "File to write (default: stdout)")
+	historyExportCmd.Flags().StringVar(&historyTag, "tag", "", "Only export captures with this tag")
+	historyExportCmd.Flags().StringVar(&historySince, "since", "", "Only export captures taken at or after this date, time or duration ago")
+	historyExportCmd.Flags().StringVar(&historyUntil, "until", "", "Only export captures taken before this date, time or duration ago")
+	historyExportCmd.Flags().IntVar(&historyMonitor, "monitor", -1, "Only export captures of this monitor index")
+	historyExportCmd.Flags().BoolVar(&historyOCR, "ocr", false, "Add the text in each capture (needs tesseract)")
+	historyCmd.AddCommand(historyExportCmd)
+	rootCmd.AddCommand(historyCmd)
+}
+
+func runHistoryExport(cmd *cobra.Command, args []string) error {
+	format := historyFormat
+	if format == "" {
+		format = history.FormatCSV
+		if strings.EqualFold(filepath.Ext(historyOutput), ".parquet") {
+			format = history.FormatParquet
+		}
+	}
+	if format != history.FormatCSV && format != history.FormatParquet {
+		return fmt.Errorf("unknown export format %q (expected csv or parquet)", format)
+	}
+	if historyOCR && !hasCommand("tesseract") {
+		return fmt.Errorf("--ocr needs tesseract on $PATH")
+	}
+
+	entries, _, err := filteredHistory()
+	if err != nil {
+		return err
+	}
+
+	var ocr []string
+	if historyOCR {
+		ocr = make([]string, len(entries))
+		for i, e := range entries {
+			if ocr[i], err = ocrText(e.Path); err != nil {
+				debugf("ocr: %s: %v", e.Path, err)
+			}
+		}
+	}
+
+	if historyOutput == "" {
+		if format == history.FormatParquet {
+			if err := checkBinaryStdout("Parquet data", "> history.parquet"); err != nil {
+				return err
+			}
+		}
+		w := bufio.NewWriter(os.Stdout)
+		if err := history.Export(w, format, entries, ocr); err != nil {
+			return stdoutError(err)
+		}
+		return stdoutError(w.Flush())
+	}
+
+	f, err := os.Create(historyOutput)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", historyOutput, err)
+	}
+	err = history.Export(f, format, entries, ocr)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", historyOutput, err)
+	}
+	infof("Exported %d captures: %s", len(entries), historyOutput)
+	return nil
+}
+
+// filteredHistory returns the history entries matching --tag, --since,
+// --until and --monitor, oldest first, and all of them
+func filteredHistory() ([]history.Entry, []history.Entry, error) {
+	filter := history.Filter{Tag: historyTag}
+	var err error
+	if filter.Since, err = parseTimeBound(historySince); err != nil {
+		return nil, nil, fmt.Errorf("invalid --since: %w", err)
+	}
+	if filter.Until, err = parseTimeBound(historyUntil); err != nil {
+		return nil, nil, fmt.Errorf("invalid --until: %w", err)
+	}
+	if historyMonitor >= 0 {
+		filter.Monitor = &historyMonitor
+	}
+
+	db, err := history.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	all, err := db.Entries()
+	if err != nil {
+		return nil, nil, err
+	}
+	var entries []history.Entry
+	for _, e := range all {
+		if filter.Match(e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, all, nil
+}
+
+// historyListItem is a capture as history list --json prints it
+type historyListItem struct {
+	history.Entry
+	Thumbnail string `json:"thumbnail,omitempty"`
+}
+
+func runHistoryList(cmd *cobra.Command, args []string) error {
+	entries, all, err := filteredHistory()
+	if err != nil {
+		return err
+	}
+
+	var items []historyListItem
+	for i := len(entries) - 1; i >= 0 && (historyLimit <= 0 || len(items) < historyLimit); i-- {
+		item := historyListItem{Entry: entries[i]}
+		if historyThumbnails {
+			if item.Thumbnail, err = history.Thumbnail(entries[i]); err != nil {
+				debugf("%v", err)
+			}
+		}
+		items = append(items, item)
+	}
+	if historyThumbnails {
+		if n, err := history.PruneThumbnails(all); err == nil && n > 0 {
+			debugf("pruned %d thumbnail(s) of captures no longer in the history", n)
+		}
+	}
+
+	if jsonOutput {
+		if items == nil {
+			items = []historyListItem{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return stdoutError(enc.Encode(items))
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	for _, item := range items {
+		size := "-"
+		if item.Width > 0 {
+			size = fmt.Sprintf("%dx%d", item.Width, item.Height)
+		}
+		path := item.Path
+		if item.TrashedAt != nil {
+			path += " (undone)"
+		}
+		fmt.Fprintf(w, "%-13s %s %9s  %s", item.ID, item.Time.Local().Format("2006-01-02 15:04:05"), size, path)
+		if historyThumbnails {
+			thumb := item.Thumbnail
+			if thumb == "" {
+				thumb = "-"
+			}
+			fmt.Fprintf(w, "\t%s", thumb)
+		}
+		fmt.Fprintln(w)
+	}
+	return stdoutError(w.Flush())
+}
+
+// parseTimeBound parses a --since/--until value: a date, a date and
+// time, or a duration back from now, which may be in days (7d). An empty
+// value is the zero time.
+func parseTimeBound(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return time.Now().AddDate(0, 0, -n), nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{time.DateOnly, "2006-01-02T15:04:05", time.DateTime, "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date, time or duration", s)
+}
+
+// ocrText returns the text tesseract finds in an image. Missing files
+// (undone or remote captures) have none.
+func ocrText(path string) (string, error) {
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	out, err := exec.Command("tesseract", path, "-").Output()
+	if err != nil {
+		return "", fmt.Errorf("tesseract failed: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
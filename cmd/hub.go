@@ -0,0 +1,105 @@
+//go:build !noserve && !minimal
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/robotin/screenshot/internal/hub"
+	"github.com/spf13/cobra"
+)
+
+var (
+	hubListen   string
+	hubTenants  []string
+	hubAgentTTL time.Duration
+	hubAgents   []string
+)
+
+var hubCmd = &cobra.Command{
+	Use:   "hub",
+	Short: "Run a central hub that screenshot agents register with",
+	Long: `Run a central hub for a fleet of screenshot agents.
+
+Agents are machines running "screenshot serve --hub URL --hub-token TOKEN".
+They register (and heartbeat) with the hub over gRPC, on the same address
+(see proto/robotin/screenshot/v1/hub.proto), and the hub offers one API
+and web UI to capture any registered machine. Each tenant has its own
+token and only sees the agents that registered with it.
+
+The hub only proxies to agents whose URL host is allowed by --agent-host
+(a name, *.domain or CIDR; repeatable). Without it any host is allowed
+except loopback, link-local (such as cloud metadata endpoints) and
+unspecified addresses, so a tenant token can't be used to reach the
+hub's own machine or network services through it.
+
+Endpoints (all require "Authorization: Bearer <tenant token>"):
+  GET  /agents                    Registered agents of the tenant
+  GET  /agents/<name>/capture     Proxied to the agent (same parameters)
+  GET  /agents/<name>/monitors
+  POST /agents/<name>/share
+
+Examples:
+  screenshot hub --listen :9090 --tenant acme=s3cret --tenant lab=0ther
+  screenshot hub --tenant acme=s3cret --agent-host '*.fleet.lan' --agent-host 10.20.0.0/16
+  screenshot serve --listen :8080 --hub http://hub:9090 --hub-token s3cret`,
+	Args: cobra.NoArgs,
+	RunE: runHub,
+}
+
+func init() {
+	hubCmd.Flags().StringVar(&hubListen, "listen", "127.0.0.1:9090", "Address to listen on")
+	hubCmd.Flags().StringArrayVar(&hubTenants, "tenant", nil, "Tenant as name=token (repeatable)")
+	hubCmd.Flags().DurationVar(&hubAgentTTL, "agent-ttl", 90*time.Second, "Drop agents that haven't sent a heartbeat for this long")
+	hubCmd.Flags().StringArrayVar(&hubAgents, "agent-host", nil, "Host agents may register with: name, *.domain or CIDR (repeatable; default: any non-local host)")
+	rootCmd.AddCommand(hubCmd)
+}
+
+func runHub(cmd *cobra.Command, args []string) error {
+	tenants := map[string]string{}
+	for _, t := range hubTenants {
+		name, token, ok := strings.Cut(t, "=")
+		if !ok || name == "" || token == "" {
+			return fmt.Errorf("invalid --tenant %q (expected name=token)", t)
+		}
+		tenants[name] = token
+	}
+
+	h, err := hub.New(hub.Config{Tenants: tenants, AgentTTL: hubAgentTTL, AgentHosts: hubAgents})
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:              hubListen,
+		Handler:           h,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	stop, stopNotify := notifyInterrupt()
+	defer stopNotify()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	fmt.Fprintf(os.Stderr, "Hub listening on http://%s (%d tenant(s))\n", hubListen, len(tenants))
+
+	select {
+	case err := <-errc:
+		return err
+	case <-stop:
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/robotin/screenshot/internal/config"
+	"github.com/robotin/screenshot/internal/indicator"
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// captureIndicator keeps the on-screen notice up during a periodic
+// capture run (--indicator, or indicator.enabled in the config)
+type captureIndicator struct {
+	cfg     config.Indicator
+	display string
+	ind     *indicator.Indicator
+	warn    sync.Once
+}
+
+// newCaptureIndicator returns the run's indicator, or nil if it is not
+// enabled. The notice is shown by the first Update.
+func newCaptureIndicator(display string) (*captureIndicator, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if !showIndicator && !cfg.Indicator.Enabled {
+		return nil, nil
+	}
+	return &captureIndicator{cfg: cfg.Indicator, display: display}, nil
+}
+
+// Update makes sure the notice is on screen before a capture, showing it
+// again if it was lost and moving it if the layout changed. If the notice
+// is required and can't be shown, it returns why and the capture must
+// not be taken; otherwise failures are a warning, once.
+func (ci *captureIndicator) Update(monitors []strategy.Monitor, layoutChanged bool) error {
+	if ci == nil {
+		return nil
+	}
+
+	if ci.ind != nil {
+		err := ci.ind.Err()
+		if err == nil && layoutChanged {
+			err = ci.ind.Move(monitors)
+		}
+		if err != nil {
+			debugf("indicator: %v", err)
+			ci.ind.Close()
+			ci.ind = nil
+		}
+	}
+	var err error
+	if ci.ind == nil {
+		ci.ind, err = indicator.Show(ci.display, ci.cfg.Text, ci.cfg.Corner, monitors)
+	}
+	if err == nil {
+		return nil
+	}
+
+	if ci.cfg.Required {
+		return fmt.Errorf("capture indicator is required but can't be shown: %w", err)
+	}
+	ci.warn.Do(func() {
+		fmt.Fprintf(os.Stderr, "Warning: capturing without the on-screen indicator: %v\n", err)
+	})
+	return nil
+}
+
+// Close removes the notice; the next Update shows it again
+func (ci *captureIndicator) Close() {
+	if ci != nil && ci.ind != nil {
+		ci.ind.Close()
+		ci.ind = nil
+	}
+}
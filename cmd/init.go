@@ -0,0 +1,354 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/config"
+	"github.com/robotin/screenshot/internal/paths"
+	"github.com/robotin/screenshot/internal/upload"
+	"github.com/robotin/screenshot/internal/xwin"
+	"github.com/spf13/cobra"
+)
+
+var (
+	initYes    bool
+	initForce  bool
+	initDryRun bool
+)
+
+// bindPrintKey binds the Print key to this tool on a desktop (see
+// screenshot integrate); nil when built without integrate
+var bindPrintKey func(desktop string) error
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Set up a starter config by answering a few questions",
+	Long: `Detect how captures work here (the capture backend, the clipboard tool,
+the pictures directory and the desktop), ask a few questions and write a
+starter config file:
+
+  - where to save captures
+  - the default format
+  - where to upload captures, if anywhere
+  - whether to bind the Print key to this tool (GNOME, KDE and sway)
+  - a panic key that stops periodic captures at once
+
+Every question has a default in brackets; press Enter to take it.
+--yes takes them all without asking, for setting up kiosks from a script.
+An existing config is only replaced with --force, which keeps it as
+config.yaml.bak.
+
+Examples:
+  screenshot init
+  screenshot init --yes
+  screenshot init --dry-run
+  screenshot init --config /etc/robotin-screenshot.yaml --force`,
+	Args: cobra.NoArgs,
+	RunE: runInit,
+}
+
+func init() {
+	initCmd.Flags().BoolVarP(&initYes, "yes", "y", false, "Take the default answers without asking")
+	initCmd.Flags().BoolVar(&initForce, "force", false, "Replace an existing config (saved as .bak)")
+	initCmd.Flags().BoolVar(&initDryRun, "dry-run", false, "Print the config instead of writing it")
+	initCmd.Flags().StringVarP(&display, "display", "d", "", "X11 display (default: $DISPLAY or :0)")
+	rootCmd.AddCommand(initCmd)
+}
+
+// initEnv is what init detected about this machine
+type initEnv struct {
+	Backend   string
+	Monitors  int
+	Clipboard string
+	Pictures  string
+	Desktop   string
+}
+
+// starterConfig is what init asks for
+type starterConfig struct {
+	OutputDir string
+	Format    string
+	Upload    string
+	PanicKey  string
+	Backend   string
+}
+
+func runInit(cmd *cobra.Command, args []string) error {
+	if display != "" {
+		os.Setenv("DISPLAY", display)
+	}
+	path := configPath
+	if path == "" {
+		var err error
+		if path, err = config.Path(); err != nil {
+			return err
+		}
+	}
+	_, err := os.Stat(path)
+	exists := err == nil
+	if exists && !initForce && !initDryRun {
+		return fmt.Errorf("%s already exists (screenshot config show prints it; --force replaces it)", path)
+	}
+
+	env := detectInitEnv()
+	fmt.Println("Detected:")
+	if env.Backend != "" {
+		fmt.Printf("  capture    %s backend, %d monitor(s)\n", env.Backend, env.Monitors)
+	} else {
+		fmt.Println("  capture    no backend can capture here yet (see screenshot doctor)")
+	}
+	if env.Clipboard != "" {
+		fmt.Printf("  clipboard  %s (for --clipboard)\n", env.Clipboard)
+	} else {
+		fmt.Println("  clipboard  none (install xclip, or wl-clipboard on Wayland, for --clipboard)")
+	}
+	fmt.Printf("  pictures   %s\n", env.Pictures)
+	if env.Desktop != "" {
+		fmt.Printf("  desktop    %s\n", env.Desktop)
+	}
+	fmt.Println()
+
+	p := &prompter{in: bufio.NewReader(os.Stdin), out: os.Stdout, defaults: initYes, echo: !isTerminal(os.Stdin)}
+	sc := starterConfig{Backend: env.Backend}
+	if backendName != "" {
+		// --backend picked it; the config only orders automatic backends
+		sc.Backend = ""
+	}
+	sc.OutputDir, err = p.ask("Save captures in", homeRelative(filepath.Join(env.Pictures, "Screenshots")), func(s string) error {
+		if s == "" {
+			return errors.New("enter a directory")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sc.Format, err = p.ask("Format (png, jpeg, auto to pick by content, qoi, heif)", "png", func(s string) error {
+		if strings.EqualFold(s, string(capture.FormatAuto)) {
+			return nil
+		}
+		_, err := capture.ParseFormat(s)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	sc.Upload, err = p.ask("Upload captures to (imgur, drive:FOLDER, s3://bucket/prefix; empty for none)", "", func(s string) error {
+		if s == "" {
+			return nil
+		}
+		_, err := upload.New(s)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	bind := false
+	if env.Desktop != "" && bindPrintKey != nil && !initDryRun {
+		if bind, err = p.confirm(fmt.Sprintf("Bind the Print key to screenshot in %s", env.Desktop), true); err != nil {
+			return err
+		}
+	}
+	sc.PanicKey, err = p.ask("Panic key that stops periodic captures at once (e.g. ctrl+alt+shift+p; empty for none)", "", func(s string) error {
+		if s == "" {
+			return nil
+		}
+		_, err := xwin.ParseKey(s)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	data := sc.yaml(time.Now())
+	if _, err := config.Parse(data); err != nil {
+		return fmt.Errorf("failed to write a valid config: %w", err)
+	}
+	if initDryRun {
+		fmt.Println()
+		_, err := os.Stdout.Write(data)
+		return stdoutError(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	backup := ""
+	if exists {
+		old, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read config: %w", err)
+		}
+		backup = path + ".bak"
+		if err := os.WriteFile(backup, old, 0o644); err != nil {
+			return fmt.Errorf("failed to back up config: %w", err)
+		}
+	}
+	if err := writeConfig(path, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Println()
+	if backup != "" {
+		infof("Wrote %s (the old config is saved as %s)", path, backup)
+	} else {
+		infof("Wrote %s", path)
+	}
+
+	if bind {
+		if err := bindPrintKey(env.Desktop); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to bind the Print key: %v (try screenshot integrate %s)\n", err, env.Desktop)
+		}
+	}
+	infof("Take a capture with: screenshot")
+	return nil
+}
+
+// detectInitEnv finds the capture backend, clipboard tool, pictures
+// directory and desktop; what can't be found is left empty
+func detectInitEnv() initEnv {
+	var env initEnv
+	auditDestination = "init"
+	if capturer, err := newCapturer(); err == nil {
+		if s, err := capturer.GetStrategy(); err == nil {
+			if monitors, err := capturer.ListMonitors(); err == nil {
+				env.Backend, env.Monitors = s.Name(), len(monitors)
+			}
+		}
+	}
+
+	switch {
+	case os.Getenv("WAYLAND_DISPLAY") != "" && hasCommand("wl-copy"):
+		env.Clipboard = "wl-copy"
+	case hasCommand("xclip"):
+		env.Clipboard = "xclip"
+	}
+
+	env.Pictures = "~/Pictures"
+	if dir, err := paths.PicturesDir(); err == nil {
+		env.Pictures = dir
+	}
+
+	// XDG_CURRENT_DESKTOP is a list such as ubuntu:GNOME
+	for _, name := range strings.Split(strings.ToLower(os.Getenv("XDG_CURRENT_DESKTOP")), ":") {
+		switch name {
+		case "gnome", "kde", "sway":
+			env.Desktop = name
+		}
+	}
+	if env.Desktop == "" && os.Getenv("SWAYSOCK") != "" {
+		env.Desktop = "sway"
+	}
+	return env
+}
+
+// homeRelative writes a path in the home directory as ~/..., so the
+// config can be copied to other machines
+func homeRelative(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(home, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(filepath.Join("~", rel))
+	}
+	return path
+}
+
+// yaml writes the starter config, with a comment on each setting
+func (sc starterConfig) yaml(now time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Written by screenshot init on %s. Every setting is described in the\n", now.Format("2006-01-02"))
+	fmt.Fprintf(&b, "# README; screenshot config show --effective shows what is in effect.\n")
+	fmt.Fprintf(&b, "version: %d\n", config.CurrentVersion)
+	setting := func(comment, key, value string) {
+		fmt.Fprintf(&b, "\n# %s\n", comment)
+		if value == "" {
+			fmt.Fprintf(&b, "# %s:\n", key)
+		} else {
+			fmt.Fprintf(&b, "%s: %s\n", key, strconv.Quote(value))
+		}
+	}
+	setting("Where captures without an output path are saved", "output_dir", sc.OutputDir)
+	setting("Format of captures whose output path doesn't name one (--format)", "format", sc.Format)
+	setting("Upload every capture here unless --upload is given", "upload", sc.Upload)
+	setting("Global hotkey that stops --interval, --session and serve at once", "panic_key", sc.PanicKey)
+	if sc.Backend != "" {
+		fmt.Fprintf(&b, "\n# Capture backends to try first\nbackend_priority: [%s]\n", strconv.Quote(sc.Backend))
+	}
+	return []byte(b.String())
+}
+
+// prompter asks questions on a terminal, or takes the defaults
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	// defaults takes every default without asking
+	defaults bool
+
+	// echo repeats answers read from a file or pipe, which the terminal
+	// doesn't show
+	echo bool
+}
+
+// ask asks a question until check accepts the answer; an empty answer
+// takes def. At the end of the input, def is taken.
+func (p *prompter) ask(question, def string, check func(string) error) (string, error) {
+	for {
+		if p.defaults {
+			return def, nil
+		}
+		if def != "" {
+			fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+		} else {
+			fmt.Fprintf(p.out, "%s: ", question)
+		}
+		line, err := p.in.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("failed to read answer: %w", err)
+		}
+		answer := strings.TrimSpace(line)
+		if p.echo || line == "" {
+			fmt.Fprintln(p.out, answer)
+		}
+		if answer == "" {
+			answer = def
+		}
+		if err := check(answer); err != nil {
+			if line == "" {
+				return "", err
+			}
+			fmt.Fprintf(p.out, "  %v\n", err)
+			continue
+		}
+		return answer, nil
+	}
+}
+
+// confirm asks a yes or no question
+func (p *prompter) confirm(question string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	answer, err := p.ask(question+" ("+hint+")", "", func(s string) error {
+		switch strings.ToLower(s) {
+		case "", "y", "yes", "n", "no":
+			return nil
+		}
+		return errors.New("answer yes or no")
+	})
+	if err != nil || answer == "" {
+		return def, err
+	}
+	return strings.HasPrefix(strings.ToLower(answer), "y"), nil
+}
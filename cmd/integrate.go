@@ -0,0 +1,74 @@
+//go:build !nointegrate && !minimal
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/robotin/screenshot/internal/integrate"
+	"github.com/spf13/cobra"
+)
+
+var (
+	integrateUninstall bool
+	integrateKey       string
+	integrateArgs      string
+	integrateDryRun    bool
+)
+
+var integrateCmd = &cobra.Command{
+	Use:   "integrate <gnome|kde|sway>",
+	Short: "Bind the Print key to this tool in the desktop environment",
+	Long: `Make this tool the desktop's screenshot key handler: bind Print (or --key)
+to run it and move the desktop's own screenshot binding out of the way.
+The replaced settings are saved and restored by --uninstall.
+
+  gnome   custom keybinding via gsettings; the GNOME Shell screenshot UI
+          shortcut is cleared
+  kde     desktop entry plus a global shortcut in kglobalshortcutsrc;
+          Spectacle's shortcut is cleared (log out and back in to apply)
+  sway    bindsym in ~/.config/sway/robotin-screenshot.conf, included
+          from the sway config and reloaded
+
+Examples:
+  screenshot integrate gnome
+  screenshot integrate kde --args "-m 0 --clipboard"
+  screenshot integrate sway --key Shift+Print --dry-run
+  screenshot integrate gnome --uninstall`,
+	Args: cobra.ExactArgs(1),
+	RunE: runIntegrate,
+}
+
+func init() {
+	integrateCmd.Flags().BoolVar(&integrateUninstall, "uninstall", false, "Remove the binding and restore the desktop's own")
+	integrateCmd.Flags().StringVar(&integrateKey, "key", "Print", "Key to bind")
+	integrateCmd.Flags().StringVar(&integrateArgs, "args", "", "Extra arguments for the bound command")
+	integrateCmd.Flags().BoolVar(&integrateDryRun, "dry-run", false, "Print the changes without making them")
+	rootCmd.AddCommand(integrateCmd)
+	bindPrintKey = func(desktop string) error {
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to find the executable: %w", err)
+		}
+		return integrate.Install(desktop, integrate.Options{Command: []string{exe}, Key: "Print", Out: os.Stdout})
+	}
+}
+
+func runIntegrate(cmd *cobra.Command, args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the executable: %w", err)
+	}
+	opts := integrate.Options{
+		Command: append([]string{exe}, strings.Fields(integrateArgs)...),
+		Key:     integrateKey,
+		DryRun:  integrateDryRun,
+		Out:     os.Stdout,
+	}
+	if integrateUninstall {
+		return integrate.Uninstall(args[0], opts)
+	}
+	return integrate.Install(args[0], opts)
+}
@@ -0,0 +1,357 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/schedule"
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// failureImages is --failure-image
+var failureImages bool
+
+// runInterval captures repeatedly every --interval until --count captures
+// have been taken, --duration elapses, or the process is interrupted.
+// With a timetable (--schedule, --cron), captures are taken when it says
+// instead. Files are named <prefix>_<timestamp><ext> next to outputPath,
+// and each is delivered (uploaded, webhook) after it is saved. With
+// --json, every capture's result and every layout change is printed on
+// stdout as a line of JSON.
+func runInterval(capturer *capture.Capturer, opts strategy.CaptureOptions, enc capture.EncodeOptions, outputPath string, d *delivery, sched schedule.Timetable) error {
+	dir, prefix := intervalNaming(outputPath)
+
+	tracker := newMonitorTracker(capturer, opts.Display)
+	defer tracker.Close()
+
+	stop, stopNotify := notifyInterrupt()
+	defer stopNotify()
+	kill, err := startPanicSwitch(opts.Display)
+	if err != nil {
+		return err
+	}
+	defer kill.Close()
+
+	var deadline <-chan time.Time
+	if duration > 0 {
+		deadline = time.After(duration)
+	}
+
+	var ticker *time.Ticker
+	if sched == nil {
+		ticker = time.NewTicker(interval)
+		defer ticker.Stop()
+	}
+
+	if !quiet {
+		timing := fmt.Sprintf("every %s", interval)
+		if sched != nil {
+			timing = sched.String()
+		}
+		if jitter > 0 {
+			timing += fmt.Sprintf(", up to %s late at random", jitter)
+		}
+		fmt.Fprintf(os.Stderr, "Capturing %s (Ctrl-C to stop)\n", timing)
+	}
+	fmt.Fprintf(os.Stderr, "Monitor layout: %s\n", describeLayout(tracker.Monitors()))
+
+	ind, err := newCaptureIndicator(opts.Display)
+	if err != nil {
+		return err
+	}
+	defer ind.Close()
+
+	var after time.Time
+	var lastSize image.Point
+	for n := 0; count <= 0 || n < count; n++ {
+		// Spread a fleet's captures, and their uploads, over the jitter
+		var delay time.Duration
+		if jitter > 0 {
+			delay = time.Duration(rand.Int63n(int64(jitter)))
+		}
+
+		if sched != nil {
+			at := sched.Next(later(after, time.Now()))
+			if at.IsZero() {
+				return fmt.Errorf("no captures left: %s", sched)
+			}
+			// A wait longer than the gap after it is off hours: nothing
+			// is being captured
+			offHours := time.Until(at) > sched.Next(at.Add(time.Nanosecond)).Sub(at)
+			if offHours {
+				ind.Close()
+			}
+			if offHours || n == 0 {
+				infof("Next capture at %s", at.Format("Mon 2006-01-02 15:04 MST"))
+			}
+			if !waitUntil(at.Add(delay), stop, kill.C, deadline) {
+				return nil
+			}
+			after = at.Add(time.Nanosecond)
+		} else if delay > 0 && !waitUntil(time.Now().Add(delay), stop, kill.C, deadline) {
+			return nil
+		}
+
+		layoutChanged := tracker.Refresh()
+		if layoutChanged {
+			fmt.Fprintf(os.Stderr, "Monitor layout changed: %s\n", describeLayout(tracker.Monitors()))
+			if jsonOutput {
+				if err := printLine(layoutEvent{Event: "layout_changed", Monitors: monitorsJSON(tracker.Monitors())}); err != nil {
+					return err
+				}
+			}
+			// Named and virtual monitors may have moved
+			if o, err := buildCaptureOptions(capturer); err == nil {
+				opts = o
+			}
+		}
+
+		path, err := capture.OrganizePath(filepath.Join(dir, capture.GenerateFilename(prefix, enc.Format)), organize, time.Now())
+		if err != nil {
+			return err
+		}
+		path = capture.UniquePath(path)
+
+		// A required indicator must be on screen before anything is
+		// captured
+		var img image.Image
+		focus, pointer := captureContext(opts.Display)
+		err = ind.Update(tracker.Monitors(), layoutChanged)
+		if err == nil {
+			img, err = capturer.Capture(opts)
+		}
+		if kill.Pulled() {
+			// Pulled during the grab: nothing of it is kept
+			wipeImage(img)
+			return nil
+		}
+		var failure error
+		if err != nil && failureImages {
+			// Stand in for the capture, so whatever shows the latest
+			// one shows the failure
+			failure = err
+			img = capture.FailureImage(failureSize(capturer, opts, lastSize), err, time.Now())
+			err = nil
+		}
+		itemEnc, out := enc, img
+		var (
+			fit      *capture.Fit
+			fallback *capture.Fallback
+		)
+		if err == nil {
+			if enc.Format == capture.FormatAuto {
+				itemEnc, path = resolveFormat(img, enc, path)
+				path = capture.UniquePath(path)
+			}
+			if out, itemEnc, fit, err = fitSize(img, itemEnc); err == nil {
+				pngPath := capture.FallbackPath(path)
+				if fallback, err = capture.SaveFallback(out, path, pngPath, itemEnc, &capture.Stats{}); fallback != nil {
+					path, itemEnc.Format = pngPath, capture.FormatPNG
+					warnFallback(path, fallback)
+				}
+			}
+		}
+		if failure != nil {
+			fmt.Fprintf(os.Stderr, "Capture failed: %v\n", failure)
+		}
+		if err != nil {
+			// Keep going: a single failed grab (VT switch, lock screen
+			// transition) shouldn't end a long-running session
+			fmt.Fprintf(os.Stderr, "Capture failed: %v\n", err)
+			if jsonOutput {
+				if err := printLine(captureResult{Dir: outputDirectory, Items: []resultItem{failedItem(path, err)}}); err != nil {
+					return err
+				}
+			}
+		} else {
+			if failure != nil {
+				infof("Failure image saved: %s", path)
+			} else {
+				lastSize = img.Bounds().Size()
+				infof("Screenshot saved: %s", path)
+			}
+			if latestLink != "" {
+				if err := capture.UpdateLatestLink(latestLink, path); err != nil {
+					fmt.Fprintf(os.Stderr, "%v\n", err)
+				}
+			}
+			item := newResultItem(path, img, itemEnc)
+			item.Region = capturedRegion(opts)
+			item.Focus, item.Pointer = focus, pointer
+			withFit(&item, out, fit)
+			item.Fallback = fallback
+			if failure != nil {
+				item.Analysis = nil
+			}
+			infoAnalysis(item)
+			if d.tiles != nil {
+				err = d.deliverTiles(&item, path, img)
+			} else {
+				err = d.deliver(&item, path)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+			} else if item.URL != "" {
+				infof("Uploaded: %s", item.URL)
+			}
+			if jsonOutput {
+				if failure != nil {
+					item.Status, item.Error = statusFailed, failure.Error()
+				}
+				if err := printLine(captureResult{OK: failure == nil, Dir: outputDirectory, Items: []resultItem{item}}); err != nil {
+					return err
+				}
+			}
+		}
+
+		if count > 0 && n+1 >= count {
+			break
+		}
+		if sched != nil {
+			continue
+		}
+
+		select {
+		case <-stop:
+			return nil
+		case <-kill.C:
+			wipeImage(img)
+			wipeImage(out)
+			return nil
+		case <-deadline:
+			return nil
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
+
+// layoutEvent is the --json line printed when the monitor layout changes
+// during an interval run
+type layoutEvent struct {
+	Event    string        `json:"event"`
+	Monitors []monitorJSON `json:"monitors"`
+}
+
+// printLine writes v as a single line of JSON on stdout
+func printLine(v any) error {
+	if err := json.NewEncoder(os.Stdout).Encode(v); err != nil {
+		return fmt.Errorf("failed to write JSON result: %w", err)
+	}
+	return nil
+}
+
+// failureSize is the size of the failure image for a capture with opts:
+// that of the last capture, else of the area captured
+func failureSize(capturer *capture.Capturer, opts strategy.CaptureOptions, last image.Point) image.Point {
+	if last != (image.Point{}) {
+		return last
+	}
+	return capturer.FailureSize(opts)
+}
+
+// captureTimetable returns the timetable set by --schedule or --cron, or
+// nil for plain --interval timing
+func captureTimetable() (schedule.Timetable, error) {
+	if scheduleName == "" && cronSpec == "" {
+		return nil, nil
+	}
+	if scheduleName != "" && cronSpec != "" {
+		return nil, fmt.Errorf("--schedule and --cron cannot be combined")
+	}
+	if interval > 0 {
+		return nil, fmt.Errorf("--schedule and --cron set when to capture; they cannot be combined with --interval")
+	}
+
+	var sched schedule.Timetable
+	if scheduleName != "" {
+		s, err := loadSchedule(scheduleName)
+		if err != nil {
+			return nil, err
+		}
+		sched = s
+	} else {
+		c, err := schedule.ParseCron(cronSpec, time.Local)
+		if err != nil {
+			return nil, err
+		}
+		sched = c
+	}
+	if sched.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("%s never comes round", sched)
+	}
+	return sched, nil
+}
+
+// shortestGap returns the shortest time between a timetable's next
+// captures
+func shortestGap(sched schedule.Timetable) time.Duration {
+	gap := time.Duration(math.MaxInt64)
+	at := sched.Next(time.Now())
+	for i := 0; i < 1000; i++ {
+		next := sched.Next(at.Add(time.Nanosecond))
+		if next.IsZero() {
+			break
+		}
+		gap = min(gap, next.Sub(at))
+		at = next
+	}
+	return gap
+}
+
+// waitUntil waits for a wall clock time, or returns false if the run
+// is stopped or the panic switch is pulled first. It sleeps in short
+// steps and checks the clock after each, so suspend, clock corrections
+// and DST changes can't make it oversleep.
+func waitUntil(at time.Time, stop <-chan os.Signal, pulled <-chan struct{}, deadline <-chan time.Time) bool {
+	for {
+		wait := time.Until(at.Round(0))
+		if wait <= 0 {
+			return true
+		}
+		timer := time.NewTimer(min(wait, time.Minute))
+		select {
+		case <-stop:
+			timer.Stop()
+			return false
+		case <-pulled:
+			timer.Stop()
+			return false
+		case <-deadline:
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+	}
+}
+
+// later returns the later of two times
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// intervalNaming splits an output path into the directory and filename
+// prefix used for interval captures. An empty path means the current
+// directory and the "screenshot" prefix.
+func intervalNaming(outputPath string) (dir, prefix string) {
+	if outputPath == "" {
+		return ".", "screenshot"
+	}
+
+	dir = filepath.Dir(outputPath)
+	base := filepath.Base(outputPath)
+	prefix = strings.TrimSuffix(base, filepath.Ext(base))
+	return dir, prefix
+}
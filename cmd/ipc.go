@@ -0,0 +1,116 @@
+//go:build !noipc && !minimal
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/robotin/screenshot/internal/ipc"
+	"github.com/robotin/screenshot/internal/paths"
+	"github.com/robotin/screenshot/internal/xwin"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ipcSocket        string
+	ipcThumbnailSize string
+	ipcThumbnailFPS  int
+)
+
+var ipcCmd = &cobra.Command{
+	Use:   "ipc",
+	Short: "Serve captures to automation tools over a unix socket",
+	Long: `Run a daemon that answers protobuf requests on a unix socket, so the
+robotin automation engine can capture, query pixels and watch regions
+without starting this CLI for every step.
+
+Requests (see proto/robotin/screenshot/v1/ipc.proto for the contract):
+  Hello      Protocol version handshake
+  Capture    Monitor, region or window as raw RGBA, PNG or JPEG
+  Pixel      Color of one screen pixel
+  Monitors   Monitor layout
+  Watch      Subscribe to changes in a region (events on every change)
+  Thumbnails Subscribe to live thumbnails of every window (for panels
+             and docks: events when a window opens, closes or changes)
+  Unwatch    Cancel a subscription
+
+Messages are length-prefixed with a varint. The socket is only accessible
+to the current user. Exclusion zones and other config settings apply as
+for normal captures. --thumbnail-size and --thumbnail-fps set the
+defaults for Thumbnails subscriptions that don't choose their own.
+
+Examples:
+  screenshot ipc
+  screenshot ipc --socket /run/user/1000/robotin/screenshot.sock -d :0
+  screenshot ipc --thumbnail-size 320x200 --thumbnail-fps 5`,
+	Args: cobra.NoArgs,
+	RunE: runIPC,
+}
+
+func init() {
+	ipcCmd.Flags().StringVar(&ipcSocket, "socket", "", "Socket path (default: $XDG_RUNTIME_DIR/robotin-screenshot/ipc.sock)")
+	ipcCmd.Flags().StringVar(&ipcThumbnailSize, "thumbnail-size", "256x256", "Box window thumbnails are scaled to fit (WxH)")
+	ipcCmd.Flags().IntVar(&ipcThumbnailFPS, "thumbnail-fps", ipc.DefaultThumbnailFPS, "Window thumbnail refreshes per second")
+	ipcCmd.Flags().StringVarP(&display, "display", "d", "", "X11 display (default: $DISPLAY or :0)")
+	rootCmd.AddCommand(ipcCmd)
+}
+
+func runIPC(cmd *cobra.Command, args []string) error {
+	if display != "" {
+		os.Setenv("DISPLAY", display)
+	}
+
+	path := ipcSocket
+	if path == "" {
+		path = filepath.Join(paths.RuntimeDir(), "ipc.sock")
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return fmt.Errorf("failed to create runtime directory: %w", err)
+		}
+	}
+
+	thumbSize, err := parseSize(ipcThumbnailSize)
+	if err != nil {
+		return fmt.Errorf("invalid --thumbnail-size: %w", err)
+	}
+	if ipcThumbnailFPS < 1 || ipcThumbnailFPS > ipc.MaxThumbnailFPS {
+		return fmt.Errorf("--thumbnail-fps must be between 1 and %d", ipc.MaxThumbnailFPS)
+	}
+
+	auditDestination = "ipc clients on " + path
+	capturer, err := newCapturer()
+	if err != nil {
+		return err
+	}
+	l, err := ipc.Listen(path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	srv := ipc.NewServer(capturer, "robotin-screenshot")
+	srv.Logf = debugf
+	srv.ThumbnailSize = thumbSize
+	srv.ThumbnailFPS = ipcThumbnailFPS
+	srv.Windows = func() ([]xwin.Window, error) {
+		conn, err := xwin.Connect("")
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		return conn.Windows()
+	}
+
+	stop, stopNotify := notifyInterrupt()
+	defer stopNotify()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	fmt.Fprintf(os.Stderr, "Listening on %s\n", path)
+	return srv.Serve(ctx, l)
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/robotin/screenshot/internal/layout"
+	"github.com/spf13/cobra"
+)
+
+var (
+	layoutOutput string
+	layoutCols   int
+	layoutWidth  int
+)
+
+var layoutCmd = &cobra.Command{
+	Use:   "layout",
+	Short: "Show the monitor arrangement",
+	Long: `Draw the current monitor arrangement with each monitor's index, name,
+resolution and offset (the primary monitor is marked with *), to help
+work out coordinates for --region on multi-monitor setups.
+
+Examples:
+  screenshot layout                  # ASCII art in the terminal
+  screenshot layout -o layout.png    # Also save a diagram image
+  screenshot layout --json`,
+	Args: cobra.NoArgs,
+	RunE: runLayout,
+}
+
+func init() {
+	layoutCmd.Flags().StringVarP(&layoutOutput, "output", "o", "", "Save a diagram image (PNG)")
+	layoutCmd.Flags().IntVar(&layoutCols, "cols", 72, "Width of the ASCII art in characters")
+	layoutCmd.Flags().IntVar(&layoutWidth, "image-width", 800, "Width of the diagram image in pixels")
+	layoutCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the monitors as JSON")
+	layoutCmd.Flags().StringVarP(&display, "display", "d", "", "X11 display (default: $DISPLAY or :0)")
+	rootCmd.AddCommand(layoutCmd)
+}
+
+func runLayout(cmd *cobra.Command, args []string) error {
+	if display != "" {
+		os.Setenv("DISPLAY", display)
+	}
+
+	capturer, err := newCapturer()
+	if err != nil {
+		return err
+	}
+	monitors, err := capturer.ListMonitors()
+	if err != nil {
+		return err
+	}
+
+	if layoutOutput != "" {
+		img, err := layout.Diagram(monitors, layoutWidth)
+		if err != nil {
+			return err
+		}
+		if err := writePNG(layoutOutput, img); err != nil {
+			return err
+		}
+	}
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(monitorsJSON(monitors))
+	}
+
+	fmt.Print(layout.ASCII(monitors, layoutCols))
+
+	b := layout.Bounds(monitors)
+	fmt.Printf("\nVirtual screen: %dx%d at %d,%d\n", b.Dx(), b.Dy(), b.Min.X, b.Min.Y)
+	for _, m := range monitors {
+		primary := ""
+		if m.Primary {
+			primary = " (primary)"
+		}
+		fmt.Printf("  %d: %-10s --region %d,%d,%d,%d%s\n",
+			m.Index, m.Name, m.Bounds.Min.X, m.Bounds.Min.Y, m.Bounds.Dx(), m.Bounds.Dy(), primary)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	for _, name := range cfg.Names() {
+		if r, err := cfg.Bounds(name, monitors); err == nil {
+			fmt.Printf("  %-13s --region %d,%d,%d,%d (virtual)\n", name, r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+		}
+	}
+	if layoutOutput != "" {
+		infof("Diagram saved: %s", layoutOutput)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/robotin/screenshot/internal/a11y"
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/locate"
+	"github.com/robotin/screenshot/internal/strategy"
+	"github.com/robotin/screenshot/internal/xwin"
+)
+
+// --locate outputs
+const (
+	locateJSON    = "json"
+	locateOverlay = "overlay"
+	locateBoth    = "both"
+)
+
+// elementsFile is the JSON sidecar written by --locate
+type elementsFile struct {
+	// Area is the screen rectangle the image shows
+	Area     a11y.Rect        `json:"area"`
+	Elements []locate.Element `json:"elements"`
+}
+
+// validateLocate checks the --locate value
+func validateLocate(mode string) error {
+	switch mode {
+	case "", locateJSON, locateOverlay, locateBoth:
+		return nil
+	}
+	return fmt.Errorf("invalid --locate %q (expected json, overlay or both)", mode)
+}
+
+// locateElements lists the visible UI elements of a capture: the
+// interactive widgets from the accessibility tree for window captures,
+// the top-level windows for everything else
+func locateElements(capturer *capture.Capturer, opts strategy.CaptureOptions, tree *a11y.Tree) (*elementsFile, error) {
+	if opts.WindowID != 0 {
+		if tree == nil {
+			return nil, fmt.Errorf("no accessibility tree")
+		}
+		return &elementsFile{Area: tree.WindowBounds, Elements: nonNil(locate.FromTree(tree))}, nil
+	}
+
+	monitors, err := capturer.ListMonitors()
+	if err != nil {
+		return nil, err
+	}
+	area := capture.Area(opts, monitors)
+
+	conn, err := xwin.Connect(display)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	windows, err := conn.Windows()
+	if err != nil {
+		return nil, err
+	}
+	rect := a11y.Rect{X: area.Min.X, Y: area.Min.Y, Width: area.Dx(), Height: area.Dy()}
+	return &elementsFile{Area: rect, Elements: nonNil(locate.FromWindows(windows, area))}, nil
+}
+
+func nonNil(elements []locate.Element) []locate.Element {
+	if elements == nil {
+		return []locate.Element{}
+	}
+	return elements
+}
+
+// elementsPath returns a --locate sidecar for an image:
+// shot.png -> shot.elements.json or shot.elements.png
+func elementsPath(imagePath, ext string) string {
+	return strings.TrimSuffix(imagePath, filepath.Ext(imagePath)) + ".elements" + ext
+}
+
+// writeElements saves the element list, the overlay image or both, and
+// returns the paths written
+func writeElements(mode, imagePath string, img image.Image, ef *elementsFile) (jsonPath, overlayPath string, err error) {
+	if mode == locateJSON || mode == locateBoth {
+		jsonPath = elementsPath(imagePath, ".json")
+		data, err := json.MarshalIndent(ef, "", "  ")
+		if err != nil {
+			return "", "", err
+		}
+		if err := os.WriteFile(jsonPath, append(data, '\n'), 0644); err != nil {
+			return "", "", fmt.Errorf("failed to save UI elements: %w", err)
+		}
+	}
+	if mode == locateOverlay || mode == locateBoth {
+		overlayPath = elementsPath(imagePath, ".png")
+		overlay, err := locate.Overlay(img, ef.Elements)
+		if err != nil {
+			return "", "", err
+		}
+		if err := writePNG(overlayPath, overlay); err != nil {
+			return "", "", err
+		}
+	}
+	return jsonPath, overlayPath, nil
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/robotin/screenshot/internal/lock"
+	"github.com/robotin/screenshot/internal/paths"
+)
+
+// Values for --single-instance
+const (
+	instanceWait = "wait"
+	instanceSkip = "skip"
+	instanceFail = "fail"
+)
+
+// errSkipped reports a capture skipped by --single-instance=skip
+var errSkipped = errors.New("skipped")
+
+// instanceLock takes the per-display capture lock according to
+// --single-instance. It returns errSkipped if the capture should be
+// skipped quietly.
+func instanceLock() (*lock.Lock, error) {
+	d := display
+	if d == "" {
+		d = os.Getenv("DISPLAY")
+	}
+	if d == "" {
+		d = ":0"
+	}
+	name := "capture-" + strings.NewReplacer("/", "_", ":", "").Replace(d) + ".lock"
+	path := filepath.Join(paths.RuntimeDir(), name)
+
+	switch singleInstance {
+	case instanceWait:
+		l, err := lock.TryAcquire(path)
+		if errors.Is(err, lock.ErrLocked) {
+			fmt.Fprintf(os.Stderr, "Waiting for another capture on %s to finish\n", d)
+			return lock.Acquire(path)
+		}
+		return l, err
+	case instanceSkip, instanceFail:
+		l, err := lock.TryAcquire(path)
+		if !errors.Is(err, lock.ErrLocked) {
+			return l, err
+		}
+		if singleInstance == instanceSkip {
+			fmt.Fprintf(os.Stderr, "Another capture is running on %s, skipping\n", d)
+			return nil, errSkipped
+		}
+		return nil, fmt.Errorf("another capture is running on %s", d)
+	default:
+		return nil, fmt.Errorf("invalid --single-instance %q: expected wait, skip or fail", singleInstance)
+	}
+}
@@ -0,0 +1,292 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/strategy"
+	"github.com/robotin/screenshot/internal/upload"
+)
+
+// Post-capture menu actions
+const (
+	actionSave     = "save"
+	actionSaveAs   = "save as"
+	actionCopy     = "copy"
+	actionAnnotate = "annotate"
+	actionUpload   = "upload"
+	actionDelete   = "delete"
+)
+
+// menuKeys maps terminal menu keys to actions
+var menuKeys = map[string]string{
+	"":  actionSave,
+	"s": actionSave,
+	"a": actionSaveAs,
+	"c": actionCopy,
+	"e": actionAnnotate,
+	"u": actionUpload,
+	"d": actionDelete,
+}
+
+// annotators are image editors tried for the Annotate action when
+// $SCREENSHOT_ANNOTATOR is not set
+var annotators = []string{"satty", "swappy", "ksnip", "pinta", "gimp"}
+
+// runMenu captures into a temporary file and asks what to do with it:
+// save (the default when the menu times out), save as, copy to the
+// clipboard, annotate in an image editor, upload, or delete. The menu is a
+// terminal prompt, or a zenity popup when there is no terminal (e.g. from
+// a hotkey daemon).
+func runMenu(capturer *capture.Capturer, opts strategy.CaptureOptions, enc capture.EncodeOptions, outputPath string, d *delivery) error {
+	f, err := captureFrame(capturer, opts)
+	if err != nil {
+		return err
+	}
+	enc, outputPath = resolveFormat(f.img, enc, outputPath)
+
+	tmp, err := os.MkdirTemp("", "screenshot-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	pending := filepath.Join(tmp, filepath.Base(outputPath))
+	out, enc, err := f.fitSize(enc)
+	if err != nil {
+		return err
+	}
+	if err := capture.Save(out, pending, enc); err != nil {
+		return err
+	}
+
+	action, err := chooseAction()
+	if err != nil {
+		return err
+	}
+	debugf("menu action: %s", action)
+
+	switch action {
+	case actionDelete:
+		infof("Screenshot discarded")
+		return nil
+
+	case actionCopy:
+		if err := f.toClipboard(); err != nil {
+			return err
+		}
+		infof("Screenshot copied to clipboard")
+		return nil
+
+	case actionSaveAs:
+		if outputPath, err = askSavePath(outputPath); err != nil {
+			return err
+		}
+
+	case actionAnnotate:
+		if err := annotateFile(pending); err != nil {
+			return err
+		}
+
+	case actionUpload:
+		if d.uploader == nil {
+			target := uploadTarget
+			if target == "" {
+				target = "imgur"
+			}
+			u, err := upload.New(target)
+			if err != nil {
+				return err
+			}
+			d = &delivery{uploader: u, target: target, webhook: d.webhook, spool: d.spool}
+		}
+	}
+
+	return keepPending(pending, outputPath, f, enc, d)
+}
+
+// keepPending moves the pending capture of f to outputPath and delivers
+// it
+func keepPending(pending, outputPath string, f *frame, enc capture.EncodeOptions, d *delivery) error {
+	if dir := filepath.Dir(outputPath); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+	}
+	if err := os.Rename(pending, outputPath); err != nil {
+		// The temporary directory may be on another filesystem
+		if err := copyPending(pending, outputPath); err != nil {
+			return fmt.Errorf("failed to save %s: %w", outputPath, err)
+		}
+	}
+
+	res := f.result(outputPath, enc)
+	if err := d.deliver(&res.Items[0], outputPath); err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		return printResult(res)
+	}
+	infof("Screenshot saved: %s", outputPath)
+	infoAnalysis(res.Items[0])
+	if url := res.Items[0].URL; url != "" {
+		infof("Uploaded: %s", url)
+	}
+	return nil
+}
+
+// copyPending copies src to dst
+func copyPending(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// chooseAction shows the menu and returns the chosen action. Without an
+// answer before --menu-timeout, the capture is saved.
+func chooseAction() (string, error) {
+	if isTerminal(os.Stdin) {
+		return terminalMenu()
+	}
+	if hasCommand("zenity") {
+		return zenityMenu()
+	}
+	return "", errors.New("--menu needs a terminal or zenity")
+}
+
+// terminalMenu prompts on stderr and reads a key from stdin
+func terminalMenu() (string, error) {
+	fmt.Fprintf(os.Stderr, "[S]ave, save [a]s, [c]opy, [e]dit/annotate, [u]pload, [d]elete (saving in %s): ", menuTimeout)
+
+	answer := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer <- strings.ToLower(strings.TrimSpace(line))
+	}()
+
+	select {
+	case key := <-answer:
+		action, ok := menuKeys[key]
+		if !ok {
+			// Don't lose the capture over a typo
+			fmt.Fprintf(os.Stderr, "Unknown choice %q, saving\n", key)
+			return actionSave, nil
+		}
+		return action, nil
+	case <-time.After(menuTimeout):
+		fmt.Fprintln(os.Stderr)
+		return actionSave, nil
+	}
+}
+
+// zenityMenu shows a popup list of actions
+func zenityMenu() (string, error) {
+	args := []string{
+		"--list", "--title=Screenshot", "--text=What should happen to the capture?",
+		"--column=Action", "--hide-header",
+		fmt.Sprintf("--timeout=%d", max(int(menuTimeout.Seconds()), 1)),
+		"Save", "Save as", "Copy", "Annotate", "Upload", "Delete",
+	}
+	out, err := exec.Command("zenity", args...).Output()
+
+	choice := strings.ToLower(strings.TrimSpace(string(out)))
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil && choice != "":
+		return choice, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 5:
+		// Timed out
+		return actionSave, nil
+	case err == nil, errors.As(err, &exitErr):
+		// Closed without a choice: treat like Delete, the user
+		// dismissed the capture
+		return actionDelete, nil
+	default:
+		return "", fmt.Errorf("failed to show menu: %w", err)
+	}
+}
+
+// askSavePath asks for a destination, suggesting def
+func askSavePath(def string) (string, error) {
+	if !isTerminal(os.Stdin) {
+		out, err := exec.Command("zenity", "--file-selection", "--save", "--confirm-overwrite", "--filename="+def).Output()
+		path := strings.TrimSpace(string(out))
+		if err != nil || path == "" {
+			return "", errors.New("save cancelled")
+		}
+		return path, nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Save as [%s]: ", def)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read path: %w", err)
+	}
+	if path := strings.TrimSpace(line); path != "" {
+		return path, nil
+	}
+	return def, nil
+}
+
+// annotateFile opens the capture in an image editor and waits for it to
+// close. $SCREENSHOT_ANNOTATOR overrides the editor (the file path is
+// appended as the last argument).
+func annotateFile(path string) error {
+	if editor := os.Getenv("SCREENSHOT_ANNOTATOR"); editor != "" {
+		return runEditor("sh", "-c", editor+` "$1"`, "annotator", path)
+	}
+
+	for _, name := range annotators {
+		if !hasCommand(name) {
+			continue
+		}
+		switch name {
+		case "satty":
+			return runEditor(name, "--filename", path, "--output-filename", path)
+		case "swappy":
+			return runEditor(name, "-f", path, "-o", path)
+		default:
+			return runEditor(name, path)
+		}
+	}
+	return fmt.Errorf("no image editor found (set $SCREENSHOT_ANNOTATOR or install one of: %s)", strings.Join(annotators, ", "))
+}
+
+// runEditor runs an editor in the foreground
+func runEditor(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("image editor failed: %w", err)
+	}
+	return nil
+}
+
+// hasCommand reports whether a program is on $PATH
+func hasCommand(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/robotin/screenshot/internal/analyze"
+	"github.com/robotin/screenshot/internal/imghash"
+	"github.com/robotin/screenshot/internal/notify"
+	"github.com/spf13/cobra"
+)
+
+// alertRecovered is the alert raised when the screen is back to normal
+const alertRecovered = "recovered"
+
+var (
+	monitorEvery     time.Duration
+	monitorBlankFor  time.Duration
+	monitorFrozenFor time.Duration
+	monitorAlertCmd  string
+	monitorOutput    string
+)
+
+var monitorCmd = &cobra.Command{
+	Use:   "monitor",
+	Short: "Alert when the screen goes blank or freezes",
+	Long: `Capture the screen every --every, and raise an alert when it has been
+entirely black, white or one solid color for --blank-for, or has not
+changed at all for --frozen-for: a health check for signage and kiosks.
+When the screen is back to normal, a "recovered" alert follows.
+
+Alerts are printed on stderr, run --alert-cmd and POST a "screen-alert"
+or "screen-recovered" event to --webhook. The command gets the alert in
+$SCREENSHOT_ALERT (black, white, solid, frozen or recovered, with the
+alert it ends in $SCREENSHOT_ALERT_FROM), when it started in
+$SCREENSHOT_ALERT_SINCE, a description in
+$SCREENSHOT_ALERT_MESSAGE and, with -o, the capture in
+$SCREENSHOT_ALERT_PATH.
+
+Examples:
+  screenshot monitor --alert-cmd 'systemctl restart kiosk'
+  screenshot monitor -m 0 --every 10s --blank-for 30s --webhook https://ops.example.com/hook
+  screenshot monitor --frozen-for 0 -o /var/lib/kiosk/alert.png --alert-cmd 'mail -s "$SCREENSHOT_ALERT_MESSAGE" ops < /dev/null'`,
+	Args: cobra.NoArgs,
+	RunE: runMonitor,
+}
+
+func init() {
+	monitorCmd.Flags().StringVar(&region, "region", "", "Region to watch: x,y,width,height")
+	monitorCmd.Flags().StringVarP(&monitor, "monitor", "m", "", "Monitor to watch: index, output name or virtual monitor (default: all)")
+	monitorCmd.Flags().StringVarP(&display, "display", "d", "", "X11 display (default: $DISPLAY or :0)")
+	monitorCmd.Flags().DurationVar(&monitorEvery, "every", 30*time.Second, "Capture this often")
+	monitorCmd.Flags().DurationVar(&monitorBlankFor, "blank-for", time.Minute, "Alert when the screen has been black, white or one solid color for this long (0 to not check)")
+	monitorCmd.Flags().DurationVar(&monitorFrozenFor, "frozen-for", 15*time.Minute, "Alert when the screen has not changed for this long (0 to not check, e.g. for static signage)")
+	monitorCmd.Flags().StringVar(&monitorAlertCmd, "alert-cmd", "", "Shell command to run on each alert, with $SCREENSHOT_ALERT and friends set")
+	monitorCmd.Flags().StringVarP(&monitorOutput, "output", "o", "", "Save the capture that raised an alert here (PNG)")
+	monitorCmd.Flags().StringVar(&webhookURL, "webhook", "", "POST a screen-alert or screen-recovered event to this URL on each alert")
+	monitorCmd.Flags().StringVar(&webhookSecret, "webhook-secret", "", "HMAC secret for signing webhook events (default: $SCREENSHOT_WEBHOOK_SECRET)")
+	monitorCmd.Flags().StringArrayVar(&tags, "tag", nil, "Tag included in webhook events (repeatable)")
+	monitorCmd.Flags().DurationVar(&duration, "duration", 0, "Stop after this long (default: until interrupted)")
+	rootCmd.AddCommand(monitorCmd)
+}
+
+// screenAlert is a change in the screen's health
+type screenAlert struct {
+	// Alert is black, white, solid, frozen or recovered
+	Alert string
+
+	// From is the alert a recovered alert ends
+	From string
+
+	// Since is when the screen started looking that way; for recovered,
+	// when the alert it ends started
+	Since time.Time
+
+	// Path is the capture saved with -o, if any
+	Path string
+
+	img      image.Image
+	analysis analyze.Result
+}
+
+// message describes the alert for people
+func (a screenAlert) message() string {
+	since := time.Since(a.Since).Round(time.Second)
+	switch a.Alert {
+	case alertRecovered:
+		if a.From == "frozen" {
+			return fmt.Sprintf("screen changing again after %s frozen", since)
+		}
+		return fmt.Sprintf("screen no longer %s after %s", a.From, since)
+	case "frozen":
+		return fmt.Sprintf("screen frozen for %s", since)
+	}
+	return fmt.Sprintf("screen %s for %s", a.Alert, since)
+}
+
+// screenHealth follows the captures of a monitor run and decides when
+// the screen's condition calls for an alert
+type screenHealth struct {
+	blankFor, frozenFor time.Duration
+
+	hash      uint64
+	changedAt time.Time
+	blank     string
+	blankAt   time.Time
+
+	// alerted is the condition last alerted about, "" when healthy
+	alerted      string
+	alertedSince time.Time
+}
+
+// update records a capture taken at now and returns the condition the
+// screen is in, and since when; "" when it is healthy
+func (h *screenHealth) update(img image.Image, a analyze.Result, now time.Time) (string, time.Time) {
+	if sum := imghash.Sum(img, imghash.Exact); h.changedAt.IsZero() || sum != h.hash {
+		h.hash, h.changedAt = sum, now
+	}
+	if a.Blank != h.blank {
+		h.blank, h.blankAt = a.Blank, now
+	}
+
+	switch {
+	case h.blankFor > 0 && h.blank != "" && now.Sub(h.blankAt) >= h.blankFor:
+		return h.blank, h.blankAt
+	case h.frozenFor > 0 && now.Sub(h.changedAt) >= h.frozenFor:
+		return "frozen", h.changedAt
+	}
+	return "", time.Time{}
+}
+
+func runMonitor(cmd *cobra.Command, args []string) error {
+	if monitorEvery <= 0 {
+		return fmt.Errorf("--every must be positive")
+	}
+	if monitorBlankFor <= 0 && monitorFrozenFor <= 0 {
+		return fmt.Errorf("nothing to check: --blank-for and --frozen-for are both 0")
+	}
+	if display != "" {
+		os.Setenv("DISPLAY", display)
+	}
+
+	auditDestination = "monitor"
+	capturer, err := newCapturer()
+	if err != nil {
+		return err
+	}
+	opts, err := buildCaptureOptions(capturer)
+	if err != nil {
+		return err
+	}
+
+	stop, stopNotify := notifyInterrupt()
+	defer stopNotify()
+	kill, err := startPanicSwitch(opts.Display)
+	if err != nil {
+		return err
+	}
+	defer kill.Close()
+	var deadline <-chan time.Time
+	if duration > 0 {
+		deadline = time.After(duration)
+	}
+
+	if !quiet {
+		var checks []string
+		if monitorBlankFor > 0 {
+			checks = append(checks, fmt.Sprintf("blank for %s", monitorBlankFor))
+		}
+		if monitorFrozenFor > 0 {
+			checks = append(checks, fmt.Sprintf("frozen for %s", monitorFrozenFor))
+		}
+		fmt.Fprintf(os.Stderr, "Monitoring every %s, alerting when the screen is %s (Ctrl-C to stop)\n",
+			monitorEvery, strings.Join(checks, " or "))
+	}
+
+	health := &screenHealth{blankFor: monitorBlankFor, frozenFor: monitorFrozenFor}
+	hook := newWebhook()
+	next := time.Now()
+	for {
+		img, err := capturer.Capture(opts)
+		if kill.Pulled() {
+			wipeImage(img)
+			return nil
+		}
+		if err != nil {
+			// Keep going: the screen may come back
+			fmt.Fprintf(os.Stderr, "Capture failed: %v\n", err)
+		} else {
+			a := analyze.Image(img)
+			debugf("luminance %.3f, blank score %.3f", a.Luminance, a.BlankScore)
+			cond, since := health.update(img, a, time.Now())
+			if cond != health.alerted {
+				alert := screenAlert{Alert: cond, Since: since, img: img, analysis: a}
+				if cond == "" {
+					alert.Alert, alert.From, alert.Since = alertRecovered, health.alerted, health.alertedSince
+				}
+				health.alerted, health.alertedSince = cond, since
+				raiseAlert(alert, hook)
+			}
+		}
+
+		next = next.Add(monitorEvery)
+		if !waitUntil(next, stop, kill.C, deadline) {
+			return nil
+		}
+	}
+}
+
+// raiseAlert reports an alert on stderr, through --alert-cmd and to the
+// webhook. Failures are reported but don't stop monitoring.
+func raiseAlert(a screenAlert, hook *notify.Webhook) {
+	if monitorOutput != "" && a.Alert != alertRecovered {
+		if err := writePNG(monitorOutput, a.img); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		} else {
+			a.Path = monitorOutput
+		}
+	}
+
+	msg := a.message()
+	if a.Alert == alertRecovered {
+		infof("Recovered: %s", msg)
+	} else {
+		fmt.Fprintf(os.Stderr, "Alert: %s\n", msg)
+	}
+
+	if monitorAlertCmd != "" {
+		cmd := exec.Command("sh", "-c", monitorAlertCmd)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(),
+			"SCREENSHOT_ALERT="+a.Alert,
+			"SCREENSHOT_ALERT_FROM="+a.From,
+			"SCREENSHOT_ALERT_SINCE="+a.Since.UTC().Format(time.RFC3339),
+			"SCREENSHOT_ALERT_MESSAGE="+msg,
+			"SCREENSHOT_ALERT_PATH="+a.Path)
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "Alert command failed: %v\n", err)
+		}
+	}
+
+	if hook == nil {
+		return
+	}
+	b := a.img.Bounds()
+	ev := notify.NewEvent(a.Path, "", "", b.Dx(), b.Dy(), tags)
+	ev.Type, ev.Alert = notify.EventScreenAlert, a.Alert
+	if a.Alert == alertRecovered {
+		ev.Type, ev.Alert = notify.EventScreenRecovered, a.From
+	}
+	since := a.Since.UTC()
+	ev.Since, ev.Analysis = &since, &a.analysis
+	if a.Path != "" {
+		ev.Format = "png"
+		if err := ev.Checksum(a.Path); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	debugf("sending %s event to webhook", ev.Type)
+	if err := hook.Send(ctx, ev); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/strategy"
+	"github.com/robotin/screenshot/internal/xwin"
+)
+
+// monitorTracker keeps the monitor layout current in long-running modes.
+// It re-reads geometry when RandR reports a change, or on every refresh
+// when RandR events are unavailable.
+type monitorTracker struct {
+	capturer *capture.Capturer
+	watcher  *xwin.LayoutWatcher
+	monitors []strategy.Monitor
+	stale    bool
+}
+
+// newMonitorTracker reads the initial layout and subscribes to changes
+func newMonitorTracker(capturer *capture.Capturer, display string) *monitorTracker {
+	t := &monitorTracker{capturer: capturer, stale: true}
+
+	if w, err := xwin.WatchLayout(display); err == nil {
+		t.watcher = w
+	}
+
+	t.Refresh()
+	return t
+}
+
+// Close stops listening for layout changes
+func (t *monitorTracker) Close() {
+	if t.watcher != nil {
+		t.watcher.Close()
+	}
+}
+
+// Monitors returns the most recently read layout
+func (t *monitorTracker) Monitors() []strategy.Monitor {
+	return t.monitors
+}
+
+// Refresh re-reads the layout if it may have changed and reports whether
+// it actually differs from the previous one
+func (t *monitorTracker) Refresh() bool {
+	if t.watcher != nil {
+		select {
+		case <-t.watcher.C:
+			t.stale = true
+		default:
+		}
+	}
+
+	if !t.stale && t.watcher != nil {
+		return false
+	}
+	t.stale = false
+
+	monitors, err := t.capturer.ListMonitors()
+	if err != nil || reflect.DeepEqual(monitors, t.monitors) {
+		return false
+	}
+
+	first := t.monitors == nil
+	t.monitors = monitors
+	return !first
+}
+
+// monitorJSON is a monitor as printed by --json
+type monitorJSON struct {
+	Index   int    `json:"index"`
+	Name    string `json:"name"`
+	X       int    `json:"x"`
+	Y       int    `json:"y"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// monitorsJSON converts a layout for --json output
+func monitorsJSON(monitors []strategy.Monitor) []monitorJSON {
+	out := make([]monitorJSON, len(monitors))
+	for i, m := range monitors {
+		out[i] = monitorJSON{m.Index, m.Name, m.Bounds.Min.X, m.Bounds.Min.Y, m.Bounds.Dx(), m.Bounds.Dy(), m.Primary}
+	}
+	return out
+}
+
+// describeLayout formats a layout as a compact single line for logs
+func describeLayout(monitors []strategy.Monitor) string {
+	parts := make([]string, len(monitors))
+	for i, m := range monitors {
+		parts[i] = fmt.Sprintf("%d:%dx%d+%d+%d", m.Index, m.Bounds.Dx(), m.Bounds.Dy(), m.Bounds.Min.X, m.Bounds.Min.Y)
+	}
+	return strings.Join(parts, " ")
+}
+
+// notifyInterrupt returns a channel that receives SIGINT/SIGTERM, and a
+// function to stop delivery
+func notifyInterrupt() (<-chan os.Signal, func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	return ch, func() { signal.Stop(ch) }
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/robotin/screenshot/internal/paths"
+	"github.com/robotin/screenshot/internal/upload"
+)
+
+// outputDirectory is the absolute directory captures are written to,
+// reported as "dir" in --json results
+var outputDirectory string
+
+// resolveOutputPath applies --output-dir to a relative output path and
+// picks the directory for generated names (--output-dir, else output_dir
+// from the config, else Screenshots in the pictures directory), so runs
+// from cron or hotkey daemons don't depend on their working directory.
+// It returns the path, still empty if a name is to be generated, and the
+// absolute output directory.
+func resolveOutputPath(path string) (string, string, error) {
+	if _, _, ok := upload.SplitObjectURI(path); ok {
+		return path, "", nil
+	}
+
+	dir := outputDir
+	switch {
+	case path == "" && dir == "":
+		var err error
+		if dir, err = defaultOutputDir(); err != nil {
+			return "", "", err
+		}
+	case path == "":
+	case filepath.IsAbs(path) || dir == "":
+		dir = filepath.Dir(path)
+	default:
+		path = filepath.Join(dir, path)
+		dir = filepath.Dir(path)
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", err
+	}
+	return path, abs, nil
+}
+
+// defaultOutputDir returns the directory for generated names without
+// --output-dir
+func defaultOutputDir() (string, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return "", err
+	}
+	if cfg.OutputDir != "" {
+		return paths.ExpandHome(cfg.OutputDir)
+	}
+	if ciMode {
+		return ciOutputDir, nil
+	}
+
+	pictures, err := paths.PicturesDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(pictures, "Screenshots"), nil
+}
+
+// exitBrokenPipe is the status a shell reports for a process killed by
+// SIGPIPE
+const exitBrokenPipe = 128 + 13
+
+// exitProtectedWindow is the status for a capture aborted because a
+// protected window was on screen
+const exitProtectedWindow = 3
+
+// stdoutError returns err from writing to stdout, except that a reader
+// closing the pipe early ends the process quietly with the status SIGPIPE
+// would have given it, instead of an error and the usage text
+func stdoutError(err error) error {
+	if errors.Is(err, syscall.EPIPE) {
+		debugf("stdout closed by reader: %v", err)
+		os.Exit(exitBrokenPipe)
+	}
+	return err
+}
+
+// checkBinaryStdout refuses to write binary data to a terminal, where it
+// would garble the screen, unless --force is given. hint shows how the
+// output is meant to be used.
+func checkBinaryStdout(what, hint string) error {
+	if force || !isTerminal(os.Stdout) {
+		return nil
+	}
+	return fmt.Errorf("refusing to write %s to a terminal; pipe or redirect it (%s) or use --force", what, hint)
+}
+
+// infof prints a status message such as "Screenshot saved: ..." on stdout.
+// --quiet drops it, and with --json or --stdout it goes to stderr, so
+// stdout carries nothing but the JSON result or the image.
+func infof(format string, args ...any) {
+	switch {
+	case quiet:
+	case jsonOutput || stdout:
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+	default:
+		fmt.Printf(format+"\n", args...)
+	}
+}
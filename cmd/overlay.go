@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/portal"
+	"github.com/robotin/screenshot/internal/xwin"
+)
+
+// overlayPortal is the --overlay-fallback that asks the desktop portal
+const overlayPortal = "portal"
+
+// overlayFallback is the --overlay-fallback for video that comes out black
+var overlayFallback string
+
+// videoClasses are the WM_CLASS names of players and browsers, which may
+// put video on a hardware overlay plane or play DRM-protected streams
+var videoClasses = []string{
+	"mpv", "vlc", "totem", "celluloid", "smplayer", "mplayer", "kodi", "haruna",
+	"dragon", "parole", "io.github.celluloid_player.celluloid",
+	"firefox", "firefox-esr", "librewolf", "chromium", "chromium-browser",
+	"google-chrome", "brave-browser", "microsoft-edge", "vivaldi-stable", "opera",
+}
+
+// overlayWarned keeps each window class's black video warning to once
+// per run
+var overlayWarned struct {
+	sync.Mutex
+	classes map[string]bool
+}
+
+// setOverlayPolicy has X11 captures check players and browsers for video
+// that came out black and fill it in per --overlay-fallback
+func setOverlayPolicy(c *capture.Capturer) error {
+	p := capture.OverlayPolicy{
+		Backends: []string{"x11"},
+		Windows:  videoWindows,
+		OnBlack:  warnBlackVideo,
+	}
+	switch overlayFallback {
+	case "":
+	case overlayPortal:
+		p.Fallback = portal.Screenshot
+	default:
+		return fmt.Errorf("invalid --overlay-fallback %q (expected %s)", overlayFallback, overlayPortal)
+	}
+	c.SetOverlayPolicy(p)
+	return nil
+}
+
+// videoWindows returns the visible players and browsers
+func videoWindows() ([]capture.VideoWindow, error) {
+	conn, err := xwin.Connect(display)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	windows, err := conn.Windows()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []capture.VideoWindow
+	for _, w := range windows {
+		if w.Hidden {
+			continue
+		}
+		for _, class := range videoClasses {
+			if strings.EqualFold(class, w.Class) || strings.EqualFold(class, w.Instance) {
+				found = append(found, capture.VideoWindow{Class: w.Class, Bounds: w.Bounds})
+				break
+			}
+		}
+	}
+	return found, nil
+}
+
+// warnBlackVideo explains a black video area, once per window class
+func warnBlackVideo(a capture.BlackArea) {
+	size := fmt.Sprintf("%dx%d at %d,%d", a.Bounds.Dx(), a.Bounds.Dy(), a.Bounds.Min.X, a.Bounds.Min.Y)
+	if a.Filled {
+		debugf("black video in %s (%s) filled in from the %s", a.Class, size, overlayFallback)
+		return
+	}
+
+	overlayWarned.Lock()
+	defer overlayWarned.Unlock()
+	if overlayWarned.classes[a.Class] {
+		return
+	}
+	if overlayWarned.classes == nil {
+		overlayWarned.classes = map[string]bool{}
+	}
+	overlayWarned.classes[a.Class] = true
+
+	switch {
+	case a.FallbackErr != nil:
+		fmt.Fprintf(os.Stderr, "Warning: video in %s (%s) came out black, and --overlay-fallback %s failed: %v\n", a.Class, size, overlayFallback, a.FallbackErr)
+	case overlayFallback != "":
+		fmt.Fprintf(os.Stderr, "Warning: video in %s (%s) came out black, also through --overlay-fallback %s: it is probably DRM-protected\n", a.Class, size, overlayFallback)
+	default:
+		fmt.Fprintf(os.Stderr, "Warning: video in %s (%s) came out black: it is probably shown on a hardware overlay plane, which screen grabs can't read, or DRM-protected. Try --overlay-fallback portal, or turn off hardware video overlays in the player (mpv --vo=gpu, VLC's OpenGL output)\n", a.Class, size)
+	}
+}
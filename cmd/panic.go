@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/robotin/screenshot/internal/xwin"
+)
+
+// panicKey is --panic-key
+var panicKey string
+
+// panicSwitch stops long-running captures at once, from the panic
+// hotkey or SIGHUP, and wipes the frames they hold in memory
+type panicSwitch struct {
+	// C is closed when the switch is pulled
+	C <-chan struct{}
+
+	c     chan struct{}
+	once  sync.Once
+	sig   chan os.Signal
+	keys  *xwin.KeyWatcher
+	done  chan struct{}
+	mu    sync.Mutex
+	wipes []func()
+}
+
+// startPanicSwitch watches for SIGHUP and, if set, the panic hotkey
+// (--panic-key, else panic_key in the config) on display. A hotkey that
+// can't be grabbed is an error when given on the command line and a
+// warning from the config, so a config shared by headless machines
+// doesn't stop them.
+func startPanicSwitch(display string) (*panicSwitch, error) {
+	c := make(chan struct{})
+	p := &panicSwitch{C: c, c: c, sig: make(chan os.Signal, 1), done: make(chan struct{})}
+
+	spec, fromFlag := panicKey, panicKey != ""
+	if spec == "" {
+		cfg, err := loadConfig()
+		if err != nil {
+			return nil, err
+		}
+		spec = cfg.PanicKey
+	}
+	var keys <-chan struct{}
+	if spec != "" {
+		key, err := xwin.ParseKey(spec)
+		if err == nil {
+			p.keys, err = xwin.WatchKey(display, key)
+		}
+		switch {
+		case err != nil && fromFlag:
+			return nil, fmt.Errorf("cannot use --panic-key: %w", err)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Panic key disabled: %v\n", err)
+		default:
+			keys = p.keys.C
+			debugf("panic key: %s", key)
+		}
+	}
+
+	signal.Notify(p.sig, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-p.sig:
+				fmt.Fprintln(os.Stderr, "Stopped by SIGHUP")
+			case _, ok := <-keys:
+				if !ok {
+					// Lost the X connection: SIGHUP still works
+					keys = nil
+					continue
+				}
+				fmt.Fprintln(os.Stderr, "Stopped by the panic key")
+			case <-p.done:
+				return
+			}
+			p.pull()
+			return
+		}
+	}()
+	return p, nil
+}
+
+// pull runs the wipes and closes C
+func (p *panicSwitch) pull() {
+	p.once.Do(func() {
+		p.mu.Lock()
+		for _, wipe := range p.wipes {
+			wipe()
+		}
+		p.mu.Unlock()
+		close(p.c)
+	})
+}
+
+// Pulled reports whether the switch has been pulled
+func (p *panicSwitch) Pulled() bool {
+	select {
+	case <-p.C:
+		return true
+	default:
+		return false
+	}
+}
+
+// OnWipe adds a function to run when the switch is pulled, before C is
+// closed
+func (p *panicSwitch) OnWipe(wipe func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.wipes = append(p.wipes, wipe)
+}
+
+// Close stops watching
+func (p *panicSwitch) Close() {
+	signal.Stop(p.sig)
+	close(p.done)
+	if p.keys != nil {
+		p.keys.Close()
+	}
+}
+
+// wipeImage zeroes the pixels of a captured frame, so they don't linger
+// in memory until the garbage collector reuses it
+func wipeImage(img image.Image) {
+	switch m := img.(type) {
+	case *image.RGBA:
+		clear(m.Pix)
+	case *image.NRGBA:
+		clear(m.Pix)
+	case *image.Gray:
+		clear(m.Pix)
+	case *image.YCbCr:
+		clear(m.Y)
+		clear(m.Cb)
+		clear(m.Cr)
+	}
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/robotin/screenshot/internal/annotate"
+	"github.com/robotin/screenshot/internal/strategy"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pixelExpect    string
+	pixelTolerance int
+)
+
+var pixelCmd = &cobra.Command{
+	Use:   "pixel <x,y>",
+	Short: "Print the color of a screen pixel",
+	Long: `Print the color of one pixel (screen coordinates) as #rrggbb. Only that
+pixel is grabbed and nothing is encoded, so scripts can poll it cheaply.
+
+With --expect, exit with status 1 unless the pixel matches the color
+(within --tolerance per channel).
+
+Examples:
+  screenshot pixel 100,200
+  screenshot pixel 100,200 --json
+  until screenshot pixel 1850,40 --expect '#2ecc71' --tolerance 30; do sleep 0.5; done`,
+	Args: cobra.ExactArgs(1),
+	RunE: runPixel,
+}
+
+func init() {
+	pixelCmd.Flags().StringVar(&pixelExpect, "expect", "", "Exit with status 1 unless the pixel is this color (name or #rrggbb)")
+	pixelCmd.Flags().IntVar(&pixelTolerance, "tolerance", 0, "Maximum difference per channel for --expect (0-255)")
+	pixelCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the color as JSON")
+	pixelCmd.Flags().StringVarP(&display, "display", "d", "", "X11 display (default: $DISPLAY or :0)")
+	rootCmd.AddCommand(pixelCmd)
+}
+
+func runPixel(cmd *cobra.Command, args []string) error {
+	pt, err := parsePoint(args[0])
+	if err != nil {
+		return err
+	}
+	var want color.RGBA
+	if pixelExpect != "" {
+		if want, err = annotate.ParseColor(pixelExpect); err != nil {
+			return err
+		}
+	}
+	if display != "" {
+		os.Setenv("DISPLAY", display)
+	}
+
+	auditDestination = "pixel"
+	capturer, err := newCapturer()
+	if err != nil {
+		return err
+	}
+	r := image.Rectangle{Min: pt, Max: pt.Add(image.Pt(1, 1))}
+	img, err := capturer.Capture(strategy.CaptureOptions{Monitor: -1, Region: &r})
+	if err != nil {
+		return fmt.Errorf("capture failed: %w", err)
+	}
+	c := color.NRGBAModel.Convert(img.At(img.Bounds().Min.X, img.Bounds().Min.Y)).(color.NRGBA)
+	hex := fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		type pixelJSON struct {
+			X   int    `json:"x"`
+			Y   int    `json:"y"`
+			Hex string `json:"hex"`
+			R   uint8  `json:"r"`
+			G   uint8  `json:"g"`
+			B   uint8  `json:"b"`
+			A   uint8  `json:"a"`
+		}
+		if err := enc.Encode(pixelJSON{pt.X, pt.Y, hex, c.R, c.G, c.B, c.A}); err != nil {
+			return err
+		}
+	} else {
+		fmt.Println(hex)
+	}
+
+	if pixelExpect != "" && !colorMatches(c, want, pixelTolerance) {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// colorMatches reports whether c is within tolerance of want on every
+// channel
+func colorMatches(c color.NRGBA, want color.RGBA, tolerance int) bool {
+	diff := func(a, b uint8) int {
+		if a > b {
+			return int(a - b)
+		}
+		return int(b - a)
+	}
+	return diff(c.R, want.R) <= tolerance && diff(c.G, want.G) <= tolerance && diff(c.B, want.B) <= tolerance
+}
+
+// parsePoint parses "x,y"
+func parsePoint(s string) (image.Point, error) {
+	xs, ys, ok := strings.Cut(s, ",")
+	x, errX := strconv.Atoi(strings.TrimSpace(xs))
+	y, errY := strconv.Atoi(strings.TrimSpace(ys))
+	if !ok || errX != nil || errY != nil {
+		return image.Point{}, fmt.Errorf("invalid point %q: expected x,y", s)
+	}
+	return image.Pt(x, y), nil
+}
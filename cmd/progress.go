@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/events"
+)
+
+const (
+	// progressDelay is how long an operation runs before its progress is
+	// shown, so quick saves and uploads print nothing
+	progressDelay = time.Second
+
+	// progressInterval spaces redraws of the bar and progress events
+	progressInterval = 250 * time.Millisecond
+
+	// progressWidth is the width of the bar itself
+	progressWidth = 24
+)
+
+// progressLine is the bar on stderr; concurrent operations take turns
+var progressLine struct {
+	sync.Mutex
+	drawn bool
+}
+
+// showProgressBar reports whether slow operations draw a bar on stderr:
+// only for a person watching a terminal, never with --quiet, --json or
+// --events, which get progress events instead
+func showProgressBar() bool {
+	return !quiet && !jsonOutput && eventsFormat == "" && isTerminal(os.Stderr)
+}
+
+// progress follows one slow operation: a save or an upload. Once it has
+// been going for progressDelay, it is shown every progressInterval until
+// finish, so phases that write nothing for a while still show the time.
+type progress struct {
+	mu    sync.Mutex
+	phase string
+	path  string
+	total int64
+	done  int64
+	start time.Time
+	shown bool
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// newProgress starts following an operation on path; total is 0 when the
+// size isn't known up front
+func newProgress(phase, path string, total int64) *progress {
+	p := &progress{phase: phase, path: path, total: total, start: time.Now(), stop: make(chan struct{})}
+	go p.run()
+	return p
+}
+
+// run shows the progress until finish
+func (p *progress) run() {
+	delay := time.NewTimer(progressDelay)
+	defer delay.Stop()
+	select {
+	case <-p.stop:
+		return
+	case <-delay.C:
+	}
+
+	tick := time.NewTicker(progressInterval)
+	defer tick.Stop()
+	for {
+		p.mu.Lock()
+		select {
+		case <-p.stop:
+			// finish may already have cleared the bar
+		default:
+			p.show()
+		}
+		p.mu.Unlock()
+		select {
+		case <-p.stop:
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// set records the bytes done so far, in phase
+func (p *progress) set(phase string, done int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.total > 0 {
+		done = min(done, p.total)
+	}
+	p.phase, p.done = phase, done
+}
+
+// add records n more bytes done
+func (p *progress) add(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done += n
+	if p.total > 0 {
+		p.done = min(p.done, p.total)
+	}
+}
+
+// finish ends the operation, with a last event at the final count and the
+// bar cleared if any progress was shown
+func (p *progress) finish() {
+	p.once.Do(func() { close(p.stop) })
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.shown {
+		return
+	}
+	p.shown = false
+	eventBus.Publish(p.event())
+
+	progressLine.Lock()
+	defer progressLine.Unlock()
+	if progressLine.drawn {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+		progressLine.drawn = false
+	}
+}
+
+// show publishes a progress event and redraws the bar
+func (p *progress) show() {
+	p.shown = true
+	eventBus.Publish(p.event())
+	if !showProgressBar() {
+		return
+	}
+	progressLine.Lock()
+	defer progressLine.Unlock()
+	fmt.Fprintf(os.Stderr, "\r\033[K%s", p.bar())
+	progressLine.drawn = true
+}
+
+// event is the progress event for the current count
+func (p *progress) event() events.Event {
+	return events.Event{Type: events.Progress, Phase: p.phase, Path: p.path, Done: p.done, Total: p.total}
+}
+
+// bar renders the progress line: a bar with the percentage and rate when
+// the total is known, the bytes and time so far otherwise
+func (p *progress) bar() string {
+	verb := map[string]string{"encode": "Encoding", "write": "Writing", "upload": "Uploading"}[p.phase]
+	elapsed := time.Since(p.start)
+	label := verb + " to stdout"
+	if p.path != "" {
+		label = fmt.Sprintf("%s %s", verb, filepath.Base(p.path))
+	}
+	if p.total <= 0 {
+		return fmt.Sprintf("%s  %s  %s", label, formatBytes(p.done), elapsed.Round(time.Second))
+	}
+
+	filled := int(int64(progressWidth) * p.done / p.total)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressWidth-filled)
+	rate := int64(float64(p.done) / elapsed.Seconds())
+	return fmt.Sprintf("%s  [%s] %3d%%  %s/%s  %s/s", label, bar, 100*p.done/p.total,
+		formatBytes(p.done), formatBytes(p.total), formatBytes(rate))
+}
+
+// saveProgress follows the saves of a run for capture.EncodeOptions.
+// Saves run concurrently (--crop, --thumbnail), so each file has its own
+// progress.
+func saveProgress() func(path string, phase capture.Phase, done int64) {
+	var mu sync.Mutex
+	saves := map[string]*progress{}
+	return func(path string, phase capture.Phase, done int64) {
+		mu.Lock()
+		p := saves[path]
+		if p == nil {
+			p = newProgress(string(phase), path, 0)
+			saves[path] = p
+		}
+		if phase == capture.PhaseDone {
+			delete(saves, path)
+		}
+		mu.Unlock()
+
+		if phase == capture.PhaseDone {
+			p.finish()
+			return
+		}
+		p.set(string(phase), done)
+	}
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/robotin/screenshot/internal/session"
+	"github.com/spf13/cobra"
+)
+
+var recoverOutput string
+
+var recoverCmd = &cobra.Command{
+	Use:   "recover <bundle.rsb>",
+	Short: "Salvage a session bundle whose recording was cut short",
+	Long: `Rebuild a session bundle left unreadable when the recording was killed,
+crashed or lost power, keeping every frame written before it stopped.
+
+The frame timeline comes from the journal recorded next to the bundle
+(bundle.rsb.journal). Without it, as for bundles recorded by older
+versions, frames are spaced evenly between their file times.
+
+Examples:
+  screenshot recover session.rsb                   # Repair in place
+  screenshot recover session.rsb -o saved.rsb      # Keep the damaged file`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRecover,
+}
+
+func init() {
+	recoverCmd.Flags().StringVarP(&recoverOutput, "output", "o", "", "Write the recovered bundle here (default: replace the damaged one)")
+	rootCmd.AddCommand(recoverCmd)
+}
+
+func runRecover(cmd *cobra.Command, args []string) error {
+	path := args[0]
+	out := recoverOutput
+	if out == "" {
+		out = path
+	}
+
+	rec, err := session.Recover(path, out)
+	if err != nil {
+		return err
+	}
+	if !rec.Journal {
+		fmt.Fprintf(os.Stderr, "Warning: no journal for %s; frame times are estimated\n", path)
+	}
+	infof("Recovered %d frames (%.1fs) into %s", rec.Manifest.Frames, rec.Manifest.Duration, out)
+	return nil
+}
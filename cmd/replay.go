@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/session"
+	"github.com/spf13/cobra"
+)
+
+var (
+	replayFrame  int
+	replayOutput string
+	replayVideo  bool
+)
+
+var replayCmd = &cobra.Command{
+	Use:   "replay <bundle.rsb | index.json>",
+	Short: "Inspect or render a recorded session bundle",
+	Long: `Inspect or render a session bundle recorded with --session.
+
+Without options, prints the bundle summary and its event timeline. For
+the index of a session recorded with --segment, lists the segments, and
+--video renders them all.
+
+Examples:
+  screenshot replay session.rsb                     # Show timeline
+  screenshot replay session.rsb --frame 12 -o f.png # Extract one frame
+  screenshot replay session.rsb --video | ffmpeg -i - out.mp4   # Render to video`,
+	Args: cobra.ExactArgs(1),
+	RunE: runReplay,
+}
+
+func init() {
+	replayCmd.Flags().IntVar(&replayFrame, "frame", -1, "Extract a single frame by number")
+	replayCmd.Flags().StringVarP(&replayOutput, "output", "o", "", "Output file (default: stdout for --video, frame_N.png for --frame)")
+	replayCmd.Flags().BoolVar(&replayVideo, "video", false, "Render all frames as a y4m video stream")
+	rootCmd.AddCommand(replayCmd)
+}
+
+func runReplay(cmd *cobra.Command, args []string) error {
+	if session.IsIndex(args[0]) {
+		return replayIndex(args[0])
+	}
+	r, err := openBundle(args[0])
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	switch {
+	case replayFrame >= 0:
+		return replayExtractFrame(r)
+	case replayVideo:
+		return replayRenderVideo(r)
+	default:
+		return replayTimeline(r)
+	}
+}
+
+// openBundle opens a bundle, pointing to recover when it's incomplete
+func openBundle(path string) (*session.Reader, error) {
+	r, err := session.Open(path)
+	if errors.Is(err, session.ErrInterrupted) {
+		return nil, fmt.Errorf("%w (still recording, or cut short: screenshot recover %s)", err, path)
+	}
+	return r, err
+}
+
+// replayTimeline prints the manifest and events, one per line
+func replayTimeline(r *session.Reader) error {
+	m := r.Manifest
+	fmt.Printf("Session from %s on %s: %d frames, %.1fs at %.2g fps\n",
+		m.Started.Format("2006-01-02 15:04:05"), m.Host, m.Frames, m.Duration, m.FPS)
+
+	for _, e := range r.Events {
+		line := fmt.Sprintf("  %10.6fs  %-8s", r.Elapsed(e).Seconds(), e.Type)
+		if e.Frame != nil {
+			line += fmt.Sprintf(" #%d", *e.Frame)
+		}
+		if e.PTS != nil {
+			line += fmt.Sprintf(" pts=%d", *e.PTS)
+		}
+		if e.Data != nil {
+			data, _ := json.Marshal(e.Data)
+			line += " " + string(data)
+		}
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+	return nil
+}
+
+// replayExtractFrame writes a single frame as PNG
+func replayExtractFrame(r *session.Reader) error {
+	img, err := r.Frame(replayFrame)
+	if err != nil {
+		return err
+	}
+
+	path := replayOutput
+	if path == "" {
+		path = fmt.Sprintf("frame_%06d.png", replayFrame)
+	}
+	if path == "-" {
+		if err := checkBinaryStdout("image data", "screenshot replay s.rsb --frame N -o - | feh -"); err != nil {
+			return err
+		}
+		return stdoutError(capture.WritePNG(img, os.Stdout, 1))
+	}
+
+	if err := capture.SavePNG(img, path, 1); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Frame saved: %s\n", path)
+	return nil
+}
+
+// replayRenderVideo streams the frames as y4m at the recorded frame rate.
+// Frames are repeated or dropped by their capture timestamps, so capture
+// stalls keep their real length and the video stays aligned with the
+// timeline.
+func replayRenderVideo(r *session.Reader) error {
+	return renderVideo(r.Manifest.FPS, func(y4m capture.FrameWriter) error {
+		return writeVideo(r, y4m)
+	})
+}
+
+// renderVideo opens the video output and lets write fill it
+func renderVideo(fps float64, write func(capture.FrameWriter) error) error {
+	out := os.Stdout
+	if replayOutput != "" && replayOutput != "-" {
+		f, err := os.Create(replayOutput)
+		if err != nil {
+			return fmt.Errorf("failed to create file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	} else if err := checkBinaryStdout("video data", "screenshot replay s.rsb --video | ffmpeg -i - out.mp4"); err != nil {
+		return err
+	}
+
+	y4m, err := capture.NewVideoWriter(out, fps)
+	if err != nil {
+		return err
+	}
+	if err := write(y4m); err != nil {
+		return stdoutError(err)
+	}
+	return stdoutError(y4m.Flush())
+}
+
+// writeVideo writes the bundle's frames to y4m
+func writeVideo(r *session.Reader, y4m capture.FrameWriter) error {
+	slots := videoSlots(r)
+	for n := 0; n < r.Manifest.Frames; n++ {
+		repeat := 1
+		if slots != nil {
+			if repeat = slots[n]; repeat == 0 {
+				continue
+			}
+		}
+		img, err := r.Frame(n)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < repeat; i++ {
+			if err := y4m.WriteFrame(img); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// replayIndex prints the segments of a session recorded with --segment,
+// or renders them as one video
+func replayIndex(path string) error {
+	ix, err := session.ReadIndex(path)
+	if err != nil {
+		return err
+	}
+	if replayFrame >= 0 {
+		return fmt.Errorf("--frame needs a segment's bundle, not the index")
+	}
+	if replayVideo {
+		return renderVideo(ix.FPS, func(y4m capture.FrameWriter) error {
+			for _, seg := range ix.Segments {
+				if err := writeSegmentVideo(filepath.Join(filepath.Dir(path), seg.File), y4m); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	frames, seconds := 0, 0.0
+	for _, seg := range ix.Segments {
+		frames += seg.Frames
+		seconds += seg.Duration
+	}
+	fmt.Printf("Session from %s: %d segments of %s, %d frames, %.1fs\n",
+		ix.Started.Format("2006-01-02 15:04:05"), len(ix.Segments),
+		time.Duration(ix.Segment*float64(time.Second)), frames, seconds)
+	for _, seg := range ix.Segments {
+		line := fmt.Sprintf("  %s  %s  %6d frames  %8.1fs", seg.Started.Format("15:04:05"), seg.File, seg.Frames, seg.Duration)
+		if seg.Recording {
+			line += "  (still recording, or cut short)"
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+// writeSegmentVideo appends the frames of one segment to y4m
+func writeSegmentVideo(path string, y4m capture.FrameWriter) error {
+	r, err := openBundle(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return writeVideo(r, y4m)
+}
+
+// videoSlots returns how many output frames each recorded frame fills at
+// the manifest frame rate, or nil when the bundle has no frame PTS
+func videoSlots(r *session.Reader) []int {
+	fps := r.Manifest.FPS
+	pts := make([]int64, r.Manifest.Frames)
+	seen := 0
+	for _, e := range r.Events {
+		if e.Frame != nil && e.PTS != nil && *e.Frame >= 0 && *e.Frame < len(pts) {
+			pts[*e.Frame] = *e.PTS
+			seen++
+		}
+	}
+	if fps <= 0 || seen != len(pts) || len(pts) == 0 {
+		return nil
+	}
+
+	// A frame is shown from its slot up to the next frame's slot; the
+	// last one gets a single slot
+	slot := func(p int64) int64 {
+		return int64(math.Round(float64(p-pts[0]) / session.PTSPerSecond * fps))
+	}
+	slots := make([]int, len(pts))
+	for n := range pts {
+		if n == len(pts)-1 {
+			slots[n] = 1
+			break
+		}
+		slots[n] = int(max(slot(pts[n+1])-slot(pts[n]), 0))
+	}
+	return slots
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/robotin/screenshot/internal/history"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reportBy     string
+	reportMaxGap time.Duration
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Summarize time on screen per application from the history",
+	Long: `Estimate how long each application had the focus from the window
+recorded with every capture, as a lightweight time tracker built on
+interval captures: each capture counts for the time until the next one.
+Gaps longer than --max-gap, where capturing stopped, count as the usual
+interval instead.
+
+Applications are told apart by window class (--by class), or by class
+and window title (--by title). Time with no window focused is reported as
+(none); captures taken without X, or before focus was recorded, are left
+out. --since, --until, --tag and --monitor filter as in history export.
+
+Examples:
+  screenshot --interval 1m --quiet &
+  screenshot report --since 7d
+  screenshot report --since 2024-05-01 --by title -n 0
+  screenshot report --since 24h --json`,
+	Args: cobra.NoArgs,
+	RunE: runReport,
+}
+
+func init() {
+	reportCmd.Flags().StringVar(&historySince, "since", "", "Only count captures taken at or after this date, time or duration ago")
+	reportCmd.Flags().StringVar(&historyUntil, "until", "", "Only count captures taken before this date, time or duration ago")
+	reportCmd.Flags().StringVar(&historyTag, "tag", "", "Only count captures with this tag")
+	reportCmd.Flags().IntVar(&historyMonitor, "monitor", -1, "Only count captures of this monitor index")
+	reportCmd.Flags().StringVar(&reportBy, "by", "class", "Group by window class or by class and title: class or title")
+	reportCmd.Flags().DurationVar(&reportMaxGap, "max-gap", 10*time.Minute, "Longest time between captures counted as on screen")
+	reportCmd.Flags().IntVarP(&historyLimit, "limit", "n", 20, "Most applications to list (0 for all)")
+	reportCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the report as JSON")
+	rootCmd.AddCommand(reportCmd)
+}
+
+// reportJSON is the report --json prints
+type reportJSON struct {
+	From         time.Time         `json:"from"`
+	To           time.Time         `json:"to"`
+	Captures     int               `json:"captures"`
+	TotalSeconds float64           `json:"total_seconds"`
+	Applications []reportUsageJSON `json:"applications"`
+}
+
+// reportUsageJSON is one application's line of the report
+type reportUsageJSON struct {
+	Name     string  `json:"name"`
+	Seconds  float64 `json:"seconds"`
+	Share    float64 `json:"share"`
+	Captures int     `json:"captures"`
+}
+
+func runReport(cmd *cobra.Command, args []string) error {
+	var name func(history.Entry) string
+	switch reportBy {
+	case "class":
+		name = func(e history.Entry) string {
+			if e.Focus == nil || e.Focus.Class == "" {
+				return "(none)"
+			}
+			return e.Focus.Class
+		}
+	case "title":
+		name = func(e history.Entry) string {
+			if e.Focus == nil || e.Focus.Class == "" && e.Focus.Title == "" {
+				return "(none)"
+			}
+			return e.Focus.Class + ": " + e.Focus.Title
+		}
+	default:
+		return fmt.Errorf("unknown --by %q (expected class or title)", reportBy)
+	}
+	if reportMaxGap <= 0 {
+		return fmt.Errorf("--max-gap must be positive")
+	}
+
+	entries, _, err := filteredHistory()
+	if err != nil {
+		return err
+	}
+	usage, total := history.ScreenTime(entries, name, reportMaxGap)
+	captures := 0
+	for _, u := range usage {
+		captures += u.Captures
+	}
+	var from, to time.Time
+	for i, e := range entries {
+		if i == 0 || e.Time.Before(from) {
+			from = e.Time
+		}
+		if e.Time.After(to) {
+			to = e.Time
+		}
+	}
+
+	share := func(d time.Duration) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(d) / float64(total)
+	}
+
+	if jsonOutput {
+		r := reportJSON{From: from, To: to, Captures: captures, TotalSeconds: total.Seconds(), Applications: []reportUsageJSON{}}
+		for _, u := range usage {
+			r.Applications = append(r.Applications, reportUsageJSON{
+				Name:     u.Name,
+				Seconds:  u.Time.Seconds(),
+				Share:    share(u.Time),
+				Captures: u.Captures,
+			})
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return stdoutError(enc.Encode(r))
+	}
+
+	if len(usage) == 0 {
+		return fmt.Errorf("no captures with focus information in the history (interval captures record it under X11)")
+	}
+	w := bufio.NewWriter(os.Stdout)
+	fmt.Fprintf(w, "%s to %s: %s on screen in %d captures\n\n",
+		from.Local().Format("2006-01-02 15:04"), to.Local().Format("2006-01-02 15:04"), formatSpan(total), captures)
+	shown := usage
+	if historyLimit > 0 && len(shown) > historyLimit {
+		shown = shown[:historyLimit]
+	}
+	for _, u := range shown {
+		fmt.Fprintf(w, "%9s %6.1f%%  %s\n", formatSpan(u.Time), 100*share(u.Time), u.Name)
+	}
+	if rest := len(usage) - len(shown); rest > 0 {
+		fmt.Fprintf(w, "%17s  (%d more, -n 0 to list all)\n", "", rest)
+	}
+	return stdoutError(w.Flush())
+}
+
+// formatSpan formats a duration in hours and minutes, or seconds when
+// shorter than a minute
+func formatSpan(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+	m := int(d.Round(time.Minute).Minutes())
+	if m < 60 {
+		return fmt.Sprintf("%dm", m)
+	}
+	return fmt.Sprintf("%dh%02dm", m/60, m%60)
+}
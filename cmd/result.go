@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+
+	"github.com/robotin/screenshot/internal/analyze"
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/history"
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// Item statuses reported in --json output
+const (
+	statusOK         = "ok"
+	statusFailed     = "failed"
+	statusRolledBack = "rolled_back"
+	statusSkipped    = "skipped"
+)
+
+// analyzeCaptures is --analyze
+var analyzeCaptures bool
+
+// captureResult is the machine-readable result of a capture run (--json)
+type captureResult struct {
+	OK    bool         `json:"ok"`
+	Dir   string       `json:"dir,omitempty"`
+	Items []resultItem `json:"items"`
+	Error string       `json:"error,omitempty"`
+
+	// Stats is the --stats timing breakdown
+	Stats *statsJSON `json:"stats,omitempty"`
+}
+
+// resultItem describes one output file of a run
+type resultItem struct {
+	Path     string          `json:"path,omitempty"`
+	Monitor  *int            `json:"monitor,omitempty"`
+	Region   *history.Region `json:"region,omitempty"`
+	Format   capture.Format  `json:"format,omitempty"`
+	Width    int             `json:"width,omitempty"`
+	Height   int             `json:"height,omitempty"`
+	Attempts int             `json:"attempts,omitempty"`
+	URL      string          `json:"url,omitempty"`
+	Queued   bool            `json:"queued,omitempty"`
+	A11y     string          `json:"a11y,omitempty"`
+	Elements string          `json:"elements,omitempty"`
+	Overlay  string          `json:"overlay,omitempty"`
+
+	// DerivedFrom is the capture a --crop or --thumbnail output was made
+	// from
+	DerivedFrom string `json:"derived_from,omitempty"`
+
+	// Clipboard is set when --clipboard copied the capture
+	Clipboard bool `json:"clipboard,omitempty"`
+
+	// Analysis is the --analyze color summary
+	Analysis *analyze.Result `json:"analysis,omitempty"`
+
+	// Fit is the quality and scale chosen to meet --max-size
+	Fit *capture.Fit `json:"fit,omitempty"`
+
+	// Fallback is set when the capture was saved as PNG because the
+	// encoder for the format asked for failed
+	Fallback *capture.Fallback `json:"fallback,omitempty"`
+
+	// Focus and Pointer are the focused window and the pointer position
+	// at capture time
+	Focus   *history.Focus `json:"focus,omitempty"`
+	Pointer *history.Point `json:"pointer,omitempty"`
+
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+
+	// img is the saved image, for the history thumbnail
+	img image.Image
+}
+
+// newResultItem builds a successful item for an image written to path
+func newResultItem(path string, img image.Image, enc capture.EncodeOptions) resultItem {
+	item := resultItem{Path: path, Format: enc.Format, Status: statusOK}
+	if img != nil {
+		item.img = img
+		item.Width = img.Bounds().Dx()
+		item.Height = img.Bounds().Dy()
+		if analyzeCaptures {
+			a := analyze.Image(img)
+			item.Analysis = &a
+		}
+	}
+	return item
+}
+
+// warnFallback reports a capture saved as PNG because its encoder failed.
+// It is a warning, so even quiet and --json runs don't hide it.
+func warnFallback(path string, fb *capture.Fallback) {
+	fmt.Fprintf(os.Stderr, "Warning: %s encoding failed (%s); saved as PNG instead: %s\n", fb.Format, fb.Error, path)
+}
+
+// infoAnalysis prints an item's --analyze summary as a status message
+func infoAnalysis(item resultItem) {
+	if item.Analysis != nil {
+		infof("Analysis: %s", item.Analysis)
+	}
+}
+
+// capturedRegion is the screen area of a region or window capture, nil
+// for whole monitors and screens
+func capturedRegion(opts strategy.CaptureOptions) *history.Region {
+	if opts.Region == nil {
+		return nil
+	}
+	r := opts.Region
+	return &history.Region{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+}
+
+// failedItem builds an item for an output that could not be produced
+func failedItem(path string, err error) resultItem {
+	return resultItem{Path: path, Status: statusFailed, Error: err.Error()}
+}
+
+// singleResult builds the --json result for a single capture
+func singleResult(path string, img image.Image, enc capture.EncodeOptions, attempts int) captureResult {
+	item := newResultItem(path, img, enc)
+	item.Attempts = attempts
+	return captureResult{OK: true, Items: []resultItem{item}}
+}
+
+// printResult writes the result as JSON on stdout
+func printResult(res captureResult) error {
+	if res.Dir == "" {
+		res.Dir = outputDirectory
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(res); err != nil {
+		return fmt.Errorf("failed to write JSON result: %w", err)
+	}
+	return nil
+}
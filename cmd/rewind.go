@@ -0,0 +1,381 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/ipc"
+	"github.com/robotin/screenshot/internal/paths"
+	"github.com/robotin/screenshot/internal/session"
+	"github.com/robotin/screenshot/internal/strategy"
+	"github.com/robotin/screenshot/internal/xwin"
+	"github.com/spf13/cobra"
+)
+
+// rewindFrame is a frame kept in memory by --rewind, encoded as PNG so the
+// buffer takes a fraction of the raw pixels' memory
+type rewindFrame struct {
+	png []byte
+	at  time.Time
+
+	// layout counts monitor layout changes, so a clip records the layout
+	// once and then only when it changes
+	layout   int
+	monitors []strategy.Monitor
+	focus    *xwin.Window
+}
+
+// clipRequest asks the --rewind loop to save its buffer. reply, if set,
+// receives the result.
+type clipRequest struct {
+	reply chan<- clipResult
+}
+
+// clipResult is the saved clip's path, or why it couldn't be saved
+type clipResult struct {
+	path string
+	err  error
+}
+
+var clipCmd = &cobra.Command{
+	Use:   "clip",
+	Short: "Save the last seconds buffered by a running --rewind",
+	Long: `Ask the screenshot --rewind running for this user to save the frames it
+holds in memory as a session bundle, and print the bundle's path.
+
+Examples:
+  screenshot --rewind 30s --output-dir ~/clips &
+  screenshot clip                 # Save the last 30 seconds
+  screenshot replay ~/clips/clip_2024-05-01_10-12-03.rsb --video | ffmpeg -i - bug.mp4`,
+	Args: cobra.NoArgs,
+	RunE: runClip,
+}
+
+func init() {
+	rootCmd.AddCommand(clipCmd)
+}
+
+// clipSocketPath returns the socket --rewind listens for clip requests on
+func clipSocketPath() string {
+	return filepath.Join(paths.RuntimeDir(), "rewind.sock")
+}
+
+func runClip(cmd *cobra.Command, args []string) error {
+	c, err := net.DialTimeout("unix", clipSocketPath(), 2*time.Second)
+	if err != nil {
+		return fmt.Errorf("no screenshot --rewind is running: %w", err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(time.Minute))
+
+	if _, err := fmt.Fprintln(c, "save"); err != nil {
+		return fmt.Errorf("failed to request a clip: %w", err)
+	}
+	line, err := bufio.NewReader(c).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to request a clip: %w", err)
+	}
+	status, text, _ := strings.Cut(strings.TrimSpace(line), " ")
+	if status != "ok" {
+		return errors.New(text)
+	}
+	infof("Clip saved: %s", text)
+	return nil
+}
+
+// runRewind keeps the last --rewind of frames in memory and saves them as
+// a session bundle in the output directory on SIGUSR1, the --clip-key
+// hotkey or screenshot clip, until interrupted
+func runRewind(capturer *capture.Capturer, opts strategy.CaptureOptions) error {
+	if sessionFPS <= 0 {
+		return fmt.Errorf("--session-fps must be positive")
+	}
+	frameInterval := time.Duration(float64(time.Second) / sessionFPS)
+	if rewindLength < frameInterval {
+		return fmt.Errorf("--rewind must be at least one frame long (1/--session-fps)")
+	}
+
+	auditDestination = "rewind buffer, clips in " + outputDirectory
+	ind, err := newCaptureIndicator(opts.Display)
+	if err != nil {
+		return err
+	}
+	defer ind.Close()
+
+	// Focus tracking is best-effort, as in --session
+	var windows *xwin.Conn
+	if conn, err := xwin.Connect(opts.Display); err == nil {
+		windows = conn
+		defer windows.Close()
+	}
+	tracker := newMonitorTracker(capturer, opts.Display)
+	defer tracker.Close()
+
+	stop, stopNotify := notifyInterrupt()
+	defer stopNotify()
+	kill, err := startPanicSwitch(opts.Display)
+	if err != nil {
+		return err
+	}
+	defer kill.Close()
+
+	requests := make(chan clipRequest)
+	closeTriggers, err := startClipTriggers(opts.Display, requests)
+	if err != nil {
+		return err
+	}
+	defer closeTriggers()
+
+	var deadline <-chan time.Time
+	if duration > 0 {
+		deadline = time.After(duration)
+	}
+	ticker := time.NewTicker(frameInterval)
+	defer ticker.Stop()
+
+	if !quiet {
+		how := "screenshot clip"
+		if len(clipSignals) > 0 {
+			how += fmt.Sprintf(" or kill -USR1 %d", os.Getpid())
+		}
+		fmt.Fprintf(os.Stderr, "Keeping the last %s in memory; save it with %s (Ctrl-C to stop)\n", rewindLength, how)
+	}
+
+	var (
+		buf       []rewindFrame
+		layout    int
+		lastFocus *xwin.Window
+		saving    sync.WaitGroup
+	)
+	defer saving.Wait()
+	// Buffered frames go when the switch is pulled, not when the garbage
+	// collector gets to them
+	wipe := func() {
+		saving.Wait()
+		for _, f := range buf {
+			clear(f.png)
+		}
+	}
+
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	for {
+		layoutChanged := tracker.Refresh()
+		if layoutChanged {
+			layout++
+		}
+		if windows != nil {
+			if focus, err := windows.ActiveWindow(); err == nil {
+				lastFocus = focus
+			}
+		}
+
+		at := time.Now()
+		var img image.Image
+		err := ind.Update(tracker.Monitors(), layoutChanged)
+		if err == nil {
+			img, err = capturer.Capture(opts)
+		}
+		if kill.Pulled() {
+			wipeImage(img)
+			wipe()
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Capture failed: %v\n", err)
+		} else {
+			var data bytes.Buffer
+			if err := encoder.Encode(&data, img); err != nil {
+				return fmt.Errorf("failed to encode frame: %w", err)
+			}
+			buf = append(buf, rewindFrame{png: data.Bytes(), at: at, layout: layout, monitors: tracker.Monitors(), focus: lastFocus})
+		}
+
+		// Let go of frames that fell out of the window
+		old := 0
+		for old < len(buf) && at.Sub(buf[old].at) > rewindLength {
+			old++
+		}
+		clear(buf[:old])
+		buf = buf[old:]
+
+	wait:
+		for {
+			select {
+			case <-stop:
+				return nil
+			case <-kill.C:
+				wipe()
+				return nil
+			case <-deadline:
+				return nil
+			case req := <-requests:
+				// Save in the background so the buffer keeps filling;
+				// the frames are never modified, only dropped
+				clip := slices.Clone(buf)
+				saving.Add(1)
+				go func() {
+					defer saving.Done()
+					path, err := saveClip(clip)
+					if req.reply != nil {
+						req.reply <- clipResult{path, err}
+					} else if err != nil {
+						fmt.Fprintf(os.Stderr, "Clip failed: %v\n", err)
+					} else {
+						infof("Clip saved: %s", path)
+					}
+				}()
+			case <-ticker.C:
+				break wait
+			}
+		}
+	}
+}
+
+// saveClip writes buffered frames to a new session bundle in the output
+// directory
+func saveClip(frames []rewindFrame) (string, error) {
+	if len(frames) == 0 {
+		return "", fmt.Errorf("no frames captured yet")
+	}
+	name := "clip_" + time.Now().Format("2006-01-02_15-04-05") + ".rsb"
+	path := capture.UniquePath(filepath.Join(outputDirectory, name))
+
+	w, err := session.CreateAt(path, sessionFPS, frames[0].at)
+	if err != nil {
+		return "", err
+	}
+	layout := -1
+	var focus *xwin.Window
+	for _, f := range frames {
+		if f.layout != layout {
+			w.EventAt(session.EventMonitors, f.monitors, f.at)
+			layout = f.layout
+		}
+		if f.focus != nil && focusChanged(focus, f.focus) {
+			w.EventAt(session.EventFocus, f.focus, f.at)
+			focus = f.focus
+		}
+		if err := w.FramePNG(f.png, f.at); err != nil {
+			w.Close()
+			return "", err
+		}
+	}
+	return path, w.Close()
+}
+
+// startClipTriggers sends clip requests on SIGUSR1, the --clip-key hotkey
+// and screenshot clip connections, until the returned function is called
+func startClipTriggers(display string, requests chan<- clipRequest) (func(), error) {
+	var keys *xwin.KeyWatcher
+	if clipKey != "" {
+		key, err := xwin.ParseKey(clipKey)
+		if err == nil {
+			keys, err = xwin.WatchKey(display, key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot use --clip-key: %w", err)
+		}
+	}
+
+	path := clipSocketPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create runtime directory: %w", err)
+	}
+	l, err := ipc.Listen(path)
+	if err != nil {
+		if keys != nil {
+			keys.Close()
+		}
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	send := func(req clipRequest) bool {
+		select {
+		case requests <- req:
+			return true
+		case <-done:
+			return false
+		}
+	}
+
+	sig := make(chan os.Signal, 1)
+	if len(clipSignals) > 0 {
+		signal.Notify(sig, clipSignals...)
+	}
+	var keyC <-chan struct{}
+	if keys != nil {
+		keyC = keys.C
+	}
+	go func() {
+		for {
+			select {
+			case <-sig:
+			case _, ok := <-keyC:
+				if !ok {
+					keyC = nil
+					continue
+				}
+			case <-done:
+				return
+			}
+			if !send(clipRequest{}) {
+				return
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				c.SetDeadline(time.Now().Add(time.Minute))
+				if _, err := bufio.NewReader(c).ReadString('\n'); err != nil {
+					return
+				}
+				reply := make(chan clipResult, 1)
+				if !send(clipRequest{reply: reply}) {
+					fmt.Fprintln(c, "error --rewind is stopping")
+					return
+				}
+				select {
+				case res := <-reply:
+					if res.err != nil {
+						fmt.Fprintf(c, "error %v\n", res.err)
+					} else {
+						fmt.Fprintf(c, "ok %s\n", res.path)
+					}
+				case <-done:
+					fmt.Fprintln(c, "error --rewind is stopping")
+				}
+			}()
+		}
+	}()
+
+	return func() {
+		close(done)
+		signal.Stop(sig)
+		if keys != nil {
+			keys.Close()
+		}
+		l.Close()
+		os.Remove(path)
+	}, nil
+}
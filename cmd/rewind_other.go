@@ -0,0 +1,9 @@
+//go:build !unix
+
+package cmd
+
+import "os"
+
+// clipSignals save a --rewind clip; Windows has no user signals, so there
+// only the hotkey and screenshot clip do
+var clipSignals []os.Signal
@@ -0,0 +1,11 @@
+//go:build unix
+
+package cmd
+
+import (
+	"os"
+	"syscall"
+)
+
+// clipSignals save a --rewind clip
+var clipSignals = []os.Signal{syscall.SIGUSR1}
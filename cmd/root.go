@@ -1,30 +1,116 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"image"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/robotin/screenshot/internal/a11y"
+	"github.com/robotin/screenshot/internal/annotate"
 	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/config"
+	"github.com/robotin/screenshot/internal/document"
+	"github.com/robotin/screenshot/internal/gpu"
+	"github.com/robotin/screenshot/internal/idle"
+	"github.com/robotin/screenshot/internal/priority"
+	"github.com/robotin/screenshot/internal/service"
 	"github.com/robotin/screenshot/internal/strategy"
+	"github.com/robotin/screenshot/internal/tiles"
+	"github.com/robotin/screenshot/internal/upload"
+	"github.com/robotin/screenshot/internal/xwin"
 	"github.com/spf13/cobra"
 )
 
 var (
 	// Flags
-	monitor       int
-	region        string
-	output        string
-	display       string
-	listMon       bool
-	compressLevel int
-	raw           bool
-	view          bool
-	stdout        bool
+	monitor         string
+	region          string
+	output          string
+	display         string
+	listMon         bool
+	compressLevel   int
+	raw             bool
+	view            bool
+	stdout          bool
+	format          string
+	zeroCopy        bool
+	sessionPath     string
+	sessionFPS      float64
+	sessionSegment  time.Duration
+	rewindLength    time.Duration
+	clipKey         string
+	duration        time.Duration
+	interval        time.Duration
+	scheduleName    string
+	cronSpec        string
+	jitter          time.Duration
+	count           int
+	organize        string
+	latestLink      string
+	perMonitor      bool
+	allOrNothing    bool
+	jsonOutput      bool
+	retries         int
+	retryDelay      time.Duration
+	debug           bool
+	uploadTarget    string
+	webhookURL      string
+	webhookSecret   string
+	tags            []string
+	noHistory       bool
+	menu            bool
+	menuTimeout     time.Duration
+	configPath      string
+	singleInstance  string
+	lowPriority     bool
+	backendPriority []string
+	backendName     string
+	recordFrames    string
+	swapRB          string
+	window          string
+	background      string
+	documentMode    string
+	boxes           []string
+	arrows          []string
+	labels          []string
+	texts           []string
+	stamps          []string
+	textFont        string
+	normalizeDPI    string
+	outputDir       string
+	quality         int
+	progressive     bool
+	interlace       bool
+	stableOutput    bool
+	pngColor        string
+	pngMeta         bool
+	flushRows       int
+	force           bool
+	quiet           bool
+	showStats       bool
+	verify          bool
+	flash           bool
+	sound           bool
+	showOSD         bool
+	a11yDump        bool
+	locateMode      string
+	settle          time.Duration
+	settleTimeout   time.Duration
+	averageFrames   int
+	maxOfFrames     int
+	afterIdle       time.Duration
+	anonymizeShare  bool
+	blurFaces       bool
+	showIndicator   bool
 )
 
 var rootCmd = &cobra.Command{
@@ -41,91 +127,711 @@ Compression levels:
   -cc           Medium compression
   -ccc          Best compression (slowest, smallest)
 
+Formats (--format):
+  png           PNG image (default)
+  jpeg          JPEG image, see --quality
+  heif          HEIF (.heic) image, in builds with the heif tag
+  qoi           Lossless QOI image, faster to encode than PNG
+  svg           SVG with annotations as editable elements
+  yuv420        Planar YUV 4:2:0 in a y4m container (for video encoders)
+  nv12          Headerless NV12 planes
+  auto          PNG for UI and text, JPEG for photographic content
+
+With --zero-copy, builds with the gpu tag grab the screen as a DMA-BUF
+(X11 DRI3) and convert it to yuv420 or nv12 on the GPU, so only the YUV
+planes are copied to memory. Where that isn't possible the usual SHM grab
+is used; --debug tells which path was taken.
+
 Examples:
   screenshot                      # Capture all monitors, fast compression
   screenshot captura.png          # Capture to specific file
+  screenshot --output-dir ~/shots # Save in a fixed directory (for cron/hotkeys)
   screenshot -r                   # No compression (raw, fastest)
   screenshot -ccc                 # Best compression (smallest)
   screenshot -v                   # Capture and open in viewer
   screenshot --stdout | feh -     # Pipe to image viewer
+  screenshot --stats -ccc shot.png   # Time each capture phase
+  screenshot --format yuv420 --stdout | ffmpeg -i - out.mp4   # Feed an encoder
+  screenshot --format nv12 --zero-copy --debug -o frame.nv12  # Stay on the GPU
+  screenshot --interval 2s --format qoi   # Lossless and fast enough for frequent captures
+  screenshot run callouts.yaml    # Capture to *.svg: annotate steps stay editable
+  screenshot --stdout --flush-every-n-rows 64 | ssh host 'cat > s.png'   # Stream over a slow link
   screenshot -m 0                 # Capture only monitor 0
   screenshot -m 1                 # Capture only monitor 1
+  screenshot -m HDMI-1            # Capture a monitor by output name
+  screenshot -m left-half         # Capture a virtual monitor from the config
   screenshot --region 100,100,500,400   # Capture region (x,y,width,height)
+  screenshot --window active      # Capture the focused window, keeping its alpha
+  screenshot --window kitty --background checker   # Translucent terminal for docs
+  screenshot --window app --box 20,80,400,300 --arrow 600,40,420,90 --label 1@600,30   # Callouts for docs
+  screenshot --text "Click here@40,300,32,blue" --font "DejaVu Sans"   # Text in a system font
+  screenshot --stamp check@120,80 --stamp "bubble:Crashes here@300,200"   # Quick feedback for a support chat
+  screenshot --window active --a11y-dump   # Also save the widget tree (shot.a11y.json)
+  screenshot --window firefox --locate=both   # Button/field boxes as JSON and an overlay
   screenshot -d :0                # Force DISPLAY (for cron)
-  screenshot --list               # List available monitors`,
+  screenshot --list               # List available monitors
+  screenshot shot.jpg --progressive   # Progressive JPEG
+  screenshot --stable-output -o golden.png   # Byte-identical for identical pixels (for git)
+  screenshot --single-instance    # From cron: skip if the last run is still going
+  screenshot --settle 500ms -m 0  # Wait for animations to finish before capturing
+  screenshot --interval 5m --after-idle 30s   # Never capture while someone is typing
+  screenshot --interval 1m --low-priority   # Background monitoring without stutter
+  screenshot layout               # Draw the monitor arrangement
+  screenshot integrate gnome      # Make Print run this tool (--uninstall reverts)
+  screenshot service install -- serve --listen :8080   # Run the server as a service
+  screenshot --backend synthetic  # Test pattern, no display needed
+  screenshot doctor               # Check why captures fail or come out black
+  screenshot selftest             # Check a test pattern's colors survive capture and encoding
+  screenshot --record-frames bug/ # Record raw frames for a bug report
+  screenshot --backend replay:bug/   # Replay someone else's frames
+  screenshot --swap-rb            # Fix captures with red and blue swapped
+  screenshot --anonymize          # Safe to post on a forum: no clock, icons or faces
+  screenshot --blur-faces -m 0    # Share a video call without showing who is on it
+  screenshot --document=bilevel -m 0   # Black and white, for OCR or printing
+  screenshot --normalize-dpi auto # Stitch a HiDPI laptop and a normal monitor
+  screenshot --per-monitor --all-or-nothing --json   # One file per monitor, all or none
+  screenshot --interval 30s shots/cap.png    # Capture every 30s into shots/
+  screenshot --interval 5m --organize date   # File captures into YYYY/MM/DD/
+  screenshot --interval 1m --latest-link /srv/www/latest.png   # Serve "the current screen"
+  screenshot --interval 5m --indicator       # Tell people their screen is being captured
+  screenshot --interval 1m --panic-key ctrl+alt+shift+p   # Stop and wipe at once from any window
+  screenshot --schedule office               # Capture on a schedule from the config
+  screenshot --cron "*/10 9-18 * * 1-5"      # Cron timing without system cron
+  screenshot --interval 5m --jitter 1m --upload s3://fleet   # Spread a fleet's uploads
+  screenshot --session s.rsb --duration 5m   # Record a replayable session
+  screenshot recover s.rsb                   # Salvage a session cut short by a crash
+  screenshot --session s.rsb --segment 10m   # Numbered 10-minute bundles + s.index.json
+  screenshot --rewind 30s --output-dir clips # Keep the last 30s; save it with screenshot clip
+  screenshot report --since 7d               # Time on screen per application this week
+  screenshot config show --effective         # Every setting in effect and where it comes from
+  SCREENSHOT_FORMAT=jpeg screenshot          # Capture flags from $SCREENSHOT_<FLAG>
+  screenshot init                            # Set up a starter config
+  screenshot --upload imgur       # Capture and upload, printing the URL
+  screenshot --upload s3://fleet --spool   # Keep failed uploads and retry them later
+  screenshot --interval 10s --upload s3://fleet/kiosk-7 --tiles   # Send only what changed
+  screenshot gs://bucket/shot.png # Capture straight to object storage
+  screenshot --webhook https://indexer/hook --tag kiosk   # Notify after capture
+  screenshot --menu               # Choose save/copy/annotate/upload/delete
+  screenshot --flash --sound -m 0 # Confirm hotkey captures with a flash and shutter
+  screenshot --osd --upload imgur # Show the link on screen, click to open it
+  screenshot --ci --xvfb -m 0     # Headless CI: private Xvfb, JSON, ./screenshots/monitor-0.png
+  screenshot --x11-socket /var/lib/kiosk/x11/X5   # X server of a container
+  screenshot -d kiosk.lan:0       # Remote X display over TCP (cookie from ~/.Xauthority)
+  screenshot -o d.png --crop chart=0,80,960,540 --thumbnail 320x200   # Crop and thumbnail, one grab
+  screenshot --clipboard --upload imgur   # Save, copy and upload the same frame
+  screenshot --average 5 -m 0     # Average 5 frames: no dithering bands on OLED panels
+  screenshot --max-of 5 --region 0,0,400,40   # Catch a blinking alert in any of 5 frames
+  screenshot --events jsonl -q    # Print lifecycle events as JSON lines on stderr
+  screenshot --overlay-fallback portal  # Fill in black video through the desktop portal
+  screenshot --json --analyze     # Report dominant colors and whether the screen is blank
+  screenshot --png-color gray     # 8-bit grayscale PNG, no alpha
+  screenshot --format auto        # PNG for UI and text, JPEG for photos and video
+  screenshot --max-size 500KB bug.jpg   # Fit a ticket's attachment limit`,
 	Args: cobra.MaximumNArgs(1),
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := applyEnv(cmd); err != nil {
+			return err
+		}
+		if backendName != "" && cmd.Flags().Changed("backend-priority") {
+			return fmt.Errorf("--backend and --backend-priority can't be combined")
+		}
+		// The policy binds every command, not just captures
+		if _, err := loadPolicy(); err != nil {
+			return err
+		}
+		if lowPriority {
+			if err := priority.Lower(); err != nil {
+				// Captures still work at normal priority
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		}
+		if err := setupX11Socket(cmd); err != nil {
+			return err
+		}
+		setupRemoteDisplay()
+		if err := setupCI(cmd); err != nil {
+			return err
+		}
+		return setupEvents()
+	},
 	RunE: run,
 }
 
 func init() {
-	rootCmd.Flags().IntVarP(&monitor, "monitor", "m", -1, "Monitor index to capture (-1 = all, default)")
+	rootCmd.Flags().StringVarP(&monitor, "monitor", "m", "", "Monitor to capture: index, output name (HDMI-1) or virtual monitor from the config (default: all)")
 	rootCmd.Flags().StringVar(&region, "region", "", "Region to capture: x,y,width,height")
-	rootCmd.Flags().StringVarP(&output, "output", "o", "", "Output filename (default: screenshot_TIMESTAMP.png)")
+	rootCmd.Flags().StringArrayVar(&crops, "crop", nil, "Also save [NAME=]x,y,width,height of the capture as FILE_NAME.EXT (FILE_crop1.EXT, ... without a name), from the same grab (repeatable)")
+	rootCmd.Flags().StringVar(&thumbnailSize, "thumbnail", "", "Also save the capture scaled to fit WxH as FILE_thumb.EXT")
+	rootCmd.Flags().BoolVar(&copyClipboard, "clipboard", false, "Also copy the capture to the clipboard (PNG, via xclip or wl-copy)")
+	rootCmd.Flags().StringVar(&window, "window", "", "Window to capture: active, an X window ID, or a title/class pattern")
+	rootCmd.Flags().BoolVar(&a11yDump, "a11y-dump", false, "With --window, also save the window's AT-SPI accessibility tree as JSON next to the image (NAME.a11y.json)")
+	rootCmd.Flags().StringVar(&locateMode, "locate", "", "Save the visible UI elements' bounding boxes: json (default when given without a value, NAME.elements.json), overlay (NAME.elements.png) or both")
+	rootCmd.Flags().Lookup("locate").NoOptDefVal = locateJSON
+	rootCmd.Flags().StringVar(&documentMode, "document", "", "Convert for OCR/printing: gray (default when given without a value) or bilevel (black and white)")
+	rootCmd.Flags().Lookup("document").NoOptDefVal = string(document.Gray)
+	rootCmd.Flags().StringVar(&background, "background", "none", "Background for translucent windows: none (keep alpha), checker, or a color (white, #rrggbb)")
+	rootCmd.Flags().StringArrayVar(&boxes, "box", nil, "Outline a box x,y,width,height[:color] on the capture (repeatable)")
+	rootCmd.Flags().StringArrayVar(&arrows, "arrow", nil, "Draw an arrow x1,y1,x2,y2[:color] pointing at x2,y2 (repeatable)")
+	rootCmd.Flags().StringArrayVar(&labels, "label", nil, "Draw a numbered callout text@x,y[:color] centered on x,y (repeatable)")
+	rootCmd.Flags().StringArrayVar(&texts, "text", nil, "Draw text@x,y[,size[,color]] with its top-left corner at x,y (repeatable)")
+	rootCmd.Flags().StringArrayVar(&stamps, "stamp", nil, "Draw a stamp name@x,y[,size[,color]] centered on x,y: check, cross, arrow-up/down/left/right, star, heart, smile, frown, warning, or bubble:TEXT (repeatable)")
+	rootCmd.Flags().StringVar(&textFont, "font", "", "Font for --text: a family found with fontconfig or a .ttf/.otf file (default: sans-serif, else built in)")
+	rootCmd.Flags().StringVarP(&output, "output", "o", "", "Output filename (default: screenshot_TIMESTAMP.png in ~/Pictures/Screenshots)")
+	rootCmd.Flags().StringVar(&outputDir, "output-dir", "", "Directory for relative output paths and generated names (default: relative to the working directory; generated names go in output_dir from the config or $XDG_PICTURES_DIR/Screenshots)")
 	rootCmd.Flags().StringVarP(&display, "display", "d", "", "X11 display (default: $DISPLAY or :0)")
 	rootCmd.Flags().BoolVarP(&listMon, "list", "l", false, "List available monitors")
 	rootCmd.Flags().CountVarP(&compressLevel, "compress", "c", "Compression level: -c fast, -cc medium, -ccc best")
 	rootCmd.Flags().BoolVarP(&raw, "raw", "r", false, "No compression (fastest, largest files)")
 	rootCmd.Flags().BoolVarP(&view, "view", "v", false, "Open screenshot in default viewer after capture")
-	rootCmd.Flags().BoolVar(&stdout, "stdout", false, "Output PNG to stdout (for piping)")
+	rootCmd.Flags().BoolVar(&flash, "flash", false, "Briefly flash the captured area white to confirm the capture")
+	rootCmd.Flags().BoolVar(&sound, "sound", false, "Play a camera shutter sound (PulseAudio) to confirm the capture")
+	rootCmd.Flags().BoolVar(&showOSD, "osd", false, "Briefly show where the capture was saved or uploaded on screen; click it to open")
+	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "Print debug information on stderr")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "Config file (default: $SCREENSHOT_CONFIG or ~/.config/robotin-screenshot/config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&backendName, "backend", "", "Use only this capture backend (e.g. x11, synthetic for a test pattern, replay:DIR for recorded frames, adb[:SERIAL] for an Android device)")
+	rootCmd.PersistentFlags().StringVar(&normalizeDPI, "normalize-dpi", "", "Scale monitors to a common DPI when capturing all of them: auto (lowest) or a DPI (overrides dpi.normalize in the config)")
+	rootCmd.PersistentFlags().StringVar(&swapRB, "swap-rb", string(capture.SwapAuto), "Swap red and blue: auto (when the display is BGR), on (default when given without a value) or off")
+	rootCmd.PersistentFlags().Lookup("swap-rb").NoOptDefVal = string(capture.SwapOn)
+	rootCmd.PersistentFlags().StringVar(&overlayFallback, "overlay-fallback", "", "Fill in video that came out black in X11 captures (hardware overlay planes) from another source: portal (the desktop portal, through the compositor)")
+	rootCmd.PersistentFlags().StringVar(&recordFrames, "record-frames", "", "Record the raw frames the backend returns into this directory (replay with --backend replay:DIR)")
+	rootCmd.PersistentFlags().StringSliceVar(&backendPriority, "backend-priority", nil, "Capture backends to try first, in order (overrides backend_priority in the config)")
+	rootCmd.PersistentFlags().BoolVar(&lowPriority, "low-priority", false, "Run with the lowest CPU and IO priority and a single encoder thread")
+	rootCmd.PersistentFlags().BoolVar(&noHistory, "no-history", false, "Don't record captures in the history")
+	rootCmd.PersistentFlags().StringVar(&panicKey, "panic-key", "", "Global hotkey that stops --interval, --session, --rewind, monitor and serve at once, wiping the frames in memory, e.g. ctrl+alt+shift+p (overrides panic_key in the config; SIGHUP does the same)")
+	rootCmd.PersistentFlags().BoolVar(&ciMode, "ci", false, "Behave for CI pipelines: JSON output, no history, names without timestamps in ./screenshots, ::error:: annotations on failure")
+	rootCmd.PersistentFlags().StringVar(&xvfbSize, "xvfb", "", "Start a private Xvfb of this size (default 1920x1080 when given without a value) when no display is set")
+	rootCmd.PersistentFlags().Lookup("xvfb").NoOptDefVal = "1920x1080"
+	rootCmd.PersistentFlags().StringVar(&x11Socket, "x11-socket", "", "Connect to the X server on this unix socket, e.g. one in a container (/path/to/.X11-unix/X5) or an abstract socket (@/tmp/.X11-unix/X5)")
+	rootCmd.PersistentFlags().StringVar(&eventsFormat, "events", "", "Print capture lifecycle events (capture started/succeeded/failed, file written, upload finished) on stderr as they happen: jsonl")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Don't print status messages such as \"Screenshot saved:\"; warnings and errors still go to stderr")
+	rootCmd.PersistentFlags().BoolVar(&force, "force", false, "Write image data to stdout even when it is a terminal")
+	rootCmd.Flags().BoolVar(&stdout, "stdout", false, "Output image to stdout (for piping)")
+	rootCmd.Flags().DurationVar(&interval, "interval", 0, "Capture repeatedly at this interval (e.g. 30s, 5m)")
+	rootCmd.Flags().StringVar(&scheduleName, "schedule", "", "Capture on a schedule from the config (every 5m, Mon-Fri 09:00-18:00) instead of a plain --interval")
+	rootCmd.Flags().StringVar(&cronSpec, "cron", "", "Capture when a cron expression matches (e.g. \"*/10 9-18 * * 1-5\") instead of a plain --interval")
+	rootCmd.Flags().DurationVar(&jitter, "jitter", 0, "Delay each --interval, --schedule or --cron capture by a random time up to this long (e.g. 30s), so a fleet doesn't capture and upload at the same second")
+	rootCmd.Flags().BoolVar(&failureImages, "failure-image", false, "In --interval, --schedule and --cron mode, save an image with the error and time when a capture fails, instead of nothing")
+	rootCmd.Flags().IntVar(&count, "count", 0, "Stop after this many interval captures (default: unlimited)")
+	rootCmd.Flags().StringVar(&organize, "organize", "", "File captures into subdirectories: date, month, host/date, or a template like {host}/{year}")
+	rootCmd.Flags().StringVar(&latestLink, "latest-link", "", "Keep a symlink (or copy) at this path pointing to the most recent capture")
+	rootCmd.Flags().BoolVar(&perMonitor, "per-monitor", false, "Capture each monitor into its own file (name_m0.png, name_m1.png, ...)")
+	rootCmd.Flags().BoolVar(&allOrNothing, "all-or-nothing", false, "With --per-monitor, stop at the first monitor that fails and keep no files unless every monitor succeeded")
+	rootCmd.Flags().BoolVar(&showStats, "stats", false, "Report how long each capture phase took, the output size and peak memory (on stderr, or in --json)")
+	rootCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print a JSON result (paths, dimensions, per-item status) on stdout; with --interval, a line per capture and per monitor layout change")
+	rootCmd.Flags().BoolVar(&analyzeCaptures, "analyze", false, "Add dominant colors, average luminance and a blank-screen score to the result (--json, webhook events, status messages)")
+	rootCmd.Flags().IntVar(&retries, "retries", 0, "Retry a failed capture up to N times (for transient X errors)")
+	rootCmd.Flags().DurationVar(&retryDelay, "retry-delay", 500*time.Millisecond, "Delay before the first retry; doubles after each attempt")
+	rootCmd.Flags().DurationVar(&settle, "settle", 0, "Wait until the captured area has stopped changing for this long (e.g. 500ms)")
+	rootCmd.Flags().DurationVar(&settleTimeout, "settle-timeout", 10*time.Second, "Capture anyway if the area is still changing after this long")
+	rootCmd.Flags().IntVar(&averageFrames, "average", 0, "Average this many frames grabbed a refresh apart (2-64), against temporal dithering and flicker")
+	rootCmd.Flags().IntVar(&maxOfFrames, "max-of", 0, "Keep the brightest value of each channel across this many frames grabbed a refresh apart (2-64), to catch blinking cursors and alerts")
+	rootCmd.Flags().DurationVar(&afterIdle, "after-idle", 0, "Wait until there has been no keyboard or pointer input for this long before each capture (e.g. 30s)")
+	rootCmd.Flags().BoolVar(&anonymizeShare, "anonymize", false, "Make the capture safe to share publicly: black out panels (clock, battery, tray), blur the desktop around windows and mask faces (tune with anonymize in the config)")
+	rootCmd.Flags().BoolVar(&blurFaces, "blur-faces", false, "Blur faces (webcam previews, video calls) before saving; with --anonymize, blur them instead of masking")
+	rootCmd.Flags().StringVar(&sessionPath, "session", "", "Record frames and events into a replayable session bundle")
+	rootCmd.Flags().Float64Var(&sessionFPS, "session-fps", 2, "Frames per second when recording a session or a --rewind buffer")
+	rootCmd.Flags().DurationVar(&rewindLength, "rewind", 0, "Keep the last DURATION of frames (at --session-fps) in memory and save them as a session bundle in the output directory on screenshot clip, SIGUSR1 or --clip-key")
+	rootCmd.Flags().StringVar(&clipKey, "clip-key", "", "Global hotkey that saves a --rewind clip, e.g. ctrl+alt+c")
+	rootCmd.Flags().DurationVar(&sessionSegment, "segment", 0, "Split a --session recording into bundles this long (NAME-0001.rsb, ...), listed in NAME.index.json")
+	rootCmd.Flags().BoolVar(&showIndicator, "indicator", false, "Show a \"Screen capture active\" notice on screen while --interval or --session runs (see indicator in the config)")
+	rootCmd.Flags().DurationVar(&duration, "duration", 0, "Stop interval/session mode after this long (default: until interrupted)")
+	rootCmd.Flags().StringVar(&uploadTarget, "upload", "", "Upload the capture after saving (e.g. imgur, drive:Screenshots, s3://bucket/prefix; default: upload in the config)")
+	rootCmd.Flags().BoolVar(&tileUpload, "tiles", false, "With --interval and --upload to object storage, upload only the tiles of the screen that changed, plus a manifest (see screenshot tiles)")
+	rootCmd.Flags().IntVar(&tileSize, "tile-size", tiles.DefaultSize, "Tile edge in pixels for --tiles")
+	rootCmd.Flags().BoolVar(&spoolUploads, "spool", false, "Queue uploads that fail (network down) and send them in order before later uploads (see uploads in the config, screenshot spool)")
+	rootCmd.Flags().StringVar(&webhookURL, "webhook", "", "POST a JSON event to this URL after each capture or upload")
+	rootCmd.Flags().StringVar(&webhookSecret, "webhook-secret", "", "HMAC secret for signing webhook events (default: $SCREENSHOT_WEBHOOK_SECRET)")
+	rootCmd.Flags().StringArrayVar(&tags, "tag", nil, "Tag included in webhook events (repeatable)")
+	rootCmd.Flags().BoolVar(&menu, "menu", false, "Ask what to do with the capture: save, save as, copy, annotate, upload or delete")
+	rootCmd.Flags().DurationVar(&menuTimeout, "menu-timeout", 10*time.Second, "Save the capture if no --menu choice is made in time")
+	rootCmd.Flags().StringVar(&singleInstance, "single-instance", "", "Don't overlap with another capture on the same display: wait, skip (default when given without a value) or fail")
+	rootCmd.Flags().Lookup("single-instance").NoOptDefVal = instanceSkip
+	rootCmd.Flags().StringVarP(&format, "format", "f", "", "Output format: png, jpeg, heif, qoi, svg, yuv420, nv12, or auto to pick PNG or JPEG by content (default: from extension, else format in the config, else png)")
+	rootCmd.Flags().BoolVar(&zeroCopy, "zero-copy", false, "Grab as a DMA-BUF and convert on the GPU, falling back to SHM (gpu builds)")
+	rootCmd.Flags().StringVar(&maxSizeFlag, "max-size", "", "Keep files under this size (e.g. 500KB, 2MiB): lower the JPEG/HEIF quality, then scale down as needed")
+	rootCmd.Flags().IntVar(&quality, "quality", capture.DefaultJPEGQuality, "JPEG and HEIF quality (1-100)")
+	rootCmd.Flags().BoolVar(&progressive, "progressive", false, "Write a progressive JPEG (renders coarse-to-fine over slow links)")
+	rootCmd.Flags().BoolVar(&verify, "verify", false, "Read each saved PNG back from disk and check its pixels match the capture")
+	rootCmd.Flags().BoolVar(&interlace, "interlace", false, "Write an interlaced (Adam7) PNG (renders coarse-to-fine over slow links)")
+	rootCmd.Flags().StringVar(&pngColor, "png-color", "auto", "PNG color type: auto (RGB, or RGBA when there is transparency), rgb (always drop alpha) or gray (8-bit grayscale)")
+	rootCmd.Flags().BoolVar(&pngMeta, "png-metadata", true, "Tag PNGs as sRGB and with the monitor's DPI (sRGB, gAMA and pHYs chunks), for color-managed viewers and printing at the right size")
+	rootCmd.Flags().BoolVar(&stableOutput, "stable-output", false, "Write byte-identical PNGs for identical screen content (fixed encoder settings, no metadata), for golden screenshots in version control")
+	rootCmd.Flags().IntVar(&flushRows, "flush-every-n-rows", 0, "Stream PNG output, flushing every N rows so readers can start early")
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	// Report a reader closing stdout as EPIPE errors instead of dying
+	// from the signal, so it can be handled where the output is written
+	signal.Ignore(syscall.SIGPIPE)
+
+	// Started by the Windows service manager, the command runs under it
+	ran, err := service.Run(rootCmd.Execute)
+	if !ran {
+		err = rootCmd.Execute()
+	}
+	stopXvfb()
+	closeXDisplay()
+	if err != nil {
+		if ciMode {
+			ciError(err)
+		}
+		if errors.Is(err, capture.ErrProtectedWindow) {
+			os.Exit(exitProtectedWindow)
+		}
 		os.Exit(1)
 	}
 }
 
 func run(cmd *cobra.Command, args []string) error {
-	capturer := capture.New()
+	gpu.Debugf = debugf
+	stats := &runStats{started: time.Now()}
+	capturer, err := newCapturer()
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if !cmd.Flags().Changed("upload") {
+		uploadTarget = cfg.Upload
+	}
+	sched, err := captureTimetable()
+	if err != nil {
+		return err
+	}
+	if sched != nil {
+		// Scheduled capture is interval mode with its own timing; the
+		// interval is the shortest gap, for the policy check
+		interval = shortestGap(sched)
+	}
+	if jitter < 0 {
+		return fmt.Errorf("--jitter must not be negative")
+	}
+	if sessionSegment != 0 && sessionPath == "" {
+		return fmt.Errorf("--segment only applies to --session")
+	}
+	if rewindLength < 0 {
+		return fmt.Errorf("--rewind must not be negative")
+	}
+	if clipKey != "" && rewindLength == 0 {
+		return fmt.Errorf("--clip-key only applies to --rewind")
+	}
+	if rewindLength > 0 && (sessionPath != "" || interval > 0) {
+		return fmt.Errorf("--rewind cannot be combined with --session or --interval")
+	}
+	if jitter > 0 {
+		if interval <= 0 {
+			return fmt.Errorf("--jitter only applies to --interval, --schedule and --cron")
+		}
+		if jitter >= interval {
+			// Captures could swap places or bunch up
+			return fmt.Errorf("--jitter %s must be shorter than the time between captures (%s)", jitter, interval)
+		}
+	}
+	bg, err := capture.ParseBackground(background)
+	if err != nil {
+		return err
+	}
+	capturer.SetBackground(bg)
+	docMode, err := document.ParseMode(documentMode)
+	if err != nil {
+		return err
+	}
+	capturer.SetDocument(docMode)
+	if flash || sound {
+		capturer.SetFeedback(captureFeedback(flash, sound))
+	}
+	capturer.SetRetryPolicy(capture.RetryPolicy{
+		Retries: retries,
+		Delay:   retryDelay,
+		OnRetry: func(attempt int, err error) {
+			debugf("capture attempt %d failed: %v (retrying)", attempt, err)
+		},
+	})
+	exposure, err := exposurePolicy()
+	if err != nil {
+		return err
+	}
+	capturer.SetExposurePolicy(exposure)
+	capturer.SetSettlePolicy(capture.SettlePolicy{
+		Quiet:   settle,
+		Timeout: settleTimeout,
+		OnTimeout: func(waited time.Duration) {
+			fmt.Fprintf(os.Stderr, "Warning: capture area still changing after %s, capturing anyway\n", waited.Round(time.Millisecond))
+		},
+	})
+	if afterIdle > 0 {
+		if sessionPath != "" {
+			return fmt.Errorf("--after-idle cannot be combined with --session")
+		}
+		capturer.SetIdlePolicy(capture.IdlePolicy{
+			After: afterIdle,
+			Time:  func() (time.Duration, error) { return idle.Time(display) },
+			OnWait: func(idleFor time.Duration) {
+				fmt.Fprintf(os.Stderr, "Waiting until there has been no input for %s (idle for %s)\n", afterIdle, idleFor.Round(time.Second))
+			},
+		})
+	}
+	stats.init = time.Since(stats.started)
 
 	// List monitors mode
 	if listMon {
 		return listMonitors(capturer)
 	}
 
+	// Single-instance mode - hold a per-display lock for the whole run
+	if singleInstance != "" {
+		l, err := instanceLock()
+		if errors.Is(err, errSkipped) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer l.Release()
+	}
+
 	// Determine output path
 	outputPath := output
 	if len(args) > 0 {
 		outputPath = args[0]
 	}
-	if outputPath == "" {
-		outputPath = capture.GenerateFilename("screenshot")
+
+	// "-" is stdout, as for most Unix tools
+	if outputPath == "-" {
+		stdout, outputPath = true, ""
+	}
+	if showStats && (interval > 0 || sessionPath != "" || perMonitor || menu) {
+		return fmt.Errorf("--stats only applies to single captures, not --interval, --session, --per-monitor or --menu")
+	}
+	if showOSD && (stdout || interval > 0 || sessionPath != "" || perMonitor || menu) {
+		return fmt.Errorf("--osd only applies to single captures, not --stdout, --interval, --session, --per-monitor or --menu")
+	}
+	derived, err := derivedOutputs()
+	if err != nil {
+		return err
+	}
+	if len(derived) > 0 && (stdout || interval > 0 || sessionPath != "" || perMonitor || menu) {
+		return fmt.Errorf("--crop and --thumbnail only apply to single captures, not --stdout, --interval, --session, --per-monitor or --menu")
+	}
+	if copyClipboard && (interval > 0 || sessionPath != "" || perMonitor || menu) {
+		return fmt.Errorf("--clipboard only applies to single captures, not --interval, --session, --per-monitor or --menu (which has its own Copy action)")
+	}
+	if stdout && ciMode && !cmd.Flags().Changed("json") {
+		// Only the image goes to stdout, not the result --ci implies
+		jsonOutput = false
+	}
+	if stdout {
+		// Only the image goes to stdout; messages would corrupt it
+		if jsonOutput || interval > 0 || sessionPath != "" || perMonitor || menu {
+			return fmt.Errorf("--stdout cannot be combined with --json, --interval, --session, --per-monitor or --menu")
+		}
+		if err := checkBinaryStdout("image data", "screenshot - | feh -, screenshot --stdout > shot.png"); err != nil {
+			return err
+		}
+	}
+
+	// Determine output format
+	enc, err := getEncodeOptions(outputPath)
+	if err != nil {
+		return err
+	}
+	if maxSize > 0 && len(derived) > 0 {
+		return fmt.Errorf("--max-size cannot be combined with --crop or --thumbnail")
+	}
+
+	// Callouts are drawn on the capture, or kept editable in SVG
+	callouts, err := annotationFlags()
+	if err != nil {
+		return err
+	}
+	if enc.Format == capture.FormatSVG {
+		enc.Annotations = callouts
+	} else {
+		capturer.SetAnnotations(callouts)
+	}
+
+	// Resolve the output directory; piped captures have none
+	if !stdout {
+		if outputPath, outputDirectory, err = resolveOutputPath(outputPath); err != nil {
+			return err
+		}
 	}
 
 	// Build capture options
-	opts := strategy.CaptureOptions{
-		Monitor: monitor,
-		Display: display,
+	opts, err := buildCaptureOptions(capturer)
+	if err != nil {
+		return err
+	}
+	if pngMeta {
+		enc.DPI = capturer.DPI(opts)
 	}
 
+	if err := validateLocate(locateMode); err != nil {
+		return err
+	}
+	if a11yDump && opts.WindowID == 0 {
+		return fmt.Errorf("--a11y-dump needs --window")
+	}
+	if (a11yDump || locateMode != "") && (stdout || interval > 0 || sessionPath != "" || perMonitor || menu) {
+		return fmt.Errorf("--a11y-dump and --locate cannot be combined with --stdout, --interval, --session, --per-monitor or --menu")
+	}
+	if anonymizeShare && (a11yDump || locateMode != "") {
+		// The sidecars hold window titles and text the image no longer shows
+		return fmt.Errorf("--anonymize cannot be combined with --a11y-dump or --locate")
+	}
 
-	// Parse region if specified
-	if region != "" {
-		rect, err := parseRegion(region)
-		if err != nil {
-			return fmt.Errorf("invalid region: %w", err)
+	// Set up upload and webhook delivery
+	deliv, err := newDelivery()
+	if err != nil {
+		return err
+	}
+
+	// Refuse up front what the policy's rate limit would fail on every
+	// other capture
+	if limit := capturer.MinInterval(); limit > 0 {
+		if sched != nil && interval < limit {
+			return fmt.Errorf("%s captures as often as every %s, more frequent than the policy (%s) allows: one capture every %s", sched, interval, config.PolicyPath, limit)
 		}
-		opts.Region = rect
+		if sched == nil && interval > 0 && interval < limit {
+			return fmt.Errorf("--interval %s is more frequent than the policy (%s) allows: one capture every %s", interval, config.PolicyPath, limit)
+		}
+		if interval >= limit && interval-jitter < limit {
+			// A late capture followed by an early one
+			return fmt.Errorf("--jitter %s can bring captures closer than the policy (%s) allows: one capture every %s", jitter, config.PolicyPath, limit)
+		}
+		if (sessionPath != "" || rewindLength > 0) && sessionFPS > 0 && time.Duration(float64(time.Second)/sessionFPS) < limit {
+			return fmt.Errorf("--session-fps %g is more frequent than the policy (%s) allows: one capture every %s", sessionFPS, config.PolicyPath, limit)
+		}
+	}
+
+	// Interval mode - repeated captures with generated names
+	if interval > 0 {
+		if outputPath == "" {
+			outputPath = filepath.Join(outputDirectory, "screenshot")
+		}
+		return runInterval(capturer, opts, enc, outputPath, deliv, sched)
+	}
+
+	// Session mode - record frames and events until stopped
+	if sessionPath != "" {
+		return runSession(capturer, opts, sessionPath)
+	}
+
+	// Rewind mode - keep recent frames in memory until asked for a clip
+	if rewindLength > 0 {
+		return runRewind(capturer, opts)
+	}
+
+	if err := routeCapture(outputPath == ""); err != nil {
+		return err
 	}
 
-	// Determine compression level
-	level := getCompressionLevel()
+	// Window captures are named after the window, and CI captures after
+	// what was captured so reruns give the same names
+	uniqueName := outputPath == "" && (targetWindow != nil || ciMode)
+	switch {
+	case outputPath != "":
+	case ciMode:
+		outputPath = filepath.Join(outputDirectory, ciFilename(opts, enc.Format))
+	case targetWindow != nil:
+		outputPath = filepath.Join(outputDirectory, capture.WindowFilename(targetWindow.Class, targetWindow.Title, time.Now(), enc.Format))
+	default:
+		outputPath = filepath.Join(outputDirectory, capture.GenerateFilename("screenshot", enc.Format))
+	}
+
+	// Object storage output - capture to a temporary file and upload it
+	if target, name, ok := upload.SplitObjectURI(outputPath); ok {
+		if perMonitor || stdout || a11yDump || locateMode != "" || showStats || len(derived) > 0 {
+			return fmt.Errorf("object storage output cannot be combined with --per-monitor, --stdout, --a11y-dump, --locate, --stats, --crop or --thumbnail")
+		}
+		return runObjectOutput(capturer, opts, enc, outputPath, target, name, deliv)
+	}
 
-	// Stdout mode - output PNG directly to stdout
+	if outputPath, err = capture.OrganizePath(outputPath, organize, time.Now()); err != nil {
+		return err
+	}
+	if uniqueName {
+		// Names without the time repeat, so the same window captured
+		// twice a day gets _1, _2, ...
+		outputPath = capture.UniquePath(outputPath)
+	}
+
+	// Per-monitor mode - one file per monitor
+	if perMonitor {
+		return capturer.Batch(func() error {
+			return runPerMonitor(capturer, opts, enc, outputPath, deliv)
+		})
+	}
+
+	// Stdout mode - output image directly to stdout
 	if stdout {
-		img, err := capturer.Capture(opts)
+		auditDestination = "stdout"
+		f, err := captureFrame(capturer, opts)
 		if err != nil {
-			return fmt.Errorf("capture failed: %w", err)
+			return err
+		}
+		stats.capture = f.stats
+		out, enc, err := f.fitSize(enc)
+		if err != nil {
+			return err
+		}
+		if err := stdoutError(capture.EncodeTimed(out, os.Stdout, enc, &stats.capture)); err != nil {
+			return err
+		}
+		if copyClipboard {
+			if err := f.toClipboard(); err != nil {
+				return err
+			}
+		}
+		if showStats {
+			stats.print()
+		}
+		return nil
+	}
+
+	// Menu mode - decide what to do with the capture afterwards
+	if menu {
+		return runMenu(capturer, opts, enc, outputPath, deliv)
+	}
+
+	// Capture to file. Everything below is made from this one frame, so
+	// the file, crops, thumbnail, clipboard and upload all match
+	var area image.Rectangle
+	if len(derived) > 0 {
+		if area, err = derivedArea(capturer, opts, derived); err != nil {
+			return err
+		}
+	}
+	f, err := captureFrame(capturer, opts)
+	if err != nil {
+		return err
+	}
+	stats.capture = f.stats
+	img := f.img
+	if enc.Format == capture.FormatAuto {
+		enc, outputPath = resolveFormat(img, enc, outputPath)
+		if uniqueName {
+			outputPath = capture.UniquePath(outputPath)
+		}
+	}
+
+	// Read the tree and element positions right away so they match the
+	// pixels; the image is still saved if that fails
+	var tree *a11y.Tree
+	if opts.WindowID != 0 && (a11yDump || locateMode != "") {
+		if tree, err = dumpA11y(opts.WindowID); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: accessibility tree not available: %v\n", err)
+		}
+	}
+	var elements *elementsFile
+	if locateMode != "" && (tree != nil || opts.WindowID == 0) {
+		if elements, err = locateElements(capturer, opts, tree); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: UI elements not saved: %v\n", err)
 		}
-		return capture.WritePNG(img, os.Stdout, level)
 	}
 
-	// Capture to file
-	if err := capturer.CaptureToFile(opts, outputPath, level); err != nil {
+	var (
+		derivedImages []image.Image
+		fallback      *capture.Fallback
+	)
+	pngPath := capture.FallbackPath(outputPath)
+	if len(derived) > 0 {
+		derivedImages, fallback, err = capture.SaveDerived(img, area, outputPath, pngPath, enc, &stats.capture, derived)
+	} else {
+		var out image.Image
+		if out, enc, err = f.fitSize(enc); err == nil {
+			fallback, err = capture.SaveFallback(out, outputPath, pngPath, enc, &stats.capture)
+		}
+	}
+	if err != nil {
 		return err
 	}
+	if fallback != nil {
+		outputPath, enc.Format = pngPath, capture.FormatPNG
+		warnFallback(outputPath, fallback)
+	}
+
+	res := f.result(outputPath, enc)
+	res.Items[0].Fallback = fallback
+	if tree != nil && a11yDump {
+		path := a11yPath(outputPath)
+		if err := writeA11y(path, tree); err != nil {
+			return err
+		}
+		res.Items[0].A11y = path
+	}
+	if elements != nil {
+		item := &res.Items[0]
+		if item.Elements, item.Overlay, err = writeElements(locateMode, outputPath, img, elements); err != nil {
+			return err
+		}
+	}
+	res.Items = append(res.Items, derivedItems(outputPath, derived, derivedImages, enc)...)
+	start := time.Now()
+	if err := deliv.deliver(&res.Items[0], outputPath); err != nil {
+		return err
+	}
+	if deliv.uploader != nil {
+		stats.upload = time.Since(start)
+	}
+	for _, item := range res.Items[1:] {
+		publishWritten(item)
+	}
+	if copyClipboard {
+		if err := f.toClipboard(); err != nil {
+			return err
+		}
+		res.Items[0].Clipboard = true
+	}
+
+	if jsonOutput {
+		if showStats {
+			res.Stats = stats.json()
+		}
+		if err := printResult(res); err != nil {
+			return err
+		}
+	} else {
+		infof("Screenshot saved: %s", outputPath)
+		infoAnalysis(res.Items[0])
+		if url := res.Items[0].URL; url != "" {
+			infof("Uploaded: %s", url)
+		}
+		if path := res.Items[0].A11y; path != "" {
+			infof("Accessibility tree saved: %s", path)
+		}
+		if path := res.Items[0].Elements; path != "" {
+			infof("UI elements saved: %s", path)
+		}
+		if path := res.Items[0].Overlay; path != "" {
+			infof("Element overlay saved: %s", path)
+		}
+		for _, item := range res.Items[1:] {
+			infof("Derived image saved: %s", item.Path)
+		}
+		if res.Items[0].Clipboard {
+			infof("Screenshot copied to clipboard")
+		}
+		if showStats {
+			stats.print()
+		}
+	}
+
+	if latestLink != "" {
+		if err := capture.UpdateLatestLink(latestLink, outputPath); err != nil {
+			return err
+		}
+	}
 
-	fmt.Printf("Screenshot saved: %s\n", outputPath)
+	if showOSD {
+		location := outputPath
+		if url := res.Items[0].URL; url != "" {
+			location = url
+		}
+		osd(capturer, opts, location)
+	}
 
 	// Open in viewer if requested
 	if view {
@@ -137,6 +843,98 @@ func run(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// exposurePolicy returns the long exposure --average or --max-of asks for
+func exposurePolicy() (capture.ExposurePolicy, error) {
+	p := capture.ExposurePolicy{Frames: averageFrames, Mode: capture.ExposureAverage}
+	flag := "--average"
+	if maxOfFrames != 0 {
+		if averageFrames != 0 {
+			return p, fmt.Errorf("--average and --max-of can't be combined")
+		}
+		p = capture.ExposurePolicy{Frames: maxOfFrames, Mode: capture.ExposureMax}
+		flag = "--max-of"
+	}
+	if p.Frames != 0 && (p.Frames < 2 || p.Frames > capture.MaxExposureFrames) {
+		return p, fmt.Errorf("%s must be between 2 and %d", flag, capture.MaxExposureFrames)
+	}
+	return p, nil
+}
+
+// debugf prints a debug message on stderr when --debug is set
+func debugf(format string, args ...any) {
+	if debug {
+		fmt.Fprintf(os.Stderr, "debug: "+format+"\n", args...)
+	}
+}
+
+// targetWindow is the window --window resolved to, if any
+var targetWindow *xwin.Window
+
+// buildCaptureOptions builds the capture options from flags
+func buildCaptureOptions(capturer *capture.Capturer) (strategy.CaptureOptions, error) {
+	opts := strategy.CaptureOptions{
+		Monitor:  -1,
+		Display:  display,
+		ZeroCopy: zeroCopy,
+	}
+
+	// Resolve -m: an index is used as is; names need the monitor list
+	switch i, err := strconv.Atoi(monitor); {
+	case monitor == "" || monitor == "all":
+	case err == nil:
+		opts.Monitor = i
+	default:
+		if display != "" {
+			os.Setenv("DISPLAY", display)
+		}
+		cfg, err := loadConfig()
+		if err != nil {
+			return opts, err
+		}
+		monitors, err := capturer.ListMonitors()
+		if err != nil {
+			return opts, err
+		}
+		index, area, err := cfg.Resolve(monitor, monitors)
+		if err != nil {
+			return opts, err
+		}
+		if area != nil && region != "" {
+			return opts, fmt.Errorf("--region cannot be combined with virtual monitor %q", monitor)
+		}
+		opts.Monitor = index
+		opts.Region = area
+		debugf("monitor %s resolved to index %d, area %v", monitor, index, area)
+	}
+
+	// Capture a single window: its own contents by ID, with its bounds as
+	// the region for exclusion zones
+	if window != "" {
+		if region != "" || opts.Monitor != -1 || opts.Region != nil || perMonitor {
+			return opts, fmt.Errorf("--window cannot be combined with --region, -m or --per-monitor")
+		}
+		win, err := findWindow(window)
+		if err != nil {
+			return opts, err
+		}
+		opts.WindowID = uint64(win.ID)
+		opts.Region = &win.Bounds
+		targetWindow = win
+		debugf("window %q resolved to 0x%x %q at %v", window, win.ID, win.Title, win.Bounds)
+	}
+
+	// Parse region if specified
+	if region != "" {
+		rect, err := strategy.ParseRegion(region)
+		if err != nil {
+			return opts, fmt.Errorf("invalid region: %w", err)
+		}
+		opts.Region = rect
+	}
+
+	return opts, nil
+}
+
 // openFile opens a file with the system's default application
 func openFile(path string) error {
 	var cmd *exec.Cmd
@@ -164,37 +962,158 @@ func listMonitors(capturer *capture.Capturer) error {
 
 	fmt.Printf("Available monitors (%d):\n", len(monitors))
 	for _, m := range monitors {
-		fmt.Printf("  %d: %s (%dx%d at %d,%d)\n",
+		primary := ""
+		if m.Primary {
+			primary = " [primary]"
+		}
+		fmt.Printf("  %d: %s (%dx%d at %d,%d)%s\n",
 			m.Index,
 			m.Name,
 			m.Bounds.Dx(),
 			m.Bounds.Dy(),
 			m.Bounds.Min.X,
 			m.Bounds.Min.Y,
+			primary,
 		)
 	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if names := cfg.Names(); len(names) > 0 {
+		fmt.Printf("Virtual monitors (%d):\n", len(names))
+		for _, name := range names {
+			r, err := cfg.Bounds(name, monitors)
+			if err != nil {
+				fmt.Printf("  %s: %v\n", name, err)
+				continue
+			}
+			fmt.Printf("  %s (%dx%d at %d,%d)\n", name, r.Dx(), r.Dy(), r.Min.X, r.Min.Y)
+		}
+	}
 	return nil
 }
 
-// parseRegion parses a region string "x,y,width,height" into an image.Rectangle
-func parseRegion(s string) (*image.Rectangle, error) {
-	parts := strings.Split(s, ",")
-	if len(parts) != 4 {
-		return nil, fmt.Errorf("expected x,y,width,height")
+// getEncodeOptions builds the encoding options from flags.
+// Without --format, the format is inferred from the output extension,
+// else taken from the config.
+func getEncodeOptions(outputPath string) (capture.EncodeOptions, error) {
+	enc := capture.EncodeOptions{
+		Format:           capture.FormatPNG,
+		CompressionLevel: getCompressionLevel(),
 	}
 
-	vals := make([]int, 4)
-	for i, p := range parts {
-		v, err := strconv.Atoi(strings.TrimSpace(p))
+	name := format
+	if name == "" {
+		if f, ok := capture.FormatFromPath(outputPath); ok {
+			name = string(f)
+		} else {
+			cfg, err := loadConfig()
+			if err != nil {
+				return enc, err
+			}
+			name = cfg.Format
+		}
+	}
+	if strings.EqualFold(name, string(capture.FormatAuto)) {
+		a, err := autoFormat()
+		if err != nil {
+			return enc, err
+		}
+		enc.Format, enc.Auto = capture.FormatAuto, a
+	} else if name != "" {
+		f, err := capture.ParseFormat(name)
 		if err != nil {
-			return nil, fmt.Errorf("invalid number: %s", p)
+			return enc, err
+		}
+		enc.Format = f
+	}
+
+	enc.Quality = quality
+	enc.Progressive = progressive
+	enc.Interlace = interlace
+	if progressive && enc.Format != capture.FormatJPEG {
+		return enc, fmt.Errorf("--progressive needs JPEG output (use --interlace for PNG)")
+	}
+	if interlace && enc.Format != capture.FormatPNG {
+		return enc, fmt.Errorf("--interlace needs PNG output (use --progressive for JPEG)")
+	}
+
+	enc.FlushRows = flushRows
+	if flushRows < 0 {
+		return enc, fmt.Errorf("--flush-every-n-rows must not be negative")
+	}
+	if flushRows > 0 && enc.Format != capture.FormatPNG {
+		return enc, fmt.Errorf("--flush-every-n-rows needs PNG output")
+	}
+
+	pc, err := capture.ParsePNGColor(pngColor)
+	if err != nil {
+		return enc, err
+	}
+	enc.PNGColor = pc
+	if pc != capture.PNGAuto && enc.Format != capture.FormatPNG {
+		return enc, fmt.Errorf("--png-color needs PNG output")
+	}
+	enc.SRGB = pngMeta
+
+	if maxSize, err = config.ParseBytes(maxSizeFlag); err != nil {
+		return enc, fmt.Errorf("--max-size: %w", err)
+	}
+	switch enc.Format {
+	case capture.FormatPNG, capture.FormatJPEG, capture.FormatHEIF, capture.FormatQOI, capture.FormatAuto:
+	default:
+		if maxSize > 0 {
+			return enc, fmt.Errorf("--max-size needs png, jpeg, heif or qoi output")
 		}
-		vals[i] = v
 	}
 
-	x, y, w, h := vals[0], vals[1], vals[2], vals[3]
-	rect := image.Rect(x, y, x+w, y+h)
-	return &rect, nil
+	enc.Stable = stableOutput
+	if stableOutput && enc.Format != capture.FormatPNG {
+		return enc, fmt.Errorf("--stable-output needs PNG output")
+	}
+	if stableOutput && (interlace || flushRows > 0) {
+		return enc, fmt.Errorf("--stable-output cannot be combined with --interlace or --flush-every-n-rows")
+	}
+
+	enc.Verify = verify
+	enc.Progress = saveProgress()
+	if verify && enc.Format != capture.FormatPNG {
+		return enc, fmt.Errorf("--verify needs PNG output (other formats are lossy or not decodable)")
+	}
+	if verify && stdout {
+		return enc, fmt.Errorf("--verify cannot be combined with --stdout")
+	}
+
+	return enc, nil
+}
+
+// annotationFlags parses --box, --arrow, --stamp, --text and --label. Boxes are
+// drawn first and labels last, so numbers stay readable where they
+// overlap.
+func annotationFlags() ([]annotate.Op, error) {
+	var ops []annotate.Op
+	for _, f := range []struct {
+		name  string
+		specs []string
+		parse func(string) (annotate.Op, error)
+	}{
+		{"box", boxes, annotate.ParseBox},
+		{"arrow", arrows, annotate.ParseArrow},
+		{"stamp", stamps, annotate.ParseStamp},
+		{"text", texts, func(spec string) (annotate.Op, error) { return annotate.ParseText(spec, textFont) }},
+		{"label", labels, annotate.ParseLabel},
+	} {
+		for _, spec := range f.specs {
+			op, err := f.parse(spec)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --%s: %w", f.name, err)
+			}
+			ops = append(ops, op)
+		}
+	}
+	return ops, nil
 }
 
 // getCompressionLevel returns the compression level based on flags
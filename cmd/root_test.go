@@ -0,0 +1,53 @@
+//go:build !nosynthetic && !minimal
+
+package cmd
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+// TestRunSynthetic runs a whole capture from the command line against the
+// synthetic backend, with no display
+func TestRunSynthetic(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"HOME", "XDG_CONFIG_HOME", "XDG_DATA_HOME", "XDG_STATE_HOME", "XDG_RUNTIME_DIR"} {
+		t.Setenv(name, dir)
+	}
+	t.Setenv("SCREENSHOT_SYNTHETIC_MONITORS", "160x90,96x64+160+13")
+	t.Cleanup(func() {
+		reset := func(f *pflag.Flag) {
+			if f.Changed {
+				f.Value.Set(f.DefValue)
+				f.Changed = false
+			}
+		}
+		rootCmd.Flags().VisitAll(reset)
+		rootCmd.PersistentFlags().VisitAll(reset)
+		clear(envFlags)
+	})
+
+	out := filepath.Join(dir, "shot.png")
+	rootCmd.SetArgs([]string{"--backend", "synthetic", "--no-history", "-q", "-m", "SYN-2", "-o", out})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds(); got != image.Rect(0, 0, 96, 64) {
+		t.Errorf("captured %v, want monitor SYN-2 (96x64)", got)
+	}
+}
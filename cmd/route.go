@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"path/filepath"
+	"slices"
+
+	"github.com/robotin/screenshot/internal/paths"
+	"github.com/robotin/screenshot/internal/xwin"
+)
+
+// routeCapture applies the first routing rule from the config that
+// matches the --window target, or else the focused window: its tags are
+// added to --tag, and when the name is generated its directory replaces
+// the output directory, unless --output-dir is given. Without a window to
+// match, nothing changes.
+func routeCapture(generated bool) error {
+	cfg, err := loadConfig()
+	if err != nil || len(cfg.Routes) == 0 {
+		return err
+	}
+
+	win := targetWindow
+	if win == nil {
+		conn, err := xwin.Connect(display)
+		if err != nil {
+			debugf("no window to route by: %v", err)
+			return nil
+		}
+		win, err = conn.ActiveWindow()
+		conn.Close()
+		if err != nil || win == nil {
+			debugf("no window to route by: %v", err)
+			return nil
+		}
+	}
+
+	route := cfg.Route(win.Class, win.Instance, win.Title)
+	if route == nil {
+		return nil
+	}
+	debugf("window %q (%s) routed to %q, tags %v", win.Title, win.Class, route.Dir, route.Tags)
+	for _, tag := range route.Tags {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	if route.Dir == "" || !generated || outputDir != "" {
+		return nil
+	}
+	dir, err := paths.ExpandHome(route.Dir)
+	if err != nil {
+		return err
+	}
+	outputDirectory, err = filepath.Abs(dir)
+	return err
+}
@@ -0,0 +1,313 @@
+//go:build !noserve && !minimal
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/robotin/screenshot/internal/history"
+	"github.com/robotin/screenshot/internal/hub"
+	"github.com/robotin/screenshot/internal/review"
+	"github.com/robotin/screenshot/internal/server"
+	"github.com/robotin/screenshot/internal/xwin"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveListen        string
+	serveHealthTimeout time.Duration
+	serveRateLimit     float64
+	serveRateBurst     int
+	serveConcurrency   int
+	serveQueueSize     int
+	serveQueueTimeout  time.Duration
+	serveCoalesce      time.Duration
+	serveToken         string
+	serveShareSecret   string
+	serveShareTTL      time.Duration
+	servePublicURL     string
+	serveHub           string
+	serveHubToken      string
+	serveAgentName     string
+	serveDiffStore     string
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve captures over HTTP",
+	Long: `Run a long-lived HTTP server that captures on request.
+
+Open the server URL in a browser for the built-in web UI (monitor
+thumbnails, capture button, region selection and download links).
+
+Endpoints:
+  GET /capture?monitor=N&region=x,y,w,h&format=png&compress=1
+  GET /monitors     Monitor layout as JSON
+  GET /healthz      Liveness: a 1x1 probe grab must complete in time
+  GET /readyz       Readiness: backend available and probe grab succeeds
+  POST /share?ttl=5m  Capture and return a one-shot signed link (/s/...)
+  POST /review/NAME   With --diff-store, compare the uploaded image to a baseline
+
+Capture requests are rate limited per client IP (--rate-limit) and run
+through a bounded queue (--concurrency, --queue-size), so a misbehaving
+client cannot flood the display server with simultaneous grabs.
+Rejected requests get 429 (rate limit) or 503 (queue full) with Retry-After.
+
+Identical capture requests arriving within --coalesce of each other share
+one capture and encode (reported in the X-Capture-Cache header).
+
+With --token (or $SCREENSHOT_TOKEN), API endpoints require
+"Authorization: Bearer <token>". Share links need no credentials: each can
+be opened exactly once before it expires, e.g. by support staff glancing
+at a kiosk.
+
+With --diff-store, the server is a small visual review service for CI:
+upload a capture to /review/NAME to compare it with NAME's baseline
+(status new, match or changed, with a highlight and a before/after page
+kept for changes), and POST /review/NAME/approve to make it the baseline.
+
+With --hub, the server registers itself as an agent with a central hub
+(see "screenshot hub"), advertising --public-url as its address.
+
+Examples:
+  screenshot serve --listen 127.0.0.1:8080
+  screenshot serve --listen :8080 --public-url http://kiosk-7:8080 --hub http://hub:9090 --hub-token s3cret
+  screenshot serve --rate-limit 2 --rate-burst 5 --concurrency 2
+  screenshot serve --listen :8080 --diff-store /var/lib/baselines
+  curl --data-binary @login.png 'http://ci-review:8080/review/login-page?threshold=8'
+  curl -o shot.png 'http://127.0.0.1:8080/capture?monitor=0'
+  curl -X POST -H "Authorization: Bearer $TOKEN" 'http://kiosk:8080/share?ttl=5m'`,
+	Args: cobra.NoArgs,
+	RunE: runServe,
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveListen, "listen", "127.0.0.1:8080", "Address to listen on")
+	serveCmd.Flags().DurationVar(&serveHealthTimeout, "health-timeout", 5*time.Second, "Maximum time for the health probe grab")
+	serveCmd.Flags().Float64Var(&serveRateLimit, "rate-limit", 5, "Capture requests per second allowed per client (0 = unlimited)")
+	serveCmd.Flags().IntVar(&serveRateBurst, "rate-burst", 10, "Burst size for the per-client rate limit")
+	serveCmd.Flags().IntVar(&serveConcurrency, "concurrency", 2, "Maximum captures running at once")
+	serveCmd.Flags().IntVar(&serveQueueSize, "queue-size", 16, "Maximum capture requests waiting for a slot")
+	serveCmd.Flags().DurationVar(&serveQueueTimeout, "queue-timeout", 10*time.Second, "Maximum time a request waits in the queue")
+	serveCmd.Flags().DurationVar(&serveCoalesce, "coalesce", 250*time.Millisecond, "Share one capture among identical requests within this window (0 = off)")
+	serveCmd.Flags().StringVar(&serveToken, "token", "", "Bearer token required for API requests (default: $SCREENSHOT_TOKEN)")
+	serveCmd.Flags().StringVar(&serveShareSecret, "share-secret", "", "Secret for signing share links (default: random, links die on restart)")
+	serveCmd.Flags().DurationVar(&serveShareTTL, "share-ttl", 10*time.Minute, "Default and maximum lifetime of share links")
+	serveCmd.Flags().StringVar(&servePublicURL, "public-url", "", "Base URL used in share links (default: from the request Host)")
+	serveCmd.Flags().StringVar(&serveHub, "hub", "", "Register with this hub URL as an agent")
+	serveCmd.Flags().StringVar(&serveHubToken, "hub-token", "", "Tenant token for the hub (default: $SCREENSHOT_HUB_TOKEN)")
+	serveCmd.Flags().StringVar(&serveAgentName, "agent-name", "", "Agent name shown in the hub (default: hostname)")
+	serveCmd.Flags().StringVar(&serveDiffStore, "diff-store", "", "Serve /review, comparing uploaded captures with named baselines kept in this directory")
+	serveCmd.Flags().StringVarP(&display, "display", "d", "", "X11 display (default: $DISPLAY or :0)")
+	rootCmd.AddCommand(serveCmd)
+}
+
+// serveRecentRegions is how many earlier capture areas the web UI
+// outlines
+const serveRecentRegions = 5
+
+// recentRegions reads the newest capture areas from the history
+func recentRegions() ([]image.Rectangle, error) {
+	db, err := history.Open()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := db.Entries()
+	if err != nil {
+		return nil, err
+	}
+	var rects []image.Rectangle
+	for _, r := range history.RecentRegions(entries, serveRecentRegions) {
+		rects = append(rects, image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height))
+	}
+	return rects, nil
+}
+
+// serveHistory is how many recent captures the web UI shows
+const serveHistory = 12
+
+// recentHistory reads the newest captures from the history, newest first
+func recentHistory() ([]history.Entry, error) {
+	db, err := history.Open()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := db.Entries()
+	if err != nil {
+		return nil, err
+	}
+	var recent []history.Entry
+	for i := len(entries) - 1; i >= 0 && len(recent) < serveHistory; i-- {
+		recent = append(recent, entries[i])
+	}
+	return recent, nil
+}
+
+// visibleWindows lists the windows on screen for the web UI to snap to.
+// Without an X server (e.g. the synthetic backend) there are none.
+func visibleWindows() ([]server.Window, error) {
+	conn, err := xwin.Connect("")
+	if err != nil {
+		return nil, nil
+	}
+	defer conn.Close()
+
+	windows, err := conn.Windows()
+	if err != nil {
+		return nil, err
+	}
+	var out []server.Window
+	for _, w := range windows {
+		if w.Hidden || w.Type == "desktop" {
+			continue
+		}
+		out = append(out, server.Window{Title: w.Title, Bounds: w.Bounds, Frame: conn.FrameBounds(&w)})
+	}
+	return out, nil
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	// Captures run concurrently, so the display is fixed for the process
+	// instead of being switched per request
+	if display != "" {
+		os.Setenv("DISPLAY", display)
+	}
+
+	if serveToken == "" {
+		serveToken = os.Getenv("SCREENSHOT_TOKEN")
+	}
+
+	settings, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	var store *review.Store
+	if serveDiffStore != "" {
+		if store, err = review.Open(serveDiffStore); err != nil {
+			return err
+		}
+	}
+
+	auditDestination = "http clients on " + serveListen
+	capturer, err := newCapturer()
+	if err != nil {
+		return err
+	}
+	handler, err := server.New(capturer, server.Config{
+		HealthTimeout:  serveHealthTimeout,
+		RateLimit:      serveRateLimit,
+		RateBurst:      serveRateBurst,
+		Concurrency:    serveConcurrency,
+		QueueSize:      serveQueueSize,
+		QueueTimeout:   serveQueueTimeout,
+		CoalesceWindow: serveCoalesce,
+		Token:          serveToken,
+		ShareSecret:    []byte(serveShareSecret),
+		ShareTTL:       serveShareTTL,
+		PublicURL:      servePublicURL,
+		Settings:       settings,
+		RecentRegions:  recentRegions,
+		History:        recentHistory,
+		Windows:        visibleWindows,
+		Review:         store,
+	})
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:              serveListen,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	stop, stopNotify := notifyInterrupt()
+	defer stopNotify()
+	kill, err := startPanicSwitch("")
+	if err != nil {
+		return err
+	}
+	defer kill.Close()
+	// Drop connections first, so nothing is served from what's wiped
+	kill.OnWipe(func() {
+		srv.Close()
+		handler.Wipe()
+	})
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	fmt.Fprintf(os.Stderr, "Serving on http://%s\n", serveListen)
+
+	if serveHub != "" {
+		cancel, err := startHubRegistration()
+		if err != nil {
+			return err
+		}
+		defer cancel()
+	}
+
+	select {
+	case err := <-errc:
+		if errors.Is(err, http.ErrServerClosed) {
+			// Closed by the panic switch
+			return nil
+		}
+		return err
+	case <-kill.C:
+		return nil
+	case <-stop:
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
+}
+
+// startHubRegistration registers this server with the hub in the
+// background and returns a function that stops the heartbeats
+func startHubRegistration() (context.CancelFunc, error) {
+	if serveHubToken == "" {
+		serveHubToken = os.Getenv("SCREENSHOT_HUB_TOKEN")
+	}
+	if serveHubToken == "" {
+		return nil, fmt.Errorf("--hub requires --hub-token or $SCREENSHOT_HUB_TOKEN")
+	}
+
+	name := serveAgentName
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+
+	advertise := servePublicURL
+	if advertise == "" {
+		advertise = "http://" + serveListen
+	}
+
+	conn, err := hub.Dial(serveHub)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --hub: %w", err)
+	}
+
+	reg := hub.Registration{Name: name, URL: advertise, Token: serveToken}
+	ctx, cancel := context.WithCancel(context.Background())
+	go hub.Register(ctx, conn, serveHubToken, reg, 30*time.Second, func(err error) {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	})
+
+	fmt.Fprintf(os.Stderr, "Registering with hub %s as %q\n", serveHub, name)
+	return func() {
+		cancel()
+		conn.Close()
+	}, nil
+}
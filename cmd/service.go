@@ -0,0 +1,159 @@
+//go:build !noservice && !minimal
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/robotin/screenshot/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serviceName   string
+	serviceSystem bool
+	serviceLog    string
+	serviceEnv    []string
+	serviceDryRun bool
+)
+
+// serviceEnvVars are passed on from the installing shell, so the service
+// captures the same display with the same configuration
+var serviceEnvVars = []string{"DISPLAY", "XAUTHORITY", "WAYLAND_DISPLAY", "SCREENSHOT_CONFIG"}
+
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Run serve or scheduled captures as a background service",
+	Long: `Register this tool as a service that starts with the session (or the
+machine, --system) and is restarted when it fails: a systemd unit on
+Linux, a launchd agent on macOS and a Windows service.
+
+  linux    ~/.config/systemd/user/robotin-screenshot[-NAME].service
+           (--system: /etc/systemd/system); logs in the journal
+  macos    ~/Library/LaunchAgents/com.robotin.screenshot[.NAME].plist
+           (--system: /Library/LaunchDaemons); logs in
+           ~/Library/Logs/robotin-screenshot/
+  windows  service robotin-screenshot[-NAME], from an administrator
+           prompt; logs in %ProgramData%\robotin-screenshot\logs\
+
+Examples:
+  screenshot service install -- serve --listen :8080
+  screenshot service install --name office -- --schedule office --output-dir ~/audit
+  screenshot service status --name office
+  screenshot service uninstall --name office`,
+}
+
+var serviceInstallCmd = &cobra.Command{
+	Use:   "install [flags] -- ARGS...",
+	Short: "Install and start a service running this tool with ARGS",
+	Long: `Install and start a service that runs this tool with the arguments
+after --, replacing a service of the same --name. $DISPLAY, $XAUTHORITY,
+$WAYLAND_DISPLAY and $SCREENSHOT_CONFIG are passed on when set; add
+others with --env.
+
+The service is restarted 5 seconds after it fails, and stopped the way
+Ctrl-C stops it, so the capture in progress finishes. Output goes to
+--log, or the platform's default (see screenshot service --help).`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runServiceInstall,
+}
+
+var serviceUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Stop and remove a service",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return service.Uninstall(serviceOptions())
+	},
+}
+
+var serviceStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether a service is installed and running",
+	Args:  cobra.NoArgs,
+	RunE:  runServiceStatus,
+}
+
+func init() {
+	serviceCmd.PersistentFlags().StringVar(&serviceName, "name", "", "Service name suffix, to run several (robotin-screenshot-NAME)")
+	serviceCmd.PersistentFlags().BoolVar(&serviceSystem, "system", false, "A service for the whole machine, run as root, instead of the current user (Linux and macOS)")
+	serviceCmd.PersistentFlags().BoolVar(&serviceDryRun, "dry-run", false, "Print the changes without making them")
+	serviceInstallCmd.Flags().StringVar(&serviceLog, "log", "", "File to append the service's output to (default: the journal on Linux, a file in the logs directory elsewhere)")
+	serviceInstallCmd.Flags().StringArrayVar(&serviceEnv, "env", nil, "NAME=VALUE to set for the service (repeatable)")
+	serviceStatusCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the status as JSON")
+	serviceCmd.AddCommand(serviceInstallCmd, serviceUninstallCmd, serviceStatusCmd)
+	rootCmd.AddCommand(serviceCmd)
+}
+
+// serviceOptions returns the service selected by the flags
+func serviceOptions() service.Options {
+	return service.Options{Name: serviceName, System: serviceSystem, DryRun: serviceDryRun, Out: os.Stdout}
+}
+
+func runServiceInstall(cmd *cobra.Command, args []string) error {
+	// Catch typos now rather than in a restart loop
+	if sub, rest, err := rootCmd.Find(args); err != nil {
+		return fmt.Errorf("invalid service arguments: %w", err)
+	} else if err := sub.ParseFlags(rest); err != nil {
+		return fmt.Errorf("invalid service arguments: %w", err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the executable: %w", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return fmt.Errorf("failed to find the executable: %w", err)
+	}
+
+	opts := serviceOptions()
+	opts.Command = append([]string{exe}, args...)
+	if serviceLog != "" {
+		if opts.Log, err = filepath.Abs(serviceLog); err != nil {
+			return err
+		}
+	}
+	for _, name := range serviceEnvVars {
+		if v, ok := os.LookupEnv(name); ok {
+			opts.Env = append(opts.Env, name+"="+v)
+		}
+	}
+	for _, v := range serviceEnv {
+		if _, _, ok := strings.Cut(v, "="); !ok {
+			return fmt.Errorf("invalid --env %q (expected NAME=VALUE)", v)
+		}
+		opts.Env = append(opts.Env, v)
+	}
+	return service.Install(opts)
+}
+
+func runServiceStatus(cmd *cobra.Command, args []string) error {
+	st, err := service.Query(serviceOptions())
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return stdoutError(enc.Encode(st))
+	}
+
+	if !st.Installed {
+		fmt.Printf("%s: not installed\n", st.Name)
+		return nil
+	}
+	state := "stopped"
+	if st.Running {
+		state = "running"
+	}
+	fmt.Printf("%s: %s\n", st.Name, state)
+	if st.Detail != "" {
+		fmt.Printf("  state: %s\n", st.Detail)
+	}
+	fmt.Printf("  file:  %s\n  logs:  %s\n", st.Path, st.Log)
+	return nil
+}
@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/session"
+	"github.com/robotin/screenshot/internal/strategy"
+	"github.com/robotin/screenshot/internal/xwin"
+)
+
+// runSession records frames and timeline events into a session bundle
+// until --duration elapses or the process is interrupted
+func runSession(capturer *capture.Capturer, opts strategy.CaptureOptions, path string) error {
+	if sessionFPS <= 0 {
+		return fmt.Errorf("--session-fps must be positive")
+	}
+	if sessionSegment < 0 || (sessionSegment > 0 && sessionSegment < time.Duration(float64(time.Second)/sessionFPS)) {
+		return fmt.Errorf("--segment must be at least one frame long (1/--session-fps)")
+	}
+
+	auditDestination = "session " + path
+	ind, err := newCaptureIndicator(opts.Display)
+	if err != nil {
+		return err
+	}
+	defer ind.Close()
+
+	rec, err := newSessionRecorder(path)
+	if err != nil {
+		return err
+	}
+
+	// Focus tracking is best-effort: without an EWMH window manager we
+	// still record frames and monitor changes
+	var windows *xwin.Conn
+	if conn, err := xwin.Connect(opts.Display); err == nil {
+		windows = conn
+		defer windows.Close()
+	}
+
+	tracker := newMonitorTracker(capturer, opts.Display)
+	defer tracker.Close()
+	rec.w.Event(session.EventMonitors, tracker.Monitors())
+
+	stop, stopNotify := notifyInterrupt()
+	defer stopNotify()
+	kill, err := startPanicSwitch(opts.Display)
+	if err != nil {
+		rec.close()
+		return err
+	}
+	defer kill.Close()
+
+	var deadline <-chan time.Time
+	if duration > 0 {
+		deadline = time.After(duration)
+	}
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / sessionFPS))
+	defer ticker.Stop()
+
+	if !quiet {
+		if sessionSegment > 0 {
+			fmt.Fprintf(os.Stderr, "Recording session to %s, ... every %s, indexed in %s (Ctrl-C to stop)\n",
+				session.SegmentPath(path, 1), sessionSegment, session.IndexPath(path))
+		} else {
+			fmt.Fprintf(os.Stderr, "Recording session to %s (Ctrl-C to stop)\n", path)
+		}
+	}
+
+	var lastFocus *xwin.Window
+
+	for {
+		// Cut between frames, and start the new segment with the layout
+		// and focus so it replays on its own
+		if rec.due() {
+			if err := rec.cut(); err != nil {
+				return err
+			}
+			rec.w.Event(session.EventMonitors, tracker.Monitors())
+			lastFocus = nil
+		}
+
+		// Record layout and focus changes before the frame they affect
+		layoutChanged := tracker.Refresh()
+		if layoutChanged {
+			rec.w.Event(session.EventMonitors, tracker.Monitors())
+		}
+		if windows != nil {
+			if focus, err := windows.ActiveWindow(); err == nil && focusChanged(lastFocus, focus) {
+				rec.w.Event(session.EventFocus, focus)
+				lastFocus = focus
+			}
+		}
+
+		// A required indicator must be on screen before anything is
+		// captured
+		at := time.Now()
+		var img image.Image
+		err := ind.Update(tracker.Monitors(), layoutChanged)
+		if err == nil {
+			img, err = capturer.Capture(opts)
+		}
+		if kill.Pulled() {
+			// The frame grabbed as the switch was pulled is not recorded
+			wipeImage(img)
+			return rec.finish()
+		}
+		if err != nil {
+			rec.w.Event(session.EventError, err.Error())
+		} else if err := rec.w.Frame(img, at); err != nil {
+			rec.close()
+			return err
+		}
+
+		select {
+		case <-stop:
+			return rec.finish()
+		case <-kill.C:
+			wipeImage(img)
+			return rec.finish()
+		case <-deadline:
+			return rec.finish()
+		case <-ticker.C:
+		}
+	}
+}
+
+// sessionRecorder writes a session to one bundle or, with --segment, to
+// numbered bundles listed in an index
+type sessionRecorder struct {
+	path   string
+	w      *session.Writer
+	n      int
+	origin time.Time
+	index  session.Index
+}
+
+// newSessionRecorder starts the first bundle
+func newSessionRecorder(path string) (*sessionRecorder, error) {
+	r := &sessionRecorder{path: path, origin: time.Now()}
+	if sessionSegment > 0 {
+		r.index = session.Index{Version: session.FormatVersion, Started: r.origin, Segment: sessionSegment.Seconds(), FPS: sessionFPS}
+	}
+	if err := r.next(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// file returns the path of the current bundle
+func (r *sessionRecorder) file() string {
+	if sessionSegment == 0 {
+		return r.path
+	}
+	return session.SegmentPath(r.path, r.n)
+}
+
+// next starts the next bundle and lists it in the index
+func (r *sessionRecorder) next() error {
+	r.n++
+	w, err := session.Create(r.file(), sessionFPS)
+	if err != nil {
+		return err
+	}
+	r.w = w
+	if sessionSegment == 0 {
+		return nil
+	}
+	r.index.Segments = append(r.index.Segments, session.Segment{
+		File:      filepath.Base(r.file()),
+		Started:   w.Manifest().Started,
+		Recording: true,
+	})
+	return r.index.Write(session.IndexPath(r.path))
+}
+
+// due reports whether the current segment is full. Cut points are counted
+// from the session start, with half a frame of slack for timer jitter, so
+// segments hold the same number of frames and don't drift.
+func (r *sessionRecorder) due() bool {
+	if sessionSegment == 0 {
+		return false
+	}
+	slack := time.Duration(float64(time.Second) / sessionFPS / 2)
+	return time.Since(r.origin)+slack >= time.Duration(r.n)*sessionSegment
+}
+
+// cut finalizes the current segment and starts the next
+func (r *sessionRecorder) cut() error {
+	if err := r.close(); err != nil {
+		return err
+	}
+	infof("Segment saved: %s", r.file())
+	return r.next()
+}
+
+// close finalizes the current bundle and records it in the index
+func (r *sessionRecorder) close() error {
+	if err := r.w.Close(); err != nil {
+		return err
+	}
+	if sessionSegment == 0 {
+		return nil
+	}
+	m := r.w.Manifest()
+	seg := &r.index.Segments[len(r.index.Segments)-1]
+	seg.Duration, seg.Frames, seg.Recording = m.Duration, m.Frames, false
+	return r.index.Write(session.IndexPath(r.path))
+}
+
+// finish finalizes the last bundle and reports the result
+func (r *sessionRecorder) finish() error {
+	if err := r.close(); err != nil {
+		return err
+	}
+	if sessionSegment > 0 {
+		infof("Session saved: %d segments, index %s", r.n, session.IndexPath(r.path))
+	} else {
+		infof("Session saved: %s", r.path)
+	}
+	return nil
+}
+
+// focusChanged reports whether the focused window differs in identity or title
+func focusChanged(prev, cur *xwin.Window) bool {
+	if prev == nil || cur == nil {
+		return prev != cur
+	}
+	return prev.ID != cur.ID || prev.Title != cur.Title
+}
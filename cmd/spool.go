@@ -0,0 +1,316 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/robotin/screenshot/internal/config"
+	"github.com/robotin/screenshot/internal/history"
+	"github.com/robotin/screenshot/internal/paths"
+	"github.com/robotin/screenshot/internal/spool"
+	"github.com/robotin/screenshot/internal/upload"
+	"github.com/spf13/cobra"
+)
+
+var spoolUploads bool
+
+// errDroppedFromSpool is the audit result of queued uploads given up on
+var errDroppedFromSpool = errors.New("dropped from the upload spool")
+
+// spooledCapture is what deliver keeps about a queued upload, to finish
+// delivering it once it is sent, possibly from another process
+type spooledCapture struct {
+	Item      resultItem `json:"item"`
+	LocalPath string     `json:"local_path"`
+	Tags      []string   `json:"tags,omitempty"`
+	HistoryID string     `json:"history_id,omitempty"`
+}
+
+var spoolCmd = &cobra.Command{
+	Use:   "spool",
+	Short: "Work with uploads queued while the network was down",
+	Long: `Uploads that fail with --spool (or uploads.spool in the config) wait in
+the spool, and are sent oldest first before each later upload. These
+commands show, send or drop them.
+
+Examples:
+  screenshot spool list
+  screenshot spool flush       # e.g. from a systemd timer or a network-up hook
+  screenshot spool clear`,
+}
+
+var spoolListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List queued uploads, oldest first",
+	Args:  cobra.NoArgs,
+	RunE:  runSpoolList,
+}
+
+var spoolFlushCmd = &cobra.Command{
+	Use:   "flush",
+	Short: "Send queued uploads now, without waiting for the backoff",
+	Long: `Send queued uploads oldest first, now, stopping at the first that fails.
+Uploads the service rejects (e.g. too large) are dropped and reported.
+Exits 1 if any are left.`,
+	Args: cobra.NoArgs,
+	RunE: runSpoolFlush,
+}
+
+var spoolClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Drop every queued upload",
+	Args:  cobra.NoArgs,
+	RunE:  runSpoolClear,
+}
+
+func init() {
+	spoolCmd.AddCommand(spoolListCmd, spoolFlushCmd, spoolClearCmd)
+	rootCmd.AddCommand(spoolCmd)
+}
+
+// spoolDir returns the spool directory from the config, or the default
+func spoolDir() (string, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return "", err
+	}
+	if cfg.Uploads.SpoolDir != "" {
+		return paths.ExpandHome(cfg.Uploads.SpoolDir)
+	}
+	return spool.DefaultDir()
+}
+
+// setupUploads applies the upload bandwidth limit and makes large
+// uploads resumable, keeping their state in the state directory
+func setupUploads(cfg *config.Config) {
+	upload.SetMaxRate(cfg.Uploads.RateLimit())
+	if !cfg.Uploads.ResumeOn() {
+		return
+	}
+	if dir, err := paths.StateDir(); err == nil {
+		upload.SetResumeDir(filepath.Join(dir, "uploads"))
+	}
+}
+
+// openSpool applies the upload bandwidth limit and returns the spool
+// failed uploads wait in, nil unless --spool or uploads.spool is set
+func openSpool() (*spool.Spool, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	setupUploads(cfg)
+	if !spoolUploads && !cfg.Uploads.Spool {
+		return nil, nil
+	}
+	dir, err := spoolDir()
+	if err != nil {
+		return nil, err
+	}
+	return spool.Open(dir, cfg.Uploads.SpoolLimit()), nil
+}
+
+// uploadOrQueue uploads a saved capture after any queued before it. If
+// that fails in a way retrying may fix, or earlier uploads are still
+// waiting, the capture is queued: it is recorded in the history and the
+// audit log as such, and the result is nil; the webhook waits until it
+// is sent. Other failures are returned for deliver to report.
+func (d *delivery) uploadOrQueue(item *resultItem, localPath string) (*upload.Result, error) {
+	if _, err := d.flushSpool(false); err != nil {
+		debugf("spool: %v", err)
+	}
+
+	waiting, _, err := d.spool.Size()
+	if err != nil {
+		return nil, err
+	}
+	var failure error
+	if waiting == 0 {
+		res, err := uploadFile(d.uploader, localPath)
+		if err == nil || upload.Permanent(err) {
+			return res, err
+		}
+		failure = err
+	}
+
+	q := spooledCapture{Item: *item, LocalPath: localPath, Tags: tags}
+	q.HistoryID = recordHistory(*item, nil)
+	_, dropped, err := d.spool.Add(localPath, d.target, q, failure)
+	reportDropped(dropped)
+	if err != nil {
+		if failure != nil {
+			return nil, fmt.Errorf("%w (and it could not be queued: %w)", failure, err)
+		}
+		return nil, err
+	}
+
+	item.Queued = true
+	result := errors.New("queued behind earlier uploads")
+	if failure != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v; queued to retry later\n", failure)
+		result = fmt.Errorf("queued to retry: %w", failure)
+	} else if waiting -= len(dropped); waiting > 0 {
+		infof("Upload queued behind %d earlier capture(s)", waiting)
+	} else {
+		infof("Upload queued")
+	}
+	return nil, auditDelivery(*item, localPath, d.target, result)
+}
+
+// flushSpool sends queued uploads in order and finishes delivering them:
+// the webhook (if this process has one), the history entry and the audit
+// log. Unless force is set, it waits out the backoff after failures.
+func (d *delivery) flushSpool(force bool) (int, error) {
+	uploaders := map[string]upload.Uploader{}
+	return d.spool.Flush(force, func(e *spool.Entry) error {
+		var q spooledCapture
+		if err := json.Unmarshal(e.Meta, &q); err != nil {
+			return fmt.Errorf("%w: unreadable entry: %w", spool.ErrRejected, err)
+		}
+
+		u, ok := uploaders[e.Target]
+		if !ok {
+			var err error
+			if u, err = upload.New(e.Target); err != nil {
+				// E.g. disallowed by a policy added since
+				dropQueued(e, q, err)
+				return fmt.Errorf("%w: %w", spool.ErrRejected, err)
+			}
+			uploaders[e.Target] = u
+		}
+		res, err := uploadFile(u, e.File())
+		if err != nil {
+			if upload.Permanent(err) {
+				dropQueued(e, q, err)
+				return fmt.Errorf("%w: %w", spool.ErrRejected, err)
+			}
+			return err
+		}
+
+		q.Item.URL = res.URL
+		q.Item.Queued = false
+		infof("Uploaded queued %s: %s", q.Item.Path, res.URL)
+		publishUpload(q.Item, nil)
+		sendWebhook(d.webhook, q.Item, e.File(), q.Tags)
+		if q.HistoryID != "" {
+			updateHistoryUpload(q.HistoryID, &history.Upload{Target: e.Target, Provider: res.Provider, URL: res.URL, ID: res.ID})
+		}
+		// Sent: failing now would send it again
+		if err := auditDelivery(q.Item, q.LocalPath, e.Target, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+		return nil
+	})
+}
+
+// updateHistoryUpload records where a queued capture was uploaded
+func updateHistoryUpload(id string, up *history.Upload) {
+	db, err := history.Open()
+	if err == nil {
+		err = db.Update(id, func(e *history.Entry) { e.Upload = up })
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to record history: %v\n", err)
+	}
+}
+
+// dropQueued reports a queued upload given up on
+func dropQueued(e *spool.Entry, q spooledCapture, reason error) {
+	fmt.Fprintf(os.Stderr, "Warning: dropped queued upload of %s to %s: %v\n", q.Item.Path, e.Target, reason)
+	if err := auditDelivery(q.Item, q.LocalPath, e.Target, fmt.Errorf("%w: %w", errDroppedFromSpool, reason)); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+}
+
+// reportDropped reports queued uploads dropped to keep the spool within
+// its size
+func reportDropped(dropped []spool.Entry) {
+	for i := range dropped {
+		var q spooledCapture
+		json.Unmarshal(dropped[i].Meta, &q)
+		dropQueued(&dropped[i], q, errors.New("the spool is full"))
+	}
+}
+
+// openSpoolCommand opens the spool for the spool commands, which work on
+// it whether or not uploads are spooled by default
+func openSpoolCommand() (*delivery, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := openAuditTrail(); err != nil {
+		return nil, err
+	}
+	setupUploads(cfg)
+	dir, err := spoolDir()
+	if err != nil {
+		return nil, err
+	}
+	return &delivery{spool: spool.Open(dir, cfg.Uploads.SpoolLimit())}, nil
+}
+
+func runSpoolList(cmd *cobra.Command, args []string) error {
+	d, err := openSpoolCommand()
+	if err != nil {
+		return err
+	}
+	entries, err := d.spool.Entries()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Println("No queued uploads")
+		return nil
+	}
+
+	var total int64
+	for _, e := range entries {
+		var q spooledCapture
+		json.Unmarshal(e.Meta, &q)
+		total += e.Size
+		fmt.Printf("%s  %s -> %s (%s)\n", e.Queued.Format(time.DateTime), q.Item.Path, e.Target, formatBytes(e.Size))
+		if e.Attempts > 0 {
+			fmt.Printf("    %d attempt(s), next after %s: %s\n", e.Attempts, e.Next.Format(time.TimeOnly), e.LastError)
+		}
+	}
+	fmt.Printf("%d queued upload(s), %s in %s\n", len(entries), formatBytes(total), d.spool.Dir())
+	return nil
+}
+
+func runSpoolFlush(cmd *cobra.Command, args []string) error {
+	d, err := openSpoolCommand()
+	if err != nil {
+		return err
+	}
+	sent, err := d.flushSpool(true)
+	if err != nil {
+		return err
+	}
+	infof("Sent %d queued upload(s)", sent)
+	return nil
+}
+
+func runSpoolClear(cmd *cobra.Command, args []string) error {
+	d, err := openSpoolCommand()
+	if err != nil {
+		return err
+	}
+	dropped, err := d.spool.Clear()
+	for i := range dropped {
+		var q spooledCapture
+		json.Unmarshal(dropped[i].Meta, &q)
+		if aerr := auditDelivery(q.Item, q.LocalPath, dropped[i].Target, errDroppedFromSpool); aerr != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", aerr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	infof("Dropped %d queued upload(s)", len(dropped))
+	return nil
+}
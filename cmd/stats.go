@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/robotin/screenshot/internal/capture"
+)
+
+// runStats collects the --stats breakdown of a single capture
+type runStats struct {
+	started time.Time
+	init    time.Duration
+	capture capture.Stats
+	upload  time.Duration
+}
+
+// statsJSON is the --stats breakdown in --json results, in milliseconds
+type statsJSON struct {
+	InitMS       float64 `json:"init_ms"`
+	GrabMS       float64 `json:"grab_ms"`
+	CompositeMS  float64 `json:"composite_ms"`
+	TransformsMS float64 `json:"transforms_ms"`
+	EncodeMS     float64 `json:"encode_ms"`
+	WriteMS      float64 `json:"write_ms"`
+	VerifyMS     float64 `json:"verify_ms,omitempty"`
+	UploadMS     float64 `json:"upload_ms,omitempty"`
+	TotalMS      float64 `json:"total_ms"`
+	Bytes        int64   `json:"bytes"`
+	PeakRSS      uint64  `json:"peak_rss_bytes,omitempty"`
+}
+
+// ms converts a duration to fractional milliseconds
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// json returns the breakdown for --json output
+func (s *runStats) json() *statsJSON {
+	c := s.capture
+	return &statsJSON{
+		InitMS:       ms(s.init),
+		GrabMS:       ms(c.Grab),
+		CompositeMS:  ms(c.Composite),
+		TransformsMS: ms(c.Transforms),
+		EncodeMS:     ms(c.Encode),
+		WriteMS:      ms(c.Write),
+		VerifyMS:     ms(c.Verify),
+		UploadMS:     ms(s.upload),
+		TotalMS:      ms(time.Since(s.started)),
+		Bytes:        c.Bytes,
+		PeakRSS:      peakRSS(),
+	}
+}
+
+// print writes the breakdown to stderr, keeping stdout for the image or
+// status messages
+func (s *runStats) print() {
+	c := s.capture
+	rows := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"init", s.init},
+		{"grab", c.Grab},
+		{"composite", c.Composite},
+		{"transforms", c.Transforms},
+		{"encode", c.Encode},
+		{"write", c.Write},
+		{"verify", c.Verify},
+		{"upload", s.upload},
+		{"total", time.Since(s.started)},
+	}
+
+	fmt.Fprintln(os.Stderr, "Capture stats:")
+	for _, r := range rows {
+		if r.d == 0 && (r.name == "verify" || r.name == "upload") {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "  %-11s %9.1f ms\n", r.name, ms(r.d))
+	}
+	fmt.Fprintf(os.Stderr, "  %-11s %12s\n", "output", formatBytes(c.Bytes))
+	if rss := peakRSS(); rss > 0 {
+		fmt.Fprintf(os.Stderr, "  %-11s %12s\n", "peak memory", formatBytes(int64(rss)))
+	}
+}
+
+// formatBytes formats a size with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	v, suffix := float64(n)/unit, "KiB"
+	for _, s := range []string{"MiB", "GiB"} {
+		if v < unit {
+			break
+		}
+		v, suffix = v/unit, s
+	}
+	return fmt.Sprintf("%.1f %s", v, suffix)
+}
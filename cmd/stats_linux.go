@@ -0,0 +1,14 @@
+//go:build linux
+
+package cmd
+
+import "golang.org/x/sys/unix"
+
+// peakRSS returns the process's peak resident set size in bytes
+func peakRSS() uint64 {
+	var ru unix.Rusage
+	if err := unix.Getrusage(unix.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+	return uint64(ru.Maxrss) * 1024 // kilobytes on Linux
+}
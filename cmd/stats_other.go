@@ -0,0 +1,13 @@
+//go:build !linux
+
+package cmd
+
+import "runtime"
+
+// peakRSS approximates the peak memory use with the memory the Go runtime
+// has obtained from the system
+func peakRSS() uint64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.Sys
+}
@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/robotin/screenshot/internal/history"
+	"github.com/robotin/screenshot/internal/tiles"
+	"github.com/robotin/screenshot/internal/upload"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tileUpload bool
+	tileSize   int
+
+	tilesOutput string
+)
+
+// tileFetchTimeout bounds reading one manifest or tile over HTTP
+const tileFetchTimeout = 30 * time.Second
+
+var tilesCmd = &cobra.Command{
+	Use:   "tiles",
+	Short: "Reassemble captures uploaded with --tiles",
+	Long: `With --tiles, interval captures are uploaded as tiles: the screen is cut
+into squares, only the squares that changed since the last upload are
+sent, and a small manifest (<name>.tiles.json) lists the tiles of each
+frame. These commands put frames back together.
+
+Examples:
+  aws s3 sync s3://fleet/kiosk-7 frames/
+  screenshot tiles assemble frames/screenshot_2025-01-02_15-04-05.tiles.json
+  screenshot tiles assemble https://fleet.example.com/kiosk-7/screenshot_2025-01-02_15-04-05.tiles.json -o now.png
+  screenshot tiles serve frames/ --listen :8081`,
+}
+
+var tilesAssembleCmd = &cobra.Command{
+	Use:   "assemble <manifest>",
+	Short: "Rebuild a frame from its manifest and tiles",
+	Long: `Rebuild a frame from its manifest, a local file or an http(s) URL, reading
+the tiles from next to it. Writes <name>.png in the current directory
+unless -o is given ("-" for stdout).`,
+	Args: cobra.ExactArgs(1),
+	RunE: runTilesAssemble,
+}
+
+func init() {
+	tilesAssembleCmd.Flags().StringVarP(&tilesOutput, "output", "o", "", "Write the frame here (default: <name>.png)")
+	tilesCmd.AddCommand(tilesAssembleCmd)
+	rootCmd.AddCommand(tilesCmd)
+}
+
+// checkTileUpload validates --tiles against the other flags
+func checkTileUpload() error {
+	if uploadTarget == "" || !upload.IsObjectTarget(uploadTarget) {
+		return fmt.Errorf("--tiles requires --upload to object storage (s3://, gs:// or az://)")
+	}
+	if interval <= 0 {
+		return fmt.Errorf("--tiles only applies to --interval, --schedule and --cron")
+	}
+	if spoolUploads {
+		// A queued frame would name tiles the next frames assume were sent
+		return fmt.Errorf("--tiles cannot be combined with --spool")
+	}
+	if tileSize < 16 || tileSize > 4096 {
+		return fmt.Errorf("--tile-size must be from 16 to 4096 pixels")
+	}
+	return nil
+}
+
+// deliverTiles uploads the tiles of a frame not sent before, then its
+// manifest, so a manifest never names a missing tile, and finishes
+// delivering it as deliver does, with the manifest as the upload. If an
+// upload fails the frame is skipped; its unsent tiles go with the next.
+func (d *delivery) deliverTiles(item *resultItem, localPath string, img image.Image) error {
+	tmp, err := os.MkdirTemp("", "screenshot-tiles-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	m, pending := d.tiles.Frame(img, time.Now())
+	var size int64
+	for _, t := range pending {
+		file, err := tiles.WriteTile(tmp, t)
+		if err == nil {
+			_, err = uploadFile(d.uploader, file)
+		}
+		if err != nil {
+			return d.uploadFailed(*item, localPath, err)
+		}
+		d.tiles.Sent(t.Name)
+		if info, err := os.Stat(file); err == nil {
+			size += info.Size()
+		}
+		os.Remove(file)
+	}
+
+	base := filepath.Base(localPath)
+	manifest := filepath.Join(tmp, strings.TrimSuffix(base, filepath.Ext(base))+tiles.ManifestSuffix)
+	if err := tiles.WriteManifest(manifest, m); err != nil {
+		return err
+	}
+	res, err := uploadFile(d.uploader, manifest)
+	if err != nil {
+		return d.uploadFailed(*item, localPath, err)
+	}
+	infof("Uploaded %d of %d tiles (%s)", len(pending), len(m.Tiles), formatBytes(size))
+
+	item.URL = res.URL
+	return d.delivered(*item, localPath, &history.Upload{Target: d.target, Provider: res.Provider, URL: res.URL, ID: res.ID})
+}
+
+// tileClient fetches manifests and tiles given as http(s) URLs
+var tileClient = &http.Client{Timeout: tileFetchTimeout}
+
+// isURL reports whether a manifest location is an http(s) URL
+func isURL(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+// openLocation opens a local file or fetches an http(s) URL
+func openLocation(location string) (io.ReadCloser, error) {
+	if !isURL(location) {
+		return os.Open(location)
+	}
+	resp, err := tileClient.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", location, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// sibling returns the location of a file next to a manifest
+func sibling(manifest, name string) string {
+	if !isURL(manifest) {
+		return filepath.Join(filepath.Dir(manifest), name)
+	}
+	base, err := url.Parse(manifest)
+	if err != nil {
+		return name
+	}
+	return base.ResolveReference(&url.URL{Path: name}).String()
+}
+
+// assembleFrame reads a manifest, a local path or an http(s) URL, and
+// rebuilds its frame from the tiles next to it
+func assembleFrame(manifest string) (*tiles.Manifest, *image.RGBA, error) {
+	r, err := openLocation(manifest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read tile manifest: %w", err)
+	}
+	m, err := tiles.ReadManifest(r)
+	r.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	frame, err := tiles.Assemble(m, func(name string) (io.ReadCloser, error) {
+		return openLocation(sibling(manifest, name))
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, frame, nil
+}
+
+func runTilesAssemble(cmd *cobra.Command, args []string) error {
+	m, frame, err := assembleFrame(args[0])
+	if err != nil {
+		return err
+	}
+
+	out := tilesOutput
+	if out == "" {
+		name := args[0]
+		if u, err := url.Parse(name); err == nil && isURL(name) {
+			name = u.Path
+		}
+		out = strings.TrimSuffix(path.Base(filepath.ToSlash(name)), tiles.ManifestSuffix) + ".png"
+	}
+	if out == "-" {
+		return png.Encode(os.Stdout, frame)
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	if err := png.Encode(f, frame); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", out, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	infof("Frame of %s (%dx%d) written to %s", m.Time.Local().Format(time.DateTime), m.Width, m.Height, out)
+	return nil
+}
@@ -0,0 +1,160 @@
+//go:build !noserve && !minimal
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robotin/screenshot/internal/tiles"
+	"github.com/spf13/cobra"
+)
+
+var tilesListen string
+
+var tilesServeCmd = &cobra.Command{
+	Use:   "serve <dir>",
+	Short: "Serve reassembled frames from a directory of tiles over HTTP",
+	Long: `Serve the frames in a directory of manifests and tiles (e.g. a synced
+bucket), reassembled as PNG on request.
+
+Endpoints:
+  GET /latest.png        The newest frame
+  GET /frames            Frame names as JSON, oldest first
+  GET /frames/NAME.png   The frame of NAME.tiles.json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runTilesServe,
+}
+
+func init() {
+	tilesServeCmd.Flags().StringVar(&tilesListen, "listen", "127.0.0.1:8081", "Address to listen on")
+	tilesCmd.AddCommand(tilesServeCmd)
+}
+
+// frameNames lists the frames in dir, oldest first
+func frameNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	type frame struct {
+		name string
+		mod  time.Time
+	}
+	var frames []frame
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), tiles.ManifestSuffix)
+		if !ok || e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		frames = append(frames, frame{name, info.ModTime()})
+	}
+	sort.Slice(frames, func(i, j int) bool {
+		if !frames[i].mod.Equal(frames[j].mod) {
+			return frames[i].mod.Before(frames[j].mod)
+		}
+		return frames[i].name < frames[j].name
+	})
+	names := make([]string, len(frames))
+	for i, f := range frames {
+		names[i] = f.name
+	}
+	return names, nil
+}
+
+// tilesHandler serves the frames in dir
+func tilesHandler(dir string) http.Handler {
+	serveFrame := func(w http.ResponseWriter, name string) {
+		_, frame, err := assembleFrame(filepath.Join(dir, name+tiles.ManifestSuffix))
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "no such frame", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "no-store")
+		png.Encode(w, frame)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/latest.png", func(w http.ResponseWriter, r *http.Request) {
+		names, err := frameNames(dir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(names) == 0 {
+			http.Error(w, "no frames yet", http.StatusNotFound)
+			return
+		}
+		serveFrame(w, names[len(names)-1])
+	})
+	mux.HandleFunc("/frames", func(w http.ResponseWriter, r *http.Request) {
+		names, err := frameNames(dir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(append([]string{}, names...))
+	})
+	mux.HandleFunc("/frames/", func(w http.ResponseWriter, r *http.Request) {
+		name, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/frames/"), ".png")
+		if !ok || name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+			http.NotFound(w, r)
+			return
+		}
+		serveFrame(w, name)
+	})
+	return mux
+}
+
+func runTilesServe(cmd *cobra.Command, args []string) error {
+	dir := args[0]
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	srv := &http.Server{
+		Addr:              tilesListen,
+		Handler:           tilesHandler(dir),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	stop, stopNotify := notifyInterrupt()
+	defer stopNotify()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	fmt.Fprintf(os.Stderr, "Serving frames from %s on http://%s\n", dir, tilesListen)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-stop:
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package cmd
+
+import "os"
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
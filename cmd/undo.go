@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/robotin/screenshot/internal/history"
+	"github.com/robotin/screenshot/internal/upload"
+	"github.com/spf13/cobra"
+)
+
+var (
+	undoKeepUpload bool
+	undoTrashTTL   time.Duration
+)
+
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Move the most recent capture to the trash",
+	Long: `Move the most recent capture (from the history) to the trash directory
+and delete its upload, if the provider supports deletion.
+
+Running undo again goes one capture further back. Each undo also deletes
+trashed captures older than --trash-ttl.`,
+	Args: cobra.NoArgs,
+	RunE: runUndo,
+}
+
+func init() {
+	undoCmd.Flags().BoolVar(&undoKeepUpload, "keep-upload", false, "Don't delete the uploaded copy")
+	undoCmd.Flags().DurationVar(&undoTrashTTL, "trash-ttl", history.DefaultTrashTTL, "Delete trashed captures older than this")
+	rootCmd.AddCommand(undoCmd)
+}
+
+func runUndo(cmd *cobra.Command, args []string) error {
+	db, err := history.Open()
+	if err != nil {
+		return err
+	}
+	entries, err := db.Entries()
+	if err != nil {
+		return err
+	}
+
+	var last *history.Entry
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].TrashedAt == nil {
+			last = &entries[i]
+			break
+		}
+	}
+	if last == nil {
+		return errors.New("nothing to undo")
+	}
+
+	var trashPath string
+	if _, err := os.Stat(last.Path); err == nil {
+		if trashPath, err = history.MoveToTrash(last); err != nil {
+			return err
+		}
+		infof("Moved to trash: %s", last.Path)
+	} else {
+		fmt.Fprintf(os.Stderr, "File already gone: %s\n", last.Path)
+	}
+
+	if last.Upload != nil && !undoKeepUpload {
+		if err := deleteUpload(last.Upload); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		} else {
+			infof("Deleted upload: %s", last.Upload.URL)
+		}
+	}
+
+	now := time.Now()
+	err = db.Update(last.ID, func(e *history.Entry) {
+		e.TrashedAt = &now
+		e.TrashPath = trashPath
+	})
+	if err != nil {
+		return err
+	}
+
+	if n, err := history.ExpireTrash(undoTrashTTL); err == nil && n > 0 {
+		debugf("expired %d trashed capture(s)", n)
+	}
+	return nil
+}
+
+// deleteUpload removes an uploaded copy through its provider
+func deleteUpload(up *history.Upload) error {
+	u, err := upload.New(up.Target)
+	if err != nil {
+		return fmt.Errorf("cannot delete upload %s: %w", up.URL, err)
+	}
+	d, ok := u.(upload.Deleter)
+	if !ok {
+		return fmt.Errorf("cannot delete upload %s: %s does not support deletion", up.URL, u.Name())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+	defer cancel()
+	if err := d.Delete(ctx, &upload.Result{Provider: up.Provider, URL: up.URL, ID: up.ID}); err != nil {
+		return fmt.Errorf("failed to delete upload %s: %w", up.URL, err)
+	}
+	return nil
+}
+
+// recordHistory adds a delivered capture to the history and returns its
+// entry's ID. Failures are reported but never fail the capture.
+func recordHistory(item resultItem, uploaded *history.Upload) string {
+	if noHistory {
+		return ""
+	}
+
+	path := item.Path
+	if _, _, remote := upload.SplitObjectURI(path); !remote {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	}
+
+	e := &history.Entry{
+		Path:    path,
+		Format:  string(item.Format),
+		Width:   item.Width,
+		Height:  item.Height,
+		Monitor: item.Monitor,
+		Region:  item.Region,
+		Tags:    tags,
+		Upload:  uploaded,
+		Focus:   item.Focus,
+		Pointer: item.Pointer,
+	}
+	db, err := history.Open()
+	if err == nil {
+		err = db.Add(e)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to record history: %v\n", err)
+		return ""
+	}
+	if item.img != nil {
+		if err := history.SaveThumbnail(*e, item.img); err != nil {
+			debugf("history thumbnail: %v", err)
+		}
+	}
+	return e.ID
+}
@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/history"
+	"github.com/robotin/screenshot/internal/notify"
+	"github.com/robotin/screenshot/internal/spool"
+	"github.com/robotin/screenshot/internal/strategy"
+	"github.com/robotin/screenshot/internal/tiles"
+	"github.com/robotin/screenshot/internal/upload"
+)
+
+// uploadTimeout bounds a single upload, including token refresh
+const uploadTimeout = 5 * time.Minute
+
+// delivery is what happens to a capture after it is saved: the --upload
+// target, the --webhook notifier, the spool failed uploads wait in and
+// the --tiles state, any of which may be nil
+type delivery struct {
+	uploader upload.Uploader
+	target   string
+	webhook  *notify.Webhook
+	spool    *spool.Spool
+	tiles    *tiles.Tracker
+}
+
+// newDelivery sets up delivery from flags and the config. The upload
+// target is resolved here so typos fail before anything is captured.
+func newDelivery() (*delivery, error) {
+	if tileUpload {
+		if err := checkTileUpload(); err != nil {
+			return nil, err
+		}
+	}
+	sp, err := openSpool()
+	if err != nil {
+		return nil, err
+	}
+	d := &delivery{webhook: newWebhook(), spool: sp}
+	if uploadTarget != "" {
+		u, err := upload.New(uploadTarget)
+		if err != nil {
+			return nil, err
+		}
+		d.uploader = u
+		d.target = uploadTarget
+	}
+	if tileUpload {
+		d.tiles = tiles.NewTracker(tileSize)
+	}
+	return d, nil
+}
+
+// deliver uploads a saved capture (setting item.URL), sends the webhook
+// event, publishes --events and records the capture in the history and
+// the audit log.
+// localPath is the file on disk, which may differ from item.Path. An
+// upload failure is returned without notifying.
+//
+// With a spool, uploads that fail for a reason retrying may fix are
+// queued instead (setting item.Queued), and queued uploads go first.
+func (d *delivery) deliver(item *resultItem, localPath string) error {
+	if localPath == item.Path {
+		// Object storage output is only written by the upload
+		publishWritten(*item)
+	}
+	var uploaded *history.Upload
+	if d.uploader != nil {
+		var res *upload.Result
+		var err error
+		if d.spool != nil {
+			if res, err = d.uploadOrQueue(item, localPath); err == nil && res == nil {
+				publishUpload(*item, nil)
+				return nil
+			}
+		} else {
+			res, err = uploadFile(d.uploader, localPath)
+		}
+		if err != nil {
+			publishUpload(*item, err)
+			return d.uploadFailed(*item, localPath, err)
+		}
+		item.URL = res.URL
+		publishUpload(*item, nil)
+		uploaded = &history.Upload{Target: d.target, Provider: res.Provider, URL: res.URL, ID: res.ID}
+	}
+	return d.delivered(*item, localPath, uploaded)
+}
+
+// delivered sends the webhook event and records a capture that has been
+// uploaded, or needed no upload, in the history and the audit log
+func (d *delivery) delivered(item resultItem, localPath string, uploaded *history.Upload) error {
+	sendWebhook(d.webhook, item, localPath, tags)
+	recordHistory(item, uploaded)
+	return auditDelivery(item, localPath, d.target, nil)
+}
+
+// uploadFailed records a failed upload in the audit log and returns the
+// error
+func (d *delivery) uploadFailed(item resultItem, localPath string, err error) error {
+	if aerr := auditDelivery(item, localPath, d.target, err); aerr != nil {
+		return fmt.Errorf("%w; %w", err, aerr)
+	}
+	return err
+}
+
+// uploadFile sends a saved capture to an upload target
+func uploadFile(u upload.Uploader, path string) (*upload.Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+	defer cancel()
+
+	var size int64
+	if fi, err := os.Stat(path); err == nil {
+		size = fi.Size()
+	}
+	p := newProgress("upload", path, size)
+	defer p.finish()
+	ctx = upload.WithProgress(ctx, p.add)
+
+	debugf("uploading %s to %s", path, u.Name())
+	res, err := u.Upload(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("upload to %s failed: %w", u.Name(), err)
+	}
+	return res, nil
+}
+
+// runObjectOutput captures to a temporary file named name and uploads it
+// to an object storage target, for output paths like gs://bucket/shot.png
+func runObjectOutput(capturer *capture.Capturer, opts strategy.CaptureOptions, enc capture.EncodeOptions, outputPath, target, name string, d *delivery) error {
+	u, err := upload.New(target)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.MkdirTemp("", "screenshot-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	f, err := captureFrame(capturer, opts)
+	if err != nil {
+		return err
+	}
+	if enc.Format == capture.FormatAuto {
+		enc, outputPath = resolveFormat(f.img, enc, outputPath)
+		_, name, _ = upload.SplitObjectURI(outputPath)
+	}
+	img, enc, err := f.fitSize(enc)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(tmp, name)
+	if err := capture.Save(img, path, enc); err != nil {
+		return err
+	}
+
+	// The object storage target is the output itself, so it replaces
+	// --upload; the webhook and the spool still apply
+	out := &delivery{uploader: u, target: target, webhook: d.webhook, spool: d.spool}
+	result := f.result(outputPath, enc)
+	if err := out.deliver(&result.Items[0], path); err != nil {
+		return err
+	}
+	if copyClipboard {
+		if err := f.toClipboard(); err != nil {
+			return err
+		}
+		result.Items[0].Clipboard = true
+	}
+
+	if jsonOutput {
+		if err := printResult(result); err != nil {
+			return err
+		}
+	} else {
+		if !result.Items[0].Queued {
+			infof("Screenshot uploaded: %s", result.Items[0].URL)
+		}
+		infoAnalysis(result.Items[0])
+	}
+	if showOSD && result.Items[0].URL != "" {
+		osd(capturer, opts, result.Items[0].URL)
+	}
+	return nil
+}
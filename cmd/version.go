@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	rtdebug "runtime/debug"
+	"strings"
+
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/strategy"
+	"github.com/robotin/screenshot/internal/upload"
+	"github.com/spf13/cobra"
+)
+
+// version is set at link time by release builds:
+//
+//	go build -ldflags "-X github.com/robotin/screenshot/cmd.version=v1.4.0"
+//
+// Otherwise the module version from the build info is used.
+var version string
+
+var versionFull bool
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version and what this binary supports",
+	Long: `Print the version. With --full, also print the build details, the
+capture backends and encoders compiled into this binary (they depend on
+build tags such as nox11 and nosynthetic), the upload targets and the
+versions of the linked Go modules. Please include it in bug reports.
+
+Examples:
+  screenshot version
+  screenshot version --full
+  screenshot version --full --json`,
+	Args: cobra.NoArgs,
+	RunE: runVersion,
+}
+
+func init() {
+	versionCmd.Flags().BoolVar(&versionFull, "full", false, "Also print build info, backends, encoders and module versions")
+	versionCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the report as JSON")
+	rootCmd.AddCommand(versionCmd)
+}
+
+// buildReport is the version --full report
+type buildReport struct {
+	Version   string          `json:"version"`
+	Commit    string          `json:"commit,omitempty"`
+	Modified  bool            `json:"modified,omitempty"`
+	BuildTime string          `json:"build_time,omitempty"`
+	Go        string          `json:"go"`
+	Platform  string          `json:"platform"`
+	Tags      []string        `json:"tags,omitempty"`
+	CGO       bool            `json:"cgo"`
+	Backends  []backendReport `json:"backends,omitempty"`
+	Encoders  []string        `json:"encoders,omitempty"`
+	Uploads   []string        `json:"uploads,omitempty"`
+	Modules   []moduleReport  `json:"modules,omitempty"`
+}
+
+// moduleReport is a Go module linked into the binary
+type moduleReport struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+}
+
+// backendReport describes a compiled-in capture backend
+type backendReport struct {
+	Name string `json:"name"`
+
+	// Selection is auto (tried in priority order), explicit (--backend
+	// NAME only, or NAME:ARG if it takes an optional argument) or
+	// argument (--backend NAME:ARG)
+	Selection string `json:"selection"`
+
+	// Available is whether the backend can run here; unknown for
+	// backends that need an argument
+	Available *bool `json:"available,omitempty"`
+}
+
+func runVersion(cmd *cobra.Command, args []string) error {
+	r := newBuildReport(versionFull)
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+
+	// Pseudo-versions already contain the commit
+	line := "screenshot " + r.Version
+	if commit := r.Commit[:min(len(r.Commit), 12)]; commit != "" && !strings.Contains(r.Version, commit) {
+		if r.Modified {
+			commit += "-dirty"
+		}
+		line += " (" + commit + ")"
+	}
+	fmt.Printf("%s, %s %s\n", line, r.Go, r.Platform)
+	if !versionFull {
+		return nil
+	}
+
+	fmt.Println("\nBuild:")
+	if r.BuildTime != "" {
+		fmt.Printf("  commit time  %s\n", r.BuildTime)
+	}
+	tags := "none"
+	if len(r.Tags) > 0 {
+		tags = strings.Join(r.Tags, ",")
+	}
+	fmt.Printf("  tags         %s\n", tags)
+	fmt.Printf("  cgo          %t\n", r.CGO)
+
+	fmt.Println("\nBackends:")
+	for _, b := range r.Backends {
+		status := ""
+		if b.Available != nil {
+			status = "not available"
+			if *b.Available {
+				status = "available"
+			}
+		}
+		fmt.Println(strings.TrimRight(fmt.Sprintf("  %-10s %-9s %s", b.Name, b.Selection, status), " "))
+	}
+
+	fmt.Printf("\nEncoders: %s\n", strings.Join(r.Encoders, ", "))
+	uploads := "none"
+	if len(r.Uploads) > 0 {
+		uploads = strings.Join(r.Uploads, ", ")
+	}
+	fmt.Printf("Uploads:  %s\n", uploads)
+
+	fmt.Println("\nModules:")
+	for _, m := range r.Modules {
+		fmt.Printf("  %s %s\n", m.Path, m.Version)
+	}
+	return nil
+}
+
+// newBuildReport collects the version and, if full, the capability matrix
+func newBuildReport(full bool) buildReport {
+	r := buildReport{
+		Version:  version,
+		Go:       runtime.Version(),
+		Platform: runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	info, ok := rtdebug.ReadBuildInfo()
+	if ok {
+		if r.Version == "" {
+			r.Version = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				r.Commit = s.Value
+			case "vcs.modified":
+				r.Modified = s.Value == "true"
+			case "vcs.time":
+				r.BuildTime = s.Value
+			case "-tags":
+				r.Tags = strings.Split(s.Value, ",")
+			case "CGO_ENABLED":
+				r.CGO = s.Value == "1"
+			}
+		}
+	}
+	if r.Version == "" {
+		r.Version = "(devel)"
+	}
+	if !full {
+		return r
+	}
+
+	for _, reg := range strategy.Registered() {
+		b := backendReport{Name: reg.Name, Selection: "auto"}
+		switch {
+		case reg.TakesArg && !reg.ArgOptional:
+			b.Selection = "argument"
+		case reg.Explicit:
+			b.Selection = "explicit"
+		}
+		if !reg.TakesArg || reg.ArgOptional {
+			if s, err := strategy.Lookup(reg.Name); err == nil {
+				available := s.Available()
+				b.Available = &available
+			}
+		}
+		r.Backends = append(r.Backends, b)
+	}
+
+	for _, f := range capture.Formats() {
+		r.Encoders = append(r.Encoders, string(f))
+	}
+	r.Uploads = upload.Schemes()
+
+	if ok {
+		for _, dep := range info.Deps {
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			r.Modules = append(r.Modules, moduleReport{Path: dep.Path, Version: dep.Version})
+		}
+	}
+	return r
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/robotin/screenshot/internal/notify"
+)
+
+// webhookTimeout bounds delivery of one event, including retries
+const webhookTimeout = 30 * time.Second
+
+// newWebhook creates the --webhook notifier, or nil if not set
+func newWebhook() *notify.Webhook {
+	if webhookURL == "" {
+		return nil
+	}
+	secret := webhookSecret
+	if secret == "" {
+		secret = os.Getenv("SCREENSHOT_WEBHOOK_SECRET")
+	}
+	return &notify.Webhook{URL: webhookURL, Secret: []byte(secret)}
+}
+
+// sendWebhook reports a saved (and possibly uploaded) capture with its
+// tags. localPath is the file on disk, which may differ from item.Path
+// for object storage output. Delivery failures are reported but don't
+// fail the capture.
+func sendWebhook(hook *notify.Webhook, item resultItem, localPath string, tags []string) {
+	if hook == nil {
+		return
+	}
+
+	ev := notify.NewEvent(item.Path, item.URL, string(item.Format), item.Width, item.Height, tags)
+	ev.Analysis = item.Analysis
+	if f := item.Focus; f != nil {
+		ev.Focus = &notify.Focus{Window: f.Window, Class: f.Class, Title: f.Title, PID: f.PID}
+	}
+	if p := item.Pointer; p != nil {
+		ev.Pointer = &notify.Point{X: p.X, Y: p.Y}
+	}
+	if err := ev.Checksum(localPath); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	debugf("sending %s event for %s to webhook", ev.Type, item.Path)
+	if err := hook.Send(ctx, ev); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+}
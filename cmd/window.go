@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/robotin/screenshot/internal/xwin"
+)
+
+// findWindow looks up the window selected by --window: "active", an X
+// window ID (decimal or 0x hex) or a title/class pattern
+func findWindow(spec string) (*xwin.Window, error) {
+	conn, err := xwin.Connect(display)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var win *xwin.Window
+	if id, perr := strconv.ParseUint(spec, 0, 32); perr == nil {
+		win, err = conn.Window(uint32(id))
+	} else if spec == "active" {
+		win, err = conn.ActiveWindow()
+	} else {
+		win, err = conn.Find(spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if win == nil {
+		return nil, fmt.Errorf("no window matching %q", spec)
+	}
+	return win, nil
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/robotin/screenshot/internal/workflow"
+	"github.com/spf13/cobra"
+)
+
+var workflowVars []string
+
+var workflowCmd = &cobra.Command{
+	Use:   "run <workflow.yaml>",
+	Short: "Run a capture workflow file",
+	Long: `Run a sequence of steps described in a YAML workflow file.
+
+Steps (one action each):
+  set:      {name: value}            Set variables
+  sleep:    2s                       Pause
+  wait:     {window: Firefox, timeout: 30s}   Wait for a window to appear
+  capture:  {monitor, region, window, output, format, compress, verify}
+  annotate: [{rect|fill: x,y,w,h, text, at: x,y, color}]   Draw on the capture
+  upload:   imgur                    Upload the capture (any --upload target)
+  notify:   {webhook, secret, tags}  POST a webhook event
+  exec:     command                  Run a shell command
+
+Strings may use {placeholders}: the built-in date/host ones, the file's
+vars, --var overrides, and values set by earlier steps ({path}, {url},
+{width}, {height}, {window_title}, {window_class}, {window_id}). Exec
+commands get them as environment variables instead ($SCREENSHOT_PATH,
+$SCREENSHOT_URL, ...).
+
+Example:
+  vars:
+    app: Firefox
+  steps:
+    - wait: {window: "{app}", timeout: 1m}
+    - capture: {window: "{app}", output: "shots/{app}_{date}.png"}
+    - annotate:
+        - {text: "{host} {date} {time}", at: "10,10", background: white}
+    - upload: imgur
+    - exec: notify-send "Captured" "$SCREENSHOT_URL"`,
+	Args: cobra.ExactArgs(1),
+	RunE: runWorkflow,
+}
+
+func init() {
+	workflowCmd.Flags().StringArrayVar(&workflowVars, "var", nil, "Set a workflow variable (name=value, repeatable)")
+	workflowCmd.Flags().StringVarP(&display, "display", "d", "", "X11 display (default: $DISPLAY or :0)")
+	rootCmd.AddCommand(workflowCmd)
+}
+
+func runWorkflow(cmd *cobra.Command, args []string) error {
+	w, err := workflow.Load(args[0])
+	if err != nil {
+		return err
+	}
+
+	overrides := map[string]string{}
+	for _, kv := range workflowVars {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("invalid --var %q: expected name=value", kv)
+		}
+		overrides[name] = value
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if display != "" {
+		// Monitor names are looked up on $DISPLAY
+		os.Setenv("DISPLAY", display)
+	}
+
+	auditDestination = "workflow " + args[0]
+	capturer, err := newCapturer()
+	if err != nil {
+		return err
+	}
+
+	r := &workflow.Runner{Capturer: capturer, Display: display, Log: os.Stderr, Config: cfg}
+	return r.Run(ctx, w, overrides)
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/robotin/screenshot/internal/xwin"
+	"github.com/spf13/cobra"
+)
+
+var (
+	x11Socket string
+
+	// x11SocketDisplay exposes --x11-socket as a display, closed on exit
+	x11SocketDisplay *xwin.Socket
+
+	// removeXauth removes the Xauthority file written for a remote display
+	removeXauth = func() {}
+)
+
+// setupX11Socket points the display at the X server behind --x11-socket,
+// for this process and the commands it runs
+func setupX11Socket(cmd *cobra.Command) error {
+	if x11Socket == "" {
+		return nil
+	}
+	if f := cmd.Flags().Lookup("display"); f != nil && f.Changed {
+		return fmt.Errorf("--x11-socket and --display can't be combined")
+	}
+	if xvfbSize != "" {
+		return fmt.Errorf("--x11-socket and --xvfb can't be combined")
+	}
+	s, err := xwin.OpenSocket(x11Socket)
+	if err != nil {
+		return err
+	}
+	x11SocketDisplay = s
+	display = s.Display()
+	os.Setenv("DISPLAY", display)
+	debugf("X socket %s is display %s", x11Socket, display)
+	return nil
+}
+
+// closeXDisplay removes what setupX11Socket and setupRemoteDisplay set up
+func closeXDisplay() {
+	removeXauth()
+	if x11SocketDisplay != nil {
+		x11SocketDisplay.Close()
+		x11SocketDisplay = nil
+	}
+}
+
+// setupRemoteDisplay finds the cookie of a remote (TCP) display, so the
+// X clients of this process and the commands it runs can authenticate
+func setupRemoteDisplay() {
+	remove, err := xwin.AuthorizeRemote(display)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	removeXauth = remove
+}
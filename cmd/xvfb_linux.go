@@ -0,0 +1,11 @@
+//go:build linux
+
+package cmd
+
+import "syscall"
+
+// xvfbAttr makes the kernel stop Xvfb if this process dies without
+// cleaning up, e.g. killed by a CI timeout
+func xvfbAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM}
+}
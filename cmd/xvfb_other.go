@@ -0,0 +1,10 @@
+//go:build !linux
+
+package cmd
+
+import "syscall"
+
+// xvfbAttr has nothing to add outside Linux
+func xvfbAttr() *syscall.SysProcAttr {
+	return nil
+}
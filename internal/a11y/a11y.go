@@ -0,0 +1,246 @@
+//go:build !noa11y && !minimal
+
+package a11y
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/robotin/screenshot/internal/xwin"
+)
+
+const (
+	registryName    = "org.a11y.atspi.Registry"
+	rootPath        = "/org/a11y/atspi/accessible/root"
+	ifaceAccessible = "org.a11y.atspi.Accessible"
+	ifaceComponent  = "org.a11y.atspi.Component"
+
+	// coordTypeScreen asks Component.GetExtents for screen coordinates
+	coordTypeScreen uint32 = 0
+)
+
+// callTimeout bounds each D-Bus call
+const callTimeout = 2 * time.Second
+
+// ref identifies an accessible object: its bus name and object path
+type ref struct {
+	Name string
+	Path dbus.ObjectPath
+}
+
+// Client is a connection to the accessibility bus
+type Client struct {
+	conn *dbus.Conn
+}
+
+// Connect connects to the accessibility bus, found through
+// $AT_SPI_BUS_ADDRESS or the session bus
+func Connect() (*Client, error) {
+	addr := os.Getenv("AT_SPI_BUS_ADDRESS")
+	if addr == "" {
+		session, err := dbus.ConnectSessionBus()
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to the session bus: %w", err)
+		}
+		defer session.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+		defer cancel()
+		err = session.Object("org.a11y.Bus", "/org/a11y/bus").
+			CallWithContext(ctx, "org.a11y.Bus.GetAddress", 0).Store(&addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the accessibility bus (is at-spi2-core installed?): %w", err)
+		}
+	}
+
+	conn, err := dbus.Connect(addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the accessibility bus: %w", err)
+	}
+	return &Client{conn: conn}, nil
+}
+
+// Close closes the connection
+func (c *Client) Close() {
+	c.conn.Close()
+}
+
+// Dump reads the accessibility tree of an X window. The window is matched
+// to an application by _NET_WM_PID and to one of its frames by title or,
+// failing that, by position.
+func (c *Client) Dump(win xwin.Window) (*Tree, error) {
+	appName, frame, err := c.findFrame(win)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Tree{
+		Window:       win.ID,
+		Title:        win.Title,
+		Application:  appName,
+		PID:          win.PID,
+		Time:         time.Now(),
+		WindowBounds: toRect(win.Bounds),
+	}
+	if t.Root, err = c.walk(frame, win.Bounds.Min, 0, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// findFrame finds the accessible frame for win among the registered
+// applications
+func (c *Client) findFrame(win xwin.Window) (string, ref, error) {
+	apps, err := c.children(ref{registryName, rootPath})
+	if err != nil {
+		return "", ref{}, fmt.Errorf("failed to list accessible applications: %w", err)
+	}
+
+	// Prefer the applications owned by the window's process; fall back to
+	// all of them when the PID is unknown or differs (sandboxed apps)
+	candidates := apps
+	if win.PID != 0 {
+		var owned []ref
+		for _, app := range apps {
+			if c.busPID(app.Name) == win.PID {
+				owned = append(owned, app)
+			}
+		}
+		if len(owned) > 0 {
+			candidates = owned
+		}
+	}
+
+	type frame struct {
+		ref
+		appName string
+		overlap int
+	}
+	var frames []frame
+	for _, app := range candidates {
+		var appName string
+		c.prop(app, ifaceAccessible, "Name", &appName)
+		children, err := c.children(app)
+		if err != nil {
+			continue
+		}
+		for _, f := range children {
+			var name string
+			c.prop(f, ifaceAccessible, "Name", &name)
+			if name != "" && name == win.Title {
+				return appName, f, nil
+			}
+			area := 0
+			if r, ok := c.extents(f); ok {
+				if o := r.Intersect(win.Bounds); !o.Empty() {
+					area = o.Dx() * o.Dy()
+				}
+			}
+			frames = append(frames, frame{f, appName, area})
+		}
+	}
+
+	best := -1
+	for i, f := range frames {
+		if f.overlap > 0 && (best < 0 || f.overlap > frames[best].overlap) {
+			best = i
+		}
+	}
+	// A single frame of the window's own process needs no matching
+	if best < 0 && len(frames) == 1 && len(candidates) < len(apps) {
+		best = 0
+	}
+	if best < 0 {
+		return "", ref{}, fmt.Errorf("no accessibility tree for window 0x%x %q; is toolkit accessibility enabled?", win.ID, win.Title)
+	}
+	return frames[best].appName, frames[best].ref, nil
+}
+
+// walk reads an accessible and its descendants. Objects that fail to
+// answer are left with empty fields; only a timeout aborts the dump.
+func (c *Client) walk(r ref, origin image.Point, depth int, t *Tree) (*Node, error) {
+	n := &Node{}
+	t.Nodes++
+
+	if err := c.call(r, ifaceAccessible, "GetRoleName", &n.Role); errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("accessibility query timed out (application not responding?)")
+	}
+	c.prop(r, ifaceAccessible, "Name", &n.Name)
+	c.prop(r, ifaceAccessible, "Description", &n.Description)
+
+	var states []uint32
+	if c.call(r, ifaceAccessible, "GetState", &states) == nil {
+		n.States = stateNames(states)
+	}
+	var attrs map[string]string
+	if c.call(r, ifaceAccessible, "GetAttributes", &attrs) == nil && len(attrs) > 0 {
+		n.Attributes = attrs
+	}
+	if b, ok := c.extents(r); ok {
+		rect := toRect(b.Sub(origin))
+		n.Bounds = &rect
+	}
+
+	children, _ := c.children(r)
+	if depth >= MaxDepth && len(children) > 0 {
+		t.Truncated = true
+		return n, nil
+	}
+	for _, child := range children {
+		if t.Nodes >= MaxNodes {
+			t.Truncated = true
+			break
+		}
+		cn, err := c.walk(child, origin, depth+1, t)
+		if err != nil {
+			return nil, err
+		}
+		n.Children = append(n.Children, cn)
+	}
+	return n, nil
+}
+
+// call calls a method on an accessible and stores its result in out
+func (c *Client) call(r ref, iface, method string, out any, args ...any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	return c.conn.Object(r.Name, r.Path).CallWithContext(ctx, iface+"."+method, 0, args...).Store(out)
+}
+
+// prop reads a property of an accessible into out
+func (c *Client) prop(r ref, iface, name string, out any) error {
+	var v dbus.Variant
+	if err := c.call(r, "org.freedesktop.DBus.Properties", "Get", &v, iface, name); err != nil {
+		return err
+	}
+	return v.Store(out)
+}
+
+func (c *Client) children(r ref) ([]ref, error) {
+	var children []ref
+	err := c.call(r, ifaceAccessible, "GetChildren", &children)
+	return children, err
+}
+
+// extents returns an accessible's screen rectangle, if it has one
+func (c *Client) extents(r ref) (image.Rectangle, bool) {
+	var e struct{ X, Y, Width, Height int32 }
+	if err := c.call(r, ifaceComponent, "GetExtents", &e, coordTypeScreen); err != nil || e.Width <= 0 || e.Height <= 0 {
+		return image.Rectangle{}, false
+	}
+	return image.Rect(int(e.X), int(e.Y), int(e.X+e.Width), int(e.Y+e.Height)), true
+}
+
+// busPID returns the process owning a bus name, or 0
+func (c *Client) busPID(name string) uint32 {
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	var pid uint32
+	c.conn.BusObject().CallWithContext(ctx, "org.freedesktop.DBus.GetConnectionUnixProcessID", 0, name).Store(&pid)
+	return pid
+}
@@ -0,0 +1,29 @@
+//go:build noa11y || minimal
+
+package a11y
+
+import (
+	"errors"
+
+	"github.com/robotin/screenshot/internal/xwin"
+)
+
+// errNotCompiled is returned by builds without AT-SPI support, which
+// leave out the D-Bus library
+var errNotCompiled = errors.New("accessibility support is not compiled into this binary (built with -tags noa11y or minimal)")
+
+// Client stands in for the AT-SPI client
+type Client struct{}
+
+// Connect always fails: this build has no AT-SPI support
+func Connect() (*Client, error) {
+	return nil, errNotCompiled
+}
+
+// Close does nothing
+func (c *Client) Close() {}
+
+// Dump always fails: this build has no AT-SPI support
+func (c *Client) Dump(win xwin.Window) (*Tree, error) {
+	return nil, errNotCompiled
+}
@@ -0,0 +1,32 @@
+//go:build !noa11y && !minimal
+
+package a11y
+
+// stateNameList is AtspiStateType in bit order
+var stateNameList = []string{
+	"invalid", "active", "armed", "busy", "checked", "collapsed", "defunct",
+	"editable", "enabled", "expandable", "expanded", "focusable", "focused",
+	"has-tooltip", "horizontal", "iconified", "modal", "multi-line",
+	"multiselectable", "opaque", "pressed", "resizable", "selectable",
+	"selected", "sensitive", "showing", "single-line", "stale", "transient",
+	"vertical", "visible", "manages-descendants", "indeterminate", "required",
+	"truncated", "animated", "invalid-entry", "supports-autocompletion",
+	"selectable-text", "is-default", "visited", "checkable", "has-popup",
+	"read-only",
+}
+
+// stateNames decodes the state bit set returned by GetState
+func stateNames(words []uint32) []string {
+	var names []string
+	for w, bits := range words {
+		for b := 0; b < 32; b++ {
+			if bits&(1<<b) == 0 {
+				continue
+			}
+			if i := w*32 + b; i < len(stateNameList) {
+				names = append(names, stateNameList[i])
+			}
+		}
+	}
+	return names
+}
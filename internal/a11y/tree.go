@@ -0,0 +1,59 @@
+// Package a11y reads a window's accessibility tree over AT-SPI, the D-Bus
+// protocol GTK, Qt, Firefox and Chromium expose their widgets with
+package a11y
+
+import (
+	"image"
+	"time"
+)
+
+// Limits keep dumps of huge trees (browsers, spreadsheets) bounded
+const (
+	MaxDepth = 64
+	MaxNodes = 20000
+)
+
+// Rect is a rectangle in JSON-friendly form
+type Rect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+func toRect(r image.Rectangle) Rect {
+	return Rect{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+}
+
+// Node is an element of the accessibility tree
+type Node struct {
+	Role        string `json:"role"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	// States are AT-SPI state names (focused, checked, showing, ...)
+	States []string `json:"states,omitempty"`
+
+	// Bounds are relative to the window's top-left corner, i.e. pixel
+	// coordinates in the window capture
+	Bounds *Rect `json:"bounds,omitempty"`
+
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Children   []*Node           `json:"children,omitempty"`
+}
+
+// Tree is a window's accessibility tree
+type Tree struct {
+	Window       uint32    `json:"window"`
+	Title        string    `json:"title,omitempty"`
+	Application  string    `json:"application,omitempty"`
+	PID          uint32    `json:"pid,omitempty"`
+	Time         time.Time `json:"time"`
+	WindowBounds Rect      `json:"window_bounds"`
+	Nodes        int       `json:"nodes"`
+
+	// Truncated is set when MaxDepth or MaxNodes cut the tree short
+	Truncated bool `json:"truncated,omitempty"`
+
+	Root *Node `json:"root"`
+}
@@ -0,0 +1,176 @@
+// Package analyze summarizes a capture's colors, so monitoring can alert on
+// a screen that went black or white without receiving the image
+package analyze
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"sort"
+)
+
+const (
+	// maxSamples bounds the pixels looked at; larger images are sampled
+	// on a grid
+	maxSamples = 1 << 20
+
+	// dominantColors is how many dominant colors are reported at most
+	dominantColors = 5
+
+	// minShare is the smallest share of the image a dominant color has
+	minShare = 0.01
+
+	// blankTolerance is how far a pixel's channels may be from the
+	// dominant color to count toward the blank score, for dithering and
+	// compression noise
+	blankTolerance = 12
+
+	// BlankThreshold is the blank score from which a capture is blank
+	BlankThreshold = 0.99
+)
+
+// Blank verdicts
+const (
+	Black = "black"
+	White = "white"
+	Solid = "solid"
+)
+
+// Result is the analysis of a capture
+type Result struct {
+	// Dominant lists the most common colors, most common first
+	Dominant []Color `json:"dominant"`
+
+	// Luminance is the average relative luminance, 0 (black) to 1 (white)
+	Luminance float64 `json:"luminance"`
+
+	// BlankScore is the share of the image close to its dominant color:
+	// 1 for a single solid color
+	BlankScore float64 `json:"blank_score"`
+
+	// Blank is black, white or solid when the blank score reaches
+	// BlankThreshold
+	Blank string `json:"blank,omitempty"`
+}
+
+// Color is a dominant color: the average of the pixels that quantize to it
+type Color struct {
+	Hex   string  `json:"hex"`
+	Share float64 `json:"share"`
+}
+
+// bucket sums the pixels of one quantized color
+type bucket struct {
+	n       int
+	r, g, b int
+}
+
+// Image analyzes img
+func Image(img image.Image) Result {
+	rgba, ok := img.(*image.RGBA)
+	if !ok {
+		b := img.Bounds()
+		rgba = image.NewRGBA(b)
+		draw.Draw(rgba, b, img, b.Min, draw.Src)
+	}
+	b := rgba.Rect
+	if b.Empty() {
+		return Result{Dominant: []Color{}}
+	}
+	step := max(1, int(math.Ceil(math.Sqrt(float64(b.Dx()*b.Dy())/maxSamples))))
+
+	// 4 bits per channel: close shades share a bucket
+	buckets := make([]bucket, 1<<12)
+	var lum float64
+	samples := 0
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		row := rgba.Pix[rgba.PixOffset(b.Min.X, y):]
+		for x := 0; x < b.Dx(); x += step {
+			r, g, bl := int(row[4*x]), int(row[4*x+1]), int(row[4*x+2])
+			k := &buckets[r>>4<<8|g>>4<<4|bl>>4]
+			k.n++
+			k.r += r
+			k.g += g
+			k.b += bl
+			lum += 0.2126*float64(r) + 0.7152*float64(g) + 0.0722*float64(bl)
+			samples++
+		}
+	}
+
+	order := make([]int, 0, len(buckets))
+	for i, k := range buckets {
+		if k.n > 0 {
+			order = append(order, i)
+		}
+	}
+	sort.Slice(order, func(i, j int) bool { return buckets[order[i]].n > buckets[order[j]].n })
+
+	res := Result{Dominant: []Color{}, Luminance: round(lum / float64(samples) / 255)}
+	for _, i := range order[:min(dominantColors, len(order))] {
+		k := buckets[i]
+		share := float64(k.n) / float64(samples)
+		if share < minShare && len(res.Dominant) > 0 {
+			break
+		}
+		res.Dominant = append(res.Dominant, Color{
+			Hex:   fmt.Sprintf("#%02x%02x%02x", k.r/k.n, k.g/k.n, k.b/k.n),
+			Share: round(share),
+		})
+	}
+
+	// The blank score counts pixels near the top color rather than its
+	// bucket, which a solid color on a bucket edge would split
+	top := buckets[order[0]]
+	tr, tg, tb := top.r/top.n, top.g/top.n, top.b/top.n
+	near := 0
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		row := rgba.Pix[rgba.PixOffset(b.Min.X, y):]
+		for x := 0; x < b.Dx(); x += step {
+			if abs(int(row[4*x])-tr) <= blankTolerance && abs(int(row[4*x+1])-tg) <= blankTolerance &&
+				abs(int(row[4*x+2])-tb) <= blankTolerance {
+				near++
+			}
+		}
+	}
+	res.BlankScore = round(float64(near) / float64(samples))
+	if res.BlankScore >= BlankThreshold {
+		switch l := (0.2126*float64(tr) + 0.7152*float64(tg) + 0.0722*float64(tb)) / 255; {
+		case l < 0.05:
+			res.Blank = Black
+		case l > 0.95:
+			res.Blank = White
+		default:
+			res.Blank = Solid
+		}
+	}
+	return res
+}
+
+// String summarizes the result on one line
+func (r Result) String() string {
+	s := ""
+	for i, c := range r.Dominant {
+		if i > 0 {
+			s += " "
+		}
+		s += fmt.Sprintf("%s (%.0f%%)", c.Hex, 100*c.Share)
+	}
+	s = fmt.Sprintf("dominant %s, luminance %.2f, blank score %.2f", s, r.Luminance, r.BlankScore)
+	if r.Blank != "" {
+		s += fmt.Sprintf(" (%s screen)", r.Blank)
+	}
+	return s
+}
+
+// round keeps 3 decimals, enough for shares and scores in JSON
+func round(f float64) float64 {
+	return math.Round(f*1000) / 1000
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
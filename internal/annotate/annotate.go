@@ -0,0 +1,371 @@
+// Package annotate draws simple markup (boxes, arrows, redactions,
+// labels, numbered callouts) onto captures
+package annotate
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+
+	"github.com/robotin/screenshot/internal/strategy"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Op is a single drawing operation. Exactly one of Rect, Arrow, Fill,
+// Text, Label or Stamp is set. Coordinates are relative to the image's top-left
+// corner.
+type Op struct {
+	// Rect outlines a box "x,y,width,height"
+	Rect string `yaml:"rect,omitempty" json:"rect,omitempty"`
+
+	// Arrow draws an arrow "x1,y1,x2,y2" pointing at x2,y2
+	Arrow string `yaml:"arrow,omitempty" json:"arrow,omitempty"`
+
+	// Fill paints a solid box "x,y,width,height" (e.g. to redact)
+	Fill string `yaml:"fill,omitempty" json:"fill,omitempty"`
+
+	// Text draws a label with its top-left corner at At ("x,y")
+	Text string `yaml:"text,omitempty" json:"text,omitempty"`
+	At   string `yaml:"at,omitempty" json:"at,omitempty"`
+
+	// Label draws a numbered callout: short text in a disc centered on At
+	Label string `yaml:"label,omitempty" json:"label,omitempty"`
+
+	// Stamp draws a named vector stamp (check, cross, star, smile, ...,
+	// see Stamps) or its emoji, Size pixels wide (default
+	// DefaultStampSize), centered on At. A "bubble" stamp is a speech
+	// bubble around Text with its tail pointing at At.
+	Stamp string `yaml:"stamp,omitempty" json:"stamp,omitempty"`
+
+	// Color is a name (red, green, blue, yellow, black, white) or #rrggbb.
+	// Default: red, or black for fills.
+	Color string `yaml:"color,omitempty" json:"color,omitempty"`
+
+	// Background is painted behind text (default: none) and fills a
+	// bubble (default: white). A label's text is white or black,
+	// whichever stands out on Color.
+	Background string `yaml:"background,omitempty" json:"background,omitempty"`
+
+	// Width is the outline or arrow thickness in pixels (default 3)
+	Width int `yaml:"width,omitempty" json:"width,omitempty"`
+
+	// Scale magnifies the built-in 7x13 font (default 2)
+	Scale int `yaml:"scale,omitempty" json:"scale,omitempty"`
+
+	// Font and Size draw Text with a TrueType font instead: a family
+	// found with fontconfig or a font file (default DefaultFont), Size
+	// pixels tall (default DefaultTextSize)
+	Font string  `yaml:"font,omitempty" json:"font,omitempty"`
+	Size float64 `yaml:"size,omitempty" json:"size,omitempty"`
+}
+
+var namedColors = map[string]color.RGBA{
+	"red":    {0xe0, 0x20, 0x20, 0xff},
+	"green":  {0x20, 0xb0, 0x40, 0xff},
+	"blue":   {0x20, 0x60, 0xe0, 0xff},
+	"yellow": {0xff, 0xd0, 0x00, 0xff},
+	"black":  {0x00, 0x00, 0x00, 0xff},
+	"white":  {0xff, 0xff, 0xff, 0xff},
+}
+
+// ParseColor parses a color name or #rrggbb
+func ParseColor(s string) (color.RGBA, error) {
+	if c, ok := namedColors[strings.ToLower(s)]; ok {
+		return c, nil
+	}
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 6 {
+		if v, err := strconv.ParseUint(hex, 16, 32); err == nil {
+			return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}, nil
+		}
+	}
+	return color.RGBA{}, fmt.Errorf("invalid color %q", s)
+}
+
+// Apply draws ops onto a copy of img
+func Apply(img image.Image, ops []Op) (*image.RGBA, error) {
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	for i, op := range ops {
+		if err := apply(dst, op); err != nil {
+			return nil, fmt.Errorf("annotation %d: %w", i+1, err)
+		}
+	}
+	return dst, nil
+}
+
+// shape is an op with its defaults filled in and its coordinates parsed
+type shape struct {
+	kind  string // "rect", "arrow", "fill", "text", "label" or "stamp"
+	box   image.Rectangle
+	from  image.Point // arrow tail; at is its tip
+	at    image.Point
+	text  string
+	color color.RGBA
+	bg    *color.RGBA
+	width int
+	scale int
+
+	// face is set for text in a TrueType font
+	face font.Face
+	font string
+	size float64 // also a stamp's width
+
+	stamp string
+}
+
+// resolve checks an op and fills in its defaults
+func resolve(op Op) (shape, error) {
+	var s shape
+	var err error
+	switch {
+	case op.Rect != "":
+		s.kind = "rect"
+		if s.box, err = box(op.Rect); err != nil {
+			return s, err
+		}
+		if s.color, err = opColor(op.Color, "red"); err != nil {
+			return s, err
+		}
+		s.width = op.Width
+		if s.width <= 0 {
+			s.width = 3
+		}
+		s.width = min(s.width, s.box.Dx()/2+1, s.box.Dy()/2+1)
+
+	case op.Arrow != "":
+		s.kind = "arrow"
+		if s.from, s.at, err = line(op.Arrow); err != nil {
+			return s, err
+		}
+		if s.color, err = opColor(op.Color, "red"); err != nil {
+			return s, err
+		}
+		s.width = op.Width
+		if s.width <= 0 {
+			s.width = 3
+		}
+
+	case op.Fill != "":
+		s.kind = "fill"
+		if s.box, err = box(op.Fill); err != nil {
+			return s, err
+		}
+		if s.color, err = opColor(op.Color, "black"); err != nil {
+			return s, err
+		}
+
+	case op.Stamp != "":
+		s.kind, s.text = "stamp", op.Text
+		if s.stamp, err = stampName(op.Stamp); err != nil {
+			return s, err
+		}
+		if s.stamp == "bubble" && s.text == "" {
+			return s, errors.New("a bubble needs text")
+		}
+		if s.at, err = point(op.At); err != nil {
+			return s, err
+		}
+		if s.color, err = opColor(op.Color, stampColors[s.stamp]); err != nil {
+			return s, err
+		}
+		s.size = op.Size
+		if s.size <= 0 {
+			s.size = DefaultStampSize
+		}
+		s.scale = op.Scale
+		if s.scale <= 0 {
+			s.scale = 2
+		}
+		if op.Background != "" {
+			b, err := ParseColor(op.Background)
+			if err != nil {
+				return s, err
+			}
+			s.bg = &b
+		}
+
+	case op.Text != "":
+		s.kind, s.text = "text", op.Text
+		s.at = image.Point{10, 10}
+		if op.At != "" {
+			if s.at, err = point(op.At); err != nil {
+				return s, err
+			}
+		}
+		if s.color, err = opColor(op.Color, "red"); err != nil {
+			return s, err
+		}
+		s.scale = op.Scale
+		if s.scale <= 0 {
+			s.scale = 2
+		}
+		if op.Font != "" || op.Size > 0 {
+			s.font, s.size = op.Font, op.Size
+			if s.font == "" {
+				s.font = DefaultFont
+			}
+			if s.size <= 0 {
+				s.size = DefaultTextSize
+			}
+			if s.face, err = loadFace(s.font, s.size); err != nil {
+				return s, err
+			}
+		}
+		if op.Background != "" {
+			b, err := ParseColor(op.Background)
+			if err != nil {
+				return s, err
+			}
+			s.bg = &b
+		}
+
+	case op.Label != "":
+		s.kind, s.text = "label", op.Label
+		if s.at, err = point(op.At); err != nil {
+			return s, err
+		}
+		if s.color, err = opColor(op.Color, "red"); err != nil {
+			return s, err
+		}
+		s.scale = op.Scale
+		if s.scale <= 0 {
+			s.scale = 2
+		}
+
+	default:
+		return s, errors.New("needs one of rect, arrow, fill, text, label or stamp")
+	}
+	return s, nil
+}
+
+// apply draws one op
+func apply(dst *image.RGBA, op Op) error {
+	s, err := resolve(op)
+	if err != nil {
+		return err
+	}
+	origin := dst.Bounds().Min
+
+	switch s.kind {
+	case "rect":
+		outline(dst, s.box.Add(origin), s.color, s.width)
+	case "fill":
+		draw.Draw(dst, s.box.Add(origin), image.NewUniform(s.color), image.Point{}, draw.Src)
+	case "text":
+		if s.face != nil {
+			ttfLabel(dst, s.at.Add(origin), s.text, s.face, s.color, s.bg)
+		} else {
+			label(dst, s.at.Add(origin), s.text, s.color, s.bg, s.scale)
+		}
+	case "arrow":
+		shaft, head := arrowShape(s)
+		fillPolygon(dst, offset(shaft, origin), s.color)
+		fillPolygon(dst, offset(head, origin), s.color)
+	case "stamp":
+		for _, p := range stampParts(s) {
+			fillPolygon(dst, offset(p.poly, origin), p.color)
+		}
+		if s.stamp == "bubble" {
+			_, at := bubbleShape(s)
+			label(dst, at.Add(origin), s.text, s.color, nil, s.scale)
+		}
+	case "label":
+		center, r := calloutDisc(s)
+		fillDisc(dst, center.Add(origin), r, s.color)
+		text := contrasting(s.color)
+		label(dst, calloutText(s).Add(origin), s.text, text, nil, s.scale)
+	}
+	return nil
+}
+
+// opColor parses c, or def when empty
+func opColor(c, def string) (color.RGBA, error) {
+	if c == "" {
+		c = def
+	}
+	return ParseColor(c)
+}
+
+// box parses "x,y,width,height"
+func box(s string) (image.Rectangle, error) {
+	r, err := strategy.ParseRegion(s)
+	if err != nil {
+		return image.Rectangle{}, fmt.Errorf("invalid box %q: %w", s, err)
+	}
+	return *r, nil
+}
+
+// point parses "x,y"
+func point(s string) (image.Point, error) {
+	xs, ys, ok := strings.Cut(s, ",")
+	x, errX := strconv.Atoi(strings.TrimSpace(xs))
+	y, errY := strconv.Atoi(strings.TrimSpace(ys))
+	if !ok || errX != nil || errY != nil {
+		return image.Point{}, fmt.Errorf("invalid point %q: expected x,y", s)
+	}
+	return image.Point{x, y}, nil
+}
+
+// outline draws the border of r, width pixels thick, inside r
+func outline(dst *image.RGBA, r image.Rectangle, c color.RGBA, width int) {
+	src := image.NewUniform(c)
+	for _, edge := range []image.Rectangle{
+		image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+width),
+		image.Rect(r.Min.X, r.Max.Y-width, r.Max.X, r.Max.Y),
+		image.Rect(r.Min.X, r.Min.Y, r.Min.X+width, r.Max.Y),
+		image.Rect(r.Max.X-width, r.Min.Y, r.Max.X, r.Max.Y),
+	} {
+		draw.Draw(dst, edge, src, image.Point{}, draw.Src)
+	}
+}
+
+// label draws text with the built-in bitmap font magnified by scale
+func label(dst *image.RGBA, at image.Point, text string, c color.RGBA, bg *color.RGBA, scale int) {
+	face := basicfont.Face7x13
+	lines := strings.Split(text, "\n")
+
+	// Render at 1x into a mask, then blow it up with nearest neighbour
+	lineHeight := face.Metrics().Height.Ceil()
+	mask := image.NewAlpha(image.Rectangle{Max: labelSize(lines)})
+	d := &font.Drawer{Dst: mask, Src: image.Opaque, Face: face}
+	for i, line := range lines {
+		d.Dot = fixed.P(1, 1+face.Ascent+i*lineHeight)
+		d.DrawString(line)
+	}
+
+	mb := mask.Bounds()
+	area := image.Rect(at.X, at.Y, at.X+mb.Dx()*scale, at.Y+mb.Dy()*scale)
+	if bg != nil {
+		draw.Draw(dst, area.Inset(-scale), image.NewUniform(*bg), image.Point{}, draw.Src)
+	}
+
+	src := image.NewUniform(c)
+	for y := 0; y < mb.Dy(); y++ {
+		for x := 0; x < mb.Dx(); x++ {
+			if mask.AlphaAt(x, y).A < 0x80 {
+				continue
+			}
+			px := image.Rect(at.X+x*scale, at.Y+y*scale, at.X+(x+1)*scale, at.Y+(y+1)*scale)
+			draw.Draw(dst, px, src, image.Point{}, draw.Src)
+		}
+	}
+}
+
+// labelSize is the size of a label's text at 1x, with a pixel of margin
+// on each side
+func labelSize(lines []string) image.Point {
+	face := basicfont.Face7x13
+	width := 0
+	for _, line := range lines {
+		width = max(width, font.MeasureString(face, line).Ceil())
+	}
+	return image.Pt(width+2, face.Metrics().Height.Ceil()*len(lines)+2)
+}
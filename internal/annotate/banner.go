@@ -0,0 +1,62 @@
+package annotate
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+
+	"golang.org/x/image/font/basicfont"
+)
+
+// bannerMargin is the share of the width and height kept clear around a
+// banner's text
+const bannerMargin = 0.1
+
+// Banner renders text centered on a size image of color bg, with the
+// built-in font in c at the largest scale that fits, wrapping lines at
+// spaces (or anywhere, for long words) as needed
+func Banner(size image.Point, text string, c, bg color.RGBA) *image.RGBA {
+	dst := image.NewRGBA(image.Rectangle{Max: size})
+	draw.Draw(dst, dst.Rect, image.NewUniform(bg), image.Point{}, draw.Src)
+
+	room := image.Pt(int(float64(size.X)*(1-2*bannerMargin)), int(float64(size.Y)*(1-2*bannerMargin)))
+	var lines []string
+	var text1x image.Point
+	scale := max(1, room.Y/labelSize([]string{""}).Y)
+	for ; scale >= 1; scale-- {
+		lines = lines[:0]
+		for _, line := range strings.Split(text, "\n") {
+			lines = append(lines, wrap(line, max(1, room.X/(basicfont.Face7x13.Advance*scale)))...)
+		}
+		if text1x = labelSize(lines); text1x.X*scale <= room.X && text1x.Y*scale <= room.Y {
+			break
+		}
+	}
+	scale = max(1, scale)
+
+	at := image.Pt((size.X-text1x.X*scale)/2, (size.Y-text1x.Y*scale)/2)
+	label(dst, at, strings.Join(lines, "\n"), c, nil, scale)
+	return dst
+}
+
+// wrap splits line into lines of at most width characters, at spaces
+// where it can
+func wrap(line string, width int) []string {
+	var lines []string
+	r := []rune(line)
+	for len(r) > width {
+		cut := width
+		for cut > 0 && r[cut] != ' ' {
+			cut--
+		}
+		if cut == 0 {
+			lines = append(lines, string(r[:width]))
+			r = r[width:]
+			continue
+		}
+		lines = append(lines, string(r[:cut]))
+		r = r[cut+1:]
+	}
+	return append(lines, string(r))
+}
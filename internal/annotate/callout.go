@@ -0,0 +1,194 @@
+package annotate
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParseBox parses a --box value "x,y,width,height[:color]"
+func ParseBox(spec string) (Op, error) {
+	b, c := cutColor(spec)
+	return checked(Op{Rect: b, Color: c})
+}
+
+// ParseArrow parses an --arrow value "x1,y1,x2,y2[:color]"
+func ParseArrow(spec string) (Op, error) {
+	a, c := cutColor(spec)
+	return checked(Op{Arrow: a, Color: c})
+}
+
+// ParseLabel parses a --label value "text@x,y[:color]", a numbered
+// callout centered on x,y
+func ParseLabel(spec string) (Op, error) {
+	i := strings.LastIndex(spec, "@")
+	if i <= 0 {
+		return Op{}, fmt.Errorf("invalid label %q: expected text@x,y", spec)
+	}
+	at, c := cutColor(spec[i+1:])
+	return checked(Op{Label: spec[:i], At: at, Color: c})
+}
+
+// ParseText parses a --text value "text@x,y[,size[,color]]", drawn in
+// the TrueType font fontName (default DefaultFont) with its top-left
+// corner at x,y
+func ParseText(spec, fontName string) (Op, error) {
+	i := strings.LastIndex(spec, "@")
+	if i <= 0 {
+		return Op{}, fmt.Errorf("invalid text %q: expected text@x,y[,size[,color]]", spec)
+	}
+	op := Op{Text: spec[:i], Font: fontName, Size: DefaultTextSize}
+	fields := strings.Split(spec[i+1:], ",")
+	if len(fields) < 2 || len(fields) > 4 {
+		return Op{}, fmt.Errorf("invalid text %q: expected text@x,y[,size[,color]]", spec)
+	}
+	op.At = fields[0] + "," + fields[1]
+	if len(fields) > 2 && fields[2] != "" {
+		size, err := strconv.ParseFloat(strings.TrimSpace(fields[2]), 64)
+		if err != nil || size <= 0 || size > 1000 {
+			return Op{}, fmt.Errorf("invalid text size %q", fields[2])
+		}
+		op.Size = size
+	}
+	if len(fields) > 3 {
+		op.Color = strings.TrimSpace(fields[3])
+	}
+	return checked(op)
+}
+
+// cutColor splits an optional ":color" off the end of a flag value
+func cutColor(spec string) (string, string) {
+	if i := strings.LastIndex(spec, ":"); i >= 0 {
+		return spec[:i], spec[i+1:]
+	}
+	return spec, ""
+}
+
+// checked returns op if it can be drawn
+func checked(op Op) (Op, error) {
+	if _, err := resolve(op); err != nil {
+		return Op{}, err
+	}
+	return op, nil
+}
+
+// line parses "x1,y1,x2,y2"
+func line(s string) (from, to image.Point, err error) {
+	var x1, y1, x2, y2 int
+	if _, err := fmt.Sscanf(strings.ReplaceAll(s, " ", ""), "%d,%d,%d,%d", &x1, &y1, &x2, &y2); err != nil {
+		return from, to, fmt.Errorf("invalid arrow %q: expected x1,y1,x2,y2", s)
+	}
+	if x1 == x2 && y1 == y2 {
+		return from, to, errors.New("arrow has no length")
+	}
+	return image.Pt(x1, y1), image.Pt(x2, y2), nil
+}
+
+// vec is a point with fractional coordinates
+type vec struct{ X, Y float64 }
+
+// arrowShape returns an arrow's shaft and head as polygons. The head is
+// four times as long as the shaft is thick, cut short for tiny arrows.
+func arrowShape(s shape) (shaft, head []vec) {
+	from := vec{float64(s.from.X), float64(s.from.Y)}
+	to := vec{float64(s.at.X), float64(s.at.Y)}
+	dx, dy := to.X-from.X, to.Y-from.Y
+	length := math.Hypot(dx, dy)
+	ux, uy := dx/length, dy/length // along the arrow
+	nx, ny := -uy, ux              // across it
+
+	w := float64(s.width)
+	headLen := math.Min(math.Max(4*w, 10), length)
+	headHalf := headLen * 0.6
+	base := vec{to.X - ux*headLen, to.Y - uy*headLen}
+
+	shaft = []vec{
+		{from.X + nx*w/2, from.Y + ny*w/2},
+		{base.X + nx*w/2, base.Y + ny*w/2},
+		{base.X - nx*w/2, base.Y - ny*w/2},
+		{from.X - nx*w/2, from.Y - ny*w/2},
+	}
+	head = []vec{
+		to,
+		{base.X + nx*headHalf, base.Y + ny*headHalf},
+		{base.X - nx*headHalf, base.Y - ny*headHalf},
+	}
+	return shaft, head
+}
+
+// offset moves a polygon by p
+func offset(poly []vec, p image.Point) []vec {
+	moved := make([]vec, len(poly))
+	for i, v := range poly {
+		moved[i] = vec{v.X + float64(p.X), v.Y + float64(p.Y)}
+	}
+	return moved
+}
+
+// fillPolygon paints the pixels whose centers are inside poly
+func fillPolygon(dst *image.RGBA, poly []vec, c color.RGBA) {
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, v := range poly {
+		minY, maxY = math.Min(minY, v.Y), math.Max(maxY, v.Y)
+	}
+
+	src := image.NewUniform(c)
+	var xs []float64
+	for y := int(math.Floor(minY)); y <= int(math.Ceil(maxY)); y++ {
+		yc := float64(y) + 0.5
+		xs = xs[:0]
+		for i, a := range poly {
+			b := poly[(i+1)%len(poly)]
+			if (a.Y <= yc) != (b.Y <= yc) {
+				xs = append(xs, a.X+(yc-a.Y)*(b.X-a.X)/(b.Y-a.Y))
+			}
+		}
+		sort.Float64s(xs)
+		for i := 0; i+1 < len(xs); i += 2 {
+			x0 := int(math.Ceil(xs[i] - 0.5))
+			x1 := int(math.Ceil(xs[i+1] - 0.5))
+			draw.Draw(dst, image.Rect(x0, y, x1, y+1), src, image.Point{}, draw.Src)
+		}
+	}
+}
+
+// calloutDisc returns the center and radius of a label's disc, which
+// fits its text with a margin
+func calloutDisc(s shape) (image.Point, int) {
+	size := labelSize(strings.Split(s.text, "\n")).Mul(s.scale)
+	return s.at, max(size.X, size.Y)/2 + s.scale
+}
+
+// calloutText returns where a label's text goes to be centered in its
+// disc
+func calloutText(s shape) image.Point {
+	size := labelSize(strings.Split(s.text, "\n")).Mul(s.scale)
+	return s.at.Sub(size.Div(2))
+}
+
+// fillDisc paints the pixels whose centers are within r of center
+func fillDisc(dst *image.RGBA, center image.Point, r int, c color.RGBA) {
+	src := image.NewUniform(c)
+	cx, cy, rf := float64(center.X), float64(center.Y), float64(r)
+	for y := center.Y - r; y < center.Y+r; y++ {
+		dy := float64(y) + 0.5 - cy
+		dx := math.Sqrt(rf*rf - dy*dy)
+		x0 := int(math.Ceil(cx - dx - 0.5))
+		x1 := int(math.Ceil(cx + dx - 0.5))
+		draw.Draw(dst, image.Rect(x0, y, x1, y+1), src, image.Point{}, draw.Src)
+	}
+}
+
+// contrasting returns white or black, whichever reads better on c
+func contrasting(c color.RGBA) color.RGBA {
+	if 299*int(c.R)+587*int(c.G)+114*int(c.B) > 160_000 {
+		return color.RGBA{0, 0, 0, 0xff}
+	}
+	return color.RGBA{0xff, 0xff, 0xff, 0xff}
+}
@@ -0,0 +1,190 @@
+package annotate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// DefaultFont is the family used when Op.Font is empty. If fontconfig
+// can't find one, text is drawn with Go Regular, built into the binary,
+// so it works in containers without any fonts installed.
+const DefaultFont = "sans-serif"
+
+// DefaultTextSize is the font size in pixels of --text annotations
+const DefaultTextSize = 24
+
+// fontDirs are searched for a font file when fontconfig isn't installed
+var fontDirs = []string{
+	"/usr/share/fonts",
+	"/usr/local/share/fonts",
+	"~/.local/share/fonts",
+	"~/.fonts",
+	"/Library/Fonts",
+	"/System/Library/Fonts",
+}
+
+var (
+	fontsMu sync.Mutex
+	fonts   = map[string]*opentype.Font{}
+)
+
+// loadFace returns a face for the named font (a family, a fontconfig
+// pattern or a .ttf/.otf/.ttc file) at size pixels. Faces aren't safe
+// for concurrent use, so each call gets its own; parsed fonts are
+// cached.
+func loadFace(name string, size float64) (font.Face, error) {
+	if name == "" {
+		name = DefaultFont
+	}
+
+	fontsMu.Lock()
+	f, ok := fonts[name]
+	fontsMu.Unlock()
+	if !ok {
+		var err error
+		if f, err = findFont(name); err != nil {
+			return nil, err
+		}
+		fontsMu.Lock()
+		fonts[name] = f
+		fontsMu.Unlock()
+	}
+
+	return opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+}
+
+// findFont locates and parses a font. Only the default falls back to
+// the built-in font: a named one that is missing is an error, rather
+// than output that silently looks different.
+func findFont(name string) (*opentype.Font, error) {
+	path := name
+	if !isFontFile(name) {
+		path = matchFont(name)
+	}
+	if path == "" {
+		if name == DefaultFont {
+			return opentype.Parse(goregular.TTF)
+		}
+		return nil, fmt.Errorf("font %q not found (install fontconfig, or give a .ttf file)", name)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read font: %w", err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".ttc") {
+		c, err := opentype.ParseCollection(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid font %s: %w", path, err)
+		}
+		return c.Font(0)
+	}
+	f, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid font %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// isFontFile reports whether name is a font file rather than a family
+func isFontFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".ttf", ".otf", ".ttc":
+		return true
+	}
+	return false
+}
+
+// matchFont asks fontconfig for the file of a family, falling back to
+// the first file in the usual font directories whose name contains the
+// family's. Returns "" if there is none.
+func matchFont(name string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "fc-match", "--format=%{file}", name).Output()
+	if path := string(bytes.TrimSpace(out)); err == nil && isFontFile(path) {
+		return path
+	}
+
+	// Without fontconfig, generic families only match by luck
+	want := strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(name))
+	home, _ := os.UserHomeDir()
+	var found string
+	for _, dir := range fontDirs {
+		if rest, ok := strings.CutPrefix(dir, "~/"); ok {
+			if home == "" {
+				continue
+			}
+			dir = filepath.Join(home, rest)
+		}
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			base := strings.ToLower(strings.ReplaceAll(d.Name(), "-", ""))
+			if !d.IsDir() && isFontFile(path) && strings.Contains(base, want) {
+				found = path
+				return fs.SkipAll
+			}
+			return nil
+		})
+		if found != "" {
+			return found
+		}
+	}
+	return ""
+}
+
+// ttfLabel draws text in a TrueType face with its top-left corner at at,
+// antialiased, over an optional background with a small margin
+func ttfLabel(dst *image.RGBA, at image.Point, text string, face font.Face, c color.RGBA, bg *color.RGBA) {
+	lines := strings.Split(text, "\n")
+	m := face.Metrics()
+	if bg != nil {
+		draw.Draw(dst, ttfBackground(face, at, lines), image.NewUniform(*bg), image.Point{}, draw.Src)
+	}
+
+	d := &font.Drawer{Dst: dst, Src: image.NewUniform(c), Face: face}
+	for i, line := range lines {
+		d.Dot = fixed.P(at.X, at.Y+m.Ascent.Ceil()+i*m.Height.Ceil())
+		d.DrawString(line)
+	}
+}
+
+// ttfBackground is the area behind text in a TrueType face: its size
+// with a margin of a sixth of the line height
+func ttfBackground(face font.Face, at image.Point, lines []string) image.Rectangle {
+	width := 0
+	for _, line := range lines {
+		width = max(width, font.MeasureString(face, line).Ceil())
+	}
+	m := face.Metrics()
+	height := (len(lines)-1)*m.Height.Ceil() + m.Ascent.Ceil() + m.Descent.Ceil()
+	margin := max(2, m.Height.Ceil()/6)
+	return image.Rect(at.X, at.Y, at.X+width, at.Y+height).Inset(-margin)
+}
+
+// fontFamily is the CSS font family of a font name: font files are
+// named after the file
+func fontFamily(name string) string {
+	if isFontFile(name) {
+		return strings.TrimSuffix(filepath.Base(name), filepath.Ext(name)) + ", sans-serif"
+	}
+	return name
+}
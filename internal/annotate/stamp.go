@@ -0,0 +1,247 @@
+package annotate
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+)
+
+// DefaultStampSize is the width in pixels of a stamp
+const DefaultStampSize = 48
+
+// stampColors lists the stamps and their default colors. A bubble's
+// color is its outline and text; it is filled with Background.
+var stampColors = map[string]string{
+	"check":       "green",
+	"cross":       "red",
+	"arrow-up":    "red",
+	"arrow-down":  "red",
+	"arrow-left":  "red",
+	"arrow-right": "red",
+	"star":        "yellow",
+	"heart":       "red",
+	"smile":       "yellow",
+	"frown":       "yellow",
+	"warning":     "yellow",
+	"bubble":      "black",
+}
+
+// stampEmoji maps emoji to the stamp drawn for them. There is no color
+// emoji font to draw them with, so each is a vector shape like the rest.
+var stampEmoji = map[string]string{
+	"✅": "check", "✔": "check", "☑": "check",
+	"❌": "cross", "✖": "cross", "❎": "cross",
+	"⬆": "arrow-up", "⬇": "arrow-down", "⬅": "arrow-left", "➡": "arrow-right",
+	"👆": "arrow-up", "👇": "arrow-down", "👈": "arrow-left", "👉": "arrow-right",
+	"⭐": "star", "🌟": "star",
+	"❤": "heart", "♥": "heart",
+	"🙂": "smile", "😀": "smile", "😊": "smile",
+	"🙁": "frown", "☹": "frown", "😞": "frown",
+	"⚠": "warning",
+	"💬": "bubble", "🗨": "bubble",
+}
+
+// Stamps lists the stamp names
+func Stamps() []string {
+	names := make([]string, 0, len(stampColors))
+	for name := range stampColors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// stampName resolves a stamp name or emoji
+func stampName(s string) (string, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	if _, ok := stampColors[name]; ok {
+		return name, nil
+	}
+	// Emoji may carry a variation selector (❤️ is ❤ U+FE0F)
+	if e, ok := stampEmoji[strings.TrimSuffix(name, "\ufe0f")]; ok {
+		return e, nil
+	}
+	return "", fmt.Errorf("unknown stamp %q (expected %s, or one of their emoji)", s, strings.Join(Stamps(), ", "))
+}
+
+// ParseStamp parses a --stamp value "name@x,y[,size[,color]]", centered
+// on x,y. A bubble's text follows its name: "bubble:It fails here@x,y",
+// with the tail pointing at x,y.
+func ParseStamp(spec string) (Op, error) {
+	i := strings.LastIndex(spec, "@")
+	if i <= 0 {
+		return Op{}, fmt.Errorf("invalid stamp %q: expected name@x,y[,size[,color]]", spec)
+	}
+	name, text, _ := strings.Cut(spec[:i], ":")
+	op := Op{Stamp: name, Text: text}
+	fields := strings.Split(spec[i+1:], ",")
+	if len(fields) < 2 || len(fields) > 4 {
+		return Op{}, fmt.Errorf("invalid stamp %q: expected name@x,y[,size[,color]]", spec)
+	}
+	op.At = fields[0] + "," + fields[1]
+	if len(fields) > 2 && fields[2] != "" {
+		var size int
+		if _, err := fmt.Sscanf(strings.TrimSpace(fields[2]), "%d", &size); err != nil || size <= 0 || size > 4096 {
+			return Op{}, fmt.Errorf("invalid stamp size %q", fields[2])
+		}
+		op.Size = float64(size)
+	}
+	if len(fields) > 3 {
+		op.Color = strings.TrimSpace(fields[3])
+	}
+	return checked(op)
+}
+
+// part is a filled polygon of a stamp
+type part struct {
+	poly  []vec
+	color color.RGBA
+}
+
+// stampParts returns a stamp's shapes, drawn in order. Stamps are laid
+// out on a unit square centered on the stamp's position.
+func stampParts(s shape) []part {
+	k := s.size
+	c := vec{float64(s.at.X), float64(s.at.Y)}
+	p := func(x, y float64) vec { return vec{c.X + x*k, c.Y + y*k} }
+	black := color.RGBA{0, 0, 0, 0xff}
+
+	switch s.stamp {
+	case "check":
+		return filled(s.color, stroke(0.14*k, false, p(-0.35, 0.02), p(-0.1, 0.28), p(0.38, -0.3)))
+
+	case "cross":
+		return filled(s.color, append(
+			stroke(0.16*k, false, p(-0.3, -0.3), p(0.3, 0.3)),
+			stroke(0.16*k, false, p(-0.3, 0.3), p(0.3, -0.3))...))
+
+	case "arrow-up", "arrow-down", "arrow-left", "arrow-right":
+		angle := map[string]float64{"arrow-right": 0, "arrow-down": 90, "arrow-left": 180, "arrow-up": 270}[s.stamp]
+		sin, cos := math.Sincos(angle * math.Pi / 180)
+		var poly []vec
+		for _, v := range []vec{{-0.45, -0.12}, {0.05, -0.12}, {0.05, -0.32}, {0.45, 0}, {0.05, 0.32}, {0.05, 0.12}, {-0.45, 0.12}} {
+			poly = append(poly, p(v.X*cos-v.Y*sin, v.X*sin+v.Y*cos))
+		}
+		return []part{{poly, s.color}}
+
+	case "star":
+		var poly []vec
+		for i := 0; i < 10; i++ {
+			r := 0.5
+			if i%2 == 1 {
+				r = 0.2
+			}
+			a := float64(i)*math.Pi/5 - math.Pi/2
+			poly = append(poly, p(r*math.Cos(a), 0.05+r*math.Sin(a)))
+		}
+		return []part{{poly, s.color}}
+
+	case "heart":
+		var poly []vec
+		for i := 0; i < 48; i++ {
+			t := float64(i) * 2 * math.Pi / 48
+			x := 16 * math.Pow(math.Sin(t), 3)
+			y := 13*math.Cos(t) - 5*math.Cos(2*t) - 2*math.Cos(3*t) - math.Cos(4*t)
+			poly = append(poly, p(x/34, -y/34-0.03))
+		}
+		return []part{{poly, s.color}}
+
+	case "smile", "frown":
+		parts := []part{
+			{circle(c, 0.5*k), s.color},
+			{circle(p(-0.17, -0.12), 0.06*k), black},
+			{circle(p(0.17, -0.12), 0.06*k), black},
+		}
+		// The mouth is an arc of a circle below it or above it
+		var mouth []vec
+		for a := 25.0; a <= 155; a += 10 {
+			sin, cos := math.Sincos(a * math.Pi / 180)
+			if s.stamp == "smile" {
+				mouth = append(mouth, p(0.27*cos, 0.02+0.27*sin))
+			} else {
+				mouth = append(mouth, p(0.22*cos, 0.38-0.22*sin))
+			}
+		}
+		return append(parts, filled(black, stroke(0.06*k, false, mouth...))...)
+
+	case "warning":
+		return append([]part{
+			{[]vec{p(0, -0.46), p(0.5, 0.42), p(-0.5, 0.42)}, s.color},
+			{circle(p(0, 0.28), 0.055*k), black},
+		}, filled(black, stroke(0.09*k, false, p(0, -0.16), p(0, 0.14)))...)
+
+	case "bubble":
+		outline, _ := bubbleShape(s)
+		bg := color.RGBA{0xff, 0xff, 0xff, 0xff}
+		if s.bg != nil {
+			bg = *s.bg
+		}
+		return append([]part{{outline, bg}}, filled(s.color, stroke(float64(s.scale), true, outline...))...)
+	}
+	return nil
+}
+
+// bubbleShape returns a speech bubble's outline, around its text with
+// the tail's tip at the stamp's position, and where the text goes
+func bubbleShape(s shape) ([]vec, image.Point) {
+	size := labelSize(strings.Split(s.text, "\n")).Mul(s.scale)
+	pad, tail := 4*s.scale, 10*s.scale
+	tip := s.at
+	x0, y1 := tip.X-tail/2, tip.Y-tail
+	x1, y0 := x0+size.X+2*pad, y1-size.Y-2*pad
+
+	v := func(x, y int) vec { return vec{float64(x), float64(y)} }
+	outline := []vec{
+		v(x0, y0), v(x1, y0), v(x1, y1),
+		v(tip.X+tail, y1), v(tip.X, tip.Y), v(tip.X+tail/4, y1),
+		v(x0, y1),
+	}
+	return outline, image.Pt(x0+pad, y0+pad)
+}
+
+// filled gives polygons a color
+func filled(c color.RGBA, polys [][]vec) []part {
+	parts := make([]part, len(polys))
+	for i, poly := range polys {
+		parts[i] = part{poly, c}
+	}
+	return parts
+}
+
+// stroke returns the polygons of a line through points, w thick with
+// round joints and ends
+func stroke(w float64, closed bool, points ...vec) [][]vec {
+	var polys [][]vec
+	n := len(points) - 1
+	if closed {
+		n = len(points)
+	}
+	for i := 0; i < n; i++ {
+		a, b := points[i], points[(i+1)%len(points)]
+		dx, dy := b.X-a.X, b.Y-a.Y
+		length := math.Hypot(dx, dy)
+		if length == 0 {
+			continue
+		}
+		nx, ny := -dy/length*w/2, dx/length*w/2
+		polys = append(polys, []vec{{a.X + nx, a.Y + ny}, {b.X + nx, b.Y + ny}, {b.X - nx, b.Y - ny}, {a.X - nx, a.Y - ny}})
+	}
+	for _, pt := range points {
+		polys = append(polys, circle(pt, w/2))
+	}
+	return polys
+}
+
+// circle approximates a circle with a polygon
+func circle(center vec, r float64) []vec {
+	sides := int(math.Min(math.Max(r, 12), 64))
+	poly := make([]vec, sides)
+	for i := range poly {
+		sin, cos := math.Sincos(float64(i) * 2 * math.Pi / float64(sides))
+		poly[i] = vec{center.X + r*cos, center.Y + r*sin}
+	}
+	return poly
+}
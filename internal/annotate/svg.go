@@ -0,0 +1,169 @@
+package annotate
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+)
+
+// WriteSVG writes an SVG document of the given size embedding a PNG,
+// with ops on top as SVG elements instead of pixels, so an editor
+// (Inkscape, Illustrator, a browser's devtools) can still move, restyle
+// or reword them. The annotations are in a group with the id
+// "annotations", one element or group per op.
+func WriteSVG(w io.Writer, size image.Point, png []byte, ops []Op) error {
+	shapes := make([]shape, len(ops))
+	for i, op := range ops {
+		s, err := resolve(op)
+		if err != nil {
+			return fmt.Errorf("annotation %d: %w", i+1, err)
+		}
+		shapes[i] = s
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%d" height="%d" viewBox="0 0 %d %d">
+`, size.X, size.Y, size.X, size.Y)
+	fmt.Fprintf(bw, `  <image id="capture" x="0" y="0" width="%d" height="%d" style="image-rendering:pixelated" xlink:href="data:image/png;base64,`, size.X, size.Y)
+	enc := base64.NewEncoder(base64.StdEncoding, bw)
+	enc.Write(png)
+	enc.Close()
+	bw.WriteString("\"/>\n")
+
+	bw.WriteString("  <g id=\"annotations\">\n")
+	for i, s := range shapes {
+		writeShape(bw, i+1, s)
+	}
+	bw.WriteString("  </g>\n</svg>\n")
+	return bw.Flush()
+}
+
+// writeShape writes one annotation. Sizes match what Apply draws: text
+// uses a monospace font the size of the built-in bitmap font.
+func writeShape(w *bufio.Writer, n int, s shape) {
+	switch s.kind {
+	case "rect":
+		// SVG strokes are centered on the outline; Apply draws inside it
+		half := float64(s.width) / 2
+		fmt.Fprintf(w, `    <rect id="annotation-%d" x="%g" y="%g" width="%g" height="%g" fill="none" stroke="%s" stroke-width="%d"/>`+"\n",
+			n, float64(s.box.Min.X)+half, float64(s.box.Min.Y)+half, float64(s.box.Dx())-2*half, float64(s.box.Dy())-2*half, svgColor(s.color), s.width)
+
+	case "fill":
+		fmt.Fprintf(w, `    <rect id="annotation-%d" x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n",
+			n, s.box.Min.X, s.box.Min.Y, s.box.Dx(), s.box.Dy(), svgColor(s.color))
+
+	case "arrow":
+		shaft, head := arrowShape(s)
+		fmt.Fprintf(w, `    <g id="annotation-%d" fill="%s">`+"\n", n, svgColor(s.color))
+		fmt.Fprintf(w, `      <polygon points="%s"/>`+"\n", svgPoints(shaft))
+		fmt.Fprintf(w, `      <polygon points="%s"/>`+"\n", svgPoints(head))
+		w.WriteString("    </g>\n")
+
+	case "label":
+		center, r := calloutDisc(s)
+		fmt.Fprintf(w, `    <g id="annotation-%d">`+"\n", n)
+		fmt.Fprintf(w, `      <circle cx="%d" cy="%d" r="%d" fill="%s"/>`+"\n", center.X, center.Y, r, svgColor(s.color))
+		fmt.Fprintf(w, `      <text x="%d" y="%d" text-anchor="middle" dominant-baseline="central" font-family="monospace" font-size="%d" fill="%s">`,
+			center.X, center.Y, 12*s.scale, svgColor(contrasting(s.color)))
+		xml.EscapeText(w, []byte(strings.ReplaceAll(s.text, "\n", " ")))
+		w.WriteString("</text>\n    </g>\n")
+
+	case "text":
+		if s.face != nil {
+			ttfText(w, n, s)
+			return
+		}
+		lines := strings.Split(s.text, "\n")
+		size := labelSize(lines).Mul(s.scale)
+		fmt.Fprintf(w, `    <g id="annotation-%d">`+"\n", n)
+		if s.bg != nil {
+			fmt.Fprintf(w, `      <rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n",
+				s.at.X-s.scale, s.at.Y-s.scale, size.X+2*s.scale, size.Y+2*s.scale, svgColor(*s.bg))
+		}
+		bitmapText(w, s.at, lines, s.scale, s.color)
+		w.WriteString("    </g>\n")
+
+	case "stamp":
+		fmt.Fprintf(w, `    <g id="annotation-%d">`+"\n", n)
+		for _, p := range stampParts(s) {
+			fmt.Fprintf(w, `      <polygon points="%s" fill="%s"/>`+"\n", svgPoints(p.poly), svgColor(p.color))
+		}
+		if s.stamp == "bubble" {
+			_, at := bubbleShape(s)
+			bitmapText(w, at, strings.Split(s.text, "\n"), s.scale, s.color)
+		}
+		w.WriteString("    </g>\n")
+	}
+}
+
+// bitmapText writes text drawn in the built-in font at at. The bitmap
+// font is 7x13 with its baseline 11 pixels down, after a pixel of margin.
+func bitmapText(w *bufio.Writer, at image.Point, lines []string, scale int, c color.RGBA) {
+	fmt.Fprintf(w, `      <text x="%d" y="%d" font-family="monospace" font-size="%d" fill="%s" xml:space="preserve">`,
+		at.X+scale, at.Y+12*scale, 12*scale, svgColor(c))
+	for i, line := range lines {
+		dy := 0
+		if i > 0 {
+			dy = 13 * scale
+		}
+		fmt.Fprintf(w, `<tspan x="%d" dy="%d">`, at.X+scale, dy)
+		xml.EscapeText(w, []byte(line))
+		w.WriteString("</tspan>")
+	}
+	w.WriteString("</text>\n")
+}
+
+// ttfText writes text in a TrueType font
+func ttfText(w *bufio.Writer, n int, s shape) {
+	lines := strings.Split(s.text, "\n")
+	m := s.face.Metrics()
+	fmt.Fprintf(w, `    <g id="annotation-%d">`+"\n", n)
+	if s.bg != nil {
+		r := ttfBackground(s.face, s.at, lines)
+		fmt.Fprintf(w, `      <rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n",
+			r.Min.X, r.Min.Y, r.Dx(), r.Dy(), svgColor(*s.bg))
+	}
+	w.WriteString(`      <text font-family="`)
+	xml.EscapeText(w, []byte(fontFamily(s.font)))
+	fmt.Fprintf(w, `" font-size="%g" fill="%s" xml:space="preserve">`, s.size, svgColor(s.color))
+	for i, line := range lines {
+		fmt.Fprintf(w, `<tspan x="%d" y="%d">`, s.at.X, s.at.Y+m.Ascent.Ceil()+i*m.Height.Ceil())
+		xml.EscapeText(w, []byte(line))
+		w.WriteString("</tspan>")
+	}
+	w.WriteString("</text>\n    </g>\n")
+}
+
+// svgPoints formats a polygon's points attribute
+func svgPoints(poly []vec) string {
+	points := make([]string, len(poly))
+	for i, v := range poly {
+		points[i] = fmt.Sprintf("%.1f,%.1f", v.X, v.Y)
+	}
+	return strings.Join(points, " ")
+}
+
+// svgColor formats a color as #rrggbb
+func svgColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// SplitFills separates fills from the other ops. Fills are redactions,
+// so an SVG export burns them into the embedded image instead of laying
+// an element over pixels anyone could uncover.
+func SplitFills(ops []Op) (fills, rest []Op) {
+	for _, op := range ops {
+		if op.Fill != "" {
+			fills = append(fills, op)
+		} else {
+			rest = append(rest, op)
+		}
+	}
+	return fills, rest
+}
@@ -0,0 +1,159 @@
+// Package anonymize hides personal details in captures before they are
+// shared publicly: panels with the clock and tray, desktop icons and
+// faces
+package anonymize
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// DefaultRadius is the blur radius used when a profile sets none
+const DefaultRadius = 12
+
+// Profile is what to hide in a capture. Areas are in screen coordinates.
+type Profile struct {
+	// Redact areas are blacked out
+	Redact []image.Rectangle
+
+	// Blur areas are blurred, except where a Keep area covers them: this
+	// blurs the desktop around windows without blurring the windows
+	Blur []image.Rectangle
+	Keep []image.Rectangle
+
+	// Faces masks the faces found by DetectFaces, with a solid color or,
+	// if BlurFaces is set, a blur strong enough that they can't be
+	// recognized
+	Faces     bool
+	BlurFaces bool
+
+	// Radius is the blur radius in pixels (default DefaultRadius)
+	Radius int
+}
+
+// Apply returns a copy of img, with the same bounds, with the profile
+// applied. origin is the screen position of img's top-left pixel.
+func Apply(img image.Image, origin image.Point, p Profile) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(b)
+	draw.Draw(out, b, img, b.Min, draw.Src)
+
+	// Screen areas as image areas
+	local := func(rs []image.Rectangle) []image.Rectangle {
+		var in []image.Rectangle
+		for _, r := range rs {
+			if r = r.Sub(origin).Add(b.Min).Intersect(b); !r.Empty() {
+				in = append(in, r)
+			}
+		}
+		return in
+	}
+
+	// Find faces before anything is blurred, which would hide them from
+	// the detector without hiding them from people
+	var faces []image.Rectangle
+	if p.Faces {
+		faces = DetectFaces(out)
+	}
+
+	radius := p.Radius
+	if radius <= 0 {
+		radius = DefaultRadius
+	}
+	if blur := local(p.Blur); len(blur) > 0 {
+		mask := image.NewAlpha(out.Rect)
+		var bounds image.Rectangle
+		for _, r := range blur {
+			draw.Draw(mask, r, image.Opaque, image.Point{}, draw.Src)
+			bounds = bounds.Union(r)
+		}
+		for _, r := range local(p.Keep) {
+			draw.Draw(mask, r, image.Transparent, image.Point{}, draw.Src)
+		}
+		blurred := boxBlur(out.SubImage(bounds).(*image.RGBA), radius)
+		draw.DrawMask(out, bounds, blurred, bounds.Min, mask, bounds.Min, draw.Over)
+	}
+
+	for _, r := range faces {
+		if p.BlurFaces {
+			// Scale the blur with the face so larger faces don't stay
+			// recognizable
+			blurred := boxBlur(out.SubImage(r).(*image.RGBA), max(radius, max(r.Dx(), r.Dy())/4))
+			draw.Draw(out, r, blurred, r.Min, draw.Src)
+			continue
+		}
+		draw.Draw(out, r, image.NewUniform(average(out, r)), image.Point{}, draw.Src)
+	}
+	black := image.NewUniform(color.Black)
+	for _, r := range local(p.Redact) {
+		draw.Draw(out, r, black, image.Point{}, draw.Src)
+	}
+	return out
+}
+
+// boxBlur returns a copy of img blurred with three passes of a box blur
+// in each direction, close to a Gaussian blur
+func boxBlur(img *image.RGBA, radius int) *image.RGBA {
+	b := img.Bounds()
+	src := image.NewRGBA(b)
+	draw.Draw(src, b, img, b.Min, draw.Src)
+	tmp := image.NewRGBA(b)
+	for pass := 0; pass < 3; pass++ {
+		blurLine(tmp, src, radius, true)
+		blurLine(src, tmp, radius, false)
+	}
+	return src
+}
+
+// blurLine box-blurs src into dst along rows (horizontal) or columns,
+// clamping at the edges
+func blurLine(dst, src *image.RGBA, radius int, horizontal bool) {
+	b := src.Bounds()
+	lines, n := b.Dy(), b.Dx()
+	if !horizontal {
+		lines, n = b.Dx(), b.Dy()
+	}
+	offset := func(line, i int) int {
+		if horizontal {
+			return src.PixOffset(b.Min.X+i, b.Min.Y+line)
+		}
+		return src.PixOffset(b.Min.X+line, b.Min.Y+i)
+	}
+	window := 2*radius + 1
+	for line := 0; line < lines; line++ {
+		var sum [4]int
+		for i := -radius; i <= radius; i++ {
+			o := offset(line, min(max(i, 0), n-1))
+			for c := 0; c < 4; c++ {
+				sum[c] += int(src.Pix[o+c])
+			}
+		}
+		for i := 0; i < n; i++ {
+			o := offset(line, i)
+			for c := 0; c < 4; c++ {
+				dst.Pix[o+c] = uint8(sum[c] / window)
+			}
+			out := offset(line, max(i-radius, 0))
+			in := offset(line, min(i+radius+1, n-1))
+			for c := 0; c < 4; c++ {
+				sum[c] += int(src.Pix[in+c]) - int(src.Pix[out+c])
+			}
+		}
+	}
+}
+
+// average returns the mean color of an area of img
+func average(img *image.RGBA, r image.Rectangle) color.RGBA {
+	var sum [3]int
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			o := img.PixOffset(x, y)
+			sum[0] += int(img.Pix[o])
+			sum[1] += int(img.Pix[o+1])
+			sum[2] += int(img.Pix[o+2])
+		}
+	}
+	n := max(r.Dx()*r.Dy(), 1)
+	return color.RGBA{uint8(sum[0] / n), uint8(sum[1] / n), uint8(sum[2] / n), 0xff}
+}
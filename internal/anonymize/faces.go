@@ -0,0 +1,117 @@
+package anonymize
+
+import (
+	"image"
+	"image/color"
+)
+
+// Face detector tuning, in blocks of faceBlock x faceBlock pixels
+const (
+	faceBlock = 4
+
+	// minFaceBlocks is the smallest face side (24 pixels)
+	minFaceBlocks = 6
+)
+
+// DetectFaces returns the areas of img that look like faces: skin colored
+// regions about as tall as they are wide, and not solid, since eyes,
+// eyebrows and mouths leave holes in them. It is a simple detector
+// that errs on the side of masking too much: orange or beige UI elements
+// with text on them may be taken for faces, and faces in unusual
+// lighting may be missed.
+func DetectFaces(img *image.RGBA) []image.Rectangle {
+	b := img.Bounds()
+	cols := (b.Dx() + faceBlock - 1) / faceBlock
+	rows := (b.Dy() + faceBlock - 1) / faceBlock
+	skin := make([]bool, cols*rows)
+	for by := 0; by < rows; by++ {
+		for bx := 0; bx < cols; bx++ {
+			r := image.Rect(bx*faceBlock, by*faceBlock, (bx+1)*faceBlock, (by+1)*faceBlock).Add(b.Min).Intersect(b)
+			n := 0
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				for x := r.Min.X; x < r.Max.X; x++ {
+					o := img.PixOffset(x, y)
+					if isSkin(img.Pix[o], img.Pix[o+1], img.Pix[o+2]) {
+						n++
+					}
+				}
+			}
+			skin[by*cols+bx] = n*2 >= r.Dx()*r.Dy()
+		}
+	}
+
+	var faces []image.Rectangle
+	seen := make([]bool, len(skin))
+	for i := range skin {
+		if !skin[i] || seen[i] {
+			continue
+		}
+
+		// Flood fill the skin region
+		var box image.Rectangle
+		count := 0
+		seen[i] = true
+		stack := []int{i}
+		for len(stack) > 0 {
+			j := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			x, y := j%cols, j/cols
+			box = box.Union(image.Rect(x, y, x+1, y+1))
+			count++
+			for _, n := range []image.Point{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+				if n.X < 0 || n.Y < 0 || n.X >= cols || n.Y >= rows {
+					continue
+				}
+				if k := n.Y*cols + n.X; skin[k] && !seen[k] {
+					seen[k] = true
+					stack = append(stack, k)
+				}
+			}
+		}
+
+		if looksLikeFace(skin, cols, box, count) {
+			// Grow the box by a sixth on each side for hair and chin
+			r := image.Rect(box.Min.X*faceBlock, box.Min.Y*faceBlock, box.Max.X*faceBlock, box.Max.Y*faceBlock)
+			r = r.Inset(-max(r.Dx(), r.Dy()) / 6)
+			faces = append(faces, r.Add(b.Min).Intersect(b))
+		}
+	}
+	return faces
+}
+
+// looksLikeFace checks a skin region's shape: a face is upright, mostly
+// filled, with a few holes (eyes, mouth) in its inner part
+func looksLikeFace(skin []bool, cols int, box image.Rectangle, count int) bool {
+	w, h := box.Dx(), box.Dy()
+	if w < minFaceBlocks || h < minFaceBlocks {
+		return false
+	}
+	if h*10 < w*9 || h > w*2 {
+		return false
+	}
+	if count*10 < w*h*4 {
+		return false
+	}
+
+	inner := box.Inset(max(w, h) / 5)
+	if inner.Empty() {
+		return false
+	}
+	holes := 0
+	for y := inner.Min.Y; y < inner.Max.Y; y++ {
+		for x := inner.Min.X; x < inner.Max.X; x++ {
+			if !skin[y*cols+x] {
+				holes++
+			}
+		}
+	}
+	area := inner.Dx() * inner.Dy()
+	return holes*100 >= area*3 && holes*2 <= area
+}
+
+// isSkin classifies a color as skin by its chroma, which varies much less
+// between skin tones than brightness does
+func isSkin(r, g, b uint8) bool {
+	y, cb, cr := color.RGBToYCbCr(r, g, b)
+	return y > 40 && cb >= 77 && cb <= 127 && cr >= 133 && cr <= 173
+}
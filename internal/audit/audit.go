@@ -0,0 +1,278 @@
+// Package audit keeps an append-only, tamper-evident log of captures:
+// who captured what, when, where it went and whether it worked. Each
+// record holds the hash of the one before it, so editing, inserting or
+// removing a record breaks the chain from there on.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/robotin/screenshot/internal/lock"
+)
+
+// Events
+const (
+	// EventCapture is a capture, successful or not
+	EventCapture = "capture"
+
+	// EventDeliver is a capture saved to a file or uploaded
+	EventDeliver = "deliver"
+)
+
+// ResultOK is the result of a successful event; failures hold the error
+const ResultOK = "ok"
+
+// Record is one line of the log
+type Record struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+
+	// Who: the user and process
+	Host    string `json:"host"`
+	User    string `json:"user"`
+	UID     int    `json:"uid"`
+	PID     int    `json:"pid"`
+	Command string `json:"command"`
+
+	// What happened: the captured area, where it went and the outcome
+	Event       string `json:"event"`
+	What        string `json:"what,omitempty"`
+	Destination string `json:"destination,omitempty"`
+	Result      string `json:"result"`
+
+	// Prev is the previous record's hash, empty for the first
+	Prev string `json:"prev"`
+}
+
+// hashSuffix ends every line: the hash of the line before it, which is
+// the record's JSON without its closing brace
+const hashSuffix = `,"hash":"`
+
+// Record lines are bounded: long commands and errors are truncated
+const (
+	maxLine    = 16 * 1024
+	maxCommand = 4096
+	maxResult  = 1024
+)
+
+// Log is an audit log file
+type Log struct {
+	path string
+}
+
+// Open returns the audit log at path. The file is created on the first
+// Append.
+func Open(path string) *Log {
+	return &Log{path: path}
+}
+
+// Path returns the log file path
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Append adds a record, filling in its sequence number, time, previous
+// hash and who made it. Concurrent appends from several processes are
+// serialized with a lock on the file.
+func (l *Log) Append(r Record) error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+		return fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+	if err := lock.File(f); err != nil {
+		return fmt.Errorf("failed to lock audit log: %w", err)
+	}
+	defer lock.Unlock(f)
+
+	last, err := lastLine(f)
+	if err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+	if last != nil {
+		prev, err := parseLine(last)
+		if err != nil {
+			return fmt.Errorf("audit log %s ends with a damaged record; move it aside to start a new chain: %w", l.path, err)
+		}
+		r.Seq, r.Prev = prev.Seq+1, prev.hash
+	} else {
+		r.Seq, r.Prev = 1, ""
+	}
+	fillIdentity(&r)
+
+	line, err := encode(r)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return f.Sync()
+}
+
+// fillIdentity sets the record's time and who fields if unset
+func fillIdentity(r *Record) {
+	if r.Time.IsZero() {
+		r.Time = time.Now().UTC()
+	}
+	if r.Host == "" {
+		r.Host, _ = os.Hostname()
+	}
+	r.UID = os.Getuid()
+	if r.User == "" {
+		if u, err := user.Current(); err == nil {
+			r.User = u.Username
+		} else {
+			r.User = strconv.Itoa(r.UID)
+		}
+	}
+	if r.PID == 0 {
+		r.PID = os.Getpid()
+	}
+}
+
+// encode returns a record's line, with its hash and a newline
+func encode(r Record) ([]byte, error) {
+	r.Command = truncate(r.Command, maxCommand)
+	r.Result = truncate(r.Result, maxResult)
+	body, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	body = body[:len(body)-1] // Without the closing brace
+	sum := sha256.Sum256(body)
+	line := append(body, hashSuffix...)
+	line = append(line, hex.EncodeToString(sum[:])...)
+	return append(line, "\"}\n"...), nil
+}
+
+// truncate shortens s to at most n bytes, on a rune boundary
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
+
+// line is a parsed record with its hash
+type line struct {
+	Record
+	hash string
+}
+
+// parseLine parses a record line and checks its hash
+func parseLine(b []byte) (*line, error) {
+	b = bytes.TrimSuffix(b, []byte("\n"))
+	i := bytes.LastIndex(b, []byte(hashSuffix))
+	if i < 0 || !bytes.HasSuffix(b, []byte(`"}`)) {
+		return nil, errors.New("not an audit record")
+	}
+	body, hash := b[:i], string(b[i+len(hashSuffix):len(b)-2])
+
+	var r Record
+	if err := json.Unmarshal(append(bytes.Clone(body), '}'), &r); err != nil {
+		return nil, fmt.Errorf("not an audit record: %w", err)
+	}
+	sum := sha256.Sum256(body)
+	if hex.EncodeToString(sum[:]) != hash {
+		return nil, errors.New("record does not match its hash")
+	}
+	return &line{Record: r, hash: hash}, nil
+}
+
+// lastLine returns the file's last line, nil if it is empty
+func lastLine(f *os.File) ([]byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size == 0 {
+		return nil, nil
+	}
+	n := min(size, int64(maxLine)+1)
+	buf := make([]byte, n)
+	if _, err := f.ReadAt(buf, size-n); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if buf[len(buf)-1] != '\n' {
+		// A write cut short
+		return buf, nil
+	}
+	buf = buf[:len(buf)-1]
+	if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+		buf = buf[i+1:]
+	} else if n < size {
+		return nil, errors.New("last record is too long")
+	}
+	return buf, nil
+}
+
+// Summary describes a verified log
+type Summary struct {
+	// Records is the number of records
+	Records int
+
+	// Head is the last record's hash: keeping a copy elsewhere makes
+	// later truncation or rewriting of the whole log detectable
+	Head string
+}
+
+// Verify reads a log and checks that every record matches its hash and
+// links to the one before it. If expect is set, one of the records must
+// have that hash.
+func Verify(r io.Reader, expect string) (*Summary, error) {
+	var s Summary
+	var prev *line
+	found := expect == ""
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), maxLine+1)
+	for n := 1; sc.Scan(); n++ {
+		l, err := parseLine(sc.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		switch {
+		case prev == nil && (l.Seq != 1 || l.Prev != ""):
+			return nil, fmt.Errorf("line %d: the log does not start at the first record (seq %d)", n, l.Seq)
+		case prev != nil && l.Prev != prev.hash:
+			return nil, fmt.Errorf("line %d: record does not follow the one before it (a record was changed, removed or inserted)", n)
+		case prev != nil && l.Seq != prev.Seq+1:
+			return nil, fmt.Errorf("line %d: sequence number %d follows %d", n, l.Seq, prev.Seq)
+		}
+		if l.hash == expect {
+			found = true
+		}
+		prev = l
+		s.Records++
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	if prev != nil {
+		s.Head = prev.hash
+	}
+	if !found {
+		return nil, fmt.Errorf("no record has hash %s: the log was truncated or replaced", expect)
+	}
+	return &s, nil
+}
@@ -0,0 +1,28 @@
+package capture
+
+import (
+	"image"
+
+	"github.com/robotin/screenshot/internal/anonymize"
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// SetAnonymizer sets a function returning what to hide in every capture
+// (--anonymize). It is called after each grab with the current monitor
+// layout, so panels and windows are found where they are at the time.
+func (c *Capturer) SetAnonymizer(profile func(monitors []strategy.Monitor) anonymize.Profile) {
+	c.anonymizer = profile
+}
+
+// anonymize applies the anonymization profile, if one is set
+func (c *Capturer) anonymize(img image.Image, opts strategy.CaptureOptions) (image.Image, error) {
+	if c.anonymizer == nil {
+		return img, nil
+	}
+
+	monitors, err := c.ListMonitors()
+	if err != nil {
+		return nil, err
+	}
+	return anonymize.Apply(img, Area(opts, monitors).Min, c.anonymizer(monitors)), nil
+}
@@ -0,0 +1,29 @@
+package capture
+
+import (
+	"fmt"
+
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// SetAudit sets a function called with the outcome of every capture,
+// successful or not, before the image is handed out. If it fails, the
+// capture fails too: nothing may be captured without a record of it.
+func (c *Capturer) SetAudit(fn func(opts strategy.CaptureOptions, err error) error) {
+	c.audit = fn
+}
+
+// Describe returns what a capture covers, for logs: "all monitors",
+// "monitor 1", "region 0,0 640x480" or "window 0x3a00007"
+func Describe(opts strategy.CaptureOptions) string {
+	switch {
+	case opts.WindowID != 0:
+		return fmt.Sprintf("window %#x", opts.WindowID)
+	case opts.Region != nil:
+		r := *opts.Region
+		return fmt.Sprintf("region %d,%d %dx%d", r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+	case opts.Monitor == -1:
+		return "all monitors"
+	}
+	return fmt.Sprintf("monitor %d", opts.Monitor)
+}
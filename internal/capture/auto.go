@@ -0,0 +1,101 @@
+package capture
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// FormatAuto picks PNG or a lossy format for each capture by its content
+// (see ChooseFormat). It is resolved before encoding, so it never names
+// a file's actual encoding.
+const FormatAuto Format = "auto"
+
+// Default AutoFormat thresholds
+const (
+	DefaultAutoMaxColors  = 4096
+	DefaultAutoPhotoShare = 0.5
+)
+
+// autoSamples bounds the pixels ChooseFormat looks at
+const autoSamples = 1 << 18
+
+// smoothStep is the largest difference between neighboring pixels, summed
+// over the channels, that counts as a gradient rather than an edge
+const smoothStep = 48
+
+// AutoFormat tunes how FormatAuto chooses
+type AutoFormat struct {
+	// MaxColors is the most colors a capture saved as PNG regardless of
+	// its content may have: UI and text use few (default
+	// DefaultAutoMaxColors)
+	MaxColors int
+
+	// PhotoShare is the share of neighboring pixels that differ slightly,
+	// as in photos, video and gradients, from which a capture is
+	// photographic (default DefaultAutoPhotoShare)
+	PhotoShare float64
+
+	// Photo is the format for photographic captures (default JPEG)
+	Photo Format
+}
+
+// ChooseFormat returns the format FormatAuto picks for img: PNG for UI,
+// text and anything with transparency, which lossy formats would blur or
+// drop, and a.Photo for photographic content, where PNG is several times
+// larger for no visible gain
+func ChooseFormat(img image.Image, a AutoFormat) Format {
+	if a.MaxColors <= 0 {
+		a.MaxColors = DefaultAutoMaxColors
+	}
+	if a.PhotoShare <= 0 {
+		a.PhotoShare = DefaultAutoPhotoShare
+	}
+	if a.Photo == "" {
+		a.Photo = FormatJPEG
+	}
+	if _, ok := encoders[a.Photo]; !ok {
+		return FormatPNG
+	}
+
+	b := img.Bounds()
+	if b.Empty() {
+		return FormatPNG
+	}
+	rgba, ok := img.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(b)
+		draw.Draw(rgba, b, img, b.Min, draw.Src)
+	}
+	if !rgba.Opaque() {
+		return FormatPNG
+	}
+
+	// Sample whole rows, so neighbors are neighbors on screen
+	step := max(1, int(math.Ceil(float64(b.Dx()*b.Dy())/autoSamples)))
+	colors := make(map[uint32]struct{}, 1024)
+	pairs, smooth := 0, 0
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		row := rgba.Pix[rgba.PixOffset(b.Min.X, y):]
+		for x := 0; x < b.Dx(); x++ {
+			p := row[4*x : 4*x+3]
+			if len(colors) <= a.MaxColors {
+				colors[uint32(p[0])<<16|uint32(p[1])<<8|uint32(p[2])] = struct{}{}
+			}
+			if x == 0 {
+				continue
+			}
+			q := row[4*x-4 : 4*x-1]
+			d := abs(int(p[0])-int(q[0])) + abs(int(p[1])-int(q[1])) + abs(int(p[2])-int(q[2]))
+			pairs++
+			if d > 0 && d <= smoothStep {
+				smooth++
+			}
+		}
+	}
+
+	if len(colors) <= a.MaxColors || pairs == 0 || float64(smooth)/float64(pairs) < a.PhotoShare {
+		return FormatPNG
+	}
+	return a.Photo
+}
@@ -0,0 +1,76 @@
+package capture
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/robotin/screenshot/internal/annotate"
+)
+
+// Background is what translucent pixels (e.g. from ARGB windows) are
+// composited onto: nothing, a solid color or a checkerboard
+type Background struct {
+	// Color is the solid background; nil means none or checker
+	Color *color.RGBA
+
+	// Checker composites onto a light gray checkerboard, as image editors
+	// show transparency
+	Checker bool
+}
+
+// checkerSize is the checkerboard square size in pixels
+const checkerSize = 8
+
+// ParseBackground parses a --background value: none, checker, a color
+// name or #rrggbb
+func ParseBackground(s string) (Background, error) {
+	switch s {
+	case "", "none":
+		return Background{}, nil
+	case "checker":
+		return Background{Checker: true}, nil
+	}
+	c, err := annotate.ParseColor(s)
+	if err != nil {
+		return Background{}, err
+	}
+	return Background{Color: &c}, nil
+}
+
+// Apply composites img onto the background. Opaque images and the empty
+// background return img unchanged, keeping the alpha channel.
+func (bg Background) Apply(img image.Image) image.Image {
+	if bg.Color == nil && !bg.Checker {
+		return img
+	}
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return img
+	}
+
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	if bg.Color != nil {
+		draw.Draw(dst, b, image.NewUniform(*bg.Color), image.Point{}, draw.Src)
+	} else {
+		light := image.NewUniform(color.RGBA{0xff, 0xff, 0xff, 0xff})
+		dark := image.NewUniform(color.RGBA{0xcc, 0xcc, 0xcc, 0xff})
+		for y := b.Min.Y; y < b.Max.Y; y += checkerSize {
+			for x := b.Min.X; x < b.Max.X; x += checkerSize {
+				src := light
+				if ((x-b.Min.X)/checkerSize+(y-b.Min.Y)/checkerSize)%2 == 1 {
+					src = dark
+				}
+				draw.Draw(dst, image.Rect(x, y, x+checkerSize, y+checkerSize).Intersect(b), src, image.Point{}, draw.Src)
+			}
+		}
+	}
+	draw.Draw(dst, b, img, b.Min, draw.Over)
+	return dst
+}
+
+// SetBackground sets the background translucent captures are composited
+// onto (default: none, keeping the alpha channel)
+func (c *Capturer) SetBackground(bg Background) {
+	c.background = bg
+}
@@ -1,39 +1,107 @@
 package capture
 
 import (
+	"errors"
 	"fmt"
 	"image"
 	"image/png"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/robotin/screenshot/internal/annotate"
+	"github.com/robotin/screenshot/internal/anonymize"
+	"github.com/robotin/screenshot/internal/document"
+	"github.com/robotin/screenshot/internal/events"
 	"github.com/robotin/screenshot/internal/strategy"
 )
 
 // Capturer handles screenshot capture with strategy selection
 type Capturer struct {
 	strategies []strategy.Strategy
+	retry      RetryPolicy
+	settle     SettlePolicy
+	exposure   ExposurePolicy
+	idle       IdlePolicy
+	exclude    func([]strategy.Monitor) []image.Rectangle
+	protected  ProtectedPolicy
+	overlay    OverlayPolicy
+	anonymizer func([]strategy.Monitor) anonymize.Profile
+	swapRB     SwapMode
+	background Background
+	document   document.Mode
+	annotate   []annotate.Op
+	scales     func([]strategy.Monitor) ([]float64, error)
+	feedback   func(area image.Rectangle)
+	limit      intervalLimit
+	audit      func(strategy.CaptureOptions, error) error
+	events     *events.Bus
 }
 
-// New creates a new Capturer with available strategies
+// RetryPolicy controls how failed captures are retried. Transient X errors
+// (BadMatch during VT switches, lock screen transitions) usually clear up
+// within a fraction of a second.
+type RetryPolicy struct {
+	// Retries is the number of extra attempts after the first failure
+	Retries int
+
+	// Delay before the first retry; doubled after each further attempt
+	Delay time.Duration
+
+	// OnRetry, if set, is called before each retry with the failed attempt
+	// number (1-based) and its error
+	OnRetry func(attempt int, err error)
+}
+
+// New creates a new Capturer with the available registered backends
 func New() *Capturer {
-	c := &Capturer{
-		strategies: []strategy.Strategy{},
+	c, _ := NewWithPriority(nil)
+	return c
+}
+
+// NewWithPriority creates a Capturer with the available registered
+// backends, trying those named in priority first
+func NewWithPriority(priority []string) (*Capturer, error) {
+	strategies, err := strategy.Ordered(priority)
+	if err != nil {
+		return nil, err
 	}
 
-	// Add X11 strategy for Linux
-	x11 := strategy.NewX11Strategy()
-	if x11.Available() {
-		c.strategies = append(c.strategies, x11)
+	c := &Capturer{}
+	for _, s := range strategies {
+		if s.Available() {
+			c.strategies = append(c.strategies, s)
+		}
 	}
+	return c, nil
+}
 
-	// TODO: Add Wayland strategy
-	// TODO: Add Windows strategy
-	// TODO: Add macOS strategy
+// NewWithBackend creates a Capturer that only uses the named backend
+func NewWithBackend(name string) (*Capturer, error) {
+	s, err := strategy.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Available() {
+		return nil, fmt.Errorf("backend %q is not available", name)
+	}
+	return &Capturer{strategies: []strategy.Strategy{s}}, nil
+}
 
-	return c
+// RecordFrames records every frame and monitor list the backends return
+// into dir, before exclusion zones are applied, for replay with
+// --backend replay:dir
+func (c *Capturer) RecordFrames(dir string) error {
+	for i, s := range c.strategies {
+		r, err := strategy.NewRecorder(s, dir)
+		if err != nil {
+			return err
+		}
+		c.strategies[i] = r
+	}
+	return nil
 }
 
 // GetStrategy returns the first available strategy
@@ -54,29 +122,124 @@ func (c *Capturer) ListStrategies() []string {
 }
 
 // CaptureToFile captures a screenshot and saves it to a file
-// compressionLevel: 0=None, 1=BestSpeed, 2=Default, 3=BestCompression
-func (c *Capturer) CaptureToFile(opts strategy.CaptureOptions, outputPath string, compressionLevel int) error {
-	strat, err := c.GetStrategy()
-	if err != nil {
-		return err
-	}
-
-	img, err := strat.Capture(opts)
+func (c *Capturer) CaptureToFile(opts strategy.CaptureOptions, outputPath string, enc EncodeOptions) error {
+	img, err := c.Capture(opts)
 	if err != nil {
 		return fmt.Errorf("capture failed: %w", err)
 	}
 
-	return SavePNG(img, outputPath, compressionLevel)
+	return Save(img, outputPath, enc)
 }
 
-// Capture captures a screenshot and returns the image
+// SetDocument sets the document conversion applied to every capture
+// (default: document.Off)
+func (c *Capturer) SetDocument(mode document.Mode) {
+	c.document = mode
+}
+
+// SetAnnotations sets markup drawn on every capture, last of all
+func (c *Capturer) SetAnnotations(ops []annotate.Op) {
+	c.annotate = ops
+}
+
+// SetRetryPolicy sets the retry policy used by Capture
+func (c *Capturer) SetRetryPolicy(p RetryPolicy) {
+	c.retry = p
+}
+
+// Capture captures a screenshot and returns the image.
+//
+// The image is always an *image.RGBA, *image.NRGBA (window captures with
+// alpha), *image.Gray or *image.Paletted (document mode). All of them
+// implement draw.Image and SubImage, so embedders can crop and draw
+// without copies, and expose their pixels as Pix: row y starts at
+// Pix[(y-Bounds().Min.Y)*Stride], and Stride may be larger than a row,
+// as in sub-images. The caller owns the image: the Capturer keeps no
+// reference to it and never reuses its buffer. ToRGBA and ToNRGBA convert
+// it when another layout is needed.
 func (c *Capturer) Capture(opts strategy.CaptureOptions) (image.Image, error) {
+	img, _, err := c.CaptureAttempts(opts)
+	return img, err
+}
+
+// CaptureAttempts captures a screenshot, retrying according to the retry
+// policy, and also returns the number of attempts made
+func (c *Capturer) CaptureAttempts(opts strategy.CaptureOptions) (image.Image, int, error) {
+	img, attempts, _, err := c.CaptureTimed(opts)
+	return img, attempts, err
+}
+
+// CaptureTimed is CaptureAttempts, also returning how long each phase of
+// the capture took
+func (c *Capturer) CaptureTimed(opts strategy.CaptureOptions) (image.Image, int, Stats, error) {
+	c.events.Publish(events.Event{Type: events.CaptureStarted, Target: Describe(opts)})
+	img, attempts, stats, err := c.captureTimed(opts)
+	if c.audit != nil {
+		if aerr := c.audit(opts, err); aerr != nil && err == nil {
+			img, err = nil, aerr
+		}
+	}
+	c.publishResult(opts, img, attempts, err)
+	return img, attempts, stats, err
+}
+
+// captureTimed is CaptureTimed without the audit record
+func (c *Capturer) captureTimed(opts strategy.CaptureOptions) (image.Image, int, Stats, error) {
+	var stats Stats
 	strat, err := c.GetStrategy()
 	if err != nil {
-		return nil, err
+		return nil, 0, stats, err
+	}
+	if err := c.waitIdle(); err != nil {
+		return nil, 0, stats, err
+	}
+	if err := c.limit.reserve(); err != nil {
+		return nil, 0, stats, err
 	}
 
-	return strat.Capture(opts)
+	delay := c.retry.Delay
+	for attempt := 1; ; attempt++ {
+		t := time.Now()
+		img, err := c.grab(strat, opts)
+		t = since(&stats.Grab, t)
+		if err == nil {
+			img = c.fixChannels(strat, img, opts)
+			img, err = c.fillOverlays(strat, img, opts)
+		}
+		if err == nil {
+			// Never hand out an unredacted image
+			img, err = c.redact(img, opts)
+			if err == nil {
+				img, err = c.anonymize(img, opts)
+			}
+			t = since(&stats.Transforms, t)
+		}
+		if err == nil {
+			img, err = c.stitch(img, opts)
+			t = since(&stats.Composite, t)
+		}
+		if err == nil {
+			img = document.Apply(c.background.Apply(img), c.document)
+			if len(c.annotate) > 0 {
+				img, err = annotate.Apply(img, c.annotate)
+			}
+			since(&stats.Transforms, t)
+		}
+		if err == nil {
+			img = owned(img)
+			c.notify(opts)
+		}
+		// Retrying won't make a protected window go away
+		if err == nil || attempt > c.retry.Retries || errors.Is(err, ErrProtectedWindow) {
+			return img, attempt, stats, err
+		}
+
+		if c.retry.OnRetry != nil {
+			c.retry.OnRetry(attempt, err)
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
 }
 
 // ListMonitors returns available monitors
@@ -92,35 +255,16 @@ func (c *Capturer) ListMonitors() ([]strategy.Monitor, error) {
 // SavePNG saves an image to a PNG file
 // compressionLevel: 0=None, 1=BestSpeed, 2=Default, 3=BestCompression
 func SavePNG(img image.Image, path string, compressionLevel int) error {
-	// Create directory if needed
-	dir := filepath.Dir(path)
-	if dir != "" && dir != "." {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("failed to create directory: %w", err)
-		}
-	}
-
-	file, err := os.Create(path)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
-	}
-	defer file.Close()
-
-	encoder := png.Encoder{CompressionLevel: intToCompressionLevel(compressionLevel)}
-	if err := encoder.Encode(file, img); err != nil {
-		return fmt.Errorf("failed to encode PNG: %w", err)
-	}
-
-	return nil
+	return Save(img, path, EncodeOptions{Format: FormatPNG, CompressionLevel: compressionLevel})
 }
 
 // GenerateFilename generates a default filename with timestamp
-func GenerateFilename(prefix string) string {
+func GenerateFilename(prefix string, format Format) string {
 	if prefix == "" {
 		prefix = "screenshot"
 	}
 	timestamp := time.Now().Format("2006-01-02_15-04-05")
-	return fmt.Sprintf("%s_%s.png", prefix, timestamp)
+	return fmt.Sprintf("%s_%s%s", prefix, timestamp, format.Extension())
 }
 
 // WritePNG writes an image as PNG to any io.Writer
@@ -149,3 +293,20 @@ func intToCompressionLevel(level int) png.CompressionLevel {
 		return png.BestSpeed
 	}
 }
+
+// UniquePath returns path unchanged if no file exists there, otherwise
+// the first free variant with a numeric suffix (name_1.png, name_2.png, ...)
+func UniquePath(path string) string {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return path
+	}
+
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s_%d%s", base, i, ext)
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
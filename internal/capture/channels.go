@@ -0,0 +1,79 @@
+package capture
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// SwapMode controls red/blue channel correction
+type SwapMode string
+
+const (
+	// SwapAuto swaps red and blue when the backend detects a BGR display
+	SwapAuto SwapMode = "auto"
+
+	// SwapOn always swaps red and blue
+	SwapOn SwapMode = "on"
+
+	// SwapOff never swaps red and blue
+	SwapOff SwapMode = "off"
+)
+
+// ParseSwapMode parses a --swap-rb value
+func ParseSwapMode(s string) (SwapMode, error) {
+	switch m := SwapMode(s); m {
+	case SwapAuto, SwapOn, SwapOff:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid --swap-rb %q (expected auto, on or off)", s)
+}
+
+// SetSwapRB sets how red/blue swapped frames are corrected (default:
+// SwapAuto)
+func (c *Capturer) SetSwapRB(mode SwapMode) {
+	c.swapRB = mode
+}
+
+// fixChannels swaps red and blue when the swap mode or the backend's
+// detection calls for it
+func (c *Capturer) fixChannels(strat strategy.Strategy, img image.Image, opts strategy.CaptureOptions) image.Image {
+	switch c.swapRB {
+	case SwapOff:
+		return img
+	case SwapOn:
+		return SwapRedBlue(img)
+	}
+	if rb, ok := strat.(strategy.RedBlueSwapper); ok && rb.SwapsRedBlue(opts.Display) {
+		return SwapRedBlue(img)
+	}
+	return img
+}
+
+// SwapRedBlue swaps the red and blue channels, in place for RGBA and
+// NRGBA images
+func SwapRedBlue(img image.Image) image.Image {
+	var pix []byte
+	var stride int
+	b := img.Bounds()
+	switch im := img.(type) {
+	case *image.RGBA:
+		pix, stride = im.Pix, im.Stride
+	case *image.NRGBA:
+		pix, stride = im.Pix, im.Stride
+	default:
+		rgba := image.NewRGBA(b)
+		draw.Draw(rgba, b, img, b.Min, draw.Src)
+		img, pix, stride = rgba, rgba.Pix, rgba.Stride
+	}
+
+	for y := 0; y < b.Dy(); y++ {
+		row := pix[y*stride : y*stride+b.Dx()*4]
+		for i := 0; i < len(row); i += 4 {
+			row[i], row[i+2] = row[i+2], row[i]
+		}
+	}
+	return img
+}
@@ -0,0 +1,128 @@
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// Derived is an extra output made from a capture without grabbing the
+// screen again: a crop of part of it, or a thumbnail of all of it
+type Derived struct {
+	// Name is added to the capture's file name (shot_NAME.png)
+	Name string
+
+	// Crop is the screen area to cut out, in the coordinates of --region
+	Crop image.Rectangle
+
+	// Thumbnail is the box the capture is scaled to fit in, for
+	// thumbnails (Crop is then empty)
+	Thumbnail image.Point
+}
+
+// Image returns the derived image of img, the capture of area. Crops
+// share img's pixels where it can make sub-images.
+func (d Derived) Image(img image.Image, area image.Rectangle) (image.Image, error) {
+	if d.Crop.Empty() {
+		return ScaleToFit(img, d.Thumbnail), nil
+	}
+	if !d.Crop.In(area) {
+		return nil, fmt.Errorf("crop %s (%v) is outside the captured area %v", d.Name, d.Crop, area)
+	}
+	if img.Bounds().Size() != area.Size() {
+		// Stitched at a common DPI, pixels no longer map to the screen
+		return nil, fmt.Errorf("crop %s: the capture is scaled (%v for %v of screen)", d.Name, img.Bounds().Size(), area.Size())
+	}
+	r := d.Crop.Sub(area.Min).Add(img.Bounds().Min)
+	if s, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return s.SubImage(r), nil
+	}
+	out := image.NewRGBA(image.Rectangle{Max: r.Size()})
+	draw.Draw(out, out.Bounds(), img, r.Min, draw.Src)
+	return out, nil
+}
+
+// DerivedPath returns where a derived output of the capture saved at path
+// goes: next to it, with the name added (shot.png -> shot_NAME.png)
+func DerivedPath(path, name string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "_" + name + ext
+}
+
+// SaveDerived saves img, the capture of area, to path along with its
+// derived outputs, encoding all of them concurrently from the same
+// pixels. It returns the derived images; stats only times the capture
+// itself. As with SaveFallback, if the encoder fails they are all saved
+// as PNG instead, the capture at pngPath.
+func SaveDerived(img image.Image, area image.Rectangle, path, pngPath string, opts EncodeOptions, stats *Stats, derived []Derived) ([]image.Image, *Fallback, error) {
+	size := stats.Bytes
+	images, err := saveDerived(img, area, path, opts, stats, derived)
+	fb := fallback(err)
+	if fb == nil {
+		return images, nil, err
+	}
+
+	os.Remove(path)
+	for _, d := range derived {
+		os.Remove(DerivedPath(path, d.Name))
+	}
+	stats.Bytes = size
+	opts.Format = FormatPNG
+	if images, err = saveDerived(img, area, pngPath, opts, stats, derived); err != nil {
+		return nil, nil, fmt.Errorf("%s (saving as PNG instead failed too: %w)", fb.Error, err)
+	}
+	return images, fb, nil
+}
+
+// saveDerived is SaveDerived without the fallback
+func saveDerived(img image.Image, area image.Rectangle, path string, opts EncodeOptions, stats *Stats, derived []Derived) ([]image.Image, error) {
+	images := make([]image.Image, len(derived))
+	errs := make([]error, len(derived)+1)
+
+	// Callouts kept editable in SVG are placed on the whole capture
+	dopts := opts
+	dopts.Annotations = nil
+
+	var wg sync.WaitGroup
+	wg.Add(len(derived) + 1)
+	go func() {
+		defer wg.Done()
+		errs[0] = SaveTimed(img, path, opts, stats)
+	}()
+	for i, d := range derived {
+		go func(i int, d Derived) {
+			defer wg.Done()
+			out, err := d.Image(img, area)
+			if err == nil {
+				err = Save(out, DerivedPath(path, d.Name), dopts)
+			}
+			images[i], errs[i+1] = out, err
+		}(i, d)
+	}
+	wg.Wait()
+	return images, errors.Join(errs...)
+}
+
+// ScaleToFit shrinks img to fit in size, keeping its aspect ratio.
+// Smaller images are returned as they are.
+func ScaleToFit(img image.Image, size image.Point) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= size.X && b.Dy() <= size.Y {
+		return img
+	}
+	scale := min(float64(size.X)/float64(b.Dx()), float64(size.Y)/float64(b.Dy()))
+	w := max(1, int(float64(b.Dx())*scale+0.5))
+	h := max(1, int(float64(b.Dy())*scale+0.5))
+	small := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.ApproxBiLinear.Scale(small, small.Bounds(), img, b, xdraw.Src, nil)
+	return small
+}
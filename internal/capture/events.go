@@ -0,0 +1,35 @@
+package capture
+
+import (
+	"image"
+
+	"github.com/robotin/screenshot/internal/events"
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// SetEvents makes Capture publish capture.started, capture.succeeded and
+// capture.failed events on bus
+func (c *Capturer) SetEvents(bus *events.Bus) {
+	c.events = bus
+}
+
+// Subscribe calls fn with every capture event from now on, until the
+// returned function is called. It sets up an event bus if SetEvents
+// wasn't called.
+func (c *Capturer) Subscribe(fn func(events.Event)) (unsubscribe func()) {
+	if c.events == nil {
+		c.events = &events.Bus{}
+	}
+	return c.events.Subscribe(fn)
+}
+
+// publishResult publishes how a capture ended
+func (c *Capturer) publishResult(opts strategy.CaptureOptions, img image.Image, attempts int, err error) {
+	e := events.Event{Type: events.CaptureSucceeded, Target: Describe(opts), Attempts: attempts}
+	if err != nil {
+		e.Type, e.Error = events.CaptureFailed, err.Error()
+	} else {
+		e.Width, e.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	}
+	c.events.Publish(e)
+}
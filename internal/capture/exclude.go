@@ -0,0 +1,83 @@
+package capture
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// SetExclusions sets a function returning areas (in screen coordinates) to
+// black out in every capture. It is called after each capture with the
+// current monitor layout, so zones tied to a monitor follow hotplug.
+func (c *Capturer) SetExclusions(zones func(monitors []strategy.Monitor) []image.Rectangle) {
+	c.exclude = zones
+}
+
+// redact blacks out the exclusion zones and protected windows that
+// overlap the captured area
+func (c *Capturer) redact(img image.Image, opts strategy.CaptureOptions) (image.Image, error) {
+	if c.exclude == nil && c.protected.Windows == nil {
+		return img, nil
+	}
+
+	monitors, err := c.ListMonitors()
+	if err != nil {
+		return nil, err
+	}
+
+	// Screen area of the image; its top-left pixel is at area.Min
+	area := Area(opts, monitors)
+	origin := area.Min
+
+	var zones []image.Rectangle
+	if c.exclude != nil {
+		zones = c.exclude(monitors)
+	}
+	protected, err := c.protectedZones(area)
+	if err != nil {
+		return nil, err
+	}
+	zones = append(zones, protected...)
+	if len(zones) == 0 {
+		return img, nil
+	}
+
+	b := img.Bounds()
+	dst, ok := img.(draw.Image)
+	if !ok {
+		rgba := image.NewRGBA(b)
+		draw.Draw(rgba, b, img, b.Min, draw.Src)
+		dst = rgba
+	}
+
+	black := image.NewUniform(color.Black)
+	for _, z := range zones {
+		r := z.Sub(origin).Add(b.Min).Intersect(b)
+		if !r.Empty() {
+			draw.Draw(dst, r, black, image.Point{}, draw.Src)
+		}
+	}
+	return dst, nil
+}
+
+// Area returns the screen area a capture with opts covers
+func Area(opts strategy.CaptureOptions, monitors []strategy.Monitor) image.Rectangle {
+	var area image.Rectangle
+	switch {
+	case opts.Region != nil:
+		area = *opts.Region
+	case opts.Monitor == -1:
+		for _, m := range monitors {
+			area = area.Union(m.Bounds)
+		}
+	default:
+		for _, m := range monitors {
+			if m.Index == opts.Monitor {
+				area = m.Bounds
+			}
+		}
+	}
+	return area
+}
@@ -0,0 +1,99 @@
+package capture
+
+import (
+	"fmt"
+	"image"
+	"time"
+
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// MaxExposureFrames bounds how many frames one capture combines
+const MaxExposureFrames = 64
+
+// exposureInterval spaces the frames of a long exposure one refresh of a
+// 60 Hz panel apart, so temporal dithering and flicker show each of their
+// phases instead of the same frame repeatedly
+const exposureInterval = 17 * time.Millisecond
+
+// Ways of combining the frames of a long exposure
+const (
+	// ExposureAverage averages each channel, which cancels out temporal
+	// dithering and OLED flicker that make single frames of some panels
+	// look banded
+	ExposureAverage = "average"
+
+	// ExposureMax keeps the largest value of each channel, so content
+	// that blinks (cursors, alerts) shows up even if most frames miss it
+	ExposureMax = "max"
+)
+
+// ExposurePolicy combines several frames grabbed in quick succession into
+// one capture, like a long exposure
+type ExposurePolicy struct {
+	// Frames is how many frames are combined; 0 or 1 grabs a single frame
+	Frames int
+
+	// Mode is ExposureAverage (the default) or ExposureMax
+	Mode string
+}
+
+// SetExposurePolicy sets the exposure policy used by Capture
+func (c *Capturer) SetExposurePolicy(p ExposurePolicy) {
+	c.exposure = p
+}
+
+// expose grabs the rest of a long exposure starting with first, and
+// combines the frames per channel as the policy's mode says
+func (c *Capturer) expose(strat strategy.Strategy, opts strategy.CaptureOptions, first image.Image) (image.Image, error) {
+	if c.exposure.Frames <= 1 {
+		return first, nil
+	}
+
+	b := first.Bounds()
+	sum := make([]uint32, 4*b.Dx()*b.Dy())
+	add := func(img image.Image) error {
+		if img.Bounds().Size() != b.Size() {
+			return fmt.Errorf("frames of a long exposure differ in size (%v, then %v)", b.Size(), img.Bounds().Size())
+		}
+		rgba := ToRGBA(img)
+		w := 4 * b.Dx()
+		for y := 0; y < b.Dy(); y++ {
+			row := rgba.Pix[y*rgba.Stride : y*rgba.Stride+w]
+			acc := sum[y*w : (y+1)*w]
+			if c.exposure.Mode == ExposureMax {
+				for i, v := range row {
+					acc[i] = max(acc[i], uint32(v))
+				}
+				continue
+			}
+			for i, v := range row {
+				acc[i] += uint32(v)
+			}
+		}
+		return nil
+	}
+	if err := add(first); err != nil {
+		return nil, err
+	}
+	for n := 1; n < c.exposure.Frames; n++ {
+		time.Sleep(exposureInterval)
+		img, err := strat.Capture(opts)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(img); err != nil {
+			return nil, err
+		}
+	}
+
+	out := image.NewRGBA(b)
+	n := uint32(c.exposure.Frames)
+	if c.exposure.Mode == ExposureMax {
+		n = 1
+	}
+	for i, v := range sum {
+		out.Pix[i] = uint8((v + n/2) / n)
+	}
+	return out, nil
+}
@@ -0,0 +1,46 @@
+package capture
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"time"
+
+	"github.com/robotin/screenshot/internal/annotate"
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// DefaultFailureSize is the size of failure images when the screen's size
+// isn't known
+var DefaultFailureSize = image.Pt(1280, 720)
+
+var (
+	failureText       = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	failureBackground = color.RGBA{0x8b, 0x10, 0x10, 0xff}
+)
+
+// FailureImage renders a stand-in for a capture that failed at at with
+// err: the error, time and host in white on red, so slideshows and
+// dashboards show the failure rather than a stale image
+func FailureImage(size image.Point, err error, at time.Time) *image.RGBA {
+	if size.X <= 0 || size.Y <= 0 {
+		size = DefaultFailureSize
+	}
+	host, _ := os.Hostname()
+	text := fmt.Sprintf("CAPTURE FAILED\n\n%s\n%s\n\n%v", at.Format("2006-01-02 15:04:05 MST"), host, err)
+	return annotate.Banner(size, text, failureText, failureBackground)
+}
+
+// FailureSize is the size a capture with opts would have had, for its
+// failure image; zero if the monitors can't be listed either
+func (c *Capturer) FailureSize(opts strategy.CaptureOptions) image.Point {
+	if opts.Region != nil {
+		return opts.Region.Size()
+	}
+	monitors, err := c.ListMonitors()
+	if err != nil {
+		return image.Point{}
+	}
+	return Area(opts, monitors).Size()
+}
@@ -0,0 +1,66 @@
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// EncoderError is an encoder failing to produce an image, as opposed to
+// the output it writes to failing
+type EncoderError struct {
+	Format Format
+	Err    error
+}
+
+func (e *EncoderError) Error() string { return e.Err.Error() }
+
+func (e *EncoderError) Unwrap() error { return e.Err }
+
+// Fallback reports a capture saved as PNG because the encoder for the
+// format asked for failed
+type Fallback struct {
+	// Format is the format asked for
+	Format Format `json:"format"`
+	Error  string `json:"error"`
+}
+
+// FallbackPath returns where SaveFallback saves the capture meant for
+// path as PNG: path with a .png extension, made unique
+func FallbackPath(path string) string {
+	return UniquePath(strings.TrimSuffix(path, filepath.Ext(path)) + FormatPNG.Extension())
+}
+
+// SaveFallback is SaveTimed, except that when the encoder for a format
+// other than PNG fails (a library missing at runtime, an encode error),
+// the image is saved as PNG at pngPath instead, so the capture isn't lost.
+// Fallback is nil unless that happened.
+func SaveFallback(img image.Image, path, pngPath string, opts EncodeOptions, stats *Stats) (*Fallback, error) {
+	size := stats.Bytes
+	err := SaveTimed(img, path, opts, stats)
+	fb := fallback(err)
+	if fb == nil {
+		return nil, err
+	}
+
+	os.Remove(path)
+	stats.Bytes = size
+	opts.Format = FormatPNG
+	if err := SaveTimed(img, pngPath, opts, stats); err != nil {
+		return nil, fmt.Errorf("%s (saving as PNG instead failed too: %w)", fb.Error, err)
+	}
+	return fb, nil
+}
+
+// fallback returns the Fallback to PNG for an error saving a capture, nil
+// if it isn't an encoder failure or PNG is what failed
+func fallback(err error) *Fallback {
+	var encErr *EncoderError
+	if !errors.As(err, &encErr) || encErr.Format == FormatPNG {
+		return nil
+	}
+	return &Fallback{Format: encErr.Format, Error: encErr.Error()}
+}
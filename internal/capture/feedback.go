@@ -0,0 +1,27 @@
+package capture
+
+import (
+	"image"
+
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// SetFeedback sets a function called after each successful capture with
+// the screen area it covered, to confirm the capture to the user (flash,
+// shutter sound). It runs before the image is encoded.
+func (c *Capturer) SetFeedback(fn func(area image.Rectangle)) {
+	c.feedback = fn
+}
+
+// notify calls the feedback function, if any
+func (c *Capturer) notify(opts strategy.CaptureOptions) {
+	if c.feedback == nil {
+		return
+	}
+	var monitors []strategy.Monitor
+	if opts.Region == nil {
+		// A failed listing just leaves the area empty
+		monitors, _ = c.ListMonitors()
+	}
+	c.feedback(Area(opts, monitors))
+}
@@ -0,0 +1,125 @@
+package capture
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	// minFitQuality is the lowest JPEG and HEIF quality FitSize uses
+	// before it scales the image down instead: below it, text turns to
+	// mush faster than it shrinks
+	minFitQuality = 40
+
+	// minFitSide is the smallest width or height FitSize scales to
+	minFitSide = 16
+)
+
+// Fit is how a capture was made to fit a size limit
+type Fit struct {
+	// Quality is the JPEG or HEIF quality used, 0 for lossless formats
+	Quality int `json:"quality,omitempty"`
+
+	// Scale is the factor the image was scaled by, 1 if it wasn't
+	Scale float64 `json:"scale"`
+
+	// Bytes is the encoded size
+	Bytes int64 `json:"bytes"`
+}
+
+// FitSize finds how to encode img in at most maxBytes: the highest
+// quality (from opts.Quality down to minFitQuality) for lossy formats and
+// the best compression for lossless ones, then scaling down until it
+// fits. It returns the image and options to save with.
+func FitSize(img image.Image, opts EncodeOptions, maxBytes int64) (image.Image, EncodeOptions, Fit, error) {
+	if opts.Format == FormatAuto {
+		opts.Format = ChooseFormat(img, opts.Auto)
+	}
+	lossy := false
+	switch opts.Format {
+	case FormatJPEG, FormatHEIF:
+		lossy = true
+		if opts.Quality <= 0 {
+			opts.Quality = DefaultJPEGQuality
+		}
+	case FormatPNG, "":
+		opts.CompressionLevel = 3
+	case FormatQOI:
+	default:
+		return nil, opts, Fit{}, fmt.Errorf("cannot fit %s output to a size (use png, jpeg, heif or qoi)", opts.Format)
+	}
+
+	b := img.Bounds()
+	fit := Fit{Scale: 1}
+	for {
+		scaled := img
+		if fit.Scale < 1 {
+			w := int(math.Round(float64(b.Dx()) * fit.Scale))
+			h := int(math.Round(float64(b.Dy()) * fit.Scale))
+			if w < minFitSide || h < minFitSide {
+				return nil, opts, fit, fmt.Errorf("cannot fit the capture in %d bytes: %d bytes at %dx%d", maxBytes, fit.Bytes, w, h)
+			}
+			small := image.NewRGBA(image.Rect(0, 0, w, h))
+			xdraw.CatmullRom.Scale(small, small.Bounds(), img, b, xdraw.Src, nil)
+			scaled = small
+		}
+
+		o := opts
+		size, err := encodedSize(scaled, o)
+		if err != nil {
+			return nil, opts, fit, err
+		}
+		if lossy && size > maxBytes {
+			// The highest quality that fits; when none does, size ends
+			// up that of the lowest
+			best, bestSize := 0, int64(0)
+			for lo, hi := minFitQuality, opts.Quality-1; lo <= hi; {
+				q := o
+				q.Quality = (lo + hi) / 2
+				if size, err = encodedSize(scaled, q); err != nil {
+					return nil, opts, fit, err
+				}
+				if size <= maxBytes {
+					best, bestSize, lo = q.Quality, size, q.Quality+1
+				} else {
+					hi = q.Quality - 1
+				}
+			}
+			if best > 0 {
+				o.Quality, size = best, bestSize
+			}
+		}
+		fit.Bytes = size
+		if size <= maxBytes {
+			if lossy {
+				fit.Quality = o.Quality
+			}
+			fit.Scale = math.Round(fit.Scale*1000) / 1000
+			return scaled, o, fit, nil
+		}
+
+		// Encoded size goes roughly with the pixel count; aim a little
+		// under and shrink at least 10% a step
+		fit.Scale *= max(0.25, min(0.9, math.Sqrt(float64(maxBytes)/float64(size))*0.95))
+	}
+}
+
+// encodedSize returns how many bytes img encodes to with opts
+func encodedSize(img image.Image, opts EncodeOptions) (int64, error) {
+	var n countWriter
+	if err := Encode(img, &n, opts); err != nil {
+		return 0, err
+	}
+	return int64(n), nil
+}
+
+// countWriter counts the bytes written to it
+type countWriter int64
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	*c += countWriter(len(p))
+	return len(p), nil
+}
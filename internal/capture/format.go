@@ -0,0 +1,330 @@
+package capture
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/robotin/screenshot/internal/annotate"
+)
+
+// Format identifies an output encoding
+type Format string
+
+const (
+	// FormatPNG is a standard PNG image (default)
+	FormatPNG Format = "png"
+
+	// FormatJPEG is a lossy JPEG image, much smaller for photos and video
+	FormatJPEG Format = "jpeg"
+
+	// FormatYUV420 is planar YUV 4:2:0 wrapped in a YUV4MPEG2 (y4m) container
+	FormatYUV420 Format = "yuv420"
+
+	// FormatNV12 is headerless NV12 (Y plane followed by interleaved UV)
+	FormatNV12 Format = "nv12"
+
+	// FormatQOI is the lossless Quite OK Image format: nearly as fast to
+	// encode as raw pixels, much smaller
+	FormatQOI Format = "qoi"
+
+	// FormatHEIF is HEVC-compressed HEIF (.heic), native to Apple devices.
+	// It needs libheif and is only built with -tags heif.
+	FormatHEIF Format = "heif"
+
+	// FormatSVG is an SVG wrapping a PNG, with annotations as editable
+	// elements on top
+	FormatSVG Format = "svg"
+)
+
+// DefaultJPEGQuality is used when EncodeOptions.Quality is unset
+const DefaultJPEGQuality = 90
+
+// encoder writes an image in one format
+type encoder func(img image.Image, w io.Writer, opts EncodeOptions) error
+
+// encoders holds the formats compiled into this build. PNG is always
+// there; the others register themselves from files that the nojpeg,
+// noyuv, noqoi, nosvg and minimal build tags leave out, or that the heif tag
+// adds.
+var encoders = map[Format]encoder{
+	FormatPNG: encodePNG,
+}
+
+// registerEncoder makes format f available
+func registerEncoder(f Format, e encoder) {
+	encoders[f] = e
+}
+
+// allFormats lists every format in display order
+var allFormats = []Format{FormatPNG, FormatJPEG, FormatHEIF, FormatQOI, FormatSVG, FormatYUV420, FormatNV12}
+
+// Formats lists the output encodings this build can write
+func Formats() []Format {
+	var formats []Format
+	for _, f := range allFormats {
+		if _, ok := encoders[f]; ok {
+			formats = append(formats, f)
+		}
+	}
+	return formats
+}
+
+// notCompiled reports a format left out of this build
+func notCompiled(f Format) error {
+	return fmt.Errorf("%s output is not compiled into this binary (see screenshot version --full)", f)
+}
+
+// FrameWriter writes a video stream one frame at a time
+type FrameWriter interface {
+	WriteFrame(img image.Image) error
+	Flush() error
+}
+
+// newVideoWriter creates the video stream writer, if compiled in
+var newVideoWriter func(w io.Writer, fps float64) FrameWriter
+
+// NewVideoWriter creates a y4m video stream writer at fps frames per
+// second
+func NewVideoWriter(w io.Writer, fps float64) (FrameWriter, error) {
+	if newVideoWriter == nil {
+		return nil, notCompiled(FormatYUV420)
+	}
+	return newVideoWriter(w, fps), nil
+}
+
+// EncodeOptions controls how a captured image is encoded
+type EncodeOptions struct {
+	// Format is the output encoding. Empty means PNG
+	Format Format
+
+	// Auto tunes the choice FormatAuto makes
+	Auto AutoFormat
+
+	// CompressionLevel: 0=None, 1=BestSpeed, 2=Default, 3=BestCompression
+	CompressionLevel int
+
+	// Quality is the JPEG and HEIF quality (1-100, default
+	// DefaultJPEGQuality)
+	Quality int
+
+	// Progressive writes progressive JPEGs and Interlace Adam7-interlaced
+	// PNGs, which render as a coarse preview first when loaded over a
+	// slow link
+	Progressive bool
+	Interlace   bool
+
+	// PNGColor is the PNG color type: RGB(A) as needed, RGB or grayscale
+	PNGColor PNGColor
+
+	// SRGB tags PNGs as sRGB (sRGB and gAMA chunks), so color-managed
+	// viewers render them as the screen showed them
+	SRGB bool
+
+	// DPI, if set, is written into PNGs (pHYs), so captures print at the
+	// screen's physical size
+	DPI float64
+
+	// FlushRows flushes PNG output every FlushRows rows, so a consumer
+	// reading a pipe can start before encoding completes (0 = off)
+	FlushRows int
+
+	// Stable writes a PNG with fixed encoder settings that is
+	// byte-identical for identical pixels (see WriteStablePNG); the other
+	// PNG options but PNGColor, metadata included, are ignored
+	Stable bool
+
+	// Annotations are written as SVG elements over the image (SVG only)
+	Annotations []annotate.Op
+
+	// Verify makes Save flush the file to disk, read it back and compare
+	// its pixels with the capture (PNG only)
+	Verify bool
+
+	// Progress, if set, is called as Save and EncodeTimed go, with the
+	// file (empty for a writer), the phase and the bytes written so far.
+	// It is called for every write, so it should be cheap.
+	Progress func(path string, phase Phase, done int64)
+}
+
+// Phase is a step of saving a capture, reported to EncodeOptions.Progress
+type Phase string
+
+// Save phases
+const (
+	// PhaseEncode is while the encoder produces output
+	PhaseEncode Phase = "encode"
+
+	// PhaseWrite is after encoding, while the file is flushed and closed
+	PhaseWrite Phase = "write"
+
+	// PhaseDone is reported once the output is complete
+	PhaseDone Phase = "done"
+)
+
+// ParseFormat parses a format name as given on the command line
+func ParseFormat(s string) (Format, error) {
+	var f Format
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "png":
+		f = FormatPNG
+	case "jpeg", "jpg":
+		f = FormatJPEG
+	case "yuv420", "yuv", "y4m", "i420":
+		f = FormatYUV420
+	case "nv12":
+		f = FormatNV12
+	case "qoi":
+		f = FormatQOI
+	case "heif", "heic":
+		f = FormatHEIF
+	case "svg":
+		f = FormatSVG
+	default:
+		return "", fmt.Errorf("unknown format %q (expected png, jpeg, heif, qoi, svg, yuv420 or nv12)", s)
+	}
+	if _, ok := encoders[f]; !ok {
+		return "", notCompiled(f)
+	}
+	return f, nil
+}
+
+// FormatFromPath guesses the format from a file extension.
+// Returns false if the extension is not recognized.
+func FormatFromPath(path string) (Format, bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		return FormatPNG, true
+	case ".jpg", ".jpeg":
+		return FormatJPEG, true
+	case ".y4m":
+		return FormatYUV420, true
+	case ".nv12":
+		return FormatNV12, true
+	case ".qoi":
+		return FormatQOI, true
+	case ".heic", ".heif":
+		return FormatHEIF, true
+	case ".svg":
+		return FormatSVG, true
+	default:
+		return "", false
+	}
+}
+
+// Extension returns the file extension (with dot) for the format
+func (f Format) Extension() string {
+	switch f {
+	case FormatJPEG:
+		return ".jpg"
+	case FormatYUV420:
+		return ".y4m"
+	case FormatNV12:
+		return ".nv12"
+	case FormatQOI:
+		return ".qoi"
+	case FormatHEIF:
+		return ".heic"
+	case FormatSVG:
+		return ".svg"
+	default:
+		return ".png"
+	}
+}
+
+// Encode writes an image to w using the given encoding options
+func Encode(img image.Image, w io.Writer, opts EncodeOptions) error {
+	f := opts.Format
+	switch f {
+	case "":
+		f = FormatPNG
+	case FormatAuto:
+		f = ChooseFormat(img, opts.Auto)
+		opts.Format = f
+	}
+	if !slices.Contains(allFormats, f) {
+		return fmt.Errorf("unsupported format: %s", f)
+	}
+	e, ok := encoders[f]
+	if !ok {
+		return notCompiled(f)
+	}
+	return e(img, w, opts)
+}
+
+// encodePNG writes a PNG, stable, streaming or interlaced if asked to
+func encodePNG(img image.Image, w io.Writer, opts EncodeOptions) error {
+	img = pngImage(img, opts.PNGColor)
+	if opts.Stable {
+		return WriteStablePNG(img, w)
+	}
+	if chunks := pngMetadata(opts); len(chunks) > 0 {
+		w = &metaWriter{w: w, chunks: chunks}
+	}
+	if opts.Interlace || opts.FlushRows > 0 {
+		return WriteStreamingPNG(img, w, opts.CompressionLevel, opts.Interlace, opts.FlushRows)
+	}
+	return WritePNG(img, w, opts.CompressionLevel)
+}
+
+// report calls the Progress hook, if set
+func (o EncodeOptions) report(path string, phase Phase, done int64) {
+	if o.Progress != nil {
+		o.Progress(path, phase, done)
+	}
+}
+
+// Save encodes an image to a file, creating the parent directory if needed
+func Save(img image.Image, path string, opts EncodeOptions) error {
+	return SaveTimed(img, path, opts, &Stats{})
+}
+
+// SaveTimed is Save, recording the encode, write and verify times and the
+// file size in stats
+func SaveTimed(img image.Image, path string, opts EncodeOptions, stats *Stats) error {
+	// Create directory if needed
+	dir := filepath.Dir(path)
+	if dir != "" && dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	// Done is reported on failure too, so progress shown can be cleared
+	size := stats.Bytes
+	defer func() { opts.report(path, PhaseDone, size) }()
+	if err := encodeTimed(img, file, path, opts, stats); err != nil {
+		file.Close()
+		return err
+	}
+	size = stats.Bytes - size
+	opts.report(path, PhaseWrite, size)
+	start := time.Now()
+	if opts.Verify {
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to write file: %w", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	since(&stats.Write, start)
+
+	if opts.Verify {
+		start := time.Now()
+		defer since(&stats.Verify, start)
+		return Verify(pngImage(img, opts.PNGColor), path)
+	}
+	return nil
+}
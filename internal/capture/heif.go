@@ -0,0 +1,137 @@
+//go:build heif && cgo && !minimal
+
+package capture
+
+/*
+#cgo pkg-config: libheif
+
+#include <stdlib.h>
+#include <string.h>
+#include <libheif/heif.h>
+
+// buffer collects the encoded file in memory
+struct buffer {
+	uint8_t *data;
+	size_t len, cap;
+};
+
+static struct heif_error buffer_write(struct heif_context *ctx, const void *data, size_t size, void *userdata) {
+	struct buffer *b = userdata;
+	if (b->len + size > b->cap) {
+		size_t cap = b->cap ? b->cap : 1 << 16;
+		while (cap < b->len + size) {
+			cap *= 2;
+		}
+		uint8_t *grown = realloc(b->data, cap);
+		if (!grown) {
+			struct heif_error err = {heif_error_Memory_allocation_error, heif_suberror_Unspecified, "out of memory"};
+			return err;
+		}
+		b->data = grown;
+		b->cap = cap;
+	}
+	memcpy(b->data + b->len, data, size);
+	b->len += size;
+	struct heif_error ok = {heif_error_Ok, heif_suberror_Unspecified, "Success"};
+	return ok;
+}
+
+static struct heif_error write_to_buffer(struct heif_context *ctx, struct buffer *b) {
+	struct heif_writer writer = {1, buffer_write};
+	return heif_context_write(ctx, &writer, b);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"unsafe"
+)
+
+func init() {
+	registerEncoder(FormatHEIF, func(img image.Image, w io.Writer, opts EncodeOptions) error {
+		return WriteHEIF(img, w, opts.Quality)
+	})
+}
+
+// heifError converts a libheif error, nil on success
+func heifError(err C.struct_heif_error) error {
+	if err.code == C.heif_error_Ok {
+		return nil
+	}
+	return errors.New(C.GoString(err.message))
+}
+
+// WriteHEIF writes an image as HEIF with HEVC compression, the format
+// Apple devices save photos and screenshots in (.heic). quality is 1-100
+// as for JPEG. Translucent images keep their alpha channel.
+func WriteHEIF(img image.Image, w io.Writer, quality int) error {
+	if quality <= 0 {
+		quality = DefaultJPEGQuality
+	}
+	quality = min(quality, 100)
+
+	b := img.Bounds()
+	nrgba := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(nrgba, nrgba.Rect, img, b.Min, draw.Src)
+	chroma, channels := C.enum_heif_chroma(C.heif_chroma_interleaved_RGB), 3
+	if !nrgba.Opaque() {
+		chroma, channels = C.heif_chroma_interleaved_RGBA, 4
+	}
+
+	ctx := C.heif_context_alloc()
+	defer C.heif_context_free(ctx)
+
+	var enc *C.struct_heif_encoder
+	if err := heifError(C.heif_context_get_encoder_for_format(ctx, C.heif_compression_HEVC, &enc)); err != nil {
+		return fmt.Errorf("no HEVC encoder in libheif: %w", err)
+	}
+	defer C.heif_encoder_release(enc)
+	if err := heifError(C.heif_encoder_set_lossy_quality(enc, C.int(quality))); err != nil {
+		return fmt.Errorf("failed to encode HEIF: %w", err)
+	}
+
+	var himg *C.struct_heif_image
+	if err := heifError(C.heif_image_create(C.int(b.Dx()), C.int(b.Dy()), C.heif_colorspace_RGB, chroma, &himg)); err != nil {
+		return fmt.Errorf("failed to encode HEIF: %w", err)
+	}
+	defer C.heif_image_release(himg)
+	if err := heifError(C.heif_image_add_plane(himg, C.heif_channel_interleaved, C.int(b.Dx()), C.int(b.Dy()), 8)); err != nil {
+		return fmt.Errorf("failed to encode HEIF: %w", err)
+	}
+
+	var stride C.int
+	plane := C.heif_image_get_plane(himg, C.heif_channel_interleaved, &stride)
+	dst := unsafe.Slice((*byte)(unsafe.Pointer(plane)), int(stride)*b.Dy())
+	for y := 0; y < b.Dy(); y++ {
+		src := nrgba.Pix[y*nrgba.Stride : y*nrgba.Stride+b.Dx()*4]
+		row := dst[y*int(stride):]
+		if channels == 4 {
+			copy(row, src)
+			continue
+		}
+		for x := 0; x < b.Dx(); x++ {
+			copy(row[x*3:x*3+3], src[x*4:x*4+3])
+		}
+	}
+
+	var handle *C.struct_heif_image_handle
+	if err := heifError(C.heif_context_encode_image(ctx, himg, enc, nil, &handle)); err != nil {
+		return fmt.Errorf("failed to encode HEIF: %w", err)
+	}
+	C.heif_image_handle_release(handle)
+
+	var buf C.struct_buffer
+	defer func() { C.free(unsafe.Pointer(buf.data)) }()
+	if err := heifError(C.write_to_buffer(ctx, &buf)); err != nil {
+		return fmt.Errorf("failed to encode HEIF: %w", err)
+	}
+	if _, err := w.Write(unsafe.Slice((*byte)(unsafe.Pointer(buf.data)), int(buf.len))); err != nil {
+		return fmt.Errorf("failed to encode HEIF: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package capture
+
+import (
+	"fmt"
+	"time"
+)
+
+// IdlePolicy makes captures wait until the user has stopped typing and
+// moving the pointer for a while, so unattended captures don't catch
+// someone entering a password
+type IdlePolicy struct {
+	// After is how long the user must have been idle; 0 disables waiting
+	After time.Duration
+
+	// Time returns the user's current idle time
+	Time func() (time.Duration, error)
+
+	// OnWait, if set, is called once when a capture has to wait, with
+	// the idle time at that point
+	OnWait func(idle time.Duration)
+}
+
+// minIdlePoll bounds how often the idle time is read while waiting
+const minIdlePoll = 100 * time.Millisecond
+
+// SetIdlePolicy sets the idle policy used by Capture
+func (c *Capturer) SetIdlePolicy(p IdlePolicy) {
+	c.idle = p
+}
+
+// waitIdle blocks until the user has been idle for the idle policy's
+// period. Input while waiting restarts the wait.
+func (c *Capturer) waitIdle() error {
+	if c.idle.After <= 0 || c.idle.Time == nil {
+		return nil
+	}
+	waited := false
+	for {
+		idle, err := c.idle.Time()
+		if err != nil {
+			return fmt.Errorf("failed to read the idle time: %w", err)
+		}
+		if idle >= c.idle.After {
+			return nil
+		}
+		if !waited && c.idle.OnWait != nil {
+			c.idle.OnWait(idle)
+		}
+		waited = true
+
+		// Nothing can change the outcome before the remaining time is up
+		// except input, which only makes the wait longer
+		time.Sleep(max(c.idle.After-idle, minIdlePoll))
+	}
+}
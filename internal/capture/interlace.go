@@ -0,0 +1,305 @@
+package capture
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"io"
+)
+
+// adam7 lists the interlace passes: x/y start and step
+var adam7 = [7][4]int{
+	{0, 0, 8, 8},
+	{4, 0, 8, 8},
+	{0, 4, 4, 8},
+	{2, 0, 4, 4},
+	{0, 2, 2, 4},
+	{1, 0, 2, 2},
+	{0, 1, 1, 2},
+}
+
+// WriteInterlacedPNG writes an Adam7-interlaced PNG, which browsers show
+// as a blurry full-size preview that sharpens as the file downloads
+// instead of top-down. The file is slightly larger than a plain PNG.
+// compressionLevel: 0=None, 1=BestSpeed, 2=Default, 3=BestCompression
+func WriteInterlacedPNG(img image.Image, w io.Writer, compressionLevel int) error {
+	return WriteStreamingPNG(img, w, compressionLevel, true, 0)
+}
+
+// WriteStreamingPNG writes a PNG, interlaced or not, that is flushed to w
+// every flushRows rows (0 = only at the end). Each flush completes the
+// pending IDAT chunk at a zlib sync point, so a consumer on the other end
+// of a slow pipe can decode the rows received so far while the rest is
+// still being encoded.
+// compressionLevel: 0=None, 1=BestSpeed, 2=Default, 3=BestCompression
+func WriteStreamingPNG(img image.Image, w io.Writer, compressionLevel int, interlace bool, flushRows int) error {
+	if err := writeRowPNG(img, w, compressionLevel, interlace, flushRows); err != nil {
+		return fmt.Errorf("failed to encode PNG: %w", err)
+	}
+	return nil
+}
+
+// sequential is the single pass of a non-interlaced PNG
+var sequential = [][4]int{{0, 0, 1, 1}}
+
+func writeRowPNG(img image.Image, w io.Writer, compressionLevel int, interlace bool, flushRows int) error {
+	b := img.Bounds()
+	var pix []byte
+	var offset func(x, y int) int
+	colorType, bpp := byte(2), 3
+	premultiplied := false
+	switch m := img.(type) {
+	case *image.Gray:
+		colorType, bpp = 0, 1
+		pix, offset = m.Pix, m.PixOffset
+	case *image.NRGBA:
+		if !m.Opaque() {
+			colorType, bpp = 6, 4
+		}
+		pix, offset = m.Pix, m.PixOffset
+	default:
+		rgba, ok := img.(*image.RGBA)
+		if !ok {
+			rgba = image.NewRGBA(b)
+			draw.Draw(rgba, b, img, b.Min, draw.Src)
+		}
+		// Screenshots are opaque: drop the alpha channel unless it's used.
+		// PNG stores straight alpha, so translucent pixels are
+		// un-premultiplied row by row.
+		if !rgba.Opaque() {
+			colorType, bpp, premultiplied = 6, 4, true
+		}
+		pix, offset = rgba.Pix, rgba.PixOffset
+	}
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString("\x89PNG\r\n\x1a\n"); err != nil {
+		return err
+	}
+
+	passes := sequential
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(b.Dx()))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(b.Dy()))
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = colorType
+	if interlace {
+		ihdr[12] = 1 // Adam7
+		passes = adam7[:]
+	}
+	if err := writeChunk(bw, "IHDR", ihdr); err != nil {
+		return err
+	}
+
+	idat := &idatWriter{w: bw}
+	zw, err := zlib.NewWriterLevel(idat, zlibLevel(compressionLevel))
+	if err != nil {
+		return err
+	}
+
+	rows := 0
+	for _, pass := range passes {
+		x0, y0, dx, dy := pass[0], pass[1], pass[2], pass[3]
+		pw := (b.Dx() - x0 + dx - 1) / dx
+		if pw <= 0 || y0 >= b.Dy() {
+			continue
+		}
+
+		// Filters work on the previous row of the same pass
+		prev := make([]byte, pw*bpp)
+		cur := make([]byte, pw*bpp)
+		for y := y0; y < b.Dy(); y += dy {
+			for i, x := 0, x0; x < b.Dx(); i, x = i+1, x+dx {
+				o := offset(b.Min.X+x, b.Min.Y+y)
+				copy(cur[i*bpp:], pix[o:o+bpp])
+			}
+			if premultiplied {
+				unpremultiply(cur)
+			}
+			if _, err := zw.Write(filterRow(cur, prev, bpp, compressionLevel)); err != nil {
+				return err
+			}
+			prev, cur = cur, prev
+
+			if rows++; flushRows > 0 && rows%flushRows == 0 {
+				if err := zw.Flush(); err != nil {
+					return err
+				}
+				if err := idat.flush(); err != nil {
+					return err
+				}
+				if err := bw.Flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := idat.flush(); err != nil {
+		return err
+	}
+	if err := writeChunk(bw, "IEND", nil); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// unpremultiply converts a row of RGBA pixels from premultiplied to
+// straight alpha, rounding as color.NRGBAModel does
+func unpremultiply(row []byte) {
+	for i := 0; i+3 < len(row); i += 4 {
+		switch a := uint32(row[i+3]) * 0x101; a {
+		case 0xffff:
+		case 0:
+			row[i], row[i+1], row[i+2] = 0, 0, 0
+		default:
+			for j := i; j < i+3; j++ {
+				row[j] = uint8(uint32(row[j]) * 0x101 * 0xffff / a >> 8)
+			}
+		}
+	}
+}
+
+// filterRow returns the row prefixed with its filter type. Without
+// compression rows are left unfiltered; otherwise the filter with the
+// smallest sum of absolute values is picked, as libpng does.
+func filterRow(cur, prev []byte, bpp, compressionLevel int) []byte {
+	if compressionLevel == 0 {
+		return append([]byte{0}, cur...)
+	}
+
+	var best []byte
+	bestSum := -1
+	for ft := byte(0); ft <= 4; ft++ {
+		out, sum := applyFilter(ft, cur, prev, bpp)
+		if bestSum < 0 || sum < bestSum {
+			best, bestSum = out, sum
+		}
+	}
+	return best
+}
+
+// applyFilter returns the row filtered with filter type ft and prefixed
+// with it, and the sum of the absolute filtered values
+func applyFilter(ft byte, cur, prev []byte, bpp int) ([]byte, int) {
+	out := make([]byte, len(cur)+1)
+	out[0] = ft
+	sum := 0
+	for i := range cur {
+		var a, b, c byte
+		if i >= bpp {
+			a, c = cur[i-bpp], prev[i-bpp]
+		}
+		b = prev[i]
+
+		var p byte
+		switch ft {
+		case 1:
+			p = a
+		case 2:
+			p = b
+		case 3:
+			p = byte((int(a) + int(b)) / 2)
+		case 4:
+			p = paeth(a, b, c)
+		}
+		d := cur[i] - p
+		out[i+1] = d
+		sum += abs(int(int8(d)))
+	}
+	return out, sum
+}
+
+// paeth is the PNG Paeth predictor
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	default:
+		return c
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// zlibLevel maps the tool's 0-3 compression levels to zlib levels
+func zlibLevel(level int) int {
+	switch level {
+	case 0:
+		return zlib.NoCompression
+	case 2:
+		return zlib.DefaultCompression
+	case 3:
+		return zlib.BestCompression
+	default:
+		return zlib.BestSpeed
+	}
+}
+
+// writeChunk writes a PNG chunk with its length and CRC
+func writeChunk(w io.Writer, typ string, data []byte) error {
+	var hdr [8]byte
+	binary.BigEndian.PutUint32(hdr[:4], uint32(len(data)))
+	copy(hdr[4:], typ)
+
+	crc := crc32.NewIEEE()
+	crc.Write(hdr[4:])
+	crc.Write(data)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+
+	for _, p := range [][]byte{hdr[:], data, sum[:]} {
+		if _, err := w.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// idatWriter splits the compressed stream into IDAT chunks
+type idatWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+const idatSize = 64 * 1024
+
+func (iw *idatWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		take := min(idatSize-len(iw.buf), len(p))
+		iw.buf = append(iw.buf, p[:take]...)
+		p = p[take:]
+		if len(iw.buf) == idatSize {
+			if err := iw.flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (iw *idatWriter) flush() error {
+	if len(iw.buf) == 0 {
+		return nil
+	}
+	err := writeChunk(iw.w, "IDAT", iw.buf)
+	iw.buf = iw.buf[:0]
+	return err
+}
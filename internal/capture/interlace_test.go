@@ -0,0 +1,82 @@
+package capture
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// translucent is a small image with opaque, translucent and transparent
+// pixels
+func translucent() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 9, 9))
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 9; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 28), uint8(y * 28), 200, 255})
+		}
+	}
+	img.SetNRGBA(3, 4, color.NRGBA{5, 0, 3, 129})
+	img.SetNRGBA(5, 5, color.NRGBA{250, 128, 7, 1})
+	img.SetNRGBA(8, 8, color.NRGBA{0, 0, 0, 0})
+	return img
+}
+
+func TestStreamingPNGTranslucent(t *testing.T) {
+	src := translucent()
+	rgba := image.NewRGBA(src.Bounds())
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 9; x++ {
+			rgba.Set(x, y, src.At(x, y))
+		}
+	}
+
+	for _, tc := range []struct {
+		interlace bool
+		flushRows int
+	}{{false, 0}, {true, 0}, {false, 1}, {true, 3}} {
+		name := fmt.Sprintf("interlace=%v,flush=%d", tc.interlace, tc.flushRows)
+		t.Run(name, func(t *testing.T) {
+			// Straight alpha comes back exactly
+			got := roundTrip(t, src, tc.interlace, tc.flushRows)
+			if c := got.At(3, 4); color.NRGBAModel.Convert(c) != (color.NRGBA{5, 0, 3, 129}) {
+				t.Errorf("NRGBA pixel came back as %v, want {5 0 3 129}", c)
+			}
+
+			// Premultiplied input decodes as image/png's encoding of it does
+			got = roundTrip(t, rgba, tc.interlace, tc.flushRows)
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, rgba); err != nil {
+				t.Fatal(err)
+			}
+			want, err := png.Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for y := 0; y < 9; y++ {
+				for x := 0; x < 9; x++ {
+					g := color.NRGBAModel.Convert(got.At(x, y))
+					w := color.NRGBAModel.Convert(want.At(x, y))
+					if g != w {
+						t.Errorf("RGBA pixel %d,%d came back as %v, want %v", x, y, g, w)
+					}
+				}
+			}
+		})
+	}
+}
+
+func roundTrip(t *testing.T, img image.Image, interlace bool, flushRows int) image.Image {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := WriteStreamingPNG(img, &buf, 2, interlace, flushRows); err != nil {
+		t.Fatal(err)
+	}
+	out, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
@@ -0,0 +1,424 @@
+//go:build !nojpeg && !minimal
+
+package capture
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"math"
+	"math/bits"
+)
+
+func init() {
+	registerEncoder(FormatJPEG, func(img image.Image, w io.Writer, opts EncodeOptions) error {
+		return WriteJPEG(img, w, opts.Quality, opts.Progressive)
+	})
+}
+
+// WriteJPEG writes an image as JPEG. Progressive JPEGs send a coarse
+// version of the whole image first and refine it as more data arrives,
+// which suits slow links; baseline JPEGs render top-down.
+func WriteJPEG(img image.Image, w io.Writer, quality int, progressive bool) error {
+	if quality <= 0 {
+		quality = DefaultJPEGQuality
+	}
+	quality = min(quality, 100)
+
+	var err error
+	if progressive {
+		err = writeProgressiveJPEG(img, w, quality)
+	} else {
+		err = jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode JPEG: %w", err)
+	}
+	return nil
+}
+
+// unzig maps zig-zag order to natural (row-major) order
+var unzig = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// jpegQuant are the ITU T.81 Annex K quantization tables (luminance,
+// chrominance) in zig-zag order
+var jpegQuant = [2][64]int{
+	{
+		16, 11, 12, 14, 12, 10, 16, 14,
+		13, 14, 18, 17, 16, 19, 24, 40,
+		26, 24, 22, 22, 24, 49, 35, 37,
+		29, 40, 58, 51, 61, 60, 57, 51,
+		56, 55, 64, 72, 92, 78, 64, 68,
+		87, 69, 55, 56, 80, 109, 81, 87,
+		95, 98, 103, 104, 103, 62, 77, 113,
+		121, 112, 100, 120, 92, 101, 103, 99,
+	},
+	{
+		17, 18, 18, 24, 21, 24, 47, 26,
+		26, 47, 99, 66, 56, 66, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+// huffmanSpec is a Huffman table as stored in a DHT segment: the number
+// of codes of each length (1-16 bits) and the symbols in code order
+type huffmanSpec struct {
+	count [16]byte
+	value []byte
+}
+
+// jpegHuffman are the Annex K tables: luminance DC, luminance AC,
+// chrominance DC, chrominance AC. The AC tables include EOB (0x00) and
+// ZRL (0xf0), which is all a spectral-selection-only progressive scan
+// needs.
+var jpegHuffman = [4]huffmanSpec{
+	{
+		[16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+		[]byte{
+			0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+			0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+			0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+			0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+			0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+			0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+			0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+			0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+			0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+			0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+			0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+			0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+			0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+			0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+			0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+			0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+			0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+			0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+			0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+			0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+	{
+		[16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119},
+		[]byte{
+			0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21,
+			0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+			0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91,
+			0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+			0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34,
+			0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+			0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38,
+			0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+			0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+			0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+			0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78,
+			0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+			0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96,
+			0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+			0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4,
+			0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+			0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2,
+			0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+			0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9,
+			0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+}
+
+// huffmanCode is a symbol's code word and its length in bits
+type huffmanCode struct {
+	code uint32
+	n    uint
+}
+
+// codes builds the symbol-to-code lookup for a table
+func (s *huffmanSpec) codes() [256]huffmanCode {
+	var lut [256]huffmanCode
+	code, k := uint32(0), 0
+	for i, count := range s.count {
+		for j := byte(0); j < count; j++ {
+			lut[s.value[k]] = huffmanCode{code, uint(i + 1)}
+			code++
+			k++
+		}
+		code <<= 1
+	}
+	return lut
+}
+
+// dctCos[u][x] is C(u)/2 * cos((2x+1)uπ/16), so a separable 2-D DCT of a
+// block is two passes of 8x8 multiplies
+var dctCos = func() (c [8][8]float64) {
+	for u := 0; u < 8; u++ {
+		cu := 0.5
+		if u == 0 {
+			cu = 0.5 / math.Sqrt2
+		}
+		for x := 0; x < 8; x++ {
+			c[u][x] = cu * math.Cos(float64(2*x+1)*float64(u)*math.Pi/16)
+		}
+	}
+	return c
+}()
+
+// jpegBlock holds a block's quantized coefficients in zig-zag order
+type jpegBlock [64]int32
+
+// writeProgressiveJPEG encodes a progressive JPEG using spectral
+// selection: one scan with every block's average color, then scans adding
+// low and high frequencies. Chroma is not subsampled (4:4:4), which keeps
+// text in screenshots sharp.
+func writeProgressiveJPEG(img image.Image, w io.Writer, quality int) error {
+	b := img.Bounds()
+	if b.Dx() > 0xffff || b.Dy() > 0xffff {
+		return fmt.Errorf("image too large: %dx%d", b.Dx(), b.Dy())
+	}
+	rgba, ok := img.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(b)
+		draw.Draw(rgba, b, img, b.Min, draw.Src)
+	}
+
+	// Scale the quantization tables as libjpeg does
+	scale := 200 - 2*quality
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	var quant [2][64]int
+	for t := range quant {
+		for i, q := range jpegQuant[t] {
+			quant[t][i] = min(max((q*scale+50)/100, 1), 255)
+		}
+	}
+
+	bw, bh := (b.Dx()+7)/8, (b.Dy()+7)/8
+	var blocks [3][]jpegBlock
+	for c := range blocks {
+		blocks[c] = make([]jpegBlock, bw*bh)
+	}
+	for by := 0; by < bh; by++ {
+		for bx := 0; bx < bw; bx++ {
+			var planes [3][64]float64
+			for y := 0; y < 8; y++ {
+				// Repeat the last row and column into the padding
+				py := min(by*8+y, b.Dy()-1)
+				for x := 0; x < 8; x++ {
+					px := min(bx*8+x, b.Dx()-1)
+					i := rgba.PixOffset(b.Min.X+px, b.Min.Y+py)
+					r, g, bl := float64(rgba.Pix[i]), float64(rgba.Pix[i+1]), float64(rgba.Pix[i+2])
+					planes[0][y*8+x] = 0.299*r + 0.587*g + 0.114*bl - 128
+					planes[1][y*8+x] = -0.168736*r - 0.331264*g + 0.5*bl
+					planes[2][y*8+x] = 0.5*r - 0.418688*g - 0.081312*bl
+				}
+			}
+			for c := range planes {
+				fdct(&planes[c], &quant[min(c, 1)], &blocks[c][by*bw+bx])
+			}
+		}
+	}
+
+	bw2 := bufio.NewWriter(w)
+	e := &jpegWriter{w: bw2}
+	for t := range jpegHuffman {
+		e.codes[t] = jpegHuffman[t].codes()
+	}
+
+	e.marker(0xd8, nil)
+	e.marker(0xe0, []byte{'J', 'F', 'I', 'F', 0, 1, 1, 0, 0, 1, 0, 1, 0, 0})
+	for t := range quant {
+		dqt := []byte{byte(t)}
+		for _, q := range quant[t] {
+			dqt = append(dqt, byte(q))
+		}
+		e.marker(0xdb, dqt)
+	}
+	e.marker(0xc2, []byte{
+		8, byte(b.Dy() >> 8), byte(b.Dy()), byte(b.Dx() >> 8), byte(b.Dx()), 3,
+		1, 0x11, 0,
+		2, 0x11, 1,
+		3, 0x11, 1,
+	})
+	for t, spec := range jpegHuffman {
+		// Class (0 = DC, 1 = AC) and destination (0 = luminance, 1 = chroma)
+		dht := []byte{byte(t%2)<<4 | byte(t/2)}
+		dht = append(dht, spec.count[:]...)
+		dht = append(dht, spec.value...)
+		e.marker(0xc4, dht)
+	}
+
+	// DC of all components, interleaved
+	e.marker(0xda, []byte{3, 1, 0x00, 2, 0x11, 3, 0x11, 0, 0, 0})
+	var pred [3]int32
+	for i := 0; i < bw*bh; i++ {
+		for c := range blocks {
+			dc := blocks[c][i][0]
+			e.dc(min(c, 1), dc-pred[c])
+			pred[c] = dc
+		}
+	}
+	e.flush()
+
+	// AC bands, one component per scan: low luminance frequencies first
+	// since they matter most for a recognizable preview
+	for _, scan := range []struct{ comp, ss, se int }{
+		{0, 1, 5}, {1, 1, 63}, {2, 1, 63}, {0, 6, 63},
+	} {
+		table := min(scan.comp, 1)
+		e.marker(0xda, []byte{1, byte(scan.comp + 1), byte(table)<<4 | byte(table), byte(scan.ss), byte(scan.se), 0})
+		for i := range blocks[scan.comp] {
+			e.acBand(table, &blocks[scan.comp][i], scan.ss, scan.se)
+		}
+		e.flush()
+	}
+
+	e.marker(0xd9, nil)
+	if e.err != nil {
+		return e.err
+	}
+	return bw2.Flush()
+}
+
+// fdct transforms a level-shifted 8x8 block and quantizes it into out
+func fdct(in *[64]float64, quant *[64]int, out *jpegBlock) {
+	var tmp [64]float64
+	for y := 0; y < 8; y++ {
+		for u := 0; u < 8; u++ {
+			var s float64
+			for x := 0; x < 8; x++ {
+				s += in[y*8+x] * dctCos[u][x]
+			}
+			tmp[y*8+u] = s
+		}
+	}
+	for zz := 0; zz < 64; zz++ {
+		n := unzig[zz]
+		u, v := n%8, n/8
+		var s float64
+		for y := 0; y < 8; y++ {
+			s += tmp[y*8+u] * dctCos[v][y]
+		}
+		out[zz] = int32(math.Round(s / float64(quant[zz])))
+	}
+}
+
+// jpegWriter writes markers and Huffman-coded entropy data
+type jpegWriter struct {
+	w     *bufio.Writer
+	codes [4][256]huffmanCode
+	acc   uint32
+	n     uint
+	err   error
+}
+
+// marker writes a marker segment; data is nil for SOI and EOI
+func (e *jpegWriter) marker(m byte, data []byte) {
+	if e.err != nil {
+		return
+	}
+	if data == nil {
+		_, e.err = e.w.Write([]byte{0xff, m})
+		return
+	}
+	n := len(data) + 2
+	if _, e.err = e.w.Write([]byte{0xff, m, byte(n >> 8), byte(n)}); e.err == nil {
+		_, e.err = e.w.Write(data)
+	}
+}
+
+// bits appends the low n bits of v to the entropy-coded data, stuffing a
+// zero byte after every 0xff
+func (e *jpegWriter) bits(v uint32, n uint) {
+	e.acc = e.acc<<n | v&(1<<n-1)
+	e.n += n
+	for e.n >= 8 && e.err == nil {
+		c := byte(e.acc >> (e.n - 8))
+		e.err = e.w.WriteByte(c)
+		if c == 0xff && e.err == nil {
+			e.err = e.w.WriteByte(0)
+		}
+		e.n -= 8
+	}
+	e.acc &= 1<<e.n - 1
+}
+
+// flush pads the last byte of a scan with 1 bits
+func (e *jpegWriter) flush() {
+	if e.n > 0 {
+		e.bits(1<<(8-e.n)-1, 8-e.n)
+	}
+}
+
+// symbol writes a Huffman symbol from table t (0-3, as in jpegHuffman)
+func (e *jpegWriter) symbol(t int, s byte) {
+	c := e.codes[t][s]
+	e.bits(c.code, c.n)
+}
+
+// value writes a coefficient's size category symbol and magnitude bits
+func (e *jpegWriter) value(t int, run int, v int32) {
+	a, u := v, v
+	if v < 0 {
+		a, u = -v, v-1
+	}
+	n := uint(bits.Len32(uint32(a)))
+	e.symbol(t, byte(run<<4)|byte(n))
+	e.bits(uint32(u), n)
+}
+
+// dc writes a DC difference for a component using table class
+// 0 (luminance) or 1 (chrominance)
+func (e *jpegWriter) dc(class int, diff int32) {
+	if diff == 0 {
+		e.symbol(class*2, 0)
+		return
+	}
+	e.value(class*2, 0, diff)
+}
+
+// acBand writes coefficients ss..se of a block for a first AC scan
+func (e *jpegWriter) acBand(class int, blk *jpegBlock, ss, se int) {
+	t := class*2 + 1
+	run := 0
+	for k := ss; k <= se; k++ {
+		if blk[k] == 0 {
+			run++
+			continue
+		}
+		for run > 15 {
+			e.symbol(t, 0xf0)
+			run -= 16
+		}
+		e.value(t, run, blk[k])
+		run = 0
+	}
+	if run > 0 {
+		// EOB (an end-of-band run of one block)
+		e.symbol(t, 0x00)
+	}
+}
@@ -0,0 +1,135 @@
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robotin/screenshot/internal/lock"
+)
+
+// ErrTooFrequent is returned, as a *TooFrequentError, for captures
+// started sooner after the previous one than the minimum interval allows
+var ErrTooFrequent = errors.New("capture too soon after the previous one")
+
+// TooFrequentError is the ErrTooFrequent error, with how long until the
+// next capture is allowed
+type TooFrequentError struct {
+	Interval time.Duration
+	Wait     time.Duration
+}
+
+func (e *TooFrequentError) Error() string {
+	return fmt.Sprintf("%v: the policy allows one capture every %s (next in %s)", ErrTooFrequent, e.Interval, e.Wait.Round(100*time.Millisecond))
+}
+
+func (e *TooFrequentError) Unwrap() error {
+	return ErrTooFrequent
+}
+
+// intervalLimit spaces captures at least min apart
+type intervalLimit struct {
+	mu    sync.Mutex
+	min   time.Duration
+	last  time.Time
+	batch int
+
+	// state is a file holding the time of the last capture by any
+	// process, empty to only space this process's captures
+	state string
+}
+
+// SetMinInterval makes captures that start less than d after the
+// previous one fail with ErrTooFrequent (0 for no limit). The time of
+// each capture is recorded in the state file, under a lock, so captures
+// by separate runs (a shell loop, cron) are spaced as well; an empty
+// state only spaces this process's captures.
+func (c *Capturer) SetMinInterval(d time.Duration, state string) {
+	c.limit.mu.Lock()
+	defer c.limit.mu.Unlock()
+	c.limit.min = d
+	c.limit.state = state
+}
+
+// MinInterval returns the minimum interval between captures, 0 if there
+// is none
+func (c *Capturer) MinInterval() time.Duration {
+	c.limit.mu.Lock()
+	defer c.limit.mu.Unlock()
+	return c.limit.min
+}
+
+// Batch runs fn, whose captures (e.g. one per monitor) count as a single
+// capture against the minimum interval
+func (c *Capturer) Batch(fn func() error) error {
+	if err := c.limit.reserve(); err != nil {
+		return err
+	}
+	c.limit.mu.Lock()
+	c.limit.batch++
+	c.limit.mu.Unlock()
+	defer func() {
+		c.limit.mu.Lock()
+		c.limit.batch--
+		c.limit.mu.Unlock()
+	}()
+	return fn()
+}
+
+// reserve claims the next capture slot, or fails with ErrTooFrequent
+func (l *intervalLimit) reserve() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.min <= 0 || l.batch > 0 {
+		return nil
+	}
+
+	last := l.last
+	if l.state != "" {
+		lk, err := lock.Acquire(l.state + ".lock")
+		if err != nil {
+			return fmt.Errorf("failed to check the time since the last capture: %w", err)
+		}
+		defer lk.Release()
+		if t, ok := readLastCapture(l.state); ok && t.After(last) {
+			last = t
+		}
+	}
+
+	// A loop ticking every min starts its captures a few milliseconds
+	// early or late; don't refuse it for that
+	now := time.Now()
+	if wait := last.Add(l.min - l.min/20).Sub(now); !last.IsZero() && wait > 0 {
+		return &TooFrequentError{Interval: l.min, Wait: wait}
+	}
+	if l.state != "" {
+		if err := os.WriteFile(l.state, []byte(strconv.FormatInt(now.UnixNano(), 10)+"\n"), 0600); err != nil {
+			return fmt.Errorf("failed to record the capture time: %w", err)
+		}
+	}
+	l.last = now
+	return nil
+}
+
+// readLastCapture reads the time recorded in a state file. A missing or
+// damaged file, or a time in the future after the clock was set back,
+// reads as no capture.
+func readLastCapture(path string) (time.Time, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	ns, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	t := time.Unix(0, ns)
+	if t.After(time.Now()) {
+		return time.Time{}, false
+	}
+	return t, true
+}
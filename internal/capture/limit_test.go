@@ -0,0 +1,69 @@
+package capture
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestMinIntervalAcrossProcesses runs two separate processes sharing a
+// state file, as two screenshot runs from a shell loop would: the second
+// is refused
+func TestMinIntervalAcrossProcesses(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "last-capture")
+	run := func() error {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestMinIntervalHelper$")
+		cmd.Env = append(os.Environ(), "SCREENSHOT_TEST_LIMIT_STATE="+state)
+		out, err := cmd.CombinedOutput()
+		if len(out) > 0 {
+			t.Logf("%s", out)
+		}
+		return err
+	}
+
+	if err := run(); err != nil {
+		t.Fatalf("first capture was refused: %v", err)
+	}
+	var exit *exec.ExitError
+	if err := run(); !errors.As(err, &exit) || exit.ExitCode() != 3 {
+		t.Fatalf("second capture: got %v, want it refused as too frequent", err)
+	}
+}
+
+// TestMinIntervalHelper is one process of TestMinIntervalAcrossProcesses.
+// It exits with status 3 if its capture is too frequent.
+func TestMinIntervalHelper(t *testing.T) {
+	state := os.Getenv("SCREENSHOT_TEST_LIMIT_STATE")
+	if state == "" {
+		t.Skip("run by TestMinIntervalAcrossProcesses")
+	}
+	l := &intervalLimit{min: time.Hour, state: state}
+	err := l.reserve()
+	if errors.Is(err, ErrTooFrequent) {
+		os.Exit(3)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMinIntervalStateFromFuture(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "last-capture")
+	future := strconv.FormatInt(time.Now().Add(24*time.Hour).UnixNano(), 10)
+	if err := os.WriteFile(state, []byte(future+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// A time ahead of the clock, after it was set back, doesn't block
+	// captures for good
+	l := &intervalLimit{min: time.Hour, state: state}
+	if err := l.reserve(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.reserve(); !errors.Is(err, ErrTooFrequent) {
+		t.Fatalf("got %v, want ErrTooFrequent", err)
+	}
+}
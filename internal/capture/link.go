@@ -0,0 +1,70 @@
+package capture
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// UpdateLatestLink atomically points link at target. A relative symlink
+// is created next to link and renamed over it, so readers never see a
+// missing or half-written file. On filesystems without symlink support the
+// target is copied instead (still via rename).
+func UpdateLatestLink(link, target string) error {
+	dir := filepath.Dir(link)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp := filepath.Join(dir, fmt.Sprintf(".%s.tmp%d", filepath.Base(link), os.Getpid()))
+	os.Remove(tmp)
+
+	if err := os.Symlink(linkTarget(link, target), tmp); err != nil {
+		if err := copyFile(target, tmp); err != nil {
+			return fmt.Errorf("failed to update latest link: %w", err)
+		}
+	}
+
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to update latest link: %w", err)
+	}
+	return nil
+}
+
+// linkTarget returns target relative to the link's directory when
+// possible, so the link survives moving the whole tree
+func linkTarget(link, target string) string {
+	absLink, err1 := filepath.Abs(filepath.Dir(link))
+	absTarget, err2 := filepath.Abs(target)
+	if err1 != nil || err2 != nil {
+		return target
+	}
+
+	rel, err := filepath.Rel(absLink, absTarget)
+	if err != nil {
+		return absTarget
+	}
+	return rel
+}
+
+// copyFile copies src to dst, replacing dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
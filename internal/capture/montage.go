@@ -0,0 +1,35 @@
+package capture
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// MontageGap is the space in pixels between the parts of a montage
+const MontageGap = 16
+
+// Montage stacks parts of img top to bottom, left-aligned on white with
+// MontageGap pixels between them. Parts are in the coordinates of area,
+// the screen area img was captured from, so several regions grabbed in
+// one capture end up in one image.
+func Montage(img image.Image, area image.Rectangle, parts []image.Rectangle) *image.RGBA {
+	size := image.Point{}
+	for i, p := range parts {
+		size.X = max(size.X, p.Dx())
+		size.Y += p.Dy()
+		if i > 0 {
+			size.Y += MontageGap
+		}
+	}
+
+	out := image.NewRGBA(image.Rectangle{Max: size})
+	draw.Draw(out, out.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	y := 0
+	for _, p := range parts {
+		src := p.Sub(area.Min).Add(img.Bounds().Min)
+		draw.Draw(out, image.Rect(0, y, p.Dx(), y+p.Dy()), img, src.Min, draw.Src)
+		y += p.Dy() + MontageGap
+	}
+	return out
+}
@@ -0,0 +1,193 @@
+package capture
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// organizePresets maps --organize shorthands to directory templates
+var organizePresets = map[string]string{
+	"date":      "{year}/{month}/{day}",
+	"month":     "{year}/{month}",
+	"host/date": "{host}/{year}/{month}/{day}",
+	"date/host": "{year}/{month}/{day}/{host}",
+}
+
+var placeholderRe = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// TemplateVars returns the placeholder values available to filename and
+// directory templates for a capture taken at t
+func TemplateVars(t time.Time) map[string]string {
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "unknown-host"
+	}
+	user := os.Getenv("USER")
+	if user == "" {
+		user = "unknown-user"
+	}
+
+	return map[string]string{
+		"year":   t.Format("2006"),
+		"month":  t.Format("01"),
+		"day":    t.Format("02"),
+		"hour":   t.Format("15"),
+		"minute": t.Format("04"),
+		"second": t.Format("05"),
+		"date":   t.Format("2006-01-02"),
+		"time":   t.Format("15-04-05"),
+		"host":   host,
+		"user":   user,
+	}
+}
+
+// ExpandTemplate replaces {placeholder} tokens with values from vars.
+// Values are sanitized so they cannot introduce path separators.
+func ExpandTemplate(tmpl string, vars map[string]string) (string, error) {
+	return expand(tmpl, vars, sanitizeComponent)
+}
+
+// ExpandText replaces {placeholder} tokens with values from vars as they
+// are, for templates that are not file paths
+func ExpandText(tmpl string, vars map[string]string) (string, error) {
+	return expand(tmpl, vars, func(s string) string { return s })
+}
+
+// expand replaces placeholders, passing each value through clean
+func expand(tmpl string, vars map[string]string, clean func(string) string) (string, error) {
+	var missing []string
+	out := placeholderRe.ReplaceAllStringFunc(tmpl, func(tok string) string {
+		name := tok[1 : len(tok)-1]
+		v, ok := vars[name]
+		if !ok {
+			missing = append(missing, name)
+			return tok
+		}
+		return clean(v)
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("unknown template placeholder(s): %s", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+// OrganizeDir expands an --organize pattern (a preset such as "date" or
+// "host/date", or a custom template like "{host}/{year}-{month}") into a
+// relative directory for a capture taken at t
+func OrganizeDir(pattern string, t time.Time) (string, error) {
+	if preset, ok := organizePresets[pattern]; ok {
+		pattern = preset
+	}
+
+	dir, err := ExpandTemplate(pattern, TemplateVars(t))
+	if err != nil {
+		return "", err
+	}
+
+	dir = filepath.Clean(dir)
+	if filepath.IsAbs(dir) || dir == ".." || strings.HasPrefix(dir, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("organize pattern must be a relative path below the output directory: %s", pattern)
+	}
+	return dir, nil
+}
+
+// OrganizePath inserts the organized subdirectory between the directory
+// and filename of path
+func OrganizePath(path, pattern string, t time.Time) (string, error) {
+	if pattern == "" {
+		return path, nil
+	}
+
+	sub, err := OrganizeDir(pattern, t)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), sub, filepath.Base(path)), nil
+}
+
+// sanitizeComponent makes a template value safe to use inside a single
+// path component
+func sanitizeComponent(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', 0:
+			return '-'
+		}
+		return r
+	}, s)
+	if s == "." || s == ".." {
+		return "_"
+	}
+	return s
+}
+
+// maxTitleSlug bounds the title part of window filenames, in runes
+const maxTitleSlug = 48
+
+// WindowFilename names a capture of a window after its class and title,
+// e.g. "firefox_github-issues_2024-06-15.png". Either part is left out
+// when it has nothing to show; with neither the name is "window_...".
+func WindowFilename(class, title string, t time.Time, format Format) string {
+	var parts []string
+	if s := Slug(class, maxTitleSlug); s != "" {
+		parts = append(parts, s)
+	}
+	// A window titled after its class only needs the name once
+	if s := Slug(windowTitle(class, title), maxTitleSlug); s != "" && (len(parts) == 0 || s != parts[0]) {
+		parts = append(parts, s)
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "window")
+	}
+	return strings.Join(append(parts, t.Format("2006-01-02")), "_") + format.Extension()
+}
+
+// windowTitle drops the application's name from the end of a title, as
+// in "GitHub Issues — Mozilla Firefox", when it mentions the class
+func windowTitle(class, title string) string {
+	class = strings.ToLower(strings.TrimSpace(class))
+	if class == "" {
+		return title
+	}
+	for _, sep := range []string{" — ", " – ", " - ", " | "} {
+		i := strings.LastIndex(title, sep)
+		if i > 0 && strings.Contains(strings.ToLower(title[i+len(sep):]), class) {
+			return title[:i]
+		}
+	}
+	return title
+}
+
+// Slug turns text into a lower-case filename part of letters, digits and
+// single dashes, at most limit runes long and cut at a dash when possible
+func Slug(s string, limit int) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+
+	slug := []rune(b.String())
+	if len(slug) <= limit {
+		return string(slug)
+	}
+	cut := string(slug[:limit])
+	if i := strings.LastIndexByte(cut, '-'); i > len(cut)/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimSuffix(cut, "-")
+}
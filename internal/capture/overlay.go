@@ -0,0 +1,158 @@
+package capture
+
+import (
+	"image"
+	"image/draw"
+	"slices"
+
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// minOverlaySize is the smallest black area taken for a video
+var minOverlaySize = image.Pt(128, 96)
+
+// overlaySolid is the share of an area's pixels that must be black for it
+// to count as one black hole rather than dark content
+const overlaySolid = 0.97
+
+// VideoWindow is a window that may show video, e.g. a player or a browser
+type VideoWindow struct {
+	Class  string
+	Bounds image.Rectangle
+}
+
+// BlackArea is part of a capture that is probably video on a hardware
+// overlay plane or DRM-protected, which screen grabs read as black
+type BlackArea struct {
+	// Class is the window it is in
+	Class string
+
+	// Bounds is the area on the desktop
+	Bounds image.Rectangle
+
+	// Filled is set when the overlay policy's fallback filled it in
+	Filled bool
+
+	// FallbackErr is why the fallback failed, if it did
+	FallbackErr error
+}
+
+// OverlayPolicy looks for video that came out black in captures
+type OverlayPolicy struct {
+	// Backends lists the backends whose grabs are checked, those that
+	// read the screen without the compositor, like "x11"
+	Backends []string
+
+	// Windows returns the windows to check. It is called after each grab;
+	// an error skips the check.
+	Windows func() ([]VideoWindow, error)
+
+	// Fallback, if set, grabs area (in desktop coordinates) another way,
+	// e.g. through the compositor, to fill in the black areas found.
+	// Areas that come out black again are left as they are.
+	Fallback func(area image.Rectangle) (image.Image, error)
+
+	// OnBlack is called for each black area found
+	OnBlack func(BlackArea)
+}
+
+// SetOverlayPolicy sets how Capture checks for black video
+func (c *Capturer) SetOverlayPolicy(p OverlayPolicy) {
+	c.overlay = p
+}
+
+// fillOverlays finds the video windows that came out black in img, the
+// capture with opts by strat, reports them and fills them in with the
+// fallback
+func (c *Capturer) fillOverlays(strat strategy.Strategy, img image.Image, opts strategy.CaptureOptions) (image.Image, error) {
+	if c.overlay.Windows == nil || !slices.Contains(c.overlay.Backends, strat.Name()) {
+		return img, nil
+	}
+	windows, err := c.overlay.Windows()
+	if err != nil || len(windows) == 0 {
+		return img, nil
+	}
+	monitors, err := c.ListMonitors()
+	if err != nil {
+		return nil, err
+	}
+	origin := Area(opts, monitors).Min
+
+	rgba := ToRGBA(img)
+	var found []BlackArea
+	var union image.Rectangle
+	for _, w := range windows {
+		r := w.Bounds.Sub(origin).Add(rgba.Rect.Min).Intersect(rgba.Rect)
+		if hole, ok := blackHole(rgba, r); ok {
+			found = append(found, BlackArea{Class: w.Class, Bounds: hole.Sub(rgba.Rect.Min).Add(origin)})
+			union = union.Union(found[len(found)-1].Bounds)
+		}
+	}
+	if len(found) == 0 {
+		return img, nil
+	}
+
+	if c.overlay.Fallback != nil {
+		fill, err := c.overlay.Fallback(union)
+		if err == nil {
+			src := ToRGBA(fill)
+			for i, a := range found {
+				if _, black := blackHole(src, a.Bounds.Sub(union.Min).Add(src.Rect.Min)); black {
+					continue
+				}
+				draw.Draw(rgba, a.Bounds.Sub(origin).Add(rgba.Rect.Min), src, a.Bounds.Sub(union.Min).Add(src.Rect.Min).Min, draw.Src)
+				found[i].Filled = true
+			}
+			img = rgba
+		} else {
+			for i := range found {
+				found[i].FallbackErr = err
+			}
+		}
+	}
+	if c.overlay.OnBlack != nil {
+		for _, a := range found {
+			c.overlay.OnBlack(a)
+		}
+	}
+	return img, nil
+}
+
+// blackHole finds the black rectangle in r of img: the bounding box of
+// rows' black runs at least minOverlaySize wide, if it is large enough
+// and almost all black
+func blackHole(img *image.RGBA, r image.Rectangle) (image.Rectangle, bool) {
+	r = r.Intersect(img.Rect)
+	if r.Dx() < minOverlaySize.X || r.Dy() < minOverlaySize.Y {
+		return image.Rectangle{}, false
+	}
+	var box image.Rectangle
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(r.Min.X, y) : img.PixOffset(r.Max.X-1, y)+4]
+		run := 0
+		for x := 0; x <= r.Dx(); x++ {
+			if x < r.Dx() && row[4*x] == 0 && row[4*x+1] == 0 && row[4*x+2] == 0 {
+				run++
+				continue
+			}
+			if run >= minOverlaySize.X {
+				box = box.Union(image.Rect(r.Min.X+x-run, y, r.Min.X+x, y+1))
+			}
+			run = 0
+		}
+	}
+	if box.Dx() < minOverlaySize.X || box.Dy() < minOverlaySize.Y {
+		return image.Rectangle{}, false
+	}
+
+	black := 0
+	for y := box.Min.Y; y < box.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(box.Min.X, y) : img.PixOffset(box.Max.X-1, y)+4]
+		for i := 0; i < len(row); i += 4 {
+			if row[i] == 0 && row[i+1] == 0 && row[i+2] == 0 {
+				black++
+			}
+		}
+	}
+	return box, float64(black) >= overlaySolid*float64(box.Dx()*box.Dy())
+}
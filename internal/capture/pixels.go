@@ -0,0 +1,42 @@
+package capture
+
+import (
+	"image"
+	"image/draw"
+)
+
+// owned returns img as one of the image types Capture documents,
+// converting others (e.g. decoded by a backend) to RGBA
+func owned(img image.Image) image.Image {
+	switch img.(type) {
+	case *image.RGBA, *image.NRGBA, *image.Gray, *image.Paletted:
+		return img
+	}
+	return ToRGBA(img)
+}
+
+// ToRGBA returns img as RGBA (premultiplied alpha), with the same bounds.
+// An *image.RGBA is returned as is, sharing its pixels; anything else is
+// copied.
+func ToRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(b)
+	draw.Draw(rgba, b, img, b.Min, draw.Src)
+	return rgba
+}
+
+// ToNRGBA returns img as NRGBA (straight alpha), with the same bounds.
+// An *image.NRGBA is returned as is, sharing its pixels; anything else is
+// copied.
+func ToNRGBA(img image.Image) *image.NRGBA {
+	if nrgba, ok := img.(*image.NRGBA); ok {
+		return nrgba
+	}
+	b := img.Bounds()
+	nrgba := image.NewNRGBA(b)
+	draw.Draw(nrgba, b, img, b.Min, draw.Src)
+	return nrgba
+}
@@ -0,0 +1,62 @@
+package capture
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+)
+
+// PNGColor is the color type of PNG output
+type PNGColor string
+
+const (
+	// PNGAuto writes what the image needs: RGB when it is opaque, RGBA
+	// otherwise, and grayscale and palette images as they are (default)
+	PNGAuto PNGColor = ""
+
+	// PNGRGB always drops the alpha channel: transparent areas, as in
+	// window captures with alpha, come out black
+	PNGRGB PNGColor = "rgb"
+
+	// PNGGray writes 8-bit grayscale, a third of RGB's raw size, for
+	// terminals, logs and OCR
+	PNGGray PNGColor = "gray"
+)
+
+// ParsePNGColor parses a PNG color type as given on the command line
+func ParsePNGColor(s string) (PNGColor, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "auto":
+		return PNGAuto, nil
+	case "rgb":
+		return PNGRGB, nil
+	case "gray", "grey":
+		return PNGGray, nil
+	}
+	return "", fmt.Errorf("unknown PNG color type %q (expected auto, rgb or gray)", s)
+}
+
+// pngImage converts img to the pixels written as a PNG of color type c
+func pngImage(img image.Image, c PNGColor) image.Image {
+	b := img.Bounds()
+	switch c {
+	case PNGRGB:
+		if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+			return img
+		}
+		rgba := image.NewRGBA(b)
+		draw.Draw(rgba, b, image.NewUniform(color.Black), image.Point{}, draw.Src)
+		draw.Draw(rgba, b, img, b.Min, draw.Over)
+		return rgba
+	case PNGGray:
+		if _, ok := img.(*image.Gray); ok {
+			return img
+		}
+		gray := image.NewGray(b)
+		draw.Draw(gray, b, img, b.Min, draw.Src)
+		return gray
+	}
+	return img
+}
@@ -0,0 +1,103 @@
+package capture
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// pngHeaderSize is the signature and IHDR chunk every PNG starts with
+const pngHeaderSize = 8 + 12 + 13
+
+// pngChunk is an ancillary PNG chunk
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// pngMetadata returns the ancillary chunks opts asks for, in file order
+func pngMetadata(opts EncodeOptions) []pngChunk {
+	var chunks []pngChunk
+	if opts.SRGB {
+		// Perceptual intent, with the gAMA the spec pairs with sRGB for
+		// decoders that only know gamma
+		gama := make([]byte, 4)
+		binary.BigEndian.PutUint32(gama, 45455)
+		chunks = append(chunks, pngChunk{"sRGB", []byte{0}}, pngChunk{"gAMA", gama})
+	}
+	if opts.DPI > 0 {
+		phys := make([]byte, 9)
+		ppm := uint32(math.Round(opts.DPI / 0.0254))
+		binary.BigEndian.PutUint32(phys[0:], ppm)
+		binary.BigEndian.PutUint32(phys[4:], ppm)
+		phys[8] = 1 // metres
+		chunks = append(chunks, pngChunk{"pHYs", phys})
+	}
+	return chunks
+}
+
+// metaWriter passes a PNG through, adding chunks after its IHDR
+type metaWriter struct {
+	w      io.Writer
+	chunks []pngChunk
+	n      int
+}
+
+func (m *metaWriter) Write(p []byte) (int, error) {
+	if m.n >= pngHeaderSize {
+		return m.w.Write(p)
+	}
+	head := min(len(p), pngHeaderSize-m.n)
+	if _, err := m.w.Write(p[:head]); err != nil {
+		return 0, err
+	}
+	if m.n += head; m.n == pngHeaderSize {
+		for _, c := range m.chunks {
+			if err := writeChunk(m.w, c.typ, c.data); err != nil {
+				return head, err
+			}
+		}
+	}
+	if head == len(p) {
+		return head, nil
+	}
+	n, err := m.w.Write(p[head:])
+	return head + n, err
+}
+
+// DPI returns the pixel density of a capture with opts, for the pHYs
+// chunk: that of the monitor it mostly shows, as scaled by mixed-DPI
+// stitching. It returns 0 when the monitor's physical size is unknown.
+func (c *Capturer) DPI(opts strategy.CaptureOptions) float64 {
+	monitors, err := c.ListMonitors()
+	if err != nil || len(monitors) == 0 {
+		return 0
+	}
+	area := Area(opts, monitors)
+	best, most := -1, 0
+	for i, m := range monitors {
+		r := m.Bounds.Intersect(area)
+		if size := r.Dx() * r.Dy(); size > most {
+			best, most = i, size
+		}
+	}
+	if best < 0 {
+		// Windows: the primary monitor is the best guess
+		best = 0
+		for i, m := range monitors {
+			if m.Primary {
+				best = i
+			}
+		}
+	}
+
+	dpi := monitors[best].DPI()
+	if c.scales != nil && opts.Monitor == -1 && opts.Region == nil && opts.WindowID == 0 {
+		if scales, err := c.scales(monitors); err == nil && scales != nil {
+			dpi *= scales[best]
+		}
+	}
+	return dpi
+}
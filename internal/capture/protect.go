@@ -0,0 +1,60 @@
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+// ErrProtectedWindow is returned for captures that would show a protected
+// window when the policy is to abort
+var ErrProtectedWindow = errors.New("a protected window is on screen")
+
+// ProtectedWindow is a window that must never appear in a capture
+type ProtectedWindow struct {
+	Class  string
+	Bounds image.Rectangle
+}
+
+// ProtectedPolicy keeps windows such as password managers out of every
+// capture
+type ProtectedPolicy struct {
+	// Windows returns the protected windows currently on screen. It is
+	// called after each grab; an error fails the capture, since without
+	// the list no capture can be known to be safe.
+	Windows func() ([]ProtectedWindow, error)
+
+	// Abort fails captures that overlap a protected window with
+	// ErrProtectedWindow instead of blacking the window out
+	Abort bool
+}
+
+// SetProtectedPolicy sets the windows to keep out of captures
+func (c *Capturer) SetProtectedPolicy(p ProtectedPolicy) {
+	c.protected = p
+}
+
+// protectedZones returns the protected windows' areas that overlap area,
+// or ErrProtectedWindow if there are some and the policy is to abort
+func (c *Capturer) protectedZones(area image.Rectangle) ([]image.Rectangle, error) {
+	if c.protected.Windows == nil {
+		return nil, nil
+	}
+	windows, err := c.protected.Windows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for protected windows: %w", err)
+	}
+
+	var zones []image.Rectangle
+	for _, w := range windows {
+		if !w.Bounds.Overlaps(area) {
+			continue
+		}
+		if c.protected.Abort {
+			return nil, fmt.Errorf("%w (%s at %d,%d %dx%d)", ErrProtectedWindow,
+				w.Class, w.Bounds.Min.X, w.Bounds.Min.Y, w.Bounds.Dx(), w.Bounds.Dy())
+		}
+		zones = append(zones, w.Bounds)
+	}
+	return zones, nil
+}
@@ -0,0 +1,225 @@
+//go:build !noqoi && !minimal
+
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+)
+
+func init() {
+	registerEncoder(FormatQOI, func(img image.Image, w io.Writer, opts EncodeOptions) error {
+		return WriteQOI(img, w)
+	})
+	// So diff and heatmap can read QOI captures back
+	image.RegisterFormat("qoi", qoiMagic, DecodeQOI, DecodeQOIConfig)
+}
+
+// QOI opcodes (https://qoiformat.org/qoi-specification.pdf)
+const (
+	qoiOpIndex = 0x00
+	qoiOpDiff  = 0x40
+	qoiOpLuma  = 0x80
+	qoiOpRun   = 0xc0
+	qoiOpRGB   = 0xfe
+	qoiOpRGBA  = 0xff
+	qoiMask    = 0xc0
+
+	qoiMagic = "qoif"
+
+	// qoiMaxPixels bounds decoding, as the reference decoder does
+	qoiMaxPixels = 400_000_000
+)
+
+// qoiEnd is the stream's end marker
+var qoiEnd = []byte{0, 0, 0, 0, 0, 0, 0, 1}
+
+// qoiPixel is a non-premultiplied RGBA color
+type qoiPixel [4]byte
+
+// hash is the pixel's slot in the index of recently seen colors
+func (p qoiPixel) hash() byte {
+	return (p[0]*3 + p[1]*5 + p[2]*7 + p[3]*11) % 64
+}
+
+// WriteQOI writes an image as QOI: lossless like PNG, encoded in a single
+// fast pass with no compression stage, at a larger size. Opaque images
+// are written with 3 channels.
+func WriteQOI(img image.Image, w io.Writer) error {
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return fmt.Errorf("cannot encode an empty image as QOI")
+	}
+
+	// QOI stores straight alpha: opaque RGBA pixels can be used as they
+	// are, anything else is converted
+	var pix []byte
+	var stride int
+	channels := byte(3)
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Opaque() {
+		pix, stride = rgba.Pix[rgba.PixOffset(b.Min.X, b.Min.Y):], rgba.Stride
+	} else {
+		nrgba := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(nrgba, nrgba.Rect, img, b.Min, draw.Src)
+		pix, stride = nrgba.Pix, nrgba.Stride
+		if !nrgba.Opaque() {
+			channels = 4
+		}
+	}
+
+	// Opcodes are appended to buf, written out whenever it fills
+	buf := make([]byte, 14, 64<<10)
+	copy(buf, qoiMagic)
+	binary.BigEndian.PutUint32(buf[4:], uint32(b.Dx()))
+	binary.BigEndian.PutUint32(buf[8:], uint32(b.Dy()))
+	buf[12] = channels
+	buf[13] = 0 // sRGB with linear alpha
+
+	var index [64]qoiPixel
+	prev := qoiPixel{0, 0, 0, 255}
+	run := 0
+	for y := 0; y < b.Dy(); y++ {
+		row := pix[y*stride : y*stride+b.Dx()*4]
+		for x := 0; x < len(row); x += 4 {
+			if len(buf) > cap(buf)-8 {
+				if _, err := w.Write(buf); err != nil {
+					return fmt.Errorf("failed to encode QOI: %w", err)
+				}
+				buf = buf[:0]
+			}
+
+			px := qoiPixel{row[x], row[x+1], row[x+2], row[x+3]}
+			if px == prev {
+				run++
+				if run == 62 {
+					buf = append(buf, qoiOpRun|byte(run-1))
+					run = 0
+				}
+				continue
+			}
+			if run > 0 {
+				buf = append(buf, qoiOpRun|byte(run-1))
+				run = 0
+			}
+
+			h := px.hash()
+			switch {
+			case index[h] == px:
+				buf = append(buf, qoiOpIndex|h)
+			case px[3] != prev[3]:
+				index[h] = px
+				buf = append(buf, qoiOpRGBA, px[0], px[1], px[2], px[3])
+			default:
+				index[h] = px
+				dr := int8(px[0] - prev[0])
+				dg := int8(px[1] - prev[1])
+				db := int8(px[2] - prev[2])
+				drg, dbg := dr-dg, db-dg
+				switch {
+				case dr >= -2 && dr <= 1 && dg >= -2 && dg <= 1 && db >= -2 && db <= 1:
+					buf = append(buf, qoiOpDiff|byte(dr+2)<<4|byte(dg+2)<<2|byte(db+2))
+				case dg >= -32 && dg <= 31 && drg >= -8 && drg <= 7 && dbg >= -8 && dbg <= 7:
+					buf = append(buf, qoiOpLuma|byte(dg+32), byte(drg+8)<<4|byte(dbg+8))
+				default:
+					buf = append(buf, qoiOpRGB, px[0], px[1], px[2])
+				}
+			}
+			prev = px
+		}
+	}
+	if run > 0 {
+		buf = append(buf, qoiOpRun|byte(run-1))
+	}
+	buf = append(buf, qoiEnd...)
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("failed to encode QOI: %w", err)
+	}
+	return nil
+}
+
+// DecodeQOIConfig reads a QOI image's size
+func DecodeQOIConfig(r io.Reader) (image.Config, error) {
+	w, h, _, err := readQOIHeader(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.NRGBAModel, Width: w, Height: h}, nil
+}
+
+// readQOIHeader reads and checks the 14-byte header
+func readQOIHeader(r io.Reader) (w, h int, channels byte, err error) {
+	var header [14]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid QOI header: %w", err)
+	}
+	if string(header[:4]) != qoiMagic {
+		return 0, 0, 0, errors.New("not a QOI image")
+	}
+	w = int(binary.BigEndian.Uint32(header[4:]))
+	h = int(binary.BigEndian.Uint32(header[8:]))
+	channels = header[12]
+	if w == 0 || h == 0 || channels < 3 || channels > 4 || header[13] > 1 {
+		return 0, 0, 0, errors.New("invalid QOI header")
+	}
+	if w*h > qoiMaxPixels {
+		return 0, 0, 0, fmt.Errorf("QOI image too large: %dx%d", w, h)
+	}
+	return w, h, channels, nil
+}
+
+// DecodeQOI reads a QOI image
+func DecodeQOI(r io.Reader) (image.Image, error) {
+	br := bufio.NewReaderSize(r, 64<<10)
+	w, h, _, err := readQOIHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	var index [64]qoiPixel
+	px := qoiPixel{0, 0, 0, 255}
+	run := 0
+	for i := 0; i < len(img.Pix); i += 4 {
+		if run > 0 {
+			run--
+		} else {
+			b1, err := br.ReadByte()
+			if err != nil {
+				return nil, fmt.Errorf("truncated QOI image: %w", err)
+			}
+			switch {
+			case b1 == qoiOpRGB:
+				_, err = io.ReadFull(br, px[:3])
+			case b1 == qoiOpRGBA:
+				_, err = io.ReadFull(br, px[:])
+			case b1&qoiMask == qoiOpIndex:
+				px = index[b1]
+			case b1&qoiMask == qoiOpDiff:
+				px[0] += (b1>>4)&3 - 2
+				px[1] += (b1>>2)&3 - 2
+				px[2] += b1&3 - 2
+			case b1&qoiMask == qoiOpLuma:
+				var b2 byte
+				b2, err = br.ReadByte()
+				dg := b1&0x3f - 32
+				px[0] += dg + (b2>>4)&0x0f - 8
+				px[1] += dg
+				px[2] += dg + b2&0x0f - 8
+			default:
+				run = int(b1 & 0x3f)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("truncated QOI image: %w", err)
+			}
+			index[px.hash()] = px
+		}
+		copy(img.Pix[i:i+4], px[:])
+	}
+	return img, nil
+}
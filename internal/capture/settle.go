@@ -0,0 +1,78 @@
+package capture
+
+import (
+	"image"
+	"time"
+
+	"github.com/robotin/screenshot/internal/imghash"
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// SettlePolicy makes captures wait until the captured area stops
+// changing, so animating UIs aren't caught half-rendered
+type SettlePolicy struct {
+	// Quiet is how long the area must stay unchanged; 0 disables settling
+	Quiet time.Duration
+
+	// Timeout bounds the wait; the last frame is used when it expires
+	Timeout time.Duration
+
+	// OnTimeout, if set, is called when the area was still changing at
+	// Timeout
+	OnTimeout func(waited time.Duration)
+}
+
+// settleInterval returns how often the area is sampled while settling
+func (p SettlePolicy) settleInterval() time.Duration {
+	return min(max(p.Quiet/5, 20*time.Millisecond), 200*time.Millisecond)
+}
+
+// SetSettlePolicy sets the settle policy used by Capture
+func (c *Capturer) SetSettlePolicy(p SettlePolicy) {
+	c.settle = p
+}
+
+// grab captures with strat: once the area has settled, then the rest of
+// a long exposure
+func (c *Capturer) grab(strat strategy.Strategy, opts strategy.CaptureOptions) (image.Image, error) {
+	img, err := c.settled(strat, opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.expose(strat, opts, img)
+}
+
+// settled captures with strat, sampling until the image has been
+// identical for the settle policy's quiet period
+func (c *Capturer) settled(strat strategy.Strategy, opts strategy.CaptureOptions) (image.Image, error) {
+	img, err := strat.Capture(opts)
+	if err != nil || c.settle.Quiet <= 0 {
+		return img, err
+	}
+
+	start := time.Now()
+	hash := imghash.Sum(img, imghash.Exact)
+	stableSince := start
+	for {
+		now := time.Now()
+		if now.Sub(stableSince) >= c.settle.Quiet {
+			return img, nil
+		}
+		if c.settle.Timeout > 0 && now.Sub(start) >= c.settle.Timeout {
+			if c.settle.OnTimeout != nil {
+				c.settle.OnTimeout(now.Sub(start))
+			}
+			return img, nil
+		}
+
+		time.Sleep(c.settle.settleInterval())
+		next, err := strat.Capture(opts)
+		if err != nil {
+			return nil, err
+		}
+		if h := imghash.Sum(next, imghash.Exact); h != hash {
+			hash, stableSince = h, time.Now()
+		}
+		img = next
+	}
+}
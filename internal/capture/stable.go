@@ -0,0 +1,144 @@
+package capture
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"slices"
+)
+
+// WriteStablePNG writes a PNG whose bytes depend only on the pixels, so
+// the same screen content always gives an identical file, whatever
+// backend captured it: golden screenshots kept in git then only change
+// when the screen did. Encoder settings are fixed (best compression, no
+// filter for palette images and Paeth for the others, no ancillary
+// chunks such as timestamps or gamma). Images with at most 256 colors,
+// which most UI screenshots of flat themes are, are written with a
+// palette sorted by color, which is also much smaller. Output is stable
+// for a given build; a different Go release's zlib may compress
+// differently.
+func WriteStablePNG(img image.Image, w io.Writer) error {
+	if err := writeStablePNG(img, w); err != nil {
+		return fmt.Errorf("failed to encode PNG: %w", err)
+	}
+	return nil
+}
+
+func writeStablePNG(img image.Image, w io.Writer) error {
+	b := img.Bounds()
+	nrgba := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(nrgba, nrgba.Bounds(), img, b.Min, draw.Src)
+
+	palette := stablePalette(nrgba)
+	opaque := nrgba.Opaque()
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString("\x89PNG\r\n\x1a\n"); err != nil {
+		return err
+	}
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(b.Dx()))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(b.Dy()))
+	ihdr[8] = 8 // bit depth
+	switch {
+	case palette != nil:
+		ihdr[9] = 3
+	case opaque:
+		ihdr[9] = 2
+	default:
+		ihdr[9] = 6
+	}
+	if err := writeChunk(bw, "IHDR", ihdr); err != nil {
+		return err
+	}
+
+	// Pixels as they go into the image data: palette indexes or RGB(A)
+	var index map[uint32]byte
+	bpp, filter := 4, byte(4)
+	if opaque {
+		bpp = 3
+	}
+	if palette != nil {
+		plte := make([]byte, 0, len(palette)*3)
+		trns := make([]byte, 0, len(palette))
+		index = make(map[uint32]byte, len(palette))
+		for i, c := range palette {
+			plte = append(plte, byte(c>>24), byte(c>>16), byte(c>>8))
+			trns = append(trns, byte(c))
+			index[c] = byte(i)
+		}
+		if err := writeChunk(bw, "PLTE", plte); err != nil {
+			return err
+		}
+		if !opaque {
+			if err := writeChunk(bw, "tRNS", trns); err != nil {
+				return err
+			}
+		}
+		bpp, filter = 1, 0
+	}
+
+	idat := &idatWriter{w: bw}
+	zw, err := zlib.NewWriterLevel(idat, zlib.BestCompression)
+	if err != nil {
+		return err
+	}
+	width := b.Dx()
+	prev := make([]byte, width*bpp)
+	cur := make([]byte, width*bpp)
+	for y := 0; y < b.Dy(); y++ {
+		row := nrgba.Pix[y*nrgba.Stride : y*nrgba.Stride+width*4]
+		for x := 0; x < width; x++ {
+			px := row[x*4 : x*4+4]
+			if index != nil {
+				cur[x] = index[binary.BigEndian.Uint32(px)]
+			} else {
+				copy(cur[x*bpp:], px[:bpp])
+			}
+		}
+		out, _ := applyFilter(filter, cur, prev, bpp)
+		if _, err := zw.Write(out); err != nil {
+			return err
+		}
+		prev, cur = cur, prev
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := idat.flush(); err != nil {
+		return err
+	}
+	if err := writeChunk(bw, "IEND", nil); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// stablePalette returns img's colors as RGBA values in ascending order,
+// or nil if it has more than 256
+func stablePalette(img *image.NRGBA) []uint32 {
+	seen := map[uint32]bool{}
+	for y := 0; y < img.Rect.Dy(); y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+img.Rect.Dx()*4]
+		for x := 0; x < len(row); x += 4 {
+			c := binary.BigEndian.Uint32(row[x:])
+			if !seen[c] {
+				if len(seen) == 256 {
+					return nil
+				}
+				seen[c] = true
+			}
+		}
+	}
+	palette := make([]uint32, 0, len(seen))
+	for c := range seen {
+		palette = append(palette, c)
+	}
+	slices.Sort(palette)
+	return palette
+}
@@ -0,0 +1,96 @@
+package capture
+
+import (
+	"image"
+	"io"
+	"time"
+)
+
+// Stats breaks down where a capture spent its time, for tuning format
+// and compression choices
+type Stats struct {
+	// Grab is the time the backend took, including settling and failed
+	// attempts but not the delay between retries
+	Grab time.Duration
+
+	// Composite is the time spent stitching mixed-DPI monitors
+	Composite time.Duration
+
+	// Transforms covers channel order fixes, redaction, the background
+	// and document conversion
+	Transforms time.Duration
+
+	// Encode and Write split the time spent producing the output: Write
+	// is the time blocked writing encoded bytes, Encode the rest
+	Encode time.Duration
+	Write  time.Duration
+
+	// Verify is the time spent reading a saved PNG back (--verify)
+	Verify time.Duration
+
+	// Bytes is the size of the encoded output
+	Bytes int64
+}
+
+// since adds the time elapsed since start to d and returns the current time
+func since(d *time.Duration, start time.Time) time.Time {
+	now := time.Now()
+	*d += now.Sub(start)
+	return now
+}
+
+// EncodeTimed is Encode, recording the encode and write times and the
+// output size in stats
+func EncodeTimed(img image.Image, w io.Writer, opts EncodeOptions, stats *Stats) error {
+	size := stats.Bytes
+	err := encodeTimed(img, w, "", opts, stats)
+	opts.report("", PhaseDone, stats.Bytes-size)
+	return err
+}
+
+// encodeTimed is EncodeTimed for the file at path, reporting progress
+// until the encoder is done
+func encodeTimed(img image.Image, w io.Writer, path string, opts EncodeOptions, stats *Stats) error {
+	tw := &timedWriter{w: w}
+	if opts.Progress != nil {
+		tw.progress = func(n int64) { opts.Progress(path, PhaseEncode, n) }
+	}
+	start := time.Now()
+	err := Encode(img, tw, opts)
+	if err != nil && tw.err == nil {
+		f := opts.Format
+		if f == "" {
+			f = FormatPNG
+		}
+		err = &EncoderError{Format: f, Err: err}
+	}
+	stats.Encode += time.Since(start) - tw.elapsed
+	stats.Write += tw.elapsed
+	stats.Bytes += tw.n
+	return err
+}
+
+// timedWriter measures the time spent in the underlying writer. err is
+// the first write error, telling the writer's failures from the
+// encoder's.
+type timedWriter struct {
+	w        io.Writer
+	elapsed  time.Duration
+	n        int64
+	err      error
+	progress func(n int64)
+}
+
+func (tw *timedWriter) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := tw.w.Write(p)
+	tw.elapsed += time.Since(start)
+	tw.n += int64(n)
+	if err != nil && tw.err == nil {
+		tw.err = err
+	}
+	if tw.progress != nil {
+		tw.progress(tw.n)
+	}
+	return n, err
+}
@@ -0,0 +1,58 @@
+package capture
+
+import (
+	"image"
+
+	"github.com/robotin/screenshot/internal/layout"
+	"github.com/robotin/screenshot/internal/strategy"
+	xdraw "golang.org/x/image/draw"
+)
+
+// SetScales sets a function returning the factor each monitor is scaled
+// by in all-monitor captures, to stitch mixed-DPI desktops the way they
+// look rather than in raw pixels. It returns nil to leave captures as is.
+func (c *Capturer) SetScales(scales func(monitors []strategy.Monitor) ([]float64, error)) {
+	c.scales = scales
+}
+
+// stitch rescales the monitors of an all-monitor capture and reassembles
+// them with layout.Normalize
+func (c *Capturer) stitch(img image.Image, opts strategy.CaptureOptions) (image.Image, error) {
+	if c.scales == nil || opts.Monitor != -1 || opts.Region != nil || opts.WindowID != 0 {
+		return img, nil
+	}
+
+	monitors, err := c.ListMonitors()
+	if err != nil {
+		return nil, err
+	}
+	scales, err := c.scales(monitors)
+	if err != nil || scales == nil {
+		return img, err
+	}
+	same := true
+	for _, s := range scales {
+		same = same && s == 1
+	}
+	if same {
+		return img, nil
+	}
+
+	bounds := make([]image.Rectangle, len(monitors))
+	for i, m := range monitors {
+		bounds[i] = m.Bounds
+	}
+	placed := layout.Normalize(bounds, scales)
+
+	// The capture's top-left pixel is the top-left of the desktop
+	origin := layout.Bounds(monitors).Min.Sub(img.Bounds().Min)
+	parts := make([]strategy.Part, len(monitors))
+	var area image.Rectangle
+	for i, m := range monitors {
+		scaled := image.NewRGBA(image.Rect(0, 0, placed[i].Dx(), placed[i].Dy()))
+		xdraw.CatmullRom.Scale(scaled, scaled.Bounds(), img, m.Bounds.Sub(origin), xdraw.Src, nil)
+		parts[i] = strategy.Part{Bounds: placed[i], Image: scaled}
+		area = area.Union(placed[i])
+	}
+	return strategy.Composite(area, parts), nil
+}
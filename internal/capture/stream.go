@@ -0,0 +1,163 @@
+package capture
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"slices"
+	"time"
+
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// streamLayoutInterval is how often Stream checks the monitor layout
+const streamLayoutInterval = time.Second
+
+// ErrStopStream can be returned by a Stream callback to end the stream
+// without an error
+var ErrStopStream = errors.New("stop stream")
+
+// Frame is one frame of a Stream
+type Frame struct {
+	// Image is the frame. It is only valid until the callback returns:
+	// Stream may reuse its buffer for later frames, so copy it to keep it.
+	Image *image.RGBA
+
+	// Seq numbers the frames delivered, from 0
+	Seq int
+
+	// Time is when the frame was grabbed
+	Time time.Time
+
+	// Dropped is how many frame slots were skipped before this one
+	// because capturing or the callback took longer than a frame
+	Dropped int
+
+	// Monitors is the current monitor layout
+	Monitors []strategy.Monitor
+
+	// LayoutChanged is set on the first frame after the monitor layout
+	// changed (and on the first frame)
+	LayoutChanged bool
+}
+
+// Stream captures frames at fps and passes them to fn until ctx is done
+// or fn returns an error, which Stream returns (nil for ErrStopStream).
+// Frames go through the same policies as Capture. Pacing is steady: when
+// a frame takes too long, the slots it overran are dropped and counted
+// rather than captured back to back. The monitor layout is checked about
+// once a second; a capture that fails while the layout changes (a monitor
+// unplugged) is dropped instead of ending the stream.
+func (c *Capturer) Stream(ctx context.Context, opts strategy.CaptureOptions, fps float64, fn func(Frame) error) error {
+	if fps <= 0 {
+		return fmt.Errorf("invalid frame rate %g", fps)
+	}
+	interval := time.Duration(float64(time.Second) / fps)
+	if limit := c.MinInterval(); limit > interval {
+		return fmt.Errorf("%g frames per second is more frequent than the policy allows: one capture every %s", fps, limit)
+	}
+
+	s := &stream{c: c}
+	if _, err := s.refreshLayout(); err != nil {
+		return err
+	}
+
+	next := time.Now()
+	dropped := 0
+	for seq := 0; ; {
+		if wait := time.Until(next); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil
+			case <-timer.C:
+			}
+		} else if ctx.Err() != nil {
+			return nil
+		}
+
+		if time.Since(s.checked) >= streamLayoutInterval {
+			if _, err := s.refreshLayout(); err != nil {
+				return err
+			}
+		}
+		at := time.Now()
+		img, err := c.Capture(opts)
+		if err != nil {
+			// A monitor coming or going can fail the capture it happens
+			// under; the next slot sees the new layout
+			if changed, lerr := s.refreshLayout(); lerr != nil || !changed {
+				return err
+			}
+			dropped++
+		} else {
+			err = fn(Frame{
+				Image:         s.rgba(img),
+				Seq:           seq,
+				Time:          at,
+				Dropped:       dropped,
+				Monitors:      s.monitors,
+				LayoutChanged: s.changed,
+			})
+			if errors.Is(err, ErrStopStream) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			seq++
+			dropped = 0
+			s.changed = false
+		}
+
+		// Skip the slots this frame overran
+		next = next.Add(interval)
+		if late := time.Since(next); late > 0 {
+			missed := int(late/interval) + 1
+			dropped += missed
+			next = next.Add(time.Duration(missed) * interval)
+		}
+	}
+}
+
+// stream is the state of a Stream between frames
+type stream struct {
+	c        *Capturer
+	monitors []strategy.Monitor
+	changed  bool
+	checked  time.Time
+
+	// buf is reused for frames that don't come as RGBA
+	buf *image.RGBA
+}
+
+// refreshLayout reads the monitor layout and reports whether it changed
+// (it has on the first read); the next frame is marked when it did
+func (s *stream) refreshLayout() (bool, error) {
+	monitors, err := s.c.ListMonitors()
+	if err != nil {
+		return false, err
+	}
+	s.checked = time.Now()
+	if s.monitors != nil && slices.Equal(monitors, s.monitors) {
+		return false, nil
+	}
+	s.monitors, s.changed = monitors, true
+	return true, nil
+}
+
+// rgba returns img as RGBA, converting into the reused buffer if needed
+func (s *stream) rgba(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	b := img.Bounds()
+	if s.buf == nil || s.buf.Rect != b {
+		s.buf = image.NewRGBA(b)
+	}
+	draw.Draw(s.buf, b, img, b.Min, draw.Src)
+	return s.buf
+}
@@ -0,0 +1,36 @@
+//go:build !nosvg && !minimal
+
+package capture
+
+import (
+	"bytes"
+	"image"
+	"io"
+
+	"github.com/robotin/screenshot/internal/annotate"
+)
+
+func init() {
+	registerEncoder(FormatSVG, func(img image.Image, w io.Writer, opts EncodeOptions) error {
+		return WriteSVG(img, w, opts.CompressionLevel, opts.Annotations)
+	})
+}
+
+// WriteSVG writes an image as SVG: the pixels as an embedded PNG, with
+// annotations as editable elements on top. Fills are redactions and are
+// burned into the PNG.
+func WriteSVG(img image.Image, w io.Writer, level int, ops []annotate.Op) error {
+	fills, rest := annotate.SplitFills(ops)
+	if len(fills) > 0 {
+		var err error
+		if img, err = annotate.Apply(img, fills); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WritePNG(img, &buf, level); err != nil {
+		return err
+	}
+	return annotate.WriteSVG(w, img.Bounds().Size(), buf.Bytes(), rest)
+}
@@ -0,0 +1,58 @@
+package capture
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+)
+
+// Verify re-reads a saved PNG from disk, decodes it and checks that its
+// pixels match img, to catch corruption by the encoder, the filesystem or
+// the storage behind it. The file's cached pages are dropped first where
+// the platform allows it, so the check reads what actually reached the
+// disk rather than the copy still in memory.
+func Verify(img image.Image, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	defer f.Close()
+	dropCache(f)
+
+	saved, err := png.Decode(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("verification failed: %s is unreadable: %w", path, err)
+	}
+
+	want, got := img.Bounds(), saved.Bounds()
+	if want.Dx() != got.Dx() || want.Dy() != got.Dy() {
+		return fmt.Errorf("verification failed: %s is %dx%d, expected %dx%d", path, got.Dx(), got.Dy(), want.Dx(), want.Dy())
+	}
+	if a, b := pixelChecksum(img), pixelChecksum(saved); a != b {
+		return fmt.Errorf("verification failed: %s does not match the capture (pixel checksum %x, expected %x)", path, b[:8], a[:8])
+	}
+	return nil
+}
+
+// pixelChecksum hashes an image's 8-bit RGBA pixels row by row
+func pixelChecksum(img image.Image) [sha256.Size]byte {
+	b := img.Bounds()
+	rgba, ok := img.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(b)
+		draw.Draw(rgba, b, img, b.Min, draw.Src)
+	}
+
+	h := sha256.New()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		i := rgba.PixOffset(b.Min.X, y)
+		h.Write(rgba.Pix[i : i+b.Dx()*4])
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
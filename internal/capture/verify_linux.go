@@ -0,0 +1,14 @@
+//go:build linux
+
+package capture
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// dropCache evicts a file's pages from the page cache (best effort)
+func dropCache(f *os.File) {
+	unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_DONTNEED)
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package capture
+
+import "os"
+
+// dropCache is a no-op: re-reads may be served from the cache
+func dropCache(f *os.File) {}
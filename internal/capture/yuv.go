@@ -0,0 +1,203 @@
+//go:build !noyuv && !minimal
+
+package capture
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/robotin/screenshot/internal/gpu"
+)
+
+func init() {
+	registerEncoder(FormatYUV420, func(img image.Image, w io.Writer, opts EncodeOptions) error {
+		return WriteY4M(img, w)
+	})
+	registerEncoder(FormatNV12, func(img image.Image, w io.Writer, opts EncodeOptions) error {
+		return WriteNV12(img, w)
+	})
+	newVideoWriter = func(w io.Writer, fps float64) FrameWriter {
+		return NewY4MWriter(w, fps)
+	}
+}
+
+// yuv420Planes converts an image to full-range BT.601 (JPEG) YUV 4:2:0.
+// Chroma is subsampled by averaging each 2x2 block; odd widths/heights
+// round the chroma plane size up. Builds with the gpu tag convert on the
+// GPU when one can be opened; otherwise rows are converted in parallel
+// bands on the CPU, with the same result.
+func yuv420Planes(img image.Image) (y, u, v []byte, w, h int) {
+	b := img.Bounds()
+	w, h = b.Dx(), b.Dy()
+	y, u, v, err := gpu.YUV420(img)
+	if err == nil {
+		gpu.Debugf("converted %dx%d to YUV on the GPU", w, h)
+		return y, u, v, w, h
+	}
+	gpu.Debugf("converting to YUV on the CPU: %v", err)
+	cw, ch := (w+1)/2, (h+1)/2
+
+	y = make([]byte, w*h)
+	u = make([]byte, cw*ch)
+	v = make([]byte, cw*ch)
+
+	// Each worker owns a band of chroma rows (two luma rows each), so no
+	// output byte is written by more than one goroutine
+	workers := runtime.NumCPU()
+	if workers > ch {
+		workers = ch
+	}
+	band := (ch + workers - 1) / max(workers, 1)
+
+	var wg sync.WaitGroup
+	for start := 0; start < ch; start += band {
+		end := min(start+band, ch)
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			convertYUV420Rows(img, y, u, v, w, h, start, end)
+		}(start, end)
+	}
+	wg.Wait()
+
+	return y, u, v, w, h
+}
+
+// convertYUV420Rows converts chroma rows [start, end) and their luma rows
+func convertYUV420Rows(img image.Image, y, u, v []byte, w, h, start, end int) {
+	b := img.Bounds()
+	cw := (w + 1) / 2
+	rgba, isRGBA := img.(*image.RGBA)
+
+	pixel := func(px, py int) (uint8, uint8, uint8) {
+		if isRGBA {
+			i := rgba.PixOffset(b.Min.X+px, b.Min.Y+py)
+			return rgba.Pix[i], rgba.Pix[i+1], rgba.Pix[i+2]
+		}
+		c := color.RGBAModel.Convert(img.At(b.Min.X+px, b.Min.Y+py)).(color.RGBA)
+		return c.R, c.G, c.B
+	}
+
+	for cy := start; cy < end; cy++ {
+		for cx := 0; cx < cw; cx++ {
+			var sumU, sumV, count int
+			for py := 2 * cy; py < 2*cy+2 && py < h; py++ {
+				for px := 2 * cx; px < 2*cx+2 && px < w; px++ {
+					yy, cb, cr := color.RGBToYCbCr(pixel(px, py))
+					y[py*w+px] = yy
+					sumU += int(cb)
+					sumV += int(cr)
+					count++
+				}
+			}
+			ci := cy*cw + cx
+			u[ci] = uint8((sumU + count/2) / count)
+			v[ci] = uint8((sumV + count/2) / count)
+		}
+	}
+}
+
+// WriteY4M writes an image as a single-frame YUV4MPEG2 stream (4:2:0, full range).
+// The output can be fed directly to encoders, e.g. `ffmpeg -i - out.mp4`.
+func WriteY4M(img image.Image, w io.Writer) error {
+	y, u, v, width, height := yuv420Planes(img)
+
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintf(bw, "YUV4MPEG2 W%d H%d F1:1 Ip A1:1 C420jpeg XCOLORRANGE=FULL\n", width, height); err != nil {
+		return fmt.Errorf("failed to write y4m header: %w", err)
+	}
+	if err := writeY4MFrame(bw, y, u, v); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// writeY4MFrame writes one FRAME record with the given planes
+func writeY4MFrame(w io.Writer, y, u, v []byte) error {
+	if _, err := io.WriteString(w, "FRAME\n"); err != nil {
+		return fmt.Errorf("failed to write y4m frame: %w", err)
+	}
+	for _, plane := range [][]byte{y, u, v} {
+		if _, err := w.Write(plane); err != nil {
+			return fmt.Errorf("failed to write y4m frame: %w", err)
+		}
+	}
+	return nil
+}
+
+// WriteNV12 writes an image as headerless NV12: the full-resolution Y plane
+// followed by a half-resolution plane of interleaved U and V samples.
+// Consumers must be told the dimensions out of band (e.g. ffmpeg -s WxH -pix_fmt nv12).
+func WriteNV12(img image.Image, w io.Writer) error {
+	y, u, v, _, _ := yuv420Planes(img)
+
+	uv := make([]byte, len(u)*2)
+	for i := range u {
+		uv[2*i] = u[i]
+		uv[2*i+1] = v[i]
+	}
+
+	if _, err := w.Write(y); err != nil {
+		return fmt.Errorf("failed to write nv12: %w", err)
+	}
+	if _, err := w.Write(uv); err != nil {
+		return fmt.Errorf("failed to write nv12: %w", err)
+	}
+	return nil
+}
+
+// Y4MWriter writes a multi-frame YUV4MPEG2 stream. The frame size is fixed
+// by the first frame; later frames of a different size are cropped or padded
+// with black so the stream stays valid.
+type Y4MWriter struct {
+	w      *bufio.Writer
+	bounds image.Rectangle
+	fps    string
+}
+
+// NewY4MWriter creates a stream writer. fps is written as a rational
+// approximation in the header (e.g. 30 -> "30:1").
+func NewY4MWriter(w io.Writer, fps float64) *Y4MWriter {
+	num, den := int(fps*1000+0.5), 1000
+	if num <= 0 {
+		num, den = 1, 1
+	}
+	for _, d := range []int{10, 2, 5} {
+		for num%d == 0 && den%d == 0 {
+			num, den = num/d, den/d
+		}
+	}
+	return &Y4MWriter{w: bufio.NewWriter(w), fps: fmt.Sprintf("%d:%d", num, den)}
+}
+
+// WriteFrame appends a frame to the stream
+func (y *Y4MWriter) WriteFrame(img image.Image) error {
+	if y.bounds.Empty() {
+		y.bounds = image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy())
+		if _, err := fmt.Fprintf(y.w, "YUV4MPEG2 W%d H%d F%s Ip A1:1 C420jpeg XCOLORRANGE=FULL\n",
+			y.bounds.Dx(), y.bounds.Dy(), y.fps); err != nil {
+			return fmt.Errorf("failed to write y4m header: %w", err)
+		}
+	}
+
+	if img.Bounds().Dx() != y.bounds.Dx() || img.Bounds().Dy() != y.bounds.Dy() {
+		canvas := image.NewRGBA(y.bounds)
+		draw.Draw(canvas, canvas.Bounds(), image.Black, image.Point{}, draw.Src)
+		draw.Draw(canvas, canvas.Bounds(), img, img.Bounds().Min, draw.Src)
+		img = canvas
+	}
+
+	yp, up, vp, _, _ := yuv420Planes(img)
+	return writeY4MFrame(y.w, yp, up, vp)
+}
+
+// Flush writes any buffered data
+func (y *Y4MWriter) Flush() error {
+	return y.w.Flush()
+}
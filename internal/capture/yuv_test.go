@@ -0,0 +1,49 @@
+//go:build !noyuv && !minimal
+
+package capture
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/robotin/screenshot/internal/gpu"
+)
+
+// TestGPUYUV420 checks the GPU conversion (built with -tags gpu) against
+// the CPU one, at sizes that leave partial chroma blocks and words
+func TestGPUYUV420(t *testing.T) {
+	if err := gpu.Available(); err != nil {
+		t.Skip(err)
+	}
+	for _, size := range []image.Point{{1, 1}, {2, 2}, {7, 5}, {17, 9}, {64, 48}, {321, 201}} {
+		t.Run(fmt.Sprintf("%dx%d", size.X, size.Y), func(t *testing.T) {
+			img := image.NewRGBA(image.Rect(10, 20, 10+size.X, 20+size.Y))
+			for py := img.Rect.Min.Y; py < img.Rect.Max.Y; py++ {
+				for px := img.Rect.Min.X; px < img.Rect.Max.X; px++ {
+					img.SetRGBA(px, py, color.RGBA{uint8(px * 37), uint8(py * 91), uint8(px*py + 7), 255})
+				}
+			}
+
+			y, u, v, err := gpu.YUV420(img)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w, h := size.X, size.Y
+			cw, ch := (w+1)/2, (h+1)/2
+			wy, wu, wv := make([]byte, w*h), make([]byte, cw*ch), make([]byte, cw*ch)
+			convertYUV420Rows(img, wy, wu, wv, w, h, 0, ch)
+
+			for _, p := range []struct {
+				name      string
+				got, want []byte
+			}{{"Y", y, wy}, {"U", u, wu}, {"V", v, wv}} {
+				if !bytes.Equal(p.got, p.want) {
+					t.Errorf("%s plane differs from the CPU conversion", p.name)
+				}
+			}
+		})
+	}
+}
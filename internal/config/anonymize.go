@@ -0,0 +1,57 @@
+package config
+
+import (
+	"image"
+
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// Anonymize tunes what --anonymize hides. The automatic parts are on
+// unless turned off.
+type Anonymize struct {
+	// Panels blacks out panels and docks, which show the clock, battery
+	// and tray icons
+	Panels *bool `yaml:"panels"`
+
+	// Desktop blurs the desktop (icons, wallpaper) where no window
+	// covers it
+	Desktop *bool `yaml:"desktop"`
+
+	// Faces masks faces, e.g. in video calls or avatars
+	Faces *bool `yaml:"faces"`
+
+	// Blur and Redact add areas to blur and to black out, with the same
+	// syntax as exclusion zones
+	Blur   []Exclusion `yaml:"blur"`
+	Redact []Exclusion `yaml:"redact"`
+
+	// Radius is the blur radius in pixels
+	Radius int `yaml:"radius"`
+}
+
+// on reports whether an automatic part is enabled
+func on(b *bool) bool {
+	return b == nil || *b
+}
+
+// PanelsOn, DesktopOn and FacesOn report whether the automatic parts
+// are enabled
+func (a Anonymize) PanelsOn() bool  { return on(a.Panels) }
+func (a Anonymize) DesktopOn() bool { return on(a.Desktop) }
+func (a Anonymize) FacesOn() bool   { return on(a.Faces) }
+
+// Areas resolves the blur and redact areas to absolute screen
+// coordinates. Areas on monitors that are not connected are skipped.
+func (a Anonymize) Areas(monitors []strategy.Monitor) (blur, redact []image.Rectangle) {
+	for _, ex := range a.Blur {
+		if r, err := areaBounds(ex.Monitor, ex.Area, monitors); err == nil {
+			blur = append(blur, r)
+		}
+	}
+	for _, ex := range a.Redact {
+		if r, err := areaBounds(ex.Monitor, ex.Area, monitors); err == nil {
+			redact = append(redact, r)
+		}
+	}
+	return blur, redact
+}
@@ -0,0 +1,353 @@
+// Package config loads the user configuration file
+// (~/.config/robotin-screenshot/config.yaml)
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/robotin/screenshot/internal/paths"
+	"github.com/robotin/screenshot/internal/xwin"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the parsed configuration file
+type Config struct {
+	// Version is the format the file was written in (see Migrate); files
+	// without one are version 1
+	Version int `yaml:"version"`
+
+	// Migrations describes the values upgraded in memory from an older
+	// version, which screenshot config migrate would write to the file
+	Migrations []string `yaml:"-"`
+
+	// File is the file the configuration was read from, if any
+	File string `yaml:"-"`
+
+	// tree is the configuration as parsed, upgraded
+	tree *yaml.Node
+
+	// Monitors defines virtual monitors: named areas of a physical monitor
+	// that can be captured with -m NAME like a real one
+	Monitors map[string]VirtualMonitor `yaml:"monitors"`
+
+	// Exclude lists areas blacked out in every capture, e.g. a panel that
+	// shows private notifications
+	Exclude []Exclusion `yaml:"exclude"`
+
+	// ProtectedWindows lists windows, such as password managers, that
+	// must never appear in a capture
+	ProtectedWindows ProtectedWindows `yaml:"protected_windows"`
+
+	// Anonymize tunes what --anonymize hides
+	Anonymize Anonymize `yaml:"anonymize"`
+
+	// Indicator is the on-screen notice shown during periodic capture
+	Indicator Indicator `yaml:"indicator"`
+
+	// Uploads configures the upload spool and bandwidth
+	Uploads Uploads `yaml:"uploads"`
+
+	// Schedules are named capture schedules (every 5m, Mon-Fri
+	// 09:00-18:00) run with --schedule NAME
+	Schedules map[string]Schedule `yaml:"schedules"`
+
+	// BackendPriority lists capture backends to try first, in order
+	// (e.g. [x11]); the rest follow in their default order
+	BackendPriority []string `yaml:"backend_priority"`
+
+	// DPI normalizes mixed-DPI desktops in all-monitor captures
+	DPI DPI `yaml:"dpi"`
+
+	// AutoFormat tunes --format auto
+	AutoFormat AutoFormat `yaml:"auto_format"`
+
+	// OutputDir is where captures without an output path are saved
+	// (default: Screenshots in the pictures directory); ~/ is expanded
+	OutputDir string `yaml:"output_dir"`
+
+	// Format is the format of captures whose output path doesn't name
+	// one, as --format takes it (e.g. jpeg or auto)
+	Format string `yaml:"format"`
+
+	// Upload is where captures are uploaded without --upload (e.g. imgur
+	// or s3://bucket/prefix)
+	Upload string `yaml:"upload"`
+
+	// Routes pick the directory and tags of captures by window, first
+	// match wins
+	Routes []Route `yaml:"routes"`
+
+	// AuditLog is a file where every capture is recorded in a
+	// tamper-evident log (~/ is expanded); the policy's audit_log takes
+	// precedence
+	AuditLog string `yaml:"audit_log"`
+
+	// PanicKey is a global hotkey (e.g. ctrl+alt+shift+p) that stops
+	// interval captures, recordings and servers at once and wipes the
+	// frames they hold in memory
+	PanicKey string `yaml:"panic_key"`
+}
+
+// VirtualMonitor is an area of a physical monitor
+type VirtualMonitor struct {
+	// Monitor is the physical monitor's index or output name (e.g.
+	// HDMI-1). Empty means the whole desktop.
+	Monitor string `yaml:"monitor"`
+
+	// Area is "x,y,width,height" relative to the monitor; each value is
+	// in pixels or a percentage of the monitor's size (e.g. "50%,0,50%,100%")
+	Area string `yaml:"area"`
+}
+
+// Exclusion is an area blanked in captures. Like a virtual monitor, it is
+// relative to a physical monitor, or to the whole desktop if Monitor is
+// empty.
+type Exclusion struct {
+	Monitor string `yaml:"monitor"`
+	Area    string `yaml:"area"`
+}
+
+// ProtectedWindows selects windows by WM_CLASS and what happens when one
+// is in a capture
+type ProtectedWindows struct {
+	// Classes are matched against the class and instance parts of
+	// WM_CLASS, ignoring case (e.g. KeePassXC, 1password)
+	Classes []string `yaml:"classes"`
+
+	// Action is blank (default: black out the window) or abort (fail the
+	// capture)
+	Action string `yaml:"action"`
+}
+
+// Protected window actions
+const (
+	ProtectBlank = "blank"
+	ProtectAbort = "abort"
+)
+
+// Matches reports whether a window with the given WM_CLASS parts is
+// protected
+func (p ProtectedWindows) Matches(class, instance string) bool {
+	for _, c := range p.Classes {
+		if strings.EqualFold(c, class) || strings.EqualFold(c, instance) {
+			return true
+		}
+	}
+	return false
+}
+
+// Path returns the configuration file path: $SCREENSHOT_CONFIG, or
+// config.yaml in the config directory
+func Path() (string, error) {
+	if p := os.Getenv("SCREENSHOT_CONFIG"); p != "" {
+		return p, nil
+	}
+	dir, err := paths.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.yaml"), nil
+}
+
+// Load reads the configuration file at path (default: Path()). A missing
+// default file is not an error and yields an empty configuration.
+func Load(path string) (*Config, error) {
+	explicit := path != ""
+	if !explicit {
+		var err error
+		if path, err = Path(); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	c, err := Parse(data)
+	var errs *Errors
+	if errors.As(err, &errs) {
+		errs.File = path
+		return nil, errs
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	c.File = path
+	return c, nil
+}
+
+// Parse parses and validates a configuration. Files from older versions
+// are upgraded in memory (see Migrate). Every problem is reported, with
+// its line and column: unknown keys are rejected so typos are reported
+// instead of ignored.
+func Parse(data []byte) (*Config, error) {
+	doc, err := parseTree(data)
+	if err != nil {
+		return nil, err
+	}
+	root := doc.Content[0]
+	from, err := version(root)
+	if err != nil {
+		return nil, err
+	}
+	changes := migrate(root, from)
+
+	errs := &Errors{}
+	checkSchema(root, reflect.TypeOf(Config{}), errs)
+	if len(errs.List) > 0 {
+		return nil, errs
+	}
+	var c Config
+	if err := root.Decode(&c); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	c.Version, c.Migrations, c.tree = from, changes, root
+
+	v := validator{root: root, errs: errs}
+	v.validate(&c)
+	if len(errs.List) > 0 {
+		slices.SortStableFunc(errs.List, func(a, b *Error) int {
+			if a.Line != b.Line {
+				return a.Line - b.Line
+			}
+			return a.Column - b.Column
+		})
+		return nil, errs
+	}
+	return &c, nil
+}
+
+// validator checks the values of a decoded configuration, locating the
+// problems in its YAML tree
+type validator struct {
+	root *yaml.Node
+	errs *Errors
+}
+
+// fail records a problem with the value at the path of keys (strings for
+// mapping keys, ints for list indexes), or the closest one present
+func (v validator) fail(path []any, format string, args ...any) {
+	n, key := v.root, ""
+	for _, p := range path {
+		var next *yaml.Node
+		switch p := p.(type) {
+		case string:
+			key = joinKey(key, p)
+			next = mapValue(n, p)
+		case int:
+			key = fmt.Sprintf("%s[%d]", key, p)
+			if n.Kind == yaml.SequenceNode && p < len(n.Content) {
+				next = n.Content[p]
+			}
+		}
+		if next == nil {
+			break
+		}
+		n = next
+	}
+	v.errs.add(n, key, format, args...)
+}
+
+// at is a path of keys for fail
+func at(path ...any) []any {
+	return path
+}
+
+// validate checks what the schema can't: areas, sizes, names and choices
+func (v validator) validate(c *Config) {
+	for name, vm := range c.Monitors {
+		if _, err := strconv.Atoi(name); err == nil {
+			v.fail(at("monitors", name), "a virtual monitor name must not be a number")
+		}
+		if vm.Area == "" {
+			v.fail(at("monitors", name), "virtual monitor has no area")
+		} else if _, err := parseArea(vm.Area); err != nil {
+			v.fail(at("monitors", name, "area"), "%v", err)
+		}
+	}
+	for i, ex := range c.Exclude {
+		if _, err := parseArea(ex.Area); err != nil {
+			v.fail(at("exclude", i, "area"), "%v", err)
+		}
+	}
+	for i, ex := range c.Anonymize.Blur {
+		if _, err := parseArea(ex.Area); err != nil {
+			v.fail(at("anonymize", "blur", i, "area"), "%v", err)
+		}
+	}
+	for i, ex := range c.Anonymize.Redact {
+		if _, err := parseArea(ex.Area); err != nil {
+			v.fail(at("anonymize", "redact", i, "area"), "%v", err)
+		}
+	}
+	if c.Anonymize.Radius < 0 {
+		v.fail(at("anonymize", "radius"), "must not be negative")
+	}
+	switch c.Indicator.Corner {
+	case "", CornerTopLeft, CornerTopRight, CornerBottomLeft, CornerBottomRight:
+	default:
+		v.fail(at("indicator", "corner"), "%q is not a corner (expected top-left, top-right, bottom-left or bottom-right)", c.Indicator.Corner)
+	}
+	if _, err := ParseBytes(c.Uploads.SpoolMaxSize); err != nil {
+		v.fail(at("uploads", "spool_max_size"), "%v", err)
+	}
+	if _, err := ParseBytes(c.Uploads.MaxRate); err != nil {
+		v.fail(at("uploads", "max_rate"), "%v", err)
+	}
+	for name, sched := range c.Schedules {
+		if _, err := sched.Parse(); err != nil {
+			v.fail(at("schedules", name), "%v", err)
+		}
+	}
+	switch c.ProtectedWindows.Action {
+	case "", ProtectBlank, ProtectAbort:
+	default:
+		v.fail(at("protected_windows", "action"), "%q is not an action (expected blank or abort)", c.ProtectedWindows.Action)
+	}
+	for i, class := range c.ProtectedWindows.Classes {
+		if strings.TrimSpace(class) == "" {
+			v.fail(at("protected_windows", "classes", i), "empty class")
+		}
+	}
+	for i, r := range c.Routes {
+		if err := r.validate(); err != nil {
+			v.fail(at("routes", i), "route %v", err)
+		}
+	}
+	if _, _, err := ParseNormalize(c.DPI.Normalize); err != nil {
+		v.fail(at("dpi", "normalize"), "%v", err)
+	}
+	for name, dpi := range c.DPI.Monitors {
+		if dpi <= 0 {
+			v.fail(at("dpi", "monitors", name), "DPI must be positive")
+		}
+	}
+	if c.PanicKey != "" {
+		if _, err := xwin.ParseKey(c.PanicKey); err != nil {
+			v.fail(at("panic_key"), "%v", err)
+		}
+	}
+	if c.AutoFormat.MaxColors < 0 {
+		v.fail(at("auto_format", "max_colors"), "must not be negative")
+	}
+	if c.AutoFormat.PhotoShare < 0 || c.AutoFormat.PhotoShare > 1 {
+		v.fail(at("auto_format", "photo_share"), "must be between 0 and 1")
+	}
+	switch c.AutoFormat.Photo {
+	case "", "jpeg", "jpg", "heif", "heic":
+	default:
+		v.fail(at("auto_format", "photo"), "%q is not a photo format (expected jpeg or heif)", c.AutoFormat.Photo)
+	}
+}
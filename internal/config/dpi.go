@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// DPI configures stitching mixed-DPI desktops
+type DPI struct {
+	// Normalize scales every monitor to a common density before the
+	// all-monitors composite: "auto" (the lowest monitor DPI), a DPI such
+	// as 96, or empty to keep raw pixels
+	Normalize string `yaml:"normalize"`
+
+	// Monitors overrides the DPI of monitors (by output name or index)
+	// whose reported physical size is missing or wrong
+	Monitors map[string]float64 `yaml:"monitors"`
+}
+
+// defaultDPI is assumed for monitors that don't report a physical size
+const defaultDPI = 96
+
+// ParseNormalize validates a normalize setting: "", "auto" or a DPI
+func ParseNormalize(s string) (auto bool, target float64, err error) {
+	switch s {
+	case "":
+		return false, 0, nil
+	case "auto":
+		return true, 0, nil
+	}
+	target, err = strconv.ParseFloat(s, 64)
+	if err != nil || target <= 0 {
+		return false, 0, fmt.Errorf("invalid DPI %q (expected auto or a number)", s)
+	}
+	return false, target, nil
+}
+
+// MonitorDPI returns a monitor's DPI: the configured override, else the
+// density from its physical size, else 96
+func (d DPI) MonitorDPI(m strategy.Monitor) float64 {
+	for spec, dpi := range d.Monitors {
+		if _, err := FindMonitor(spec, []strategy.Monitor{m}); err == nil {
+			return dpi
+		}
+	}
+	if dpi := m.DPI(); dpi > 0 {
+		return dpi
+	}
+	return defaultDPI
+}
+
+// Scales returns the factor each monitor is scaled by to bring them all
+// to the density selected by normalize, or nil if normalize is empty
+func (d DPI) Scales(normalize string, monitors []strategy.Monitor) ([]float64, error) {
+	auto, target, err := ParseNormalize(normalize)
+	if err != nil || (!auto && target == 0) {
+		return nil, err
+	}
+
+	dpis := make([]float64, len(monitors))
+	for i, m := range monitors {
+		dpis[i] = d.MonitorDPI(m)
+		if auto && (target == 0 || dpis[i] < target) {
+			target = dpis[i]
+		}
+	}
+
+	scales := make([]float64, len(monitors))
+	for i := range monitors {
+		scales[i] = target / dpis[i]
+	}
+	return scales, nil
+}
@@ -0,0 +1,17 @@
+package config
+
+// AutoFormat tunes how --format auto tells UI from photographic captures
+type AutoFormat struct {
+	// MaxColors is the most colors a capture always saved as PNG may
+	// have (default 4096)
+	MaxColors int `yaml:"max_colors"`
+
+	// PhotoShare is the share of neighboring pixels that differ slightly
+	// (photos, video, gradients) from which a capture is photographic,
+	// 0 to 1 (default 0.5)
+	PhotoShare float64 `yaml:"photo_share"`
+
+	// Photo is the format of photographic captures: jpeg (default) or
+	// heif
+	Photo string `yaml:"photo"`
+}
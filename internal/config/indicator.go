@@ -0,0 +1,29 @@
+package config
+
+// Indicator corners
+const (
+	CornerTopLeft     = "top-left"
+	CornerTopRight    = "top-right"
+	CornerBottomLeft  = "bottom-left"
+	CornerBottomRight = "bottom-right"
+)
+
+// Indicator is the notice shown on screen while periodic capture
+// (--interval, --session) runs, which monitoring laws in some places
+// require
+type Indicator struct {
+	// Enabled shows the indicator on every periodic capture run, as if
+	// --indicator were always given
+	Enabled bool `yaml:"enabled"`
+
+	// Text is the notice (default "Screen capture active")
+	Text string `yaml:"text"`
+
+	// Corner is where the notice goes on each monitor: top-left,
+	// top-right (default), bottom-left or bottom-right
+	Corner string `yaml:"corner"`
+
+	// Required refuses to capture while the notice can't be shown,
+	// instead of capturing with a warning
+	Required bool `yaml:"required"`
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the configuration format this build reads. Files
+// without a version key are version 1.
+const CurrentVersion = 2
+
+// migrations upgrade a configuration, as a YAML tree so comments and
+// layout are kept, from version i+1 to i+2. Each returns what it changed.
+var migrations = []func(root *yaml.Node) []string{
+	// Version 2 rejects durations without a unit, which version 1 read
+	// as nanoseconds: every: 300 was 300ns, not 5 minutes
+	func(root *yaml.Node) []string {
+		var changes []string
+		walk(root, reflect.TypeOf(Config{}), "", func(n *yaml.Node, t reflect.Type, key string) {
+			if t != durationType || n.Kind != yaml.ScalarNode || n.Tag != "!!int" {
+				return
+			}
+			ns, err := strconv.ParseInt(n.Value, 0, 64)
+			if err != nil {
+				return
+			}
+			d := time.Duration(ns).String()
+			changes = append(changes, fmt.Sprintf("%s: %s is now %s, the nanoseconds it was read as (for %s seconds, write %ss)", key, n.Value, d, n.Value, n.Value))
+			n.Tag, n.Value, n.Style = "!!str", d, 0
+		})
+		return changes
+	},
+}
+
+// Migration is a configuration upgraded to CurrentVersion
+type Migration struct {
+	From, To int
+
+	// Changes describes each value changed, besides the version
+	Changes []string
+
+	// Data is the upgraded configuration
+	Data []byte
+}
+
+// Migrate upgrades a configuration to CurrentVersion, keeping its
+// comments. The result is validated.
+func Migrate(data []byte) (*Migration, error) {
+	doc, err := parseTree(data)
+	if err != nil {
+		return nil, err
+	}
+	root := doc.Content[0]
+	from, err := version(root)
+	if err != nil {
+		return nil, err
+	}
+	m := &Migration{From: from, To: CurrentVersion, Changes: migrate(root, from)}
+	setVersion(root, CurrentVersion)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("failed to write config: %w", err)
+	}
+	enc.Close()
+	if _, err := Parse(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	m.Data = buf.Bytes()
+	return m, nil
+}
+
+// parseTree parses a configuration into a document whose content is one
+// mapping, empty for an empty file
+func parseTree(data []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	doc.Kind = yaml.DocumentNode
+	if len(doc.Content) == 0 || doc.Content[0].Tag == "!!null" {
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+	if root := doc.Content[0]; root.Kind != yaml.MappingNode {
+		errs := &Errors{}
+		errs.add(root, "", "expected a mapping of settings, found %s", describe(root))
+		return nil, errs
+	}
+	return &doc, nil
+}
+
+// version returns a configuration's version
+func version(root *yaml.Node) (int, error) {
+	n := mapValue(root, "version")
+	if n == nil {
+		return 1, nil
+	}
+	errs := &Errors{}
+	v, err := strconv.Atoi(n.Value)
+	switch {
+	case err != nil || v < 1:
+		errs.add(n, "version", "%q is not a version number", n.Value)
+	case v > CurrentVersion:
+		errs.add(n, "version", "%d is newer than this build reads (%d); upgrade screenshot", v, CurrentVersion)
+	default:
+		return v, nil
+	}
+	return 0, errs
+}
+
+// migrate upgrades root from version from and returns the changes
+func migrate(root *yaml.Node, from int) []string {
+	var changes []string
+	for _, m := range migrations[from-1:] {
+		changes = append(changes, m(root)...)
+	}
+	return changes
+}
+
+// setVersion sets the version key, adding it at the top
+func setVersion(root *yaml.Node, v int) {
+	value := strconv.Itoa(v)
+	if n := mapValue(root, "version"); n != nil {
+		n.Value = value
+		return
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"}
+	if len(root.Content) > 0 {
+		// A comment heading the file stays above the version
+		key.HeadComment, root.Content[0].HeadComment = root.Content[0].HeadComment, ""
+	}
+	root.Content = append([]*yaml.Node{key, {Kind: yaml.ScalarNode, Tag: "!!int", Value: value}}, root.Content...)
+}
+
+// mapValue returns the value of key in a mapping, or nil
+func mapValue(n *yaml.Node, key string) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"image"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// areaValue is one coordinate of an area: pixels, or a percentage of the
+// monitor's width or height
+type areaValue struct {
+	v       float64
+	percent bool
+}
+
+// resolve converts the value to pixels along a monitor side of size n
+func (a areaValue) resolve(n int) int {
+	if a.percent {
+		return int(a.v * float64(n) / 100)
+	}
+	return int(a.v)
+}
+
+// parseArea parses "x,y,width,height" with pixel or percentage values
+func parseArea(s string) ([4]areaValue, error) {
+	var vals [4]areaValue
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return vals, fmt.Errorf("area must be x,y,width,height: %q", s)
+	}
+
+	for i, p := range parts {
+		p = strings.TrimSpace(p)
+		num, percent := strings.CutSuffix(p, "%")
+		v, err := strconv.ParseFloat(num, 64)
+		if err != nil || v < 0 {
+			return vals, fmt.Errorf("invalid area value: %q", p)
+		}
+		vals[i] = areaValue{v: v, percent: percent}
+	}
+	return vals, nil
+}
+
+// Names returns the virtual monitor names, sorted
+func (c *Config) Names() []string {
+	names := make([]string, 0, len(c.Monitors))
+	for name := range c.Monitors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Bounds resolves a virtual monitor to absolute screen coordinates
+func (c *Config) Bounds(name string, monitors []strategy.Monitor) (image.Rectangle, error) {
+	vm, ok := c.Monitors[name]
+	if !ok {
+		return image.Rectangle{}, fmt.Errorf("unknown virtual monitor %q", name)
+	}
+
+	r, err := areaBounds(vm.Monitor, vm.Area, monitors)
+	if err != nil {
+		return image.Rectangle{}, fmt.Errorf("virtual monitor %q: %w", name, err)
+	}
+	return r, nil
+}
+
+// Exclusions resolves the exclusion zones to absolute screen coordinates.
+// Zones on monitors that are not connected are skipped.
+func (c *Config) Exclusions(monitors []strategy.Monitor) []image.Rectangle {
+	var zones []image.Rectangle
+	for _, ex := range c.Exclude {
+		if r, err := areaBounds(ex.Monitor, ex.Area, monitors); err == nil {
+			zones = append(zones, r)
+		}
+	}
+	return zones
+}
+
+// areaBounds resolves an area relative to a monitor (or the whole desktop
+// if monitor is empty) to absolute screen coordinates
+func areaBounds(monitor, spec string, monitors []strategy.Monitor) (image.Rectangle, error) {
+	var within image.Rectangle
+	if monitor == "" {
+		for _, m := range monitors {
+			within = within.Union(m.Bounds)
+		}
+	} else {
+		m, err := FindMonitor(monitor, monitors)
+		if err != nil {
+			return image.Rectangle{}, err
+		}
+		within = m.Bounds
+	}
+
+	area, err := parseArea(spec)
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	w, h := within.Dx(), within.Dy()
+	x, y := area[0].resolve(w), area[1].resolve(h)
+	r := image.Rect(x, y, x+area[2].resolve(w), y+area[3].resolve(h)).Add(within.Min).Intersect(within)
+	if r.Empty() {
+		return image.Rectangle{}, fmt.Errorf("area %q is outside the monitor", spec)
+	}
+	return r, nil
+}
+
+// FindMonitor looks up a physical monitor by index or output name
+func FindMonitor(spec string, monitors []strategy.Monitor) (strategy.Monitor, error) {
+	if i, err := strconv.Atoi(spec); err == nil {
+		for _, m := range monitors {
+			if m.Index == i {
+				return m, nil
+			}
+		}
+		return strategy.Monitor{}, fmt.Errorf("monitor %d not found", i)
+	}
+	for _, m := range monitors {
+		if strings.EqualFold(m.Name, spec) {
+			return m, nil
+		}
+	}
+	return strategy.Monitor{}, fmt.Errorf("monitor %q not found", spec)
+}
+
+// Resolve turns a -m value (an index, an output name such as HDMI-1, or a
+// virtual monitor) into a monitor index or, for virtual monitors, a
+// capture area in screen coordinates. Virtual monitors take precedence
+// over output names.
+func (c *Config) Resolve(spec string, monitors []strategy.Monitor) (int, *image.Rectangle, error) {
+	if _, ok := c.Monitors[spec]; ok {
+		r, err := c.Bounds(spec, monitors)
+		if err != nil {
+			return 0, nil, err
+		}
+		return -1, &r, nil
+	}
+
+	m, err := FindMonitor(spec, monitors)
+	if err != nil {
+		return 0, nil, err
+	}
+	return m.Index, nil, nil
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/robotin/screenshot/internal/strategy"
+	"gopkg.in/yaml.v3"
+)
+
+// PolicyPath is the machine-wide policy file. Packagers can move it with
+// -ldflags "-X github.com/robotin/screenshot/internal/config.PolicyPath=...";
+// users can't, since the policy constrains them.
+var PolicyPath = "/etc/robotin-screenshot/policy.yaml"
+
+// Policy is constraints set by the machine's administrator, which the CLI
+// and daemons refuse to violate whatever the user's flags and config say
+type Policy struct {
+	// MinInterval is the shortest time allowed between captures
+	MinInterval time.Duration `yaml:"min_interval"`
+
+	// Mask lists areas blacked out in every capture, with the same syntax
+	// as exclusion zones
+	Mask []Exclusion `yaml:"mask"`
+
+	// DisallowUploads lists upload targets that may not be used: a
+	// provider (imgur, dropbox) or a target prefix (s3://public-bucket)
+	DisallowUploads []string `yaml:"disallow_uploads"`
+
+	// AuditLog is a file where every capture is recorded in a
+	// tamper-evident log, whatever the user's config says
+	AuditLog string `yaml:"audit_log"`
+}
+
+// LoadPolicy reads the policy file. A missing file is no policy.
+func LoadPolicy() (*Policy, error) {
+	data, err := os.ReadFile(PolicyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Policy{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+	p, err := ParsePolicy(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", PolicyPath, err)
+	}
+	return p, nil
+}
+
+// ParsePolicy parses and validates a policy. As with the config, unknown
+// keys are rejected: a misspelled constraint must not be silently
+// dropped.
+func ParsePolicy(data []byte) (*Policy, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	var p Policy
+	if err := dec.Decode(&p); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	if p.MinInterval < 0 {
+		return nil, fmt.Errorf("invalid policy: min_interval must not be negative")
+	}
+	for i, m := range p.Mask {
+		if _, err := parseArea(m.Area); err != nil {
+			return nil, fmt.Errorf("invalid policy: mask %d: %w", i+1, err)
+		}
+	}
+	for i, t := range p.DisallowUploads {
+		if strings.TrimSpace(t) == "" {
+			return nil, fmt.Errorf("invalid policy: disallowed upload %d is empty", i+1)
+		}
+	}
+	return &p, nil
+}
+
+// Masks resolves the mask areas to absolute screen coordinates. Areas on
+// monitors that are not connected are skipped.
+func (p *Policy) Masks(monitors []strategy.Monitor) []image.Rectangle {
+	var zones []image.Rectangle
+	for _, m := range p.Mask {
+		if r, err := areaBounds(m.Monitor, m.Area, monitors); err == nil {
+			zones = append(zones, r)
+		}
+	}
+	return zones
+}
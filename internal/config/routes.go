@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Route sends captures of matching windows to their own directory and
+// tags them, e.g. anything titled "JIRA" to ~/work/tickets
+type Route struct {
+	// Class is matched against the class and instance parts of
+	// WM_CLASS, ignoring case (e.g. firefox)
+	Class string `yaml:"class"`
+
+	// Title is a part of the window title, ignoring case (e.g. JIRA)
+	Title string `yaml:"title"`
+
+	// Dir is where captures without an output path are saved instead of
+	// output_dir; ~/ is expanded
+	Dir string `yaml:"dir"`
+
+	// Tags are added to the capture's history entry and webhook events
+	Tags []string `yaml:"tags"`
+}
+
+// Matches reports whether a window matches the route: both Class and
+// Title when both are given
+func (r Route) Matches(class, instance, title string) bool {
+	if r.Class != "" && !strings.EqualFold(r.Class, class) && !strings.EqualFold(r.Class, instance) {
+		return false
+	}
+	return r.Title == "" || strings.Contains(strings.ToLower(title), strings.ToLower(r.Title))
+}
+
+// Route returns the first route matching a window, or nil
+func (c *Config) Route(class, instance, title string) *Route {
+	for i := range c.Routes {
+		if c.Routes[i].Matches(class, instance, title) {
+			return &c.Routes[i]
+		}
+	}
+	return nil
+}
+
+// validate checks a route can match something and do something
+func (r Route) validate() error {
+	if strings.TrimSpace(r.Class) == "" && strings.TrimSpace(r.Title) == "" {
+		return fmt.Errorf("needs a class or a title")
+	}
+	if r.Dir == "" && len(r.Tags) == 0 {
+		return fmt.Errorf("needs a dir or tags")
+	}
+	for _, tag := range r.Tags {
+		if strings.TrimSpace(tag) == "" {
+			return fmt.Errorf("has an empty tag")
+		}
+	}
+	return nil
+}
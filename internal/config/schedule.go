@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robotin/screenshot/internal/schedule"
+)
+
+// Schedule is a named capture schedule, run with --schedule NAME
+type Schedule struct {
+	// Every is the time between captures (e.g. 5m)
+	Every time.Duration `yaml:"every"`
+
+	// Timezone is the IANA zone the windows are in (e.g. Europe/Madrid);
+	// empty is the local zone
+	Timezone string `yaml:"timezone"`
+
+	// Windows are when captures happen; none means always
+	Windows []ScheduleWindow `yaml:"windows"`
+
+	// Skip lists dates with no captures, e.g. public holidays
+	// (2006-01-02)
+	Skip []string `yaml:"skip"`
+}
+
+// ScheduleWindow is a daily time window on some days of the week
+type ScheduleWindow struct {
+	// Days are weekdays or ranges (mon-fri, sat,sun); empty is every day
+	Days string `yaml:"days"`
+
+	// Hours is the time of day (09:00-18:00); empty is the whole day.
+	// A window ending before it starts runs past midnight.
+	Hours string `yaml:"hours"`
+}
+
+// Parse validates the schedule and resolves its time zone
+func (s Schedule) Parse() (*schedule.Schedule, error) {
+	if s.Every <= 0 {
+		return nil, fmt.Errorf("every must be a positive duration (e.g. 5m)")
+	}
+	loc := time.Local
+	if s.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(s.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", s.Timezone, err)
+		}
+	}
+
+	sched := &schedule.Schedule{Every: s.Every, Location: loc}
+	for i, w := range s.Windows {
+		days, err := schedule.ParseDays(w.Days)
+		if err != nil {
+			return nil, fmt.Errorf("window %d: %w", i+1, err)
+		}
+		start, end, err := schedule.ParseHours(w.Hours)
+		if err != nil {
+			return nil, fmt.Errorf("window %d: %w", i+1, err)
+		}
+		sched.Windows = append(sched.Windows, schedule.Window{Days: days, Start: start, End: end})
+	}
+	for _, date := range s.Skip {
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return nil, fmt.Errorf("invalid skip date %q (expected YYYY-MM-DD)", date)
+		}
+		if sched.Skip == nil {
+			sched.Skip = make(map[string]bool)
+		}
+		sched.Skip[date] = true
+	}
+	return sched, nil
+}
@@ -0,0 +1,223 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Error is a problem with a configuration value, at the line and column
+// of the file it is on
+type Error struct {
+	Line, Column int
+
+	// Key is the value's path, e.g. monitors.left.area or routes[0].dir
+	Key string
+	Msg string
+}
+
+// Errors is every problem found in a configuration, in file order
+type Errors struct {
+	// File is the configuration file, if it came from one
+	File string
+	List []*Error
+}
+
+func (e *Errors) Error() string {
+	lines := make([]string, len(e.List))
+	for i, err := range e.List {
+		loc := fmt.Sprintf("line %d, column %d", err.Line, err.Column)
+		if e.File != "" {
+			loc = fmt.Sprintf("%s:%d:%d", e.File, err.Line, err.Column)
+		}
+		lines[i] = loc + ": "
+		if err.Key != "" {
+			lines[i] += err.Key + ": "
+		}
+		lines[i] += err.Msg
+	}
+	if len(lines) == 1 {
+		return "invalid config: " + lines[0]
+	}
+	return fmt.Sprintf("invalid config, %d problems:\n  %s", len(lines), strings.Join(lines, "\n  "))
+}
+
+// add records a problem with the value n at key
+func (e *Errors) add(n *yaml.Node, key, format string, args ...any) {
+	e.List = append(e.List, &Error{Line: n.Line, Column: n.Column, Key: key, Msg: fmt.Sprintf(format, args...)})
+}
+
+// durationType is decoded from strings such as 5m
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// walk calls fn with every value in n that has a place in t, the type it
+// decodes into, and its key path. Keys t has no field for and values of
+// the wrong kind are not descended into.
+func walk(n *yaml.Node, t reflect.Type, key string, fn func(n *yaml.Node, t reflect.Type, key string)) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	fn(n, t, key)
+
+	switch {
+	case t.Kind() == reflect.Struct && n.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if f, ok := fieldByKey(t, n.Content[i].Value); ok {
+				walk(n.Content[i+1], f.Type, joinKey(key, n.Content[i].Value), fn)
+			}
+		}
+	case t.Kind() == reflect.Map && n.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			walk(n.Content[i+1], t.Elem(), joinKey(key, n.Content[i].Value), fn)
+		}
+	case t.Kind() == reflect.Slice && n.Kind == yaml.SequenceNode:
+		for i, item := range n.Content {
+			walk(item, t.Elem(), fmt.Sprintf("%s[%d]", key, i), fn)
+		}
+	}
+}
+
+// joinKey appends a mapping key to a key path
+func joinKey(key, name string) string {
+	if key == "" {
+		return name
+	}
+	return key + "." + name
+}
+
+// yamlKey returns the key a struct field is read from, "" if none
+func yamlKey(f reflect.StructField) string {
+	if !f.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		name = strings.ToLower(f.Name)
+	}
+	return name
+}
+
+// fieldByKey returns the field of struct type t read from key
+func fieldByKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); yamlKey(f) == key {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// checkSchema reports values in n that don't fit t: unknown keys, lists
+// where a mapping belongs, text where a number does and so on. Unlike
+// decoding, it finds all of them.
+func checkSchema(n *yaml.Node, t reflect.Type, errs *Errors) {
+	walk(n, t, "", func(n *yaml.Node, t reflect.Type, key string) {
+		if n.Tag == "!!null" {
+			return
+		}
+		switch {
+		case t == durationType:
+			if n.Kind != yaml.ScalarNode {
+				errs.add(n, key, "expected a duration such as 30s or 5m, found %s", describe(n))
+			} else if n.Tag == "!!int" || n.Tag == "!!float" {
+				errs.add(n, key, "%s has no unit (write 30s, 5m, 1h...)", n.Value)
+			} else if _, err := time.ParseDuration(n.Value); err != nil {
+				errs.add(n, key, "invalid duration %q (expected e.g. 30s or 5m)", n.Value)
+			}
+		case t.Kind() == reflect.Struct:
+			if n.Kind != yaml.MappingNode {
+				errs.add(n, key, "expected a mapping of settings, found %s", describe(n))
+				return
+			}
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				k := n.Content[i]
+				if _, ok := fieldByKey(t, k.Value); !ok {
+					errs.add(k, joinKey(key, k.Value), "unknown key%s", suggest(k.Value, t))
+				}
+			}
+		case t.Kind() == reflect.Map:
+			if n.Kind != yaml.MappingNode {
+				errs.add(n, key, "expected a mapping of names, found %s", describe(n))
+			}
+		case t.Kind() == reflect.Slice:
+			if n.Kind != yaml.SequenceNode {
+				errs.add(n, key, "expected a list, found %s", describe(n))
+			}
+		case n.Kind != yaml.ScalarNode:
+			errs.add(n, key, "expected a single value, found %s", describe(n))
+		case t.Kind() == reflect.Bool:
+			if n.Tag != "!!bool" {
+				errs.add(n, key, "expected true or false, found %q", n.Value)
+			}
+		case t.Kind() == reflect.Int:
+			if n.Tag != "!!int" {
+				errs.add(n, key, "expected a whole number, found %q", n.Value)
+			}
+		case t.Kind() == reflect.Float64:
+			if n.Tag != "!!int" && n.Tag != "!!float" {
+				errs.add(n, key, "expected a number, found %q", n.Value)
+			}
+		}
+	})
+}
+
+// describe names what a node is, for errors
+func describe(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	}
+	return strconv.Quote(n.Value)
+}
+
+// suggest returns a hint naming the key of t closest to a misspelled
+// one, if any is close
+func suggest(key string, t reflect.Type) string {
+	best, bestDist := "", 3
+	for i := 0; i < t.NumField(); i++ {
+		name := yamlKey(t.Field(i))
+		if name == "" {
+			continue
+		}
+		if d := editDistance(strings.ToLower(key), name); d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %q?)", best)
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Setting is a value set in the configuration file
+type Setting struct {
+	// Key is the value's path, e.g. schedules.office.every
+	Key   string
+	Value string
+	Line  int
+}
+
+// Settings lists the values the configuration file sets, in file order.
+// Lists of plain values are one setting.
+func (c *Config) Settings() []Setting {
+	var settings []Setting
+	if c.tree != nil {
+		settings = appendSettings(settings, c.tree, "")
+	}
+	return settings
+}
+
+// appendSettings appends the values in n at key to settings
+func appendSettings(settings []Setting, n *yaml.Node, key string) []Setting {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			settings = appendSettings(settings, n.Content[i+1], joinKey(key, n.Content[i].Value))
+		}
+	case yaml.SequenceNode:
+		values := make([]string, 0, len(n.Content))
+		for _, item := range n.Content {
+			if item.Kind != yaml.ScalarNode {
+				for i, item := range n.Content {
+					settings = appendSettings(settings, item, fmt.Sprintf("%s[%d]", key, i))
+				}
+				return settings
+			}
+			values = append(values, item.Value)
+		}
+		settings = append(settings, Setting{Key: key, Value: "[" + strings.Join(values, ", ") + "]", Line: n.Line})
+	default:
+		settings = append(settings, Setting{Key: key, Value: n.Value, Line: n.Line})
+	}
+	return settings
+}
+
+// Lookup returns the value the configuration file sets at key, as
+// Settings lists it
+func (c *Config) Lookup(key string) (string, bool) {
+	for _, s := range c.Settings() {
+		if s.Key == key {
+			return s.Value, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultSpoolMaxSize caps the upload spool when spool_max_size is unset
+const DefaultSpoolMaxSize = 1 << 30
+
+// Uploads configures how captures are uploaded
+type Uploads struct {
+	// Spool queues uploads that fail (network down) on disk and retries
+	// them in order, as --spool does
+	Spool bool `yaml:"spool"`
+
+	// SpoolDir is where queued captures are kept (default: spool in the
+	// state directory); ~/ is expanded
+	SpoolDir string `yaml:"spool_dir"`
+
+	// SpoolMaxSize caps the queued captures' size on disk (e.g. 500MB,
+	// default 1GiB); the oldest are dropped to make room
+	SpoolMaxSize string `yaml:"spool_max_size"`
+
+	// MaxRate limits the upload bandwidth, in bytes per second (e.g.
+	// 256KB)
+	MaxRate string `yaml:"max_rate"`
+
+	// Resume keeps the state of large S3 and tus uploads so an
+	// interrupted one carries on where it stopped (default: on)
+	Resume *bool `yaml:"resume"`
+}
+
+// ResumeOn reports whether interrupted uploads are resumed
+func (u Uploads) ResumeOn() bool {
+	return on(u.Resume)
+}
+
+// SpoolLimit returns the spool's size cap in bytes
+func (u Uploads) SpoolLimit() int64 {
+	if u.SpoolMaxSize == "" {
+		return DefaultSpoolMaxSize
+	}
+	n, _ := ParseBytes(u.SpoolMaxSize)
+	return n
+}
+
+// RateLimit returns the upload bandwidth limit in bytes per second, 0 if
+// there is none
+func (u Uploads) RateLimit() int64 {
+	n, _ := ParseBytes(u.MaxRate)
+	return n
+}
+
+// byteUnits are the size suffixes ParseBytes accepts
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30},
+	{"kb", 1e3}, {"mb", 1e6}, {"gb", 1e9},
+	{"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30},
+	{"b", 1},
+}
+
+// ParseBytes parses a size in bytes: a number with an optional unit (KB,
+// MB, GB are powers of 1000; KiB, MiB, GiB and K, M, G powers of 1024).
+// Empty is 0.
+func ParseBytes(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	num, unit := s, int64(1)
+	lower := strings.ToLower(s)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(lower, u.suffix) {
+			num, unit = strings.TrimSpace(s[:len(s)-len(u.suffix)]), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q (expected e.g. 500MB or 256KiB)", s)
+	}
+	return int64(n * float64(unit)), nil
+}
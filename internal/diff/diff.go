@@ -0,0 +1,132 @@
+// Package diff compares captures pixel by pixel
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Options control what counts as a change
+type Options struct {
+	// Threshold is the largest per-channel difference (0-255) still
+	// considered equal, to ignore compression noise and dithering
+	Threshold uint8
+}
+
+// Result summarizes the differences between two images
+type Result struct {
+	Width   int `json:"width"`
+	Height  int `json:"height"`
+	Changed int `json:"changed"`
+
+	// Ratio is the fraction of changed pixels (0-1)
+	Ratio float64 `json:"ratio"`
+
+	// Bounds encloses all changed pixels, relative to the image origin
+	// (empty if nothing changed)
+	Bounds image.Rectangle `json:"-"`
+
+	// Mask marks changed pixels (0xff) and unchanged ones (0)
+	Mask *image.Alpha `json:"-"`
+}
+
+// Compare diffs two images of the same size
+func Compare(a, b image.Image, opts Options) (*Result, error) {
+	ab, bb := a.Bounds(), b.Bounds()
+	if ab.Dx() != bb.Dx() || ab.Dy() != bb.Dy() {
+		return nil, fmt.Errorf("image sizes differ: %dx%d vs %dx%d", ab.Dx(), ab.Dy(), bb.Dx(), bb.Dy())
+	}
+
+	ra, rb := toRGBA(a), toRGBA(b)
+	w, h := ab.Dx(), ab.Dy()
+	res := &Result{Width: w, Height: h, Mask: image.NewAlpha(image.Rect(0, 0, w, h))}
+	t := int(opts.Threshold)
+
+	for y := 0; y < h; y++ {
+		pa := ra.Pix[y*ra.Stride : y*ra.Stride+w*4]
+		pb := rb.Pix[y*rb.Stride : y*rb.Stride+w*4]
+		for x := 0; x < w; x++ {
+			i := x * 4
+			if absDiff(pa[i], pb[i]) <= t && absDiff(pa[i+1], pb[i+1]) <= t && absDiff(pa[i+2], pb[i+2]) <= t {
+				continue
+			}
+			res.Changed++
+			res.Mask.Pix[y*res.Mask.Stride+x] = 0xff
+			res.Bounds = res.Bounds.Union(image.Rect(x, y, x+1, y+1))
+		}
+	}
+
+	if w*h > 0 {
+		res.Ratio = float64(res.Changed) / float64(w*h)
+	}
+	return res, nil
+}
+
+// MarshalJSON adds the changed bounds as x/y/width/height
+func (r *Result) MarshalJSON() ([]byte, error) {
+	type box struct {
+		X      int `json:"x"`
+		Y      int `json:"y"`
+		Width  int `json:"width"`
+		Height int `json:"height"`
+	}
+	type plain Result
+	out := struct {
+		*plain
+		Bounds *box `json:"bounds,omitempty"`
+	}{plain: (*plain)(r)}
+	if !r.Bounds.Empty() {
+		b := r.Bounds
+		out.Bounds = &box{b.Min.X, b.Min.Y, b.Dx(), b.Dy()}
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON reads what MarshalJSON writes
+func (r *Result) UnmarshalJSON(data []byte) error {
+	type plain Result
+	in := struct {
+		*plain
+		Bounds *struct{ X, Y, Width, Height int } `json:"bounds"`
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	if b := in.Bounds; b != nil {
+		r.Bounds = image.Rect(b.X, b.Y, b.X+b.Width, b.Y+b.Height)
+	}
+	return nil
+}
+
+// Highlight renders the "after" image dimmed, with changed pixels painted
+// in c, for a quick visual of what moved
+func Highlight(after image.Image, res *Result, c color.Color) *image.RGBA {
+	out := toRGBA(after)
+	dimmed := image.NewRGBA(out.Rect)
+	draw.Draw(dimmed, dimmed.Rect, out, out.Rect.Min, draw.Src)
+	draw.DrawMask(dimmed, dimmed.Rect, image.NewUniform(color.RGBA{0, 0, 0, 0xff}), image.Point{},
+		image.NewUniform(color.Alpha{0x90}), image.Point{}, draw.Over)
+	draw.DrawMask(dimmed, dimmed.Rect, image.NewUniform(c), image.Point{}, res.Mask, image.Point{}, draw.Over)
+	return dimmed
+}
+
+// toRGBA returns img as an *image.RGBA with its origin at (0,0)
+func toRGBA(img image.Image) *image.RGBA {
+	if r, ok := img.(*image.RGBA); ok && r.Rect.Min == (image.Point{}) {
+		return r
+	}
+	b := img.Bounds()
+	r := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(r, r.Rect, img, b.Min, draw.Src)
+	return r
+}
+
+func absDiff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
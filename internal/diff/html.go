@@ -0,0 +1,103 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"image"
+	"image/png"
+	"io"
+)
+
+// sliderTemplate is a self-contained page with a before/after swipe slider
+var sliderTemplate = template.Must(template.New("slider").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+  body { margin: 0; padding: 1.5rem; font-family: system-ui, sans-serif; background: #1e1e1e; color: #ddd; }
+  h1 { font-size: 1.1rem; font-weight: 600; margin: 0 0 .25rem; }
+  p { margin: 0 0 1rem; color: #aaa; font-size: .9rem; }
+  .compare { position: relative; display: inline-block; max-width: 100%; user-select: none; line-height: 0; }
+  .compare img { display: block; max-width: 100%; height: auto; }
+  .compare .before { position: absolute; inset: 0; clip-path: inset(0 50% 0 0); }
+  .compare .line { position: absolute; top: 0; bottom: 0; left: 50%; width: 2px; background: #fff; box-shadow: 0 0 4px #000; pointer-events: none; }
+  .compare .tag { position: absolute; top: .5rem; padding: .15rem .5rem; font-size: .75rem; line-height: 1.4; background: rgba(0,0,0,.6); border-radius: 3px; }
+  .compare .tag.l { left: .5rem; } .compare .tag.r { right: .5rem; }
+  input[type=range] { display: block; width: 100%; margin: .75rem 0 0; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Summary}}</p>
+<div class="compare" id="compare">
+  <img class="after" src="{{.After}}" alt="{{.AfterName}}">
+  <img class="before" id="before" src="{{.Before}}" alt="{{.BeforeName}}">
+  <div class="line" id="line"></div>
+  <span class="tag l">{{.BeforeName}}</span><span class="tag r">{{.AfterName}}</span>
+</div>
+<input type="range" id="slider" min="0" max="100" value="50" step="0.1" aria-label="Before/after position">
+<script>
+  const slider = document.getElementById('slider');
+  const before = document.getElementById('before');
+  const line = document.getElementById('line');
+  const box = document.getElementById('compare');
+  function set(pct) {
+    slider.value = pct;
+    before.style.clipPath = 'inset(0 ' + (100 - pct) + '% 0 0)';
+    line.style.left = pct + '%';
+  }
+  slider.addEventListener('input', () => set(slider.value));
+  box.addEventListener('pointermove', e => {
+    if (e.buttons !== 1 && e.pointerType === 'mouse') return;
+    const r = box.getBoundingClientRect();
+    set(Math.max(0, Math.min(100, (e.clientX - r.left) / r.width * 100)));
+  });
+</script>
+</body>
+</html>
+`))
+
+// SliderPage holds the content of an HTML comparison page
+type SliderPage struct {
+	Title      string
+	Summary    string
+	BeforeName string
+	AfterName  string
+	Before     image.Image
+	After      image.Image
+}
+
+// WriteSliderHTML writes a standalone HTML page with both images embedded
+// and a slider that swipes between them
+func WriteSliderHTML(w io.Writer, page SliderPage) error {
+	before, err := dataURL(page.Before)
+	if err != nil {
+		return err
+	}
+	after, err := dataURL(page.After)
+	if err != nil {
+		return err
+	}
+
+	return sliderTemplate.Execute(w, map[string]any{
+		"Title":      page.Title,
+		"Summary":    page.Summary,
+		"BeforeName": page.BeforeName,
+		"AfterName":  page.AfterName,
+		"Before":     before,
+		"After":      after,
+	})
+}
+
+// dataURL encodes an image as a PNG data URL
+func dataURL(img image.Image) (template.URL, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", fmt.Errorf("failed to encode image: %w", err)
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())), nil
+}
@@ -0,0 +1,164 @@
+// Package document turns captures of text into high-contrast grayscale or
+// black and white images for OCR and printing
+package document
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Mode selects the document conversion
+type Mode string
+
+const (
+	// Off leaves captures unchanged
+	Off Mode = ""
+
+	// Gray converts to grayscale with the contrast stretched to full range
+	Gray Mode = "gray"
+
+	// Bilevel converts to black and white and removes isolated specks
+	Bilevel Mode = "bilevel"
+)
+
+// ParseMode parses a --document value
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case Off, Gray, Bilevel:
+		return m, nil
+	}
+	return Off, fmt.Errorf("invalid document mode %q (expected gray or bilevel)", s)
+}
+
+// Apply converts img. Gray returns an *image.Gray and Bilevel a
+// two-color *image.Paletted, which encode as 8-bit and 1-bit PNGs.
+func Apply(img image.Image, mode Mode) image.Image {
+	switch mode {
+	case Gray:
+		return stretch(grayscale(img))
+	case Bilevel:
+		g := stretch(grayscale(img))
+		return despeckle(threshold(g, otsu(g)))
+	}
+	return img
+}
+
+func grayscale(img image.Image) *image.Gray {
+	b := img.Bounds()
+	g := image.NewGray(b)
+	draw.Draw(g, b, img, b.Min, draw.Src)
+	return g
+}
+
+// stretch maps the 1st to 99th percentile of brightness onto 0-255, so
+// gray-on-gray themes become black on white (or white on black)
+func stretch(g *image.Gray) *image.Gray {
+	var hist [256]int
+	for _, v := range g.Pix {
+		hist[v]++
+	}
+
+	total := len(g.Pix)
+	lo, hi := 0, 255
+	for sum := 0; lo < 255; lo++ {
+		if sum += hist[lo]; sum > total/100 {
+			break
+		}
+	}
+	for sum := 0; hi > 0; hi-- {
+		if sum += hist[hi]; sum > total/100 {
+			break
+		}
+	}
+	if hi <= lo {
+		return g
+	}
+
+	var lut [256]uint8
+	for v := range lut {
+		lut[v] = uint8(min(max((v-lo)*255/(hi-lo), 0), 255))
+	}
+	for i, v := range g.Pix {
+		g.Pix[i] = lut[v]
+	}
+	return g
+}
+
+// otsu picks the threshold that best separates ink from background
+func otsu(g *image.Gray) uint8 {
+	var hist [256]float64
+	for _, v := range g.Pix {
+		hist[v]++
+	}
+	total := float64(len(g.Pix))
+
+	var sumAll float64
+	for v, n := range hist {
+		sumAll += float64(v) * n
+	}
+
+	var sumB, wB, best float64
+	t := uint8(128)
+	for v, n := range hist {
+		wB += n
+		if wB == 0 {
+			continue
+		}
+		wF := total - wB
+		if wF == 0 {
+			break
+		}
+		sumB += float64(v) * n
+		mB, mF := sumB/wB, (sumAll-sumB)/wF
+		if between := wB * wF * (mB - mF) * (mB - mF); between > best {
+			best, t = between, uint8(v)
+		}
+	}
+	return t
+}
+
+var bilevelPalette = color.Palette{color.Gray{0}, color.Gray{255}}
+
+// threshold returns a black and white image: 0 is black, 1 is white
+func threshold(g *image.Gray, t uint8) *image.Paletted {
+	b := g.Bounds()
+	p := image.NewPaletted(b, bilevelPalette)
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			if g.Pix[y*g.Stride+x] > t {
+				p.Pix[y*p.Stride+x] = 1
+			}
+		}
+	}
+	return p
+}
+
+// despeckle flips pixels none of whose 8 neighbours share their color,
+// removing noise dots without eroding strokes
+func despeckle(p *image.Paletted) *image.Paletted {
+	b := p.Bounds()
+	w, h := b.Dx(), b.Dy()
+	out := image.NewPaletted(b, p.Palette)
+	copy(out.Pix, p.Pix)
+
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			v := p.Pix[y*p.Stride+x]
+			alone := true
+			for dy := -1; dy <= 1 && alone; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					if (dx != 0 || dy != 0) && p.Pix[(y+dy)*p.Stride+x+dx] == v {
+						alone = false
+						break
+					}
+				}
+			}
+			if alone {
+				out.Pix[y*out.Stride+x] = 1 - v
+			}
+		}
+	}
+	return out
+}
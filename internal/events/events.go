@@ -0,0 +1,130 @@
+// Package events passes capture lifecycle events to subscribers, for
+// progress UIs and integrations
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	CaptureStarted   = "capture.started"
+	CaptureSucceeded = "capture.succeeded"
+	CaptureFailed    = "capture.failed"
+	FileWritten      = "file.written"
+	UploadFinished   = "upload.finished"
+	Progress         = "progress"
+)
+
+// Event is something that happened to a capture. Only the fields that
+// apply to its type are set.
+type Event struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+
+	// Target describes what is captured, e.g. "monitor 1"
+	Target string `json:"target,omitempty"`
+
+	// Attempts is how many attempts a capture took
+	Attempts int `json:"attempts,omitempty"`
+
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+
+	// Path is the file written or uploaded
+	Path string `json:"path,omitempty"`
+
+	// URL is where an upload ended up
+	URL string `json:"url,omitempty"`
+
+	// Queued is set when an upload was spooled to retry later
+	Queued bool `json:"queued,omitempty"`
+
+	// Phase is the step a progress event is about: encode, write or
+	// upload
+	Phase string `json:"phase,omitempty"`
+
+	// Done and Total are the bytes a progress event counts; Total is 0
+	// when unknown (encoding)
+	Done  int64 `json:"done,omitempty"`
+	Total int64 `json:"total,omitempty"`
+
+	// Error is why a capture or upload failed
+	Error string `json:"error,omitempty"`
+}
+
+// Bus delivers published events to its subscribers. The zero value is
+// ready to use, and a nil *Bus drops events.
+type Bus struct {
+	mu     sync.Mutex
+	next   int
+	subs   map[int]func(Event)
+	order  []int
+	sendMu sync.Mutex
+}
+
+// Subscribe calls fn with every event published from now on, in order,
+// until the returned function is called. fn runs on the publishing
+// goroutine and should return quickly.
+func (b *Bus) Subscribe(fn func(Event)) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs == nil {
+		b.subs = make(map[int]func(Event))
+	}
+	id := b.next
+	b.next++
+	b.subs[id] = fn
+	b.order = append(b.order, id)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subs, id)
+			for i, o := range b.order {
+				if o == id {
+					b.order = append(b.order[:i:i], b.order[i+1:]...)
+					break
+				}
+			}
+		})
+	}
+}
+
+// Publish sends e to the subscribers, setting its time if unset. Events
+// published from several goroutines reach each subscriber one at a time.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	b.mu.Lock()
+	fns := make([]func(Event), 0, len(b.order))
+	for _, id := range b.order {
+		fns = append(fns, b.subs[id])
+	}
+	b.mu.Unlock()
+
+	b.sendMu.Lock()
+	defer b.sendMu.Unlock()
+	for _, fn := range fns {
+		fn(e)
+	}
+}
+
+// JSONLines returns a subscriber that writes each event to w as one line
+// of JSON
+func JSONLines(w io.Writer) func(Event) {
+	enc := json.NewEncoder(w)
+	return func(e Event) {
+		enc.Encode(e)
+	}
+}
@@ -0,0 +1,72 @@
+// Package feedback confirms captures to the user with a screen flash or
+// a shutter sound, for captures fired from a hotkey
+package feedback
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/robotin/screenshot/internal/xwin"
+)
+
+// FlashDuration is how long the flash overlay stays up
+const FlashDuration = 120 * time.Millisecond
+
+// Flash briefly covers area (in screen coordinates) with white on the
+// given X display (empty for $DISPLAY)
+func Flash(display string, area image.Rectangle) error {
+	conn, err := xwin.Connect(display)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Flash(area, FlashDuration)
+}
+
+// shutterSound is the freedesktop sound theme's camera shutter, relative
+// to a data directory
+const shutterSound = "sounds/freedesktop/stereo/camera-shutter.oga"
+
+// Shutter starts playing a camera shutter sound through PulseAudio (or
+// PipeWire's Pulse server) and returns without waiting for it to finish.
+// It uses paplay with the freedesktop sound theme, or canberra-gtk-play.
+func Shutter() error {
+	if path, err := exec.LookPath("paplay"); err == nil {
+		if sound := findSound(); sound != "" {
+			return start(exec.Command(path, sound))
+		}
+	}
+	if path, err := exec.LookPath("canberra-gtk-play"); err == nil {
+		return start(exec.Command(path, "--id", "camera-shutter", "--description", "Screenshot"))
+	}
+	return fmt.Errorf("no shutter sound: install paplay (pulseaudio-utils) and sound-theme-freedesktop, or canberra-gtk-play")
+}
+
+// findSound looks for the shutter sound in $XDG_DATA_DIRS
+func findSound() string {
+	dirs := os.Getenv("XDG_DATA_DIRS")
+	if dirs == "" {
+		dirs = "/usr/local/share:/usr/share"
+	}
+	for _, dir := range strings.Split(dirs, ":") {
+		path := filepath.Join(dir, shutterSound)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// start runs cmd in the background, reaping it when it exits
+func start(cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to play shutter sound: %w", err)
+	}
+	go cmd.Wait()
+	return nil
+}
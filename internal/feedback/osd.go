@@ -0,0 +1,72 @@
+package feedback
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"time"
+
+	"github.com/robotin/screenshot/internal/xwin"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// OSDDuration is how long the result OSD stays up unless clicked
+const OSDDuration = 4 * time.Second
+
+// osdMaxChars bounds the location shown; longer ones lose their start,
+// keeping the file name
+const osdMaxChars = 72
+
+// Layout of the OSD, in pixels
+const (
+	osdMargin  = 16 // from the monitor's edges
+	osdPadding = 8
+)
+
+// RenderOSD returns the OSD for a saved file or uploaded URL: the
+// location over a hint to click it, on a dark band
+func RenderOSD(location string) *image.RGBA {
+	if r := []rune(location); len(r) > osdMaxChars {
+		location = "..." + string(r[len(r)-osdMaxChars+3:])
+	}
+	hint := "Click to open"
+
+	face := basicfont.Face7x13
+	lineHeight := face.Metrics().Height.Ceil()
+	w := 2*osdPadding + max(font.MeasureString(face, location).Ceil(), font.MeasureString(face, hint).Ceil())
+	h := 2*osdPadding + 2*lineHeight + osdPadding/2
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{0x20, 0x20, 0x20, 0xff}), image.Point{}, draw.Src)
+
+	d := &font.Drawer{Dst: img, Src: image.White, Face: face}
+	d.Dot = fixed.P(osdPadding, osdPadding+face.Ascent)
+	d.DrawString(location)
+	d.Src = image.NewUniform(color.RGBA{0xa0, 0xa0, 0xa0, 0xff})
+	d.Dot = fixed.P(osdPadding, osdPadding+lineHeight+osdPadding/2+face.Ascent)
+	d.DrawString(hint)
+	return img
+}
+
+// OSD shows where a capture went in the bottom-right corner of monitor
+// (in screen coordinates) on the given X display (empty for $DISPLAY),
+// for OSDDuration or until clicked. It reports whether it was clicked.
+// The window is override-redirect, so it needs no notification daemon
+// and the window manager leaves it alone.
+func OSD(display string, monitor image.Rectangle, location string) (bool, error) {
+	conn, err := xwin.Connect(display)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	img := RenderOSD(location)
+	size := img.Bounds().Size()
+	o, err := conn.ShowImage(img, image.Pt(monitor.Max.X-osdMargin-size.X, monitor.Max.Y-osdMargin-size.Y))
+	if err != nil {
+		return false, err
+	}
+	defer o.Close()
+	return o.WaitClick(OSDDuration)
+}
@@ -0,0 +1,213 @@
+//go:build gpu && cgo && linux
+
+package gpu
+
+/*
+#cgo pkg-config: xcb
+
+#include <stdlib.h>
+#include <unistd.h>
+#include <xcb/xcb.h>
+#include <xcb/xcbext.h>
+
+// The DRI3 requests are sent by hand, as libxcb-dri3 would, so only
+// libxcb itself is needed
+static xcb_extension_t dri3_id = {"DRI3", 0};
+
+typedef struct {
+	uint8_t major_opcode, minor_opcode;
+	uint16_t length;
+	uint32_t major_version, minor_version;
+} dri3_query_version_request;
+
+typedef struct {
+	uint8_t major_opcode, minor_opcode;
+	uint16_t length;
+	uint32_t pixmap;
+} dri3_buffer_from_pixmap_request;
+
+typedef struct {
+	uint8_t response_type, nfd;
+	uint16_t sequence;
+	uint32_t length, size;
+	uint16_t width, height, stride;
+	uint8_t depth, bpp;
+	uint8_t pad[12];
+} dri3_buffer_from_pixmap_reply;
+
+// dri3_request sends a DRI3 request and waits for its reply
+static void *dri3_request(xcb_connection_t *c, uint8_t opcode, void *req, size_t len, int flags) {
+	const xcb_protocol_request_t proto = {2, &dri3_id, opcode, 0};
+	struct iovec parts[4];
+	parts[2].iov_base = req;
+	parts[2].iov_len = len;
+	parts[3].iov_base = 0;
+	parts[3].iov_len = -len & 3;
+	unsigned int seq = xcb_send_request(c, XCB_REQUEST_CHECKED | flags, parts + 2, &proto);
+	xcb_generic_error_t *err = NULL;
+	void *reply = xcb_wait_for_reply(c, seq, &err);
+	free(err);
+	return reply;
+}
+
+// dmabuf_grab copies a rectangle of the root window into a pixmap, on the
+// X server's GPU, and exports the pixmap as a DMA-BUF
+static const char *dmabuf_grab(const char *name, int x, int y, int w, int h, int *fd, int *stride, int *depth, int *bpp) {
+	int screen_num;
+	xcb_connection_t *c = xcb_connect(name, &screen_num);
+	if (xcb_connection_has_error(c)) {
+		xcb_disconnect(c);
+		return "failed to connect to the X server";
+	}
+
+	const char *err = NULL;
+	const xcb_query_extension_reply_t *ext = xcb_get_extension_data(c, &dri3_id);
+	if (!ext || !ext->present) {
+		err = "the X server has no DRI3 extension";
+		goto done;
+	}
+	dri3_query_version_request version = {.major_version = 1, .minor_version = 0};
+	free(dri3_request(c, 0, &version, sizeof version, 0));
+
+	xcb_screen_iterator_t it = xcb_setup_roots_iterator(xcb_get_setup(c));
+	for (; screen_num > 0 && it.rem; screen_num--) {
+		xcb_screen_next(&it);
+	}
+	xcb_screen_t *screen = it.data;
+
+	xcb_pixmap_t pixmap = xcb_generate_id(c);
+	xcb_create_pixmap(c, screen->root_depth, pixmap, screen->root, w, h);
+	xcb_gcontext_t gc = xcb_generate_id(c);
+	uint32_t mode = XCB_SUBWINDOW_MODE_INCLUDE_INFERIORS;
+	xcb_create_gc(c, gc, pixmap, XCB_GC_SUBWINDOW_MODE, &mode);
+	xcb_copy_area(c, screen->root, pixmap, gc, x, y, 0, 0, w, h);
+	xcb_free_gc(c, gc);
+
+	dri3_buffer_from_pixmap_request req = {.pixmap = pixmap};
+	dri3_buffer_from_pixmap_reply *reply = dri3_request(c, 3, &req, sizeof req, XCB_REQUEST_REPLY_FDS);
+	if (!reply || reply->nfd != 1) {
+		err = "the X server can't export the screen as a DMA-BUF";
+	} else {
+		*fd = xcb_get_reply_fds(c, reply, sizeof *reply + 4 * reply->length)[0];
+		*stride = reply->stride;
+		*depth = reply->depth;
+		*bpp = reply->bpp;
+	}
+	free(reply);
+
+	// The DMA-BUF keeps the pixmap's memory alive
+	xcb_free_pixmap(c, pixmap);
+	xcb_flush(c);
+done:
+	xcb_disconnect(c);
+	return err;
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// Frame is a screen grab imported from a DMA-BUF and still on the GPU.
+// YUV420 converts it there, so only the YUV planes are copied to memory;
+// reading its pixels copies them back, once.
+type Frame struct {
+	rect  image.Rectangle
+	tex   uint32
+	image unsafe.Pointer
+
+	once sync.Once
+	rgba *image.RGBA
+}
+
+// GrabX11 grabs a rectangle of the X11 root window on display ("" for
+// $DISPLAY) without copying it through the CPU: the X server copies it
+// into a pixmap, exports that as a DMA-BUF (DRI3) and the GPU imports it.
+// It fails when the X server or the GPU driver can't share buffers; the
+// SHM grab is the fallback.
+func GrabX11(display string, r image.Rectangle) (image.Image, error) {
+	if err := start(); err != nil {
+		return nil, err
+	}
+	if r.Empty() {
+		return nil, errors.New("empty area")
+	}
+
+	var name *C.char
+	if display != "" {
+		name = C.CString(display)
+		defer C.free(unsafe.Pointer(name))
+	}
+	var fd, stride, depth, bpp C.int
+	if msg := C.dmabuf_grab(name, C.int(r.Min.X), C.int(r.Min.Y), C.int(r.Dx()), C.int(r.Dy()), &fd, &stride, &depth, &bpp); msg != nil {
+		return nil, errors.New(C.GoString(msg))
+	}
+	// The GPU keeps its own reference to the buffer
+	defer C.close(fd)
+	if bpp != 32 {
+		return nil, fmt.Errorf("unsupported DMA-BUF of %d bits per pixel", bpp)
+	}
+
+	f := &Frame{rect: image.Rect(0, 0, r.Dx(), r.Dy())}
+	var err error
+	do(func() {
+		f.tex, f.image, err = importDMABuf(int(fd), r.Dx(), r.Dy(), int(stride), int(depth))
+	})
+	if err != nil {
+		return nil, err
+	}
+	runtime.SetFinalizer(f, (*Frame).release)
+	return f, nil
+}
+
+// release frees the frame's texture
+func (f *Frame) release() {
+	do(func() {
+		releaseTexture(f.tex, f.image)
+	})
+}
+
+// ColorModel implements image.Image
+func (f *Frame) ColorModel() color.Model {
+	return color.RGBAModel
+}
+
+// Bounds implements image.Image
+func (f *Frame) Bounds() image.Rectangle {
+	return f.rect
+}
+
+// At implements image.Image, reading the frame back the first time
+func (f *Frame) At(x, y int) color.Color {
+	return f.RGBA().At(x, y)
+}
+
+// RGBA copies the frame back from the GPU the first time it's called
+func (f *Frame) RGBA() *image.RGBA {
+	f.once.Do(func() {
+		f.rgba = image.NewRGBA(f.rect)
+		var err error
+		do(func() {
+			err = readTexture(f.tex, f.rgba)
+		})
+		if err != nil {
+			Debugf("%v", err)
+		}
+	})
+	return f.rgba
+}
+
+// yuv420 converts the frame on the GPU
+func (f *Frame) yuv420() (y, u, v []byte, err error) {
+	do(func() {
+		y, u, v, err = convertTexture(f.tex, f.rect.Dx(), f.rect.Dy())
+	})
+	return y, u, v, err
+}
@@ -0,0 +1,19 @@
+// Package gpu converts frames to YUV 4:2:0 with an OpenGL ES compute
+// shader, for streaming and encoding at resolutions where the CPU
+// conversion can't keep up. It is only compiled with the gpu build tag
+// (and cgo, on Linux); otherwise, or when no EGL device can be opened,
+// every function returns an error and callers convert on the CPU.
+//
+// The conversion matches the CPU one byte for byte: full-range BT.601
+// with 2x2 chroma averaging. With GrabX11, frames can go from the X
+// server to the conversion without passing through the CPU at all.
+package gpu
+
+import "errors"
+
+// ErrNotCompiled is returned by builds without the gpu tag
+var ErrNotCompiled = errors.New("GPU support is not compiled in (build with -tags gpu)")
+
+// Debugf, if set, is told which path frames took (a DMA-BUF grab or the
+// SHM fallback, the GPU or the CPU conversion) and why
+var Debugf = func(format string, args ...any) {}
@@ -0,0 +1,399 @@
+//go:build gpu && cgo && linux
+
+package gpu
+
+/*
+#cgo pkg-config: egl glesv2
+
+#include <stdint.h>
+#include <string.h>
+#include <EGL/egl.h>
+#include <EGL/eglext.h>
+#include <GLES3/gl31.h>
+
+// Each invocation converts a block of 8x2 pixels, writing two words of
+// luma on each of its rows and one word each of U and V, so no two
+// invocations write the same word. The arithmetic is Go's
+// color.RGBToYCbCr, so the result matches the CPU conversion exactly.
+static const char *shader_source =
+	"#version 310 es\n"
+	"layout(local_size_x = 8, local_size_y = 8) in;\n"
+	"uniform highp sampler2D src;\n"
+	"uniform ivec2 size;\n"
+	"layout(std430, binding = 0) writeonly buffer Y { uint y[]; };\n"
+	"layout(std430, binding = 1) writeonly buffer U { uint u[]; };\n"
+	"layout(std430, binding = 2) writeonly buffer V { uint v[]; };\n"
+	"void main() {\n"
+	"	ivec2 g = ivec2(gl_GlobalInvocationID.xy);\n"
+	"	int cw = (size.x + 1) / 2, ch = (size.y + 1) / 2;\n"
+	"	int cwords = (cw + 3) / 4;\n"
+	"	if (g.x >= cwords || g.y >= ch) return;\n"
+	"	uint luma[4] = uint[4](0u, 0u, 0u, 0u);\n"
+	"	uint uw = 0u, vw = 0u;\n"
+	"	for (int i = 0; i < 4; i++) {\n"
+	"		int cx = g.x * 4 + i;\n"
+	"		if (cx >= cw) break;\n"
+	"		int su = 0, sv = 0, n = 0;\n"
+	"		for (int dy = 0; dy < 2; dy++) {\n"
+	"			int py = g.y * 2 + dy;\n"
+	"			if (py >= size.y) break;\n"
+	"			for (int dx = 0; dx < 2; dx++) {\n"
+	"				int px = cx * 2 + dx;\n"
+	"				if (px >= size.x) break;\n"
+	"				ivec3 c = ivec3(round(texelFetch(src, ivec2(px, py), 0).rgb * 255.0));\n"
+	"				int yy = (19595 * c.r + 38470 * c.g + 7471 * c.b + 32768) >> 16;\n"
+	"				int cb = (-11056 * c.r - 21712 * c.g + 32768 * c.b + 8421376) >> 16;\n"
+	"				int cr = (32768 * c.r - 27440 * c.g - 5328 * c.b + 8421376) >> 16;\n"
+	"				su += clamp(cb, 0, 255);\n"
+	"				sv += clamp(cr, 0, 255);\n"
+	"				n++;\n"
+	"				int k = i * 2 + dx;\n"
+	"				luma[dy * 2 + k / 4] |= uint(yy) << (8 * (k % 4));\n"
+	"			}\n"
+	"		}\n"
+	"		uw |= uint((su + n / 2) / n) << (8 * i);\n"
+	"		vw |= uint((sv + n / 2) / n) << (8 * i);\n"
+	"	}\n"
+	"	for (int dy = 0; dy < 2; dy++) {\n"
+	"		if (g.y * 2 + dy < size.y) {\n"
+	"			int row = (g.y * 2 + dy) * cwords * 2 + g.x * 2;\n"
+	"			y[row] = luma[dy * 2];\n"
+	"			y[row + 1] = luma[dy * 2 + 1];\n"
+	"		}\n"
+	"	}\n"
+	"	u[g.y * cwords + g.x] = uw;\n"
+	"	v[g.y * cwords + g.x] = vw;\n"
+	"}\n";
+
+static EGLDisplay display = EGL_NO_DISPLAY;
+static EGLContext context = EGL_NO_CONTEXT;
+static GLuint program, buffers[3];
+static GLint src_loc, size_loc;
+static char info_log[1024];
+
+// gpu_init opens a surfaceless EGL display on the first GPU, makes an
+// OpenGL ES 3.1 context current on this thread and builds the shader.
+// It returns NULL on success, or why it failed.
+static const char *gpu_init(void) {
+	PFNEGLGETPLATFORMDISPLAYEXTPROC get_display =
+		(PFNEGLGETPLATFORMDISPLAYEXTPROC)eglGetProcAddress("eglGetPlatformDisplayEXT");
+	if (!get_display) {
+		return "EGL has no eglGetPlatformDisplayEXT";
+	}
+	display = get_display(EGL_PLATFORM_SURFACELESS_MESA, EGL_DEFAULT_DISPLAY, NULL);
+	if (display == EGL_NO_DISPLAY || !eglInitialize(display, NULL, NULL)) {
+		return "failed to open a surfaceless EGL display";
+	}
+	if (!eglBindAPI(EGL_OPENGL_ES_API)) {
+		return "EGL has no OpenGL ES";
+	}
+	const EGLint attrs[] = {EGL_CONTEXT_MAJOR_VERSION, 3, EGL_CONTEXT_MINOR_VERSION, 1, EGL_NONE};
+	context = eglCreateContext(display, EGL_NO_CONFIG_KHR, EGL_NO_CONTEXT, attrs);
+	if (context == EGL_NO_CONTEXT) {
+		return "failed to create an OpenGL ES 3.1 context";
+	}
+	if (!eglMakeCurrent(display, EGL_NO_SURFACE, EGL_NO_SURFACE, context)) {
+		return "failed to make the OpenGL ES context current";
+	}
+
+	GLint ok;
+	GLuint shader = glCreateShader(GL_COMPUTE_SHADER);
+	glShaderSource(shader, 1, &shader_source, NULL);
+	glCompileShader(shader);
+	glGetShaderiv(shader, GL_COMPILE_STATUS, &ok);
+	if (!ok) {
+		glGetShaderInfoLog(shader, sizeof info_log, NULL, info_log);
+		return info_log;
+	}
+	program = glCreateProgram();
+	glAttachShader(program, shader);
+	glLinkProgram(program);
+	glDeleteShader(shader);
+	glGetProgramiv(program, GL_LINK_STATUS, &ok);
+	if (!ok) {
+		glGetProgramInfoLog(program, sizeof info_log, NULL, info_log);
+		return info_log;
+	}
+	src_loc = glGetUniformLocation(program, "src");
+	size_loc = glGetUniformLocation(program, "size");
+	glGenBuffers(3, buffers);
+	return NULL;
+}
+
+// read_plane copies rows of width bytes out of a shader storage buffer
+// whose rows are stride bytes apart
+static int read_plane(GLuint buffer, uint8_t *dst, int width, int stride, int rows) {
+	glBindBuffer(GL_SHADER_STORAGE_BUFFER, buffer);
+	const uint8_t *src = glMapBufferRange(GL_SHADER_STORAGE_BUFFER, 0, (GLsizeiptr)stride * rows, GL_MAP_READ_BIT);
+	if (!src) {
+		return 0;
+	}
+	for (int r = 0; r < rows; r++) {
+		memcpy(dst + (size_t)r * width, src + (size_t)r * stride, width);
+	}
+	return glUnmapBuffer(GL_SHADER_STORAGE_BUFFER);
+}
+
+// gpu_convert converts texture tex of w x h pixels into YUV 4:2:0 planes
+static const char *gpu_convert(GLuint tex, int w, int h, uint8_t *y, uint8_t *u, uint8_t *v) {
+	int cw = (w + 1) / 2, ch = (h + 1) / 2;
+	int cstride = (cw + 3) / 4 * 4, ystride = cstride * 2;
+
+	const GLsizeiptr sizes[3] = {(GLsizeiptr)ystride * h, (GLsizeiptr)cstride * ch, (GLsizeiptr)cstride * ch};
+	for (int i = 0; i < 3; i++) {
+		glBindBufferBase(GL_SHADER_STORAGE_BUFFER, i, buffers[i]);
+		glBufferData(GL_SHADER_STORAGE_BUFFER, sizes[i], NULL, GL_STREAM_READ);
+	}
+
+	glUseProgram(program);
+	glActiveTexture(GL_TEXTURE0);
+	glBindTexture(GL_TEXTURE_2D, tex);
+	glTexParameteri(GL_TEXTURE_2D, GL_TEXTURE_MIN_FILTER, GL_NEAREST);
+	glTexParameteri(GL_TEXTURE_2D, GL_TEXTURE_MAG_FILTER, GL_NEAREST);
+	glUniform1i(src_loc, 0);
+	glUniform2i(size_loc, w, h);
+	glDispatchCompute((cstride / 4 + 7) / 8, (ch + 7) / 8, 1);
+	glMemoryBarrier(GL_BUFFER_UPDATE_BARRIER_BIT);
+
+	if (!read_plane(buffers[0], y, w, ystride, h) ||
+		!read_plane(buffers[1], u, cw, cstride, ch) ||
+		!read_plane(buffers[2], v, cw, cstride, ch)) {
+		return "failed to read the planes back from the GPU";
+	}
+	if (glGetError() != GL_NO_ERROR) {
+		return "the GPU conversion failed";
+	}
+	return NULL;
+}
+
+// gpu_convert_rgba uploads RGBA pixels, stride bytes per row, and
+// converts them
+static const char *gpu_convert_rgba(const uint8_t *pix, int stride, int w, int h, uint8_t *y, uint8_t *u, uint8_t *v) {
+	GLint max;
+	glGetIntegerv(GL_MAX_TEXTURE_SIZE, &max);
+	if (w > max || h > max) {
+		return "the frame is larger than the GPU's largest texture";
+	}
+
+	GLuint tex;
+	glGenTextures(1, &tex);
+	glBindTexture(GL_TEXTURE_2D, tex);
+	glTexStorage2D(GL_TEXTURE_2D, 1, GL_RGBA8, w, h);
+	glPixelStorei(GL_UNPACK_ROW_LENGTH, stride / 4);
+	glPixelStorei(GL_UNPACK_ALIGNMENT, 4);
+	glTexSubImage2D(GL_TEXTURE_2D, 0, 0, 0, w, h, GL_RGBA, GL_UNSIGNED_BYTE, pix);
+	const char *err = gpu_convert(tex, w, h, y, u, v);
+	glDeleteTextures(1, &tex);
+	return err;
+}
+
+// gpu_release frees a texture imported by gpu_import
+static void gpu_release(GLuint tex, EGLImageKHR image) {
+	glDeleteTextures(1, &tex);
+	PFNEGLDESTROYIMAGEKHRPROC destroy_image = (PFNEGLDESTROYIMAGEKHRPROC)eglGetProcAddress("eglDestroyImageKHR");
+	if (destroy_image) {
+		destroy_image(display, image);
+	}
+}
+
+typedef void (*image_target_fn)(GLenum target, void *image);
+
+// gpu_import imports a DMA-BUF of w x h 32-bit pixels (XRGB8888, or
+// ARGB8888 at depth 32) as a texture, without copying it. The DMA-BUF
+// fd stays the caller's to close.
+static const char *gpu_import(int fd, int w, int h, int stride, int depth, GLuint *tex, EGLImageKHR *image) {
+	const char *exts = eglQueryString(display, EGL_EXTENSIONS);
+	if (!exts || !strstr(exts, "EGL_EXT_image_dma_buf_import")) {
+		return "the GPU driver can't import DMA-BUFs";
+	}
+	PFNEGLCREATEIMAGEKHRPROC create_image = (PFNEGLCREATEIMAGEKHRPROC)eglGetProcAddress("eglCreateImageKHR");
+	image_target_fn target = (image_target_fn)eglGetProcAddress("glEGLImageTargetTexture2DOES");
+	if (!create_image || !target) {
+		return "EGL has no image support";
+	}
+
+	const EGLint attrs[] = {
+		EGL_WIDTH, w,
+		EGL_HEIGHT, h,
+		EGL_LINUX_DRM_FOURCC_EXT, depth == 32 ? 0x34325241 : 0x34325258, // AR24, XR24
+		EGL_DMA_BUF_PLANE0_FD_EXT, fd,
+		EGL_DMA_BUF_PLANE0_OFFSET_EXT, 0,
+		EGL_DMA_BUF_PLANE0_PITCH_EXT, stride,
+		EGL_NONE,
+	};
+	*image = create_image(display, EGL_NO_CONTEXT, EGL_LINUX_DMA_BUF_EXT, NULL, attrs);
+	if (*image == EGL_NO_IMAGE_KHR) {
+		return "failed to import the DMA-BUF";
+	}
+	glGenTextures(1, tex);
+	glBindTexture(GL_TEXTURE_2D, *tex);
+	target(GL_TEXTURE_2D, *image);
+
+	// Reading the frame back needs it as a framebuffer; check that works
+	// now, while the grab can still fall back
+	GLuint fb;
+	glGenFramebuffers(1, &fb);
+	glBindFramebuffer(GL_FRAMEBUFFER, fb);
+	glFramebufferTexture2D(GL_FRAMEBUFFER, GL_COLOR_ATTACHMENT0, GL_TEXTURE_2D, *tex, 0);
+	GLenum status = glCheckFramebufferStatus(GL_FRAMEBUFFER);
+	glBindFramebuffer(GL_FRAMEBUFFER, 0);
+	glDeleteFramebuffers(1, &fb);
+	if (glGetError() != GL_NO_ERROR || status != GL_FRAMEBUFFER_COMPLETE) {
+		gpu_release(*tex, *image);
+		return "the imported DMA-BUF can't be read back";
+	}
+	return NULL;
+}
+
+// gpu_read_rgba reads texture tex of w x h pixels back as RGBA, w*4 bytes
+// per row
+static const char *gpu_read_rgba(GLuint tex, int w, int h, uint8_t *pix) {
+	GLuint fb;
+	glGenFramebuffers(1, &fb);
+	glBindFramebuffer(GL_FRAMEBUFFER, fb);
+	glFramebufferTexture2D(GL_FRAMEBUFFER, GL_COLOR_ATTACHMENT0, GL_TEXTURE_2D, tex, 0);
+	glPixelStorei(GL_PACK_ALIGNMENT, 4);
+	glReadPixels(0, 0, w, h, GL_RGBA, GL_UNSIGNED_BYTE, pix);
+	glBindFramebuffer(GL_FRAMEBUFFER, 0);
+	glDeleteFramebuffers(1, &fb);
+	if (glGetError() != GL_NO_ERROR) {
+		return "failed to read the frame back from the GPU";
+	}
+	return NULL;
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+var (
+	startOnce sync.Once
+	startErr  error
+
+	// calls run on the thread the OpenGL context is current on
+	calls chan func()
+)
+
+// start creates the OpenGL context on a thread of its own, the first
+// time the GPU is used
+func start() error {
+	startOnce.Do(func() {
+		calls = make(chan func())
+		ready := make(chan error)
+		go func() {
+			runtime.LockOSThread()
+			if msg := C.gpu_init(); msg != nil {
+				ready <- errors.New(C.GoString(msg))
+				return
+			}
+			ready <- nil
+			for f := range calls {
+				f()
+			}
+		}()
+		startErr = <-ready
+	})
+	return startErr
+}
+
+// do runs f on the OpenGL thread and waits for it
+func do(f func()) {
+	done := make(chan struct{})
+	calls <- func() {
+		f()
+		close(done)
+	}
+	<-done
+}
+
+// Available opens the GPU if it isn't yet and reports why it can't be
+// used, if it can't
+func Available() error {
+	return start()
+}
+
+// YUV420 converts an image to full-range BT.601 YUV 4:2:0 planes on the
+// GPU. Chroma is subsampled by averaging each 2x2 block; odd widths and
+// heights round the chroma plane size up.
+func YUV420(img image.Image) (y, u, v []byte, err error) {
+	if err := start(); err != nil {
+		return nil, nil, nil, err
+	}
+	if f, ok := img.(*Frame); ok {
+		return f.yuv420()
+	}
+	rgba, ok := img.(*image.RGBA)
+	if !ok {
+		b := img.Bounds()
+		rgba = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+	}
+	b := rgba.Rect
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return nil, nil, nil, errors.New("empty image")
+	}
+
+	y, u, v = planes(w, h)
+	pix := rgba.Pix[rgba.PixOffset(b.Min.X, b.Min.Y):]
+	do(func() {
+		msg := C.gpu_convert_rgba((*C.uint8_t)(&pix[0]), C.int(rgba.Stride), C.int(w), C.int(h),
+			(*C.uint8_t)(&y[0]), (*C.uint8_t)(&u[0]), (*C.uint8_t)(&v[0]))
+		if msg != nil {
+			err = errors.New(C.GoString(msg))
+		}
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return y, u, v, nil
+}
+
+// planes allocates the YUV 4:2:0 planes of a w x h image
+func planes(w, h int) (y, u, v []byte) {
+	cw, ch := (w+1)/2, (h+1)/2
+	return make([]byte, w*h), make([]byte, cw*ch), make([]byte, cw*ch)
+}
+
+// The texture helpers below must run on the OpenGL thread (see do)
+
+// importDMABuf imports a DMA-BUF as a texture
+func importDMABuf(fd, w, h, stride, depth int) (tex uint32, img unsafe.Pointer, err error) {
+	var t C.GLuint
+	var i C.EGLImageKHR
+	if msg := C.gpu_import(C.int(fd), C.int(w), C.int(h), C.int(stride), C.int(depth), &t, &i); msg != nil {
+		return 0, nil, errors.New(C.GoString(msg))
+	}
+	return uint32(t), unsafe.Pointer(i), nil
+}
+
+// releaseTexture frees a texture made by importDMABuf
+func releaseTexture(tex uint32, img unsafe.Pointer) {
+	C.gpu_release(C.GLuint(tex), C.EGLImageKHR(img))
+}
+
+// readTexture copies a texture back into dst, whose rows must be packed
+func readTexture(tex uint32, dst *image.RGBA) error {
+	w, h := dst.Rect.Dx(), dst.Rect.Dy()
+	if msg := C.gpu_read_rgba(C.GLuint(tex), C.int(w), C.int(h), (*C.uint8_t)(&dst.Pix[0])); msg != nil {
+		return errors.New(C.GoString(msg))
+	}
+	return nil
+}
+
+// convertTexture converts a w x h texture to YUV 4:2:0 planes
+func convertTexture(tex uint32, w, h int) (y, u, v []byte, err error) {
+	y, u, v = planes(w, h)
+	msg := C.gpu_convert(C.GLuint(tex), C.int(w), C.int(h), (*C.uint8_t)(&y[0]), (*C.uint8_t)(&u[0]), (*C.uint8_t)(&v[0]))
+	if msg != nil {
+		return nil, nil, nil, errors.New(C.GoString(msg))
+	}
+	return y, u, v, nil
+}
@@ -0,0 +1,20 @@
+//go:build !gpu || !cgo || !linux
+
+package gpu
+
+import "image"
+
+// Available reports why the GPU can't be used
+func Available() error {
+	return ErrNotCompiled
+}
+
+// YUV420 is only available with the gpu build tag
+func YUV420(img image.Image) (y, u, v []byte, err error) {
+	return nil, nil, nil, ErrNotCompiled
+}
+
+// GrabX11 is only available with the gpu build tag
+func GrabX11(display string, r image.Rectangle) (image.Image, error) {
+	return nil, ErrNotCompiled
+}
@@ -0,0 +1,113 @@
+package heatmap
+
+import (
+	"image"
+	"image/draw"
+	"slices"
+)
+
+// BurnInOptions control what counts as a burn-in risk
+type BurnInOptions struct {
+	// CellSize is the size of the square cells the screen is checked in
+	CellSize int
+
+	// MinContrast is the smallest difference between a cell's darkest and
+	// brightest pixel (0-255) for it to count: static text, logos and
+	// borders burn in as visible edges, flat areas much less
+	MinContrast uint8
+
+	// StaticSince is the capture number the cells' pixels must have been
+	// unchanged since: a cell whose last change came with a later capture
+	// doesn't count
+	StaticSince int
+}
+
+// Region is a static, high-contrast area of the screen
+type Region struct {
+	Bounds image.Rectangle
+
+	// Since is the number of the capture the area has looked the same
+	// since (0 for the first one)
+	Since int
+
+	// Contrast is the largest luminance range of the area's cells
+	Contrast uint8
+}
+
+// BurnIn finds the areas of latest, the last capture added to the map,
+// that have been unchanged since opts.StaticSince and have high
+// contrast. Adjacent cells are merged into one region; the largest
+// regions come first, and regions inside another's bounds are left out.
+func (m *Map) BurnIn(latest image.Image, opts BurnInOptions) []Region {
+	size := opts.CellSize
+	if size <= 0 || m.Width == 0 || m.Height == 0 {
+		return nil
+	}
+	gray := image.NewGray(image.Rect(0, 0, m.Width, m.Height))
+	draw.Draw(gray, gray.Rect, latest, latest.Bounds().Min, draw.Src)
+
+	cols, rows := (m.Width+size-1)/size, (m.Height+size-1)/size
+	cells := make([]*Region, cols*rows)
+	for cy := 0; cy < rows; cy++ {
+		for cx := 0; cx < cols; cx++ {
+			r := image.Rect(cx*size, cy*size, min((cx+1)*size, m.Width), min((cy+1)*size, m.Height))
+			since := 0
+			lo, hi := uint8(255), uint8(0)
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				for _, l := range m.Last[y*m.Width+r.Min.X : y*m.Width+r.Max.X] {
+					since = max(since, int(l))
+				}
+				for _, v := range gray.Pix[y*gray.Stride+r.Min.X : y*gray.Stride+r.Max.X] {
+					lo, hi = min(lo, v), max(hi, v)
+				}
+			}
+			if since <= opts.StaticSince && hi-lo >= opts.MinContrast {
+				cells[cy*cols+cx] = &Region{Bounds: r, Since: since, Contrast: hi - lo}
+			}
+		}
+	}
+
+	// Merge 4-connected cells
+	var regions []Region
+	for i, c := range cells {
+		if c == nil {
+			continue
+		}
+		region := *c
+		cells[i] = nil
+		stack := []int{i}
+		for len(stack) > 0 {
+			j := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			x, y := j%cols, j/cols
+			for _, n := range []image.Point{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+				if n.X < 0 || n.Y < 0 || n.X >= cols || n.Y >= rows {
+					continue
+				}
+				k := n.Y*cols + n.X
+				if next := cells[k]; next != nil {
+					region.Bounds = region.Bounds.Union(next.Bounds)
+					region.Since = max(region.Since, next.Since)
+					region.Contrast = max(region.Contrast, next.Contrast)
+					cells[k] = nil
+					stack = append(stack, k)
+				}
+			}
+		}
+		regions = append(regions, region)
+	}
+
+	slices.SortStableFunc(regions, func(a, b Region) int {
+		return b.Bounds.Dx()*b.Bounds.Dy() - a.Bounds.Dx()*a.Bounds.Dy()
+	})
+
+	// A region enclosed by a larger one (static text in a static frame)
+	// adds nothing to its bounds
+	kept := regions[:0]
+	for _, r := range regions {
+		if !slices.ContainsFunc(kept, func(k Region) bool { return r.Bounds.In(k.Bounds) }) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
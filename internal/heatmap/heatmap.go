@@ -0,0 +1,169 @@
+// Package heatmap accumulates how often each part of the screen changes
+// across a series of captures and renders the result
+package heatmap
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"slices"
+
+	"github.com/robotin/screenshot/internal/diff"
+)
+
+// Map counts, per pixel, the intervals between consecutive captures in
+// which the pixel changed
+type Map struct {
+	Width, Height int
+
+	// Counts holds one count per pixel, row by row
+	Counts []uint32
+
+	// Last holds, per pixel, the number of the last interval in which it
+	// changed, 0 if it never did. Interval n ends with capture n.
+	Last []uint32
+
+	// Intervals is the number of capture pairs added
+	Intervals int
+}
+
+// New returns an empty map for captures of the given size
+func New(width, height int) *Map {
+	return &Map{Width: width, Height: height, Counts: make([]uint32, width*height), Last: make([]uint32, width*height)}
+}
+
+// Add counts the changed pixels of a diff between two consecutive
+// captures
+func (m *Map) Add(res *diff.Result) error {
+	if res.Width != m.Width || res.Height != m.Height {
+		return fmt.Errorf("diff is %dx%d, the map %dx%d", res.Width, res.Height, m.Width, m.Height)
+	}
+	m.Intervals++
+	mask := res.Mask
+	for y := 0; y < m.Height; y++ {
+		row := mask.Pix[y*mask.Stride : y*mask.Stride+m.Width]
+		counts := m.Counts[y*m.Width : (y+1)*m.Width]
+		last := m.Last[y*m.Width : (y+1)*m.Width]
+		for x, a := range row {
+			if a != 0 {
+				counts[x]++
+				last[x] = uint32(m.Intervals)
+			}
+		}
+	}
+	return nil
+}
+
+// Static returns the fraction of pixels that never changed, the areas at
+// risk of burn-in on a kiosk or dashboard
+func (m *Map) Static() float64 {
+	if len(m.Counts) == 0 {
+		return 0
+	}
+	n := 0
+	for _, c := range m.Counts {
+		if c == 0 {
+			n++
+		}
+	}
+	return float64(n) / float64(len(m.Counts))
+}
+
+// Cell is an area of the screen and how often it changed
+type Cell struct {
+	Bounds image.Rectangle
+
+	// Ratio is the average fraction of intervals in which the cell's
+	// pixels changed (0-1)
+	Ratio float64
+}
+
+// Hottest splits the map into square cells of the given size and
+// returns up to n of those that changed, most active first
+func (m *Map) Hottest(size, n int) []Cell {
+	if m.Intervals == 0 || size <= 0 {
+		return nil
+	}
+	var cells []Cell
+	for y0 := 0; y0 < m.Height; y0 += size {
+		for x0 := 0; x0 < m.Width; x0 += size {
+			r := image.Rect(x0, y0, min(x0+size, m.Width), min(y0+size, m.Height))
+			var sum uint64
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				for _, c := range m.Counts[y*m.Width+r.Min.X : y*m.Width+r.Max.X] {
+					sum += uint64(c)
+				}
+			}
+			if sum > 0 {
+				ratio := float64(sum) / float64(r.Dx()*r.Dy()) / float64(m.Intervals)
+				cells = append(cells, Cell{Bounds: r, Ratio: ratio})
+			}
+		}
+	}
+	slices.SortStableFunc(cells, func(a, b Cell) int {
+		switch {
+		case a.Ratio > b.Ratio:
+			return -1
+		case a.Ratio < b.Ratio:
+			return 1
+		}
+		return 0
+	})
+	return cells[:min(n, len(cells))]
+}
+
+// Render draws the map over background (usually the latest capture),
+// which is shown dimmed in gray so the colors stand out: pixels that
+// never changed keep the background, the others go from blue (rarely)
+// to red (as often as the most active pixel)
+func (m *Map) Render(background image.Image) *image.RGBA {
+	out := image.NewRGBA(image.Rect(0, 0, m.Width, m.Height))
+	gray := image.NewGray(out.Rect)
+	draw.Draw(gray, gray.Rect, background, background.Bounds().Min, draw.Src)
+	for i, v := range gray.Pix {
+		v = v / 3
+		out.Pix[i*4], out.Pix[i*4+1], out.Pix[i*4+2], out.Pix[i*4+3] = v, v, v, 0xff
+	}
+
+	var most uint32
+	for _, c := range m.Counts {
+		most = max(most, c)
+	}
+	if most == 0 {
+		return out
+	}
+	for i, c := range m.Counts {
+		if c == 0 {
+			continue
+		}
+		hot := ramp(float64(c) / float64(most))
+		p := out.Pix[i*4 : i*4+3]
+		// 3/4 heat over 1/4 background, so the screen stays recognizable
+		p[0] = uint8((uint16(hot.R)*3 + uint16(p[0])) / 4)
+		p[1] = uint8((uint16(hot.G)*3 + uint16(p[1])) / 4)
+		p[2] = uint8((uint16(hot.B)*3 + uint16(p[2])) / 4)
+	}
+	return out
+}
+
+// stops are the heat colors from cold to hot
+var stops = []color.RGBA{
+	{0, 0, 255, 255},
+	{0, 255, 255, 255},
+	{0, 255, 0, 255},
+	{255, 255, 0, 255},
+	{255, 0, 0, 255},
+}
+
+// ramp returns the heat color for t in (0,1]
+func ramp(t float64) color.RGBA {
+	t = min(max(t, 0), 1) * float64(len(stops)-1)
+	i := min(int(t), len(stops)-2)
+	f := t - float64(i)
+	a, b := stops[i], stops[i+1]
+	mix := func(x, y uint8) uint8 {
+		return uint8(float64(x) + (float64(y)-float64(x))*f + 0.5)
+	}
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 255}
+}
@@ -0,0 +1,167 @@
+package history
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robotin/screenshot/internal/parquet"
+)
+
+// Export formats
+const (
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+)
+
+// Filter selects entries to export
+type Filter struct {
+	// Tag, if set, must be one of the entry's tags
+	Tag string
+
+	// Since and Until, if set, bound the capture time (Until exclusive)
+	Since, Until time.Time
+
+	// Monitor, if set, is the monitor index the capture was taken of
+	Monitor *int
+}
+
+// Match reports whether e passes the filter
+func (f Filter) Match(e Entry) bool {
+	switch {
+	case f.Tag != "" && !slices.Contains(e.Tags, f.Tag):
+		return false
+	case !f.Since.IsZero() && e.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !e.Time.Before(f.Until):
+		return false
+	case f.Monitor != nil && (e.Monitor == nil || *e.Monitor != *f.Monitor):
+		return false
+	}
+	return true
+}
+
+// exportColumns are the exported fields, in order; tags are joined with
+// commas
+var exportColumns = []parquet.Column{
+	{Name: "id", Type: parquet.String},
+	{Name: "time", Type: parquet.Timestamp},
+	{Name: "host", Type: parquet.String},
+	{Name: "path", Type: parquet.String},
+	{Name: "format", Type: parquet.String},
+	{Name: "width", Type: parquet.Int32},
+	{Name: "height", Type: parquet.Int32},
+	{Name: "monitor", Type: parquet.Int32},
+	{Name: "tags", Type: parquet.String},
+	{Name: "upload_target", Type: parquet.String},
+	{Name: "upload_provider", Type: parquet.String},
+	{Name: "upload_url", Type: parquet.String},
+	{Name: "trashed_at", Type: parquet.Timestamp},
+	{Name: "focus_class", Type: parquet.String},
+	{Name: "focus_title", Type: parquet.String},
+	{Name: "focus_pid", Type: parquet.Int32},
+	{Name: "pointer_x", Type: parquet.Int32},
+	{Name: "pointer_y", Type: parquet.Int32},
+}
+
+// ocrColumn holds the text recognized in each capture
+var ocrColumn = parquet.Column{Name: "ocr_text", Type: parquet.String}
+
+// Export writes entries as a table in the given format, one row per
+// entry. If ocr is not nil, it holds the text found in each entry's
+// capture, added as an ocr_text column.
+func Export(w io.Writer, format string, entries []Entry, ocr []string) error {
+	columns := exportColumns
+	if ocr != nil {
+		columns = append(slices.Clip(columns), ocrColumn)
+	}
+
+	rows := make([][]any, len(entries))
+	for i, e := range entries {
+		rows[i] = exportRow(e)
+		if ocr != nil {
+			rows[i] = append(rows[i], ocr[i])
+		}
+	}
+
+	switch format {
+	case FormatCSV:
+		return writeCSV(w, columns, rows)
+	case FormatParquet:
+		return parquet.Write(w, columns, rows)
+	}
+	return fmt.Errorf("unknown export format %q (expected csv or parquet)", format)
+}
+
+// exportRow returns an entry's values for exportColumns, nil where unset
+func exportRow(e Entry) []any {
+	opt := func(s string) any {
+		if s == "" {
+			return nil
+		}
+		return s
+	}
+	row := []any{e.ID, e.Time, opt(e.Host), e.Path, opt(e.Format), nil, nil, nil, opt(strings.Join(e.Tags, ",")), nil, nil, nil, nil, nil, nil, nil, nil, nil}
+	if e.Width > 0 {
+		row[5], row[6] = e.Width, e.Height
+	}
+	if e.Monitor != nil {
+		row[7] = *e.Monitor
+	}
+	if e.Upload != nil {
+		row[9], row[10], row[11] = opt(e.Upload.Target), opt(e.Upload.Provider), opt(e.Upload.URL)
+	}
+	if e.TrashedAt != nil {
+		row[12] = *e.TrashedAt
+	}
+	if e.Focus != nil {
+		row[13], row[14] = opt(e.Focus.Class), opt(e.Focus.Title)
+		if e.Focus.PID != 0 {
+			row[15] = int(e.Focus.PID)
+		}
+	}
+	if e.Pointer != nil {
+		row[16], row[17] = e.Pointer.X, e.Pointer.Y
+	}
+	return row
+}
+
+// writeCSV writes rows with a header line. Times are RFC 3339 in UTC and
+// nulls are empty.
+func writeCSV(w io.Writer, columns []parquet.Column, rows [][]any) error {
+	cw := csv.NewWriter(w)
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.Name
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for i, v := range row {
+			switch v := v.(type) {
+			case nil:
+				record[i] = ""
+			case string:
+				record[i] = v
+			case int:
+				record[i] = strconv.Itoa(v)
+			case time.Time:
+				record[i] = v.UTC().Format(time.RFC3339Nano)
+			default:
+				record[i] = fmt.Sprint(v)
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
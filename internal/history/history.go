@@ -0,0 +1,252 @@
+// Package history records every capture in a small append-only database
+// (one JSON object per line) so captures can be listed, undone and
+// analyzed later
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/robotin/screenshot/internal/lock"
+	"github.com/robotin/screenshot/internal/paths"
+)
+
+// Upload records where a capture was uploaded, with enough information to
+// delete it again
+type Upload struct {
+	// Target is the --upload target used (e.g. "imgur", "s3://b/p")
+	Target   string `json:"target"`
+	Provider string `json:"provider"`
+	URL      string `json:"url,omitempty"`
+	ID       string `json:"id,omitempty"`
+}
+
+// Region is the screen area of a region or window capture
+type Region struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Focus is the window that had the input focus at capture time
+type Focus struct {
+	Window uint32 `json:"window"`
+	Class  string `json:"class,omitempty"`
+	Title  string `json:"title,omitempty"`
+	PID    uint32 `json:"pid,omitempty"`
+}
+
+// Point is a position in screen coordinates
+type Point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// RecentRegions returns the areas of the newest region and window
+// captures, newest first, each once, at most n
+func RecentRegions(entries []Entry, n int) []Region {
+	var regions []Region
+	seen := map[Region]bool{}
+	for i := len(entries) - 1; i >= 0 && len(regions) < n; i-- {
+		r := entries[i].Region
+		if r == nil || seen[*r] {
+			continue
+		}
+		seen[*r] = true
+		regions = append(regions, *r)
+	}
+	return regions
+}
+
+// Entry is one recorded capture
+type Entry struct {
+	ID      string    `json:"id"`
+	Time    time.Time `json:"time"`
+	Host    string    `json:"host,omitempty"`
+	Path    string    `json:"path"`
+	Format  string    `json:"format,omitempty"`
+	Width   int       `json:"width,omitempty"`
+	Height  int       `json:"height,omitempty"`
+	Monitor *int      `json:"monitor,omitempty"`
+	Region  *Region   `json:"region,omitempty"`
+	Tags    []string  `json:"tags,omitempty"`
+	Upload  *Upload   `json:"upload,omitempty"`
+
+	// Focus and Pointer are the focused window and the pointer position
+	// when the capture was taken, if known
+	Focus   *Focus `json:"focus,omitempty"`
+	Pointer *Point `json:"pointer,omitempty"`
+
+	// TrashedAt is set once the capture has been undone; TrashPath is
+	// where its file went
+	TrashedAt *time.Time `json:"trashed_at,omitempty"`
+	TrashPath string     `json:"trash_path,omitempty"`
+}
+
+// DB is the history database file
+type DB struct {
+	path string
+}
+
+// Open returns the history database in the state directory
+func Open() (*DB, error) {
+	dir, err := paths.StateDir()
+	if err != nil {
+		return nil, err
+	}
+	return &DB{path: filepath.Join(dir, "history.jsonl")}, nil
+}
+
+// Path returns the database file path
+func (db *DB) Path() string {
+	return db.path
+}
+
+// Add appends an entry, filling in its ID and time if unset
+func (db *DB) Add(e *Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.ID == "" {
+		e.ID = strconv.FormatInt(e.Time.UnixNano(), 36)
+	}
+	if e.Host == "" {
+		e.Host, _ = os.Hostname()
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	return db.locked(func() error {
+		f, err := os.OpenFile(db.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to open history: %w", err)
+		}
+		defer f.Close()
+
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("failed to write history: %w", err)
+		}
+		return nil
+	})
+}
+
+// Entries returns all entries, oldest first
+func (db *DB) Entries() ([]Entry, error) {
+	var entries []Entry
+	err := db.locked(func() error {
+		var err error
+		entries, err = db.read()
+		return err
+	})
+	return entries, err
+}
+
+// Update applies fn to the entry with the given ID and rewrites the
+// database
+func (db *DB) Update(id string, fn func(*Entry)) error {
+	return db.locked(func() error {
+		entries, err := db.read()
+		if err != nil {
+			return err
+		}
+
+		found := false
+		for i := range entries {
+			if entries[i].ID == id {
+				fn(&entries[i])
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("history entry %s not found", id)
+		}
+		return db.write(entries)
+	})
+}
+
+// read parses the database. Unparseable lines (e.g. a write cut short by
+// a crash) are skipped. Must be called with the lock held.
+func (db *DB) read() ([]Entry, error) {
+	f, err := os.Open(db.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var e Entry
+		if json.Unmarshal(sc.Bytes(), &e) == nil && e.ID != "" {
+			entries = append(entries, e)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	return entries, nil
+}
+
+// write replaces the database with entries. Must be called with the lock
+// held.
+func (db *DB) write(entries []Entry) error {
+	tmp := db.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for i := range entries {
+		if err := enc.Encode(&entries[i]); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, db.path)
+}
+
+// locked runs fn holding an exclusive lock, so concurrent captures (e.g.
+// an interval run and a hotkey) don't lose each other's entries
+func (db *DB) locked(fn func() error) error {
+	if err := os.MkdirAll(filepath.Dir(db.path), 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	f, err := os.OpenFile(db.path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to lock history: %w", err)
+	}
+	defer f.Close()
+
+	if err := lock.File(f); err != nil {
+		return fmt.Errorf("failed to lock history: %w", err)
+	}
+	defer lock.Unlock(f)
+
+	return fn()
+}
@@ -0,0 +1,78 @@
+package history
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// Usage is how long one application (or window) had the focus
+type Usage struct {
+	Name     string
+	Time     time.Duration
+	Captures int
+}
+
+// ScreenTime estimates from periodic captures how long each application
+// had the focus, grouping entries by name(e). Each capture stands for the
+// time until the next one; gaps longer than maxGap, where capturing
+// stopped, and the last capture count as the usual spacing between
+// captures instead. Entries without a recorded focus or pointer, taken
+// before they were recorded or without X, are left out; the rest without
+// a focus are named by name too. Usage is sorted by time, longest first,
+// and total is their sum.
+func ScreenTime(entries []Entry, name func(Entry) string, maxGap time.Duration) (usage []Usage, total time.Duration) {
+	var samples []Entry
+	for _, e := range entries {
+		if e.Focus == nil && e.Pointer == nil {
+			continue
+		}
+		// Captures of every monitor at once are one sample
+		if n := len(samples); n > 0 && e.Time.Sub(samples[n-1].Time) < time.Second {
+			continue
+		}
+		samples = append(samples, e)
+	}
+	if len(samples) == 0 {
+		return nil, 0
+	}
+
+	gaps := make([]time.Duration, 0, len(samples)-1)
+	for i := 1; i < len(samples); i++ {
+		gaps = append(gaps, samples[i].Time.Sub(samples[i-1].Time))
+	}
+	usual := time.Duration(0)
+	if len(gaps) > 0 {
+		sorted := slices.Clone(gaps)
+		slices.Sort(sorted)
+		usual = min(sorted[len(sorted)/2], maxGap)
+	}
+
+	byName := map[string]*Usage{}
+	for i, e := range samples {
+		span := usual
+		if i < len(gaps) && gaps[i] <= maxGap {
+			span = gaps[i]
+		}
+		key := name(e)
+		u := byName[key]
+		if u == nil {
+			u = &Usage{Name: key}
+			byName[key] = u
+		}
+		u.Time += span
+		u.Captures++
+		total += span
+	}
+
+	for _, u := range byName {
+		usage = append(usage, *u)
+	}
+	slices.SortFunc(usage, func(a, b Usage) int {
+		if c := cmp.Compare(b.Time, a.Time); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return usage, total
+}
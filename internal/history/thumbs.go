@@ -0,0 +1,137 @@
+package history
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/paths"
+)
+
+// ThumbnailSize is the box history thumbnails are scaled to fit in
+var ThumbnailSize = image.Pt(320, 200)
+
+// ThumbDir returns the directory history thumbnails are cached in
+func ThumbDir() (string, error) {
+	dir, err := paths.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "thumbs"), nil
+}
+
+// thumbPath returns where the thumbnail of an entry is cached
+func thumbPath(e Entry) (string, error) {
+	dir, err := ThumbDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, e.ID+".png"), nil
+}
+
+// source returns the file an entry's capture is in now: its path, or
+// the trash once undone
+func (e Entry) source() string {
+	if e.TrashedAt != nil && e.TrashPath != "" {
+		return e.TrashPath
+	}
+	return e.Path
+}
+
+// SaveThumbnail caches a thumbnail of img, the capture recorded in e, so
+// listing it later needn't decode the file
+func SaveThumbnail(e Entry, img image.Image) error {
+	path, err := thumbPath(e)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create thumbnail directory: %w", err)
+	}
+
+	// Written aside and renamed, so a reader never sees half a thumbnail
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write thumbnail: %w", err)
+	}
+	enc := png.Encoder{CompressionLevel: png.BestSpeed}
+	err = enc.Encode(f, capture.ScaleToFit(img, ThumbnailSize))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write thumbnail: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// Thumbnail returns the path of an entry's thumbnail, making it from the
+// capture file when it isn't cached yet or the file changed since.
+// Remote and missing files, and formats that can't be decoded (SVG,
+// HEIF, PDF), have none unless cached when the capture was taken.
+func Thumbnail(e Entry) (string, error) {
+	path, err := thumbPath(e)
+	if err != nil {
+		return "", err
+	}
+	src, err := os.Stat(e.source())
+	thumb, terr := os.Stat(path)
+	if terr == nil && (err != nil || !thumb.ModTime().Before(src.ModTime())) {
+		// Undone and expired captures keep the thumbnail they had
+		return path, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("no thumbnail for %s: %w", e.ID, err)
+	}
+
+	f, err := os.Open(e.source())
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return "", fmt.Errorf("cannot make a thumbnail of %s: %w", e.source(), err)
+	}
+	if err := SaveThumbnail(e, img); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// PruneThumbnails deletes cached thumbnails of entries no longer in the
+// history and returns how many were removed
+func PruneThumbnails(entries []Entry) (int, error) {
+	dir, err := ThumbDir()
+	if err != nil {
+		return 0, err
+	}
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read thumbnails: %w", err)
+	}
+
+	keep := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		keep[e.ID+".png"] = true
+	}
+	n := 0
+	for _, f := range files {
+		if f.IsDir() || keep[f.Name()] || filepath.Ext(f.Name()) == ".tmp" {
+			continue
+		}
+		if os.Remove(filepath.Join(dir, f.Name())) == nil {
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,102 @@
+package history
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/robotin/screenshot/internal/paths"
+)
+
+// DefaultTrashTTL is how long trashed captures are kept
+const DefaultTrashTTL = 30 * 24 * time.Hour
+
+// TrashDir returns the directory undone captures are moved to
+func TrashDir() (string, error) {
+	dir, err := paths.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "trash"), nil
+}
+
+// MoveToTrash moves an entry's file into the trash directory and returns
+// its new path. The file's modification time is set to now so expiry
+// counts from the moment it was trashed.
+func MoveToTrash(e *Entry) (string, error) {
+	dir, err := TrashDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create trash directory: %w", err)
+	}
+
+	dst := filepath.Join(dir, e.ID+"_"+filepath.Base(e.Path))
+	if err := os.Rename(e.Path, dst); err != nil {
+		// The trash may be on another filesystem
+		if err := moveByCopy(e.Path, dst); err != nil {
+			return "", fmt.Errorf("failed to move %s to trash: %w", e.Path, err)
+		}
+	}
+
+	now := time.Now()
+	os.Chtimes(dst, now, now)
+	return dst, nil
+}
+
+// moveByCopy copies src to dst and removes src
+func moveByCopy(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// ExpireTrash deletes trashed files older than ttl and returns how many
+// were removed
+func ExpireTrash(ttl time.Duration) (int, error) {
+	dir, err := TrashDir()
+	if err != nil {
+		return 0, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	cutoff := time.Now().Add(-ttl)
+	for _, de := range entries {
+		info, err := de.Info()
+		if err != nil || info.IsDir() || info.ModTime().After(cutoff) {
+			continue
+		}
+		if os.Remove(filepath.Join(dir, de.Name())) == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,91 @@
+package hub
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// Dial connects to the hub at hubURL (http://host:port, or https:// for a
+// hub behind a TLS proxy). The connection is made lazily, so a hub that is
+// down isn't an error here.
+func Dial(hubURL string) (*grpc.ClientConn, error) {
+	u, err := url.Parse(hubURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hub URL: %w", err)
+	}
+	if u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return nil, fmt.Errorf("invalid hub URL %q (expected http://host:port)", hubURL)
+	}
+
+	var creds credentials.TransportCredentials
+	port := u.Port()
+	switch u.Scheme {
+	case "http":
+		creds = insecure.NewCredentials()
+		if port == "" {
+			port = "80"
+		}
+	case "https":
+		creds = credentials.NewTLS(&tls.Config{})
+		if port == "" {
+			port = "443"
+		}
+	default:
+		return nil, fmt.Errorf("invalid hub URL %q (must be http or https)", hubURL)
+	}
+
+	return grpc.NewClient(net.JoinHostPort(u.Hostname(), port),
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(codec{})))
+}
+
+// Register announces an agent to the hub every interval until ctx is
+// done; the hub may ask for another interval. Failures are passed to
+// onError (if set) and retried on the next tick, so agents survive hub
+// restarts.
+func Register(ctx context.Context, conn *grpc.ClientConn, hubToken string, reg Registration, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	current := interval
+	for {
+		resp, err := registerOnce(ctx, conn, hubToken, reg)
+		if err != nil && onError != nil {
+			onError(err)
+		}
+		if err == nil && resp.HeartbeatSeconds > 0 {
+			if d := time.Duration(resp.HeartbeatSeconds) * time.Second; d != current {
+				current = d
+				ticker.Reset(d)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// registerOnce sends a single registration
+func registerOnce(ctx context.Context, conn *grpc.ClientConn, token string, reg Registration) (*registerResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+
+	resp := new(registerResponse)
+	if err := conn.Invoke(ctx, registerMethod, &reg, resp); err != nil {
+		return nil, fmt.Errorf("hub registration failed: %w", err)
+	}
+	return resp, nil
+}
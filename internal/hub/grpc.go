@@ -0,0 +1,194 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The registration service is served over gRPC. Its messages are encoded
+// by hand with protowire rather than generated with protoc, as the IPC
+// messages are; they follow proto/robotin/screenshot/v1/hub.proto exactly,
+// so keep the two in sync.
+
+// registerMethod is the full name of the Register RPC
+const registerMethod = "/robotin.screenshot.v1.Hub/Register"
+
+// message is a hand-encoded protobuf message
+type message interface {
+	marshal() []byte
+	unmarshal(b []byte) error
+}
+
+// codec lets gRPC carry the hand-encoded messages. It is named proto,
+// since that's what goes on the wire.
+type codec struct{}
+
+func (codec) Name() string { return "proto" }
+
+func (codec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(message)
+	if !ok {
+		return nil, fmt.Errorf("cannot encode %T", v)
+	}
+	return m.marshal(), nil
+}
+
+func (codec) Unmarshal(b []byte, v any) error {
+	m, ok := v.(message)
+	if !ok {
+		return fmt.Errorf("cannot decode %T", v)
+	}
+	return m.unmarshal(b)
+}
+
+// RegisterRequest: name = 1, url = 2, token = 3
+func (r *Registration) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, r.Name)
+	b = appendString(b, 2, r.URL)
+	return appendString(b, 3, r.Token)
+}
+
+func (r *Registration) unmarshal(b []byte) error {
+	*r = Registration{}
+	return parse(b, func(num protowire.Number, typ protowire.Type, v []byte, u uint64) {
+		if typ != protowire.BytesType {
+			return
+		}
+		switch num {
+		case 1:
+			r.Name = string(v)
+		case 2:
+			r.URL = string(v)
+		case 3:
+			r.Token = string(v)
+		}
+	})
+}
+
+// registerResponse is the hub's answer to a registration
+type registerResponse struct {
+	// HeartbeatSeconds is how often the hub expects a heartbeat; 0 leaves
+	// it to the agent
+	HeartbeatSeconds uint32
+}
+
+func (r *registerResponse) marshal() []byte {
+	if r.HeartbeatSeconds == 0 {
+		return nil
+	}
+	b := protowire.AppendTag(nil, 1, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(r.HeartbeatSeconds))
+}
+
+func (r *registerResponse) unmarshal(b []byte) error {
+	*r = registerResponse{}
+	return parse(b, func(num protowire.Number, typ protowire.Type, v []byte, u uint64) {
+		if num == 1 && typ == protowire.VarintType {
+			r.HeartbeatSeconds = uint32(u)
+		}
+	})
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+// parse calls fn for each varint and length-delimited field in b; other
+// fields are skipped, as are fields fn doesn't know
+func parse(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte, u uint64)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var v []byte
+		var u uint64
+		switch typ {
+		case protowire.VarintType:
+			u, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		fn(num, typ, v, u)
+	}
+	return nil
+}
+
+// hubServer is the Register handler the gRPC server calls
+type hubServer interface {
+	register(ctx context.Context, reg *Registration) (*registerResponse, error)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "robotin.screenshot.v1.Hub",
+	HandlerType: (*hubServer)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Register",
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			reg := new(Registration)
+			if err := dec(reg); err != nil {
+				return nil, err
+			}
+			return srv.(hubServer).register(ctx, reg)
+		},
+	}},
+	Metadata: "robotin/screenshot/v1/hub.proto",
+}
+
+// isGRPC tells gRPC calls from the HTTP API requests sharing the address
+func isGRPC(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// register records or refreshes an agent (also used as heartbeat)
+func (h *Hub) register(ctx context.Context, reg *Registration) (*registerResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var got string
+	if v := md.Get("authorization"); len(v) > 0 {
+		got = strings.TrimPrefix(v[0], "Bearer ")
+	}
+	tenant, ok := h.tenant(got)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+
+	if reg.Name == "" || strings.Contains(reg.Name, "/") {
+		return nil, status.Error(codes.InvalidArgument, "invalid agent name")
+	}
+	u, err := h.agentURL(reg.URL)
+	if errors.Is(err, errAgentHost) {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	} else if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	reg.URL = u
+
+	h.mu.Lock()
+	h.agents[tenant+"/"+reg.Name] = &agent{Registration: *reg, tenant: tenant, lastSeen: time.Now()}
+	h.mu.Unlock()
+
+	return &registerResponse{HeartbeatSeconds: uint32(h.config.AgentTTL / 3 / time.Second)}, nil
+}
@@ -0,0 +1,69 @@
+package hub
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRegisterOverGRPC(t *testing.T) {
+	h, err := New(Config{Tenants: map[string]string{"acme": "s3cret"}, AgentTTL: 90 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	conn, err := Dial(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+
+	reg := Registration{Name: "kiosk-7", URL: "http://kiosk-7:8080/", Token: "agent"}
+	resp, err := registerOnce(ctx, conn, "s3cret", reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.HeartbeatSeconds != 30 {
+		t.Errorf("heartbeat is %ds, want 30s", resp.HeartbeatSeconds)
+	}
+	a := h.agents["acme/kiosk-7"]
+	if a == nil {
+		t.Fatal("agent wasn't registered")
+	}
+	if a.URL != "http://kiosk-7:8080" || a.Token != "agent" {
+		t.Errorf("registered %+v", a.Registration)
+	}
+
+	_, err = registerOnce(ctx, conn, "wrong", reg)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("wrong token: got %v, want Unauthenticated", err)
+	}
+	reg.Name = "a/b"
+	_, err = registerOnce(ctx, conn, "s3cret", reg)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("bad name: got %v, want InvalidArgument", err)
+	}
+	reg.Name, reg.URL = "kiosk-7", "http://169.254.169.254"
+	_, err = registerOnce(ctx, conn, "s3cret", reg)
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("metadata address: got %v, want PermissionDenied", err)
+	}
+}
+
+func TestRegistrationWire(t *testing.T) {
+	reg := Registration{Name: "kiosk", URL: "http://kiosk:8080", Token: "t"}
+	var got Registration
+	if err := got.unmarshal(reg.marshal()); err != nil {
+		t.Fatal(err)
+	}
+	if got != reg {
+		t.Errorf("got %+v, want %+v", got, reg)
+	}
+}
@@ -0,0 +1,350 @@
+// Package hub implements a central registry that screenshot agents
+// (`screenshot serve --hub ...`) register with over gRPC. The hub exposes
+// a single API and web UI to request captures from any registered machine.
+//
+// Tenants are isolated by token: an agent registers under the tenant whose
+// token it presents, and API clients only see their own tenant's agents.
+package hub
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+)
+
+//go:embed web/index.html
+var indexHTML []byte
+
+// Config holds hub settings
+type Config struct {
+	// Tenants maps tenant names to their tokens
+	Tenants map[string]string
+
+	// AgentTTL is how long an agent stays listed without a heartbeat
+	AgentTTL time.Duration
+
+	// ProxyTimeout bounds requests forwarded to agents
+	ProxyTimeout time.Duration
+
+	// AgentHosts lists the hosts agents may register with: host names,
+	// *.domain wildcards or CIDRs. When empty, any host is allowed except
+	// loopback, link-local (such as cloud metadata endpoints) and
+	// unspecified addresses; those are only reached through a CIDR here.
+	AgentHosts []string
+}
+
+// Registration is what an agent sends to the hub (a RegisterRequest)
+type Registration struct {
+	// Name identifies the agent within its tenant (usually the hostname)
+	Name string
+
+	// URL is the agent's serve-mode base URL, reachable from the hub
+	URL string
+
+	// Token is the agent's own API token, used by the hub when proxying
+	Token string
+}
+
+// agent is a registered agent
+type agent struct {
+	Registration
+	tenant   string
+	lastSeen time.Time
+}
+
+// AgentInfo is the public view of an agent in /agents
+type AgentInfo struct {
+	Name     string    `json:"name"`
+	URL      string    `json:"url"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// Hub is the agent registry and proxy
+type Hub struct {
+	config  Config
+	mux     *http.ServeMux
+	grpc    *grpc.Server
+	handler http.Handler
+	client  *http.Client
+
+	// Parsed Config.AgentHosts
+	agentNames []string
+	agentNets  []*net.IPNet
+
+	mu     sync.Mutex
+	agents map[string]*agent // keyed by tenant + "/" + name
+}
+
+// New creates a hub
+func New(config Config) (*Hub, error) {
+	if len(config.Tenants) == 0 {
+		return nil, fmt.Errorf("at least one tenant is required")
+	}
+	if config.AgentTTL <= 0 {
+		config.AgentTTL = 90 * time.Second
+	}
+	if config.ProxyTimeout <= 0 {
+		config.ProxyTimeout = 30 * time.Second
+	}
+
+	h := &Hub{
+		config: config,
+		mux:    http.NewServeMux(),
+		grpc:   grpc.NewServer(grpc.ForceServerCodec(codec{})),
+		agents: map[string]*agent{},
+	}
+	for _, host := range config.AgentHosts {
+		if _, n, err := net.ParseCIDR(host); err == nil {
+			h.agentNets = append(h.agentNets, n)
+			continue
+		}
+		name := strings.ToLower(strings.TrimPrefix(host, "*."))
+		if name == "" || strings.ContainsAny(name, "*/:") {
+			return nil, fmt.Errorf("invalid agent host %q (expected a name, *.domain or a CIDR)", host)
+		}
+		h.agentNames = append(h.agentNames, strings.ToLower(host))
+	}
+
+	// Names can resolve to anything, so the address is checked again
+	// when connecting
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: h.checkDial}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	h.client = &http.Client{Timeout: config.ProxyTimeout, Transport: transport}
+	h.grpc.RegisterService(&serviceDesc, h)
+
+	// Agents register over gRPC, which needs HTTP/2; h2c serves it
+	// without TLS on the API's address
+	h.handler = h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isGRPC(r) {
+			h.grpc.ServeHTTP(w, r)
+			return
+		}
+		h.mux.ServeHTTP(w, r)
+	}), &http2.Server{})
+
+	h.mux.HandleFunc("/", h.handleIndex)
+	h.mux.HandleFunc("/agents", h.tenantOnly(h.handleAgents))
+	h.mux.HandleFunc("/agents/", h.tenantOnly(h.handleAgentProxy))
+	return h, nil
+}
+
+// ServeHTTP implements http.Handler
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.handler.ServeHTTP(w, r)
+}
+
+// tenant returns the tenant whose token was presented
+func (h *Hub) tenant(token string) (string, bool) {
+	for tenant, t := range h.config.Tenants {
+		if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return tenant, true
+		}
+	}
+	return "", false
+}
+
+// tenantOnly authenticates the request and passes the tenant name on
+func (h *Hub) tenantOnly(next func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if tenant, ok := h.tenant(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")); ok {
+			next(w, r, tenant)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}
+}
+
+// handleIndex serves the web UI
+func (h *Hub) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexHTML)
+}
+
+// handleAgents lists the tenant's live agents
+func (h *Hub) handleAgents(w http.ResponseWriter, r *http.Request, tenant string) {
+	h.mu.Lock()
+	h.prune(time.Now())
+	list := []AgentInfo{}
+	for _, a := range h.agents {
+		if a.tenant == tenant {
+			list = append(list, AgentInfo{Name: a.Name, URL: a.URL, LastSeen: a.lastSeen})
+		}
+	}
+	h.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(list)
+}
+
+// handleAgentProxy forwards /agents/<name>/<endpoint> to the agent.
+// Only the capture API endpoints are forwarded.
+func (h *Hub) handleAgentProxy(w http.ResponseWriter, r *http.Request, tenant string) {
+	name, endpoint, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/agents/"), "/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	switch endpoint {
+	case "capture", "monitors", "share", "healthz":
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	h.mu.Lock()
+	h.prune(time.Now())
+	a, found := h.agents[tenant+"/"+name]
+	var reg Registration
+	if found {
+		reg = a.Registration
+	}
+	h.mu.Unlock()
+
+	if !found {
+		http.Error(w, "unknown agent: "+name, http.StatusNotFound)
+		return
+	}
+
+	target := reg.URL + "/" + endpoint
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, target, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if reg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+reg.Token)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("agent %s unreachable: %v", name, err), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, k := range []string{"Content-Type", "Content-Length", "Retry-After", "X-Capture-Cache"} {
+		if v := resp.Header.Get(k); v != "" {
+			w.Header().Set(k, v)
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// errAgentHost reports a host outside Config.AgentHosts
+var errAgentHost = errors.New("agent host not allowed")
+
+// agentURL checks the URL an agent registered with and returns it
+// without a trailing slash. It fails with errAgentHost when the host isn't
+// allowed.
+func (h *Hub) agentURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("agent url must be http(s)://host[:port]")
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" || strings.Trim(u.Path, "/") != "" {
+		return "", fmt.Errorf("agent url must be a base URL, without a path, query or credentials")
+	}
+	if !h.allowHost(u.Hostname()) {
+		return "", fmt.Errorf("%w: %s", errAgentHost, u.Hostname())
+	}
+	return strings.TrimRight(raw, "/"), nil
+}
+
+// allowHost reports whether agents may be reached at host
+func (h *Hub) allowHost(host string) bool {
+	if ip := net.ParseIP(host); ip != nil {
+		return h.allowIP(ip)
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if len(h.agentNames) == 0 && len(h.agentNets) == 0 {
+		return host != "localhost" && !strings.HasSuffix(host, ".localhost")
+	}
+	for _, name := range h.agentNames {
+		if suffix, ok := strings.CutPrefix(name, "*"); ok {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+		} else if host == name {
+			return true
+		}
+	}
+	return false
+}
+
+// allowIP reports whether agents may be reached at ip: inside a listed
+// CIDR, or, with no CIDRs listed, anything but a local address
+func (h *Hub) allowIP(ip net.IP) bool {
+	for _, n := range h.agentNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	if len(h.agentNets) > 0 {
+		return false
+	}
+	return !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsUnspecified()
+}
+
+// checkDial refuses connections to local addresses that no CIDR in
+// Config.AgentHosts allows, wherever the agent's name resolved
+func (h *Hub) checkDial(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%w: %s", errAgentHost, host)
+	}
+	for _, n := range h.agentNets {
+		if n.Contains(ip) {
+			return nil
+		}
+	}
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%w: %s", errAgentHost, ip)
+	}
+	return nil
+}
+
+// prune removes agents that missed their heartbeats. Must be called with
+// the lock held.
+func (h *Hub) prune(now time.Time) {
+	for key, a := range h.agents {
+		if now.Sub(a.lastSeen) > h.config.AgentTTL {
+			delete(h.agents, key)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+//go:build !noidle && !minimal
+
+package idle
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// callTimeout bounds the D-Bus call
+const callTimeout = 2 * time.Second
+
+func init() {
+	gnomeIdle = mutterIdleTime
+}
+
+// mutterIdleTime asks Mutter's IdleMonitor, which sees all input in GNOME
+// sessions, Wayland or not
+func mutterIdleTime() (time.Duration, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to the session bus: %w", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	var ms uint64
+	err = conn.Object("org.gnome.Mutter.IdleMonitor", "/org/gnome/Mutter/IdleMonitor/Core").
+		CallWithContext(ctx, "org.gnome.Mutter.IdleMonitor.GetIdletime", 0).Store(&ms)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query GNOME's idle monitor: %w", err)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
@@ -0,0 +1,40 @@
+// Package idle reports how long the user has been idle, that is, how long
+// ago the last keyboard or pointer input was
+package idle
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/robotin/screenshot/internal/xwin"
+)
+
+// gnomeIdle reads the idle time from GNOME's idle monitor; nil when
+// built with the noidle tag
+var gnomeIdle func() (time.Duration, error)
+
+// Time returns the user's idle time on the given X display ("" for
+// $DISPLAY). In a Wayland session XWayland only sees input to X11 apps,
+// which would report a typing user as idle, so GNOME's idle monitor is
+// asked instead and other Wayland compositors are an error.
+func Time(display string) (time.Duration, error) {
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		if gnomeIdle == nil {
+			return 0, errors.New("idle time in Wayland sessions needs GNOME's idle monitor, which is not compiled into this binary (built with -tags noidle or minimal)")
+		}
+		d, err := gnomeIdle()
+		if err != nil {
+			return 0, fmt.Errorf("idle time in Wayland sessions is only available from GNOME's idle monitor: %w", err)
+		}
+		return d, nil
+	}
+
+	conn, err := xwin.Connect(display)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	return conn.IdleTime()
+}
@@ -0,0 +1,214 @@
+// Package imghash computes exact and perceptual hashes of captures, so
+// scripts can poll a screen area for changes without encoding images
+package imghash
+
+import (
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/draw"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// Type names a hash algorithm
+type Type string
+
+const (
+	// Exact is FNV-1a over the pixels: any change alters it
+	Exact Type = "exact"
+
+	// Average (aHash) sets a bit per 8x8 cell brighter than the mean
+	Average Type = "ahash"
+
+	// Difference (dHash) sets a bit per horizontal brightness gradient in
+	// a 9x8 thumbnail; robust to scaling and small color shifts
+	Difference Type = "dhash"
+
+	// Perceptual (pHash) keeps the signs of the low DCT frequencies of a
+	// 32x32 thumbnail; the most robust to compression and small edits
+	Perceptual Type = "phash"
+)
+
+// Types lists the hash types in the order they are reported
+var Types = []Type{Exact, Average, Difference, Perceptual}
+
+// ParseType parses a hash type name
+func ParseType(s string) (Type, error) {
+	for _, t := range Types {
+		if strings.EqualFold(s, string(t)) {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("unknown hash type %q (expected exact, ahash, dhash or phash)", s)
+}
+
+// Sum computes a hash of img
+func Sum(img image.Image, t Type) uint64 {
+	switch t {
+	case Average:
+		return averageHash(img)
+	case Difference:
+		return differenceHash(img)
+	case Perceptual:
+		return perceptualHash(img)
+	}
+	return exactHash(img)
+}
+
+// Format renders a hash as 16 hex digits
+func Format(h uint64) string {
+	return fmt.Sprintf("%016x", h)
+}
+
+// Parse parses a hash printed by Format
+func Parse(s string) (uint64, error) {
+	h, err := strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hash %q", s)
+	}
+	return h, nil
+}
+
+// Distance is the number of differing bits between two hashes. For
+// perceptual hashes, up to about 5 of 64 means the same picture.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Pixels returns img's pixels as non-premultiplied RGBA rows without
+// padding, the input of the exact hash
+func Pixels(img image.Image) []byte {
+	b := img.Bounds()
+	rowLen := b.Dx() * 4
+	var src []byte
+	var stride int
+	switch im := img.(type) {
+	case *image.NRGBA:
+		src, stride = im.Pix, im.Stride
+	case *image.RGBA:
+		if im.Opaque() {
+			// Premultiplied and straight alpha agree on opaque pixels
+			src, stride = im.Pix, im.Stride
+		}
+	}
+	if src == nil {
+		n := image.NewNRGBA(b)
+		draw.Draw(n, b, img, b.Min, draw.Src)
+		return n.Pix
+	}
+
+	out := make([]byte, rowLen*b.Dy())
+	for y := 0; y < b.Dy(); y++ {
+		copy(out[y*rowLen:(y+1)*rowLen], src[y*stride:y*stride+rowLen])
+	}
+	return out
+}
+
+// ExactPixels hashes pixels returned by Pixels, for callers that need
+// both
+func ExactPixels(pix []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(pix)
+	return h.Sum64()
+}
+
+func exactHash(img image.Image) uint64 {
+	return ExactPixels(Pixels(img))
+}
+
+// thumbnail scales img to w x h luminance values
+func thumbnail(img image.Image, w, h int) []float64 {
+	small := image.NewGray(image.Rect(0, 0, w, h))
+	xdraw.ApproxBiLinear.Scale(small, small.Bounds(), img, img.Bounds(), xdraw.Src, nil)
+	lum := make([]float64, w*h)
+	for i, v := range small.Pix {
+		lum[i] = float64(v)
+	}
+	return lum
+}
+
+func averageHash(img image.Image) uint64 {
+	lum := thumbnail(img, 8, 8)
+	mean := 0.0
+	for _, v := range lum {
+		mean += v
+	}
+	mean /= float64(len(lum))
+
+	var h uint64
+	for i, v := range lum {
+		if v > mean {
+			h |= 1 << (63 - i)
+		}
+	}
+	return h
+}
+
+func differenceHash(img image.Image) uint64 {
+	lum := thumbnail(img, 9, 8)
+	var h uint64
+	bit := 63
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if lum[y*9+x] < lum[y*9+x+1] {
+				h |= 1 << bit
+			}
+			bit--
+		}
+	}
+	return h
+}
+
+// perceptualHash is the classic pHash: the top-left 8x8 coefficients of
+// the DCT of a 32x32 thumbnail, compared with their median (the DC term
+// is left out of the median, as it only reflects overall brightness)
+func perceptualHash(img image.Image) uint64 {
+	const n = 32
+	lum := thumbnail(img, n, n)
+
+	// Separable 2D DCT-II: rows, then columns of the 8 kept frequencies
+	cos := make([]float64, n*n)
+	for k := 0; k < n; k++ {
+		for i := 0; i < n; i++ {
+			cos[k*n+i] = math.Cos(math.Pi / n * (float64(i) + 0.5) * float64(k))
+		}
+	}
+	rows := make([]float64, n*8)
+	for y := 0; y < n; y++ {
+		for u := 0; u < 8; u++ {
+			s := 0.0
+			for x := 0; x < n; x++ {
+				s += lum[y*n+x] * cos[u*n+x]
+			}
+			rows[y*8+u] = s
+		}
+	}
+	coeffs := make([]float64, 64)
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			s := 0.0
+			for y := 0; y < n; y++ {
+				s += rows[y*8+u] * cos[v*n+y]
+			}
+			coeffs[v*8+u] = s
+		}
+	}
+
+	sorted := append([]float64(nil), coeffs[1:]...)
+	sort.Float64s(sorted)
+	median := (sorted[31] + sorted[32]) / 2
+
+	var h uint64
+	for i, c := range coeffs {
+		if c > median {
+			h |= 1 << (63 - i)
+		}
+	}
+	return h
+}
@@ -0,0 +1,168 @@
+// Package indicator shows a small notice on screen while periodic capture
+// runs, for monitored machines where people must be told they are being
+// recorded
+package indicator
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+	"time"
+
+	"github.com/robotin/screenshot/internal/config"
+	"github.com/robotin/screenshot/internal/strategy"
+	"github.com/robotin/screenshot/internal/xwin"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// DefaultText is the notice shown when none is configured
+const DefaultText = "Screen capture active"
+
+// RaiseInterval is how often the notice is put back above windows opened
+// after it
+const RaiseInterval = 2 * time.Second
+
+// Layout of the notice, in pixels
+const (
+	margin  = 8 // from the monitor's edges
+	padding = 6
+	dotSize = 9
+)
+
+// Render returns the notice: a red dot and the text on a dark band
+func Render(text string) *image.RGBA {
+	face := basicfont.Face7x13
+	textHeight := face.Metrics().Height.Ceil()
+	w := padding + dotSize + padding + font.MeasureString(face, text).Ceil() + padding
+	h := textHeight + 2*padding
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{0x20, 0x20, 0x20, 0xff}), image.Point{}, draw.Src)
+
+	r := dotSize / 2
+	cx, cy := padding+r, h/2
+	for y := -r; y <= r; y++ {
+		for x := -r; x <= r; x++ {
+			if x*x+y*y <= r*r {
+				img.Set(cx+x, cy+y, color.RGBA{0xe0, 0x20, 0x20, 0xff})
+			}
+		}
+	}
+
+	d := &font.Drawer{Dst: img, Src: image.White, Face: face}
+	d.Dot = fixed.P(padding+dotSize+padding, padding+face.Ascent)
+	d.DrawString(text)
+	return img
+}
+
+// Position returns where a notice of the given size goes in a corner of
+// a monitor
+func Position(bounds image.Rectangle, size image.Point, corner string) image.Point {
+	p := image.Pt(bounds.Max.X-margin-size.X, bounds.Min.Y+margin)
+	switch corner {
+	case config.CornerTopLeft:
+		p.X = bounds.Min.X + margin
+	case config.CornerBottomLeft:
+		p = image.Pt(bounds.Min.X+margin, bounds.Max.Y-margin-size.Y)
+	case config.CornerBottomRight:
+		p.Y = bounds.Max.Y - margin - size.Y
+	}
+	return p
+}
+
+// Indicator is the notice, shown on every monitor until closed
+type Indicator struct {
+	conn   *xwin.Conn
+	img    *image.RGBA
+	corner string
+	done   chan struct{}
+
+	mu       sync.Mutex
+	overlays []*xwin.Overlay
+	err      error
+}
+
+// Show puts the notice in a corner of each monitor on an X display
+// (empty for $DISPLAY), and keeps it above other windows until Close
+func Show(display, text, corner string, monitors []strategy.Monitor) (*Indicator, error) {
+	if text == "" {
+		text = DefaultText
+	}
+	conn, err := xwin.Connect(display)
+	if err != nil {
+		return nil, err
+	}
+	ind := &Indicator{conn: conn, img: Render(text), corner: corner, done: make(chan struct{})}
+	if err := ind.Move(monitors); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go ind.keepAbove()
+	return ind, nil
+}
+
+// Move shows the notice on a new monitor layout
+func (ind *Indicator) Move(monitors []strategy.Monitor) error {
+	ind.mu.Lock()
+	defer ind.mu.Unlock()
+	ind.hide()
+	size := ind.img.Bounds().Size()
+	for _, m := range monitors {
+		o, err := ind.conn.ShowImage(ind.img, Position(m.Bounds, size, ind.corner))
+		if err != nil {
+			ind.hide()
+			return fmt.Errorf("failed to show the capture indicator: %w", err)
+		}
+		ind.overlays = append(ind.overlays, o)
+	}
+	return nil
+}
+
+// Err returns why the notice is no longer known to be on screen, e.g.
+// the X server went away, or nil
+func (ind *Indicator) Err() error {
+	ind.mu.Lock()
+	defer ind.mu.Unlock()
+	return ind.err
+}
+
+// Close removes the notice
+func (ind *Indicator) Close() {
+	close(ind.done)
+	ind.mu.Lock()
+	ind.hide()
+	ind.mu.Unlock()
+	ind.conn.Close()
+}
+
+// hide removes the notice from every monitor; mu must be held
+func (ind *Indicator) hide() {
+	for _, o := range ind.overlays {
+		o.Close()
+	}
+	ind.overlays = nil
+}
+
+// keepAbove raises the notice every RaiseInterval until Close
+func (ind *Indicator) keepAbove() {
+	ticker := time.NewTicker(RaiseInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ind.done:
+			return
+		case <-ticker.C:
+		}
+		ind.mu.Lock()
+		for _, o := range ind.overlays {
+			if err := o.Raise(); err != nil {
+				ind.err = fmt.Errorf("capture indicator lost: %w", err)
+				break
+			}
+		}
+		ind.mu.Unlock()
+	}
+}
@@ -0,0 +1,139 @@
+package integrate
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	gnomeMediaKeys = "org.gnome.settings-daemon.plugins.media-keys"
+	gnomeBinding   = "/org/gnome/settings-daemon/plugins/media-keys/custom-keybindings/robotin-screenshot/"
+)
+
+// gnomeDefaults are GNOME's own screenshot bindings, cleared on install:
+// the screenshot UI (GNOME 42+) and the older media key
+var gnomeDefaults = [][2]string{
+	{"org.gnome.shell.keybindings", "show-screenshot-ui"},
+	{gnomeMediaKeys, "screenshot"},
+}
+
+// gnome adds a custom keybinding through gsettings
+type gnome struct{}
+
+func (gnome) Name() string { return "gnome" }
+
+func (gnome) Install(e *Env) error {
+	list, err := e.Read("gsettings", "get", gnomeMediaKeys, "custom-keybindings")
+	if err != nil {
+		return fmt.Errorf("GNOME settings not available: %w", err)
+	}
+	paths := parseStrv(list)
+	if !contains(paths, gnomeBinding) {
+		paths = append(paths, gnomeBinding)
+	}
+
+	schema := gnomeMediaKeys + ".custom-keybinding:" + gnomeBinding
+	for _, kv := range [][2]string{
+		{"name", "Screenshot (robotin-screenshot)"},
+		{"command", shellJoin(e.Command)},
+		{"binding", e.Key},
+	} {
+		if err := e.Run("gsettings", "set", schema, kv[0], gvariantString(kv[1])); err != nil {
+			return err
+		}
+	}
+	if err := e.Run("gsettings", "set", gnomeMediaKeys, "custom-keybindings", formatStrv(paths)); err != nil {
+		return err
+	}
+
+	for _, d := range gnomeDefaults {
+		value, err := e.Read("gsettings", "get", d[0], d[1])
+		if err != nil || !strings.Contains(value, "'"+e.Key+"'") {
+			// Key missing in this GNOME version, or not bound to ours
+			continue
+		}
+		name := d[0] + " " + d[1]
+		if _, saved := e.State[name]; !saved {
+			e.State[name] = value
+		}
+		if err := e.Run("gsettings", "set", d[0], d[1], "[]"); err != nil {
+			return err
+		}
+	}
+
+	e.Logf("Bound %s to %s in GNOME", e.Key, shellJoin(e.Command))
+	return nil
+}
+
+func (gnome) Uninstall(e *Env) error {
+	list, err := e.Read("gsettings", "get", gnomeMediaKeys, "custom-keybindings")
+	if err != nil {
+		return fmt.Errorf("GNOME settings not available: %w", err)
+	}
+	var paths []string
+	for _, p := range parseStrv(list) {
+		if p != gnomeBinding {
+			paths = append(paths, p)
+		}
+	}
+	if err := e.Run("gsettings", "set", gnomeMediaKeys, "custom-keybindings", formatStrv(paths)); err != nil {
+		return err
+	}
+
+	schema := gnomeMediaKeys + ".custom-keybinding:" + gnomeBinding
+	for _, key := range []string{"name", "command", "binding"} {
+		if err := e.Run("gsettings", "reset", schema, key); err != nil {
+			return err
+		}
+	}
+
+	for _, d := range gnomeDefaults {
+		if value, ok := e.State[d[0]+" "+d[1]]; ok {
+			if err := e.Run("gsettings", "set", d[0], d[1], value); err != nil {
+				return err
+			}
+		}
+	}
+
+	e.Logf("Removed the GNOME keybinding and restored the default screenshot keys")
+	return nil
+}
+
+// parseStrv parses a GVariant string array as printed by gsettings, e.g.
+// "@as []" or "['/a/', '/b/']"
+func parseStrv(s string) []string {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "@as ")
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		item = strings.Trim(strings.TrimSpace(item), `'"`)
+		if item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// formatStrv formats a GVariant string array
+func formatStrv(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = gvariantString(item)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// gvariantString quotes a GVariant string literal
+func gvariantString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
+
+func contains(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,234 @@
+// Package integrate makes the tool the desktop's screenshot handler by
+// binding it to the Print key in GNOME, KDE Plasma or Sway, and reverts
+// the change
+package integrate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/robotin/screenshot/internal/paths"
+)
+
+// Options configures an installation
+type Options struct {
+	// Command is the command line the key runs
+	Command []string
+
+	// Key is the key to bind, in X keysym notation (default: Print)
+	Key string
+
+	// DryRun prints the changes instead of making them. Current settings
+	// are still read.
+	DryRun bool
+
+	// Out receives progress messages and, with DryRun, the changes
+	Out io.Writer
+}
+
+// Desktop installs and removes the integration for one desktop
+type Desktop interface {
+	Name() string
+	Install(e *Env) error
+	Uninstall(e *Env) error
+}
+
+var desktops = map[string]Desktop{
+	"gnome": gnome{},
+	"kde":   kde{},
+	"sway":  sway{},
+}
+
+// Names returns the supported desktops, sorted
+func Names() []string {
+	names := make([]string, 0, len(desktops))
+	for name := range desktops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Install binds the key to the command on the named desktop, replacing
+// the desktop's own screenshot binding. The replaced settings are saved
+// for Uninstall.
+func Install(desktop string, opts Options) error {
+	d, err := lookup(desktop)
+	if err != nil {
+		return err
+	}
+	if opts.Key == "" {
+		opts.Key = "Print"
+	}
+	e, err := newEnv(d.Name(), opts)
+	if err != nil {
+		return err
+	}
+	if err := d.Install(e); err != nil {
+		return err
+	}
+	return e.saveState()
+}
+
+// Uninstall removes the binding and restores the desktop's settings
+func Uninstall(desktop string, opts Options) error {
+	d, err := lookup(desktop)
+	if err != nil {
+		return err
+	}
+	e, err := newEnv(d.Name(), opts)
+	if err != nil {
+		return err
+	}
+	if err := d.Uninstall(e); err != nil {
+		return err
+	}
+	return e.removeState()
+}
+
+func lookup(name string) (Desktop, error) {
+	d, ok := desktops[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported desktop %q (supported: %s)", name, strings.Join(Names(), ", "))
+	}
+	return d, nil
+}
+
+// Env carries out changes for a desktop, or prints them in dry-run mode,
+// and keeps the settings to restore on uninstall
+type Env struct {
+	Options
+
+	statePath string
+
+	// State maps setting names to the values they had before install
+	State map[string]string
+}
+
+func newEnv(desktop string, opts Options) (*Env, error) {
+	if opts.Out == nil {
+		opts.Out = io.Discard
+	}
+	dir, err := paths.StateDir()
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Env{
+		Options:   opts,
+		statePath: filepath.Join(dir, "integrate-"+desktop+".json"),
+		State:     map[string]string{},
+	}
+	data, err := os.ReadFile(e.statePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read integration state: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &e.State); err != nil {
+			return nil, fmt.Errorf("invalid integration state %s: %w", e.statePath, err)
+		}
+	}
+	return e, nil
+}
+
+// Read runs a command that only queries settings, even in dry-run mode
+func (e *Env) Read(name string, args ...string) (string, error) {
+	out, err := exec.Command(name, args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Run runs a command that changes settings
+func (e *Env) Run(name string, args ...string) error {
+	if e.DryRun {
+		fmt.Fprintf(e.Out, "would run: %s\n", shellJoin(append([]string{name}, args...)))
+		return nil
+	}
+	if out, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// WriteFile writes a file, creating its directory
+func (e *Env) WriteFile(path, content string) error {
+	if e.DryRun {
+		fmt.Fprintf(e.Out, "would write %s:\n%s", path, content)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	fmt.Fprintf(e.Out, "Wrote %s\n", path)
+	return nil
+}
+
+// RemoveFile removes a file if it exists
+func (e *Env) RemoveFile(path string) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if e.DryRun {
+		fmt.Fprintf(e.Out, "would remove %s\n", path)
+		return nil
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	fmt.Fprintf(e.Out, "Removed %s\n", path)
+	return nil
+}
+
+// Logf prints a progress message
+func (e *Env) Logf(format string, args ...any) {
+	fmt.Fprintf(e.Out, format+"\n", args...)
+}
+
+func (e *Env) saveState() error {
+	if e.DryRun {
+		return nil
+	}
+	data, err := json.MarshalIndent(e.State, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(e.statePath), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	return os.WriteFile(e.statePath, data, 0644)
+}
+
+func (e *Env) removeState() error {
+	if e.DryRun {
+		return nil
+	}
+	if err := os.Remove(e.statePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// shellJoin quotes a command line for sh
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if a != "" && strings.Trim(a, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,@%+") == "" {
+			quoted[i] = a
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
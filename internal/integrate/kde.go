@@ -0,0 +1,141 @@
+package integrate
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	kdeDesktopFile = "robotin-screenshot.desktop"
+	spectacle      = "org.kde.spectacle.desktop"
+)
+
+// kde installs a desktop entry and a global shortcut for it, taking the
+// key away from Spectacle
+type kde struct{}
+
+func (kde) Name() string { return "kde" }
+
+// kdeConfig returns the kwriteconfig/kreadconfig pair for the installed
+// Plasma version and the group holding a .desktop file's shortcuts
+func kdeConfig(entry string) (write, read string, groups []string, plasma6 bool, err error) {
+	if _, err := exec.LookPath("kwriteconfig6"); err == nil {
+		// Plasma 6 keeps application shortcuts under [services]
+		return "kwriteconfig6", "kreadconfig6", []string{"services", entry}, true, nil
+	}
+	if _, err := exec.LookPath("kwriteconfig5"); err == nil {
+		return "kwriteconfig5", "kreadconfig5", []string{entry}, false, nil
+	}
+	return "", "", nil, false, fmt.Errorf("kwriteconfig6 or kwriteconfig5 not found; is KDE Plasma installed?")
+}
+
+func kdeArgs(groups []string, key string) []string {
+	args := []string{"--file", "kglobalshortcutsrc"}
+	for _, g := range groups {
+		args = append(args, "--group", g)
+	}
+	return append(args, "--key", key)
+}
+
+func applicationsDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "applications"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "applications"), nil
+}
+
+func (kde) Install(e *Env) error {
+	write, read, groups, plasma6, err := kdeConfig(kdeDesktopFile)
+	if err != nil {
+		return err
+	}
+	dir, err := applicationsDir()
+	if err != nil {
+		return err
+	}
+
+	entry := "[Desktop Entry]\n" +
+		"Type=Application\n" +
+		"Name=Screenshot (robotin-screenshot)\n" +
+		"Exec=" + desktopExec(e.Command) + "\n" +
+		"Icon=applets-screenshooter\n" +
+		"NoDisplay=true\n" +
+		"X-KDE-Shortcuts=" + e.Key + "\n"
+	if err := e.WriteFile(filepath.Join(dir, kdeDesktopFile), entry); err != nil {
+		return err
+	}
+
+	// Plasma 5 stores "active,default,description"
+	value := e.Key
+	if !plasma6 {
+		value = e.Key + ",none,Screenshot (robotin-screenshot)"
+	}
+	if err := e.Run(write, append(kdeArgs(groups, "_launch"), value)...); err != nil {
+		return err
+	}
+
+	_, _, specGroups, _, _ := kdeConfig(spectacle)
+	current, err := e.Read(read, kdeArgs(specGroups, "_launch")...)
+	if err == nil && strings.Split(current, ",")[0] == e.Key {
+		if _, saved := e.State["spectacle"]; !saved {
+			e.State["spectacle"] = current
+		}
+		fields := strings.Split(current, ",")
+		fields[0] = "none"
+		if err := e.Run(write, append(kdeArgs(specGroups, "_launch"), strings.Join(fields, ","))...); err != nil {
+			return err
+		}
+	}
+
+	e.Logf("Bound %s to %s in KDE Plasma; log out and back in to apply", e.Key, shellJoin(e.Command))
+	return nil
+}
+
+func (kde) Uninstall(e *Env) error {
+	write, _, groups, _, err := kdeConfig(kdeDesktopFile)
+	if err != nil {
+		return err
+	}
+	if err := e.Run(write, append(kdeArgs(groups, "_launch"), "--delete")...); err != nil {
+		return err
+	}
+	if value, ok := e.State["spectacle"]; ok {
+		_, _, specGroups, _, _ := kdeConfig(spectacle)
+		if err := e.Run(write, append(kdeArgs(specGroups, "_launch"), value)...); err != nil {
+			return err
+		}
+	}
+
+	dir, err := applicationsDir()
+	if err != nil {
+		return err
+	}
+	if err := e.RemoveFile(filepath.Join(dir, kdeDesktopFile)); err != nil {
+		return err
+	}
+
+	e.Logf("Removed the KDE shortcut and restored Spectacle's; log out and back in to apply")
+	return nil
+}
+
+// desktopExec quotes a command line for a desktop entry's Exec key
+func desktopExec(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		a = strings.ReplaceAll(a, "%", "%%")
+		if a != "" && !strings.ContainsAny(a, " \t\n\"'\\><~|&;$*?#()`") {
+			quoted[i] = a
+			continue
+		}
+		r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", `$`, `\$`)
+		quoted[i] = `"` + r.Replace(a) + `"`
+	}
+	return strings.Join(quoted, " ")
+}
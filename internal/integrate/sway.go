@@ -0,0 +1,105 @@
+package integrate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// swayInclude marks the line install adds to the sway config
+const swayInclude = "# Added by screenshot integrate sway"
+
+// sway writes a bindsym into its own file and includes it from the main
+// config
+type sway struct{}
+
+func (sway) Name() string { return "sway" }
+
+func swayPaths() (config, binding string, err error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", "", err
+	}
+	dir = filepath.Join(dir, "sway")
+	return filepath.Join(dir, "config"), filepath.Join(dir, "robotin-screenshot.conf"), nil
+}
+
+func (sway) Install(e *Env) error {
+	config, binding, err := swayPaths()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(config)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("no sway config at %s; copy /etc/sway/config there first", config)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read sway config: %w", err)
+	}
+
+	// --no-warn: replacing an existing Print binding is the point
+	content := fmt.Sprintf("%s\nbindsym --no-warn %s exec %s\n", swayInclude, e.Key, shellJoin(e.Command))
+	if err := e.WriteFile(binding, content); err != nil {
+		return err
+	}
+
+	if !strings.Contains(string(data), swayInclude) {
+		text := string(data)
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		text += fmt.Sprintf("\n%s\ninclude %s\n", swayInclude, binding)
+		if err := e.WriteFile(config, text); err != nil {
+			return err
+		}
+	}
+
+	e.Logf("Bound %s to %s in sway", e.Key, shellJoin(e.Command))
+	return swayReload(e)
+}
+
+func (sway) Uninstall(e *Env) error {
+	config, binding, err := swayPaths()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(config)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read sway config: %w", err)
+	}
+
+	if strings.Contains(string(data), swayInclude) {
+		var kept []string
+		lines := strings.Split(string(data), "\n")
+		for i := 0; i < len(lines); i++ {
+			if lines[i] == swayInclude {
+				i++ // and the include line after it
+				if len(kept) > 0 && kept[len(kept)-1] == "" {
+					kept = kept[:len(kept)-1]
+				}
+				continue
+			}
+			kept = append(kept, lines[i])
+		}
+		if err := e.WriteFile(config, strings.Join(kept, "\n")); err != nil {
+			return err
+		}
+	}
+	if err := e.RemoveFile(binding); err != nil {
+		return err
+	}
+
+	e.Logf("Removed the sway binding")
+	return swayReload(e)
+}
+
+// swayReload reloads a running sway so the change applies immediately
+func swayReload(e *Env) error {
+	if os.Getenv("SWAYSOCK") == "" {
+		e.Logf("sway is not running; the binding applies on next start")
+		return nil
+	}
+	return e.Run("swaymsg", "reload")
+}
@@ -0,0 +1,598 @@
+package ipc
+
+import (
+	"image"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ProtocolVersion is reported in HelloResponse
+const ProtocolVersion = 1
+
+// Format is an image encoding
+type Format int32
+
+const (
+	FormatRGBA Format = 0
+	FormatPNG  Format = 1
+	FormatJPEG Format = 2
+)
+
+// Request is sent by the client. Exactly one request kind is set.
+type Request struct {
+	ID         uint64
+	Hello      *HelloRequest
+	Capture    *CaptureRequest
+	Pixel      *PixelRequest
+	Watch      *WatchRequest
+	Unwatch    *UnwatchRequest
+	Monitors   *MonitorsRequest
+	Thumbnails *ThumbnailsRequest
+}
+
+// Response answers a Request, or reports a watch or thumbnail event
+type Response struct {
+	ID        uint64
+	Error     string
+	Hello     *HelloResponse
+	Capture   *Image
+	Pixel     *PixelResponse
+	Monitors  *MonitorsResponse
+	Event     *WatchEvent
+	Thumbnail *ThumbnailEvent
+}
+
+// Rect is a rectangle in screen coordinates
+type Rect struct {
+	X, Y, Width, Height int32
+}
+
+type HelloRequest struct {
+	Client string
+}
+
+type HelloResponse struct {
+	ProtocolVersion uint32
+	Server          string
+}
+
+type CaptureRequest struct {
+	// Monitor is the monitor index; nil captures all monitors
+	Monitor  *int32
+	Region   *Rect
+	WindowID uint32
+	Format   Format
+	Quality  int32
+}
+
+type Image struct {
+	Width, Height int32
+	Format        Format
+	Data          []byte
+	Area          *Rect
+}
+
+type PixelRequest struct {
+	X, Y int32
+}
+
+type PixelResponse struct {
+	R, G, B, A uint32
+}
+
+type WatchRequest struct {
+	Region       *Rect
+	IntervalMS   uint32
+	IncludeImage bool
+}
+
+type UnwatchRequest struct {
+	WatchID uint64
+}
+
+type WatchEvent struct {
+	UnixNano int64
+	Hash     uint64
+	Image    *Image
+}
+
+type MonitorsRequest struct{}
+
+type ThumbnailsRequest struct {
+	MaxWidth, MaxHeight uint32
+	FPS                 uint32
+	Format              Format
+}
+
+type ThumbnailEvent struct {
+	UnixNano int64
+	WindowID uint32
+	Title    string
+	Class    string
+	Bounds   *Rect
+	Hidden   bool
+	Closed   bool
+	Image    *Image
+}
+
+type MonitorsResponse struct {
+	Monitors []*Monitor
+}
+
+type Monitor struct {
+	Index   int32
+	Name    string
+	Bounds  *Rect
+	Primary bool
+}
+
+// ToRect converts an image rectangle
+func ToRect(r image.Rectangle) *Rect {
+	return &Rect{X: int32(r.Min.X), Y: int32(r.Min.Y), Width: int32(r.Dx()), Height: int32(r.Dy())}
+}
+
+// Rectangle converts r to an image rectangle
+func (r *Rect) Rectangle() image.Rectangle {
+	return image.Rect(int(r.X), int(r.Y), int(r.X+r.Width), int(r.Y+r.Height))
+}
+
+func (m *Request) Marshal() []byte {
+	b := appendUint(nil, 1, m.ID)
+	if m.Hello != nil {
+		b = appendMessage(b, 2, m.Hello)
+	}
+	if m.Capture != nil {
+		b = appendMessage(b, 3, m.Capture)
+	}
+	if m.Pixel != nil {
+		b = appendMessage(b, 4, m.Pixel)
+	}
+	if m.Watch != nil {
+		b = appendMessage(b, 5, m.Watch)
+	}
+	if m.Unwatch != nil {
+		b = appendMessage(b, 6, m.Unwatch)
+	}
+	if m.Monitors != nil {
+		b = appendMessage(b, 7, m.Monitors)
+	}
+	if m.Thumbnails != nil {
+		b = appendMessage(b, 8, m.Thumbnails)
+	}
+	return b
+}
+
+func (m *Request) Unmarshal(b []byte) error {
+	*m = Request{}
+	return parse(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.ID = f.u
+		case 2:
+			m.Hello = &HelloRequest{}
+			return sub(f, m.Hello)
+		case 3:
+			m.Capture = &CaptureRequest{}
+			return sub(f, m.Capture)
+		case 4:
+			m.Pixel = &PixelRequest{}
+			return sub(f, m.Pixel)
+		case 5:
+			m.Watch = &WatchRequest{}
+			return sub(f, m.Watch)
+		case 6:
+			m.Unwatch = &UnwatchRequest{}
+			return sub(f, m.Unwatch)
+		case 7:
+			m.Monitors = &MonitorsRequest{}
+			return sub(f, m.Monitors)
+		case 8:
+			m.Thumbnails = &ThumbnailsRequest{}
+			return sub(f, m.Thumbnails)
+		}
+		return nil
+	})
+}
+
+func (m *Response) Marshal() []byte {
+	b := appendUint(nil, 1, m.ID)
+	b = appendString(b, 2, m.Error)
+	if m.Hello != nil {
+		b = appendMessage(b, 3, m.Hello)
+	}
+	if m.Capture != nil {
+		b = appendMessage(b, 4, m.Capture)
+	}
+	if m.Pixel != nil {
+		b = appendMessage(b, 5, m.Pixel)
+	}
+	if m.Monitors != nil {
+		b = appendMessage(b, 6, m.Monitors)
+	}
+	if m.Event != nil {
+		b = appendMessage(b, 7, m.Event)
+	}
+	if m.Thumbnail != nil {
+		b = appendMessage(b, 8, m.Thumbnail)
+	}
+	return b
+}
+
+func (m *Response) Unmarshal(b []byte) error {
+	*m = Response{}
+	return parse(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.ID = f.u
+		case 2:
+			m.Error = string(f.bytes)
+		case 3:
+			m.Hello = &HelloResponse{}
+			return sub(f, m.Hello)
+		case 4:
+			m.Capture = &Image{}
+			return sub(f, m.Capture)
+		case 5:
+			m.Pixel = &PixelResponse{}
+			return sub(f, m.Pixel)
+		case 6:
+			m.Monitors = &MonitorsResponse{}
+			return sub(f, m.Monitors)
+		case 7:
+			m.Event = &WatchEvent{}
+			return sub(f, m.Event)
+		case 8:
+			m.Thumbnail = &ThumbnailEvent{}
+			return sub(f, m.Thumbnail)
+		}
+		return nil
+	})
+}
+
+func (m *Rect) Marshal() []byte {
+	b := appendInt(nil, 1, m.X)
+	b = appendInt(b, 2, m.Y)
+	b = appendInt(b, 3, m.Width)
+	return appendInt(b, 4, m.Height)
+}
+
+func (m *Rect) Unmarshal(b []byte) error {
+	*m = Rect{}
+	return parse(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.X = f.int32()
+		case 2:
+			m.Y = f.int32()
+		case 3:
+			m.Width = f.int32()
+		case 4:
+			m.Height = f.int32()
+		}
+		return nil
+	})
+}
+
+func (m *HelloRequest) Marshal() []byte {
+	return appendString(nil, 1, m.Client)
+}
+
+func (m *HelloRequest) Unmarshal(b []byte) error {
+	*m = HelloRequest{}
+	return parse(b, func(f field) error {
+		if f.num == 1 {
+			m.Client = string(f.bytes)
+		}
+		return nil
+	})
+}
+
+func (m *HelloResponse) Marshal() []byte {
+	b := appendUint(nil, 1, uint64(m.ProtocolVersion))
+	return appendString(b, 2, m.Server)
+}
+
+func (m *HelloResponse) Unmarshal(b []byte) error {
+	*m = HelloResponse{}
+	return parse(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.ProtocolVersion = uint32(f.u)
+		case 2:
+			m.Server = string(f.bytes)
+		}
+		return nil
+	})
+}
+
+func (m *CaptureRequest) Marshal() []byte {
+	var b []byte
+	if m.Monitor != nil {
+		// Explicit presence: monitor 0 is still sent
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(int64(*m.Monitor)))
+	}
+	if m.Region != nil {
+		b = appendMessage(b, 2, m.Region)
+	}
+	b = appendUint(b, 3, uint64(m.WindowID))
+	b = appendInt(b, 4, int32(m.Format))
+	return appendInt(b, 5, m.Quality)
+}
+
+func (m *CaptureRequest) Unmarshal(b []byte) error {
+	*m = CaptureRequest{}
+	return parse(b, func(f field) error {
+		switch f.num {
+		case 1:
+			v := f.int32()
+			m.Monitor = &v
+		case 2:
+			m.Region = &Rect{}
+			return sub(f, m.Region)
+		case 3:
+			m.WindowID = uint32(f.u)
+		case 4:
+			m.Format = Format(f.int32())
+		case 5:
+			m.Quality = f.int32()
+		}
+		return nil
+	})
+}
+
+func (m *Image) Marshal() []byte {
+	b := appendInt(nil, 1, m.Width)
+	b = appendInt(b, 2, m.Height)
+	b = appendInt(b, 3, int32(m.Format))
+	b = appendBytes(b, 4, m.Data)
+	if m.Area != nil {
+		b = appendMessage(b, 5, m.Area)
+	}
+	return b
+}
+
+func (m *Image) Unmarshal(b []byte) error {
+	*m = Image{}
+	return parse(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.Width = f.int32()
+		case 2:
+			m.Height = f.int32()
+		case 3:
+			m.Format = Format(f.int32())
+		case 4:
+			m.Data = f.bytes
+		case 5:
+			m.Area = &Rect{}
+			return sub(f, m.Area)
+		}
+		return nil
+	})
+}
+
+func (m *PixelRequest) Marshal() []byte {
+	return appendInt(appendInt(nil, 1, m.X), 2, m.Y)
+}
+
+func (m *PixelRequest) Unmarshal(b []byte) error {
+	*m = PixelRequest{}
+	return parse(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.X = f.int32()
+		case 2:
+			m.Y = f.int32()
+		}
+		return nil
+	})
+}
+
+func (m *PixelResponse) Marshal() []byte {
+	b := appendUint(nil, 1, uint64(m.R))
+	b = appendUint(b, 2, uint64(m.G))
+	b = appendUint(b, 3, uint64(m.B))
+	return appendUint(b, 4, uint64(m.A))
+}
+
+func (m *PixelResponse) Unmarshal(b []byte) error {
+	*m = PixelResponse{}
+	return parse(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.R = uint32(f.u)
+		case 2:
+			m.G = uint32(f.u)
+		case 3:
+			m.B = uint32(f.u)
+		case 4:
+			m.A = uint32(f.u)
+		}
+		return nil
+	})
+}
+
+func (m *WatchRequest) Marshal() []byte {
+	var b []byte
+	if m.Region != nil {
+		b = appendMessage(b, 1, m.Region)
+	}
+	b = appendUint(b, 2, uint64(m.IntervalMS))
+	return appendBool(b, 3, m.IncludeImage)
+}
+
+func (m *WatchRequest) Unmarshal(b []byte) error {
+	*m = WatchRequest{}
+	return parse(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.Region = &Rect{}
+			return sub(f, m.Region)
+		case 2:
+			m.IntervalMS = uint32(f.u)
+		case 3:
+			m.IncludeImage = f.bool()
+		}
+		return nil
+	})
+}
+
+func (m *UnwatchRequest) Marshal() []byte {
+	return appendUint(nil, 1, m.WatchID)
+}
+
+func (m *UnwatchRequest) Unmarshal(b []byte) error {
+	*m = UnwatchRequest{}
+	return parse(b, func(f field) error {
+		if f.num == 1 {
+			m.WatchID = f.u
+		}
+		return nil
+	})
+}
+
+func (m *WatchEvent) Marshal() []byte {
+	b := appendUint(nil, 1, uint64(m.UnixNano))
+	b = appendUint(b, 2, m.Hash)
+	if m.Image != nil {
+		b = appendMessage(b, 3, m.Image)
+	}
+	return b
+}
+
+func (m *WatchEvent) Unmarshal(b []byte) error {
+	*m = WatchEvent{}
+	return parse(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.UnixNano = int64(f.u)
+		case 2:
+			m.Hash = f.u
+		case 3:
+			m.Image = &Image{}
+			return sub(f, m.Image)
+		}
+		return nil
+	})
+}
+
+func (m *MonitorsRequest) Marshal() []byte { return nil }
+
+func (m *MonitorsRequest) Unmarshal(b []byte) error {
+	return parse(b, func(f field) error { return nil })
+}
+
+func (m *MonitorsResponse) Marshal() []byte {
+	var b []byte
+	for _, mon := range m.Monitors {
+		b = appendMessage(b, 1, mon)
+	}
+	return b
+}
+
+func (m *MonitorsResponse) Unmarshal(b []byte) error {
+	*m = MonitorsResponse{}
+	return parse(b, func(f field) error {
+		if f.num == 1 {
+			mon := &Monitor{}
+			m.Monitors = append(m.Monitors, mon)
+			return sub(f, mon)
+		}
+		return nil
+	})
+}
+
+func (m *Monitor) Marshal() []byte {
+	b := appendInt(nil, 1, m.Index)
+	b = appendString(b, 2, m.Name)
+	if m.Bounds != nil {
+		b = appendMessage(b, 3, m.Bounds)
+	}
+	return appendBool(b, 4, m.Primary)
+}
+
+func (m *Monitor) Unmarshal(b []byte) error {
+	*m = Monitor{}
+	return parse(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.Index = f.int32()
+		case 2:
+			m.Name = string(f.bytes)
+		case 3:
+			m.Bounds = &Rect{}
+			return sub(f, m.Bounds)
+		case 4:
+			m.Primary = f.bool()
+		}
+		return nil
+	})
+}
+
+func (m *ThumbnailsRequest) Marshal() []byte {
+	b := appendUint(nil, 1, uint64(m.MaxWidth))
+	b = appendUint(b, 2, uint64(m.MaxHeight))
+	b = appendUint(b, 3, uint64(m.FPS))
+	return appendInt(b, 4, int32(m.Format))
+}
+
+func (m *ThumbnailsRequest) Unmarshal(b []byte) error {
+	*m = ThumbnailsRequest{}
+	return parse(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.MaxWidth = uint32(f.u)
+		case 2:
+			m.MaxHeight = uint32(f.u)
+		case 3:
+			m.FPS = uint32(f.u)
+		case 4:
+			m.Format = Format(f.int32())
+		}
+		return nil
+	})
+}
+
+func (m *ThumbnailEvent) Marshal() []byte {
+	b := appendUint(nil, 1, uint64(m.UnixNano))
+	b = appendUint(b, 2, uint64(m.WindowID))
+	b = appendString(b, 3, m.Title)
+	b = appendString(b, 4, m.Class)
+	if m.Bounds != nil {
+		b = appendMessage(b, 5, m.Bounds)
+	}
+	b = appendBool(b, 6, m.Hidden)
+	b = appendBool(b, 7, m.Closed)
+	if m.Image != nil {
+		b = appendMessage(b, 8, m.Image)
+	}
+	return b
+}
+
+func (m *ThumbnailEvent) Unmarshal(b []byte) error {
+	*m = ThumbnailEvent{}
+	return parse(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.UnixNano = int64(f.u)
+		case 2:
+			m.WindowID = uint32(f.u)
+		case 3:
+			m.Title = string(f.bytes)
+		case 4:
+			m.Class = string(f.bytes)
+		case 5:
+			m.Bounds = &Rect{}
+			return sub(f, m.Bounds)
+		case 6:
+			m.Hidden = f.bool()
+		case 7:
+			m.Closed = f.bool()
+		case 8:
+			m.Image = &Image{}
+			return sub(f, m.Image)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,353 @@
+// Package ipc serves captures, pixel queries, region watches and window
+// thumbnails to the robotin automation tools and to desktop panels over a
+// unix socket, so they don't have to run the CLI for every step. The
+// contract is proto/robotin/screenshot/v1/ipc.proto.
+package ipc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/imghash"
+	"github.com/robotin/screenshot/internal/strategy"
+	"github.com/robotin/screenshot/internal/xwin"
+)
+
+// Watch sampling limits
+const (
+	DefaultWatchInterval = 250 * time.Millisecond
+	MinWatchInterval     = 20 * time.Millisecond
+)
+
+// maxRequestSize bounds requests, which carry no pixel data
+const maxRequestSize = 1 << 20
+
+// Server answers IPC requests with a Capturer
+type Server struct {
+	capturer *capture.Capturer
+	name     string
+
+	// Logf, if set, receives connection and error messages
+	Logf func(format string, args ...any)
+
+	// Windows, if set, lists the top-level windows for thumbnail
+	// subscriptions, bottom to top
+	Windows func() ([]xwin.Window, error)
+
+	// ThumbnailSize and ThumbnailFPS are the defaults for thumbnail
+	// subscriptions that don't set their own
+	ThumbnailSize image.Point
+	ThumbnailFPS  int
+
+	// captures are serialized: the automation engine's steps and watches
+	// share one display connection's worth of bandwidth
+	mu sync.Mutex
+}
+
+// NewServer creates a server that identifies itself as name in Hello
+// responses
+func NewServer(capturer *capture.Capturer, name string) *Server {
+	return &Server{capturer: capturer, name: name}
+}
+
+// Listen creates the unix socket at path, readable only by the current
+// user. A stale socket left by a crashed daemon is replaced; a live one
+// is an error.
+func Listen(path string) (net.Listener, error) {
+	if _, err := os.Stat(path); err == nil {
+		if c, err := net.Dial("unix", path); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("%s is in use by another daemon", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+
+	// Create the socket with no permissions for others from the start
+	old := umask(0o177)
+	l, err := net.Listen("unix", path)
+	umask(old)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// Serve accepts connections until ctx is done, then closes l
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveConn(ctx, c)
+		}()
+	}
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+// conn is one client connection. Responses and watch events are written
+// from several goroutines, under wmu.
+type conn struct {
+	s   *Server
+	c   net.Conn
+	wmu sync.Mutex
+	w   *bufio.Writer
+
+	mu      sync.Mutex
+	watches map[uint64]context.CancelFunc
+}
+
+func (s *Server) serveConn(ctx context.Context, c net.Conn) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		c.Close()
+	}()
+
+	cn := &conn{s: s, c: c, w: bufio.NewWriter(c), watches: map[uint64]context.CancelFunc{}}
+	r := bufio.NewReader(c)
+	for {
+		var req Request
+		if err := Read(r, &req, maxRequestSize); err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				s.logf("ipc: closing connection: %v", err)
+			}
+			return
+		}
+		resp, start := cn.handle(ctx, &req)
+		if err := cn.send(resp); err != nil {
+			return
+		}
+		if start != nil {
+			go start()
+		}
+	}
+}
+
+// send writes a response, flushing it immediately
+func (cn *conn) send(resp *Response) error {
+	cn.wmu.Lock()
+	defer cn.wmu.Unlock()
+	if err := Write(cn.w, resp); err != nil {
+		return err
+	}
+	return cn.w.Flush()
+}
+
+// handle answers a request. A watch or thumbnail subscription also
+// returns the function running it, to be started once the
+// acknowledgement is sent.
+func (cn *conn) handle(ctx context.Context, req *Request) (*Response, func()) {
+	resp := &Response{ID: req.ID}
+	var start func()
+	var err error
+	switch {
+	case req.Hello != nil:
+		cn.s.logf("ipc: hello from %q", req.Hello.Client)
+		resp.Hello = &HelloResponse{ProtocolVersion: ProtocolVersion, Server: cn.s.name}
+	case req.Capture != nil:
+		resp.Capture, err = cn.s.captureImage(req.Capture)
+	case req.Pixel != nil:
+		resp.Pixel, err = cn.s.pixel(req.Pixel)
+	case req.Monitors != nil:
+		resp.Monitors, err = cn.s.monitors()
+	case req.Watch != nil:
+		start, err = cn.watch(ctx, req.ID, req.Watch)
+	case req.Thumbnails != nil:
+		start, err = cn.thumbnails(ctx, req.ID, req.Thumbnails)
+	case req.Unwatch != nil:
+		err = cn.unwatch(req.Unwatch.WatchID)
+	default:
+		err = errors.New("unknown request")
+	}
+	if err != nil {
+		return &Response{ID: req.ID, Error: err.Error()}, nil
+	}
+	return resp, start
+}
+
+// grab captures with the shared capturer
+func (s *Server) grab(opts strategy.CaptureOptions) (image.Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.capturer.Capture(opts)
+}
+
+func (s *Server) captureImage(req *CaptureRequest) (*Image, error) {
+	opts := strategy.CaptureOptions{Monitor: -1, WindowID: uint64(req.WindowID)}
+	if req.Monitor != nil {
+		opts.Monitor = int(*req.Monitor)
+	}
+	if req.Region != nil {
+		r := req.Region.Rectangle()
+		if r.Empty() {
+			return nil, fmt.Errorf("empty region")
+		}
+		opts.Region = &r
+	}
+
+	img, err := s.grab(opts)
+	if err != nil {
+		return nil, err
+	}
+	monitors, err := s.capturer.ListMonitors()
+	if err != nil {
+		return nil, err
+	}
+	out, err := encode(img, req.Format, int(req.Quality))
+	if err != nil {
+		return nil, err
+	}
+	out.Area = ToRect(capture.Area(opts, monitors))
+	return out, nil
+}
+
+// encode converts img to an Image message in the given format
+func encode(img image.Image, format Format, quality int) (*Image, error) {
+	b := img.Bounds()
+	out := &Image{Width: int32(b.Dx()), Height: int32(b.Dy()), Format: format}
+	switch format {
+	case FormatRGBA:
+		out.Data = imghash.Pixels(img)
+	case FormatPNG, FormatJPEG:
+		enc := capture.EncodeOptions{Format: capture.FormatPNG, CompressionLevel: 1}
+		if format == FormatJPEG {
+			enc = capture.EncodeOptions{Format: capture.FormatJPEG, Quality: quality}
+		}
+		var buf bytes.Buffer
+		if err := capture.Encode(img, &buf, enc); err != nil {
+			return nil, err
+		}
+		out.Data = buf.Bytes()
+	default:
+		return nil, fmt.Errorf("unknown format %d", format)
+	}
+	return out, nil
+}
+
+func (s *Server) pixel(req *PixelRequest) (*PixelResponse, error) {
+	r := image.Rect(int(req.X), int(req.Y), int(req.X)+1, int(req.Y)+1)
+	img, err := s.grab(strategy.CaptureOptions{Monitor: -1, Region: &r})
+	if err != nil {
+		return nil, err
+	}
+	px := imghash.Pixels(img)
+	return &PixelResponse{R: uint32(px[0]), G: uint32(px[1]), B: uint32(px[2]), A: uint32(px[3])}, nil
+}
+
+func (s *Server) monitors() (*MonitorsResponse, error) {
+	monitors, err := s.capturer.ListMonitors()
+	if err != nil {
+		return nil, err
+	}
+	resp := &MonitorsResponse{}
+	for _, m := range monitors {
+		resp.Monitors = append(resp.Monitors, &Monitor{
+			Index:   int32(m.Index),
+			Name:    m.Name,
+			Bounds:  ToRect(m.Bounds),
+			Primary: m.Primary,
+		})
+	}
+	return resp, nil
+}
+
+// watch registers a region watch and returns the sampling loop, which
+// sends an event with the first sample and then on every change
+func (cn *conn) watch(ctx context.Context, id uint64, req *WatchRequest) (func(), error) {
+	if req.Region == nil || req.Region.Rectangle().Empty() {
+		return nil, fmt.Errorf("watch needs a non-empty region")
+	}
+	interval := DefaultWatchInterval
+	if req.IntervalMS != 0 {
+		interval = max(time.Duration(req.IntervalMS)*time.Millisecond, MinWatchInterval)
+	}
+	// Sample no faster than the policy allows captures
+	interval = max(interval, cn.s.capturer.MinInterval())
+
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+	if _, ok := cn.watches[id]; ok {
+		return nil, fmt.Errorf("watch %d already exists", id)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	cn.watches[id] = cancel
+
+	r := req.Region.Rectangle()
+	opts := strategy.CaptureOptions{Monitor: -1, Region: &r}
+	return func() {
+		defer cn.unwatch(id)
+
+		var last uint64
+		first := true
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if img, err := cn.s.grab(opts); err != nil {
+				cn.s.logf("ipc: watch %d: %v", id, err)
+			} else {
+				px := imghash.Pixels(img)
+				if sum := imghash.ExactPixels(px); first || sum != last {
+					first, last = false, sum
+					ev := &WatchEvent{UnixNano: time.Now().UnixNano(), Hash: sum}
+					if req.IncludeImage {
+						b := img.Bounds()
+						ev.Image = &Image{Width: int32(b.Dx()), Height: int32(b.Dy()), Format: FormatRGBA, Data: px, Area: req.Region}
+					}
+					if err := cn.send(&Response{ID: id, Event: ev}); err != nil {
+						return
+					}
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}, nil
+}
+
+// unwatch stops a watch
+func (cn *conn) unwatch(id uint64) error {
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+	cancel, ok := cn.watches[id]
+	if !ok {
+		return fmt.Errorf("no watch %d", id)
+	}
+	cancel()
+	delete(cn.watches, id)
+	return nil
+}
@@ -0,0 +1,153 @@
+package ipc
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"time"
+
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/imghash"
+	"github.com/robotin/screenshot/internal/strategy"
+	"github.com/robotin/screenshot/internal/xwin"
+)
+
+// DefaultThumbnailSize is the box thumbnails are scaled to fit when
+// neither the daemon nor the request sets one
+var DefaultThumbnailSize = image.Pt(256, 256)
+
+// Thumbnail refresh rates
+const (
+	DefaultThumbnailFPS = 2
+	MaxThumbnailFPS     = 30
+)
+
+// thumbnailState is what a subscriber was last told about a window
+type thumbnailState struct {
+	win  xwin.Window
+	hash uint64
+}
+
+// thumbnails registers a thumbnail subscription and returns its refresh
+// loop, which sends an event for every window right away and then for
+// each window that opens, closes, changes its title, bounds or
+// visibility, or whose thumbnail changes
+func (cn *conn) thumbnails(ctx context.Context, id uint64, req *ThumbnailsRequest) (func(), error) {
+	if cn.s.Windows == nil {
+		return nil, fmt.Errorf("window thumbnails need an X11 display")
+	}
+	size := cn.s.ThumbnailSize
+	if size.X <= 0 || size.Y <= 0 {
+		size = DefaultThumbnailSize
+	}
+	if req.MaxWidth != 0 {
+		size.X = int(req.MaxWidth)
+	}
+	if req.MaxHeight != 0 {
+		size.Y = int(req.MaxHeight)
+	}
+	// Thumbnails capture every window on each refresh, which no limit on
+	// the capture rate leaves room for
+	if d := cn.s.capturer.MinInterval(); d > 0 {
+		return nil, fmt.Errorf("thumbnails are not allowed by the policy (one capture every %s)", d)
+	}
+	fps := cn.s.ThumbnailFPS
+	if fps <= 0 {
+		fps = DefaultThumbnailFPS
+	}
+	if req.FPS != 0 {
+		fps = int(req.FPS)
+	}
+	fps = min(fps, MaxThumbnailFPS)
+	if req.Format != FormatRGBA && req.Format != FormatPNG && req.Format != FormatJPEG {
+		return nil, fmt.Errorf("unknown format %d", req.Format)
+	}
+
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+	if _, ok := cn.watches[id]; ok {
+		return nil, fmt.Errorf("watch %d already exists", id)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	cn.watches[id] = cancel
+
+	return func() {
+		defer cn.unwatch(id)
+
+		seen := map[uint32]*thumbnailState{}
+		ticker := time.NewTicker(time.Second / time.Duration(fps))
+		defer ticker.Stop()
+		for {
+			if err := cn.refreshThumbnails(id, req.Format, size, seen); err != nil {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}, nil
+}
+
+// refreshThumbnails captures every window and sends the events since the
+// state in seen, which it updates. Only send errors are returned; a
+// window that can't be captured is reported without an image.
+func (cn *conn) refreshThumbnails(id uint64, format Format, size image.Point, seen map[uint32]*thumbnailState) error {
+	windows, err := cn.s.Windows()
+	if err != nil {
+		cn.s.logf("ipc: thumbnails %d: %v", id, err)
+		return nil
+	}
+
+	current := make(map[uint32]bool, len(windows))
+	for _, w := range windows {
+		current[w.ID] = true
+		ev := &ThumbnailEvent{WindowID: w.ID, Title: w.Title, Class: w.Class, Bounds: ToRect(w.Bounds), Hidden: w.Hidden}
+
+		last := seen[w.ID]
+		changed := last == nil || last.win != w
+		var hash uint64
+		if !w.Hidden && !w.Bounds.Empty() {
+			img, err := cn.s.grab(strategy.CaptureOptions{Monitor: -1, WindowID: uint64(w.ID), Region: &w.Bounds})
+			if err != nil {
+				// Windows can disappear between listing and capturing
+				cn.s.logf("ipc: thumbnails %d: window %#x: %v", id, w.ID, err)
+			} else {
+				small := capture.ScaleToFit(img, size)
+				hash = imghash.ExactPixels(imghash.Pixels(small))
+				if last == nil || hash != last.hash {
+					changed = true
+					if ev.Image, err = encode(small, format, 0); err != nil {
+						return err
+					}
+					ev.Image.Area = ev.Bounds
+				}
+			}
+		}
+		if last != nil && hash == 0 {
+			hash = last.hash
+		}
+		seen[w.ID] = &thumbnailState{win: w, hash: hash}
+		if !changed {
+			continue
+		}
+
+		ev.UnixNano = time.Now().UnixNano()
+		if err := cn.send(&Response{ID: id, Thumbnail: ev}); err != nil {
+			return err
+		}
+	}
+
+	for wid := range seen {
+		if current[wid] {
+			continue
+		}
+		delete(seen, wid)
+		ev := &ThumbnailEvent{UnixNano: time.Now().UnixNano(), WindowID: wid, Closed: true}
+		if err := cn.send(&Response{ID: id, Thumbnail: ev}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package ipc
+
+func umask(mask int) int {
+	return 0
+}
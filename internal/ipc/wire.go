@@ -0,0 +1,144 @@
+package ipc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The messages are encoded by hand with protowire rather than generated
+// with protoc, to keep the build free of code generation. They follow
+// proto/robotin/screenshot/v1/ipc.proto exactly; keep the two in sync.
+
+// Message is a protocol message
+type Message interface {
+	Marshal() []byte
+	Unmarshal(b []byte) error
+}
+
+// MaxMessageSize bounds a single message (a full 8K RGBA frame fits)
+const MaxMessageSize = 256 << 20
+
+// Write sends m prefixed with its varint length
+func Write(w io.Writer, m Message) error {
+	data := m.Marshal()
+	frame := protowire.AppendVarint(make([]byte, 0, len(data)+binary.MaxVarintLen64), uint64(len(data)))
+	_, err := w.Write(append(frame, data...))
+	return err
+}
+
+// Read reads one length-prefixed message of at most limit bytes into m
+func Read(r *bufio.Reader, m Message, limit int) error {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	if n > uint64(limit) {
+		return fmt.Errorf("message of %d bytes exceeds the %d byte limit", n, limit)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return m.Unmarshal(data)
+}
+
+// Encoding helpers. Zero values are omitted, as proto3 does.
+
+func appendUint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// appendInt encodes an int32 field: negative values are sign-extended to
+// ten bytes, as proto int32 requires
+func appendInt(b []byte, num protowire.Number, v int32) []byte {
+	return appendUint(b, num, uint64(int64(v)))
+}
+
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	return appendUint(b, num, 1)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	return appendBytes(b, num, []byte(v))
+}
+
+// appendMessage encodes a sub-message; nil is omitted but an empty
+// message is kept, since its presence selects a oneof case
+func appendMessage(b []byte, num protowire.Number, m Message) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m.Marshal())
+}
+
+// field is one decoded field; exactly one of its values is meaningful
+// depending on the wire type
+type field struct {
+	num   protowire.Number
+	typ   protowire.Type
+	u     uint64
+	bytes []byte
+}
+
+func (f field) int32() int32 { return int32(f.u) }
+func (f field) bool() bool   { return f.u != 0 }
+
+// parse calls fn for each field in b. Unknown fields are skipped by fn
+// simply ignoring them.
+func parse(b []byte, fn func(f field) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		f := field{num: num, typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.u, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if err := fn(f); err != nil {
+			return fmt.Errorf("field %d: %w", num, err)
+		}
+	}
+	return nil
+}
+
+// sub decodes a sub-message field into m
+func sub(f field, m Message) error {
+	if f.typ != protowire.BytesType {
+		return fmt.Errorf("expected a message")
+	}
+	return m.Unmarshal(f.bytes)
+}
@@ -0,0 +1,159 @@
+// Package layout draws the monitor arrangement, as ASCII art for the
+// terminal or as a diagram image, to help pick --region coordinates
+package layout
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+
+	"github.com/robotin/screenshot/internal/annotate"
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// Bounds returns the area covered by all monitors
+func Bounds(monitors []strategy.Monitor) image.Rectangle {
+	var b image.Rectangle
+	for _, m := range monitors {
+		b = b.Union(m.Bounds)
+	}
+	return b
+}
+
+// labels returns the lines describing a monitor
+func labels(m strategy.Monitor) []string {
+	name := fmt.Sprintf("%d: %s", m.Index, m.Name)
+	if m.Primary {
+		name += " *"
+	}
+	return []string{
+		name,
+		fmt.Sprintf("%dx%d", m.Bounds.Dx(), m.Bounds.Dy()),
+		fmt.Sprintf("+%d+%d", m.Bounds.Min.X, m.Bounds.Min.Y),
+	}
+}
+
+// ASCII draws the monitors as boxes scaled to cols characters wide.
+// Terminal cells are about twice as tall as wide, so rows are halved to
+// keep proportions.
+func ASCII(monitors []strategy.Monitor, cols int) string {
+	b := Bounds(monitors)
+	if b.Empty() {
+		return ""
+	}
+	cols = max(cols, 20)
+
+	scale := float64(cols-1) / float64(b.Dx())
+	rows := int(math.Round(float64(b.Dy())*scale/2)) + 1
+	col := func(x int) int { return int(math.Round(float64(x-b.Min.X) * scale)) }
+	row := func(y int) int { return int(math.Round(float64(y-b.Min.Y) * scale / 2)) }
+
+	grid := make([][]rune, rows)
+	for i := range grid {
+		grid[i] = []rune(strings.Repeat(" ", cols))
+	}
+	set := func(r, c int, ch rune) {
+		if r >= 0 && r < rows && c >= 0 && c < cols {
+			grid[r][c] = ch
+		}
+	}
+
+	for _, m := range monitors {
+		x0, x1 := col(m.Bounds.Min.X), col(m.Bounds.Max.X)
+		y0, y1 := row(m.Bounds.Min.Y), row(m.Bounds.Max.Y)
+		x1, y1 = max(x1, x0+2), max(y1, y0+2)
+
+		for c := x0 + 1; c < x1; c++ {
+			set(y0, c, '-')
+			set(y1, c, '-')
+		}
+		for r := y0 + 1; r < y1; r++ {
+			set(r, x0, '|')
+			set(r, x1, '|')
+		}
+		for _, p := range [][2]int{{y0, x0}, {y0, x1}, {y1, x0}, {y1, x1}} {
+			set(p[0], p[1], '+')
+		}
+
+		// Center as many label lines as fit inside the box
+		lines := labels(m)
+		inner := y1 - y0 - 1
+		lines = lines[:min(len(lines), inner)]
+		top := y0 + 1 + (inner-len(lines))/2
+		for i, line := range lines {
+			width := x1 - x0 - 1
+			if len(line) > width {
+				line = line[:max(width, 0)]
+			}
+			start := x0 + 1 + (width-len(line))/2
+			for j, ch := range line {
+				set(top+i, start+j, ch)
+			}
+		}
+	}
+
+	var sb strings.Builder
+	for _, r := range grid {
+		sb.WriteString(strings.TrimRight(string(r), " "))
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// monitorFill alternates so adjacent monitors are easy to tell apart
+var monitorFill = []color.RGBA{
+	{0x3a, 0x5f, 0x8f, 0xff},
+	{0x4f, 0x7a, 0x4a, 0xff},
+	{0x8a, 0x5a, 0x3c, 0xff},
+	{0x6a, 0x4c, 0x8a, 0xff},
+}
+
+// Diagram renders the monitors into an image width pixels wide, each
+// monitor a colored box labeled with its index, name, size and offset
+func Diagram(monitors []strategy.Monitor, width int) (*image.RGBA, error) {
+	b := Bounds(monitors)
+	if b.Empty() {
+		return nil, fmt.Errorf("no monitors")
+	}
+
+	const margin = 16
+	width = max(width, 200)
+	scale := float64(width-2*margin) / float64(b.Dx())
+	height := int(math.Round(float64(b.Dy())*scale)) + 2*margin
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{0x20, 0x20, 0x24, 0xff}), image.Point{}, draw.Src)
+
+	var ops []annotate.Op
+	for i, m := range monitors {
+		x0 := margin + int(math.Round(float64(m.Bounds.Min.X-b.Min.X)*scale))
+		y0 := margin + int(math.Round(float64(m.Bounds.Min.Y-b.Min.Y)*scale))
+		x1 := margin + int(math.Round(float64(m.Bounds.Max.X-b.Min.X)*scale))
+		y1 := margin + int(math.Round(float64(m.Bounds.Max.Y-b.Min.Y)*scale))
+		box := fmt.Sprintf("%d,%d,%d,%d", x0, y0, x1-x0, y1-y0)
+
+		fill := monitorFill[i%len(monitorFill)]
+		ops = append(ops,
+			annotate.Op{Fill: box, Color: fmt.Sprintf("#%02x%02x%02x", fill.R, fill.G, fill.B)},
+			annotate.Op{Rect: box, Color: "white", Width: 2},
+		)
+
+		// Shrink labels on small boxes; the built-in font is 7x13
+		textScale := 2
+		if x1-x0 < 200 || y1-y0 < 100 {
+			textScale = 1
+		}
+		for j, line := range labels(m) {
+			ops = append(ops, annotate.Op{
+				Text:  line,
+				At:    fmt.Sprintf("%d,%d", x0+8, y0+8+j*15*textScale),
+				Color: "white",
+				Scale: textScale,
+			})
+		}
+	}
+	return annotate.Apply(img, ops)
+}
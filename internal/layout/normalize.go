@@ -0,0 +1,82 @@
+package layout
+
+import (
+	"image"
+	"math"
+)
+
+// Normalize returns where monitors go once each is scaled by its factor,
+// e.g. to bring a HiDPI laptop panel to the density of an external
+// monitor. A monitor keeps touching the monitor to its left (or, failing
+// that, above it), with its offset along the shared edge scaled by the
+// neighbour's factor, so the result looks like the desktop does to the
+// user rather than like the raw pixel space.
+func Normalize(bounds []image.Rectangle, scales []float64) []image.Rectangle {
+	out := make([]image.Rectangle, len(bounds))
+	placed := make([]bool, len(bounds))
+
+	scaled := func(v int, s float64) int {
+		return int(math.Round(float64(v) * s))
+	}
+	size := func(i int) image.Point {
+		return image.Pt(scaled(bounds[i].Dx(), scales[i]), scaled(bounds[i].Dy(), scales[i]))
+	}
+	place := func(i int, min image.Point) {
+		out[i] = image.Rectangle{Min: min, Max: min.Add(size(i))}
+		placed[i] = true
+	}
+
+	for remaining := len(bounds); remaining > 0; {
+		progress := false
+		for i, b := range bounds {
+			if placed[i] {
+				continue
+			}
+			left, top := neighbours(bounds, i)
+			switch {
+			case left >= 0 && placed[left]:
+				l := bounds[left]
+				place(i, image.Pt(out[left].Max.X, out[left].Min.Y+scaled(b.Min.Y-l.Min.Y, scales[left])))
+			case left < 0 && top >= 0 && placed[top]:
+				u := bounds[top]
+				place(i, image.Pt(out[top].Min.X+scaled(b.Min.X-u.Min.X, scales[top]), out[top].Max.Y))
+			case left < 0 && top < 0:
+				place(i, image.Pt(scaled(b.Min.X, scales[i]), scaled(b.Min.Y, scales[i])))
+			default:
+				continue
+			}
+			remaining--
+			progress = true
+		}
+		if !progress {
+			// Circular neighbours (overlapping monitors): place the rest
+			// by their own scale
+			for i, b := range bounds {
+				if !placed[i] {
+					place(i, image.Pt(scaled(b.Min.X, scales[i]), scaled(b.Min.Y, scales[i])))
+					remaining--
+				}
+			}
+		}
+	}
+	return out
+}
+
+// neighbours returns the monitors whose right edge touches monitor i's
+// left edge and whose bottom edge touches its top edge, or -1
+func neighbours(bounds []image.Rectangle, i int) (left, top int) {
+	left, top = -1, -1
+	b := bounds[i]
+	for j, o := range bounds {
+		if j == i {
+			continue
+		}
+		if left < 0 && o.Max.X == b.Min.X && o.Min.Y < b.Max.Y && b.Min.Y < o.Max.Y {
+			left = j
+		}
+		if top < 0 && o.Max.Y == b.Min.Y && o.Min.X < b.Max.X && b.Min.X < o.Max.X {
+			top = j
+		}
+	}
+	return left, top
+}
@@ -0,0 +1,213 @@
+// Package locate lists the visible UI elements in a capture with their
+// positions, for automation tools that need coordinates to click
+package locate
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/robotin/screenshot/internal/a11y"
+	"github.com/robotin/screenshot/internal/annotate"
+	"github.com/robotin/screenshot/internal/xwin"
+)
+
+// Sources of element data
+const (
+	SourceATSPI = "atspi"
+	SourceEWMH  = "ewmh"
+)
+
+// Point is a point in JSON-friendly form
+type Point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// Element is a visible UI element
+type Element struct {
+	// ID numbers elements from 1, matching the labels drawn by Overlay
+	ID     int      `json:"id"`
+	Role   string   `json:"role"`
+	Name   string   `json:"name,omitempty"`
+	States []string `json:"states,omitempty"`
+	Source string   `json:"source"`
+
+	// Bounds is the element's visible part in image pixels
+	Bounds a11y.Rect `json:"bounds"`
+
+	// Click is a point inside the element in screen coordinates
+	Click Point `json:"click"`
+}
+
+// interactiveRoles are the AT-SPI roles reported as elements: things a
+// user clicks or types into
+var interactiveRoles = map[string]bool{
+	"push button":     true,
+	"toggle button":   true,
+	"check box":       true,
+	"radio button":    true,
+	"menu item":       true,
+	"check menu item": true,
+	"radio menu item": true,
+	"menu":            true,
+	"combo box":       true,
+	"text":            true,
+	"entry":           true,
+	"password text":   true,
+	"spin button":     true,
+	"slider":          true,
+	"scroll bar":      true,
+	"link":            true,
+	"page tab":        true,
+	"list item":       true,
+	"tree item":       true,
+	"table cell":      true,
+	"icon":            true,
+}
+
+// FromTree returns the interactive elements of a window's accessibility
+// tree that are showing and inside the window, in tree order
+func FromTree(t *a11y.Tree) []Element {
+	win := image.Rect(0, 0, t.WindowBounds.Width, t.WindowBounds.Height)
+	origin := image.Pt(t.WindowBounds.X, t.WindowBounds.Y)
+
+	var elements []Element
+	var walk func(n *a11y.Node)
+	walk = func(n *a11y.Node) {
+		if !has(n.States, "showing") || !has(n.States, "visible") {
+			// Children of hidden containers are hidden too
+			return
+		}
+		if interactiveRoles[n.Role] && n.Bounds != nil {
+			r := rect(*n.Bounds).Intersect(win)
+			if !r.Empty() {
+				elements = append(elements, Element{
+					ID:     len(elements) + 1,
+					Role:   n.Role,
+					Name:   n.Name,
+					States: n.States,
+					Source: SourceATSPI,
+					Bounds: toRect(r),
+					Click:  center(r.Add(origin)),
+				})
+			}
+		}
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	if t.Root != nil {
+		walk(t.Root)
+	}
+	return elements
+}
+
+// FromWindows returns the top-level windows visible in area (screen
+// coordinates), topmost first. windows is in stacking order, bottom to
+// top, as returned by xwin.Conn.Windows. Bounds are clipped to area and
+// Click is in the largest part not covered by windows above.
+func FromWindows(windows []xwin.Window, area image.Rectangle) []Element {
+	var elements []Element
+	var above []image.Rectangle
+	for i := len(windows) - 1; i >= 0; i-- {
+		w := windows[i]
+		if w.Hidden {
+			continue
+		}
+		r := w.Bounds.Intersect(area)
+		visible := []image.Rectangle{r}
+		for _, a := range above {
+			visible = subtract(visible, a)
+		}
+		above = append(above, w.Bounds)
+		if r.Empty() || len(visible) == 0 {
+			continue
+		}
+
+		largest := visible[0]
+		for _, v := range visible[1:] {
+			if v.Dx()*v.Dy() > largest.Dx()*largest.Dy() {
+				largest = v
+			}
+		}
+		name := w.Title
+		if name == "" {
+			name = w.Class
+		}
+		elements = append(elements, Element{
+			ID:     len(elements) + 1,
+			Role:   "window",
+			Name:   name,
+			Source: SourceEWMH,
+			Bounds: toRect(r.Sub(area.Min)),
+			Click:  center(largest),
+		})
+	}
+	return elements
+}
+
+// subtract removes s from each rectangle in rs, splitting them into the
+// up to four pieces around s
+func subtract(rs []image.Rectangle, s image.Rectangle) []image.Rectangle {
+	var out []image.Rectangle
+	for _, r := range rs {
+		o := r.Intersect(s)
+		if o.Empty() {
+			out = append(out, r)
+			continue
+		}
+		for _, piece := range []image.Rectangle{
+			image.Rect(r.Min.X, r.Min.Y, r.Max.X, o.Min.Y), // above
+			image.Rect(r.Min.X, o.Max.Y, r.Max.X, r.Max.Y), // below
+			image.Rect(r.Min.X, o.Min.Y, o.Min.X, o.Max.Y), // left
+			image.Rect(o.Max.X, o.Min.Y, r.Max.X, o.Max.Y), // right
+		} {
+			if !piece.Empty() {
+				out = append(out, piece)
+			}
+		}
+	}
+	return out
+}
+
+// Overlay draws each element's box and ID onto a copy of img, colored by
+// kind: text inputs blue, windows yellow, everything else red
+func Overlay(img image.Image, elements []Element) (*image.RGBA, error) {
+	ops := make([]annotate.Op, 0, 2*len(elements))
+	for _, e := range elements {
+		c, fg := "red", "white"
+		switch e.Role {
+		case "text", "entry", "password text", "spin button", "combo box":
+			c = "blue"
+		case "window":
+			c, fg = "yellow", "black"
+		}
+		b := e.Bounds
+		ops = append(ops,
+			annotate.Op{Rect: fmt.Sprintf("%d,%d,%d,%d", b.X, b.Y, b.Width, b.Height), Color: c, Width: 2},
+			annotate.Op{Text: fmt.Sprint(e.ID), At: fmt.Sprintf("%d,%d", b.X+2, b.Y+2), Color: fg, Background: c, Scale: 1},
+		)
+	}
+	return annotate.Apply(img, ops)
+}
+
+func has(states []string, state string) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+func rect(r a11y.Rect) image.Rectangle {
+	return image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height)
+}
+
+func toRect(r image.Rectangle) a11y.Rect {
+	return a11y.Rect{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+}
+
+func center(r image.Rectangle) Point {
+	return Point{X: (r.Min.X + r.Max.X) / 2, Y: (r.Min.Y + r.Max.Y) / 2}
+}
@@ -0,0 +1,72 @@
+// Package lock provides advisory file locks used to keep captures from
+// overlapping
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrLocked is returned by TryAcquire when another process holds the lock
+var ErrLocked = errors.New("lock is held by another process")
+
+// Lock is a held file lock. The lock is released when the process exits,
+// even if it crashes.
+type Lock struct {
+	f *os.File
+}
+
+// Acquire takes the lock at path, blocking until it is free
+func Acquire(path string) (*Lock, error) {
+	return acquire(path, true)
+}
+
+// TryAcquire takes the lock at path, or returns ErrLocked if another
+// process holds it
+func TryAcquire(path string) (*Lock, error) {
+	return acquire(path, false)
+}
+
+func acquire(path string, block bool) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock: %w", err)
+	}
+
+	if err := lockFile(f, block); err != nil {
+		f.Close()
+		if errors.Is(err, ErrLocked) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+
+	// Record the holder for anyone inspecting a stuck lock
+	f.Truncate(0)
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+	return &Lock{f: f}, nil
+}
+
+// Release releases the lock
+func (l *Lock) Release() error {
+	unlockFile(l.f)
+	return l.f.Close()
+}
+
+// File takes an exclusive lock on an open file, blocking until it is
+// free, for files that are locked while they are written (a log others
+// append to). Other processes can still read the file.
+func File(f *os.File) error {
+	return lockFile(f, true)
+}
+
+// Unlock releases a lock taken with File
+func Unlock(f *os.File) error {
+	return unlockFile(f)
+}
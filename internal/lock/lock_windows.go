@@ -0,0 +1,38 @@
+//go:build windows
+
+package lock
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// Windows locks are mandatory for the bytes they cover, so the lock is
+// on a byte far past the end of any file, where it keeps no one from
+// reading or writing the data
+const (
+	lockOffsetHigh = 0x7fffffff
+	lockLength     = 1
+)
+
+// lockFile takes an exclusive LockFileEx lock on f, or returns ErrLocked
+// without blocking if another process holds it and block is false
+func lockFile(f *os.File, block bool) error {
+	flags := uint32(windows.LOCKFILE_EXCLUSIVE_LOCK)
+	if !block {
+		flags |= windows.LOCKFILE_FAIL_IMMEDIATELY
+	}
+	ol := &windows.Overlapped{OffsetHigh: lockOffsetHigh}
+	err := windows.LockFileEx(windows.Handle(f.Fd()), flags, 0, lockLength, 0, ol)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return ErrLocked
+	}
+	return err
+}
+
+func unlockFile(f *os.File) error {
+	ol := &windows.Overlapped{OffsetHigh: lockOffsetHigh}
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, lockLength, 0, ol)
+}
@@ -0,0 +1,14 @@
+//go:build nowebhook || minimal
+
+package notify
+
+import (
+	"context"
+	"errors"
+)
+
+// post fails without retrying: builds with the nowebhook or minimal tags
+// have no HTTP client
+func (w *Webhook) post(ctx context.Context, body []byte) (bool, error) {
+	return false, errors.New("webhooks are not compiled into this binary (built with -tags nowebhook or minimal)")
+}
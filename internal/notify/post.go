@@ -0,0 +1,45 @@
+//go:build !nowebhook && !minimal
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// post sends one request and reports whether a failure is worth retrying
+func (w *Webhook) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "robotin-screenshot")
+
+	if len(w.Secret) > 0 {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, w.Secret)
+		mac.Write([]byte(ts + "."))
+		mac.Write(body)
+		req.Header.Set("X-Screenshot-Timestamp", ts)
+		req.Header.Set("X-Screenshot-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode >= 500, fmt.Errorf("%s", resp.Status)
+	}
+	return false, nil
+}
@@ -0,0 +1,171 @@
+// Package notify tells external systems about captures
+package notify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/robotin/screenshot/internal/analyze"
+)
+
+// Event types
+const (
+	EventCapture = "capture"
+	EventUpload  = "upload"
+	EventBurnIn  = "burn-in"
+
+	// EventScreenAlert reports a screen that went blank or froze, and
+	// EventScreenRecovered that it is back to normal
+	EventScreenAlert     = "screen-alert"
+	EventScreenRecovered = "screen-recovered"
+)
+
+// Event describes a finished capture (and its upload, if any), or an
+// alert about captures
+type Event struct {
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Host   string    `json:"host"`
+	Path   string    `json:"path,omitempty"`
+	URL    string    `json:"url,omitempty"`
+	Format string    `json:"format,omitempty"`
+	Width  int       `json:"width,omitempty"`
+	Height int       `json:"height,omitempty"`
+	Size   int64     `json:"size,omitempty"`
+	SHA256 string    `json:"sha256,omitempty"`
+	Tags   []string  `json:"tags,omitempty"`
+
+	// Regions lists the static screen areas of a burn-in alert
+	Regions []Region `json:"regions,omitempty"`
+
+	// Analysis is the capture's --analyze color summary
+	Analysis *analyze.Result `json:"analysis,omitempty"`
+
+	// Focus is the window that had the focus at capture time and Pointer
+	// where the pointer was
+	Focus   *Focus `json:"focus,omitempty"`
+	Pointer *Point `json:"pointer,omitempty"`
+
+	// Alert is what a screen alert, or the one a recovery ends, is about:
+	// black, white, solid or frozen; Since is when it started
+	Alert string     `json:"alert,omitempty"`
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// Focus is the focused window reported in an event
+type Focus struct {
+	Window uint32 `json:"window"`
+	Class  string `json:"class,omitempty"`
+	Title  string `json:"title,omitempty"`
+	PID    uint32 `json:"pid,omitempty"`
+}
+
+// Point is a screen position reported in an event
+type Point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// Region is a screen area reported in an event
+type Region struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+
+	// StaticSeconds is how long the area has looked the same
+	StaticSeconds int64 `json:"static_seconds,omitempty"`
+}
+
+// NewEvent creates an event for a capture saved at path and, if url is
+// set, uploaded there. Call Checksum to add the file's size and hash.
+func NewEvent(path, url, format string, width, height int, tags []string) *Event {
+	host, _ := os.Hostname()
+	ev := &Event{
+		Type:   EventCapture,
+		Time:   time.Now().UTC(),
+		Host:   host,
+		Path:   path,
+		URL:    url,
+		Format: format,
+		Width:  width,
+		Height: height,
+		Tags:   tags,
+	}
+	if url != "" {
+		ev.Type = EventUpload
+	}
+	return ev
+}
+
+// Checksum fills in the size and SHA-256 of the file at path
+func (e *Event) Checksum(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	e.Size = n
+	e.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+// Webhook POSTs events as JSON to a URL.
+//
+// With a secret, each request carries X-Screenshot-Timestamp and
+// X-Screenshot-Signature: "sha256=" followed by the hex HMAC-SHA256 of
+// "<timestamp>.<body>", so receivers can verify the sender and reject
+// replays.
+type Webhook struct {
+	URL      string
+	Secret   []byte
+	Attempts int // total tries per event (default 3)
+}
+
+// Send delivers an event, retrying network errors and 5xx responses
+func (w *Webhook) Send(ctx context.Context, ev *Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	attempts := w.Attempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+
+	delay := time.Second
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+
+		retry, err := w.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry {
+			break
+		}
+	}
+	return fmt.Errorf("webhook %s failed: %w", w.URL, lastErr)
+}
@@ -0,0 +1,256 @@
+// Package parquet writes simple Apache Parquet files, enough to hand
+// tables to analytics tools (DuckDB, Spark, pandas): a flat schema of
+// nullable columns stored in one uncompressed row group, with PLAIN
+// encoded values
+package parquet
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Type is a column type
+type Type int
+
+// Column types
+const (
+	// String holds UTF-8 text
+	String Type = iota
+	Int32
+	Int64
+
+	// Timestamp holds UTC times with millisecond precision
+	Timestamp
+)
+
+// Parquet physical types, converted types and encodings
+const (
+	physicalInt32     = 1
+	physicalInt64     = 2
+	physicalByteArray = 6
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	repetitionOptional = 1
+)
+
+// Column is a column of the schema
+type Column struct {
+	Name string
+	Type Type
+}
+
+// physical returns the column's physical type
+func (c Column) physical() int32 {
+	switch c.Type {
+	case String:
+		return physicalByteArray
+	case Int32:
+		return physicalInt32
+	}
+	return physicalInt64
+}
+
+const magic = "PAR1"
+
+// Write writes rows as a Parquet file. Each row has one value per column:
+// a string, int32 (or int), int64 or time.Time matching the column type,
+// or nil for null.
+func Write(w io.Writer, columns []Column, rows [][]any) error {
+	for r, row := range rows {
+		if len(row) != len(columns) {
+			return fmt.Errorf("row %d has %d values for %d columns", r+1, len(row), len(columns))
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(magic); err != nil {
+		return err
+	}
+	offset := int64(len(magic))
+
+	chunks := make([]chunk, len(columns))
+	for i, col := range columns {
+		page, err := encodePage(col, i, rows)
+		if err != nil {
+			return err
+		}
+		if _, err := bw.Write(page); err != nil {
+			return err
+		}
+		chunks[i] = chunk{offset: offset, size: int64(len(page))}
+		offset += int64(len(page))
+	}
+
+	meta := fileMetadata(columns, chunks, int64(len(rows)))
+	if _, err := bw.Write(meta); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, binary.LittleEndian, uint32(len(meta))); err != nil {
+		return err
+	}
+	if _, err := bw.WriteString(magic); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// chunk is where a column's data page was written
+type chunk struct {
+	offset, size int64
+}
+
+// encodePage returns column i of rows as a data page with its header
+func encodePage(col Column, i int, rows [][]any) ([]byte, error) {
+	defined := make([]bool, len(rows))
+	var values []byte
+	for r, row := range rows {
+		v := row[i]
+		if v == nil {
+			continue
+		}
+		defined[r] = true
+		var ok bool
+		switch col.Type {
+		case String:
+			var s string
+			if s, ok = v.(string); ok {
+				values = binary.LittleEndian.AppendUint32(values, uint32(len(s)))
+				values = append(values, s...)
+			}
+		case Int32:
+			var n int32
+			switch x := v.(type) {
+			case int32:
+				n, ok = x, true
+			case int:
+				n, ok = int32(x), true
+			}
+			if ok {
+				values = binary.LittleEndian.AppendUint32(values, uint32(n))
+			}
+		case Int64:
+			var n int64
+			if n, ok = v.(int64); ok {
+				values = binary.LittleEndian.AppendUint64(values, uint64(n))
+			}
+		case Timestamp:
+			var t time.Time
+			if t, ok = v.(time.Time); ok {
+				values = binary.LittleEndian.AppendUint64(values, uint64(t.UnixMilli()))
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("column %s: row %d has a %T value", col.Name, r+1, v)
+		}
+	}
+
+	levels := definitionLevels(defined)
+	data := binary.LittleEndian.AppendUint32(nil, uint32(len(levels)))
+	data = append(data, levels...)
+	data = append(data, values...)
+
+	var t thrift
+	t.begin(0)
+	t.i32(1, 0) // DATA_PAGE
+	t.i32(2, int32(len(data)))
+	t.i32(3, int32(len(data)))
+	t.begin(5)
+	t.i32(1, int32(len(rows)))
+	t.i32(2, encodingPlain)
+	t.i32(3, encodingRLE)
+	t.i32(4, encodingRLE)
+	t.end()
+	t.end()
+	return append(t.buf, data...), nil
+}
+
+// definitionLevels encodes which values are set as RLE runs of 0 (null)
+// and 1 (set), with a bit width of 1
+func definitionLevels(defined []bool) []byte {
+	var out []byte
+	for i := 0; i < len(defined); {
+		j := i
+		for j < len(defined) && defined[j] == defined[i] {
+			j++
+		}
+		out = binary.AppendUvarint(out, uint64(j-i)<<1)
+		if defined[i] {
+			out = append(out, 1)
+		} else {
+			out = append(out, 0)
+		}
+		i = j
+	}
+	return out
+}
+
+// fileMetadata returns the footer describing the schema and where each
+// column chunk is
+func fileMetadata(columns []Column, chunks []chunk, rows int64) []byte {
+	var t thrift
+	t.begin(0)
+	t.i32(1, 1) // version
+
+	t.list(2, tStruct, len(columns)+1)
+	t.begin(0)
+	t.binary(4, "schema")
+	t.i32(5, int32(len(columns)))
+	t.end()
+	for _, c := range columns {
+		t.begin(0)
+		t.i32(1, c.physical())
+		t.i32(3, repetitionOptional)
+		t.binary(4, c.Name)
+		switch c.Type {
+		case String:
+			t.i32(6, convertedUTF8)
+		case Timestamp:
+			t.i32(6, convertedTimestampMillis)
+		}
+		t.end()
+	}
+
+	t.i64(3, rows)
+
+	var total int64
+	for _, ch := range chunks {
+		total += ch.size
+	}
+	t.list(4, tStruct, 1)
+	t.begin(0)
+	t.list(1, tStruct, len(columns))
+	for i, c := range columns {
+		t.begin(0)
+		t.i64(2, chunks[i].offset)
+		t.begin(3)
+		t.i32(1, c.physical())
+		t.list(2, tI32, 2)
+		t.zigzag(encodingPlain)
+		t.zigzag(encodingRLE)
+		t.list(3, tBinary, 1)
+		t.uvarint(uint64(len(c.Name)))
+		t.buf = append(t.buf, c.Name...)
+		t.i32(4, 0) // UNCOMPRESSED
+		t.i64(5, rows)
+		t.i64(6, chunks[i].size)
+		t.i64(7, chunks[i].size)
+		t.i64(9, chunks[i].offset)
+		t.end()
+		t.end()
+	}
+	t.i64(2, total)
+	t.i64(3, rows)
+	t.end()
+
+	t.binary(6, "robotin-screenshot")
+	t.end()
+	return t.buf
+}
@@ -0,0 +1,86 @@
+package parquet
+
+import (
+	"encoding/binary"
+)
+
+// Thrift compact protocol field types
+const (
+	tI32    = 5
+	tI64    = 6
+	tBinary = 8
+	tList   = 9
+	tStruct = 12
+)
+
+// thrift encodes structs with the Thrift compact protocol, which is what
+// Parquet metadata is written in
+type thrift struct {
+	buf []byte
+
+	// last is the previous field ID of each open struct
+	last []int16
+}
+
+func (t *thrift) uvarint(v uint64) {
+	t.buf = binary.AppendUvarint(t.buf, v)
+}
+
+func (t *thrift) zigzag(v int64) {
+	t.uvarint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+// field writes a field header, using the short form when the ID follows
+// closely on the previous one
+func (t *thrift) field(id int16, typ byte) {
+	last := &t.last[len(t.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.zigzag(int64(id))
+	}
+	*last = id
+}
+
+func (t *thrift) i32(id int16, v int32) {
+	t.field(id, tI32)
+	t.zigzag(int64(v))
+}
+
+func (t *thrift) i64(id int16, v int64) {
+	t.field(id, tI64)
+	t.zigzag(v)
+}
+
+func (t *thrift) binary(id int16, s string) {
+	t.field(id, tBinary)
+	t.uvarint(uint64(len(s)))
+	t.buf = append(t.buf, s...)
+}
+
+// list writes a list header for n elements of the given type, which the
+// caller then writes without field headers
+func (t *thrift) list(id int16, elem byte, n int) {
+	t.field(id, tList)
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|elem)
+	} else {
+		t.buf = append(t.buf, 0xf0|elem)
+		t.uvarint(uint64(n))
+	}
+}
+
+// begin opens a struct, as a field (id > 0) or a list element (id 0)
+func (t *thrift) begin(id int16) {
+	if id > 0 {
+		t.field(id, tStruct)
+	}
+	t.last = append(t.last, 0)
+}
+
+// end closes the innermost struct
+func (t *thrift) end() {
+	t.buf = append(t.buf, 0)
+	t.last = t.last[:len(t.last)-1]
+}
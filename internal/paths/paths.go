@@ -0,0 +1,105 @@
+// Package paths resolves the per-user directories used by the tool,
+// following the XDG base directory conventions
+package paths
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// appName is the directory name used under the XDG base directories
+const appName = "robotin-screenshot"
+
+// ConfigDir returns the configuration directory
+// ($XDG_CONFIG_HOME/robotin-screenshot, usually ~/.config/robotin-screenshot)
+func ConfigDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine config directory: %w", err)
+	}
+	return filepath.Join(dir, appName), nil
+}
+
+// StateDir returns the state directory for data that should persist but
+// isn't worth backing up, such as capture history
+// ($XDG_STATE_HOME/robotin-screenshot, usually ~/.local/state/robotin-screenshot)
+func StateDir() (string, error) {
+	return xdgDir("XDG_STATE_HOME", ".local/state")
+}
+
+// DataDir returns the data directory
+// ($XDG_DATA_HOME/robotin-screenshot, usually ~/.local/share/robotin-screenshot)
+func DataDir() (string, error) {
+	return xdgDir("XDG_DATA_HOME", ".local/share")
+}
+
+// RuntimeDir returns the directory for lock files and other per-boot
+// state ($XDG_RUNTIME_DIR/robotin-screenshot, or a per-user directory in
+// the system temp directory)
+func RuntimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, appName)
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", appName, os.Getuid()))
+}
+
+// xdgDir resolves an XDG base directory variable, falling back to a path
+// under the home directory
+func xdgDir(env, fallback string) (string, error) {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return filepath.Join(dir, appName), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine home directory: %w", err)
+	}
+	return filepath.Join(home, fallback, appName), nil
+}
+
+// PicturesDir returns the user's pictures directory: $XDG_PICTURES_DIR,
+// the XDG_PICTURES_DIR entry of ~/.config/user-dirs.dirs (localized on
+// many desktops), or ~/Pictures
+func PicturesDir() (string, error) {
+	if dir := os.Getenv("XDG_PICTURES_DIR"); filepath.IsAbs(dir) {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine home directory: %w", err)
+	}
+
+	configDir, err := os.UserConfigDir()
+	if err == nil {
+		if data, err := os.ReadFile(filepath.Join(configDir, "user-dirs.dirs")); err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				value, ok := strings.CutPrefix(strings.TrimSpace(line), "XDG_PICTURES_DIR=")
+				if !ok {
+					continue
+				}
+				value = strings.Trim(value, `"`)
+				if rest, ok := strings.CutPrefix(value, "$HOME"); ok {
+					value = home + rest
+				}
+				if filepath.IsAbs(value) && filepath.Clean(value) != filepath.Clean(home) {
+					return value, nil
+				}
+			}
+		}
+	}
+	return filepath.Join(home, "Pictures"), nil
+}
+
+// ExpandHome replaces a leading ~/ with the home directory
+func ExpandHome(path string) (string, error) {
+	rest, ok := strings.CutPrefix(path, "~/")
+	if !ok && path != "~" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine home directory: %w", err)
+	}
+	return filepath.Join(home, rest), nil
+}
@@ -0,0 +1,103 @@
+//go:build !noportal && !minimal
+
+package portal
+
+import (
+	"context"
+	"fmt"
+	"image"
+	_ "image/png"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	portalName = "org.freedesktop.portal.Desktop"
+	portalPath = "/org/freedesktop/portal/desktop"
+
+	// responseTimeout bounds the wait for the portal, which may be
+	// showing a permission dialog
+	responseTimeout = 30 * time.Second
+)
+
+func init() {
+	screenshot = portalScreenshot
+}
+
+// portalScreenshot calls Screenshot.Screenshot and loads the file the
+// portal writes, removing it after
+func portalScreenshot() (image.Image, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the session bus: %w", err)
+	}
+	defer conn.Close()
+
+	// Subscribe to the request's Response before making it, so a fast
+	// portal can't answer first
+	token := "screenshot" + strconv.Itoa(os.Getpid())
+	sender := strings.ReplaceAll(strings.TrimPrefix(conn.Names()[0], ":"), ".", "_")
+	request := dbus.ObjectPath(portalPath + "/request/" + sender + "/" + token)
+	if err := conn.AddMatchSignal(dbus.WithMatchObjectPath(request),
+		dbus.WithMatchInterface("org.freedesktop.portal.Request"), dbus.WithMatchMember("Response")); err != nil {
+		return nil, fmt.Errorf("failed to watch the portal request: %w", err)
+	}
+	signals := make(chan *dbus.Signal, 1)
+	conn.Signal(signals)
+
+	ctx, cancel := context.WithTimeout(context.Background(), responseTimeout)
+	defer cancel()
+	opts := map[string]dbus.Variant{
+		"handle_token": dbus.MakeVariant(token),
+		"interactive":  dbus.MakeVariant(false),
+	}
+	var handle dbus.ObjectPath
+	err = conn.Object(portalName, portalPath).
+		CallWithContext(ctx, "org.freedesktop.portal.Screenshot.Screenshot", 0, "", opts).Store(&handle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call the screenshot portal (is xdg-desktop-portal running?): %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("the screenshot portal did not answer in %v", responseTimeout)
+		case sig := <-signals:
+			if sig.Path != handle || len(sig.Body) < 2 {
+				continue
+			}
+			return loadResponse(sig.Body)
+		}
+	}
+}
+
+// loadResponse reads a Response signal: a code, 0 on success, and the
+// results with the screenshot's uri
+func loadResponse(body []interface{}) (image.Image, error) {
+	if code, _ := body[0].(uint32); code != 0 {
+		return nil, fmt.Errorf("the screenshot portal refused (response %d)", code)
+	}
+	results, _ := body[1].(map[string]dbus.Variant)
+	uri, _ := results["uri"].Value().(string)
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return nil, fmt.Errorf("the screenshot portal returned no file (%q)", uri)
+	}
+	defer os.Remove(u.Path)
+
+	f, err := os.Open(u.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the portal's screenshot: %w", err)
+	}
+	return img, nil
+}
@@ -0,0 +1,36 @@
+// Package portal captures the screen through the XDG desktop portal, which
+// asks the compositor for the picture. The compositor can include what
+// plain screen grabs miss, like video on hardware overlay planes.
+package portal
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+// screenshot asks the portal for a picture of the whole screen; nil when
+// built with the noportal tag
+var screenshot func() (image.Image, error)
+
+// Screenshot returns area of the screen, in desktop coordinates, as the
+// portal sees it. The portal may ask the user for permission the first
+// time.
+func Screenshot(area image.Rectangle) (image.Image, error) {
+	if screenshot == nil {
+		return nil, errors.New("the desktop portal is not compiled into this binary (built with -tags noportal or minimal)")
+	}
+	img, err := screenshot()
+	if err != nil {
+		return nil, err
+	}
+	if !area.In(img.Bounds()) {
+		return nil, fmt.Errorf("the portal's %dx%d screenshot does not cover %v", img.Bounds().Dx(), img.Bounds().Dy(), area)
+	}
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(area), nil
+	}
+	return nil, fmt.Errorf("unsupported portal screenshot type %T", img)
+}
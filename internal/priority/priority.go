@@ -0,0 +1,13 @@
+// Package priority lowers the process priority so background captures
+// don't compete with foreground applications
+package priority
+
+import "runtime"
+
+// Lower sets the lowest CPU and idle IO scheduling priority where the
+// platform supports it, and limits Go code (including image encoding) to
+// a single thread
+func Lower() error {
+	runtime.GOMAXPROCS(1)
+	return lower()
+}
@@ -0,0 +1,47 @@
+//go:build linux
+
+package priority
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+const (
+	// niceLowest is the lowest CPU scheduling priority
+	niceLowest = 19
+
+	// ioprioIdle is IOPRIO_CLASS_IDLE: disk access only when nobody else
+	// needs the disk
+	ioprioIdle = 3 << 13
+
+	// ioprioWhoProcess targets a single thread ID with ioprio_set
+	ioprioWhoProcess = 1
+)
+
+// lower applies the priorities to every thread. On Linux both settings
+// are per thread, and threads started later inherit them from their
+// creator.
+func lower() error {
+	tids := []int{0}
+	if entries, err := os.ReadDir("/proc/self/task"); err == nil {
+		tids = tids[:0]
+		for _, e := range entries {
+			if tid, err := strconv.Atoi(e.Name()); err == nil {
+				tids = append(tids, tid)
+			}
+		}
+	}
+
+	for _, tid := range tids {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, niceLowest); err != nil {
+			return fmt.Errorf("failed to lower CPU priority: %w", err)
+		}
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), ioprioIdle); errno != 0 {
+			return fmt.Errorf("failed to lower IO priority: %w", errno)
+		}
+	}
+	return nil
+}
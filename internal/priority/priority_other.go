@@ -0,0 +1,8 @@
+//go:build !linux
+
+package priority
+
+// lower is a no-op: only the thread limit applies on this platform
+func lower() error {
+	return nil
+}
@@ -0,0 +1,320 @@
+// Package review keeps named baseline images and compares new captures
+// against them, for visual regression checks in CI: a capture that
+// differs is kept with a highlight and a before/after page until it is
+// approved as the new baseline
+package review
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robotin/screenshot/internal/diff"
+)
+
+// Statuses of a comparison
+const (
+	// StatusNew means there was no baseline yet; approve the capture to
+	// make it one
+	StatusNew = "new"
+
+	// StatusMatch means the capture matches the baseline
+	StatusMatch = "match"
+
+	// StatusChanged means the capture differs from the baseline
+	StatusChanged = "changed"
+
+	// StatusApproved means the capture was made the baseline
+	StatusApproved = "approved"
+)
+
+// Files of a baseline's directory
+const (
+	BaselineFile  = "baseline.png"
+	CandidateFile = "candidate.png"
+	DiffFile      = "diff.png"
+	ReportFile    = "report.html"
+	resultFile    = "result.json"
+)
+
+// ErrNotFound is returned for names without a baseline or capture
+var ErrNotFound = errors.New("not found")
+
+var nameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// Options control when a capture still matches its baseline
+type Options struct {
+	// Threshold is the largest per-channel difference (0-255) still
+	// considered equal
+	Threshold uint8
+
+	// Tolerance is the fraction of pixels (0-1) allowed to change
+	Tolerance float64
+}
+
+// Result is the outcome of the latest comparison for a name
+type Result struct {
+	Name   string       `json:"name"`
+	Status string       `json:"status"`
+	Time   time.Time    `json:"time"`
+	Diff   *diff.Result `json:"diff,omitempty"`
+
+	// Error explains a comparison that could not be made, e.g. the
+	// capture's size differs from the baseline's
+	Error string `json:"error,omitempty"`
+
+	// Files lists the artifacts kept for the name (baseline.png,
+	// candidate.png, diff.png, report.html)
+	Files []string `json:"files"`
+}
+
+// Store keeps baselines in a directory, one subdirectory per name
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// Open opens a store, creating its directory if needed
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create diff store: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// ValidName reports whether name can name a baseline: letters, digits,
+// dots, dashes and underscores, starting with a letter or digit
+func ValidName(name string) bool {
+	return nameRe.MatchString(name)
+}
+
+// Submit compares a capture against the baseline called name and keeps
+// it as the candidate, with a highlight and report when it differs
+func (s *Store) Submit(name string, img image.Image, opts Options) (*Result, error) {
+	if !ValidName(name) {
+		return nil, fmt.Errorf("invalid name %q", name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := filepath.Join(s.dir, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	for _, f := range []string{DiffFile, ReportFile} {
+		if err := os.Remove(filepath.Join(dir, f)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	if err := writePNG(filepath.Join(dir, CandidateFile), img); err != nil {
+		return nil, err
+	}
+
+	res := &Result{Name: name, Time: time.Now().UTC()}
+	baseline, err := readImage(filepath.Join(dir, BaselineFile))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		res.Status = StatusNew
+	case err != nil:
+		return nil, err
+	default:
+		if err := s.compare(dir, res, baseline, img, opts); err != nil {
+			return nil, err
+		}
+	}
+	return res, s.save(dir, res)
+}
+
+// compare fills in the result of comparing img to the baseline, writing
+// the artifacts if they differ
+func (s *Store) compare(dir string, res *Result, baseline, img image.Image, opts Options) error {
+	d, err := diff.Compare(baseline, img, diff.Options{Threshold: opts.Threshold})
+	if err != nil {
+		// A different size is a change, not a failure
+		res.Status, res.Error = StatusChanged, err.Error()
+		return nil
+	}
+	res.Diff = d
+	if d.Changed == 0 || d.Ratio <= opts.Tolerance {
+		res.Status = StatusMatch
+		return nil
+	}
+
+	res.Status = StatusChanged
+	if err := writePNG(filepath.Join(dir, DiffFile), diff.Highlight(img, d, color.RGBA{0xff, 0, 0, 0xff})); err != nil {
+		return err
+	}
+	f, err := os.Create(filepath.Join(dir, ReportFile))
+	if err != nil {
+		return fmt.Errorf("failed to create report: %w", err)
+	}
+	err = diff.WriteSliderHTML(f, diff.SliderPage{
+		Title:      res.Name,
+		Summary:    fmt.Sprintf("%d pixels changed (%.2f%%)", d.Changed, d.Ratio*100),
+		BeforeName: "baseline",
+		AfterName:  "candidate",
+		Before:     baseline,
+		After:      img,
+	})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// Approve makes the latest capture for name its baseline
+func (s *Store) Approve(name string) (*Result, error) {
+	if !ValidName(name) {
+		return nil, fmt.Errorf("invalid name %q", name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := filepath.Join(s.dir, name)
+	err := os.Rename(filepath.Join(dir, CandidateFile), filepath.Join(dir, BaselineFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no capture to approve for %s: %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to approve %s: %w", name, err)
+	}
+	for _, f := range []string{DiffFile, ReportFile} {
+		os.Remove(filepath.Join(dir, f))
+	}
+
+	res := &Result{Name: name, Status: StatusApproved, Time: time.Now().UTC()}
+	return res, s.save(dir, res)
+}
+
+// Result returns the latest result for name
+func (s *Store) Result(name string) (*Result, error) {
+	if !ValidName(name) {
+		return nil, fmt.Errorf("invalid name %q", name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(filepath.Join(s.dir, name))
+}
+
+// List returns the latest result of every name, sorted by name
+func (s *Store) List() ([]*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read diff store: %w", err)
+	}
+	var results []*Result
+	for _, e := range entries {
+		if !e.IsDir() || !ValidName(e.Name()) {
+			continue
+		}
+		res, err := s.load(filepath.Join(s.dir, e.Name()))
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results, nil
+}
+
+// File returns the path of one of a name's artifacts
+func (s *Store) File(name, file string) (string, error) {
+	if !ValidName(name) {
+		return "", fmt.Errorf("invalid name %q", name)
+	}
+	switch file {
+	case BaselineFile, CandidateFile, DiffFile, ReportFile:
+	default:
+		return "", fmt.Errorf("unknown file %q: %w", file, ErrNotFound)
+	}
+	path := filepath.Join(s.dir, name, file)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("%s/%s: %w", name, file, ErrNotFound)
+	}
+	return path, nil
+}
+
+// save writes the result, listing the files present; mu must be held
+func (s *Store) save(dir string, res *Result) error {
+	res.Files = nil
+	for _, f := range []string{BaselineFile, CandidateFile, DiffFile, ReportFile} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err == nil {
+			res.Files = append(res.Files, f)
+		}
+	}
+	data, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, resultFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to save result: %w", err)
+	}
+	return nil
+}
+
+// load reads a saved result; mu must be held
+func (s *Store) load(dir string) (*Result, error) {
+	data, err := os.ReadFile(filepath.Join(dir, resultFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(dir), ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var res Result
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, fmt.Errorf("invalid result for %s: %w", filepath.Base(dir), err)
+	}
+	return &res, nil
+}
+
+// readImage decodes an image file
+func readImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return img, nil
+}
+
+// writePNG saves an image as PNG, replacing the file atomically so
+// readers never see half of it
+func writePNG(path string, img image.Image) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*.png")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := png.Encode(tmp, img); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
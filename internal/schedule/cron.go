@@ -0,0 +1,210 @@
+package schedule
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timetable is when periodic captures are due: a Schedule or a Cron
+type Timetable interface {
+	// Next returns the first capture time at or after t, or the zero
+	// time if there is none
+	Next(t time.Time) time.Time
+
+	String() string
+}
+
+// Cron is a standard five-field cron expression: minute, hour, day of
+// month, month, day of week
+type Cron struct {
+	spec string
+
+	minute, hour, dom, month, dow uint64
+
+	// domAny and dowAny are set when the field starts with "*". As in
+	// Vixie cron, when both day fields are restricted a day matching
+	// either one is due.
+	domAny, dowAny bool
+
+	Location *time.Location
+}
+
+// cronHorizon bounds the search for the next capture: Feb 29 on a given
+// weekday comes round within 28 years
+const cronHorizon = 366 * 28
+
+var (
+	monthNames = []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+
+	cronMacros = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+)
+
+// ParseCron parses a cron expression ("*/10 9-18 * * 1-5") in loc.
+// Fields take *, numbers, ranges (a-b), steps (*/n, a-b/n, a/n), lists
+// and month and weekday names; Sunday is 0 or 7. @hourly, @daily,
+// @weekly, @monthly and @yearly are accepted, and a CRON_TZ=Zone prefix
+// overrides loc.
+func ParseCron(spec string, loc *time.Location) (*Cron, error) {
+	spec = strings.TrimSpace(spec)
+	expr := spec
+	if tz, rest, ok := strings.Cut(expr, " "); ok && strings.HasPrefix(tz, "CRON_TZ=") {
+		var err error
+		if loc, err = time.LoadLocation(strings.TrimPrefix(tz, "CRON_TZ=")); err != nil {
+			return nil, fmt.Errorf("invalid cron time zone: %w", err)
+		}
+		expr = strings.TrimSpace(rest)
+	}
+	c := &Cron{spec: expr, Location: loc}
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields (minute hour day month weekday), got %d", spec, len(fields))
+	}
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("invalid cron minute: %w", err)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("invalid cron hour: %w", err)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("invalid cron day of month: %w", err)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("invalid cron month: %w", err)
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7, dayNames); err != nil {
+		return nil, fmt.Errorf("invalid cron weekday: %w", err)
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny = strings.HasPrefix(fields[2], "*")
+	c.dowAny = strings.HasPrefix(fields[4], "*")
+	return c, nil
+}
+
+// parseCronField parses one field into a bit set of the values it
+// matches. names, if given, are accepted for the values they index.
+func parseCronField(field string, lo, hi int, names []string) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", item)
+			}
+		}
+
+		from, to := lo, hi
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if from, err = parseCronValue(a, lo, hi, names); err != nil {
+				return 0, err
+			}
+			// a alone is one value; a/n runs from a to the end
+			switch {
+			case isRange:
+				if to, err = parseCronValue(b, lo, hi, names); err != nil {
+					return 0, err
+				}
+				if to < from {
+					return 0, fmt.Errorf("invalid range %q", rng)
+				}
+			case !hasStep:
+				to = from
+			}
+		}
+		for v := from; v <= to; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// parseCronValue parses a number in [lo, hi], or a name
+func parseCronValue(s string, lo, hi int, names []string) (int, error) {
+	for i, name := range names {
+		if name != "" && strings.EqualFold(s, name) {
+			return i, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < lo || n > hi {
+		return 0, fmt.Errorf("%q is not a number from %d to %d", s, lo, hi)
+	}
+	return n, nil
+}
+
+// Next returns the first minute at or after t the expression matches,
+// or the zero time if there is none (Feb 30). Local times skipped by a
+// DST change never match; repeated ones match once.
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.In(c.Location)
+	if t.Second() != 0 || t.Nanosecond() != 0 {
+		t = t.Truncate(time.Minute).Add(time.Minute)
+	}
+
+	y, m, d := t.Date()
+	for i := 0; i < cronHorizon; i++ {
+		date := time.Date(y, m, d+i, 0, 0, 0, 0, c.Location)
+		if !c.dayMatches(date) {
+			continue
+		}
+		dy, dm, dd := date.Date()
+		for h := 0; h < 24; h++ {
+			if c.hour&(1<<h) == 0 {
+				continue
+			}
+			for mi := bits.TrailingZeros64(c.minute); mi < 60; mi++ {
+				if c.minute&(1<<mi) == 0 {
+					continue
+				}
+				at := time.Date(dy, dm, dd, h, mi, 0, 0, c.Location)
+				if at.Hour() != h || at.Minute() != mi {
+					// Skipped by a DST change
+					continue
+				}
+				if !at.Before(t) {
+					return at
+				}
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches reports whether the expression's day fields match date
+func (c *Cron) dayMatches(date time.Time) bool {
+	if c.month&(1<<int(date.Month())) == 0 {
+		return false
+	}
+	dom := c.dom&(1<<date.Day()) != 0
+	dow := c.dow&(1<<int(date.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// String describes the expression, e.g. `cron "*/10 9-18 * * 1-5" (UTC)`
+func (c *Cron) String() string {
+	return fmt.Sprintf("cron %q (%s)", c.spec, c.Location)
+}
@@ -0,0 +1,269 @@
+// Package schedule works out when periodic captures are due: every so
+// often, within time windows on given days (e.g. every 5m, Mon-Fri
+// 09:00-18:00), in a time zone
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Window is a daily time window on some days of the week
+type Window struct {
+	// Days are the weekdays the window starts on, indexed by
+	// time.Weekday
+	Days [7]bool
+
+	// Start and End are times of day; an End at or before Start is on
+	// the next day (22:00-06:00). 00:00-24:00 is the whole day.
+	Start, End Clock
+}
+
+// Clock is a time of day
+type Clock struct {
+	Hour, Minute int
+}
+
+func (c Clock) String() string {
+	return fmt.Sprintf("%02d:%02d", c.Hour, c.Minute)
+}
+
+// on returns the clock time on a date in loc. Times skipped by a DST
+// change fall after it, as time.Date normalizes them.
+func (c Clock) on(year int, month time.Month, day int, loc *time.Location) time.Time {
+	return time.Date(year, month, day, c.Hour, c.Minute, 0, 0, loc)
+}
+
+// Schedule is when captures are due
+type Schedule struct {
+	// Every is the time between captures within a window; they are
+	// aligned to the window's start
+	Every time.Duration
+
+	// Windows are when captures happen; none means all day, every day
+	Windows []Window
+
+	// Skip lists dates (in Location) on which no window starts, e.g.
+	// public holidays, as "2006-01-02"
+	Skip map[string]bool
+
+	Location *time.Location
+}
+
+// allDay is the window of a schedule without windows
+var allDay = Window{
+	Days: [7]bool{true, true, true, true, true, true, true},
+	End:  Clock{24, 0},
+}
+
+// horizon bounds the search for the next capture
+const horizon = 400
+
+// Next returns the first capture time at or after t, or the zero time if
+// there is none within a year (all days skipped)
+func (s *Schedule) Next(t time.Time) time.Time {
+	windows := s.Windows
+	if len(windows) == 0 {
+		windows = []Window{allDay}
+	}
+	t = t.In(s.Location)
+
+	// Start a day early: yesterday's window may run past midnight
+	var best time.Time
+	y, m, d := t.Date()
+	for i := -1; i < horizon; i++ {
+		date := time.Date(y, m, d+i, 0, 0, 0, 0, s.Location)
+		if !best.IsZero() && !best.After(date) {
+			// Windows starting on this day or later can't be earlier
+			return best
+		}
+		if s.Skip[date.Format(time.DateOnly)] {
+			continue
+		}
+		for _, w := range windows {
+			if !w.Days[date.Weekday()] {
+				continue
+			}
+			if at := s.nextIn(w, date, t); !at.IsZero() && (best.IsZero() || at.Before(best)) {
+				best = at
+			}
+		}
+	}
+	return best
+}
+
+// bounds returns when a window starting on date begins and ends
+func (s *Schedule) bounds(w Window, date time.Time) (start, end time.Time) {
+	y, m, d := date.Date()
+	start = w.Start.on(y, m, d, s.Location)
+	end = w.End.on(y, m, d, s.Location)
+	if !end.After(start) {
+		end = w.End.on(y, m, d+1, s.Location)
+	}
+	return start, end
+}
+
+// nextIn returns the first capture at or after t in a window starting on
+// date, or the zero time if the window is over by then
+func (s *Schedule) nextIn(w Window, date time.Time, t time.Time) time.Time {
+	start, end := s.bounds(w, date)
+	at := start
+	if t.After(start) {
+		steps := (t.Sub(start) + s.Every - 1) / s.Every
+		at = start.Add(steps * s.Every)
+	}
+	if !at.Before(end) {
+		return time.Time{}
+	}
+	return at
+}
+
+// Active reports whether t is within one of the windows
+func (s *Schedule) Active(t time.Time) bool {
+	if len(s.Windows) == 0 {
+		return true
+	}
+	t = t.In(s.Location)
+	y, m, d := t.Date()
+	for i := -1; i <= 0; i++ {
+		date := time.Date(y, m, d+i, 0, 0, 0, 0, s.Location)
+		if s.Skip[date.Format(time.DateOnly)] {
+			continue
+		}
+		for _, w := range s.Windows {
+			if !w.Days[date.Weekday()] {
+				continue
+			}
+			if start, end := s.bounds(w, date); !t.Before(start) && t.Before(end) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// String describes the schedule, e.g. "every 5m Mon-Fri 09:00-18:00
+// (Europe/Madrid)"
+func (s *Schedule) String() string {
+	parts := []string{"every " + s.Every.String()}
+	for _, w := range s.Windows {
+		parts = append(parts, formatDays(w.Days)+" "+w.Start.String()+"-"+w.End.String())
+	}
+	if len(s.Windows) > 0 {
+		parts[len(parts)-1] += " (" + s.Location.String() + ")"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatDays describes weekdays as ranges from Monday, e.g. "Mon-Fri"
+func formatDays(days [7]bool) string {
+	if days == [7]bool{true, true, true, true, true, true, true} {
+		return "daily"
+	}
+	var ranges []string
+	for i := 0; i < 7; {
+		// Monday first
+		if !days[(i+1)%7] {
+			i++
+			continue
+		}
+		j := i
+		for j+1 < 7 && days[(j+2)%7] {
+			j++
+		}
+		r := time.Weekday((i + 1) % 7).String()[:3]
+		if j > i {
+			r += "-" + time.Weekday((j + 1) % 7).String()[:3]
+		}
+		ranges = append(ranges, r)
+		i = j + 1
+	}
+	return strings.Join(ranges, ",")
+}
+
+var dayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseDays parses weekdays: names or ranges separated by commas
+// ("mon-fri", "sat,sun", "mon-wed,fri"); ranges may wrap ("fri-mon").
+// Empty, "daily" and "every day" mean all days.
+func ParseDays(s string) ([7]bool, error) {
+	var days [7]bool
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" || s == "daily" || s == "every day" {
+		for i := range days {
+			days[i] = true
+		}
+		return days, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		a, err := parseDay(from)
+		if err != nil {
+			return days, err
+		}
+		b := a
+		if isRange {
+			if b, err = parseDay(to); err != nil {
+				return days, err
+			}
+		}
+		for i := a; ; i = (i + 1) % 7 {
+			days[i] = true
+			if i == b {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseDay parses a weekday name, or its first three letters
+func parseDay(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if len(s) >= 3 {
+		for i, name := range dayNames {
+			if strings.HasPrefix(s, name) && strings.HasPrefix(strings.ToLower(time.Weekday(i).String()), s) {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unknown day %q (expected mon, tue, ..., sun)", s)
+}
+
+// ParseHours parses a time window "HH:MM-HH:MM". Empty is the whole day.
+func ParseHours(s string) (start, end Clock, err error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Clock{}, Clock{24, 0}, nil
+	}
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return start, end, fmt.Errorf("invalid hours %q (expected HH:MM-HH:MM)", s)
+	}
+	if start, err = parseClock(from); err != nil {
+		return start, end, err
+	}
+	if start.Hour == 24 {
+		return start, end, fmt.Errorf("invalid hours %q: 24:00 can only end a window", s)
+	}
+	if end, err = parseClock(to); err != nil {
+		return start, end, err
+	}
+	if start == end {
+		return start, end, fmt.Errorf("invalid hours %q: the window is empty", s)
+	}
+	return start, end, nil
+}
+
+// parseClock parses HH:MM; 24:00 is the end of the day
+func parseClock(s string) (Clock, error) {
+	h, m, ok := strings.Cut(strings.TrimSpace(s), ":")
+	hour, err1 := strconv.Atoi(h)
+	minute, err2 := strconv.Atoi(m)
+	if !ok || err1 != nil || err2 != nil || hour < 0 || minute < 0 || minute > 59 || hour > 24 || (hour == 24 && minute != 0) {
+		return Clock{}, fmt.Errorf("invalid time %q (expected HH:MM)", s)
+	}
+	return Clock{hour, minute}, nil
+}
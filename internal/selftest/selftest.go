@@ -0,0 +1,138 @@
+// Package selftest draws a known test pattern and checks a capture of it,
+// to catch color order, depth and offset problems in the capture pipeline
+package selftest
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Pattern layout: a grid of solid blocks, each a different color
+const (
+	blockSize = 32
+	columns   = 8
+	rows      = 4
+
+	// margin is left out around each block when checking it, so
+	// resampling, JPEG blocks and window shadows at the edges don't count
+	margin = 4
+)
+
+// colors are the blocks' colors, row by row: primaries, secondaries,
+// grays and mid tones, none repeated, so a swapped channel, a shifted
+// capture or a flipped one can't match
+var colors = [rows * columns]color.RGBA{
+	{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}, {0, 255, 255, 255},
+	{255, 0, 255, 255}, {255, 255, 0, 255}, {255, 255, 255, 255}, {0, 0, 0, 255},
+	{128, 0, 0, 255}, {0, 128, 0, 255}, {0, 0, 128, 255}, {0, 128, 128, 255},
+	{128, 0, 128, 255}, {128, 128, 0, 255}, {128, 128, 128, 255}, {64, 64, 64, 255},
+	{255, 128, 0, 255}, {255, 0, 128, 255}, {128, 255, 0, 255}, {0, 255, 128, 255},
+	{128, 0, 255, 255}, {0, 128, 255, 255}, {192, 192, 192, 255}, {32, 32, 32, 255},
+	{255, 128, 128, 255}, {128, 255, 128, 255}, {128, 128, 255, 255}, {255, 255, 128, 255},
+	{255, 128, 255, 255}, {128, 255, 255, 255}, {224, 96, 32, 255}, {32, 96, 224, 255},
+}
+
+// Pattern returns the test pattern
+func Pattern() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, columns*blockSize, rows*blockSize))
+	for i, c := range colors {
+		draw.Draw(img, block(i), &image.Uniform{C: c}, image.Point{}, draw.Src)
+	}
+	return img
+}
+
+// block returns the area of block i in the pattern
+func block(i int) image.Rectangle {
+	x, y := i%columns*blockSize, i/columns*blockSize
+	return image.Rect(x, y, x+blockSize, y+blockSize)
+}
+
+// Result describes how a capture of the pattern differs from it
+type Result struct {
+	// Blocks is the number of blocks and Mismatched how many of them have
+	// a pixel further than the tolerance from the block's color
+	Blocks     int `json:"blocks"`
+	Mismatched int `json:"mismatched"`
+
+	// MaxDiff is the largest channel difference found
+	MaxDiff int `json:"max_diff"`
+
+	// First describes the first mismatch
+	First string `json:"first,omitempty"`
+
+	// Diagnosis names the likely cause of a failure
+	Diagnosis string `json:"diagnosis,omitempty"`
+}
+
+// OK reports whether every block matched
+func (r Result) OK() bool {
+	return r.Mismatched == 0
+}
+
+// Verify compares a capture of the pattern with it, allowing channels to
+// differ by up to tolerance (for 16 bit displays and lossy encoders)
+func Verify(img image.Image, tolerance int) Result {
+	want := Pattern().Bounds().Size()
+	if got := img.Bounds().Size(); got != want {
+		return Result{
+			Blocks:     len(colors),
+			Mismatched: len(colors),
+			First:      fmt.Sprintf("capture is %dx%d, the pattern %dx%d", got.X, got.Y, want.X, want.Y),
+			Diagnosis:  "the capture was scaled or cropped (DPI normalization or a scaled monitor?)",
+		}
+	}
+
+	res := compare(img, tolerance, false)
+	if res.OK() {
+		return res
+	}
+	switch {
+	case compare(img, tolerance, true).OK():
+		res.Diagnosis = "red and blue are swapped: the display is BGR but the backend didn't detect it (try --swap-rb on)"
+	case res.Mismatched > res.Blocks/2:
+		res.Diagnosis = "the pattern window isn't in the capture: the backend sees a different screen, " +
+			"or a compositor or Wayland hides override-redirect X11 windows"
+	default:
+		res.Diagnosis = "colors are off: check the display depth, color management or exclusion zones"
+	}
+	return res
+}
+
+// compare checks each block's inner area, optionally with red and blue
+// swapped
+func compare(img image.Image, tolerance int, swapRB bool) Result {
+	res := Result{Blocks: len(colors)}
+	origin := img.Bounds().Min
+	for i, want := range colors {
+		r := block(i).Inset(margin)
+		bad := false
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				got := color.RGBAModel.Convert(img.At(origin.X+x, origin.Y+y)).(color.RGBA)
+				if swapRB {
+					got.R, got.B = got.B, got.R
+				}
+				d := max(diff(got.R, want.R), diff(got.G, want.G), diff(got.B, want.B))
+				res.MaxDiff = max(res.MaxDiff, d)
+				if d > tolerance && !bad {
+					bad = true
+					res.Mismatched++
+					if res.First == "" {
+						res.First = fmt.Sprintf("block %d at %d,%d: got #%02x%02x%02x, want #%02x%02x%02x",
+							i, x, y, got.R, got.G, got.B, want.R, want.G, want.B)
+					}
+				}
+			}
+		}
+	}
+	return res
+}
+
+func diff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// frameCache coalesces identical capture requests. A request joins an
+// in-flight capture with the same key, or reuses its encoded bytes if it
+// finished less than ttl ago, so many dashboard tiles polling the same
+// view cost a single grab and encode.
+type frameCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+// cacheEntry is one shared capture result
+type cacheEntry struct {
+	done     chan struct{}
+	data     []byte
+	err      error
+	finished time.Time
+}
+
+// newFrameCache creates a cache; a non-positive ttl disables coalescing
+func newFrameCache(ttl time.Duration) *frameCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &frameCache{ttl: ttl, entries: map[string]*cacheEntry{}}
+}
+
+// get returns the bytes for key, calling produce only if no usable entry
+// exists. shared reports whether the result came from another request.
+func (c *frameCache) get(key string, produce func() ([]byte, error)) (data []byte, shared bool, err error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	c.prune(now)
+	if e, ok := c.entries[key]; ok {
+		c.mu.Unlock()
+		<-e.done
+		return e.data, true, e.err
+	}
+
+	e := &cacheEntry{done: make(chan struct{})}
+	c.entries[key] = e
+	c.mu.Unlock()
+
+	e.data, e.err = produce()
+
+	c.mu.Lock()
+	e.finished = time.Now()
+	if e.err != nil {
+		// Don't serve failures to later requests
+		delete(c.entries, key)
+	}
+	c.mu.Unlock()
+	close(e.done)
+
+	return e.data, false, e.err
+}
+
+// wipe zeroes and drops every finished entry
+func (c *frameCache) wipe() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, e := range c.entries {
+		if !e.finished.IsZero() {
+			clear(e.data)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// prune drops finished entries older than the ttl. Must be called with
+// the lock held.
+func (c *frameCache) prune(now time.Time) {
+	for key, e := range c.entries {
+		if !e.finished.IsZero() && now.Sub(e.finished) > c.ttl {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// errQueueFull is returned when the capture queue has no free slot
+var errQueueFull = errors.New("capture queue full")
+
+// rateLimiter enforces a per-client token bucket
+type rateLimiter struct {
+	rate  float64 // tokens per second
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+// bucket is one client's token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter creates a limiter; a non-positive rate disables limiting
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: rate, burst: float64(burst), buckets: map[string]*bucket{}}
+}
+
+// allow takes a token for client. When none is available it returns false
+// and how long until the next token.
+func (l *rateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// prune drops buckets of clients that have been idle long enough to be
+// full again, keeping memory bounded
+func (l *rateLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < time.Minute {
+		return
+	}
+	l.lastPrune = now
+
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for client, b := range l.buckets {
+		if now.Sub(b.last) > full {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// captureQueue bounds concurrent captures and the number of requests
+// waiting for a slot
+type captureQueue struct {
+	slots   chan struct{}
+	waiting chan struct{}
+	timeout time.Duration
+}
+
+// newCaptureQueue creates a queue running at most concurrency captures
+// with up to size requests waiting
+func newCaptureQueue(concurrency, size int, timeout time.Duration) *captureQueue {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if size < 0 {
+		size = 0
+	}
+	return &captureQueue{
+		slots:   make(chan struct{}, concurrency),
+		waiting: make(chan struct{}, concurrency+size),
+		timeout: timeout,
+	}
+}
+
+// acquire waits for a capture slot. It fails immediately when the queue is
+// full, and after the queue timeout or request cancellation otherwise.
+// The returned function releases the slot.
+func (q *captureQueue) acquire(ctx context.Context) (func(), error) {
+	select {
+	case q.waiting <- struct{}{}:
+	default:
+		return nil, errQueueFull
+	}
+
+	if q.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.timeout)
+		defer cancel()
+	}
+
+	select {
+	case q.slots <- struct{}{}:
+		return func() {
+			<-q.slots
+			<-q.waiting
+		}, nil
+	case <-ctx.Done():
+		<-q.waiting
+		return nil, ctx.Err()
+	}
+}
+
+// limit wraps a capture handler with the per-client rate limit. The
+// capture queue is entered later, only by requests that actually capture.
+func (s *Server) limit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.limiter != nil {
+			if ok, wait := s.limiter.allow(clientID(r), time.Now()); !ok {
+				secs := int(wait.Seconds()) + 1
+				w.Header().Set("Retry-After", strconv.Itoa(secs))
+				http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+// clientID identifies the client for rate limiting (its IP address)
+func clientID(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
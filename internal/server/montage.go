@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"net/http"
+	"strconv"
+
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// maxMontageParts bounds the regions of one montage request
+const maxMontageParts = 32
+
+// handleMontage captures several regions at once and returns them
+// stacked in one image. It answers /capture requests with more than one
+// region parameter, which share a single grab of the area around them
+// so the parts show the same moment.
+func (s *Server) handleMontage(w http.ResponseWriter, r *http.Request) {
+	opts, enc, err := s.parseCaptureRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	parts, err := parseRegions(r.URL.Query()["region"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var area image.Rectangle
+	for _, p := range parts {
+		area = area.Union(p)
+	}
+	opts.Region = &area
+
+	data, err := s.captureMontage(r, opts, enc, parts)
+	if err != nil {
+		writeCaptureError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType(enc.Format))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(data)
+}
+
+// parseRegions parses the region parameters of a montage
+func parseRegions(values []string) ([]image.Rectangle, error) {
+	if len(values) > maxMontageParts {
+		return nil, fmt.Errorf("too many regions: %d (max %d)", len(values), maxMontageParts)
+	}
+	parts := make([]image.Rectangle, len(values))
+	for i, v := range values {
+		rect, err := strategy.ParseRegion(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid region: %w", err)
+		}
+		parts[i] = *rect
+	}
+	return parts, nil
+}
+
+// captureMontage grabs the area around the parts through the queue and
+// encodes their montage. Montages bypass the coalescing cache, which is
+// keyed by a single region.
+func (s *Server) captureMontage(r *http.Request, opts strategy.CaptureOptions, enc capture.EncodeOptions, parts []image.Rectangle) ([]byte, error) {
+	release, err := s.queue.acquire(r.Context())
+	if err != nil {
+		return nil, &httpError{code: http.StatusServiceUnavailable, err: err}
+	}
+	defer release()
+
+	img, err := s.capture(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := capture.Encode(capture.Montage(img, *opts.Region, parts), &buf, enc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
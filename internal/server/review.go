@@ -0,0 +1,116 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/robotin/screenshot/internal/review"
+)
+
+// maxReviewUpload bounds the size of an uploaded capture
+const maxReviewUpload = 64 << 20
+
+// handleReview serves the visual review endpoints:
+//
+//	GET  /review                  latest result of every baseline
+//	GET  /review/NAME             latest result for NAME
+//	POST /review/NAME             compare the image in the body (PNG or JPEG) to NAME's baseline
+//	POST /review/NAME/approve     make the latest capture NAME's baseline
+//	GET  /review/NAME/FILE        baseline.png, candidate.png, diff.png or report.html
+//
+// Comparisons take threshold (per-channel difference still equal,
+// 0-255) and tolerance (fraction of pixels allowed to change, 0-1).
+func (s *Server) handleReview(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/review"), "/")
+	name, action, _ := strings.Cut(rest, "/")
+
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		results, err := s.config.Review.List()
+		if err != nil {
+			writeReviewError(w, err)
+			return
+		}
+		if results == nil {
+			results = []*review.Result{}
+		}
+		writeJSON(w, http.StatusOK, results)
+	case name == "":
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	case !review.ValidName(name):
+		http.Error(w, fmt.Sprintf("invalid name %q (letters, digits, '.', '-' and '_')", name), http.StatusBadRequest)
+	case action == "" && r.Method == http.MethodGet:
+		res, err := s.config.Review.Result(name)
+		if err != nil {
+			writeReviewError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	case action == "" && r.Method == http.MethodPost:
+		s.submitReview(w, r, name)
+	case action == "approve" && r.Method == http.MethodPost:
+		res, err := s.config.Review.Approve(name)
+		if err != nil {
+			writeReviewError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	case action != "approve" && r.Method == http.MethodGet:
+		path, err := s.config.Review.File(name, action)
+		if err != nil {
+			writeReviewError(w, err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		http.ServeFile(w, r, path)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// submitReview compares an uploaded capture to its baseline
+func (s *Server) submitReview(w http.ResponseWriter, r *http.Request, name string) {
+	var opts review.Options
+	q := r.URL.Query()
+	if v := q.Get("threshold"); v != "" {
+		t, err := strconv.ParseUint(v, 10, 8)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid threshold: %s (expected 0-255)", v), http.StatusBadRequest)
+			return
+		}
+		opts.Threshold = uint8(t)
+	}
+	if v := q.Get("tolerance"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil || t < 0 || t > 1 {
+			http.Error(w, fmt.Sprintf("invalid tolerance: %s (expected 0-1)", v), http.StatusBadRequest)
+			return
+		}
+		opts.Tolerance = t
+	}
+
+	img, _, err := image.Decode(http.MaxBytesReader(w, r.Body, maxReviewUpload))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid image: %v", err), http.StatusBadRequest)
+		return
+	}
+	res, err := s.config.Review.Submit(name, img, opts)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// writeReviewError reports a failed review request
+func writeReviewError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if errors.Is(err, review.ErrNotFound) {
+		code = http.StatusNotFound
+	}
+	http.Error(w, err.Error(), code)
+}
@@ -0,0 +1,730 @@
+// Package server implements the HTTP API used by `screenshot serve`
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/config"
+	"github.com/robotin/screenshot/internal/history"
+	"github.com/robotin/screenshot/internal/review"
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// Config holds server settings. Captures always use $DISPLAY: the X11
+// strategy switches displays by changing the environment, which is not
+// safe with concurrent requests.
+type Config struct {
+	// HealthTimeout bounds the probe grab used by /healthz and /readyz
+	HealthTimeout time.Duration
+
+	// RateLimit is the sustained capture requests per second allowed per
+	// client IP, with bursts up to RateBurst. Zero disables rate limiting.
+	RateLimit float64
+	RateBurst int
+
+	// Concurrency is the maximum number of captures running at once;
+	// up to QueueSize further requests wait at most QueueTimeout for a slot
+	Concurrency  int
+	QueueSize    int
+	QueueTimeout time.Duration
+
+	// CoalesceWindow makes identical capture requests (same monitor,
+	// region, format and compression) arriving within this window share a
+	// single capture and encode. Zero disables coalescing.
+	CoalesceWindow time.Duration
+
+	// Token, if set, is required as "Authorization: Bearer <token>" on all
+	// API endpoints except health checks and share links
+	Token string
+
+	// ShareSecret signs share links (random per process if empty);
+	// ShareTTL is the default and maximum link lifetime
+	ShareSecret []byte
+	ShareTTL    time.Duration
+
+	// PublicURL is the externally visible base URL used in share links
+	// (default: derived from the request Host header)
+	PublicURL string
+
+	// Settings, if set, lets ?monitor= name outputs (HDMI-1) and the
+	// virtual monitors defined in the configuration file
+	Settings *config.Config
+
+	// RecentRegions, if set, lists the areas of recent region and window
+	// captures, newest first, which the web UI outlines on the preview
+	// and snaps selections to
+	RecentRegions func() ([]image.Rectangle, error)
+
+	// History, if set, lists recent captures, newest first, which the
+	// web UI shows with their cached thumbnails
+	History func() ([]history.Entry, error)
+
+	// Windows, if set, lists the visible windows bottom to top, whose
+	// edges the web UI snaps selections to
+	Windows func() ([]Window, error)
+
+	// Review, if set, serves /review: comparing uploaded captures with
+	// named baselines, for visual regression checks in CI
+	Review *review.Store
+}
+
+// Window is an on-screen window
+type Window struct {
+	Title string
+
+	// Bounds is the window's content; Frame adds the window manager's
+	// title bar and borders
+	Bounds image.Rectangle
+	Frame  image.Rectangle
+}
+
+// Server serves captures over HTTP
+type Server struct {
+	capturer *capture.Capturer
+	config   Config
+	mux      *http.ServeMux
+	limiter  *rateLimiter
+	queue    *captureQueue
+	cache    *frameCache
+	shares   *shareStore
+
+	mu    sync.Mutex
+	stats stats
+
+	// probeMu guards lastProbe, the newest probe grab, which health checks
+	// share while it runs and for probeTTL after. stuck is the result
+	// channel of a grab that timed out and hasn't returned yet.
+	probeMu   sync.Mutex
+	lastProbe *probeResult
+	stuck     chan error
+}
+
+// probeTTL is how long a probe result answers further health checks.
+// /healthz and /readyz need no token, so without it anyone could keep
+// the display busy with grabs.
+const probeTTL = 2 * time.Second
+
+// probeResult is one probe grab shared by the health checks
+type probeResult struct {
+	done     chan struct{}
+	status   healthStatus
+	timedOut bool
+	finished time.Time
+}
+
+// stats tracks capture outcomes for self-monitoring
+type stats struct {
+	captures            int
+	failures            int
+	consecutiveFailures int
+	lastSuccess         time.Time
+	lastError           string
+}
+
+// New creates a server using the given capturer
+func New(capturer *capture.Capturer, config Config) (*Server, error) {
+	if config.HealthTimeout <= 0 {
+		config.HealthTimeout = 5 * time.Second
+	}
+	if config.ShareTTL <= 0 {
+		config.ShareTTL = 10 * time.Minute
+	}
+
+	shares, err := newShareStore(config.ShareSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		capturer: capturer,
+		config:   config,
+		mux:      http.NewServeMux(),
+		limiter:  newRateLimiter(config.RateLimit, config.RateBurst),
+		queue:    newCaptureQueue(config.Concurrency, config.QueueSize, config.QueueTimeout),
+		cache:    newFrameCache(config.CoalesceWindow),
+		shares:   shares,
+	}
+
+	s.mux.HandleFunc("/", s.handleIndex)
+	s.mux.HandleFunc("/capture", s.auth(s.limit(s.handleCapture)))
+	s.mux.HandleFunc("/share", s.auth(s.limit(s.handleShare)))
+	s.mux.HandleFunc("/monitors", s.auth(s.handleMonitors))
+	s.mux.HandleFunc("/regions", s.auth(s.handleRegions))
+	s.mux.HandleFunc("/windows", s.auth(s.handleWindows))
+	s.mux.HandleFunc("/history", s.auth(s.handleHistory))
+	s.mux.HandleFunc("/history/thumb", s.auth(s.handleHistoryThumb))
+	if config.Review != nil {
+		s.mux.HandleFunc("/review", s.auth(s.handleReview))
+		s.mux.HandleFunc("/review/", s.auth(s.handleReview))
+	}
+	s.mux.HandleFunc("/s/", s.handleShared)
+	s.mux.HandleFunc("/healthz", s.handleHealthz)
+	s.mux.HandleFunc("/readyz", s.handleReadyz)
+	return s, nil
+}
+
+// auth requires the configured bearer token, if any
+func (s *Server) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.config.Token != "" {
+			got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(got), []byte(s.config.Token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// Wipe zeroes and forgets the captures the server holds in memory: the
+// coalescing cache and unclaimed share links
+func (s *Server) Wipe() {
+	if s.cache != nil {
+		s.cache.wipe()
+	}
+	s.shares.wipe()
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handleCapture captures and returns an image.
+//
+// Query parameters: monitor (index, output name or virtual monitor, default all), region (x,y,w,h),
+// format (png, jpeg, yuv420, nv12), compress (0-3), quality (JPEG 1-100),
+// progressive (JPEG), interlace (PNG) and failure_image (an image of the
+// error if the capture fails). Several regions make a montage.
+func (s *Server) handleCapture(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if len(r.URL.Query()["region"]) > 1 {
+		s.handleMontage(w, r)
+		return
+	}
+
+	opts, enc, err := s.parseCaptureRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data, shared, err := s.captureEncodedShared(r, opts, enc)
+	if err != nil {
+		if q := r.URL.Query().Get("failure_image"); q == "1" || q == "true" {
+			s.writeFailureImage(w, opts, enc, err)
+			return
+		}
+		writeCaptureError(w, err)
+		return
+	}
+
+	cacheStatus := "MISS"
+	if shared {
+		cacheStatus = "HIT"
+	}
+
+	w.Header().Set("Content-Type", contentType(enc.Format))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Capture-Cache", cacheStatus)
+	w.Write(data)
+}
+
+// captureEncoded captures and encodes an image through the queue and the
+// coalescing cache
+func (s *Server) captureEncoded(r *http.Request, opts strategy.CaptureOptions, enc capture.EncodeOptions) ([]byte, error) {
+	data, _, err := s.captureEncodedShared(r, opts, enc)
+	return data, err
+}
+
+// captureEncodedShared is captureEncoded that also reports whether the
+// bytes were shared with another request
+func (s *Server) captureEncodedShared(r *http.Request, opts strategy.CaptureOptions, enc capture.EncodeOptions) ([]byte, bool, error) {
+	produce := func() ([]byte, error) {
+		// Other requests may be waiting on this result, so the first
+		// client disconnecting must not abort it (the queue timeout still applies)
+		release, err := s.queue.acquire(context.WithoutCancel(r.Context()))
+		if err != nil {
+			return nil, &httpError{code: http.StatusServiceUnavailable, err: err}
+		}
+		defer release()
+
+		img, err := s.capture(opts)
+		if err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		if err := capture.Encode(img, &buf, enc); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	if s.cache == nil {
+		data, err := produce()
+		return data, false, err
+	}
+	return s.cache.get(requestKey(opts, enc), produce)
+}
+
+// writeCaptureError reports a failed capture with the right status code
+func writeCaptureError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), captureErrorCode(w, err))
+}
+
+// writeFailureImage reports a failed capture with an image of the error
+// in the requested format, for image tags and dashboards that would
+// otherwise show a broken or stale image. The status code is that of the
+// error, and X-Capture-Error has its text.
+func (s *Server) writeFailureImage(w http.ResponseWriter, opts strategy.CaptureOptions, enc capture.EncodeOptions, err error) {
+	code := captureErrorCode(w, err)
+	var buf bytes.Buffer
+	if eerr := capture.Encode(capture.FailureImage(s.capturer.FailureSize(opts), err, time.Now()), &buf, enc); eerr != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	w.Header().Set("Content-Type", contentType(enc.Format))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Capture-Error", strings.ReplaceAll(err.Error(), "\n", " "))
+	w.WriteHeader(code)
+	w.Write(buf.Bytes())
+}
+
+// captureErrorCode returns the status code for a failed capture, setting
+// Retry-After for errors worth retrying
+func captureErrorCode(w http.ResponseWriter, err error) int {
+	code := http.StatusInternalServerError
+	if he, ok := err.(*httpError); ok {
+		code = he.code
+		retry := 1
+		if he.retryAfter > 0 {
+			retry = int(math.Ceil(he.retryAfter.Seconds()))
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(retry))
+	}
+	return code
+}
+
+// httpError carries a specific status code out of a capture
+type httpError struct {
+	code int
+	err  error
+
+	// retryAfter is sent as Retry-After (default 1s)
+	retryAfter time.Duration
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+// requestKey identifies requests that can share one capture
+func requestKey(opts strategy.CaptureOptions, enc capture.EncodeOptions) string {
+	region := "full"
+	if opts.Region != nil {
+		region = opts.Region.String()
+	}
+	return fmt.Sprintf("%d|%s|%s|%d|%d|%t|%t", opts.Monitor, region, enc.Format, enc.CompressionLevel,
+		enc.Quality, enc.Progressive, enc.Interlace)
+}
+
+// handleMonitors returns the monitor layout as JSON
+func (s *Server) handleMonitors(w http.ResponseWriter, r *http.Request) {
+	monitors, err := s.capturer.ListMonitors()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	type monitorJSON struct {
+		Index   int    `json:"index"`
+		Name    string `json:"name"`
+		X       int    `json:"x"`
+		Y       int    `json:"y"`
+		Width   int    `json:"width"`
+		Height  int    `json:"height"`
+		Primary bool   `json:"primary,omitempty"`
+	}
+
+	out := make([]monitorJSON, len(monitors))
+	for i, m := range monitors {
+		out[i] = monitorJSON{m.Index, m.Name, m.Bounds.Min.X, m.Bounds.Min.Y, m.Bounds.Dx(), m.Bounds.Dy(), m.Primary}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// rectJSON is a screen area in API responses
+type rectJSON struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+func newRectJSON(r image.Rectangle) rectJSON {
+	return rectJSON{r.Min.X, r.Min.Y, r.Dx(), r.Dy()}
+}
+
+// handleRegions returns the recently captured areas as JSON
+func (s *Server) handleRegions(w http.ResponseWriter, r *http.Request) {
+	out := []rectJSON{}
+	if s.config.RecentRegions != nil {
+		regions, err := s.config.RecentRegions()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, r := range regions {
+			out = append(out, newRectJSON(r))
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleWindows returns the visible windows as JSON, bottom to top
+func (s *Server) handleWindows(w http.ResponseWriter, r *http.Request) {
+	type windowJSON struct {
+		Title string `json:"title"`
+		rectJSON
+		Frame rectJSON `json:"frame"`
+	}
+
+	out := []windowJSON{}
+	if s.config.Windows != nil {
+		windows, err := s.config.Windows()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, win := range windows {
+			out = append(out, windowJSON{win.Title, newRectJSON(win.Bounds), newRectJSON(win.Frame)})
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleHistory returns recent captures as JSON, newest first
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	type entryJSON struct {
+		ID     string    `json:"id"`
+		Time   time.Time `json:"time"`
+		Path   string    `json:"path"`
+		Width  int       `json:"width,omitempty"`
+		Height int       `json:"height,omitempty"`
+		Undone bool      `json:"undone,omitempty"`
+		Thumb  string    `json:"thumb"`
+	}
+
+	out := []entryJSON{}
+	if s.config.History != nil {
+		entries, err := s.config.History()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, e := range entries {
+			out = append(out, entryJSON{e.ID, e.Time, e.Path, e.Width, e.Height, e.TrashedAt != nil, "/history/thumb?id=" + e.ID})
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleHistoryThumb serves the cached thumbnail of a capture listed by
+// /history, making it on first request
+func (s *Server) handleHistoryThumb(w http.ResponseWriter, r *http.Request) {
+	if s.config.History == nil {
+		http.NotFound(w, r)
+		return
+	}
+	entries, err := s.config.History()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	id := r.URL.Query().Get("id")
+	for _, e := range entries {
+		if e.ID != id {
+			continue
+		}
+		path, err := history.Thumbnail(e)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Cache-Control", "private, no-cache")
+		http.ServeFile(w, r, path)
+		return
+	}
+	http.Error(w, fmt.Sprintf("no capture %q in the recent history", id), http.StatusNotFound)
+}
+
+// healthStatus is the body of /healthz and /readyz
+type healthStatus struct {
+	Status              string  `json:"status"`
+	Backend             string  `json:"backend,omitempty"`
+	ProbeMillis         float64 `json:"probe_ms"`
+	Error               string  `json:"error,omitempty"`
+	Captures            int     `json:"captures"`
+	Failures            int     `json:"failures"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+	LastSuccess         string  `json:"last_success,omitempty"`
+	LastError           string  `json:"last_error,omitempty"`
+}
+
+// handleHealthz reports liveness: the capture path must complete a 1x1
+// grab within the health timeout. A hung X connection makes this fail,
+// so orchestrators can restart a wedged daemon.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	status, timedOut := s.probe()
+	code := http.StatusOK
+	if timedOut {
+		code = http.StatusServiceUnavailable
+		status.Status = "wedged"
+	}
+	writeJSON(w, code, status)
+}
+
+// handleReadyz reports readiness: a backend must be available and the
+// probe grab must succeed
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	status, _ := s.probe()
+	code := http.StatusOK
+	if status.Error != "" {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, status)
+}
+
+// probe performs a cheap 1x1 grab with a timeout and fills in the
+// self-monitoring counters. timedOut reports a grab that never returned.
+// Concurrent checks share one grab, and its result is reused for probeTTL.
+func (s *Server) probe() (status healthStatus, timedOut bool) {
+	s.probeMu.Lock()
+	p := s.lastProbe
+	if p == nil || !p.finished.IsZero() && time.Since(p.finished) > probeTTL {
+		p = &probeResult{done: make(chan struct{})}
+		s.lastProbe = p
+		s.probeMu.Unlock()
+
+		p.status, p.timedOut = s.grabProbe()
+
+		s.probeMu.Lock()
+		p.finished = time.Now()
+		s.probeMu.Unlock()
+		close(p.done)
+	} else {
+		s.probeMu.Unlock()
+		<-p.done
+	}
+
+	status = p.status
+	s.fillStats(&status)
+	return status, p.timedOut
+}
+
+// grabProbe runs the probe grab. It is only called by one probe at a
+// time; a grab that timed out isn't repeated until it has returned.
+func (s *Server) grabProbe() (status healthStatus, timedOut bool) {
+	status = healthStatus{Status: "ok"}
+
+	strat, err := s.capturer.GetStrategy()
+	if err != nil {
+		status.Status = "unavailable"
+		status.Error = err.Error()
+		return status, false
+	}
+	status.Backend = strat.Name()
+
+	if s.stuck != nil {
+		select {
+		case <-s.stuck:
+			s.stuck = nil
+		default:
+			status.Status = "failing"
+			status.Error = "previous probe grab hasn't returned"
+			return status, true
+		}
+	}
+
+	rect := image.Rect(0, 0, 1, 1)
+	opts := strategy.CaptureOptions{Monitor: -1, Region: &rect}
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		_, err := strat.Capture(opts)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			status.Status = "failing"
+			status.Error = err.Error()
+		}
+	case <-time.After(s.config.HealthTimeout):
+		status.Status = "failing"
+		status.Error = fmt.Sprintf("probe timed out after %s", s.config.HealthTimeout)
+		timedOut = true
+		s.stuck = done
+	}
+	status.ProbeMillis = float64(time.Since(start).Microseconds()) / 1000
+	return status, timedOut
+}
+
+// fillStats copies the capture counters into a health status
+func (s *Server) fillStats(status *healthStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status.Captures = s.stats.captures
+	status.Failures = s.stats.failures
+	status.ConsecutiveFailures = s.stats.consecutiveFailures
+	status.LastError = s.stats.lastError
+	if !s.stats.lastSuccess.IsZero() {
+		status.LastSuccess = s.stats.lastSuccess.Format(time.RFC3339)
+	}
+}
+
+// capture runs a capture and records its outcome
+func (s *Server) capture(opts strategy.CaptureOptions) (image.Image, error) {
+	img, err := s.capturer.Capture(opts)
+
+	// Refused by the policy's rate limit: nothing is wrong with the
+	// display, so it's not counted as a failure
+	var tooFrequent *capture.TooFrequentError
+	if errors.As(err, &tooFrequent) {
+		return nil, &httpError{code: http.StatusTooManyRequests, err: err, retryAfter: tooFrequent.Wait}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stats.captures++
+	if err != nil {
+		s.stats.failures++
+		s.stats.consecutiveFailures++
+		s.stats.lastError = err.Error()
+		return nil, fmt.Errorf("capture failed: %w", err)
+	}
+	s.stats.consecutiveFailures = 0
+	s.stats.lastSuccess = time.Now()
+	return img, nil
+}
+
+// parseCaptureRequest reads capture and encoding options from the query
+func (s *Server) parseCaptureRequest(r *http.Request) (strategy.CaptureOptions, capture.EncodeOptions, error) {
+	q := r.URL.Query()
+	opts := strategy.CaptureOptions{Monitor: -1}
+	enc := capture.EncodeOptions{Format: capture.FormatPNG, CompressionLevel: 1}
+
+	if v := q.Get("monitor"); v != "" {
+		m, err := strconv.Atoi(v)
+		switch {
+		case err == nil:
+			opts.Monitor = m
+		case s.config.Settings != nil:
+			monitors, err := s.capturer.ListMonitors()
+			if err != nil {
+				return opts, enc, err
+			}
+			if opts.Monitor, opts.Region, err = s.config.Settings.Resolve(v, monitors); err != nil {
+				return opts, enc, err
+			}
+		default:
+			return opts, enc, fmt.Errorf("invalid monitor: %s", v)
+		}
+	}
+
+	if v := q.Get("region"); v != "" {
+		rect, err := strategy.ParseRegion(v)
+		if err != nil {
+			return opts, enc, fmt.Errorf("invalid region: %w", err)
+		}
+		opts.Region = rect
+	}
+
+	if v := q.Get("format"); v != "" {
+		f, err := capture.ParseFormat(v)
+		if err != nil {
+			return opts, enc, err
+		}
+		enc.Format = f
+	}
+
+	if v := q.Get("compress"); v != "" {
+		level, err := strconv.Atoi(v)
+		if err != nil || level < 0 || level > 3 {
+			return opts, enc, fmt.Errorf("invalid compress level: %s (expected 0-3)", v)
+		}
+		enc.CompressionLevel = level
+	}
+
+	if v := q.Get("quality"); v != "" {
+		quality, err := strconv.Atoi(v)
+		if err != nil || quality < 1 || quality > 100 {
+			return opts, enc, fmt.Errorf("invalid quality: %s (expected 1-100)", v)
+		}
+		enc.Quality = quality
+	}
+
+	enc.Progressive = q.Get("progressive") == "1" || q.Get("progressive") == "true"
+	enc.Interlace = q.Get("interlace") == "1" || q.Get("interlace") == "true"
+	if enc.Progressive && enc.Format != capture.FormatJPEG {
+		return opts, enc, fmt.Errorf("progressive needs format=jpeg")
+	}
+	if enc.Interlace && enc.Format != capture.FormatPNG {
+		return opts, enc, fmt.Errorf("interlace needs format=png")
+	}
+	enc.SRGB, enc.DPI = true, s.capturer.DPI(opts)
+
+	return opts, enc, nil
+}
+
+// contentType returns the MIME type for a format
+func contentType(f capture.Format) string {
+	switch f {
+	case capture.FormatPNG, "":
+		return "image/png"
+	case capture.FormatJPEG:
+		return "image/jpeg"
+	case capture.FormatQOI:
+		return "image/qoi"
+	case capture.FormatHEIF:
+		return "image/heic"
+	case capture.FormatSVG:
+		return "image/svg+xml"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
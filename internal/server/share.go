@@ -0,0 +1,187 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxShares bounds the number of unclaimed share links held in memory
+const maxShares = 100
+
+// shareStore holds captured images behind one-shot, time-limited signed
+// links. Each link can be fetched exactly once before it expires.
+type shareStore struct {
+	secret []byte
+
+	mu     sync.Mutex
+	shares map[string]*share
+}
+
+// share is a stored capture waiting to be claimed
+type share struct {
+	data        []byte
+	contentType string
+	expires     time.Time
+}
+
+// newShareStore creates a store signing links with secret. An empty
+// secret generates a random one, invalidating links on restart.
+func newShareStore(secret []byte) (*shareStore, error) {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate share secret: %w", err)
+		}
+	}
+	return &shareStore{secret: secret, shares: map[string]*share{}}, nil
+}
+
+// add stores data and returns the path of its signed link
+func (st *shareStore) add(data []byte, contentType string, ttl time.Duration) (string, time.Time, error) {
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate share id: %w", err)
+	}
+	id := hex.EncodeToString(idBytes)
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.prune(time.Now())
+	if len(st.shares) >= maxShares {
+		return "", time.Time{}, errors.New("too many unclaimed share links")
+	}
+	st.shares[id] = &share{data: data, contentType: contentType, expires: expires}
+
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return fmt.Sprintf("/s/%s?exp=%s&sig=%s", id, exp, st.sign(id, exp)), expires, nil
+}
+
+// wipe zeroes and drops every unclaimed share
+func (st *shareStore) wipe() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for id, sh := range st.shares {
+		clear(sh.data)
+		delete(st.shares, id)
+	}
+}
+
+// claim verifies a link and removes its share, so it can't be used twice
+func (st *shareStore) claim(id, exp, sig string) (*share, error) {
+	if !hmac.Equal([]byte(sig), []byte(st.sign(id, exp))) {
+		return nil, errors.New("invalid signature")
+	}
+
+	expUnix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > expUnix {
+		return nil, errors.New("link expired")
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	sh, ok := st.shares[id]
+	if !ok {
+		return nil, errors.New("link already used")
+	}
+	delete(st.shares, id)
+	return sh, nil
+}
+
+// sign returns the hex HMAC-SHA256 of a link's id and expiry
+func (st *shareStore) sign(id, exp string) string {
+	mac := hmac.New(sha256.New, st.secret)
+	mac.Write([]byte(id + "|" + exp))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// prune drops expired shares. Must be called with the lock held.
+func (st *shareStore) prune(now time.Time) {
+	for id, sh := range st.shares {
+		if now.After(sh.expires) {
+			delete(st.shares, id)
+		}
+	}
+}
+
+// handleShare captures an image and returns a one-shot signed link to it.
+// Accepts the same parameters as /capture plus ttl (e.g. 5m).
+func (s *Server) handleShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	opts, enc, err := s.parseCaptureRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ttl := s.config.ShareTTL
+	if v := r.URL.Query().Get("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > s.config.ShareTTL {
+			http.Error(w, fmt.Sprintf("invalid ttl: %s (max %s)", v, s.config.ShareTTL), http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+
+	data, err := s.captureEncoded(r, opts, enc)
+	if err != nil {
+		writeCaptureError(w, err)
+		return
+	}
+
+	path, expires, err := s.shares.add(data, contentType(enc.Format), ttl)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]string{
+		"url":     s.baseURL(r) + path,
+		"expires": expires.Format(time.RFC3339),
+	})
+}
+
+// handleShared serves a share link exactly once
+func (s *Server) handleShared(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/s/")
+	q := r.URL.Query()
+
+	sh, err := s.shares.claim(id, q.Get("exp"), q.Get("sig"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+
+	w.Header().Set("Content-Type", sh.contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(sh.data)))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(sh.data)
+}
+
+// baseURL returns the externally visible server URL for links
+func (s *Server) baseURL(r *http.Request) string {
+	if s.config.PublicURL != "" {
+		return strings.TrimRight(s.config.PublicURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
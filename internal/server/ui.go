@@ -0,0 +1,24 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// indexHTML is the embedded web UI: monitor thumbnails, a capture button,
+// region selection on the preview, and download links. It talks to the
+// same API as any other client.
+//
+//go:embed web/index.html
+var indexHTML []byte
+
+// handleIndex serves the web UI at /
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexHTML)
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// label returns the launchd label of the service
+func (e *env) label() string {
+	if e.Name == "" {
+		return "com.robotin.screenshot"
+	}
+	return "com.robotin.screenshot." + e.Name
+}
+
+// domain returns the launchd domain the service runs in: the user's GUI
+// session, so captures see the screen, or the system
+func (e *env) domain() string {
+	if e.System {
+		return "system"
+	}
+	return "gui/" + strconv.Itoa(os.Getuid())
+}
+
+// plistPath returns the property list of the service
+func (e *env) plistPath() (string, error) {
+	if e.System {
+		return filepath.Join("/Library/LaunchDaemons", e.label()+".plist"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine home directory: %w", err)
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", e.label()+".plist"), nil
+}
+
+// logPath returns where the service's output goes
+func (e *env) logPath() (string, error) {
+	if e.Log != "" {
+		return e.Log, nil
+	}
+	dir := "/Library/Logs"
+	if !e.System {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("cannot determine home directory: %w", err)
+		}
+		dir = filepath.Join(home, "Library", "Logs")
+	}
+	return filepath.Join(dir, baseName, e.ServiceName()+".log"), nil
+}
+
+func install(e *env) error {
+	path, err := e.plistPath()
+	if err != nil {
+		return err
+	}
+	log, err := e.logPath()
+	if err != nil {
+		return err
+	}
+	if !e.DryRun {
+		if err := os.MkdirAll(filepath.Dir(log), 0755); err != nil {
+			return fmt.Errorf("failed to create log directory: %w", err)
+		}
+	}
+	if err := e.writeFile(path, e.plist(log)); err != nil {
+		return err
+	}
+	// Unload an older version first; it's fine if there is none
+	if !e.DryRun {
+		e.read("launchctl", "bootout", e.domain()+"/"+e.label())
+	}
+	if err := e.run("launchctl", "bootstrap", e.domain(), path); err != nil {
+		return err
+	}
+	e.logf("Installed %s; logs: %s", e.label(), log)
+	return nil
+}
+
+// plist returns the launchd property list
+func (e *env) plist(log string) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString("<plist version=\"1.0\">\n<dict>\n")
+	plistKey(&b, "Label", e.label())
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, a := range e.Command {
+		fmt.Fprintf(&b, "\t\t<string>%s</string>\n", xmlEscape(a))
+	}
+	b.WriteString("\t</array>\n")
+	if len(e.Env) > 0 {
+		b.WriteString("\t<key>EnvironmentVariables</key>\n\t<dict>\n")
+		for _, v := range e.Env {
+			name, value, _ := strings.Cut(v, "=")
+			fmt.Fprintf(&b, "\t\t<key>%s</key>\n\t\t<string>%s</string>\n", xmlEscape(name), xmlEscape(value))
+		}
+		b.WriteString("\t</dict>\n")
+	}
+	// Start at login or boot, and again whenever it fails
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n")
+	b.WriteString("\t<key>KeepAlive</key>\n\t<dict>\n\t\t<key>SuccessfulExit</key>\n\t\t<false/>\n\t</dict>\n")
+	b.WriteString("\t<key>ThrottleInterval</key>\n\t<integer>5</integer>\n")
+	plistKey(&b, "StandardOutPath", log)
+	plistKey(&b, "StandardErrorPath", log)
+	b.WriteString("</dict>\n</plist>\n")
+	return b.String()
+}
+
+// plistKey writes a string entry of a property list dict
+func plistKey(b *strings.Builder, key, value string) {
+	fmt.Fprintf(b, "\t<key>%s</key>\n\t<string>%s</string>\n", key, xmlEscape(value))
+}
+
+// xmlEscape escapes text for XML
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func uninstall(e *env) error {
+	path, err := e.plistPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("%s is not installed", e.label())
+	}
+	if err := e.run("launchctl", "bootout", e.domain()+"/"+e.label()); err != nil {
+		// Installed but not loaded: removing the file is enough
+		e.logf("%v", err)
+	}
+	return e.removeFile(path)
+}
+
+func query(e *env) (Status, error) {
+	path, err := e.plistPath()
+	if err != nil {
+		return Status{}, err
+	}
+	st := Status{Path: path}
+	if st.Log, err = e.logPath(); err != nil {
+		return st, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return st, nil
+	}
+	st.Installed = true
+
+	out, err := e.read("launchctl", "print", e.domain()+"/"+e.label())
+	if err != nil {
+		st.Detail = "not loaded"
+		return st, nil
+	}
+	var details []string
+	seen := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		k, v, ok := strings.Cut(strings.TrimSpace(line), " = ")
+		if !ok || seen[k] {
+			// Nested sections repeat keys; the service's come first
+			continue
+		}
+		seen[k] = true
+		switch k {
+		case "state":
+			st.Running = v == "running"
+			details = append(details, v)
+		case "runs", "last exit code":
+			details = append(details, k+" "+v)
+		case "stdout path":
+			st.Log = v
+		}
+	}
+	st.Detail = strings.Join(details, ", ")
+	return st, nil
+}
@@ -0,0 +1,20 @@
+//go:build !linux && !darwin && !windows
+
+package service
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func install(e *env) error {
+	return fmt.Errorf("services are not supported on %s", runtime.GOOS)
+}
+
+func uninstall(e *env) error {
+	return fmt.Errorf("services are not supported on %s", runtime.GOOS)
+}
+
+func query(e *env) (Status, error) {
+	return Status{}, fmt.Errorf("services are not supported on %s", runtime.GOOS)
+}
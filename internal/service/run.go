@@ -0,0 +1,10 @@
+//go:build !windows
+
+package service
+
+// Run runs main as a Windows service when the service manager started
+// the process, and reports whether it did. Elsewhere services are plain
+// processes, so it never does.
+func Run(main func() error) (bool, error) {
+	return false, nil
+}
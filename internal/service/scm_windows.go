@@ -0,0 +1,284 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows/registry"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// logEnv passes the log file to the service process, which opens it
+// itself: Windows services have no output of their own
+const logEnv = "SCREENSHOT_SERVICE_LOG"
+
+// logPath returns where the service's output goes
+func (e *env) logPath() string {
+	if e.Log != "" {
+		return e.Log
+	}
+	return defaultLog(e.ServiceName())
+}
+
+// defaultLog returns the default log file of the named service
+func defaultLog(name string) string {
+	dir := os.Getenv("ProgramData")
+	if dir == "" {
+		dir = `C:\ProgramData`
+	}
+	return filepath.Join(dir, baseName, "logs", name+".log")
+}
+
+// connect opens the service manager, which needs an elevated prompt
+func connect() (*mgr.Mgr, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the service manager (run as administrator): %w", err)
+	}
+	return m, nil
+}
+
+func install(e *env) error {
+	name, log := e.ServiceName(), e.logPath()
+	env := append([]string{logEnv + "=" + log}, e.Env...)
+	if e.DryRun {
+		e.logf("would install service %s: %s", name, commandLine(e.Command))
+		e.logf("would set its environment: %s", strings.Join(env, " "))
+		return nil
+	}
+
+	m, err := connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	cfg := mgr.Config{
+		DisplayName: "robotin screenshot (" + name + ")",
+		Description: "Runs: " + commandLine(e.Command[1:]),
+		StartType:   mgr.StartAutomatic,
+	}
+	s, err := m.OpenService(name)
+	if err == nil {
+		// Reconfigure it in place: a deleted service lingers until
+		// every handle to it is closed
+		s.Control(svc.Stop)
+		old, err := s.Config()
+		if err == nil {
+			old.DisplayName, old.Description, old.StartType = cfg.DisplayName, cfg.Description, cfg.StartType
+			old.BinaryPathName = commandLine(e.Command)
+			err = s.UpdateConfig(old)
+		}
+		if err != nil {
+			s.Close()
+			return fmt.Errorf("failed to update service %s: %w", name, err)
+		}
+	} else if s, err = m.CreateService(name, e.Command[0], cfg, e.Command[1:]...); err != nil {
+		return fmt.Errorf("failed to create service %s: %w", name, err)
+	}
+	defer s.Close()
+
+	if err := setServiceEnv(name, env); err != nil {
+		return err
+	}
+	// Restart after a crash or an error exit, resetting the count daily
+	restart := mgr.RecoveryAction{Type: mgr.ServiceRestart, Delay: 5 * time.Second}
+	if err := s.SetRecoveryActions([]mgr.RecoveryAction{restart, restart, restart}, 24*60*60); err != nil {
+		return fmt.Errorf("failed to set recovery actions: %w", err)
+	}
+	if err := s.SetRecoveryActionsOnNonCrashFailures(true); err != nil {
+		return fmt.Errorf("failed to set recovery actions: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(log), 0755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+	if err := waitStopped(s); err != nil {
+		return err
+	}
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("failed to start service %s: %w", name, err)
+	}
+	e.logf("Installed %s; logs: %s", name, log)
+	return nil
+}
+
+// setServiceEnv sets the environment of a service, kept in its registry
+// key
+func setServiceEnv(name string, env []string) error {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Services\`+name, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("failed to open the registry key of %s: %w", name, err)
+	}
+	defer k.Close()
+	if err := k.SetStringsValue("Environment", env); err != nil {
+		return fmt.Errorf("failed to set the environment of %s: %w", name, err)
+	}
+	return nil
+}
+
+// serviceEnv returns the environment of a service
+func serviceEnv(name string) []string {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Services\`+name, registry.QUERY_VALUE)
+	if err != nil {
+		return nil
+	}
+	defer k.Close()
+	env, _, _ := k.GetStringsValue("Environment")
+	return env
+}
+
+// waitStopped waits up to 10 seconds for a stopping service to stop
+func waitStopped(s *mgr.Service) error {
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(200 * time.Millisecond) {
+		st, err := s.Query()
+		if err != nil {
+			return fmt.Errorf("failed to query service: %w", err)
+		}
+		if st.State == svc.Stopped {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("service did not stop (state %d)", st.State)
+		}
+	}
+}
+
+func uninstall(e *env) error {
+	name := e.ServiceName()
+	if e.DryRun {
+		e.logf("would stop and delete service %s", name)
+		return nil
+	}
+	m, err := connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("%s is not installed", name)
+	}
+	defer s.Close()
+	s.Control(svc.Stop)
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("failed to delete service %s: %w", name, err)
+	}
+	e.logf("Removed service %s", name)
+	return nil
+}
+
+func query(e *env) (Status, error) {
+	name := e.ServiceName()
+	st := Status{Log: e.logPath()}
+	m, err := connect()
+	if err != nil {
+		return st, err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return st, nil
+	}
+	defer s.Close()
+	st.Installed = true
+	if cfg, err := s.Config(); err == nil {
+		st.Path = cfg.BinaryPathName
+	}
+	for _, v := range serviceEnv(name) {
+		if log, ok := strings.CutPrefix(v, logEnv+"="); ok {
+			st.Log = log
+		}
+	}
+	status, err := s.Query()
+	if err != nil {
+		return st, fmt.Errorf("failed to query service %s: %w", name, err)
+	}
+	st.Running = status.State == svc.Running
+	st.Detail = stateNames[status.State]
+	return st, nil
+}
+
+// stateNames describe service states
+var stateNames = map[svc.State]string{
+	svc.Stopped:         "stopped",
+	svc.StartPending:    "starting",
+	svc.StopPending:     "stopping",
+	svc.Running:         "running",
+	svc.ContinuePending: "continuing",
+	svc.PausePending:    "pausing",
+	svc.Paused:          "paused",
+}
+
+// commandLine quotes a command line the Windows way
+func commandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = syscall.EscapeArg(a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Run runs main as a Windows service when the service manager started
+// the process, and reports whether it did. Output goes to the service's
+// log file. A stop request ends the process without waiting for main.
+func Run(main func() error) (bool, error) {
+	if ok, err := svc.IsWindowsService(); err != nil || !ok {
+		return false, err
+	}
+	h := &handler{main: main}
+	if err := svc.Run("", h); err != nil {
+		return true, err
+	}
+	return true, h.err
+}
+
+// handler runs main for the service manager
+type handler struct {
+	main func() error
+	err  error
+}
+
+func (h *handler) Execute(args []string, r <-chan svc.ChangeRequest, s chan<- svc.Status) (bool, uint32) {
+	s <- svc.Status{State: svc.StartPending}
+
+	log := os.Getenv(logEnv)
+	if log == "" && len(args) > 0 {
+		log = defaultLog(args[0])
+	}
+	if f, err := os.OpenFile(log, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err == nil {
+		defer f.Close()
+		os.Stdout, os.Stderr = f, f
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- h.main()
+	}()
+	s <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case h.err = <-done:
+			if h.err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", h.err)
+				// A service-specific exit code triggers the recovery
+				// actions
+				return true, 1
+			}
+			return false, 0
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				s <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				s <- svc.Status{State: svc.StopPending}
+				return false, 0
+			}
+		}
+	}
+}
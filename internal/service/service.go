@@ -0,0 +1,193 @@
+// Package service registers the tool as a background service that starts
+// with the session or the machine and is restarted when it fails: a
+// systemd unit on Linux, a launchd agent on macOS and a Windows service
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// baseName is the name of services without Options.Name
+const baseName = "robotin-screenshot"
+
+// nameRe is what Options.Name may contain, being part of file names
+var nameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Options configures a service
+type Options struct {
+	// Name tells several services apart: the service is called
+	// robotin-screenshot-NAME, or robotin-screenshot without one
+	Name string
+
+	// Command is the command line the service runs, the executable
+	// first
+	Command []string
+
+	// System installs a service for the whole machine, run as root,
+	// instead of one for the current user (Linux and macOS; Windows
+	// services always are)
+	System bool
+
+	// Log is the file the service's output goes to. The default is the
+	// journal on Linux, ~/Library/Logs/robotin-screenshot/NAME.log on
+	// macOS and %ProgramData%\robotin-screenshot\logs\NAME.log on
+	// Windows.
+	Log string
+
+	// Env are NAME=value variables set for the service, such as DISPLAY
+	Env []string
+
+	// DryRun prints the changes instead of making them
+	DryRun bool
+
+	// Out receives progress messages and, with DryRun, the changes
+	Out io.Writer
+}
+
+// Status is the state of an installed service
+type Status struct {
+	Name      string `json:"name"`
+	Installed bool   `json:"installed"`
+	Running   bool   `json:"running"`
+
+	// Path is the unit or agent file, Log where the output goes
+	Path string `json:"path,omitempty"`
+	Log  string `json:"log,omitempty"`
+
+	// Detail is the service manager's own description of the state
+	Detail string `json:"detail,omitempty"`
+}
+
+// ServiceName returns the name of the service with opts.Name
+func (o Options) ServiceName() string {
+	if o.Name == "" {
+		return baseName
+	}
+	return baseName + "-" + o.Name
+}
+
+// Install registers and starts the service, replacing one of the same
+// name
+func Install(opts Options) error {
+	if len(opts.Command) == 0 {
+		return errors.New("no command for the service to run")
+	}
+	e, err := newEnv(opts)
+	if err != nil {
+		return err
+	}
+	return install(e)
+}
+
+// Uninstall stops and removes the service
+func Uninstall(opts Options) error {
+	e, err := newEnv(opts)
+	if err != nil {
+		return err
+	}
+	return uninstall(e)
+}
+
+// Query returns the state of the service
+func Query(opts Options) (Status, error) {
+	e, err := newEnv(opts)
+	if err != nil {
+		return Status{}, err
+	}
+	st, err := query(e)
+	st.Name = opts.ServiceName()
+	return st, err
+}
+
+// env carries out changes, or prints them in dry-run mode
+type env struct {
+	Options
+}
+
+func newEnv(opts Options) (*env, error) {
+	if opts.Name != "" && !nameRe.MatchString(opts.Name) {
+		return nil, fmt.Errorf("invalid service name %q (letters, digits, '.', '-' and '_')", opts.Name)
+	}
+	if opts.Out == nil {
+		opts.Out = io.Discard
+	}
+	return &env{Options: opts}, nil
+}
+
+// read runs a command that only queries state, even in dry-run mode
+func (e *env) read(name string, args ...string) (string, error) {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return strings.TrimSpace(string(out)), fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// run runs a command that changes state
+func (e *env) run(name string, args ...string) error {
+	if e.DryRun {
+		fmt.Fprintf(e.Out, "would run: %s\n", shellJoin(append([]string{name}, args...)))
+		return nil
+	}
+	if out, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// writeFile writes a file, creating its directory
+func (e *env) writeFile(path, content string) error {
+	if e.DryRun {
+		fmt.Fprintf(e.Out, "would write %s:\n%s", path, content)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	fmt.Fprintf(e.Out, "Wrote %s\n", path)
+	return nil
+}
+
+// removeFile removes a file if it exists
+func (e *env) removeFile(path string) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if e.DryRun {
+		fmt.Fprintf(e.Out, "would remove %s\n", path)
+		return nil
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	fmt.Fprintf(e.Out, "Removed %s\n", path)
+	return nil
+}
+
+// logf prints a progress message
+func (e *env) logf(format string, args ...any) {
+	fmt.Fprintf(e.Out, format+"\n", args...)
+}
+
+// shellJoin quotes args for display
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if a != "" && strings.Trim(a, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,@%+") == "" {
+			quoted[i] = a
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
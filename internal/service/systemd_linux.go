@@ -0,0 +1,165 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// unitPath returns the unit file of the service
+func (e *env) unitPath() (string, error) {
+	if e.System {
+		return filepath.Join("/etc/systemd/system", e.ServiceName()+".service"), nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine config directory: %w", err)
+	}
+	return filepath.Join(dir, "systemd", "user", e.ServiceName()+".service"), nil
+}
+
+// systemctl runs systemctl for the user or the system manager
+func (e *env) systemctl(args ...string) error {
+	if !e.System {
+		args = append([]string{"--user"}, args...)
+	}
+	return e.run("systemctl", args...)
+}
+
+func install(e *env) error {
+	path, err := e.unitPath()
+	if err != nil {
+		return err
+	}
+	if err := e.writeFile(path, e.unit()); err != nil {
+		return err
+	}
+	if err := e.systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	if err := e.systemctl("enable", e.ServiceName()); err != nil {
+		return err
+	}
+	// Starts it, or picks up a changed unit when it was running
+	if err := e.systemctl("restart", e.ServiceName()); err != nil {
+		return err
+	}
+	if e.Log == "" {
+		journal := "journalctl -u " + e.ServiceName()
+		if !e.System {
+			journal = "journalctl --user -u " + e.ServiceName()
+		}
+		e.logf("Installed %s; logs: %s", e.ServiceName(), journal)
+	} else {
+		e.logf("Installed %s; logs: %s", e.ServiceName(), e.Log)
+	}
+	return nil
+}
+
+// unit returns the unit file
+func (e *env) unit() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Unit]\nDescription=robotin screenshot (%s)\n", shellJoin(e.Command[1:]))
+	if e.System {
+		b.WriteString("After=network-online.target\nWants=network-online.target\n")
+	} else {
+		b.WriteString("After=graphical-session.target\n")
+	}
+
+	b.WriteString("\n[Service]\n")
+	fmt.Fprintf(&b, "ExecStart=%s\n", systemdJoin(e.Command))
+	for _, v := range e.Env {
+		fmt.Fprintf(&b, "Environment=%s\n", systemdQuote(v))
+	}
+	// Stop the way Ctrl-C does, so the current capture finishes
+	b.WriteString("KillSignal=SIGINT\nRestart=on-failure\nRestartSec=5\n")
+	if e.Log != "" {
+		fmt.Fprintf(&b, "StandardOutput=append:%s\nStandardError=append:%s\n", e.Log, e.Log)
+	}
+
+	b.WriteString("\n[Install]\n")
+	if e.System {
+		b.WriteString("WantedBy=multi-user.target\n")
+	} else {
+		b.WriteString("WantedBy=default.target\n")
+	}
+	return b.String()
+}
+
+func uninstall(e *env) error {
+	path, err := e.unitPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("%s is not installed", e.ServiceName())
+	}
+	if err := e.systemctl("disable", "--now", e.ServiceName()); err != nil {
+		return err
+	}
+	if err := e.removeFile(path); err != nil {
+		return err
+	}
+	return e.systemctl("daemon-reload")
+}
+
+func query(e *env) (Status, error) {
+	path, err := e.unitPath()
+	if err != nil {
+		return Status{}, err
+	}
+	st := Status{Path: path, Log: "journal"}
+	unit, err := os.ReadFile(path)
+	if err != nil {
+		return st, nil
+	}
+	st.Installed = true
+	for _, line := range strings.Split(string(unit), "\n") {
+		if log, ok := strings.CutPrefix(line, "StandardOutput=append:"); ok {
+			st.Log = log
+		}
+	}
+
+	args := []string{"show", "--property=ActiveState,SubState,NRestarts", e.ServiceName()}
+	if !e.System {
+		args = append([]string{"--user"}, args...)
+	}
+	out, err := e.read("systemctl", args...)
+	if err != nil {
+		return st, err
+	}
+	props := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		if k, v, ok := strings.Cut(line, "="); ok {
+			props[k] = v
+		}
+	}
+	st.Running = props["ActiveState"] == "active"
+	st.Detail = props["ActiveState"] + " (" + props["SubState"] + ")"
+	if n := props["NRestarts"]; n != "" && n != "0" {
+		st.Detail += ", restarted " + n + " times"
+	}
+	return st, nil
+}
+
+// systemdJoin quotes a command line for ExecStart
+func systemdJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = systemdQuote(a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// systemdQuote quotes a word for a unit file when it needs it. Percent
+// signs are specifiers and dollar signs variables to systemd, so both
+// are escaped.
+func systemdQuote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	s = strings.ReplaceAll(s, "$", "$$")
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,18 @@
+//go:build linux
+
+package session
+
+import "golang.org/x/sys/unix"
+
+// monotonicClock names the clock event timestamps are taken from
+const monotonicClock = "CLOCK_MONOTONIC"
+
+// monotonicNow reads CLOCK_MONOTONIC in nanoseconds, the clock journald
+// (_SOURCE_MONOTONIC_TIMESTAMP) and the kernel log stamp entries with
+func monotonicNow() int64 {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return 0
+	}
+	return ts.Nano()
+}
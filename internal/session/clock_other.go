@@ -0,0 +1,12 @@
+//go:build !linux
+
+package session
+
+// monotonicClock names the clock event timestamps are taken from: without
+// a system-wide monotonic clock, timestamps count from the session start
+const monotonicClock = "session"
+
+// monotonicNow returns 0, so monotonic timestamps are relative to the start
+func monotonicNow() int64 {
+	return 0
+}
@@ -0,0 +1,86 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Index lists the bundles of a session recorded in segments. Segments are
+// cut between frames, and each starts with the monitor layout and focused
+// window, so it replays on its own.
+type Index struct {
+	Version  int       `json:"version"`
+	Started  time.Time `json:"started"`
+	Segment  float64   `json:"segment_seconds"`
+	FPS      float64   `json:"fps"`
+	Segments []Segment `json:"segments"`
+}
+
+// Segment is one bundle of a segmented session
+type Segment struct {
+	// File is the bundle's name, in the index's directory
+	File     string    `json:"file"`
+	Started  time.Time `json:"started"`
+	Duration float64   `json:"duration_seconds"`
+	Frames   int       `json:"frames"`
+
+	// Recording is set while the segment is recorded, and stays set if
+	// the recording was cut short (see Recover)
+	Recording bool `json:"recording,omitempty"`
+}
+
+// SegmentPath returns the path of segment n, from 1, of a session
+// recorded to path: s.rsb becomes s-0001.rsb
+func SegmentPath(path string, n int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%04d%s", strings.TrimSuffix(path, ext), n, ext)
+}
+
+// IndexPath returns the index of a session recorded to path in segments:
+// s.rsb becomes s.index.json
+func IndexPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".index.json"
+}
+
+// IsIndex reports whether path names a segment index
+func IsIndex(path string) bool {
+	return strings.HasSuffix(path, ".index.json")
+}
+
+// ReadIndex reads a segment index
+func ReadIndex(path string) (*Index, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read segment index: %w", err)
+	}
+	var ix Index
+	if err := json.Unmarshal(data, &ix); err != nil {
+		return nil, fmt.Errorf("failed to parse segment index %s: %w", path, err)
+	}
+	if ix.Version > FormatVersion {
+		return nil, fmt.Errorf("unsupported segment index version %d", ix.Version)
+	}
+	return &ix, nil
+}
+
+// Write replaces the index at path, atomically so a crash leaves the
+// previous one
+func (ix *Index) Write(path string) error {
+	data, err := json.MarshalIndent(ix, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write segment index: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write segment index: %w", err)
+	}
+	return nil
+}
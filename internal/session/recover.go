@@ -0,0 +1,241 @@
+package session
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Zip record signatures
+const (
+	localHeaderSig    = 0x04034b50
+	dataDescriptorSig = 0x08074b50
+)
+
+// Recovered describes a bundle rebuilt by Recover
+type Recovered struct {
+	Manifest Manifest
+
+	// Events is the number of timeline events kept. Journal tells whether
+	// they came from the journal; without one the timeline is rebuilt
+	// from the frames' file times, which only have 2-second precision.
+	Events  int
+	Journal bool
+}
+
+// Recover rebuilds the bundle at path, whose recording was cut short, from
+// the frames and events written before it stopped, and writes it to out,
+// which may be path itself. Frames after the first damaged one are lost.
+func Recover(path, out string) (Recovered, error) {
+	if zr, err := zip.OpenReader(path); err == nil {
+		zr.Close()
+		return Recovered{}, fmt.Errorf("%s is a complete session bundle, there is nothing to recover", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return Recovered{}, fmt.Errorf("failed to open session bundle: %w", err)
+	}
+	defer f.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(out), ".recover-*.rsb")
+	if err != nil {
+		return Recovered{}, fmt.Errorf("failed to create recovered bundle: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	zw := zip.NewWriter(tmp)
+	times, err := copyFrames(bufio.NewReader(f), zw)
+	if err != nil {
+		return Recovered{}, err
+	}
+
+	m, events, journal := readJournal(JournalPath(path))
+	if !journal {
+		if len(times) == 0 {
+			return Recovered{}, fmt.Errorf("no frames to recover in %s", path)
+		}
+		m, events = rebuildTimeline(times)
+	}
+
+	// Keep the events of the frames that made it to the bundle, and close
+	// the timeline at the last one
+	kept := events[:0]
+	for _, e := range events {
+		if e.Type != EventFrame || (e.Frame != nil && *e.Frame < len(times)) {
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) > 0 {
+		last := kept[len(kept)-1]
+		kept = append(kept, Event{Offset: last.Offset, Type: EventStop, Mono: last.Mono, Wall: last.Wall, Data: "recovered"})
+		m.Duration = (time.Duration(last.Offset) * time.Millisecond).Seconds()
+	}
+	m.Frames = len(times)
+
+	if err := finalize(zw, m, kept); err != nil {
+		return Recovered{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return Recovered{}, fmt.Errorf("failed to write recovered bundle: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), out); err != nil {
+		return Recovered{}, fmt.Errorf("failed to write recovered bundle: %w", err)
+	}
+
+	// The journal goes with the damaged bundle, so it stays unless that
+	// was replaced
+	if a, b := absPath(path), absPath(out); a == b {
+		os.Remove(JournalPath(path))
+	}
+	return Recovered{Manifest: m, Events: len(kept), Journal: journal}, nil
+}
+
+// copyFrames copies the intact frames at the start of a damaged bundle to
+// zw, in order, and returns their file times. It stops at the first entry
+// that isn't the next frame or is cut short.
+func copyFrames(r *bufio.Reader, zw *zip.Writer) ([]time.Time, error) {
+	var times []time.Time
+	for {
+		var h [30]byte
+		if _, err := io.ReadFull(r, h[:]); err != nil {
+			return times, nil
+		}
+		le := binary.LittleEndian
+		if le.Uint32(h[0:]) != localHeaderSig {
+			return times, nil
+		}
+		flags, method := le.Uint16(h[6:]), le.Uint16(h[8:])
+		modTime, modDate := le.Uint16(h[10:]), le.Uint16(h[12:])
+		sum, size := le.Uint32(h[14:]), le.Uint32(h[18:])
+
+		name := make([]byte, le.Uint16(h[26:]))
+		if _, err := io.ReadFull(r, name); err != nil {
+			return times, nil
+		}
+		if _, err := r.Discard(int(le.Uint16(h[28:]))); err != nil {
+			return times, nil
+		}
+		if string(name) != frameName(len(times)) || method != zip.Store {
+			return times, nil
+		}
+
+		var data []byte
+		if flags&0x8 == 0 {
+			data = make([]byte, size)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return times, nil
+			}
+		} else {
+			// Bundles from older versions put the sizes after the data,
+			// but a PNG's own structure tells where it ends
+			var buf bytes.Buffer
+			if _, err := png.Decode(io.TeeReader(r, &buf)); err != nil {
+				return times, nil
+			}
+			data = buf.Bytes()
+			if sig, err := r.Peek(4); err == nil && le.Uint32(sig) == dataDescriptorSig {
+				r.Discard(4)
+			}
+			var d [12]byte
+			if _, err := io.ReadFull(r, d[:]); err != nil {
+				return times, nil
+			}
+			sum = le.Uint32(d[:])
+		}
+		if crc32.ChecksumIEEE(data) != sum {
+			return times, nil
+		}
+
+		fw, err := zw.CreateRaw(&zip.FileHeader{
+			Name:               string(name),
+			Method:             zip.Store,
+			ModifiedTime:       modTime,
+			ModifiedDate:       modDate,
+			CRC32:              sum,
+			CompressedSize64:   uint64(len(data)),
+			UncompressedSize64: uint64(len(data)),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to write recovered bundle: %w", err)
+		}
+		if _, err := fw.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to write recovered bundle: %w", err)
+		}
+		times = append(times, msDosTime(modDate, modTime))
+	}
+}
+
+// readJournal reads the manifest and events of a bundle's journal, up to
+// a line cut short by the crash, and reports whether there was one
+func readJournal(path string) (Manifest, []Event, bool) {
+	var m Manifest
+	f, err := os.Open(path)
+	if err != nil {
+		return m, nil, false
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 16<<20)
+	if !sc.Scan() || json.Unmarshal(sc.Bytes(), &m) != nil || m.Version == 0 {
+		return m, nil, false
+	}
+	var events []Event
+	for sc.Scan() {
+		var e Event
+		if json.Unmarshal(sc.Bytes(), &e) != nil {
+			break
+		}
+		events = append(events, e)
+	}
+	return m, events, true
+}
+
+// rebuildTimeline makes up a manifest and frame events from frame file
+// times, spacing the frames evenly between the first and the last
+func rebuildTimeline(times []time.Time) (Manifest, []Event) {
+	m := Manifest{Version: FormatVersion, Started: times[0], FPS: 1, TimeBase: TimeBase}
+	if span := times[len(times)-1].Sub(times[0]); len(times) > 1 && span > 0 {
+		m.FPS = float64(len(times)-1) / span.Seconds()
+	}
+
+	events := []Event{{Type: EventStart, Wall: m.Started}}
+	for i := range times {
+		n := i
+		elapsed := time.Duration(float64(i) / m.FPS * float64(time.Second))
+		pts := elapsed.Nanoseconds() * PTSPerSecond / int64(time.Second)
+		events = append(events, Event{
+			Offset: elapsed.Milliseconds(),
+			Type:   EventFrame,
+			Wall:   m.Started.Add(elapsed),
+			Frame:  &n,
+			PTS:    &pts,
+		})
+	}
+	return m, events
+}
+
+// msDosTime converts a zip entry's MS-DOS date and time
+func msDosTime(date, t uint16) time.Time {
+	return time.Date(int(date>>9)+1980, time.Month(date>>5&0xf), int(date&0x1f),
+		int(t>>11), int(t>>5&0x3f), int(t&0x1f)*2, 0, time.Local)
+}
+
+// absPath returns path made absolute, or as is if that fails
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
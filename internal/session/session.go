@@ -0,0 +1,431 @@
+// Package session reads and writes replayable session bundles (.rsb).
+//
+// A bundle is a zip archive containing:
+//
+//	manifest.json   bundle metadata (version, host, start time, frame count)
+//	events.jsonl    one JSON event per line, in time order
+//	frames/NNNNNN.png  captured frames, numbered from 0
+//
+// Every event carries a monotonic timestamp (mono_ns, CLOCK_MONOTONIC on
+// Linux) and the wall-clock time; frame events also carry a presentation
+// timestamp (pts) in the manifest's time base, counted from the session
+// start. Monotonic timestamps are immune to NTP steps and line up with
+// journald's monotonic timestamps and the kernel log.
+//
+// While a bundle is recorded, the manifest and events also go to a journal
+// next to it (JournalPath) and every frame is flushed with its sizes in the
+// local header, so Recover can rebuild a bundle whose recording was cut
+// short from the frames and events written so far.
+package session
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// FormatVersion is the bundle format version written to the manifest
+const FormatVersion = 1
+
+// TimeBase is the frame PTS unit, as in MPEG transport streams, and
+// PTSPerSecond the number of PTS ticks per second
+const (
+	TimeBase     = "1/90000"
+	PTSPerSecond = 90000
+)
+
+// Event types recorded in a bundle
+const (
+	EventStart    = "start"
+	EventFrame    = "frame"
+	EventFocus    = "focus"
+	EventMonitors = "monitors"
+	EventError    = "error"
+	EventStop     = "stop"
+)
+
+// Manifest describes a session bundle
+type Manifest struct {
+	Version  int       `json:"version"`
+	Host     string    `json:"host"`
+	Started  time.Time `json:"started"`
+	Duration float64   `json:"duration_seconds"`
+	Frames   int       `json:"frames"`
+	FPS      float64   `json:"fps"`
+
+	// Clock names the clock of the events' mono_ns timestamps and
+	// MonotonicStart is its reading when the session started
+	Clock          string `json:"clock,omitempty"`
+	MonotonicStart int64  `json:"monotonic_start_ns,omitempty"`
+
+	// TimeBase is the unit of frame PTS values
+	TimeBase string `json:"time_base,omitempty"`
+}
+
+// Event is a single timestamped entry in the session timeline
+type Event struct {
+	// Offset is the time since session start in milliseconds
+	Offset int64  `json:"t"`
+	Type   string `json:"type"`
+
+	// Mono is the monotonic clock reading in nanoseconds and Wall the
+	// wall-clock time. For frames both are taken when the capture started.
+	Mono int64     `json:"mono_ns,omitempty"`
+	Wall time.Time `json:"wall,omitempty"`
+
+	// Frame is the frame number and PTS its presentation timestamp in the
+	// manifest's time base (frame events only)
+	Frame *int   `json:"frame,omitempty"`
+	PTS   *int64 `json:"pts,omitempty"`
+
+	// Data holds event-specific details (window, monitor layout, error text)
+	Data any `json:"data,omitempty"`
+}
+
+// ErrInterrupted is returned by Open for a bundle whose recording has not
+// finished, because it's still running or was cut short
+var ErrInterrupted = errors.New("session bundle is incomplete")
+
+// JournalPath returns the journal kept next to the bundle at path while it
+// is recorded
+func JournalPath(path string) string {
+	return path + ".journal"
+}
+
+// Writer records a session bundle
+type Writer struct {
+	path     string
+	file     *os.File
+	zip      *zip.Writer
+	journal  *os.File
+	started  time.Time
+	mono     int64
+	events   []Event
+	frames   int
+	manifest Manifest
+}
+
+// Create starts a new bundle at path
+func Create(path string, fps float64) (*Writer, error) {
+	return CreateAt(path, fps, time.Now())
+}
+
+// CreateAt starts a new bundle at path for a session that started at
+// start, which may be in the past, as for frames kept in memory. start
+// must come from time.Now so it has a monotonic reading.
+func CreateAt(path string, fps float64, start time.Time) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session bundle: %w", err)
+	}
+	journal, err := os.Create(JournalPath(path))
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to create session journal: %w", err)
+	}
+
+	host, _ := os.Hostname()
+
+	// Later timestamps are derived from Go's monotonic reading of start,
+	// so one clock read is enough to place them all on the system clock
+	mono := monotonicNow() - time.Since(start).Nanoseconds()
+
+	w := &Writer{
+		path:    path,
+		file:    file,
+		zip:     zip.NewWriter(file),
+		journal: journal,
+		started: start,
+		mono:    mono,
+		manifest: Manifest{
+			Version:        FormatVersion,
+			Host:           host,
+			Started:        start,
+			FPS:            fps,
+			Clock:          monotonicClock,
+			MonotonicStart: mono,
+			TimeBase:       TimeBase,
+		},
+	}
+	w.log(w.manifest)
+	w.EventAt(EventStart, nil, start)
+	return w, nil
+}
+
+// Manifest returns the bundle's manifest, complete once the bundle is
+// closed
+func (w *Writer) Manifest() Manifest {
+	return w.manifest
+}
+
+// stamp returns an event of type typ timestamped at t
+func (w *Writer) stamp(typ string, t time.Time) Event {
+	elapsed := t.Sub(w.started)
+	return Event{
+		Offset: elapsed.Milliseconds(),
+		Type:   typ,
+		Mono:   w.mono + elapsed.Nanoseconds(),
+		Wall:   t,
+	}
+}
+
+// Event appends a timeline event
+func (w *Writer) Event(typ string, data any) {
+	w.EventAt(typ, data, time.Now())
+}
+
+// EventAt appends a timeline event that happened at t, which must come
+// from time.Now
+func (w *Writer) EventAt(typ string, data any, t time.Time) {
+	e := w.stamp(typ, t)
+	e.Data = data
+	w.events = append(w.events, e)
+	w.log(e)
+}
+
+// log appends v to the journal. The journal only matters after a crash,
+// so failing to write it doesn't fail the recording.
+func (w *Writer) log(v any) {
+	if data, err := json.Marshal(v); err == nil {
+		w.journal.Write(append(data, '\n'))
+	}
+}
+
+// Frame appends a frame whose capture started at captured, and its frame
+// event. captured must come from time.Now so it has a monotonic reading.
+func (w *Writer) Frame(img image.Image, captured time.Time) error {
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return fmt.Errorf("failed to encode frame: %w", err)
+	}
+	return w.FramePNG(buf.Bytes(), captured)
+}
+
+// FramePNG is Frame for a frame already encoded as PNG
+func (w *Writer) FramePNG(data []byte, captured time.Time) error {
+	// Sizes in the local header, rather than in a descriptor after the
+	// data, let Recover walk the frames without the central directory
+	n := w.frames
+	hdr := &zip.FileHeader{
+		Name:               frameName(n),
+		Method:             zip.Store, // PNG data is already compressed
+		CRC32:              crc32.ChecksumIEEE(data),
+		CompressedSize64:   uint64(len(data)),
+		UncompressedSize64: uint64(len(data)),
+	}
+	// CreateRaw ignores Modified and only writes the MS-DOS time fields
+	hdr.SetModTime(captured)
+	fw, err := w.zip.CreateRaw(hdr)
+	if err != nil {
+		return fmt.Errorf("failed to add frame: %w", err)
+	}
+	if _, err := fw.Write(data); err != nil {
+		return fmt.Errorf("failed to write frame: %w", err)
+	}
+	if err := w.zip.Flush(); err != nil {
+		return fmt.Errorf("failed to write frame: %w", err)
+	}
+
+	e := w.stamp(EventFrame, captured)
+	pts := captured.Sub(w.started).Nanoseconds() * PTSPerSecond / int64(time.Second)
+	e.Frame, e.PTS = &n, &pts
+	w.events = append(w.events, e)
+	w.log(e)
+	w.frames++
+	return nil
+}
+
+// Close writes the timeline and manifest and finalizes the bundle
+func (w *Writer) Close() error {
+	w.Event(EventStop, nil)
+	if err := w.finish(); err != nil {
+		w.file.Close()
+		w.journal.Close()
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		w.journal.Close()
+		return fmt.Errorf("failed to finalize session bundle: %w", err)
+	}
+	// The bundle is complete, so the journal is no longer needed
+	w.journal.Close()
+	os.Remove(JournalPath(w.path))
+	return nil
+}
+
+// finish writes the manifest, the timeline and the central directory
+func (w *Writer) finish() error {
+	w.manifest.Frames = w.frames
+	w.manifest.Duration = time.Since(w.started).Seconds()
+	return finalize(w.zip, w.manifest, w.events)
+}
+
+// finalize writes the manifest and events and closes the archive
+func finalize(zw *zip.Writer, m Manifest, events []Event) error {
+	if err := writeJSON(zw, "manifest.json", m); err != nil {
+		return err
+	}
+
+	ew, err := zw.Create("events.jsonl")
+	if err != nil {
+		return fmt.Errorf("failed to write events: %w", err)
+	}
+	enc := json.NewEncoder(ew)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("failed to write events: %w", err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to finalize session bundle: %w", err)
+	}
+	return nil
+}
+
+// writeJSON adds an indented JSON file to the archive
+func writeJSON(zw *zip.Writer, name string, v any) error {
+	fw, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(append(data, '\n'))
+	return err
+}
+
+// Reader gives access to a recorded bundle
+type Reader struct {
+	zip      *zip.ReadCloser
+	frames   map[string]*zip.File
+	Manifest Manifest
+	Events   []Event
+}
+
+// Open opens a bundle for reading
+func Open(path string) (*Reader, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		if _, serr := os.Stat(JournalPath(path)); serr == nil {
+			return nil, fmt.Errorf("failed to open %s: %w", path, ErrInterrupted)
+		}
+		return nil, fmt.Errorf("failed to open session bundle: %w", err)
+	}
+
+	r := &Reader{zip: zr, frames: map[string]*zip.File{}}
+	for _, f := range zr.File {
+		switch f.Name {
+		case "manifest.json":
+			if err := readJSON(f, &r.Manifest); err != nil {
+				zr.Close()
+				return nil, err
+			}
+		case "events.jsonl":
+			if err := r.readEvents(f); err != nil {
+				zr.Close()
+				return nil, err
+			}
+		default:
+			r.frames[f.Name] = f
+		}
+	}
+
+	if r.Manifest.Version == 0 {
+		zr.Close()
+		return nil, fmt.Errorf("not a session bundle: missing manifest")
+	}
+	if r.Manifest.Version > FormatVersion {
+		zr.Close()
+		return nil, fmt.Errorf("unsupported session bundle version %d", r.Manifest.Version)
+	}
+
+	sort.SliceStable(r.Events, func(i, j int) bool { return r.Elapsed(r.Events[i]) < r.Elapsed(r.Events[j]) })
+	return r, nil
+}
+
+// Close closes the bundle
+func (r *Reader) Close() error {
+	return r.zip.Close()
+}
+
+// Elapsed returns the time from the session start to e, at nanosecond
+// precision for bundles with monotonic timestamps
+func (r *Reader) Elapsed(e Event) time.Duration {
+	if r.Manifest.Clock == "" {
+		return time.Duration(e.Offset) * time.Millisecond
+	}
+	return time.Duration(e.Mono - r.Manifest.MonotonicStart)
+}
+
+// Frame decodes frame n
+func (r *Reader) Frame(n int) (image.Image, error) {
+	f, ok := r.frames[frameName(n)]
+	if !ok {
+		return nil, fmt.Errorf("frame %d not found (bundle has %d frames)", n, r.Manifest.Frames)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read frame %d: %w", n, err)
+	}
+	defer rc.Close()
+
+	img, err := png.Decode(bufio.NewReader(rc))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode frame %d: %w", n, err)
+	}
+	return img, nil
+}
+
+// readEvents parses the events.jsonl timeline
+func (r *Reader) readEvents(f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("failed to read events: %w", err)
+	}
+	defer rc.Close()
+
+	dec := json.NewDecoder(rc)
+	for {
+		var e Event
+		if err := dec.Decode(&e); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to parse events: %w", err)
+		}
+		r.Events = append(r.Events, e)
+	}
+}
+
+// readJSON decodes a JSON file from the archive
+func readJSON(f *zip.File, v any) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	if err := json.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", f.Name, err)
+	}
+	return nil
+}
+
+// frameName returns the archive path of frame n
+func frameName(n int) string {
+	return fmt.Sprintf("frames/%06d.png", n)
+}
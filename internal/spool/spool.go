@@ -0,0 +1,375 @@
+// Package spool keeps uploads that failed (network down) on disk and
+// sends them later, oldest first, backing off while they keep failing.
+// Each queued upload is a directory holding a copy of the capture and an
+// entry.json describing it.
+package spool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/robotin/screenshot/internal/lock"
+	"github.com/robotin/screenshot/internal/paths"
+)
+
+// Backoff between attempts: doubling from minBackoff up to maxBackoff
+const (
+	minBackoff = 30 * time.Second
+	maxBackoff = time.Hour
+)
+
+// entryFile describes a queued upload in its directory
+const entryFile = "entry.json"
+
+var (
+	// ErrRejected marks a send failure that retrying won't fix; Flush
+	// drops the entry instead of retrying it
+	ErrRejected = errors.New("upload rejected")
+
+	// ErrBusy is returned by Flush while another process is flushing
+	ErrBusy = errors.New("the upload spool is being sent by another process")
+
+	// ErrTooLarge is returned by Add for files bigger than the whole spool
+	ErrTooLarge = errors.New("capture is larger than the upload spool")
+)
+
+// Entry is a queued upload
+type Entry struct {
+	// ID orders entries: the time they were queued, in nanoseconds
+	ID string `json:"-"`
+
+	// Target is the upload target (e.g. "s3://bucket/kiosks")
+	Target string `json:"target"`
+
+	// Name is the capture's file name
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+
+	Queued   time.Time `json:"queued"`
+	Attempts int       `json:"attempts"`
+
+	// Next is when the entry may be tried again
+	Next      time.Time `json:"next,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+
+	// Meta is the caller's data about the capture
+	Meta json.RawMessage `json:"meta,omitempty"`
+
+	dir string
+}
+
+// File returns the queued copy of the capture
+func (e *Entry) File() string {
+	return filepath.Join(e.dir, e.Name)
+}
+
+// Spool is a directory of queued uploads
+type Spool struct {
+	dir     string
+	maxSize int64
+}
+
+// DefaultDir returns the spool directory in the state directory
+func DefaultDir() (string, error) {
+	dir, err := paths.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "spool"), nil
+}
+
+// Open returns the spool in dir, holding at most maxSize bytes of
+// captures. The directory is created on first use.
+func Open(dir string, maxSize int64) *Spool {
+	return &Spool{dir: dir, maxSize: maxSize}
+}
+
+// Dir returns the spool directory
+func (s *Spool) Dir() string {
+	return s.dir
+}
+
+// Add queues a copy of the file at path for upload to target, with meta
+// kept for the caller. failure is why the upload was queued: the error
+// of a failed attempt, which starts the backoff, or nil for an upload
+// queued behind others without an attempt. The oldest entries are
+// dropped to keep the spool within its size and returned.
+func (s *Spool) Add(path, target string, meta any, failure error) (*Entry, []Entry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to queue upload: %w", err)
+	}
+	if info.Size() > s.maxSize {
+		return nil, nil, fmt.Errorf("%w (%d bytes, the limit is %d)", ErrTooLarge, info.Size(), s.maxSize)
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	e := &Entry{
+		Target: target,
+		Name:   filepath.Base(path),
+		Size:   info.Size(),
+		Queued: time.Now(),
+		Meta:   data,
+	}
+	if failure != nil {
+		e.failed(failure)
+	}
+
+	var dropped []Entry
+	err = s.locked(func() error {
+		entries, err := s.list()
+		if err != nil {
+			return err
+		}
+		total := e.Size
+		for _, q := range entries {
+			total += q.Size
+		}
+		for len(entries) > 0 && total > s.maxSize {
+			if err := os.RemoveAll(entries[0].dir); err != nil {
+				return fmt.Errorf("failed to drop queued upload: %w", err)
+			}
+			total -= entries[0].Size
+			dropped = append(dropped, entries[0])
+			entries = entries[1:]
+		}
+
+		if err := s.create(e); err != nil {
+			return err
+		}
+		if err := linkOrCopy(path, e.File()); err != nil {
+			os.RemoveAll(e.dir)
+			return fmt.Errorf("failed to queue upload: %w", err)
+		}
+		// Written last: a directory without it is a crashed Add
+		if err := e.save(); err != nil {
+			os.RemoveAll(e.dir)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, dropped, err
+	}
+	return e, dropped, nil
+}
+
+// create makes the entry's directory, named for the time so entries sort
+// in queue order
+func (s *Spool) create(e *Entry) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	for n := e.Queued.UnixNano(); ; n++ {
+		e.ID = fmt.Sprintf("%020d", n)
+		e.dir = filepath.Join(s.dir, e.ID)
+		err := os.Mkdir(e.dir, 0700)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("failed to queue upload: %w", err)
+		}
+	}
+}
+
+// Entries returns the queued uploads, oldest first
+func (s *Spool) Entries() ([]Entry, error) {
+	var entries []Entry
+	err := s.locked(func() error {
+		var err error
+		entries, err = s.list()
+		return err
+	})
+	return entries, err
+}
+
+// Size returns the number of queued uploads and their total size
+func (s *Spool) Size() (int, int64, error) {
+	entries, err := s.Entries()
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+	return len(entries), total, err
+}
+
+// Flush sends queued uploads oldest first, stopping at the first that
+// fails or, unless force is set, isn't due for another attempt yet, so
+// they arrive in order. A failed entry is retried after a backoff; one
+// whose error wraps ErrRejected is dropped and the next one sent. It
+// returns how many were sent and the error that stopped it.
+func (s *Spool) Flush(force bool, send func(*Entry) error) (int, error) {
+	l, err := lock.TryAcquire(filepath.Join(s.dir, ".flush.lock"))
+	if errors.Is(err, lock.ErrLocked) {
+		return 0, ErrBusy
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer l.Release()
+
+	sent := 0
+	for {
+		entries, err := s.Entries()
+		if err != nil || len(entries) == 0 {
+			return sent, err
+		}
+		e := &entries[0]
+		if !force && time.Now().Before(e.Next) {
+			return sent, nil
+		}
+
+		err = send(e)
+		switch {
+		case err == nil:
+			sent++
+			if err := s.remove(e); err != nil {
+				return sent, err
+			}
+		case errors.Is(err, ErrRejected):
+			if err := s.remove(e); err != nil {
+				return sent, err
+			}
+		default:
+			e.failed(err)
+			if serr := s.locked(e.save); serr != nil && !errors.Is(serr, os.ErrNotExist) {
+				return sent, serr
+			}
+			return sent, err
+		}
+	}
+}
+
+// Clear drops every queued upload and returns them
+func (s *Spool) Clear() ([]Entry, error) {
+	var entries []Entry
+	err := s.locked(func() error {
+		var err error
+		if entries, err = s.list(); err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := os.RemoveAll(e.dir); err != nil {
+				return fmt.Errorf("failed to clear spool: %w", err)
+			}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// remove drops a sent or rejected entry
+func (s *Spool) remove(e *Entry) error {
+	return s.locked(func() error {
+		if err := os.RemoveAll(e.dir); err != nil {
+			return fmt.Errorf("failed to remove queued upload: %w", err)
+		}
+		return nil
+	})
+}
+
+// list reads the queued entries, oldest first. Must be called with the
+// lock held.
+func (s *Spool) list() ([]Entry, error) {
+	dirs, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool: %w", err)
+	}
+
+	var entries []Entry
+	for _, d := range dirs {
+		if _, err := strconv.ParseInt(d.Name(), 10, 64); err != nil || !d.IsDir() {
+			continue
+		}
+		dir := filepath.Join(s.dir, d.Name())
+		data, err := os.ReadFile(filepath.Join(dir, entryFile))
+		if err != nil {
+			// Being added, or left by a crash while it was
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(data, &e); err != nil {
+			continue
+		}
+		e.ID, e.dir = d.Name(), dir
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries, nil
+}
+
+// locked runs fn holding the spool lock, so concurrent captures don't
+// lose each other's entries
+func (s *Spool) locked(fn func() error) error {
+	l, err := lock.Acquire(filepath.Join(s.dir, ".lock"))
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+	return fn()
+}
+
+// failed records a failed attempt and schedules the next
+func (e *Entry) failed(err error) {
+	e.Attempts++
+	e.LastError = err.Error()
+	e.Next = time.Now().Add(backoff(e.Attempts))
+}
+
+// save writes the entry's description
+func (e *Entry) save() error {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(e.dir, entryFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write queued upload: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// backoff is the wait after a number of failed attempts
+func backoff(attempts int) time.Duration {
+	d := minBackoff
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
+
+// linkOrCopy puts a copy of src at dst, as a hard link if it can
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,178 @@
+//go:build !noadb && !minimal
+
+package strategy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterWithOptionalArg("adb", func(serial string) (Strategy, error) {
+		return NewADBStrategy(serial), nil
+	})
+}
+
+// adbTimeout bounds each adb call, so an unplugged or unauthorized device
+// fails the capture instead of hanging it
+const adbTimeout = 30 * time.Second
+
+// ADBStrategy captures the screen of an Android device connected over
+// adb (USB or adb connect) with screencap, so device screenshots go
+// through the same output, annotation and upload options as desktop
+// ones. Only the default display is captured. It is never picked
+// automatically; select it with --backend adb, or adb:SERIAL when more
+// than one device is connected.
+type ADBStrategy struct {
+	serial string
+}
+
+// NewADBStrategy creates an adb strategy for the device with the given
+// serial; empty means the only connected device
+func NewADBStrategy(serial string) *ADBStrategy {
+	return &ADBStrategy{serial: serial}
+}
+
+// Name returns the strategy name
+func (s *ADBStrategy) Name() string {
+	return "adb"
+}
+
+// Available checks that adb is installed and the device is online
+func (s *ADBStrategy) Available() bool {
+	out, err := s.run("get-state")
+	return err == nil && strings.TrimSpace(string(out)) == "device"
+}
+
+// run runs an adb command against the device and returns its stdout
+func (s *ADBStrategy) run(args ...string) ([]byte, error) {
+	path, err := exec.LookPath("adb")
+	if err != nil {
+		return nil, fmt.Errorf("adb not found: install the Android platform tools")
+	}
+	if s.serial != "" {
+		args = append([]string{"-s", s.serial}, args...)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), adbTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("adb %s: %s", strings.Join(args, " "), strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("adb %s: %w", strings.Join(args, " "), err)
+	}
+	return out, nil
+}
+
+// screencap captures the device's screen as it is currently rotated
+func (s *ADBStrategy) screencap() (image.Image, error) {
+	out, err := s.run("exec-out", "screencap", "-p")
+	if err != nil {
+		return nil, err
+	}
+	img, err := png.Decode(bytes.NewReader(out))
+	if err != nil {
+		// screencap prints its errors on stdout
+		msg := strings.TrimSpace(string(out[:min(len(out), 200)]))
+		return nil, fmt.Errorf("screencap returned no image (%s): %w", msg, err)
+	}
+	return img, nil
+}
+
+// Capture takes a screenshot of the device; a region is cut from the
+// full screen
+func (s *ADBStrategy) Capture(opts CaptureOptions) (image.Image, error) {
+	if opts.Monitor > 0 {
+		return nil, fmt.Errorf("monitor %d out of range (0-0)", opts.Monitor)
+	}
+	img, err := s.screencap()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Region == nil {
+		return img, nil
+	}
+	b := img.Bounds()
+	return Composite(*opts.Region, []Part{{Bounds: b.Sub(b.Min), Image: img}}), nil
+}
+
+var (
+	// adbDisplayInfo matches the default display's line in dumpsys
+	// display, e.g. DisplayInfo{"Built-in Screen", displayId 0, ...,
+	// real 1080 x 2400, ..., density 420 (403.4 x 403.0) dpi, ...}
+	adbDisplayInfo = regexp.MustCompile(`DisplayInfo\{"[^"]*", displayId 0\b`)
+	adbRealSize    = regexp.MustCompile(`\breal (\d+) x (\d+)`)
+	adbDPI         = regexp.MustCompile(`\(([\d.]+) x [\d.]+\) dpi`)
+)
+
+// adbDisplay parses the default display's size at its current rotation
+// and its horizontal DPI (0 if unknown) from dumpsys display. The
+// override info, which window manager updates on rotation, wins over the
+// device's base info.
+func adbDisplay(dumpsys string) (size image.Point, dpi float64, ok bool) {
+	var line string
+	for _, l := range strings.Split(dumpsys, "\n") {
+		if !adbDisplayInfo.MatchString(l) || !adbRealSize.MatchString(l) {
+			continue
+		}
+		if line == "" || strings.Contains(l, "mOverrideDisplayInfo") {
+			line = l
+		}
+	}
+	if line == "" {
+		return image.Point{}, 0, false
+	}
+
+	m := adbRealSize.FindStringSubmatch(line)
+	size.X, _ = strconv.Atoi(m[1])
+	size.Y, _ = strconv.Atoi(m[2])
+	if m := adbDPI.FindStringSubmatch(line); m != nil {
+		dpi, _ = strconv.ParseFloat(m[1], 64)
+	}
+	return size, dpi, size.X > 0 && size.Y > 0
+}
+
+// ListMonitors returns the device's screen, named by its serial, at its
+// current rotation. The size comes from dumpsys display, or from a
+// capture if it can't be parsed.
+func (s *ADBStrategy) ListMonitors() ([]Monitor, error) {
+	name := s.serial
+	if name == "" {
+		out, err := s.run("get-serialno")
+		if err != nil {
+			return nil, err
+		}
+		name = strings.TrimSpace(string(out))
+	}
+	m := Monitor{Name: name, Primary: true}
+
+	if out, err := s.run("shell", "dumpsys", "display"); err == nil {
+		if size, dpi, ok := adbDisplay(string(out)); ok {
+			m.Bounds = image.Rectangle{Max: size}
+			if dpi > 0 {
+				m.WidthMM = int(math.Round(float64(size.X) * 25.4 / dpi))
+			}
+		}
+	}
+	if m.Bounds.Empty() {
+		img, err := s.screencap()
+		if err != nil {
+			return nil, err
+		}
+		m.Bounds = img.Bounds().Sub(img.Bounds().Min)
+	}
+	return []Monitor{m}, nil
+}
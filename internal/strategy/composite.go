@@ -0,0 +1,85 @@
+package strategy
+
+import (
+	"image"
+	"image/draw"
+	"sync"
+)
+
+// Part is one monitor's image and where it goes on the desktop
+type Part struct {
+	Bounds image.Rectangle
+	Image  image.Image
+}
+
+// Composite assembles parts into one image covering area, with the
+// top-left of area at 0,0 and opaque black wherever no part is. Parts are
+// copied in parallel, row by row when they are RGBA.
+func Composite(area image.Rectangle, parts []Part) *image.RGBA {
+	canvas := image.NewRGBA(image.Rect(0, 0, area.Dx(), area.Dy()))
+
+	exact, disjoint := coverage(area, parts)
+	if !exact {
+		// Gaps between monitors of different sizes
+		draw.Draw(canvas, canvas.Bounds(), image.Black, image.Point{}, draw.Src)
+	}
+	if !disjoint {
+		// Overlapping (e.g. mirrored) monitors: later parts win, so keep
+		// the order
+		for _, p := range parts {
+			r := p.Bounds.Intersect(area)
+			blit(canvas, r.Sub(area.Min), p.Image, r.Min.Sub(p.Bounds.Min))
+		}
+		return canvas
+	}
+
+	var wg sync.WaitGroup
+	for _, p := range parts {
+		wg.Add(1)
+		go func(p Part) {
+			defer wg.Done()
+			r := p.Bounds.Intersect(area)
+			blit(canvas, r.Sub(area.Min), p.Image, r.Min.Sub(p.Bounds.Min))
+		}(p)
+	}
+	wg.Wait()
+	return canvas
+}
+
+// coverage reports whether parts cover area exactly once, and whether
+// they are disjoint
+func coverage(area image.Rectangle, parts []Part) (exact, disjoint bool) {
+	covered := 0
+	for i, p := range parts {
+		r := p.Bounds.Intersect(area)
+		for _, q := range parts[:i] {
+			if r.Overlaps(q.Bounds.Intersect(area)) {
+				return false, false
+			}
+		}
+		covered += r.Dx() * r.Dy()
+	}
+	return covered == area.Dx()*area.Dy(), true
+}
+
+// blit copies src, starting at sp relative to its top-left corner, into
+// r of dst
+func blit(dst *image.RGBA, r image.Rectangle, src image.Image, sp image.Point) {
+	if r.Empty() {
+		return
+	}
+	sp = sp.Add(src.Bounds().Min)
+
+	s, ok := src.(*image.RGBA)
+	if !ok {
+		draw.Draw(dst, r, src, sp, draw.Src)
+		return
+	}
+
+	n := r.Dx() * 4
+	for y := 0; y < r.Dy(); y++ {
+		d := dst.PixOffset(r.Min.X, r.Min.Y+y)
+		o := s.PixOffset(sp.X, sp.Y+y)
+		copy(dst.Pix[d:d+n], s.Pix[o:o+n])
+	}
+}
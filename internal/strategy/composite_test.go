@@ -0,0 +1,40 @@
+package strategy
+
+import (
+	"image"
+	"testing"
+)
+
+// BenchmarkComposite stitches two 1080p monitors side by side, which
+// takes the parallel fast path, and mirrored on top of each other, which
+// takes the ordered path for overlapping parts
+func BenchmarkComposite(b *testing.B) {
+	left := image.Rect(0, 0, 1920, 1080)
+	right := left.Add(image.Pt(1920, 0))
+
+	for _, bc := range []struct {
+		name     string
+		area     image.Rectangle
+		parts    []Part
+		disjoint bool
+	}{
+		{"disjoint", left.Union(right), []Part{
+			{Bounds: left, Image: image.NewRGBA(left)},
+			{Bounds: right, Image: image.NewRGBA(right)},
+		}, true},
+		{"overlapping", left, []Part{
+			{Bounds: left, Image: image.NewRGBA(left)},
+			{Bounds: left, Image: image.NewRGBA(left)},
+		}, false},
+	} {
+		if _, disjoint := coverage(bc.area, bc.parts); disjoint != bc.disjoint {
+			b.Fatalf("%s: parts are disjoint=%v, want %v", bc.name, disjoint, bc.disjoint)
+		}
+		b.Run(bc.name, func(b *testing.B) {
+			b.SetBytes(int64(bc.area.Dx() * bc.area.Dy() * 4))
+			for i := 0; i < b.N; i++ {
+				Composite(bc.area, bc.parts)
+			}
+		})
+	}
+}
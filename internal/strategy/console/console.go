@@ -0,0 +1,149 @@
+//go:build linux && !noconsole
+
+package console
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+	"unsafe"
+
+	"github.com/robotin/screenshot/internal/strategy"
+	"golang.org/x/sys/unix"
+)
+
+// Backends are registered after the ones in package strategy, so X11 is
+// still preferred when a display server is running. DispmanX comes
+// before kms and fbdev: on the legacy firmware stack it is the only one
+// that sees video and EGL layers.
+func init() {
+	if newDispmanX != nil {
+		strategy.Register("dispmanx", newDispmanX)
+	}
+	strategy.Register("kms", func() strategy.Strategy { return NewKMSStrategy() })
+	strategy.Register("fbdev", func() strategy.Strategy { return NewFBDevStrategy() })
+}
+
+// ioctl issues an ioctl whose argument is a pointer to arg
+func ioctl(fd int, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// ioc encodes an ioctl request number
+func ioc(dir, typ, nr, size uintptr) uintptr {
+	return dir<<iocDirShift | size<<16 | typ<<8 | nr
+}
+
+// pixelLayout describes packed little-endian RGB pixels
+type pixelLayout struct {
+	bytes            int
+	red, green, blue channel
+}
+
+// newPixelLayout returns the layout for bpp bits per pixel with the
+// given color masks
+func newPixelLayout(bpp int, red, green, blue uint32) pixelLayout {
+	return pixelLayout{bytes: bpp / 8, red: newChannel(red), green: newChannel(green), blue: newChannel(blue)}
+}
+
+// decode converts the area of a framebuffer with the given row pitch into
+// an opaque RGBA image. The area must lie inside the framebuffer.
+func (l pixelLayout) decode(fb []byte, pitch int, area image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, area.Dx(), area.Dy()))
+	for y := 0; y < area.Dy(); y++ {
+		row := fb[(area.Min.Y+y)*pitch+area.Min.X*l.bytes:]
+		out := img.Pix[y*img.Stride:]
+		for x := 0; x < area.Dx(); x++ {
+			var p uint32
+			for i := 0; i < l.bytes; i++ {
+				p |= uint32(row[x*l.bytes+i]) << (8 * i)
+			}
+			out[x*4] = l.red.value(p)
+			out[x*4+1] = l.green.value(p)
+			out[x*4+2] = l.blue.value(p)
+			out[x*4+3] = 255
+		}
+	}
+	return img
+}
+
+// channel extracts one color component from a pixel value and scales it
+// to 8 bits
+type channel struct {
+	mask  uint32
+	shift int
+	max   uint32
+}
+
+func newChannel(mask uint32) channel {
+	if mask == 0 {
+		return channel{}
+	}
+	shift := bits.TrailingZeros32(mask)
+	return channel{mask: mask, shift: shift, max: mask >> shift}
+}
+
+func (c channel) value(p uint32) uint8 {
+	if c.max == 0 {
+		return 0
+	}
+	return uint8(((p & c.mask) >> c.shift) * 255 / c.max)
+}
+
+// sideBySide places monitors of the given sizes left to right, top
+// aligned: console outputs have no shared coordinate space
+func sideBySide(sizes []image.Point, names []string) []strategy.Monitor {
+	monitors := make([]strategy.Monitor, len(sizes))
+	x := 0
+	for i, sz := range sizes {
+		monitors[i] = strategy.Monitor{
+			Index:  i,
+			Name:   names[i],
+			Bounds: image.Rect(x, 0, x+sz.X, sz.Y),
+		}
+		x += sz.X
+	}
+	if len(monitors) > 0 {
+		monitors[0].Primary = true
+	}
+	return monitors
+}
+
+// capture implements Capture for backends that read one monitor at a
+// time: it grabs the monitors the requested area touches and assembles
+// them, with images starting at 0,0 like the X11 backend
+func capture(opts strategy.CaptureOptions, monitors []strategy.Monitor, grab func(i int) (image.Image, error)) (image.Image, error) {
+	var rect image.Rectangle
+	switch {
+	case opts.Region != nil:
+		rect = *opts.Region
+	case opts.Monitor == -1:
+		for _, m := range monitors {
+			rect = rect.Union(m.Bounds)
+		}
+	case opts.Monitor < 0 || opts.Monitor >= len(monitors):
+		return nil, fmt.Errorf("monitor %d out of range (0-%d)", opts.Monitor, len(monitors)-1)
+	default:
+		return grab(opts.Monitor)
+	}
+	if rect.Empty() {
+		return nil, fmt.Errorf("empty capture area %v", rect)
+	}
+
+	var parts []strategy.Part
+	for i, m := range monitors {
+		if !m.Bounds.Overlaps(rect) {
+			continue
+		}
+		img, err := grab(i)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, strategy.Part{Bounds: m.Bounds, Image: img})
+	}
+	return strategy.Composite(rect, parts), nil
+}
@@ -0,0 +1,154 @@
+//go:build linux && !noconsole && dispmanx && cgo
+
+package console
+
+/*
+#cgo CFLAGS: -I/opt/vc/include
+#cgo LDFLAGS: -L/opt/vc/lib -lbcm_host -lvchiq_arm -lvcos
+
+#include <stdlib.h>
+#include <bcm_host.h>
+
+// display_size returns 0 and the size of a DispmanX display, or -1 if
+// it isn't connected
+static int display_size(uint32_t id, int *width, int *height) {
+	DISPMANX_DISPLAY_HANDLE_T display = vc_dispmanx_display_open(id);
+	if (display == DISPMANX_NO_HANDLE) {
+		return -1;
+	}
+	DISPMANX_MODEINFO_T info;
+	int ret = vc_dispmanx_display_get_info(display, &info);
+	vc_dispmanx_display_close(display);
+	if (ret != 0) {
+		return -1;
+	}
+	*width = info.width;
+	*height = info.height;
+	return 0;
+}
+
+// snapshot composites all layers of a display into an RGB888 buffer
+static int snapshot(uint32_t id, int width, int height, void *buf, int pitch) {
+	DISPMANX_DISPLAY_HANDLE_T display = vc_dispmanx_display_open(id);
+	if (display == DISPMANX_NO_HANDLE) {
+		return -1;
+	}
+	uint32_t image;
+	DISPMANX_RESOURCE_HANDLE_T res = vc_dispmanx_resource_create(VC_IMAGE_RGB888, width, height, &image);
+	if (res == DISPMANX_NO_HANDLE) {
+		vc_dispmanx_display_close(display);
+		return -2;
+	}
+	int ret = -3;
+	if (vc_dispmanx_snapshot(display, res, DISPMANX_NO_ROTATE) == 0) {
+		VC_RECT_T rect;
+		vc_dispmanx_rect_set(&rect, 0, 0, width, height);
+		ret = vc_dispmanx_resource_read_data(res, &rect, buf, pitch) == 0 ? 0 : -4;
+	}
+	vc_dispmanx_resource_delete(res);
+	vc_dispmanx_display_close(display);
+	return ret;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"image"
+	"sync"
+	"unsafe"
+
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+var newDispmanX strategy.Factory = func() strategy.Strategy { return NewDispmanXStrategy() }
+
+// dispmanxDisplays are the firmware's display IDs, in the order monitors
+// are listed
+var dispmanxDisplays = []struct {
+	id   C.uint32_t
+	name string
+}{
+	{0, "LCD"},
+	{2, "HDMI-0"},
+	{7, "HDMI-1"},
+	{3, "SDTV"},
+}
+
+var bcmHostInit sync.Once
+
+// DispmanXStrategy snapshots the Raspberry Pi firmware compositor
+// (legacy graphics stack, without the vc4-kms-v3d overlay), including the
+// video and EGL layers the framebuffer doesn't have. It needs cgo and
+// the firmware's bcm_host library, so it is only built with -tags
+// dispmanx on the Pi (or with a Pi sysroot).
+type DispmanXStrategy struct{}
+
+// NewDispmanXStrategy creates a new DispmanX screenshot strategy
+func NewDispmanXStrategy() *DispmanXStrategy {
+	bcmHostInit.Do(func() { C.bcm_host_init() })
+	return &DispmanXStrategy{}
+}
+
+// Name returns the strategy name
+func (s *DispmanXStrategy) Name() string {
+	return "dispmanx"
+}
+
+// Available checks for a connected DispmanX display
+func (s *DispmanXStrategy) Available() bool {
+	ids, _ := s.displays()
+	return len(ids) > 0
+}
+
+// displays returns the connected displays' IDs and monitors
+func (s *DispmanXStrategy) displays() ([]C.uint32_t, []strategy.Monitor) {
+	var ids []C.uint32_t
+	var sizes []image.Point
+	var names []string
+	for _, d := range dispmanxDisplays {
+		var w, h C.int
+		if C.display_size(d.id, &w, &h) != 0 || w <= 0 || h <= 0 {
+			continue
+		}
+		ids = append(ids, d.id)
+		sizes = append(sizes, image.Pt(int(w), int(h)))
+		names = append(names, d.name)
+	}
+	return ids, sideBySide(sizes, names)
+}
+
+// Capture snapshots the displays the requested area touches
+func (s *DispmanXStrategy) Capture(opts strategy.CaptureOptions) (image.Image, error) {
+	ids, monitors := s.displays()
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no DispmanX displays found")
+	}
+	return capture(opts, monitors, func(i int) (image.Image, error) {
+		size := monitors[i].Bounds.Size()
+
+		// Rows are padded to a multiple of 16 pixels
+		pitch := ((size.X + 15) &^ 15) * 3
+		buf := C.malloc(C.size_t(pitch * size.Y))
+		if buf == nil {
+			return nil, fmt.Errorf("out of memory")
+		}
+		defer C.free(buf)
+
+		if ret := C.snapshot(ids[i], C.int(size.X), C.int(size.Y), buf, C.int(pitch)); ret != 0 {
+			return nil, fmt.Errorf("DispmanX snapshot of %s failed (%d)", monitors[i].Name, int(ret))
+		}
+		data := unsafe.Slice((*byte)(buf), pitch*size.Y)
+		rgb := newPixelLayout(24, 0x0000ff, 0x00ff00, 0xff0000)
+		return rgb.decode(data, pitch, image.Rectangle{Max: size}), nil
+	})
+}
+
+// ListMonitors returns the connected displays, left to right
+func (s *DispmanXStrategy) ListMonitors() ([]strategy.Monitor, error) {
+	ids, monitors := s.displays()
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no DispmanX displays found")
+	}
+	return monitors, nil
+}
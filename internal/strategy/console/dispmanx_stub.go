@@ -0,0 +1,8 @@
+//go:build linux && !noconsole && !(dispmanx && cgo)
+
+package console
+
+import "github.com/robotin/screenshot/internal/strategy"
+
+// newDispmanX is nil: the dispmanx backend needs -tags dispmanx and cgo
+var newDispmanX strategy.Factory
@@ -0,0 +1,7 @@
+// Package console provides capture backends for Linux consoles without a
+// display server, as on Raspberry Pi signage: kms reads the framebuffers
+// being scanned out through DRM/KMS, fbdev reads /dev/fbN, and dispmanx
+// (opt-in with -tags dispmanx, needs cgo and the Pi's bcm_host library)
+// snapshots the legacy firmware compositor. The backends register
+// themselves; link them in with a blank import.
+package console
@@ -0,0 +1,203 @@
+//go:build linux && !noconsole
+
+package console
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/robotin/screenshot/internal/strategy"
+)
+
+// fbioGetVScreenInfo is FBIOGET_VSCREENINFO (linux/fb.h)
+const fbioGetVScreenInfo = 0x4600
+
+// fbBitfield is struct fb_bitfield
+type fbBitfield struct {
+	Offset   uint32
+	Length   uint32
+	MSBRight uint32
+}
+
+// mask returns the bitfield as a pixel mask
+func (b fbBitfield) mask() uint32 {
+	if b.Length == 0 {
+		return 0
+	}
+	return (1<<b.Length - 1) << b.Offset
+}
+
+// fbVarScreenInfo is struct fb_var_screeninfo
+type fbVarScreenInfo struct {
+	XRes, YRes               uint32
+	XResVirtual, YResVirtual uint32
+	XOffset, YOffset         uint32
+	BitsPerPixel             uint32
+	Grayscale                uint32
+	Red, Green, Blue, Transp fbBitfield
+	Nonstd, Activate         uint32
+	HeightMM, WidthMM        uint32
+	AccelFlags               uint32
+	_                        [7]uint32 // timings
+	_                        [4]uint32 // sync, vmode, rotate, colorspace
+	_                        [4]uint32
+}
+
+// FBDevStrategy reads the Linux framebuffer devices (/dev/fbN), one
+// monitor per device. On the Raspberry Pi's legacy firmware stack this is
+// the console and whatever draws to it directly (Qt linuxfb, SDL fbcon);
+// layers composited by the firmware (video, EGL) are not included, use
+// the dispmanx backend for those. Reading needs access to the device,
+// normally membership of the video group.
+type FBDevStrategy struct{}
+
+// NewFBDevStrategy creates a new framebuffer screenshot strategy
+func NewFBDevStrategy() *FBDevStrategy {
+	return &FBDevStrategy{}
+}
+
+// Name returns the strategy name
+func (s *FBDevStrategy) Name() string {
+	return "fbdev"
+}
+
+// Available checks for a readable framebuffer device
+func (s *FBDevStrategy) Available() bool {
+	devices, err := s.devices()
+	return err == nil && len(devices) > 0
+}
+
+// fbDevice is a framebuffer's geometry and pixel format
+type fbDevice struct {
+	path   string
+	name   string // fb0, fb1, ...
+	info   fbVarScreenInfo
+	pitch  int
+	layout pixelLayout
+}
+
+// devices returns the usable framebuffer devices in index order
+func (s *FBDevStrategy) devices() ([]fbDevice, error) {
+	paths, _ := filepath.Glob("/dev/fb[0-9]*")
+	sort.Slice(paths, func(i, j int) bool {
+		a, _ := strconv.Atoi(strings.TrimPrefix(paths[i], "/dev/fb"))
+		b, _ := strconv.Atoi(strings.TrimPrefix(paths[j], "/dev/fb"))
+		return a < b
+	})
+
+	var devices []fbDevice
+	var firstErr error
+	for _, path := range paths {
+		d, err := openFB(path)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		devices = append(devices, d)
+	}
+	if len(devices) == 0 {
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		return nil, fmt.Errorf("no framebuffer devices found")
+	}
+	return devices, nil
+}
+
+// openFB reads a framebuffer device's geometry and pixel format
+func openFB(path string) (fbDevice, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return fbDevice{}, fmt.Errorf("failed to open framebuffer: %w", err)
+	}
+	defer f.Close()
+
+	d := fbDevice{path: path, name: filepath.Base(path)}
+	if err := ioctl(int(f.Fd()), fbioGetVScreenInfo, unsafe.Pointer(&d.info)); err != nil {
+		return fbDevice{}, fmt.Errorf("failed to read %s screen info: %w", path, err)
+	}
+	if d.info.XRes == 0 || d.info.YRes == 0 {
+		return fbDevice{}, fmt.Errorf("%s has no active mode", path)
+	}
+
+	bpp := int(d.info.BitsPerPixel)
+	if d.info.Grayscale != 0 || (bpp != 16 && bpp != 24 && bpp != 32) {
+		return fbDevice{}, fmt.Errorf("unsupported %s pixel format (%d bits per pixel)", path, bpp)
+	}
+	d.layout = newPixelLayout(bpp, d.info.Red.mask(), d.info.Green.mask(), d.info.Blue.mask())
+
+	// The line length is in the fixed screen info, whose layout depends on
+	// the word size; sysfs has it as plain text
+	sys := filepath.Join("/sys/class/graphics", d.name)
+	d.pitch = int(d.info.XResVirtual) * bpp / 8
+	if b, err := os.ReadFile(filepath.Join(sys, "stride")); err == nil {
+		if n, err := strconv.Atoi(strings.TrimSpace(string(b))); err == nil && n > 0 {
+			d.pitch = n
+		}
+	}
+	return d, nil
+}
+
+// grab reads the visible part of a framebuffer
+func (d fbDevice) grab() (image.Image, error) {
+	f, err := os.Open(d.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open framebuffer: %w", err)
+	}
+	defer f.Close()
+
+	// Only the rows on screen, which start at the panning offset
+	w, h := int(d.info.XRes), int(d.info.YRes)
+	offset := int64(d.info.YOffset) * int64(d.pitch)
+	buf := make([]byte, h*d.pitch)
+	n, err := f.ReadAt(buf, offset)
+	if n < (h-1)*d.pitch+(int(d.info.XOffset)+w)*d.layout.bytes {
+		return nil, fmt.Errorf("failed to read framebuffer %s: %w", d.path, err)
+	}
+	area := image.Rect(int(d.info.XOffset), 0, int(d.info.XOffset)+w, h)
+	return d.layout.decode(buf, d.pitch, area), nil
+}
+
+// Capture reads the framebuffers the requested area touches
+func (s *FBDevStrategy) Capture(opts strategy.CaptureOptions) (image.Image, error) {
+	devices, err := s.devices()
+	if err != nil {
+		return nil, err
+	}
+	return capture(opts, fbMonitors(devices), func(i int) (image.Image, error) {
+		return devices[i].grab()
+	})
+}
+
+// ListMonitors returns one monitor per framebuffer device
+func (s *FBDevStrategy) ListMonitors() ([]strategy.Monitor, error) {
+	devices, err := s.devices()
+	if err != nil {
+		return nil, err
+	}
+	return fbMonitors(devices), nil
+}
+
+func fbMonitors(devices []fbDevice) []strategy.Monitor {
+	sizes := make([]image.Point, len(devices))
+	names := make([]string, len(devices))
+	for i, d := range devices {
+		sizes[i] = image.Pt(int(d.info.XRes), int(d.info.YRes))
+		names[i] = d.name
+	}
+	monitors := sideBySide(sizes, names)
+	for i, d := range devices {
+		if d.info.WidthMM > 0 && d.info.WidthMM < 0xffffffff {
+			monitors[i].WidthMM = int(d.info.WidthMM)
+		}
+	}
+	return monitors
+}
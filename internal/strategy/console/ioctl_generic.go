@@ -0,0 +1,10 @@
+//go:build linux && !noconsole && !mips && !mipsle && !mips64 && !mips64le && !ppc64 && !ppc64le
+
+package console
+
+// Linux ioctl request encoding (asm-generic/ioctl.h)
+const (
+	iocWrite    = 1
+	iocRead     = 2
+	iocDirShift = 30
+)
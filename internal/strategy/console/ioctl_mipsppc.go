@@ -0,0 +1,11 @@
+//go:build linux && !noconsole && (mips || mipsle || mips64 || mips64le || ppc64 || ppc64le)
+
+package console
+
+// Linux ioctl request encoding on MIPS and PowerPC, which use three
+// direction bits
+const (
+	iocWrite    = 4
+	iocRead     = 2
+	iocDirShift = 29
+)
@@ -0,0 +1,465 @@
+//go:build linux && !noconsole
+
+package console
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"sort"
+	"unsafe"
+
+	"github.com/robotin/screenshot/internal/strategy"
+	"golang.org/x/sys/unix"
+)
+
+// DRM ioctls (drm.h, drm_mode.h)
+var (
+	drmIoctlGemClose         = ioc(iocWrite, 'd', 0x09, unsafe.Sizeof(drmGemClose{}))
+	drmIoctlPrimeHandleToFD  = ioc(iocRead|iocWrite, 'd', 0x2d, unsafe.Sizeof(drmPrimeHandle{}))
+	drmIoctlModeGetResources = ioc(iocRead|iocWrite, 'd', 0xA0, unsafe.Sizeof(drmModeCardRes{}))
+	drmIoctlModeGetCrtc      = ioc(iocRead|iocWrite, 'd', 0xA1, unsafe.Sizeof(drmModeCrtc{}))
+	drmIoctlModeGetEncoder   = ioc(iocRead|iocWrite, 'd', 0xA6, unsafe.Sizeof(drmModeGetEncoder{}))
+	drmIoctlModeGetConnector = ioc(iocRead|iocWrite, 'd', 0xA7, unsafe.Sizeof(drmModeGetConnector{}))
+	drmIoctlModeGetFB        = ioc(iocRead|iocWrite, 'd', 0xAD, unsafe.Sizeof(drmModeFBCmd{}))
+	drmIoctlModeMapDumb      = ioc(iocRead|iocWrite, 'd', 0xB3, unsafe.Sizeof(drmModeMapDumb{}))
+	drmIoctlModeGetFB2       = ioc(iocRead|iocWrite, 'd', 0xCE, unsafe.Sizeof(drmModeFBCmd2{}))
+
+	dmaBufIoctlSync = ioc(iocWrite, 'b', 0, 8)
+)
+
+const (
+	drmModeFBModifiers = 1 << 1
+	drmFormatModLinear = 0
+
+	dmaBufSyncRead  = 1 << 0
+	dmaBufSyncStart = 0 << 2
+	dmaBufSyncEnd   = 1 << 2
+)
+
+type drmGemClose struct {
+	Handle uint32
+	_      uint32
+}
+
+type drmPrimeHandle struct {
+	Handle uint32
+	Flags  uint32
+	FD     int32
+}
+
+type drmModeCardRes struct {
+	FBIDPtr, CrtcIDPtr, ConnectorIDPtr, EncoderIDPtr     uint64
+	CountFBs, CountCrtcs, CountConnectors, CountEncoders uint32
+	MinWidth, MaxWidth, MinHeight, MaxHeight             uint32
+}
+
+type drmModeModeInfo struct {
+	Clock                                         uint32
+	HDisplay, HSyncStart, HSyncEnd, HTotal, HSkew uint16
+	VDisplay, VSyncStart, VSyncEnd, VTotal, VScan uint16
+	VRefresh, Flags, Type                         uint32
+	Name                                          [32]byte
+}
+
+type drmModeCrtc struct {
+	SetConnectorsPtr uint64
+	CountConnectors  uint32
+	CrtcID, FBID     uint32
+	X, Y             uint32
+	GammaSize        uint32
+	ModeValid        uint32
+	Mode             drmModeModeInfo
+}
+
+type drmModeGetEncoder struct {
+	EncoderID, EncoderType, CrtcID, PossibleCrtcs, PossibleClones uint32
+}
+
+type drmModeGetConnector struct {
+	EncodersPtr, ModesPtr, PropsPtr, PropValuesPtr uint64
+	CountModes, CountProps, CountEncoders          uint32
+	EncoderID, ConnectorID                         uint32
+	ConnectorType, ConnectorTypeID                 uint32
+	Connection                                     uint32
+	MMWidth, MMHeight                              uint32
+	Subpixel                                       uint32
+	_                                              uint32
+}
+
+type drmModeFBCmd struct {
+	FBID, Width, Height, Pitch, BPP, Depth, Handle uint32
+}
+
+type drmModeFBCmd2 struct {
+	FBID, Width, Height, PixelFormat, Flags uint32
+	Handles, Pitches, Offsets               [4]uint32
+	_                                       uint32 // 64-bit alignment on every architecture
+	Modifier                                [4]uint64
+}
+
+type drmModeMapDumb struct {
+	Handle uint32
+	_      uint32
+	Offset uint64
+}
+
+// drmConnectorTypes names connectors as the kernel and Wayland
+// compositors do (HDMI-A-1, DSI-1)
+var drmConnectorTypes = map[uint32]string{
+	1: "VGA", 2: "DVI-I", 3: "DVI-D", 4: "DVI-A", 5: "Composite", 6: "SVIDEO",
+	7: "LVDS", 8: "Component", 9: "DIN", 10: "DP", 11: "HDMI-A", 12: "HDMI-B",
+	13: "TV", 14: "eDP", 15: "Virtual", 16: "DSI", 17: "DPI", 18: "Writeback",
+	19: "SPI", 20: "USB",
+}
+
+// fourcc builds a DRM pixel format code
+func fourcc(s string) uint32 {
+	return uint32(s[0]) | uint32(s[1])<<8 | uint32(s[2])<<16 | uint32(s[3])<<24
+}
+
+// drmFormats are the single-plane RGB formats kms can decode
+var drmFormats = map[uint32]pixelLayout{
+	fourcc("XR24"): newPixelLayout(32, 0xff0000, 0x00ff00, 0x0000ff),
+	fourcc("AR24"): newPixelLayout(32, 0xff0000, 0x00ff00, 0x0000ff),
+	fourcc("XB24"): newPixelLayout(32, 0x0000ff, 0x00ff00, 0xff0000),
+	fourcc("AB24"): newPixelLayout(32, 0x0000ff, 0x00ff00, 0xff0000),
+	fourcc("RG24"): newPixelLayout(24, 0xff0000, 0x00ff00, 0x0000ff),
+	fourcc("BG24"): newPixelLayout(24, 0x0000ff, 0x00ff00, 0xff0000),
+	fourcc("RG16"): newPixelLayout(16, 0xf800, 0x07e0, 0x001f),
+	fourcc("BG16"): newPixelLayout(16, 0x001f, 0x07e0, 0xf800),
+}
+
+// KMSStrategy reads the framebuffers the display controller is scanning
+// out, through DRM/KMS (/dev/dri/cardN), one monitor per connected output.
+// This works on consoles and kiosks without a display server, including
+// Raspberry Pis with the vc4-kms-v3d driver, whatever is drawing (fbcon,
+// Chromium or Qt on DRM). Only the primary plane is read: hardware
+// overlays such as some video players use are missing. Getting the
+// framebuffer from the kernel needs root (CAP_SYS_ADMIN).
+type KMSStrategy struct{}
+
+// NewKMSStrategy creates a new DRM/KMS screenshot strategy
+func NewKMSStrategy() *KMSStrategy {
+	return &KMSStrategy{}
+}
+
+// Name returns the strategy name
+func (s *KMSStrategy) Name() string {
+	return "kms"
+}
+
+// Available checks for a DRM device with an active output whose
+// framebuffer can be read
+func (s *KMSStrategy) Available() bool {
+	card, err := openCard()
+	if err != nil {
+		return false
+	}
+	defer card.close()
+
+	fb, err := card.framebuffer(card.outputs[0].fb)
+	if err != nil {
+		return false
+	}
+	fb.close()
+	return true
+}
+
+// kmsOutput is a connected output and the CRTC driving it
+type kmsOutput struct {
+	name    string
+	widthMM int
+	fb      uint32
+	area    image.Rectangle // the part of the framebuffer shown
+}
+
+// drmCard is an open DRM device with at least one active output
+type drmCard struct {
+	f       *os.File
+	outputs []kmsOutput
+}
+
+// openCard opens the first DRM device with an active output
+func openCard() (*drmCard, error) {
+	paths, _ := filepath.Glob("/dev/dri/card[0-9]*")
+	sort.Strings(paths)
+
+	err := errors.New("no DRM devices found")
+	for _, path := range paths {
+		f, ferr := os.OpenFile(path, os.O_RDWR|unix.O_CLOEXEC, 0)
+		if ferr != nil {
+			err = fmt.Errorf("failed to open %s: %w", path, ferr)
+			continue
+		}
+		card := &drmCard{f: f}
+		if card.outputs, ferr = card.activeOutputs(); ferr != nil {
+			f.Close()
+			err = fmt.Errorf("%s: %w", path, ferr)
+			continue
+		}
+		if len(card.outputs) == 0 {
+			f.Close()
+			err = fmt.Errorf("%s: no active outputs", path)
+			continue
+		}
+		return card, nil
+	}
+	return nil, err
+}
+
+func (c *drmCard) close() {
+	c.f.Close()
+}
+
+func (c *drmCard) ioctl(req uintptr, arg unsafe.Pointer) error {
+	return ioctl(int(c.f.Fd()), req, arg)
+}
+
+// activeOutputs lists the connected outputs that are showing a
+// framebuffer, in connector order
+func (c *drmCard) activeOutputs() ([]kmsOutput, error) {
+	var res drmModeCardRes
+	if err := c.ioctl(drmIoctlModeGetResources, unsafe.Pointer(&res)); err != nil {
+		return nil, fmt.Errorf("not a KMS device: %w", err)
+	}
+	if res.CountConnectors == 0 {
+		return nil, nil
+	}
+	connectors := make([]uint32, res.CountConnectors)
+	res = drmModeCardRes{
+		ConnectorIDPtr:  uint64(uintptr(unsafe.Pointer(&connectors[0]))),
+		CountConnectors: uint32(len(connectors)),
+	}
+	if err := c.ioctl(drmIoctlModeGetResources, unsafe.Pointer(&res)); err != nil {
+		return nil, fmt.Errorf("failed to read DRM resources: %w", err)
+	}
+	connectors = connectors[:min(len(connectors), int(res.CountConnectors))]
+
+	var outputs []kmsOutput
+	for _, id := range connectors {
+		conn := drmModeGetConnector{ConnectorID: id}
+		if err := c.ioctl(drmIoctlModeGetConnector, unsafe.Pointer(&conn)); err != nil {
+			continue
+		}
+		if conn.Connection != 1 || conn.EncoderID == 0 {
+			continue
+		}
+		enc := drmModeGetEncoder{EncoderID: conn.EncoderID}
+		if err := c.ioctl(drmIoctlModeGetEncoder, unsafe.Pointer(&enc)); err != nil || enc.CrtcID == 0 {
+			continue
+		}
+		crtc := drmModeCrtc{CrtcID: enc.CrtcID}
+		if err := c.ioctl(drmIoctlModeGetCrtc, unsafe.Pointer(&crtc)); err != nil {
+			continue
+		}
+		if crtc.ModeValid == 0 || crtc.FBID == 0 {
+			continue
+		}
+
+		typ, ok := drmConnectorTypes[conn.ConnectorType]
+		if !ok {
+			typ = "Unknown"
+		}
+		x, y := int(crtc.X), int(crtc.Y)
+		outputs = append(outputs, kmsOutput{
+			name:    fmt.Sprintf("%s-%d", typ, conn.ConnectorTypeID),
+			widthMM: int(conn.MMWidth),
+			fb:      crtc.FBID,
+			area:    image.Rect(x, y, x+int(crtc.Mode.HDisplay), y+int(crtc.Mode.VDisplay)),
+		})
+	}
+	return outputs, nil
+}
+
+// drmFramebuffer is a framebuffer mapped for reading
+type drmFramebuffer struct {
+	data   []byte
+	offset int
+	pitch  int
+	layout pixelLayout
+	bounds image.Rectangle
+	dmabuf int // -1 for dumb buffer mappings
+}
+
+func (fb *drmFramebuffer) close() {
+	if fb.dmabuf >= 0 {
+		sync := uint64(dmaBufSyncEnd | dmaBufSyncRead)
+		ioctl(fb.dmabuf, dmaBufIoctlSync, unsafe.Pointer(&sync))
+		unix.Close(fb.dmabuf)
+	}
+	unix.Munmap(fb.data)
+}
+
+// framebuffer maps a framebuffer: exported as a dma-buf, or as a dumb
+// buffer for drivers that can't export it
+func (c *drmCard) framebuffer(id uint32) (*drmFramebuffer, error) {
+	fb, handle, err := c.framebufferInfo(id)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		gc := drmGemClose{Handle: handle}
+		c.ioctl(drmIoctlGemClose, unsafe.Pointer(&gc))
+	}()
+
+	size := fb.offset + fb.bounds.Dy()*fb.pitch
+	prime := drmPrimeHandle{Handle: handle, Flags: unix.O_CLOEXEC}
+	if err := c.ioctl(drmIoctlPrimeHandleToFD, unsafe.Pointer(&prime)); err == nil {
+		if fb.data, err = unix.Mmap(int(prime.FD), 0, size, unix.PROT_READ, unix.MAP_SHARED); err == nil {
+			fb.dmabuf = int(prime.FD)
+			sync := uint64(dmaBufSyncStart | dmaBufSyncRead)
+			ioctl(fb.dmabuf, dmaBufIoctlSync, unsafe.Pointer(&sync))
+			return fb, nil
+		}
+		unix.Close(int(prime.FD))
+	}
+
+	dumb := drmModeMapDumb{Handle: handle}
+	if err := c.ioctl(drmIoctlModeMapDumb, unsafe.Pointer(&dumb)); err != nil {
+		return nil, fmt.Errorf("failed to map framebuffer %d: %w", id, err)
+	}
+	if fb.data, err = unix.Mmap(int(c.f.Fd()), int64(dumb.Offset), size, unix.PROT_READ, unix.MAP_SHARED); err != nil {
+		return nil, fmt.Errorf("failed to map framebuffer %d: %w", id, err)
+	}
+	fb.dmabuf = -1
+	return fb, nil
+}
+
+// framebufferInfo reads a framebuffer's format and a GEM handle to its
+// memory, with GETFB2 where the kernel has it (5.7+), else GETFB
+func (c *drmCard) framebufferInfo(id uint32) (*drmFramebuffer, uint32, error) {
+	var (
+		handle uint32
+		layout pixelLayout
+		ok     bool
+		fb     = &drmFramebuffer{}
+	)
+
+	cmd2 := drmModeFBCmd2{FBID: id}
+	if err := c.ioctl(drmIoctlModeGetFB2, unsafe.Pointer(&cmd2)); err == nil {
+		handle = cmd2.Handles[0]
+		if handle != 0 && cmd2.Handles[1] != 0 && cmd2.Handles[1] != handle {
+			c.closeHandles(cmd2.Handles[:])
+			return nil, 0, fmt.Errorf("unsupported multi-planar framebuffer format %q", fourccString(cmd2.PixelFormat))
+		}
+		if cmd2.Flags&drmModeFBModifiers != 0 && cmd2.Modifier[0] != drmFormatModLinear {
+			c.closeHandles(cmd2.Handles[:])
+			return nil, 0, fmt.Errorf("unsupported tiled framebuffer (modifier %#x)", cmd2.Modifier[0])
+		}
+		if layout, ok = drmFormats[cmd2.PixelFormat]; !ok {
+			c.closeHandles(cmd2.Handles[:])
+			return nil, 0, fmt.Errorf("unsupported framebuffer format %q", fourccString(cmd2.PixelFormat))
+		}
+		fb.offset = int(cmd2.Offsets[0])
+		fb.pitch = int(cmd2.Pitches[0])
+		fb.bounds = image.Rect(0, 0, int(cmd2.Width), int(cmd2.Height))
+	} else {
+		cmd := drmModeFBCmd{FBID: id}
+		if err := c.ioctl(drmIoctlModeGetFB, unsafe.Pointer(&cmd)); err != nil {
+			return nil, 0, fmt.Errorf("failed to read framebuffer %d: %w", id, err)
+		}
+		handle = cmd.Handle
+		switch {
+		case cmd.BPP == 32 && cmd.Depth >= 24:
+			layout = drmFormats[fourcc("XR24")]
+		case cmd.BPP == 24:
+			layout = drmFormats[fourcc("RG24")]
+		case cmd.BPP == 16 && cmd.Depth == 16:
+			layout = drmFormats[fourcc("RG16")]
+		default:
+			c.closeHandles([]uint32{handle})
+			return nil, 0, fmt.Errorf("unsupported framebuffer depth %d (%d bits per pixel)", cmd.Depth, cmd.BPP)
+		}
+		fb.pitch = int(cmd.Pitch)
+		fb.bounds = image.Rect(0, 0, int(cmd.Width), int(cmd.Height))
+	}
+
+	if handle == 0 {
+		return nil, 0, fmt.Errorf("no access to framebuffer %d (needs root or CAP_SYS_ADMIN)", id)
+	}
+	fb.layout = layout
+	return fb, handle, nil
+}
+
+// closeHandles releases the distinct GEM handles GETFB2 returned
+func (c *drmCard) closeHandles(handles []uint32) {
+	closed := map[uint32]bool{0: true}
+	for _, h := range handles {
+		if !closed[h] {
+			gc := drmGemClose{Handle: h}
+			c.ioctl(drmIoctlGemClose, unsafe.Pointer(&gc))
+			closed[h] = true
+		}
+	}
+}
+
+// fourccString returns a pixel format code as text, e.g. NV12
+func fourccString(f uint32) string {
+	return string([]byte{byte(f), byte(f >> 8), byte(f >> 16), byte(f >> 24)})
+}
+
+// grab reads the part of an output's framebuffer that is on screen
+func (c *drmCard) grab(o kmsOutput) (image.Image, error) {
+	fb, err := c.framebuffer(o.fb)
+	if err != nil {
+		return nil, err
+	}
+	defer fb.close()
+
+	area := o.area.Intersect(fb.bounds)
+	if area.Empty() {
+		return nil, fmt.Errorf("%s shows no part of its framebuffer", o.name)
+	}
+	img := fb.layout.decode(fb.data[fb.offset:], fb.pitch, area)
+	if area.Size() == o.area.Size() {
+		return img, nil
+	}
+
+	// Panned past the framebuffer's edge: the rest is black
+	full := strategy.Composite(image.Rect(0, 0, o.area.Dx(), o.area.Dy()),
+		[]strategy.Part{{Bounds: area.Sub(o.area.Min), Image: img}})
+	return full, nil
+}
+
+// Capture reads the framebuffers of the outputs the requested area
+// touches
+func (s *KMSStrategy) Capture(opts strategy.CaptureOptions) (image.Image, error) {
+	card, err := openCard()
+	if err != nil {
+		return nil, err
+	}
+	defer card.close()
+
+	return capture(opts, kmsMonitors(card.outputs), func(i int) (image.Image, error) {
+		return card.grab(card.outputs[i])
+	})
+}
+
+// ListMonitors returns the active outputs, left to right in connector
+// order
+func (s *KMSStrategy) ListMonitors() ([]strategy.Monitor, error) {
+	card, err := openCard()
+	if err != nil {
+		return nil, err
+	}
+	defer card.close()
+
+	return kmsMonitors(card.outputs), nil
+}
+
+func kmsMonitors(outputs []kmsOutput) []strategy.Monitor {
+	sizes := make([]image.Point, len(outputs))
+	names := make([]string, len(outputs))
+	for i, o := range outputs {
+		sizes[i] = o.area.Size()
+		names[i] = o.name
+	}
+	monitors := sideBySide(sizes, names)
+	for i, o := range outputs {
+		monitors[i].WidthMM = o.widthMM
+	}
+	return monitors
+}
@@ -0,0 +1,97 @@
+//go:build linux && !nox11
+
+package strategy
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/robotin/screenshot/internal/xwin"
+)
+
+// Registered before x11 (files register in name order), so it is picked
+// in the ChromeOS container, where X11 capture would return a black
+// screen
+func init() {
+	Register("crostini", func() Strategy { return NewCrostiniStrategy() })
+}
+
+// CrostiniStrategy captures in ChromeOS's Linux container. Its X server
+// is a rootless XWayland behind sommelier whose root window has no
+// contents, so the desktop is rebuilt from the container's mapped X11
+// windows, each read on its own, on black. The ChromeOS desktop, the
+// browser, Android apps and the container's Wayland apps can't be seen
+// from inside the container and stay black.
+type CrostiniStrategy struct {
+	x11 *X11Strategy
+}
+
+// NewCrostiniStrategy creates a new crostini screenshot strategy
+func NewCrostiniStrategy() *CrostiniStrategy {
+	return &CrostiniStrategy{x11: NewX11Strategy()}
+}
+
+// Name returns the strategy name
+func (s *CrostiniStrategy) Name() string {
+	return "crostini"
+}
+
+// Available checks for the ChromeOS container and its X server
+func (s *CrostiniStrategy) Available() bool {
+	return InCrostini() && s.x11.Available()
+}
+
+// Capture paints the X11 windows in the requested area, or reads one
+// window
+func (s *CrostiniStrategy) Capture(opts CaptureOptions) (image.Image, error) {
+	cleanup := s.x11.ensureDisplay(opts)
+	defer cleanup()
+
+	monitors, err := s.ListMonitors()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := xwin.Connect("")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if opts.WindowID != 0 {
+		img, err := conn.Image(uint32(opts.WindowID))
+		if err != nil {
+			return nil, err
+		}
+		return img, nil
+	}
+
+	var rect image.Rectangle
+	switch {
+	case opts.Region != nil:
+		rect = *opts.Region
+	case opts.Monitor == -1:
+		for _, m := range monitors {
+			rect = rect.Union(m.Bounds)
+		}
+	case opts.Monitor < 0 || opts.Monitor >= len(monitors):
+		return nil, fmt.Errorf("monitor %d out of range (0-%d)", opts.Monitor, len(monitors)-1)
+	default:
+		rect = monitors[opts.Monitor].Bounds
+	}
+	if rect.Empty() {
+		return nil, fmt.Errorf("empty capture area %v", rect)
+	}
+	return conn.Desktop(rect)
+}
+
+// ListMonitors returns the monitors XWayland reports
+func (s *CrostiniStrategy) ListMonitors() ([]Monitor, error) {
+	return s.x11.ListMonitors()
+}
+
+// SwapsRedBlue reports whether the root visual is BGR: window reads
+// decode pixels as 0xRRGGBB
+func (s *CrostiniStrategy) SwapsRedBlue(display string) bool {
+	return s.x11.bgr(display)
+}
@@ -0,0 +1,20 @@
+package strategy
+
+import "os"
+
+// InCrostini reports whether this is ChromeOS's Linux container
+// (crostini). Its X server is a rootless XWayland behind sommelier, so
+// only the container's own X11 windows can be captured: the ChromeOS
+// desktop, browser and Android apps, and the container's Wayland apps
+// are out of reach.
+func InCrostini() bool {
+	if os.Getenv("SOMMELIER_VERSION") != "" {
+		return true
+	}
+	for _, path := range []string{"/dev/.cros_milestone", "/opt/google/cros-containers"} {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,302 @@
+package strategy
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterWithArg("replay", func(dir string) (Strategy, error) {
+		return NewReplayStrategy(dir), nil
+	})
+}
+
+// A frame recording is a directory with monitors.json (the backend's
+// monitor list) and, per capture, frame-NNNNNN.json describing the image
+// as the backend returned it plus frame-NNNNNN.raw with its pixel buffer,
+// stride and padding included. Replaying it reproduces backend-specific
+// bugs (swapped channels, odd strides) on machines without that hardware.
+
+// frameMeta is the JSON description of a recorded frame
+type frameMeta struct {
+	Backend  string       `json:"backend"`
+	Time     time.Time    `json:"time"`
+	Options  frameOptions `json:"options"`
+	Type     string       `json:"type"`
+	Rect     frameRect    `json:"rect"`
+	Stride   int          `json:"stride"`
+	Original string       `json:"original_type,omitempty"`
+
+	// SwapsRedBlue records the backend's channel order detection
+	SwapsRedBlue bool `json:"swaps_red_blue,omitempty"`
+}
+
+type frameOptions struct {
+	Monitor  int        `json:"monitor"`
+	Region   *frameRect `json:"region,omitempty"`
+	WindowID uint64     `json:"window_id,omitempty"`
+}
+
+type frameRect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+func toFrameRect(r image.Rectangle) frameRect {
+	return frameRect{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+}
+
+func (r frameRect) rect() image.Rectangle {
+	return image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height)
+}
+
+func toFrameOptions(opts CaptureOptions) frameOptions {
+	fo := frameOptions{Monitor: opts.Monitor, WindowID: opts.WindowID}
+	if opts.Region != nil {
+		r := toFrameRect(*opts.Region)
+		fo.Region = &r
+	}
+	return fo
+}
+
+// Recorder wraps a backend and saves every frame and monitor list it
+// returns into a directory, for replay with the replay backend
+type Recorder struct {
+	Strategy
+	dir string
+
+	mu   sync.Mutex
+	next int
+}
+
+// NewRecorder wraps s so its frames are recorded into dir. Frames are
+// appended to an existing recording.
+func NewRecorder(s Strategy, dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create frame directory: %w", err)
+	}
+	frames, err := filepath.Glob(filepath.Join(dir, "frame-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{Strategy: s, dir: dir, next: len(frames) + 1}, nil
+}
+
+// Capture captures with the wrapped backend and records the frame
+func (r *Recorder) Capture(opts CaptureOptions) (image.Image, error) {
+	img, err := r.Strategy.Capture(opts)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(r.dir, "monitors.json")); os.IsNotExist(err) {
+		if _, err := r.ListMonitors(); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.record(img, opts, r.SwapsRedBlue(opts.Display)); err != nil {
+		return nil, fmt.Errorf("failed to record frame: %w", err)
+	}
+	return img, nil
+}
+
+// ListMonitors lists the wrapped backend's monitors and records them
+func (r *Recorder) ListMonitors() ([]Monitor, error) {
+	monitors, err := r.Strategy.ListMonitors()
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(monitors, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(r.dir, "monitors.json"), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to record monitors: %w", err)
+	}
+	return monitors, nil
+}
+
+// SwapsRedBlue forwards to the wrapped backend's channel order detection
+func (r *Recorder) SwapsRedBlue(display string) bool {
+	rb, ok := r.Strategy.(RedBlueSwapper)
+	return ok && rb.SwapsRedBlue(display)
+}
+
+func (r *Recorder) record(img image.Image, opts CaptureOptions, swapsRB bool) error {
+	meta := frameMeta{
+		Backend:      r.Strategy.Name(),
+		Time:         time.Now(),
+		Options:      toFrameOptions(opts),
+		Rect:         toFrameRect(img.Bounds()),
+		SwapsRedBlue: swapsRB,
+	}
+
+	var pix []byte
+	switch im := img.(type) {
+	case *image.RGBA:
+		meta.Type, meta.Stride, pix = "RGBA", im.Stride, im.Pix
+	case *image.NRGBA:
+		meta.Type, meta.Stride, pix = "NRGBA", im.Stride, im.Pix
+	case *image.Gray:
+		meta.Type, meta.Stride, pix = "Gray", im.Stride, im.Pix
+	default:
+		rgba := image.NewRGBA(img.Bounds())
+		draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+		meta.Type, meta.Stride, pix = "RGBA", rgba.Stride, rgba.Pix
+		meta.Original = fmt.Sprintf("%T", img)
+	}
+
+	r.mu.Lock()
+	n := r.next
+	r.next++
+	r.mu.Unlock()
+
+	base := filepath.Join(r.dir, fmt.Sprintf("frame-%06d", n))
+	if err := os.WriteFile(base+".raw", pix, 0644); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(base+".json", data, 0644)
+}
+
+// ReplayStrategy serves frames from a recording made with --record-frames
+type ReplayStrategy struct {
+	dir string
+
+	mu      sync.Mutex
+	frames  []string
+	next    int
+	swapsRB bool
+}
+
+// NewReplayStrategy creates a backend replaying the recording in dir
+func NewReplayStrategy(dir string) *ReplayStrategy {
+	return &ReplayStrategy{dir: dir}
+}
+
+// Name returns the strategy name
+func (s *ReplayStrategy) Name() string {
+	return "replay"
+}
+
+// Available checks that dir holds a recording
+func (s *ReplayStrategy) Available() bool {
+	_, err := os.Stat(filepath.Join(s.dir, "monitors.json"))
+	return err == nil
+}
+
+// ListMonitors returns the recorded monitor list
+func (s *ReplayStrategy) ListMonitors() ([]Monitor, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, "monitors.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recorded monitors: %w", err)
+	}
+	var monitors []Monitor
+	if err := json.Unmarshal(data, &monitors); err != nil {
+		return nil, fmt.Errorf("invalid recorded monitors: %w", err)
+	}
+	return monitors, nil
+}
+
+// Capture returns the next recorded frame captured with the same
+// monitor, region and window, cycling back to the first at the end
+func (s *ReplayStrategy) Capture(opts CaptureOptions) (image.Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.frames == nil {
+		frames, err := filepath.Glob(filepath.Join(s.dir, "frame-*.json"))
+		if err != nil {
+			return nil, err
+		}
+		if len(frames) == 0 {
+			return nil, fmt.Errorf("no frames recorded in %s", s.dir)
+		}
+		sort.Strings(frames)
+		s.frames = frames
+	}
+
+	want := toFrameOptions(opts)
+	for i := range s.frames {
+		n := (s.next + i) % len(s.frames)
+		meta, err := readFrameMeta(s.frames[n])
+		if err != nil {
+			return nil, err
+		}
+		if !sameFrameOptions(meta.Options, want) {
+			continue
+		}
+		s.next = n + 1
+		s.swapsRB = meta.SwapsRedBlue
+		return loadFrame(s.frames[n], meta)
+	}
+	return nil, fmt.Errorf("no frame recorded with these options (monitor %d) in %s", opts.Monitor, s.dir)
+}
+
+// SwapsRedBlue reports the recording backend's channel order detection
+// for the last replayed frame
+func (s *ReplayStrategy) SwapsRedBlue(display string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.swapsRB
+}
+
+func sameFrameOptions(a, b frameOptions) bool {
+	if a.Monitor != b.Monitor || a.WindowID != b.WindowID || (a.Region == nil) != (b.Region == nil) {
+		return false
+	}
+	return a.Region == nil || *a.Region == *b.Region
+}
+
+func readFrameMeta(path string) (*frameMeta, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read frame: %w", err)
+	}
+	var meta frameMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("invalid frame %s: %w", filepath.Base(path), err)
+	}
+	return &meta, nil
+}
+
+// loadFrame rebuilds the image exactly as the recording backend returned
+// it, including its stride
+func loadFrame(path string, meta *frameMeta) (image.Image, error) {
+	pix, err := os.ReadFile(path[:len(path)-len(".json")] + ".raw")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read frame: %w", err)
+	}
+
+	rect := meta.Rect.rect()
+	bpp := 4
+	if meta.Type == "Gray" {
+		bpp = 1
+	}
+	if rect.Dx() > 0 && rect.Dy() > 0 {
+		if need := (rect.Dy()-1)*meta.Stride + rect.Dx()*bpp; meta.Stride < rect.Dx()*bpp || len(pix) < need {
+			return nil, fmt.Errorf("frame %s is truncated", filepath.Base(path))
+		}
+	}
+
+	switch meta.Type {
+	case "RGBA":
+		return &image.RGBA{Pix: pix, Stride: meta.Stride, Rect: rect}, nil
+	case "NRGBA":
+		return &image.NRGBA{Pix: pix, Stride: meta.Stride, Rect: rect}, nil
+	case "Gray":
+		return &image.Gray{Pix: pix, Stride: meta.Stride, Rect: rect}, nil
+	}
+	return nil, fmt.Errorf("frame %s has unsupported type %q", filepath.Base(path), meta.Type)
+}
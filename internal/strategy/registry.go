@@ -0,0 +1,192 @@
+package strategy
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Factory creates a capture backend
+type Factory func() Strategy
+
+type backend struct {
+	name    string
+	factory Factory
+
+	// explicit backends are only used when selected by name
+	explicit bool
+
+	// withArg creates backends selected as name:arg
+	withArg func(arg string) (Strategy, error)
+
+	// optionalArg backends can also be selected as plain name, with an
+	// empty arg
+	optionalArg bool
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []backend
+)
+
+// Register makes a capture backend available under name. Backends
+// register themselves from an init function, normally in a file guarded
+// by build tags so a build only contains the backends it can run (the
+// X11 backend is left out with -tags nox11). Register panics if name is
+// already registered.
+//
+// A backend in another package is linked in with a blank import:
+//
+//	import _ "github.com/robotin/screenshot/internal/strategy/mydevice"
+func Register(name string, factory Factory) {
+	register(backend{name: name, factory: factory})
+}
+
+// RegisterExplicit registers a backend that is never picked
+// automatically, only when selected by name with Lookup (--backend), like
+// the synthetic test pattern
+func RegisterExplicit(name string, factory Factory) {
+	register(backend{name: name, factory: factory, explicit: true})
+}
+
+// RegisterWithArg registers an explicit backend that is selected as
+// name:arg, e.g. replay:frames/
+func RegisterWithArg(name string, factory func(arg string) (Strategy, error)) {
+	register(backend{name: name, explicit: true, withArg: factory})
+}
+
+// RegisterWithOptionalArg registers an explicit backend that is selected
+// as name or name:arg, e.g. adb or adb:SERIAL. The factory gets an empty
+// arg for the former.
+func RegisterWithOptionalArg(name string, factory func(arg string) (Strategy, error)) {
+	register(backend{name: name, explicit: true, withArg: factory, optionalArg: true})
+}
+
+func register(b backend) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for _, r := range registry {
+		if r.name == b.name {
+			panic("strategy: Register called twice for backend " + b.name)
+		}
+	}
+	registry = append(registry, b)
+}
+
+// Lookup creates the backend selected by spec: a registered name, or
+// name:arg for backends registered with RegisterWithArg
+func Lookup(spec string) (Strategy, error) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	name, arg, hasArg := strings.Cut(spec, ":")
+	for _, b := range registry {
+		if b.name != name {
+			continue
+		}
+		switch {
+		case b.withArg != nil && arg == "" && !b.optionalArg:
+			return nil, fmt.Errorf("backend %q needs an argument (%s:...)", name, name)
+		case b.withArg != nil:
+			return b.withArg(arg)
+		case hasArg:
+			return nil, fmt.Errorf("backend %q takes no argument", name)
+		}
+		return b.factory(), nil
+	}
+	return nil, unknownBackend(name)
+}
+
+// Backends returns the registered backend names in registration order
+func Backends() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	names := make([]string, len(registry))
+	for i, b := range registry {
+		names[i] = b.name
+	}
+	return names
+}
+
+// Registration describes a registered backend
+type Registration struct {
+	Name string
+
+	// Explicit backends are only used when selected by name, TakesArg
+	// ones as name:arg, or also as name if ArgOptional
+	Explicit    bool
+	TakesArg    bool
+	ArgOptional bool
+}
+
+// Registered describes the registered backends in registration order
+func Registered() []Registration {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	regs := make([]Registration, len(registry))
+	for i, b := range registry {
+		regs[i] = Registration{Name: b.name, Explicit: b.explicit, TakesArg: b.withArg != nil, ArgOptional: b.optionalArg}
+	}
+	return regs
+}
+
+// Ordered creates the registered backends: those named in priority
+// first, in that order, then the rest in registration order. Explicit
+// backends are only included when named.
+func Ordered(priority []string) ([]Strategy, error) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	var ordered []backend
+	used := map[string]bool{}
+	for _, name := range priority {
+		found := false
+		for _, b := range registry {
+			if b.name == name {
+				if b.withArg != nil && !b.optionalArg {
+					return nil, fmt.Errorf("backend %q can only be selected as %s:...", name, name)
+				}
+				found = true
+				if !used[name] {
+					ordered = append(ordered, b)
+					used[name] = true
+				}
+			}
+		}
+		if !found {
+			return nil, unknownBackend(name)
+		}
+	}
+	for _, b := range registry {
+		if !used[b.name] && !b.explicit {
+			ordered = append(ordered, b)
+		}
+	}
+
+	strategies := make([]Strategy, len(ordered))
+	for i, b := range ordered {
+		if b.withArg != nil {
+			s, err := b.withArg("")
+			if err != nil {
+				return nil, err
+			}
+			strategies[i] = s
+			continue
+		}
+		strategies[i] = b.factory()
+	}
+	return strategies, nil
+}
+
+// unknownBackend reports a backend name that isn't registered. The
+// caller must hold registryMu.
+func unknownBackend(name string) error {
+	names := make([]string, len(registry))
+	for i, b := range registry {
+		names[i] = b.name
+	}
+	return fmt.Errorf("unknown backend %q (available: %s)", name, strings.Join(names, ", "))
+}
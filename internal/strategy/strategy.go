@@ -1,7 +1,10 @@
 package strategy
 
 import (
+	"fmt"
 	"image"
+	"strconv"
+	"strings"
 )
 
 // CaptureOptions holds the options for a screenshot capture
@@ -12,11 +15,18 @@ type CaptureOptions struct {
 	// Region to capture. If nil, captures the full monitor/screen
 	Region *image.Rectangle
 
-	// WindowID to capture (X11 window ID). 0 means no specific window
+	// WindowID to capture (X11 window ID). 0 means no specific window.
+	// Set Region to the window's bounds as well, so exclusion zones and
+	// backends without window support use the right area.
 	WindowID uint64
 
 	// Display override (e.g., ":0"). Empty means use DISPLAY env var
 	Display string
+
+	// ZeroCopy grabs the screen as a DMA-BUF that stays on the GPU, if
+	// the backend, the X server and the build (gpu tag) can; otherwise
+	// the usual grab is used
+	ZeroCopy bool
 }
 
 // Strategy defines the interface for screenshot capture strategies
@@ -34,9 +44,52 @@ type Strategy interface {
 	ListMonitors() ([]Monitor, error)
 }
 
+// RedBlueSwapper is implemented by backends that can detect frames coming
+// out with red and blue swapped (e.g. X servers with a BGR visual)
+type RedBlueSwapper interface {
+	// SwapsRedBlue reports whether frames captured on display (empty
+	// means the default) have red and blue swapped
+	SwapsRedBlue(display string) bool
+}
+
 // Monitor represents a display monitor
 type Monitor struct {
 	Index  int
 	Name   string
 	Bounds image.Rectangle
+
+	// Primary is set on the monitor the desktop treats as primary
+	Primary bool
+
+	// WidthMM is the physical width in millimetres, 0 if unknown
+	WidthMM int
+}
+
+// DPI returns the monitor's horizontal pixel density, or 0 if its
+// physical size is unknown
+func (m Monitor) DPI() float64 {
+	if m.WidthMM <= 0 {
+		return 0
+	}
+	return float64(m.Bounds.Dx()) * 25.4 / float64(m.WidthMM)
+}
+
+// ParseRegion parses a region string "x,y,width,height" into an image.Rectangle
+func ParseRegion(s string) (*image.Rectangle, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("expected x,y,width,height")
+	}
+
+	vals := make([]int, 4)
+	for i, p := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return nil, fmt.Errorf("invalid number: %s", p)
+		}
+		vals[i] = v
+	}
+
+	rect := image.Rect(vals[0], vals[1], vals[0]+vals[2], vals[1]+vals[3])
+	return &rect, nil
 }
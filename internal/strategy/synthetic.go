@@ -0,0 +1,215 @@
+//go:build !nosynthetic && !minimal
+
+package strategy
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+func init() {
+	RegisterExplicit("synthetic", func() Strategy { return NewSyntheticStrategy() })
+}
+
+// DefaultSyntheticMonitors is the synthetic desktop used when
+// $SCREENSHOT_SYNTHETIC_MONITORS is not set
+const DefaultSyntheticMonitors = "1920x1080,1280x1024"
+
+// SyntheticStrategy renders a deterministic test pattern instead of
+// reading a display, for end-to-end tests, golden images and demos on
+// machines without a display server. The monitors come from
+// $SCREENSHOT_SYNTHETIC_MONITORS: comma-separated WxH or WxH+X+Y; those
+// without an offset are placed to the right of the previous one. A
+// trailing @DPI (e.g. 3840x2160@192) gives the monitor a physical size.
+type SyntheticStrategy struct {
+	mu    sync.Mutex
+	tiles map[int]*image.RGBA
+}
+
+// NewSyntheticStrategy creates a new synthetic screenshot strategy
+func NewSyntheticStrategy() *SyntheticStrategy {
+	return &SyntheticStrategy{tiles: map[int]*image.RGBA{}}
+}
+
+// Name returns the strategy name
+func (s *SyntheticStrategy) Name() string {
+	return "synthetic"
+}
+
+// Available always reports true: the synthetic backend needs nothing
+func (s *SyntheticStrategy) Available() bool {
+	return true
+}
+
+// Capture renders the requested part of the synthetic desktop. Areas
+// outside every monitor are black, as on a real X screen.
+func (s *SyntheticStrategy) Capture(opts CaptureOptions) (image.Image, error) {
+	monitors, err := s.ListMonitors()
+	if err != nil {
+		return nil, err
+	}
+
+	var rect image.Rectangle
+	switch {
+	case opts.Region != nil:
+		rect = *opts.Region
+	case opts.Monitor == -1:
+		for _, m := range monitors {
+			rect = rect.Union(m.Bounds)
+		}
+	case opts.Monitor < 0 || opts.Monitor >= len(monitors):
+		return nil, fmt.Errorf("monitor %d out of range (0-%d)", opts.Monitor, len(monitors)-1)
+	default:
+		rect = monitors[opts.Monitor].Bounds
+	}
+	if rect.Empty() {
+		return nil, fmt.Errorf("empty capture area %v", rect)
+	}
+
+	// Like the X11 backend, images start at 0,0
+	parts := make([]Part, len(monitors))
+	for i, m := range monitors {
+		parts[i] = Part{Bounds: m.Bounds, Image: s.tile(m)}
+	}
+	return Composite(rect, parts), nil
+}
+
+// ListMonitors returns the configured synthetic monitors
+func (s *SyntheticStrategy) ListMonitors() ([]Monitor, error) {
+	spec := os.Getenv("SCREENSHOT_SYNTHETIC_MONITORS")
+	if spec == "" {
+		spec = DefaultSyntheticMonitors
+	}
+	monitors, err := ParseSyntheticMonitors(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SCREENSHOT_SYNTHETIC_MONITORS: %w", err)
+	}
+	return monitors, nil
+}
+
+// ParseSyntheticMonitors parses a synthetic desktop description such as
+// "3840x2160@192,1280x1024+3840+56". The first monitor is primary.
+func ParseSyntheticMonitors(spec string) ([]Monitor, error) {
+	var monitors []Monitor
+	next := image.Point{}
+	for i, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		geometry, dpiSpec, hasDPI := strings.Cut(part, "@")
+		size, offset, hasOffset := strings.Cut(geometry, "+")
+
+		w, h, ok := strings.Cut(size, "x")
+		if !ok {
+			return nil, fmt.Errorf("monitor %q: expected WxH or WxH+X+Y", part)
+		}
+		width, err1 := strconv.Atoi(w)
+		height, err2 := strconv.Atoi(h)
+		if err1 != nil || err2 != nil || width <= 0 || height <= 0 {
+			return nil, fmt.Errorf("monitor %q: invalid size", part)
+		}
+
+		origin := next
+		if hasOffset {
+			x, y, ok := strings.Cut(offset, "+")
+			ox, err1 := strconv.Atoi(x)
+			oy, err2 := strconv.Atoi(y)
+			if !ok || err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("monitor %q: invalid offset", part)
+			}
+			origin = image.Pt(ox, oy)
+		}
+
+		widthMM := 0
+		if hasDPI {
+			dpi, err := strconv.ParseFloat(dpiSpec, 64)
+			if err != nil || dpi <= 0 {
+				return nil, fmt.Errorf("monitor %q: invalid DPI", part)
+			}
+			widthMM = int(math.Round(float64(width) * 25.4 / dpi))
+		}
+
+		bounds := image.Rectangle{Min: origin, Max: origin.Add(image.Pt(width, height))}
+		monitors = append(monitors, Monitor{
+			Index:   i,
+			Name:    fmt.Sprintf("SYN-%d", i+1),
+			Bounds:  bounds,
+			Primary: i == 0,
+			WidthMM: widthMM,
+		})
+		next = image.Pt(bounds.Max.X, origin.Y)
+	}
+	return monitors, nil
+}
+
+// syntheticBars are the color bars across the top of each monitor
+var syntheticBars = []color.RGBA{
+	{0xff, 0xff, 0xff, 0xff},
+	{0xff, 0xff, 0x00, 0xff},
+	{0x00, 0xff, 0xff, 0xff},
+	{0x00, 0xff, 0x00, 0xff},
+	{0xff, 0x00, 0xff, 0xff},
+	{0xff, 0x00, 0x00, 0xff},
+	{0x00, 0x00, 0xff, 0xff},
+	{0x00, 0x00, 0x00, 0xff},
+}
+
+// tile returns the test pattern for a monitor, rendered once
+func (s *SyntheticStrategy) tile(m Monitor) *image.RGBA {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.tiles[m.Index]; ok && t.Bounds().Size() == m.Bounds.Size() {
+		return t
+	}
+	t := renderTestPattern(m)
+	s.tiles[m.Index] = t
+	return t
+}
+
+// renderTestPattern draws color bars over the top 60%, a grayscale ramp
+// below them and a dark grid with the monitor's name and geometry at the
+// bottom, framed by a 1px white border
+func renderTestPattern(m Monitor) *image.RGBA {
+	w, h := m.Bounds.Dx(), m.Bounds.Dy()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	barsEnd, rampEnd := h*60/100, h*75/100
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var c color.RGBA
+			switch {
+			case y < barsEnd:
+				c = syntheticBars[x*len(syntheticBars)/w]
+			case y < rampEnd:
+				v := uint8(x * 255 / max(w-1, 1))
+				c = color.RGBA{v, v, v, 0xff}
+			case x%32 == 0 || (y-rampEnd)%32 == 0:
+				c = color.RGBA{0x60, 0x60, 0x60, 0xff}
+			default:
+				c = color.RGBA{0x20, 0x20, 0x20, 0xff}
+			}
+			if x == 0 || y == 0 || x == w-1 || y == h-1 {
+				c = color.RGBA{0xff, 0xff, 0xff, 0xff}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	label := fmt.Sprintf("%s %dx%d+%d+%d", m.Name, w, h, m.Bounds.Min.X, m.Bounds.Min.Y)
+	face := basicfont.Face7x13
+	d := &font.Drawer{Dst: img, Src: image.White, Face: face}
+	x := (w - d.MeasureString(label).Round()) / 2
+	y := rampEnd + (h-rampEnd+face.Ascent)/2
+	d.Dot = fixed.P(max(x, 2), y)
+	d.DrawString(label)
+	return img
+}
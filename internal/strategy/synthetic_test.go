@@ -0,0 +1,39 @@
+//go:build !nosynthetic && !minimal
+
+package strategy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"image/png"
+	"testing"
+)
+
+// syntheticGolden is the SHA-256 of the synthetic desktop below, encoded
+// as an uncompressed PNG (stored zlib blocks, no filters), which doesn't
+// depend on the Go release's compressor. Update it only when the test
+// pattern is meant to change.
+const syntheticGolden = "67aef8e2119231faff707460295a8c21d19aaab260cf73efdddd868508e68627"
+
+func TestSyntheticGolden(t *testing.T) {
+	t.Setenv("SCREENSHOT_SYNTHETIC_MONITORS", "160x90,96x64+160+13")
+
+	img, err := NewSyntheticStrategy().Capture(CaptureOptions{Monitor: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds().Size(); got.X != 256 || got.Y != 90 {
+		t.Fatalf("desktop is %v, want 256x90", got)
+	}
+
+	var buf bytes.Buffer
+	enc := png.Encoder{CompressionLevel: png.NoCompression}
+	if err := enc.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	if got := hex.EncodeToString(sum[:]); got != syntheticGolden {
+		t.Errorf("synthetic desktop hashes to %s, want %s", got, syntheticGolden)
+	}
+}
@@ -1,4 +1,4 @@
-//go:build linux
+//go:build linux && !nox11
 
 package strategy
 
@@ -6,13 +6,25 @@ import (
 	"fmt"
 	"image"
 	"os"
+	"sync"
 
-	"github.com/kbinani/screenshot"
+	"github.com/robotin/screenshot/internal/gpu"
+	"github.com/robotin/screenshot/internal/xwin"
 )
 
+func init() {
+	Register("x11", func() Strategy { return NewX11Strategy() })
+}
+
 // X11Strategy implements screenshot capture for X11
 type X11Strategy struct {
 	originalDisplay string
+
+	// impl is the grabber picked by Available, see pickGrabber
+	impl x11Grabber
+
+	mu      sync.Mutex
+	swapsRB map[string]bool
 }
 
 // NewX11Strategy creates a new X11 screenshot strategy
@@ -34,9 +46,20 @@ func (s *X11Strategy) Available() bool {
 		display = ":0"
 	}
 
-	// Check if we can get display count (quick availability check)
-	n := screenshot.NumActiveDisplays()
-	return n > 0
+	s.impl = pickGrabber()
+	return s.impl != nil
+}
+
+// grabber returns the grabber picked by Available, picking one now if
+// Available wasn't called (--backend x11)
+func (s *X11Strategy) grabber() (x11Grabber, error) {
+	if s.impl == nil {
+		s.impl = pickGrabber()
+	}
+	if s.impl == nil {
+		return nil, fmt.Errorf("no active displays found")
+	}
+	return s.impl, nil
 }
 
 // setDisplay temporarily sets DISPLAY env var and returns a cleanup function
@@ -77,38 +100,73 @@ func (s *X11Strategy) Capture(opts CaptureOptions) (image.Image, error) {
 	cleanup := s.ensureDisplay(opts)
 	defer cleanup()
 
+	if opts.ZeroCopy {
+		img, err := s.grabZeroCopy(opts)
+		if err == nil {
+			gpu.Debugf("zero-copy: grabbed %dx%d as a DMA-BUF", img.Bounds().Dx(), img.Bounds().Dy())
+			return img, nil
+		}
+		gpu.Debugf("zero-copy: %v; using the SHM grab", err)
+	}
+
+	g, err := s.grabber()
+	if err != nil {
+		return nil, err
+	}
+
+	// A specific window, with its own contents and alpha channel. Window
+	// reads decode like the shm grabber; without it, fix BGR here since
+	// SwapsRedBlue won't.
+	if opts.WindowID != 0 {
+		conn, err := xwin.Connect("")
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		img, err := conn.Image(uint32(opts.WindowID))
+		if err != nil {
+			return nil, err
+		}
+		if !g.swapsRedBlue() && s.bgr(opts.Display) {
+			swapRB(img)
+		}
+		return img, nil
+	}
+
 	// If a specific region is requested
 	if opts.Region != nil {
-		return screenshot.CaptureRect(*opts.Region)
+		return g.grab(*opts.Region)
 	}
 
-	// Get number of displays
-	n := screenshot.NumActiveDisplays()
-	if n == 0 {
-		return nil, fmt.Errorf("no active displays found")
+	displays, err := g.displays()
+	if err != nil {
+		return nil, err
 	}
+	n := len(displays)
 
-	// Capture all monitors combined
+	// Capture all monitors combined: grab each monitor concurrently (the
+	// per-pixel decoding dominates) and assemble the desktop
 	if opts.Monitor == -1 {
-		// Calculate combined bounds
-		var minX, minY, maxX, maxY int
+		parts := make([]Part, n)
+		errs := make([]error, n)
+		var all image.Rectangle
+		var wg sync.WaitGroup
 		for i := 0; i < n; i++ {
-			bounds := screenshot.GetDisplayBounds(i)
-			if i == 0 || bounds.Min.X < minX {
-				minX = bounds.Min.X
-			}
-			if i == 0 || bounds.Min.Y < minY {
-				minY = bounds.Min.Y
-			}
-			if i == 0 || bounds.Max.X > maxX {
-				maxX = bounds.Max.X
-			}
-			if i == 0 || bounds.Max.Y > maxY {
-				maxY = bounds.Max.Y
+			parts[i].Bounds = displays[i]
+			all = all.Union(parts[i].Bounds)
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				parts[i].Image, errs[i] = g.grab(parts[i].Bounds)
+			}(i)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				return nil, err
 			}
 		}
-		allBounds := image.Rect(minX, minY, maxX, maxY)
-		return screenshot.CaptureRect(allBounds)
+		return Composite(all, parts), nil
 	}
 
 	// Capture specific monitor
@@ -116,8 +174,7 @@ func (s *X11Strategy) Capture(opts CaptureOptions) (image.Image, error) {
 		return nil, fmt.Errorf("monitor %d out of range (0-%d)", opts.Monitor, n-1)
 	}
 
-	bounds := screenshot.GetDisplayBounds(opts.Monitor)
-	return screenshot.CaptureRect(bounds)
+	return g.grab(displays[opts.Monitor])
 }
 
 // ListMonitors returns the available monitors
@@ -127,20 +184,81 @@ func (s *X11Strategy) ListMonitors() ([]Monitor, error) {
 		os.Setenv("DISPLAY", ":0")
 	}
 
-	n := screenshot.NumActiveDisplays()
-	if n == 0 {
-		return nil, fmt.Errorf("no active displays found")
+	g, err := s.grabber()
+	if err != nil {
+		return nil, err
 	}
+	displays, err := g.displays()
+	if err != nil {
+		return nil, err
+	}
+
+	// RandR output names (e.g. HDMI-1) and the primary flag are best
+	// effort; without them monitors are named by index
+	outputs, _ := xwin.Outputs("")
 
-	monitors := make([]Monitor, n)
-	for i := 0; i < n; i++ {
-		bounds := screenshot.GetDisplayBounds(i)
+	monitors := make([]Monitor, len(displays))
+	for i, bounds := range displays {
 		monitors[i] = Monitor{
 			Index:  i,
 			Name:   fmt.Sprintf("Display %d", i),
 			Bounds: bounds,
 		}
+		for _, o := range outputs {
+			if o.Bounds == bounds {
+				monitors[i].Name = o.Name
+				monitors[i].Primary = o.Primary
+				monitors[i].WidthMM = o.WidthMM
+				break
+			}
+		}
 	}
 
 	return monitors, nil
 }
+
+// SwapsRedBlue reports whether frames have red and blue swapped: the
+// shm grabber and window reads decode pixels as 0xRRGGBB, which is wrong
+// on displays with a BGR root visual (the xgb grabber decodes with the
+// visual's masks)
+func (s *X11Strategy) SwapsRedBlue(display string) bool {
+	g, err := s.grabber()
+	return err == nil && g.swapsRedBlue() && s.bgr(display)
+}
+
+// bgr reports whether the display's root visual is BGR. The answer is
+// cached per display; if the visual can't be queried, it is assumed not
+// to be.
+func (s *X11Strategy) bgr(display string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if swap, ok := s.swapsRB[display]; ok {
+		return swap
+	}
+
+	target := display
+	if target == "" {
+		target = os.Getenv("DISPLAY")
+	}
+	if target == "" {
+		target = ":0"
+	}
+	swap, _ := xwin.SwapsRedBlue(target)
+
+	if s.swapsRB == nil {
+		s.swapsRB = map[string]bool{}
+	}
+	s.swapsRB[display] = swap
+	return swap
+}
+
+// swapRB swaps the red and blue channels in place
+func swapRB(img *image.RGBA) {
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(img.Rect.Min.X, y):img.PixOffset(img.Rect.Max.X, y)]
+		for i := 0; i < len(row); i += 4 {
+			row[i], row[i+2] = row[i+2], row[i]
+		}
+	}
+}
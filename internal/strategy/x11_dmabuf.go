@@ -0,0 +1,39 @@
+//go:build linux
+
+package strategy
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"os"
+
+	"github.com/robotin/screenshot/internal/gpu"
+)
+
+// grabZeroCopy grabs what opts asks for as a DMA-BUF frame on the GPU
+// (see --zero-copy). Windows aren't grabbed this way.
+func (s *X11Strategy) grabZeroCopy(opts CaptureOptions) (image.Image, error) {
+	if opts.WindowID != 0 {
+		return nil, errors.New("windows can't be grabbed as DMA-BUFs")
+	}
+
+	var bounds image.Rectangle
+	if opts.Region != nil {
+		bounds = *opts.Region
+	} else {
+		monitors, err := s.ListMonitors()
+		if err != nil {
+			return nil, err
+		}
+		if opts.Monitor >= len(monitors) {
+			return nil, fmt.Errorf("monitor %d out of range (0-%d)", opts.Monitor, len(monitors)-1)
+		}
+		for _, m := range monitors {
+			if opts.Monitor == -1 || m.Index == opts.Monitor {
+				bounds = bounds.Union(m.Bounds)
+			}
+		}
+	}
+	return gpu.GrabX11(os.Getenv("DISPLAY"), bounds)
+}
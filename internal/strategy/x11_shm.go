@@ -0,0 +1,39 @@
+//go:build linux && !nox11 && (386 || amd64 || arm || arm64 || riscv64)
+
+package strategy
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/kbinani/screenshot"
+)
+
+func init() {
+	shmGrabber = kbinaniGrabber{}
+}
+
+// kbinaniGrabber is the shm grabber. The library's display bounds are
+// relative to the first Xinerama screen, which is at the root origin on
+// the setups it supports.
+type kbinaniGrabber struct{}
+
+func (kbinaniGrabber) displays() ([]image.Rectangle, error) {
+	n := screenshot.NumActiveDisplays()
+	if n == 0 {
+		return nil, fmt.Errorf("no active displays found")
+	}
+	bounds := make([]image.Rectangle, n)
+	for i := range bounds {
+		bounds[i] = screenshot.GetDisplayBounds(i)
+	}
+	return bounds, nil
+}
+
+func (kbinaniGrabber) grab(r image.Rectangle) (image.Image, error) {
+	return screenshot.CaptureRect(r)
+}
+
+func (kbinaniGrabber) swapsRedBlue() bool {
+	return true
+}
@@ -0,0 +1,207 @@
+// Package tiles uploads only the parts of the screen that changed. A
+// capture is cut into square tiles, each named by a hash of its pixels,
+// and a manifest lists the tiles that make up the frame. Tiles sent for
+// an earlier frame aren't sent again, so a static screen costs one small
+// manifest per capture. Assemble puts a frame back together.
+package tiles
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Version is the manifest format version
+const Version = 1
+
+// DefaultSize is the default tile edge in pixels
+const DefaultSize = 128
+
+// ManifestSuffix ends manifest file names ("shot_2025-01-02_15-04-05.tiles.json")
+const ManifestSuffix = ".tiles.json"
+
+// Manifest describes one frame
+type Manifest struct {
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+	Width   int       `json:"width"`
+	Height  int       `json:"height"`
+
+	// TileSize is the tile edge; tiles on the right and bottom edges are
+	// cut short by the frame
+	TileSize int `json:"tile_size"`
+
+	// Tiles names the tile files row by row, left to right. They are
+	// found next to the manifest.
+	Tiles []string `json:"tiles"`
+}
+
+// Tile is a square of a frame
+type Tile struct {
+	Name  string
+	Image *image.RGBA
+}
+
+// Tracker cuts frames into tiles and remembers which have been sent
+type Tracker struct {
+	size int
+	sent map[string]bool
+}
+
+// NewTracker returns a tracker for tiles of size pixels, with nothing
+// sent yet: the first frame goes out whole
+func NewTracker(size int) *Tracker {
+	return &Tracker{size: size, sent: map[string]bool{}}
+}
+
+// Frame cuts img into tiles and returns its manifest and the tiles that
+// haven't been sent, each once even if it repeats across the frame
+func (t *Tracker) Frame(img image.Image, at time.Time) (*Manifest, []Tile) {
+	b := img.Bounds()
+	m := &Manifest{Version: Version, Time: at, Width: b.Dx(), Height: b.Dy(), TileSize: t.size}
+
+	var pending []Tile
+	seen := map[string]bool{}
+	for _, r := range grid(m) {
+		tile := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+		draw.Draw(tile, tile.Rect, img, b.Min.Add(r.Min), draw.Src)
+		name := tileName(tile)
+		m.Tiles = append(m.Tiles, name)
+		if !t.sent[name] && !seen[name] {
+			seen[name] = true
+			pending = append(pending, Tile{Name: name, Image: tile})
+		}
+	}
+	return m, pending
+}
+
+// Sent records that a tile has been uploaded
+func (t *Tracker) Sent(name string) {
+	t.sent[name] = true
+}
+
+// grid returns the tile rectangles of a frame, row by row
+func grid(m *Manifest) []image.Rectangle {
+	var rects []image.Rectangle
+	for y := 0; y < m.Height; y += m.TileSize {
+		for x := 0; x < m.Width; x += m.TileSize {
+			rects = append(rects, image.Rect(x, y, min(x+m.TileSize, m.Width), min(y+m.TileSize, m.Height)))
+		}
+	}
+	return rects
+}
+
+// tileName hashes a tile's size and pixels into its file name, so equal
+// tiles share one file
+func tileName(img *image.RGBA) string {
+	h := sha256.New()
+	var size [8]byte
+	binary.BigEndian.PutUint32(size[:4], uint32(img.Rect.Dx()))
+	binary.BigEndian.PutUint32(size[4:], uint32(img.Rect.Dy()))
+	h.Write(size[:])
+	w := img.Rect.Dx() * 4
+	for y := 0; y < img.Rect.Dy(); y++ {
+		h.Write(img.Pix[y*img.Stride : y*img.Stride+w])
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16]) + ".png"
+}
+
+// WriteTile saves a tile as dir/<name> and returns its path
+func WriteTile(dir string, t Tile) (string, error) {
+	path := filepath.Join(dir, t.Name)
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to write tile: %w", err)
+	}
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := enc.Encode(f, t.Image); err != nil {
+		f.Close()
+		return "", fmt.Errorf("failed to write tile: %w", err)
+	}
+	return path, f.Close()
+}
+
+// WriteManifest saves a manifest to path
+func WriteManifest(path string, m *Manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write tile manifest: %w", err)
+	}
+	return nil
+}
+
+// ReadManifest parses and checks a manifest
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid tile manifest: %w", err)
+	}
+	if m.Version != Version {
+		return nil, fmt.Errorf("unsupported tile manifest version %d", m.Version)
+	}
+	if m.Width <= 0 || m.Height <= 0 || m.TileSize <= 0 {
+		return nil, fmt.Errorf("invalid tile manifest: %dx%d in %d pixel tiles", m.Width, m.Height, m.TileSize)
+	}
+	cols := (m.Width + m.TileSize - 1) / m.TileSize
+	rows := (m.Height + m.TileSize - 1) / m.TileSize
+	if len(m.Tiles) != cols*rows {
+		return nil, fmt.Errorf("invalid tile manifest: %d tiles for a %dx%d grid", len(m.Tiles), cols, rows)
+	}
+	for _, name := range m.Tiles {
+		// Names are resolved next to the manifest and must stay there
+		if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+			return nil, fmt.Errorf("invalid tile name %q in manifest", name)
+		}
+	}
+	return &m, nil
+}
+
+// Assemble rebuilds a frame from its manifest, reading each tile file
+// through open
+func Assemble(m *Manifest, open func(name string) (io.ReadCloser, error)) (*image.RGBA, error) {
+	frame := image.NewRGBA(image.Rect(0, 0, m.Width, m.Height))
+	decoded := map[string]image.Image{}
+	for i, r := range grid(m) {
+		name := m.Tiles[i]
+		tile, ok := decoded[name]
+		if !ok {
+			var err error
+			if tile, err = readTile(name, open); err != nil {
+				return nil, err
+			}
+			decoded[name] = tile
+		}
+		if tb := tile.Bounds(); tb.Dx() != r.Dx() || tb.Dy() != r.Dy() {
+			return nil, fmt.Errorf("tile %s is %dx%d, expected %dx%d", name, tb.Dx(), tb.Dy(), r.Dx(), r.Dy())
+		}
+		draw.Draw(frame, r, tile, tile.Bounds().Min, draw.Src)
+	}
+	return frame, nil
+}
+
+// readTile decodes one tile file
+func readTile(name string, open func(string) (io.ReadCloser, error)) (image.Image, error) {
+	rc, err := open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tile %s: %w", name, err)
+	}
+	defer rc.Close()
+	img, err := png.Decode(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode tile %s: %w", name, err)
+	}
+	return img, nil
+}
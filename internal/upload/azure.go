@@ -0,0 +1,232 @@
+//go:build !noupload && !minimal
+
+package upload
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// azureAPIVersion is the Blob service REST API version requests use
+const azureAPIVersion = "2021-08-06"
+
+func init() {
+	Register("az", newAzure)
+}
+
+// azure uploads block blobs to an Azure Storage container
+type azure struct {
+	container string
+	prefix    string
+	creds     *azureCredentials
+}
+
+// azureCredentials identify a storage account and how to authorize
+// requests to it: a shared key or a SAS token
+type azureCredentials struct {
+	account  string
+	key      []byte
+	sas      string
+	endpoint string // blob service URL without trailing slash
+}
+
+// newAzure creates the Azure uploader for "az://container/prefix"
+func newAzure(location string) (Uploader, error) {
+	container, prefix, err := splitBucket(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid az target: %w", err)
+	}
+	creds, err := findAzureCredentials()
+	if err != nil {
+		return nil, err
+	}
+	return &azure{container: container, prefix: prefix, creds: creds}, nil
+}
+
+// findAzureCredentials reads the environment variables used by the Azure
+// CLI and SDKs: $AZURE_STORAGE_CONNECTION_STRING, or $AZURE_STORAGE_ACCOUNT
+// with $AZURE_STORAGE_KEY or $AZURE_STORAGE_SAS_TOKEN
+func findAzureCredentials() (*azureCredentials, error) {
+	c := &azureCredentials{}
+	var key string
+
+	if cs := os.Getenv("AZURE_STORAGE_CONNECTION_STRING"); cs != "" {
+		suffix := "core.windows.net"
+		protocol := "https"
+		for _, part := range strings.Split(cs, ";") {
+			k, v, _ := strings.Cut(part, "=")
+			switch k {
+			case "AccountName":
+				c.account = v
+			case "AccountKey":
+				key = v
+			case "SharedAccessSignature":
+				c.sas = v
+			case "BlobEndpoint":
+				c.endpoint = strings.TrimRight(v, "/")
+			case "EndpointSuffix":
+				suffix = v
+			case "DefaultEndpointsProtocol":
+				protocol = v
+			}
+		}
+		if c.endpoint == "" && c.account != "" {
+			c.endpoint = fmt.Sprintf("%s://%s.blob.%s", protocol, c.account, suffix)
+		}
+	} else {
+		c.account = os.Getenv("AZURE_STORAGE_ACCOUNT")
+		key = os.Getenv("AZURE_STORAGE_KEY")
+		c.sas = os.Getenv("AZURE_STORAGE_SAS_TOKEN")
+		if c.account != "" {
+			c.endpoint = "https://" + c.account + ".blob.core.windows.net"
+		}
+	}
+
+	if c.endpoint == "" {
+		return nil, errors.New("no Azure storage account configured: set AZURE_STORAGE_CONNECTION_STRING or AZURE_STORAGE_ACCOUNT")
+	}
+	if key != "" {
+		decoded, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Azure storage key: %w", err)
+		}
+		c.key = decoded
+	}
+	if c.key == nil && c.sas == "" {
+		return nil, errors.New("no Azure storage credentials: set AZURE_STORAGE_KEY or AZURE_STORAGE_SAS_TOKEN")
+	}
+	c.sas = strings.TrimPrefix(c.sas, "?")
+	return c, nil
+}
+
+func (a *azure) Name() string { return "az" }
+
+func (a *azure) Upload(ctx context.Context, path string) (*Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	blob := objectKey(a.prefix, filepath.Base(path))
+	req, err := a.request(ctx, http.MethodPut, blob, f)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", contentType(path))
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	a.creds.authorize(req)
+
+	if err := doJSON(req, nil); err != nil {
+		return nil, fmt.Errorf("azure upload failed: %w", err)
+	}
+	return &Result{Provider: a.Name(), URL: a.blobURL(blob), ID: blob}, nil
+}
+
+// Delete removes an uploaded blob
+func (a *azure) Delete(ctx context.Context, r *Result) error {
+	req, err := a.request(ctx, http.MethodDelete, r.ID, nil)
+	if err != nil {
+		return err
+	}
+	a.creds.authorize(req)
+	if err := doJSON(req, nil); err != nil {
+		return fmt.Errorf("azure delete failed: %w", err)
+	}
+	return nil
+}
+
+// blobURL returns the URL of a blob without credentials
+func (a *azure) blobURL(blob string) string {
+	return a.creds.endpoint + "/" + url.PathEscape(a.container) + "/" + escapeKey(blob)
+}
+
+// request creates a blob request, adding the SAS token if that is how
+// the account is authorized
+func (a *azure) request(ctx context.Context, method, blob string, body io.Reader) (*http.Request, error) {
+	u := a.blobURL(blob)
+	if a.creds.key == nil {
+		u += "?" + a.creds.sas
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	return req, nil
+}
+
+// authorize signs a request with the Shared Key scheme. Requests carrying
+// a SAS token are left as they are.
+func (c *azureCredentials) authorize(req *http.Request) {
+	if c.key == nil {
+		return
+	}
+
+	length := ""
+	if req.ContentLength > 0 {
+		length = strconv.FormatInt(req.ContentLength, 10)
+	}
+
+	var msHeaders []string
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-ms-") {
+			msHeaders = append(msHeaders, lower+":"+strings.TrimSpace(req.Header.Get(name)))
+		}
+	}
+	sort.Strings(msHeaders)
+
+	resource := "/" + c.account + req.URL.EscapedPath()
+	query := req.URL.Query()
+	params := make([]string, 0, len(query))
+	for k := range query {
+		params = append(params, k)
+	}
+	sort.Strings(params)
+	for _, k := range params {
+		resource += "\n" + strings.ToLower(k) + ":" + strings.Join(query[k], ",")
+	}
+
+	toSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		length,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date (x-ms-date is used instead)
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		strings.Join(msHeaders, "\n"),
+		resource,
+	}, "\n")
+
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(toSign))
+	req.Header.Set("Authorization", "SharedKey "+c.account+":"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
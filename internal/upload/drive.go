@@ -0,0 +1,246 @@
+//go:build !noupload && !minimal
+
+package upload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// driveOAuth logs in to Google Drive with the device flow. The drive.file
+// scope only grants access to files and folders the tool created itself.
+var driveOAuth = &OAuthProvider{
+	Name:            "google",
+	ClientIDEnv:     "SCREENSHOT_GOOGLE_CLIENT_ID",
+	ClientSecretEnv: "SCREENSHOT_GOOGLE_CLIENT_SECRET",
+	DeviceURL:       "https://oauth2.googleapis.com/device/code",
+	TokenURL:        "https://oauth2.googleapis.com/token",
+	Scopes:          []string{"https://www.googleapis.com/auth/drive.file"},
+}
+
+const driveFolderType = "application/vnd.google-apps.folder"
+
+func init() {
+	RegisterOAuth(driveOAuth)
+	Register("drive", newDrive)
+}
+
+// drive uploads to Google Drive and shares each file with anyone who has
+// the link
+type drive struct {
+	folder []string // folder path below My Drive, created on demand
+}
+
+// newDrive creates the Drive uploader. location is a folder path such as
+// "Screenshots/kiosk" (empty for My Drive itself).
+func newDrive(location string) (Uploader, error) {
+	var folder []string
+	for _, name := range strings.Split(location, "/") {
+		if name != "" {
+			folder = append(folder, name)
+		}
+	}
+	return &drive{folder: folder}, nil
+}
+
+func (d *drive) Name() string { return "drive" }
+
+func (d *drive) Upload(ctx context.Context, path string) (*Result, error) {
+	token, err := driveOAuth.AccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	parent, err := d.folderID(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := map[string]any{"name": filepath.Base(path)}
+	if parent != "" {
+		meta["parents"] = []string{parent}
+	}
+	body, ctype, err := driveMultipart(meta, contentType(path), data)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		"https://www.googleapis.com/upload/drive/v3/files?uploadType=multipart&fields=id,webViewLink", body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", ctype)
+
+	var file struct {
+		ID          string `json:"id"`
+		WebViewLink string `json:"webViewLink"`
+	}
+	if err := doJSON(req, &file); err != nil {
+		return nil, fmt.Errorf("drive upload failed: %w", err)
+	}
+
+	if err := d.share(ctx, token, file.ID); err != nil {
+		return nil, err
+	}
+	return &Result{Provider: d.Name(), URL: file.WebViewLink, ID: file.ID}, nil
+}
+
+// Delete removes an uploaded file
+func (d *drive) Delete(ctx context.Context, r *Result) error {
+	token, err := driveOAuth.AccessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, "https://www.googleapis.com/drive/v3/files/"+url.PathEscape(r.ID), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if err := doJSON(req, nil); err != nil {
+		return fmt.Errorf("drive delete failed: %w", err)
+	}
+	return nil
+}
+
+// share makes a file readable by anyone with its link
+func (d *drive) share(ctx context.Context, token, id string) error {
+	body, err := jsonBody(map[string]string{"role": "reader", "type": "anyone"})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://www.googleapis.com/drive/v3/files/"+url.PathEscape(id)+"/permissions", body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	if err := doJSON(req, nil); err != nil {
+		return fmt.Errorf("failed to create drive share link: %w", err)
+	}
+	return nil
+}
+
+// folderID walks the folder path, creating missing folders, and returns
+// the ID of the last one ("" for My Drive)
+func (d *drive) folderID(ctx context.Context, token string) (string, error) {
+	parent := "root"
+	for _, name := range d.folder {
+		id, err := d.findFolder(ctx, token, parent, name)
+		if err != nil {
+			return "", err
+		}
+		if id == "" {
+			if id, err = d.createFolder(ctx, token, parent, name); err != nil {
+				return "", err
+			}
+		}
+		parent = id
+	}
+	if parent == "root" {
+		return "", nil
+	}
+	return parent, nil
+}
+
+// findFolder looks up a folder by name under parent
+func (d *drive) findFolder(ctx context.Context, token, parent, name string) (string, error) {
+	q := fmt.Sprintf("name = '%s' and mimeType = '%s' and '%s' in parents and trashed = false",
+		driveQuote(name), driveFolderType, parent)
+	u := "https://www.googleapis.com/drive/v3/files?fields=files(id)&q=" + url.QueryEscape(q)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var list struct {
+		Files []struct {
+			ID string `json:"id"`
+		} `json:"files"`
+	}
+	if err := doJSON(req, &list); err != nil {
+		return "", fmt.Errorf("failed to look up drive folder %q: %w", name, err)
+	}
+	if len(list.Files) == 0 {
+		return "", nil
+	}
+	return list.Files[0].ID, nil
+}
+
+// createFolder creates a folder under parent and returns its ID
+func (d *drive) createFolder(ctx context.Context, token, parent, name string) (string, error) {
+	body, err := jsonBody(map[string]any{"name": name, "mimeType": driveFolderType, "parents": []string{parent}})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://www.googleapis.com/drive/v3/files?fields=id", body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	var folder struct {
+		ID string `json:"id"`
+	}
+	if err := doJSON(req, &folder); err != nil {
+		return "", fmt.Errorf("failed to create drive folder %q: %w", name, err)
+	}
+	return folder.ID, nil
+}
+
+// driveQuote escapes a value for a Drive search query string literal
+func driveQuote(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
+
+// driveMultipart builds a multipart/related body with JSON metadata
+// followed by the file content
+func driveMultipart(meta map[string]any, mediaType string, data []byte) (io.Reader, string, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	metaPart, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/json; charset=UTF-8"}})
+	if err != nil {
+		return nil, "", err
+	}
+	metaBody, err := jsonBody(meta)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := io.Copy(metaPart, metaBody); err != nil {
+		return nil, "", err
+	}
+
+	filePart, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {mediaType}})
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := filePart.Write(data); err != nil {
+		return nil, "", err
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+	return &buf, "multipart/related; boundary=" + mw.Boundary(), nil
+}
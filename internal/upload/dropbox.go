@@ -0,0 +1,135 @@
+//go:build !noupload && !minimal
+
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// dropboxOAuth logs in to Dropbox. Dropbox has no device flow; without a
+// redirect URI its authorize page shows a code to paste back.
+var dropboxOAuth = &OAuthProvider{
+	Name:            "dropbox",
+	ClientIDEnv:     "SCREENSHOT_DROPBOX_APP_KEY",
+	ClientSecretEnv: "SCREENSHOT_DROPBOX_APP_SECRET",
+	AuthURL:         "https://www.dropbox.com/oauth2/authorize",
+	TokenURL:        "https://api.dropboxapi.com/oauth2/token",
+	AuthParams:      map[string]string{"token_access_type": "offline"},
+}
+
+func init() {
+	RegisterOAuth(dropboxOAuth)
+	Register("dropbox", newDropbox)
+}
+
+// dropbox uploads into a Dropbox folder and creates a shared link for
+// each file
+type dropbox struct {
+	folder string
+}
+
+// newDropbox creates the Dropbox uploader. location is the destination
+// folder (e.g. "/Screenshots"); empty means the root of the app's access.
+func newDropbox(location string) (Uploader, error) {
+	folder := "/" + strings.Trim(location, "/")
+	return &dropbox{folder: folder}, nil
+}
+
+func (d *dropbox) Name() string { return "dropbox" }
+
+func (d *dropbox) Upload(ctx context.Context, file string) (*Result, error) {
+	token, err := dropboxOAuth.AccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	arg, err := json.Marshal(map[string]any{
+		"path":       path.Join(d.folder, filepath.Base(file)),
+		"mode":       "add",
+		"autorename": true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://content.dropboxapi.com/2/files/upload", f)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Dropbox-API-Arg", string(arg))
+
+	var meta struct {
+		PathDisplay string `json:"path_display"`
+	}
+	if err := doJSON(req, &meta); err != nil {
+		return nil, fmt.Errorf("dropbox upload failed: %w", err)
+	}
+
+	link, err := d.sharedLink(ctx, token, meta.PathDisplay)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Provider: d.Name(), URL: link, ID: meta.PathDisplay}, nil
+}
+
+// Delete removes an uploaded file by its path
+func (d *dropbox) Delete(ctx context.Context, r *Result) error {
+	token, err := dropboxOAuth.AccessToken(ctx)
+	if err != nil {
+		return err
+	}
+	if err := d.call(ctx, token, "files/delete_v2", map[string]string{"path": r.ID}, nil); err != nil {
+		return fmt.Errorf("dropbox delete failed: %w", err)
+	}
+	return nil
+}
+
+// sharedLink creates a public shared link for a file
+func (d *dropbox) sharedLink(ctx context.Context, token, file string) (string, error) {
+	var link struct {
+		URL string `json:"url"`
+	}
+	err := d.call(ctx, token, "sharing/create_shared_link_with_settings", map[string]string{"path": file}, &link)
+	if err != nil {
+		return "", fmt.Errorf("failed to create dropbox shared link: %w", err)
+	}
+	return link.URL, nil
+}
+
+// call invokes a Dropbox RPC endpoint with a JSON argument
+func (d *dropbox) call(ctx context.Context, token, endpoint string, arg, out any) error {
+	body, err := jsonBody(arg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.dropboxapi.com/2/"+endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	err = doJSON(req, out)
+	var ae *apiError
+	if errors.As(err, &ae) && strings.Contains(ae.Body, "expired_access_token") {
+		return fmt.Errorf("%w (run `screenshot auth login dropbox`)", err)
+	}
+	return err
+}
@@ -0,0 +1,252 @@
+//go:build !noupload && !minimal
+
+package upload
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const gcsScope = "https://www.googleapis.com/auth/devstorage.read_write"
+
+func init() {
+	Register("gs", newGCS)
+}
+
+// gcs uploads objects to a Google Cloud Storage bucket
+type gcs struct {
+	bucket string
+	prefix string
+	creds  *googleCredentials
+}
+
+// newGCS creates the GCS uploader for "gs://bucket/prefix"
+func newGCS(location string) (Uploader, error) {
+	bucket, prefix, err := splitBucket(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gs target: %w", err)
+	}
+	creds, err := findGoogleCredentials()
+	if err != nil {
+		return nil, err
+	}
+	return &gcs{bucket: bucket, prefix: prefix, creds: creds}, nil
+}
+
+func (g *gcs) Name() string { return "gs" }
+
+func (g *gcs) Upload(ctx context.Context, path string) (*Result, error) {
+	token, err := g.creds.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	object := objectKey(g.prefix, filepath.Base(path))
+	u := fmt.Sprintf("https://storage.googleapis.com/upload/storage/v1/b/%s/o?uploadType=media&name=%s",
+		url.PathEscape(g.bucket), url.QueryEscape(object))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, f)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", contentType(path))
+
+	if err := doJSON(req, nil); err != nil {
+		return nil, fmt.Errorf("gcs upload failed: %w", err)
+	}
+
+	return &Result{
+		Provider: g.Name(),
+		URL:      "https://storage.googleapis.com/" + g.bucket + "/" + escapeKey(object),
+		ID:       object,
+	}, nil
+}
+
+// Delete removes an uploaded object
+func (g *gcs) Delete(ctx context.Context, r *Result) error {
+	token, err := g.creds.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	u := fmt.Sprintf("https://storage.googleapis.com/storage/v1/b/%s/o/%s", url.PathEscape(g.bucket), url.PathEscape(r.ID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if err := doJSON(req, nil); err != nil {
+		return fmt.Errorf("gcs delete failed: %w", err)
+	}
+	return nil
+}
+
+// googleCredentials are Application Default Credentials: a service
+// account key, a gcloud user login, or the GCE metadata server
+type googleCredentials struct {
+	Type string `json:"type"`
+
+	// service_account
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+
+	// authorized_user
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+
+	mu     sync.Mutex
+	cached *Token
+}
+
+// findGoogleCredentials discovers credentials the way Google's client
+// libraries do: $GOOGLE_APPLICATION_CREDENTIALS, then the gcloud
+// application default credentials file, then the metadata server
+func findGoogleCredentials() (*googleCredentials, error) {
+	file := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if file == "" {
+		if dir, err := os.UserConfigDir(); err == nil {
+			candidate := filepath.Join(dir, "gcloud", "application_default_credentials.json")
+			if _, err := os.Stat(candidate); err == nil {
+				file = candidate
+			}
+		}
+	}
+	if file == "" {
+		return &googleCredentials{Type: "metadata"}, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Google credentials: %w", err)
+	}
+	var c googleCredentials
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid Google credentials %s: %w", file, err)
+	}
+	if c.Type != "service_account" && c.Type != "authorized_user" {
+		return nil, fmt.Errorf("unsupported Google credentials type %q in %s", c.Type, file)
+	}
+	if c.TokenURI == "" {
+		c.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return &c, nil
+}
+
+// token returns a cached or newly minted access token
+func (c *googleCredentials) token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cached != nil && c.cached.valid() {
+		return c.cached.AccessToken, nil
+	}
+
+	var tok *Token
+	var err error
+	switch c.Type {
+	case "service_account":
+		tok, err = c.serviceAccountToken(ctx)
+	case "authorized_user":
+		tok, err = requestToken(ctx, c.TokenURI, url.Values{
+			"client_id":     {c.ClientID},
+			"client_secret": {c.ClientSecret},
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {c.RefreshToken},
+		})
+	default:
+		tok, err = metadataToken(ctx)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get Google access token: %w", err)
+	}
+
+	c.cached = tok
+	return tok.AccessToken, nil
+}
+
+// serviceAccountToken exchanges a signed JWT assertion for a token
+func (c *googleCredentials) serviceAccountToken(ctx context.Context) (*Token, error) {
+	block, _ := pem.Decode([]byte(c.PrivateKey))
+	if block == nil {
+		return nil, errors.New("service account private key is not PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("service account private key is not RSA")
+	}
+
+	now := time.Now()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]any{
+		"iss":   c.ClientEmail,
+		"scope": gcsScope,
+		"aud":   c.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign JWT: %w", err)
+	}
+
+	return requestToken(ctx, c.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {unsigned + "." + base64.RawURLEncoding.EncodeToString(sig)},
+	})
+}
+
+// metadataToken gets a token for the instance's service account from the
+// GCE/GKE metadata server
+func metadataToken(ctx context.Context) (*Token, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		"http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := doJSON(req, &resp); err != nil {
+		return nil, fmt.Errorf("no Google credentials found (set GOOGLE_APPLICATION_CREDENTIALS or run `gcloud auth application-default login`): %w", err)
+	}
+	return &Token{
+		AccessToken: resp.AccessToken,
+		Expiry:      time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second),
+	}, nil
+}
@@ -0,0 +1,168 @@
+//go:build !noupload && !minimal
+
+package upload
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// httpClient is shared by providers; uploads of large captures over slow
+// links need a generous timeout
+var httpClient = &http.Client{
+	Timeout:   5 * time.Minute,
+	Transport: throttledTransport{http.DefaultTransport},
+}
+
+// throttledTransport paces request bodies to the SetMaxRate limit and
+// reports them to WithProgress functions
+type throttledTransport struct {
+	base http.RoundTripper
+}
+
+func (t throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	progress := progressOf(req.Context())
+	if (maxRate <= 0 && progress == nil) || req.Body == nil || req.Body == http.NoBody {
+		return t.base.RoundTrip(req)
+	}
+	r := req.Clone(req.Context())
+	if maxRate > 0 {
+		r.Body = &throttledBody{ReadCloser: r.Body, ctx: req.Context()}
+	}
+	if progress != nil {
+		r.Body = &progressBody{ReadCloser: r.Body, progress: progress}
+	}
+	return t.base.RoundTrip(r)
+}
+
+// progressBody is a request body that reports what has been read
+type progressBody struct {
+	io.ReadCloser
+	progress func(n int64)
+}
+
+func (b *progressBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.progress(int64(n))
+	}
+	return n, err
+}
+
+// throttleChunk is the most read between pauses, so the pace is even
+const throttleChunk = 16 << 10
+
+// throttle is the pace shared by all uploads: the time by which
+// everything read so far may have been sent
+var throttle struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+// throttledBody is a request body read no faster than maxRate
+type throttledBody struct {
+	io.ReadCloser
+	ctx context.Context
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+	if len(p) > throttleChunk {
+		p = p[:throttleChunk]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if werr := pace(b.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// pace waits until n more bytes fit within the rate limit
+func pace(ctx context.Context, n int) error {
+	throttle.mu.Lock()
+	now := time.Now()
+	if throttle.next.Before(now) {
+		throttle.next = now
+	}
+	throttle.next = throttle.next.Add(time.Duration(int64(n) * int64(time.Second) / maxRate))
+	wait := throttle.next.Sub(now)
+	throttle.mu.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// contentType returns the MIME type for a file based on its extension
+func contentType(path string) string {
+	if t := mime.TypeByExtension(filepath.Ext(path)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// apiError is returned for non-2xx responses of JSON APIs
+type apiError struct {
+	Code   int
+	Status string
+	Body   string
+}
+
+// Permanent reports whether the service rejected the request in a way
+// that retrying won't change
+func (e *apiError) Permanent() bool {
+	switch e.Code {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return e.Code >= 400 && e.Code < 500
+}
+
+func (e *apiError) Error() string {
+	if e.Body != "" {
+		return e.Status + ": " + e.Body
+	}
+	return e.Status
+}
+
+// doJSON sends req and decodes a JSON response into out (if not nil).
+// Non-2xx responses are returned as *apiError with the start of the body.
+func doJSON(req *http.Request, out any) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &apiError{Code: resp.StatusCode, Status: resp.Status, Body: strings.TrimSpace(string(body))}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// jsonBody encodes v as a request body
+func jsonBody(v any) (io.Reader, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
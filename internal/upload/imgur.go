@@ -0,0 +1,154 @@
+//go:build !noupload && !minimal
+
+package upload
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// imgurOAuth logs in to an imgur account. Imgur has no device flow, so
+// login uses the paste-code flow.
+var imgurOAuth = &OAuthProvider{
+	Name:            "imgur",
+	ClientIDEnv:     "SCREENSHOT_IMGUR_CLIENT_ID",
+	ClientSecretEnv: "SCREENSHOT_IMGUR_CLIENT_SECRET",
+	AuthURL:         "https://api.imgur.com/oauth2/authorize",
+	TokenURL:        "https://api.imgur.com/oauth2/token",
+}
+
+func init() {
+	RegisterOAuth(imgurOAuth)
+	Register("imgur", newImgur)
+}
+
+// imgur uploads images to imgur.com, to the logged-in account if there is
+// one and anonymously (with the app's client ID) otherwise
+type imgur struct {
+	anonymous bool
+}
+
+// newImgur creates the imgur uploader. "imgur:anon" forces an anonymous
+// upload even when logged in.
+func newImgur(location string) (Uploader, error) {
+	switch location {
+	case "":
+		return &imgur{}, nil
+	case "anon", "anonymous":
+		return &imgur{anonymous: true}, nil
+	default:
+		return nil, fmt.Errorf("invalid imgur target option %q (use imgur or imgur:anon)", location)
+	}
+}
+
+func (u *imgur) Name() string { return "imgur" }
+
+// authorization returns the Authorization header value to use
+func (u *imgur) authorization(ctx context.Context) (string, error) {
+	if !u.anonymous {
+		if tok, err := LoadToken(imgurOAuth.Name); err == nil && tok != nil {
+			access, err := imgurOAuth.AccessToken(ctx)
+			if err != nil {
+				return "", err
+			}
+			return "Bearer " + access, nil
+		}
+	}
+
+	clientID := os.Getenv(imgurOAuth.ClientIDEnv)
+	if clientID == "" {
+		return "", fmt.Errorf("imgur upload needs %s (or `screenshot auth login imgur`)", imgurOAuth.ClientIDEnv)
+	}
+	return "Client-ID " + clientID, nil
+}
+
+// imgurResponse is the envelope of imgur API responses
+type imgurResponse struct {
+	Success bool `json:"success"`
+	Status  int  `json:"status"`
+	Data    struct {
+		ID         string `json:"id"`
+		Link       string `json:"link"`
+		DeleteHash string `json:"deletehash"`
+		Error      any    `json:"error"`
+	} `json:"data"`
+}
+
+func (u *imgur) Upload(ctx context.Context, path string) (*Result, error) {
+	auth, err := u.authorization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("image", filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	mw.WriteField("type", "file")
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.imgur.com/3/image", &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	var res imgurResponse
+	if err := doImgur(req, &res); err != nil {
+		return nil, err
+	}
+	return &Result{Provider: u.Name(), URL: res.Data.Link, ID: res.Data.DeleteHash}, nil
+}
+
+// Delete removes an upload using the deletehash stored as its ID
+func (u *imgur) Delete(ctx context.Context, r *Result) error {
+	auth, err := u.authorization(ctx)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, "https://api.imgur.com/3/image/"+r.ID, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", auth)
+	return doImgur(req, &imgurResponse{})
+}
+
+// doImgur sends an API request and decodes the response envelope
+func doImgur(req *http.Request, res *imgurResponse) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("imgur request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		return fmt.Errorf("imgur: %s", resp.Status)
+	}
+	if !res.Success {
+		return &apiError{Code: resp.StatusCode, Status: "imgur: " + resp.Status, Body: fmt.Sprint(res.Data.Error)}
+	}
+	return nil
+}
@@ -0,0 +1,417 @@
+//go:build !noupload && !minimal
+
+package upload
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robotin/screenshot/internal/paths"
+)
+
+// OAuthProvider describes how to obtain tokens for a provider.
+//
+// Providers with a DeviceURL use the OAuth2 device authorization grant
+// (RFC 8628): the user opens a URL on any device and enters a short code.
+// Providers without one use the authorization code grant with PKCE, where
+// the user opens a URL and pastes the code shown after approval.
+type OAuthProvider struct {
+	// Name is the provider key used for token storage ("google", "dropbox")
+	Name string
+
+	// ClientIDEnv and ClientSecretEnv name the environment variables that
+	// hold the OAuth client credentials of the user's registered app
+	ClientIDEnv     string
+	ClientSecretEnv string
+
+	DeviceURL string
+	AuthURL   string
+	TokenURL  string
+	Scopes    []string
+
+	// AuthParams are extra query parameters for the authorization URL
+	AuthParams map[string]string
+}
+
+// Token is a stored OAuth2 token
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	TokenType    string    `json:"token_type,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+
+	// Extra holds provider-specific fields returned with the token
+	// (e.g. the imgur account name)
+	Extra map[string]string `json:"extra,omitempty"`
+}
+
+// valid reports whether the access token can be used without refreshing
+func (t *Token) valid() bool {
+	return t.AccessToken != "" && (t.Expiry.IsZero() || time.Until(t.Expiry) > time.Minute)
+}
+
+var oauthProviders = map[string]*OAuthProvider{}
+
+// RegisterOAuth makes a provider available to `screenshot auth`
+func RegisterOAuth(p *OAuthProvider) {
+	oauthProviders[p.Name] = p
+}
+
+// OAuthProviders returns the names of providers that support login
+func OAuthProviders() []string {
+	names := make([]string, 0, len(oauthProviders))
+	for name := range oauthProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupOAuth returns a registered OAuth provider
+func LookupOAuth(name string) (*OAuthProvider, error) {
+	p, ok := oauthProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown auth provider %q (available: %s)", name, strings.Join(OAuthProviders(), ", "))
+	}
+	return p, nil
+}
+
+// clientCredentials reads the client ID and secret from the environment
+func (p *OAuthProvider) clientCredentials() (string, string, error) {
+	id := os.Getenv(p.ClientIDEnv)
+	if id == "" {
+		return "", "", fmt.Errorf("%s is not set: register an OAuth app with %s and export its client ID", p.ClientIDEnv, p.Name)
+	}
+	return id, os.Getenv(p.ClientSecretEnv), nil
+}
+
+// Prompter shows the user where to authorize. For device flows code is
+// the code to enter at url; for paste flows code is empty and Prompter
+// must return the code the user pasted.
+type Prompter func(url, code string) (string, error)
+
+// Login runs the provider's interactive flow and stores the token
+func (p *OAuthProvider) Login(ctx context.Context, prompt Prompter) (*Token, error) {
+	var tok *Token
+	var err error
+	if p.DeviceURL != "" {
+		tok, err = p.deviceFlow(ctx, prompt)
+	} else {
+		tok, err = p.pasteFlow(ctx, prompt)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := saveToken(p.Name, tok); err != nil {
+		return nil, err
+	}
+	return tok, nil
+}
+
+// deviceFlow implements the device authorization grant (RFC 8628)
+func (p *OAuthProvider) deviceFlow(ctx context.Context, prompt Prompter) (*Token, error) {
+	clientID, clientSecret, err := p.clientCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	var dev struct {
+		DeviceCode              string `json:"device_code"`
+		UserCode                string `json:"user_code"`
+		VerificationURI         string `json:"verification_uri"`
+		VerificationURL         string `json:"verification_url"` // Google's spelling
+		VerificationURIComplete string `json:"verification_uri_complete"`
+		ExpiresIn               int    `json:"expires_in"`
+		Interval                int    `json:"interval"`
+	}
+	form := url.Values{"client_id": {clientID}, "scope": {strings.Join(p.Scopes, " ")}}
+	if err := postForm(ctx, p.DeviceURL, form, &dev); err != nil {
+		return nil, fmt.Errorf("device authorization failed: %w", err)
+	}
+
+	verify := dev.VerificationURIComplete
+	if verify == "" {
+		verify = dev.VerificationURI
+	}
+	if verify == "" {
+		verify = dev.VerificationURL
+	}
+	if _, err := prompt(verify, dev.UserCode); err != nil {
+		return nil, err
+	}
+
+	interval := time.Duration(max(dev.Interval, 5)) * time.Second
+	deadline := time.Now().Add(time.Duration(dev.ExpiresIn) * time.Second)
+
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		form := url.Values{
+			"client_id":   {clientID},
+			"device_code": {dev.DeviceCode},
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		}
+		if clientSecret != "" {
+			form.Set("client_secret", clientSecret)
+		}
+
+		tok, err := requestToken(ctx, p.TokenURL, form)
+		var oe *oauthError
+		switch {
+		case err == nil:
+			return tok, nil
+		case errors.As(err, &oe) && oe.Code == "authorization_pending":
+			continue
+		case errors.As(err, &oe) && oe.Code == "slow_down":
+			interval += 5 * time.Second
+			continue
+		default:
+			return nil, err
+		}
+	}
+	return nil, errors.New("device code expired before authorization completed")
+}
+
+// pasteFlow implements the authorization code grant with PKCE for
+// providers without device flow support: the user approves in a browser
+// and pastes the displayed code back
+func (p *OAuthProvider) pasteFlow(ctx context.Context, prompt Prompter) (*Token, error) {
+	clientID, clientSecret, err := p.clientCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	verifierBytes := make([]byte, 32)
+	if _, err := rand.Read(verifierBytes); err != nil {
+		return nil, err
+	}
+	verifier := base64.RawURLEncoding.EncodeToString(verifierBytes)
+	challenge := sha256.Sum256([]byte(verifier))
+
+	q := url.Values{
+		"client_id":             {clientID},
+		"response_type":         {"code"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	if len(p.Scopes) > 0 {
+		q.Set("scope", strings.Join(p.Scopes, " "))
+	}
+	for k, v := range p.AuthParams {
+		q.Set(k, v)
+	}
+
+	code, err := prompt(p.AuthURL+"?"+q.Encode(), "")
+	if err != nil {
+		return nil, err
+	}
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return nil, errors.New("no authorization code entered")
+	}
+
+	form := url.Values{
+		"client_id":     {clientID},
+		"code":          {code},
+		"code_verifier": {verifier},
+		"grant_type":    {"authorization_code"},
+	}
+	if clientSecret != "" {
+		form.Set("client_secret", clientSecret)
+	}
+	return requestToken(ctx, p.TokenURL, form)
+}
+
+// AccessToken returns a valid access token for the provider, refreshing
+// and re-saving the stored token if it expired. Returns an error if the
+// user has not logged in.
+func (p *OAuthProvider) AccessToken(ctx context.Context) (string, error) {
+	tok, err := LoadToken(p.Name)
+	if err != nil {
+		return "", err
+	}
+	if tok == nil {
+		return "", fmt.Errorf("not logged in to %s: run `screenshot auth login %s`", p.Name, p.Name)
+	}
+	if tok.valid() {
+		return tok.AccessToken, nil
+	}
+	if tok.RefreshToken == "" {
+		return "", fmt.Errorf("%s token expired: run `screenshot auth login %s`", p.Name, p.Name)
+	}
+
+	clientID, clientSecret, err := p.clientCredentials()
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"client_id":     {clientID},
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tok.RefreshToken},
+	}
+	if clientSecret != "" {
+		form.Set("client_secret", clientSecret)
+	}
+
+	fresh, err := requestToken(ctx, p.TokenURL, form)
+	if err != nil {
+		return "", fmt.Errorf("failed to refresh %s token: %w", p.Name, err)
+	}
+	// Providers may omit the refresh token on refresh; keep the old one
+	if fresh.RefreshToken == "" {
+		fresh.RefreshToken = tok.RefreshToken
+	}
+	if err := saveToken(p.Name, fresh); err != nil {
+		return "", err
+	}
+	return fresh.AccessToken, nil
+}
+
+// oauthError is an error response from a token endpoint
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *oauthError) Error() string {
+	if e.Description != "" {
+		return e.Code + ": " + e.Description
+	}
+	return e.Code
+}
+
+// requestToken posts to a token endpoint and parses the token response
+func requestToken(ctx context.Context, tokenURL string, form url.Values) (*Token, error) {
+	var resp struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		AccountName  string `json:"account_username"`
+		AccountID    string `json:"account_id"`
+	}
+	if err := postForm(ctx, tokenURL, form, &resp); err != nil {
+		return nil, err
+	}
+
+	tok := &Token{
+		AccessToken:  resp.AccessToken,
+		RefreshToken: resp.RefreshToken,
+		TokenType:    resp.TokenType,
+	}
+	if resp.ExpiresIn > 0 {
+		tok.Expiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+	if resp.AccountName != "" {
+		tok.Extra = map[string]string{"account": resp.AccountName}
+	}
+	return tok, nil
+}
+
+// postForm posts a form and decodes the JSON response into v. OAuth error
+// responses are returned as *oauthError.
+func postForm(ctx context.Context, endpoint string, form url.Values, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		var oe oauthError
+		if json.NewDecoder(resp.Body).Decode(&oe) == nil && oe.Code != "" {
+			return &oe
+		}
+		return fmt.Errorf("%s: %s", endpoint, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// tokenPath returns the token file for a provider
+func tokenPath(provider string) (string, error) {
+	dir, err := paths.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "tokens", provider+".json"), nil
+}
+
+// LoadToken reads a stored token. Returns nil without error if none exists.
+func LoadToken(provider string) (*Token, error) {
+	path, err := tokenPath(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token: %w", err)
+	}
+
+	var tok Token
+	if err := json.Unmarshal(data, &tok); err != nil {
+		return nil, fmt.Errorf("corrupt token file %s: %w", path, err)
+	}
+	return &tok, nil
+}
+
+// saveToken writes a token readable only by the user
+func saveToken(provider string, tok *Token) error {
+	path, err := tokenPath(provider)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create token directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(tok, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write token: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// Logout deletes a stored token
+func Logout(provider string) error {
+	path, err := tokenPath(provider)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove token: %w", err)
+	}
+	return nil
+}
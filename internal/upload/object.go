@@ -0,0 +1,75 @@
+package upload
+
+import (
+	"errors"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// objectSchemes are the object storage targets that can also be used as
+// output paths ("gs://bucket/dir/shot.png")
+var objectSchemes = []string{"s3", "gs", "az"}
+
+// SplitObjectURI splits an object storage output path into the upload
+// target for its directory and the file name, e.g.
+// "gs://b/dir/shot.png" -> ("gs://b/dir", "shot.png"). Query options stay
+// with the target. ok is false for anything that isn't an object storage
+// URI.
+func SplitObjectURI(p string) (target, name string, ok bool) {
+	for _, scheme := range objectSchemes {
+		prefix := scheme + "://"
+		if !strings.HasPrefix(p, prefix) {
+			continue
+		}
+		// Options ("s3://b/shot.png?endpoint=...") belong to the target
+		rest, query, hasQuery := strings.Cut(strings.TrimPrefix(p, prefix), "?")
+		i := strings.LastIndex(rest, "/")
+		if i <= 0 || i == len(rest)-1 {
+			return "", "", false
+		}
+		target = prefix + rest[:i]
+		if hasQuery {
+			target += "?" + query
+		}
+		return target, rest[i+1:], true
+	}
+	return "", "", false
+}
+
+// IsObjectTarget reports whether target is object storage, where files
+// keep their names under the target's prefix
+func IsObjectTarget(target string) bool {
+	for _, scheme := range objectSchemes {
+		if strings.HasPrefix(target, scheme+"://") {
+			return true
+		}
+	}
+	return false
+}
+
+// splitBucket splits "bucket/some/prefix" into its bucket and key prefix
+func splitBucket(location string) (bucket, prefix string, err error) {
+	bucket, prefix, _ = strings.Cut(location, "/")
+	if bucket == "" {
+		return "", "", errors.New("missing bucket name")
+	}
+	return bucket, strings.Trim(prefix, "/"), nil
+}
+
+// objectKey joins a key prefix and file name
+func objectKey(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return path.Join(prefix, name)
+}
+
+// escapeKey escapes each segment of an object key for use in a URL path
+func escapeKey(key string) string {
+	parts := strings.Split(key, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,114 @@
+//go:build !noupload && !minimal
+
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// resumeMaxAge is how long an interrupted upload is kept to resume;
+	// services drop unfinished uploads after a while too
+	resumeMaxAge = 7 * 24 * time.Hour
+
+	// fingerprintSample is how much of each end of a file is hashed to
+	// recognize it
+	fingerprintSample = 1 << 20
+)
+
+// resumeState is kept on disk while a resumable upload is unfinished
+type resumeState struct {
+	// Target identifies where the file goes (the object URL, the tus
+	// endpoint)
+	Target string `json:"target"`
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+
+	Started time.Time `json:"started"`
+
+	// UploadID, PartSize and Parts are the S3 multipart upload and the
+	// ETags of the parts sent, by part number
+	UploadID string         `json:"upload_id,omitempty"`
+	PartSize int64          `json:"part_size,omitempty"`
+	Parts    map[int]string `json:"parts,omitempty"`
+
+	// Location is the tus upload URL
+	Location string `json:"location,omitempty"`
+}
+
+// resumable is an upload whose state is kept in resumeDir
+type resumable struct {
+	path string
+}
+
+// openResumable finds the state of an earlier upload of f to target, if
+// resuming is enabled. The file is recognized by its name, size and a
+// hash of its first and last MiB, not its path, so a capture copied into
+// the upload spool resumes the upload of the original. It returns nil if
+// resuming is disabled, and a nil state if there is nothing to resume.
+func openResumable(target string, f *os.File, size int64) (*resumable, *resumeState) {
+	if resumeDir == "" {
+		return nil, nil
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%d\x00", target, filepath.Base(f.Name()), size)
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, min(size, fingerprintSample))); err != nil {
+		return nil, nil
+	}
+	if _, err := io.Copy(h, io.NewSectionReader(f, max(size-fingerprintSample, 0), min(size, fingerprintSample))); err != nil {
+		return nil, nil
+	}
+	r := &resumable{path: filepath.Join(resumeDir, hex.EncodeToString(h.Sum(nil))[:32]+".json")}
+	pruneResumable()
+
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return r, nil
+	}
+	var st resumeState
+	if json.Unmarshal(data, &st) != nil || st.Target != target || st.Size != size || time.Since(st.Started) > resumeMaxAge {
+		r.clear()
+		return r, nil
+	}
+	return r, &st
+}
+
+// pruneResumable removes the state of uploads too old to resume
+func pruneResumable() {
+	entries, _ := os.ReadDir(resumeDir)
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && time.Since(info.ModTime()) > resumeMaxAge {
+			os.Remove(filepath.Join(resumeDir, e.Name()))
+		}
+	}
+}
+
+// save records the state after progress; failing to only costs the
+// ability to resume, so errors are ignored
+func (r *resumable) save(st *resumeState) {
+	if r == nil {
+		return
+	}
+	data, err := json.Marshal(st)
+	if err != nil || os.MkdirAll(filepath.Dir(r.path), 0700) != nil {
+		return
+	}
+	tmp := r.path + ".tmp"
+	if os.WriteFile(tmp, data, 0600) != nil || os.Rename(tmp, r.path) != nil {
+		os.Remove(tmp)
+	}
+}
+
+// clear forgets the state, once the upload is complete or can't resume
+func (r *resumable) clear() {
+	if r != nil {
+		os.Remove(r.path)
+	}
+}
@@ -0,0 +1,560 @@
+//go:build !noupload && !minimal
+
+package upload
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// s3DefaultPartSize is the multipart part size; files up to this size
+	// are sent with a single PUT
+	s3DefaultPartSize = 8 << 20
+
+	// s3MinPartSize is the smallest part size S3 accepts
+	s3MinPartSize = 5 << 20
+
+	// s3Attempts is how many times each request is tried before giving up
+	s3Attempts = 4
+)
+
+func init() {
+	Register("s3", newS3)
+}
+
+// s3 uploads objects to Amazon S3 or an S3-compatible service (MinIO,
+// Ceph, Wasabi, ...). Large files use multipart uploads, and every request
+// is retried on network and server errors so flaky links don't restart a
+// whole upload.
+type s3 struct {
+	bucket    string
+	prefix    string
+	endpoint  *url.URL
+	pathStyle bool
+	region    string
+	partSize  int64
+	sse       string
+	kmsKeyID  string
+	creds     awsCredentials
+}
+
+// awsCredentials are the keys used to sign requests
+type awsCredentials struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// newS3 creates the S3 uploader for "s3://bucket/prefix". Options can be
+// given as query parameters:
+//
+//	endpoint=URL       S3-compatible endpoint (default: $AWS_ENDPOINT_URL_S3, $AWS_ENDPOINT_URL or AWS)
+//	path-style=BOOL    address buckets as endpoint/bucket (default: true with a custom endpoint)
+//	region=NAME        signing region (default: $AWS_REGION, the profile's region, or us-east-1)
+//	sse=ALGORITHM      server-side encryption: AES256 or aws:kms
+//	kms-key-id=ID      KMS key for sse=aws:kms
+//	part-size=MIB      multipart part size in MiB (minimum 5, default 8)
+func newS3(location string) (Uploader, error) {
+	loc, query, _ := strings.Cut(location, "?")
+	bucket, prefix, err := splitBucket(loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 target: %w", err)
+	}
+	opts, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 target options: %w", err)
+	}
+
+	profile := awsProfile()
+	u := &s3{bucket: bucket, prefix: prefix, partSize: s3DefaultPartSize}
+
+	u.region = firstNonEmpty(opts.Get("region"), os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), profile.config["region"], "us-east-1")
+
+	endpoint := firstNonEmpty(opts.Get("endpoint"), os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL"))
+	if endpoint == "" {
+		endpoint = "https://s3." + u.region + ".amazonaws.com"
+	} else {
+		u.pathStyle = true
+	}
+	if u.endpoint, err = url.Parse(strings.TrimRight(endpoint, "/")); err != nil || u.endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", endpoint)
+	}
+
+	if v := opts.Get("path-style"); v != "" {
+		if u.pathStyle, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid s3 path-style option %q", v)
+		}
+	}
+	// Bucket names with dots break TLS for virtual-hosted addressing
+	if strings.Contains(bucket, ".") {
+		u.pathStyle = true
+	}
+
+	switch u.sse = opts.Get("sse"); u.sse {
+	case "", "AES256", "aws:kms":
+	default:
+		return nil, fmt.Errorf("invalid s3 sse option %q (use AES256 or aws:kms)", u.sse)
+	}
+	u.kmsKeyID = opts.Get("kms-key-id")
+	if u.kmsKeyID != "" && u.sse != "aws:kms" {
+		return nil, errors.New("s3 kms-key-id requires sse=aws:kms")
+	}
+
+	if v := opts.Get("part-size"); v != "" {
+		mib, err := strconv.Atoi(v)
+		if err != nil || mib < s3MinPartSize>>20 {
+			return nil, fmt.Errorf("invalid s3 part-size %q (minimum 5 MiB)", v)
+		}
+		u.partSize = int64(mib) << 20
+	}
+
+	u.creds = awsCredentials{
+		accessKey:    firstNonEmpty(os.Getenv("AWS_ACCESS_KEY_ID"), profile.credentials["aws_access_key_id"]),
+		secretKey:    firstNonEmpty(os.Getenv("AWS_SECRET_ACCESS_KEY"), profile.credentials["aws_secret_access_key"]),
+		sessionToken: firstNonEmpty(os.Getenv("AWS_SESSION_TOKEN"), profile.credentials["aws_session_token"]),
+	}
+	if u.creds.accessKey == "" || u.creds.secretKey == "" {
+		return nil, errors.New("no AWS credentials: set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY or configure ~/.aws/credentials")
+	}
+	return u, nil
+}
+
+func (u *s3) Name() string { return "s3" }
+
+func (u *s3) Upload(ctx context.Context, path string) (*Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	key := objectKey(u.prefix, filepath.Base(path))
+	ctype := contentType(path)
+
+	if info.Size() <= u.partSize {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+		headers := u.sseHeaders()
+		headers.Set("Content-Type", ctype)
+		if _, err := u.send(ctx, http.MethodPut, key, nil, headers, data); err != nil {
+			return nil, fmt.Errorf("s3 upload failed: %w", err)
+		}
+	} else if err := u.multipart(ctx, key, ctype, f, info.Size()); err != nil {
+		return nil, err
+	}
+
+	return &Result{Provider: u.Name(), URL: u.objectURL(key).String(), ID: key}, nil
+}
+
+// Delete removes an uploaded object
+func (u *s3) Delete(ctx context.Context, r *Result) error {
+	if _, err := u.send(ctx, http.MethodDelete, r.ID, nil, nil, nil); err != nil {
+		return fmt.Errorf("s3 delete failed: %w", err)
+	}
+	return nil
+}
+
+// multipart uploads f in parts. With resuming enabled, an interrupted
+// upload is left on the service and the parts sent are recorded, so the
+// next upload of the file sends only the rest; otherwise it is aborted so
+// no orphaned parts are left to be billed.
+func (u *s3) multipart(ctx context.Context, key, ctype string, f *os.File, size int64) error {
+	res, st := openResumable(u.objectURL(key).String(), f, size)
+	sent := map[int]string{}
+	if st != nil && st.PartSize == u.partSize {
+		if listed, err := u.listParts(ctx, key, st.UploadID); err == nil {
+			// Only parts the service still has, as they were sent
+			for n, etag := range st.Parts {
+				if listed[n] == etag {
+					sent[n] = etag
+				}
+			}
+		} else {
+			st = nil
+		}
+	} else {
+		st = nil
+	}
+
+	if st == nil {
+		headers := u.sseHeaders()
+		headers.Set("Content-Type", ctype)
+		body, err := u.send(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, headers, nil)
+		if err != nil {
+			return fmt.Errorf("failed to start s3 multipart upload: %w", err)
+		}
+		var initiated struct {
+			UploadID string `xml:"UploadId"`
+		}
+		if err := xml.Unmarshal(body, &initiated); err != nil || initiated.UploadID == "" {
+			return fmt.Errorf("invalid s3 multipart response: %s", body)
+		}
+		st = &resumeState{Target: u.objectURL(key).String(), Name: filepath.Base(f.Name()), Size: size,
+			Started: time.Now().UTC(), UploadID: initiated.UploadID, PartSize: u.partSize}
+	}
+	st.Parts = sent
+	res.save(st)
+	uploadID := st.UploadID
+
+	type part struct {
+		PartNumber int
+		ETag       string
+	}
+	var parts []part
+	buf := make([]byte, u.partSize)
+
+	err := func() error {
+		for n := 1; int64(n-1)*u.partSize < size; n++ {
+			if etag, ok := sent[n]; ok {
+				parts = append(parts, part{PartNumber: n, ETag: etag})
+				continue
+			}
+			chunk := buf[:min(u.partSize, size-int64(n-1)*u.partSize)]
+			if _, err := f.ReadAt(chunk, int64(n-1)*u.partSize); err != nil {
+				return err
+			}
+
+			q := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {uploadID}}
+			resp, err := u.sendResponse(ctx, http.MethodPut, key, q, nil, chunk)
+			if err != nil {
+				return fmt.Errorf("part %d: %w", n, err)
+			}
+			parts = append(parts, part{PartNumber: n, ETag: resp.Get("ETag")})
+			sent[n] = resp.Get("ETag")
+			res.save(st)
+		}
+		return nil
+	}()
+	if err == nil {
+		complete := struct {
+			XMLName xml.Name `xml:"CompleteMultipartUpload"`
+			Parts   []part   `xml:"Part"`
+		}{Parts: parts}
+		var data []byte
+		if data, err = xml.Marshal(complete); err == nil {
+			var body []byte
+			body, err = u.send(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, nil, data)
+			// Completion can fail with a 200 status and an error document
+			if err == nil && bytes.Contains(body, []byte("<Error>")) {
+				err = fmt.Errorf("%s", body)
+			}
+		}
+	}
+	if err != nil && res != nil && !Permanent(err) {
+		return fmt.Errorf("s3 multipart upload interrupted after %d of %d part(s), resumable: %w", len(sent), (size+u.partSize-1)/u.partSize, err)
+	}
+	res.clear()
+	if err != nil {
+		abortCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cancel()
+		u.send(abortCtx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+		return fmt.Errorf("s3 multipart upload failed: %w", err)
+	}
+	return nil
+}
+
+// listParts returns the ETags of the parts of a multipart upload the
+// service has, by part number. It fails if the upload no longer exists.
+func (u *s3) listParts(ctx context.Context, key, uploadID string) (map[int]string, error) {
+	parts := map[int]string{}
+	marker := ""
+	for {
+		q := url.Values{"uploadId": {uploadID}}
+		if marker != "" {
+			q.Set("part-number-marker", marker)
+		}
+		body, err := u.send(ctx, http.MethodGet, key, q, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var list struct {
+			IsTruncated          bool
+			NextPartNumberMarker string
+			Parts                []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &list); err != nil {
+			return nil, fmt.Errorf("invalid s3 list parts response: %w", err)
+		}
+		for _, p := range list.Parts {
+			parts[p.PartNumber] = p.ETag
+		}
+		if !list.IsTruncated || list.NextPartNumberMarker == "" {
+			return parts, nil
+		}
+		marker = list.NextPartNumberMarker
+	}
+}
+
+// sseHeaders returns the server-side encryption headers to send when an
+// object is created
+func (u *s3) sseHeaders() http.Header {
+	h := http.Header{}
+	if u.sse != "" {
+		h.Set("x-amz-server-side-encryption", u.sse)
+	}
+	if u.kmsKeyID != "" {
+		h.Set("x-amz-server-side-encryption-aws-kms-key-id", u.kmsKeyID)
+	}
+	return h
+}
+
+// objectURL returns the URL of an object in the configured addressing style
+func (u *s3) objectURL(key string) *url.URL {
+	o := *u.endpoint
+	base := strings.TrimRight(o.Path, "/")
+	if u.pathStyle {
+		base += "/" + u.bucket
+	} else {
+		o.Host = u.bucket + "." + o.Host
+	}
+
+	// The escaped path is what gets signed, so spell it out in the
+	// encoding SigV4 expects instead of relying on net/url's choices
+	segments := strings.Split(key, "/")
+	for i, seg := range segments {
+		segments[i] = awsEscape(seg)
+	}
+	o.Path = base + "/" + key
+	o.RawPath = base + "/" + strings.Join(segments, "/")
+	return &o
+}
+
+// send performs a signed request and returns the response body
+func (u *s3) send(ctx context.Context, method, key string, query url.Values, headers http.Header, body []byte) ([]byte, error) {
+	var data []byte
+	_, err := u.do(ctx, method, key, query, headers, body, func(resp *http.Response) error {
+		var err error
+		data, err = io.ReadAll(resp.Body)
+		return err
+	})
+	return data, err
+}
+
+// sendResponse performs a signed request and returns the response headers
+func (u *s3) sendResponse(ctx context.Context, method, key string, query url.Values, headers http.Header, body []byte) (http.Header, error) {
+	return u.do(ctx, method, key, query, headers, body, nil)
+}
+
+// do performs a signed request, retrying network errors and 5xx/429
+// responses with exponential backoff
+func (u *s3) do(ctx context.Context, method, key string, query url.Values, headers http.Header, body []byte, read func(*http.Response) error) (http.Header, error) {
+	delay := 500 * time.Millisecond
+	var lastErr error
+
+	for attempt := 1; attempt <= s3Attempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+
+		target := u.objectURL(key)
+		target.RawQuery = s3Query(query)
+		req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range headers {
+			req.Header[k] = v
+		}
+		u.sign(req, body, time.Now().UTC())
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if resp.StatusCode/100 == 2 {
+			if read != nil {
+				err = read(resp)
+			}
+			resp.Body.Close()
+			return resp.Header, err
+		}
+
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		lastErr = &apiError{Code: resp.StatusCode, Status: resp.Status, Body: strings.TrimSpace(string(msg))}
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return nil, lastErr
+		}
+	}
+	return nil, fmt.Errorf("after %d attempts: %w", s3Attempts, lastErr)
+}
+
+// sign adds AWS Signature Version 4 headers to req
+func (u *s3) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if u.creds.sessionToken != "" {
+		req.Header.Set("x-amz-security-token", u.creds.sessionToken)
+	}
+
+	// Sign host and all x-amz-* headers
+	signed := []string{"host"}
+	values := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" {
+			signed = append(signed, lower)
+			values[lower] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	sort.Strings(signed)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range signed {
+		canonicalHeaders.WriteString(name + ":" + values[name] + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + u.region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := hmacSHA256([]byte("AWS4"+u.creds.secretKey), day)
+	key = hmacSHA256(key, u.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		u.creds.accessKey, scope, signedHeaders, signature))
+}
+
+// s3Query encodes query parameters in SigV4 canonical form: sorted, with
+// RFC 3986 escaping
+func s3Query(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape percent-encodes everything except RFC 3986 unreserved characters
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsProfileFiles holds the settings of the active AWS profile
+type awsProfileFiles struct {
+	config      map[string]string
+	credentials map[string]string
+}
+
+// awsProfile reads the $AWS_PROFILE (or default) section of
+// ~/.aws/config and ~/.aws/credentials
+func awsProfile() awsProfileFiles {
+	profile := firstNonEmpty(os.Getenv("AWS_PROFILE"), "default")
+	home, _ := os.UserHomeDir()
+
+	configSection := "profile " + profile
+	if profile == "default" {
+		configSection = "default"
+	}
+	return awsProfileFiles{
+		config:      readINISection(firstNonEmpty(os.Getenv("AWS_CONFIG_FILE"), filepath.Join(home, ".aws", "config")), configSection),
+		credentials: readINISection(firstNonEmpty(os.Getenv("AWS_SHARED_CREDENTIALS_FILE"), filepath.Join(home, ".aws", "credentials")), profile),
+	}
+}
+
+// readINISection returns the key/value pairs of one section of an INI
+// file, or an empty map if the file or section doesn't exist
+func readINISection(path, section string) map[string]string {
+	values := map[string]string{}
+	f, err := os.Open(path)
+	if err != nil {
+		return values
+	}
+	defer f.Close()
+
+	in := false
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+		case line[0] == '[':
+			in = strings.TrimSpace(strings.Trim(line, "[]")) == section
+		case in:
+			k, v, ok := strings.Cut(line, "=")
+			if ok {
+				values[strings.TrimSpace(k)] = strings.TrimSpace(v)
+			}
+		}
+	}
+	return values
+}
+
+// firstNonEmpty returns the first non-empty string
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
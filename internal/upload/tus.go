@@ -0,0 +1,204 @@
+//go:build !noupload && !minimal
+
+package upload
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// tusVersion is the protocol version spoken
+	tusVersion = "1.0.0"
+
+	// tusChunkSize is the most sent in one request, so a dropped
+	// connection costs at most a chunk even with proxies that don't pass
+	// partial requests on
+	tusChunkSize = 8 << 20
+
+	// tusAttempts is how many times in a row a chunk is tried before
+	// giving up
+	tusAttempts = 4
+)
+
+func init() {
+	Register("tus+https", func(location string) (Uploader, error) { return newTus("https", location) })
+	Register("tus+http", func(location string) (Uploader, error) { return newTus("http", location) })
+}
+
+// tus uploads to a server speaking the tus resumable upload protocol
+// (tus.io), for self-hosted targets. The server keeps what it has
+// received, so a failed request is resumed from the server's offset,
+// and with SetResumeDir so is an upload interrupted by a crash.
+type tus struct {
+	endpoint *url.URL
+	token    string
+}
+
+// newTus creates the tus uploader for "tus+https://host/files/". A
+// bearer token is sent if $SCREENSHOT_TUS_TOKEN is set.
+func newTus(scheme, location string) (Uploader, error) {
+	u, err := url.Parse(scheme + "://" + location)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid tus target: expected e.g. tus+https://example.com/files/")
+	}
+	return &tus{endpoint: u, token: os.Getenv("SCREENSHOT_TUS_TOKEN")}, nil
+}
+
+func (u *tus) Name() string { return "tus" }
+
+func (u *tus) Upload(ctx context.Context, path string) (*Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+
+	res, st := openResumable(u.endpoint.String(), f, size)
+	var location string
+	var offset int64
+	if st != nil && st.Location != "" {
+		if offset, err = u.offset(ctx, st.Location); err == nil {
+			location = st.Location
+		}
+	}
+	if location == "" {
+		if location, err = u.create(ctx, filepath.Base(path), size); err != nil {
+			return nil, fmt.Errorf("failed to start tus upload: %w", err)
+		}
+		offset = 0
+		res.save(&resumeState{Target: u.endpoint.String(), Name: filepath.Base(path), Size: size,
+			Started: time.Now().UTC(), Location: location})
+	}
+
+	delay := 500 * time.Millisecond
+	for failures := 0; offset < size; {
+		next, err := u.patch(ctx, location, f, offset, min(tusChunkSize, size-offset))
+		if err == nil {
+			offset, failures, delay = next, 0, 500*time.Millisecond
+			continue
+		}
+
+		// 409 is an offset mismatch: the server got more (or less) of an
+		// earlier request than we thought
+		var apiErr *apiError
+		conflict := errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict
+		if failures++; (Permanent(err) && !conflict) || failures >= tusAttempts || ctx.Err() != nil {
+			if Permanent(err) && !conflict {
+				res.clear()
+			}
+			return nil, fmt.Errorf("tus upload failed after %d of %d bytes: %w", offset, size, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if off, err := u.offset(ctx, location); err == nil {
+			offset = off
+		}
+	}
+	res.clear()
+	return &Result{Provider: u.Name(), URL: location, ID: location}, nil
+}
+
+// Delete removes an upload, if the server supports termination
+func (u *tus) Delete(ctx context.Context, r *Result) error {
+	if _, err := u.do(ctx, http.MethodDelete, r.ID, nil, 0, nil); err != nil {
+		return fmt.Errorf("tus delete failed: %w", err)
+	}
+	return nil
+}
+
+// create starts an upload of size bytes and returns its URL
+func (u *tus) create(ctx context.Context, name string, size int64) (string, error) {
+	h := http.Header{}
+	h.Set("Upload-Length", strconv.FormatInt(size, 10))
+	h.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte(name))+
+		",filetype "+base64.StdEncoding.EncodeToString([]byte(contentType(name))))
+	resp, err := u.do(ctx, http.MethodPost, u.endpoint.String(), h, 0, nil)
+	if err != nil {
+		return "", err
+	}
+	loc, err := u.endpoint.Parse(resp.Get("Location"))
+	if err != nil || resp.Get("Location") == "" {
+		return "", fmt.Errorf("server returned no upload location")
+	}
+	return loc.String(), nil
+}
+
+// offset asks the server how much of an upload it has
+func (u *tus) offset(ctx context.Context, location string) (int64, error) {
+	resp, err := u.do(ctx, http.MethodHead, location, nil, 0, nil)
+	if err != nil {
+		return 0, err
+	}
+	return uploadOffset(resp)
+}
+
+// patch sends n bytes of f from offset and returns the new offset
+func (u *tus) patch(ctx context.Context, location string, f *os.File, offset, n int64) (int64, error) {
+	h := http.Header{}
+	h.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	h.Set("Content-Type", "application/offset+octet-stream")
+	resp, err := u.do(ctx, http.MethodPatch, location, h, n, io.NewSectionReader(f, offset, n))
+	if err != nil {
+		return 0, err
+	}
+	return uploadOffset(resp)
+}
+
+// do sends a tus request and returns the response headers, or an
+// *apiError for non-2xx responses
+func (u *tus) do(ctx context.Context, method, target string, h http.Header, length int64, body io.Reader) (http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range h {
+		req.Header[k] = v
+	}
+	req.Header.Set("Tus-Resumable", tusVersion)
+	if u.token != "" {
+		req.Header.Set("Authorization", "Bearer "+u.token)
+	}
+	if body != nil {
+		req.ContentLength = length
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, &apiError{Code: resp.StatusCode, Status: resp.Status, Body: strings.TrimSpace(string(msg))}
+	}
+	return resp.Header, nil
+}
+
+// uploadOffset reads the Upload-Offset header of a response
+func uploadOffset(h http.Header) (int64, error) {
+	off, err := strconv.ParseInt(h.Get("Upload-Offset"), 10, 64)
+	if err != nil || off < 0 {
+		return 0, fmt.Errorf("invalid Upload-Offset %q", h.Get("Upload-Offset"))
+	}
+	return off, nil
+}
@@ -0,0 +1,159 @@
+// Package upload sends captures to remote storage and sharing services.
+//
+// Providers register a factory for their target scheme; targets are given
+// as "scheme", "scheme:option" or "scheme://location" (e.g. "imgur",
+// "s3://bucket/prefix"). The providers are left out of builds with the
+// noupload or minimal tags, which then have no network client code.
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Result describes a completed upload
+type Result struct {
+	// Provider is the name of the provider that stored the file
+	Provider string `json:"provider"`
+
+	// URL is where the file can be viewed or downloaded
+	URL string `json:"url,omitempty"`
+
+	// ID identifies the remote object for later deletion
+	ID string `json:"id,omitempty"`
+}
+
+// Uploader stores files at a remote target
+type Uploader interface {
+	// Name returns the provider name (e.g. "imgur")
+	Name() string
+
+	// Upload sends the file at path and reports where it ended up
+	Upload(ctx context.Context, path string) (*Result, error)
+}
+
+// Deleter is implemented by uploaders that can remove an earlier upload
+type Deleter interface {
+	Delete(ctx context.Context, r *Result) error
+}
+
+// Factory creates an uploader for a target. location is everything after
+// "scheme:" or "scheme://" (empty for a bare scheme).
+type Factory func(location string) (Uploader, error)
+
+var factories = map[string]Factory{}
+
+// Register makes a provider available under scheme. It is meant to be
+// called from provider init functions.
+func Register(scheme string, f Factory) {
+	factories[scheme] = f
+}
+
+// ErrDisallowed is returned for upload targets the policy forbids
+var ErrDisallowed = errors.New("upload target is not allowed by policy")
+
+var disallowed []string
+
+// Disallow makes New refuse targets matching any of patterns: a bare
+// scheme (imgur) matches every target of that provider, anything else
+// (s3://public-bucket) matches targets it is a prefix of. Case is
+// ignored.
+func Disallow(patterns []string) {
+	disallowed = patterns
+}
+
+// allowed reports whether target passes the Disallow patterns
+func allowed(target, scheme string) bool {
+	for _, p := range disallowed {
+		if strings.Contains(p, ":") {
+			if len(target) >= len(p) && strings.EqualFold(target[:len(p)], p) {
+				return false
+			}
+		} else if strings.EqualFold(scheme, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// Permanent reports whether an upload failed in a way retrying won't
+// fix: the service rejected the request itself (HTTP 4xx other than
+// 401, 403, 408 and 429). Network failures, server errors and expired
+// credentials are worth retrying.
+func Permanent(err error) bool {
+	var p interface{ Permanent() bool }
+	return errors.As(err, &p) && p.Permanent()
+}
+
+// maxRate caps upload bandwidth in bytes per second; 0 is no limit
+var maxRate int64
+
+// SetMaxRate limits the bandwidth all uploads share, in bytes per
+// second; 0 removes the limit
+func SetMaxRate(bytesPerSecond int64) {
+	maxRate = bytesPerSecond
+}
+
+// resumeDir keeps the state of interrupted uploads; empty disables
+// resuming
+var resumeDir string
+
+// SetResumeDir makes large uploads (S3 multipart, tus) resumable, keeping
+// their state in dir: an upload of the same file to the same target
+// after a dropped connection, a crash or in a later run carries on from
+// what was already sent. Empty disables resuming.
+func SetResumeDir(dir string) {
+	resumeDir = dir
+}
+
+// progressKey holds the WithProgress function of a context
+type progressKey struct{}
+
+// WithProgress returns a context that makes uploads using it call fn as
+// request bodies are sent, with the bytes just sent. Bodies include
+// protocol overhead such as multipart headers, so the sum can slightly
+// exceed the file size.
+func WithProgress(ctx context.Context, fn func(n int64)) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// progressOf returns the WithProgress function of ctx, or nil
+func progressOf(ctx context.Context) func(n int64) {
+	fn, _ := ctx.Value(progressKey{}).(func(n int64))
+	return fn
+}
+
+// Schemes returns the registered target schemes
+func Schemes() []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates the uploader for a target string
+func New(target string) (Uploader, error) {
+	scheme, location := target, ""
+	if i := strings.Index(target, ":"); i >= 0 {
+		scheme = target[:i]
+		location = strings.TrimPrefix(target[i+1:], "//")
+	}
+
+	if !allowed(target, scheme) {
+		return nil, fmt.Errorf("%w: %s", ErrDisallowed, target)
+	}
+
+	f, ok := factories[strings.ToLower(scheme)]
+	if !ok && len(factories) == 0 {
+		return nil, fmt.Errorf("uploads are not compiled into this binary (built with -tags noupload or minimal)")
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown upload target %q (available: %s)", target, strings.Join(Schemes(), ", "))
+	}
+	return f(location)
+}
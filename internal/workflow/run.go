@@ -0,0 +1,440 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/robotin/screenshot/internal/annotate"
+	"github.com/robotin/screenshot/internal/capture"
+	"github.com/robotin/screenshot/internal/config"
+	"github.com/robotin/screenshot/internal/notify"
+	"github.com/robotin/screenshot/internal/strategy"
+	"github.com/robotin/screenshot/internal/upload"
+	"github.com/robotin/screenshot/internal/xwin"
+)
+
+// defaultWaitTimeout bounds wait steps without a timeout
+const defaultWaitTimeout = 30 * time.Second
+
+// Runner executes workflows
+type Runner struct {
+	Capturer *capture.Capturer
+
+	// Display is the X11 display used for captures and window lookups
+	Display string
+
+	// Log receives one line per step (may be nil)
+	Log io.Writer
+
+	// Config resolves output names and virtual monitors in capture steps
+	// (may be nil)
+	Config *config.Config
+
+	vars map[string]string
+	img  image.Image
+	enc  capture.EncodeOptions
+}
+
+// Run executes the workflow's steps in order, stopping at the first
+// error. overrides replace the workflow's vars.
+func (r *Runner) Run(ctx context.Context, w *Workflow, overrides map[string]string) error {
+	base := capture.TemplateVars(time.Now())
+	r.vars = map[string]string{}
+	for name, v := range base {
+		r.vars[name] = v
+	}
+	for name, v := range w.Vars {
+		expanded, err := capture.ExpandText(v, base)
+		if err != nil {
+			return fmt.Errorf("var %s: %w", name, err)
+		}
+		r.vars[name] = expanded
+	}
+	for name, v := range overrides {
+		r.vars[name] = v
+	}
+
+	for i := range w.Steps {
+		step := &w.Steps[i]
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		r.logf("%s", step.label(i))
+		if err := r.step(ctx, step); err != nil {
+			return fmt.Errorf("%s: %w", step.label(i), err)
+		}
+	}
+	return nil
+}
+
+// Vars returns the variables after a run (path, url, window_title, ...)
+func (r *Runner) Vars() map[string]string {
+	return r.vars
+}
+
+func (r *Runner) logf(format string, args ...any) {
+	if r.Log != nil {
+		fmt.Fprintf(r.Log, format+"\n", args...)
+	}
+}
+
+// expand fills placeholders in a step field
+func (r *Runner) expand(s string) (string, error) {
+	return capture.ExpandText(s, r.vars)
+}
+
+// step runs a single step
+func (r *Runner) step(ctx context.Context, s *Step) error {
+	switch {
+	case s.Set != nil:
+		for name, v := range s.Set {
+			expanded, err := r.expand(v)
+			if err != nil {
+				return err
+			}
+			r.vars[name] = expanded
+		}
+		return nil
+	case s.Sleep != "":
+		d, err := time.ParseDuration(s.Sleep)
+		if err != nil {
+			return fmt.Errorf("invalid sleep: %w", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d):
+			return nil
+		}
+	case s.Wait != nil:
+		return r.wait(ctx, s.Wait)
+	case s.Capture != nil:
+		return r.capture(s.Capture)
+	case s.Annotate != nil:
+		return r.annotate(s.Annotate)
+	case s.Upload != "":
+		return r.upload(ctx, s.Upload)
+	case s.Notify != nil:
+		return r.notify(ctx, s.Notify)
+	default:
+		return r.exec(ctx, s.Exec)
+	}
+}
+
+// wait polls for a matching window
+func (r *Runner) wait(ctx context.Context, w *Wait) error {
+	pattern, err := r.expand(w.Window)
+	if err != nil {
+		return err
+	}
+	if pattern == "" {
+		return errors.New("wait needs a window pattern")
+	}
+
+	timeout := defaultWaitTimeout
+	if w.Timeout != "" {
+		if timeout, err = time.ParseDuration(w.Timeout); err != nil {
+			return fmt.Errorf("invalid timeout: %w", err)
+		}
+	}
+
+	conn, err := xwin.Connect(r.Display)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		win, err := conn.Find(pattern)
+		if err != nil {
+			return err
+		}
+		if win != nil {
+			r.setWindow(win)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("no window matching %q after %s", pattern, timeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
+
+// setWindow records a window in the variables
+func (r *Runner) setWindow(w *xwin.Window) {
+	r.vars["window_id"] = strconv.FormatUint(uint64(w.ID), 10)
+	r.vars["window_title"] = w.Title
+	r.vars["window_class"] = w.Class
+}
+
+// capture grabs the screen and saves the image
+func (r *Runner) capture(c *Capture) error {
+	opts := strategy.CaptureOptions{Monitor: -1, Display: r.Display}
+	if c.Monitor != "" {
+		if err := r.resolveMonitor(c.Monitor, &opts); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case c.Window != "" && c.Region != "":
+		return errors.New("capture takes either window or region, not both")
+	case opts.Region != nil && (c.Window != "" || c.Region != ""):
+		return errors.New("a virtual monitor cannot be combined with window or region")
+	case c.Window != "":
+		pattern, err := r.expand(c.Window)
+		if err != nil {
+			return err
+		}
+		win, err := r.findWindow(pattern)
+		if err != nil {
+			return err
+		}
+		opts.WindowID = uint64(win.ID)
+		opts.Region = &win.Bounds
+	case c.Region != "":
+		region, err := r.expand(c.Region)
+		if err != nil {
+			return err
+		}
+		if opts.Region, err = strategy.ParseRegion(region); err != nil {
+			return fmt.Errorf("invalid region: %w", err)
+		}
+	}
+
+	output := c.Output
+	if output == "" {
+		output = "screenshot_{date}_{time}.png"
+	}
+	path, err := capture.ExpandTemplate(output, r.vars)
+	if err != nil {
+		return err
+	}
+
+	r.enc = capture.EncodeOptions{Format: capture.FormatPNG, CompressionLevel: 1}
+	if c.Compress != nil {
+		r.enc.CompressionLevel = *c.Compress
+	}
+	if c.Format != "" {
+		if r.enc.Format, err = capture.ParseFormat(c.Format); err != nil {
+			return err
+		}
+	} else if f, ok := capture.FormatFromPath(path); ok {
+		r.enc.Format = f
+	}
+	if c.Verify {
+		if r.enc.Format != capture.FormatPNG {
+			return errors.New("verify needs PNG output")
+		}
+		r.enc.Verify = true
+	}
+
+	bg, err := capture.ParseBackground(c.Background)
+	if err != nil {
+		return err
+	}
+
+	img, err := r.Capturer.Capture(opts)
+	if err != nil {
+		return fmt.Errorf("capture failed: %w", err)
+	}
+	img = bg.Apply(img)
+	if err := capture.Save(img, path, r.enc); err != nil {
+		return err
+	}
+
+	r.img = img
+	r.vars["path"] = path
+	r.vars["width"] = strconv.Itoa(img.Bounds().Dx())
+	r.vars["height"] = strconv.Itoa(img.Bounds().Dy())
+	delete(r.vars, "url")
+	r.logf("  saved %s", path)
+	return nil
+}
+
+// resolveMonitor sets the monitor index, or the area of a virtual monitor
+func (r *Runner) resolveMonitor(spec string, opts *strategy.CaptureOptions) error {
+	spec, err := r.expand(spec)
+	if err != nil {
+		return err
+	}
+	if i, err := strconv.Atoi(spec); err == nil {
+		opts.Monitor = i
+		return nil
+	}
+
+	monitors, err := r.Capturer.ListMonitors()
+	if err != nil {
+		return err
+	}
+	cfg := r.Config
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	opts.Monitor, opts.Region, err = cfg.Resolve(spec, monitors)
+	return err
+}
+
+// findWindow looks up the active or a matching window
+func (r *Runner) findWindow(pattern string) (*xwin.Window, error) {
+	conn, err := xwin.Connect(r.Display)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var win *xwin.Window
+	if pattern == "active" {
+		win, err = conn.ActiveWindow()
+	} else {
+		win, err = conn.Find(pattern)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if win == nil {
+		return nil, fmt.Errorf("no window matching %q", pattern)
+	}
+
+	r.setWindow(win)
+	return win, nil
+}
+
+// annotate draws on the current capture and rewrites its file
+func (r *Runner) annotate(ops []annotate.Op) error {
+	if r.img == nil {
+		return errors.New("annotate needs a previous capture step")
+	}
+
+	expanded := make([]annotate.Op, len(ops))
+	for i, op := range ops {
+		text, err := r.expand(op.Text)
+		if err != nil {
+			return err
+		}
+		op.Text = text
+		expanded[i] = op
+	}
+
+	// SVG keeps the annotations as elements over the unchanged capture;
+	// each step adds to those of the steps before
+	if r.enc.Format == capture.FormatSVG {
+		enc := r.enc
+		enc.Annotations = append(slices.Clip(r.enc.Annotations), expanded...)
+		if err := capture.Save(r.img, r.vars["path"], enc); err != nil {
+			return err
+		}
+		r.enc = enc
+		return nil
+	}
+
+	img, err := annotate.Apply(r.img, expanded)
+	if err != nil {
+		return err
+	}
+	if err := capture.Save(img, r.vars["path"], r.enc); err != nil {
+		return err
+	}
+	r.img = img
+	return nil
+}
+
+// upload sends the current capture to a target
+func (r *Runner) upload(ctx context.Context, target string) error {
+	path := r.vars["path"]
+	if path == "" {
+		return errors.New("upload needs a previous capture step")
+	}
+
+	target, err := r.expand(target)
+	if err != nil {
+		return err
+	}
+	u, err := upload.New(target)
+	if err != nil {
+		return err
+	}
+
+	res, err := u.Upload(ctx, path)
+	if err != nil {
+		return fmt.Errorf("upload to %s failed: %w", u.Name(), err)
+	}
+	r.vars["url"] = res.URL
+	r.logf("  uploaded %s", res.URL)
+	return nil
+}
+
+// notify sends a webhook event for the current capture
+func (r *Runner) notify(ctx context.Context, n *Notify) error {
+	path := r.vars["path"]
+	if path == "" {
+		return errors.New("notify needs a previous capture step")
+	}
+
+	url, err := r.expand(n.Webhook)
+	if err != nil {
+		return err
+	}
+	secret, err := r.expand(n.Secret)
+	if err != nil {
+		return err
+	}
+
+	tags := make([]string, len(n.Tags))
+	for i, t := range n.Tags {
+		if tags[i], err = r.expand(t); err != nil {
+			return err
+		}
+	}
+
+	var width, height int
+	if r.img != nil {
+		width, height = r.img.Bounds().Dx(), r.img.Bounds().Dy()
+	}
+	ev := notify.NewEvent(path, r.vars["url"], string(r.enc.Format), width, height, tags)
+	if err := ev.Checksum(path); err != nil {
+		return err
+	}
+
+	hook := &notify.Webhook{URL: url, Secret: []byte(secret)}
+	return hook.Send(ctx, ev)
+}
+
+// exec runs a shell command. Placeholders are not expanded into the
+// command line, since values such as window titles are not trusted;
+// variables are exported as $SCREENSHOT_<NAME> instead.
+func (r *Runner) exec(ctx context.Context, command string) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+
+	names := make([]string, 0, len(r.vars))
+	for name := range r.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmd.Env = append(cmd.Env, envName(name)+"="+r.vars[name])
+	}
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("command failed: %w", err)
+	}
+	return nil
+}
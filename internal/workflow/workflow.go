@@ -0,0 +1,144 @@
+// Package workflow runs declarative capture pipelines described in YAML:
+// a list of steps (wait for a window, capture, annotate, upload, notify,
+// run a command) sharing {placeholder} variables.
+package workflow
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/robotin/screenshot/internal/annotate"
+	"gopkg.in/yaml.v3"
+)
+
+// Workflow is a parsed workflow file
+type Workflow struct {
+	// Vars are defaults for {placeholder} variables; they may use the
+	// built-in date/host placeholders and can be overridden on the
+	// command line
+	Vars map[string]string `yaml:"vars"`
+
+	Steps []Step `yaml:"steps"`
+}
+
+// Step is one action. Exactly one action field is set.
+type Step struct {
+	// Name labels the step in progress output and errors
+	Name string `yaml:"name"`
+
+	Set      map[string]string `yaml:"set"`
+	Sleep    string            `yaml:"sleep"`
+	Wait     *Wait             `yaml:"wait"`
+	Capture  *Capture          `yaml:"capture"`
+	Annotate []annotate.Op     `yaml:"annotate"`
+	Upload   string            `yaml:"upload"`
+	Notify   *Notify           `yaml:"notify"`
+	Exec     string            `yaml:"exec"`
+}
+
+// Wait blocks until a window matching Window (title, class or instance
+// substring) exists
+type Wait struct {
+	Window  string `yaml:"window"`
+	Timeout string `yaml:"timeout"`
+}
+
+// Capture grabs the screen and saves it to Output
+type Capture struct {
+	// Monitor is an index, output name or virtual monitor (default: all)
+	Monitor string `yaml:"monitor"`
+	Region  string `yaml:"region"`
+
+	// Window captures a window's contents: "active" or a title/class
+	// pattern. ARGB windows keep their alpha channel unless Background
+	// is set.
+	Window string `yaml:"window"`
+
+	// Background composites translucent pixels onto "checker" or a color
+	// (default: none)
+	Background string `yaml:"background"`
+
+	Output   string `yaml:"output"`
+	Format   string `yaml:"format"`
+	Compress *int   `yaml:"compress"`
+
+	// Verify reads the saved PNG back and checks it matches the capture
+	Verify bool `yaml:"verify"`
+}
+
+// Notify sends the webhook event for the current capture
+type Notify struct {
+	Webhook string   `yaml:"webhook"`
+	Secret  string   `yaml:"secret"`
+	Tags    []string `yaml:"tags"`
+}
+
+// Load reads and validates a workflow file
+func Load(path string) (*Workflow, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workflow: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse parses and validates a workflow. Unknown keys are rejected so
+// typos don't silently skip steps.
+func Parse(data []byte) (*Workflow, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	var w Workflow
+	if err := dec.Decode(&w); err != nil {
+		return nil, fmt.Errorf("invalid workflow: %w", err)
+	}
+	if len(w.Steps) == 0 {
+		return nil, errors.New("invalid workflow: no steps")
+	}
+
+	for i, step := range w.Steps {
+		if n := len(step.actions()); n != 1 {
+			return nil, fmt.Errorf("invalid workflow: %s must have exactly one action (has %d)", step.label(i), n)
+		}
+	}
+	return &w, nil
+}
+
+// actions returns the names of the action fields set on a step
+func (s *Step) actions() []string {
+	var set []string
+	add := func(name string, ok bool) {
+		if ok {
+			set = append(set, name)
+		}
+	}
+	add("set", s.Set != nil)
+	add("sleep", s.Sleep != "")
+	add("wait", s.Wait != nil)
+	add("capture", s.Capture != nil)
+	add("annotate", s.Annotate != nil)
+	add("upload", s.Upload != "")
+	add("notify", s.Notify != nil)
+	add("exec", s.Exec != "")
+	return set
+}
+
+// label describes a step for messages: its name, or its position and action
+func (s *Step) label(i int) string {
+	if s.Name != "" {
+		return fmt.Sprintf("step %d (%s)", i+1, s.Name)
+	}
+	if a := s.actions(); len(a) == 1 {
+		return fmt.Sprintf("step %d (%s)", i+1, a[0])
+	}
+	return fmt.Sprintf("step %d", i+1)
+}
+
+// envName returns the environment variable a workflow variable is
+// exported as to exec steps
+func envName(name string) string {
+	return "SCREENSHOT_" + strings.ToUpper(name)
+}
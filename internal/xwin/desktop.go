@@ -0,0 +1,71 @@
+package xwin
+
+import (
+	"fmt"
+	"image"
+	"strings"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+// windowTypes are the EWMH window types reported in Window.Type
+var windowTypes = []string{"normal", "dialog", "utility", "toolbar", "menu", "splash", "dock", "desktop"}
+
+// windowType returns the first known type in _NET_WM_WINDOW_TYPE (e.g.
+// "dock", "desktop"), or "" if the client doesn't set one
+func (c *Conn) windowType(win xproto.Window) string {
+	reply, err := c.property(win, "_NET_WM_WINDOW_TYPE")
+	if err != nil || reply.Format != 32 {
+		return ""
+	}
+	for i := 0; i < int(reply.ValueLen); i++ {
+		a := xproto.Atom(xgb.Get32(reply.Value[i*4:]))
+		for _, t := range windowTypes {
+			if known, err := c.atom("_NET_WM_WINDOW_TYPE_" + strings.ToUpper(t)); err == nil && known == a {
+				return t
+			}
+		}
+	}
+	return ""
+}
+
+// WorkArea returns the part of the screen not reserved by panels and
+// docks on the current desktop (_NET_WORKAREA). With several monitors
+// it is a single rectangle across them, as EWMH defines it.
+func (c *Conn) WorkArea() (image.Rectangle, error) {
+	reply, err := c.property(c.root, "_NET_WORKAREA")
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	if reply.Format != 32 || reply.ValueLen < 4 {
+		return image.Rectangle{}, fmt.Errorf("the window manager doesn't set _NET_WORKAREA")
+	}
+
+	desktop := 0
+	if cur, err := c.property(c.root, "_NET_CURRENT_DESKTOP"); err == nil && cur.Format == 32 && cur.ValueLen > 0 {
+		desktop = int(xgb.Get32(cur.Value))
+	}
+	if (desktop+1)*4 > int(reply.ValueLen) {
+		desktop = 0
+	}
+
+	v := reply.Value[desktop*16:]
+	x, y := int(int32(xgb.Get32(v))), int(int32(xgb.Get32(v[4:])))
+	w, h := int(xgb.Get32(v[8:])), int(xgb.Get32(v[12:]))
+	return image.Rect(x, y, x+w, y+h), nil
+}
+
+// FrameBounds returns a window's bounds including the title bar and
+// borders the window manager draws around it (_NET_FRAME_EXTENTS), or
+// just its bounds when it has none
+func (c *Conn) FrameBounds(w *Window) image.Rectangle {
+	reply, err := c.property(xproto.Window(w.ID), "_NET_FRAME_EXTENTS")
+	if err != nil || reply.Format != 32 || reply.ValueLen < 4 {
+		return w.Bounds
+	}
+	left, right := int(xgb.Get32(reply.Value)), int(xgb.Get32(reply.Value[4:]))
+	top, bottom := int(xgb.Get32(reply.Value[8:])), int(xgb.Get32(reply.Value[12:]))
+	b := w.Bounds
+	return image.Rect(b.Min.X-left, b.Min.Y-top, b.Max.X+right, b.Max.Y+bottom)
+}
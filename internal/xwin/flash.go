@@ -0,0 +1,42 @@
+package xwin
+
+import (
+	"fmt"
+	"image"
+	"time"
+
+	"github.com/jezek/xgb/xproto"
+)
+
+// Flash covers area (in screen coordinates) with a white override-redirect
+// window for d, as a visual confirmation of a capture
+func (c *Conn) Flash(area image.Rectangle, d time.Duration) error {
+	if area.Empty() {
+		return nil
+	}
+	screen := xproto.Setup(c.x).DefaultScreen(c.x)
+
+	win, err := xproto.NewWindowId(c.x)
+	if err != nil {
+		return fmt.Errorf("failed to allocate window: %w", err)
+	}
+	err = xproto.CreateWindowChecked(c.x, screen.RootDepth, win, c.root,
+		int16(area.Min.X), int16(area.Min.Y), uint16(area.Dx()), uint16(area.Dy()), 0,
+		xproto.WindowClassInputOutput, screen.RootVisual,
+		xproto.CwBackPixel|xproto.CwOverrideRedirect,
+		[]uint32{screen.WhitePixel, 1}).Check()
+	if err != nil {
+		return fmt.Errorf("failed to create flash window: %w", err)
+	}
+	defer xproto.DestroyWindow(c.x, win)
+
+	if err := xproto.MapWindowChecked(c.x, win).Check(); err != nil {
+		return fmt.Errorf("failed to map flash window: %w", err)
+	}
+	time.Sleep(d)
+
+	// Make sure the window is gone before returning
+	xproto.DestroyWindow(c.x, win)
+	_, err = xproto.GetInputFocus(c.x).Reply()
+	return err
+}
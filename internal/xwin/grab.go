@@ -0,0 +1,168 @@
+package xwin
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+
+	"github.com/jezek/xgb/xproto"
+)
+
+// grabBandBytes caps the size of one GetImage reply; larger areas are
+// read in horizontal bands
+const grabBandBytes = 8 << 20
+
+// RootBounds returns the size of the root window (the whole virtual
+// screen)
+func (c *Conn) RootBounds() image.Rectangle {
+	screen := xproto.Setup(c.x).DefaultScreen(c.x)
+	return image.Rect(0, 0, int(screen.WidthInPixels), int(screen.HeightInPixels))
+}
+
+// Grab reads an area of the screen with plain GetImage requests on the
+// root window. It needs no X extensions and no shared memory, so it works
+// on any architecture Go supports and over remote connections. Pixels are
+// decoded with the root visual's color masks, so BGR and 16-bit visuals
+// come out with correct colors. Parts of r outside the screen are black.
+func (c *Conn) Grab(r image.Rectangle) (*image.RGBA, error) {
+	f, err := c.rootFormat()
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+	area := r.Intersect(c.RootBounds())
+	if area.Empty() {
+		return img, nil
+	}
+
+	w, h := area.Dx(), area.Dy()
+	stride := f.stride(w)
+	band := max(1, min(h, grabBandBytes/stride))
+	for y0 := 0; y0 < h; y0 += band {
+		bh := min(band, h-y0)
+		reply, err := xproto.GetImage(c.x, xproto.ImageFormatZPixmap, xproto.Drawable(c.root),
+			int16(area.Min.X), int16(area.Min.Y+y0), uint16(w), uint16(bh), 0xffffffff).Reply()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read screen contents: %w", err)
+		}
+		if len(reply.Data) < stride*bh {
+			return nil, fmt.Errorf("short screen image (%d bytes for %dx%d)", len(reply.Data), w, bh)
+		}
+
+		for y := 0; y < bh; y++ {
+			row := reply.Data[y*stride:]
+			out := img.Pix[img.PixOffset(area.Min.X-r.Min.X, area.Min.Y-r.Min.Y+y0+y):]
+			for x := 0; x < w; x++ {
+				p := pixel(row[x*f.bytesPP:x*f.bytesPP+f.bytesPP], f.msb)
+				out[x*4] = f.red.value(p)
+				out[x*4+1] = f.green.value(p)
+				out[x*4+2] = f.blue.value(p)
+			}
+		}
+	}
+	return img, nil
+}
+
+// pixelFormat is how the root window's pixels are laid out in images
+// exchanged with the server
+type pixelFormat struct {
+	depth            byte
+	bytesPP, pad     int
+	msb              bool
+	red, green, blue channel
+}
+
+// rootFormat reads the root window's pixel format from the connection
+// setup. Only TrueColor visuals with 16, 24 or 32 bits per pixel are
+// supported.
+func (c *Conn) rootFormat() (pixelFormat, error) {
+	setup := xproto.Setup(c.x)
+	screen := setup.DefaultScreen(c.x)
+
+	var visual *xproto.VisualInfo
+	for _, d := range screen.AllowedDepths {
+		for i, v := range d.Visuals {
+			if v.VisualId == screen.RootVisual {
+				visual = &d.Visuals[i]
+			}
+		}
+	}
+	if visual == nil {
+		return pixelFormat{}, fmt.Errorf("root visual %d not found", screen.RootVisual)
+	}
+	if visual.Class != xproto.VisualClassTrueColor && visual.Class != xproto.VisualClassDirectColor {
+		return pixelFormat{}, fmt.Errorf("unsupported root visual class %d (TrueColor needed)", visual.Class)
+	}
+
+	bpp, pad := 0, 0
+	for _, f := range setup.PixmapFormats {
+		if f.Depth == screen.RootDepth {
+			bpp, pad = int(f.BitsPerPixel), int(f.ScanlinePad)
+		}
+	}
+	if bpp != 16 && bpp != 24 && bpp != 32 {
+		return pixelFormat{}, fmt.Errorf("unsupported root depth %d (%d bits per pixel)", screen.RootDepth, bpp)
+	}
+
+	return pixelFormat{
+		depth:   screen.RootDepth,
+		bytesPP: bpp / 8,
+		pad:     pad,
+		msb:     setup.ImageByteOrder == xproto.ImageOrderMSBFirst,
+		red:     newChannel(visual.RedMask),
+		green:   newChannel(visual.GreenMask),
+		blue:    newChannel(visual.BlueMask),
+	}, nil
+}
+
+// stride returns the length of an image row w pixels wide, padded as the
+// server requires
+func (f pixelFormat) stride(w int) int {
+	bits := w * f.bytesPP * 8
+	return (bits + f.pad - 1) / f.pad * f.pad / 8
+}
+
+// pixel assembles a pixel value from its bytes in the server's byte order
+func pixel(b []byte, msb bool) uint32 {
+	var p uint32
+	for i := range b {
+		if msb {
+			p = p<<8 | uint32(b[i])
+		} else {
+			p |= uint32(b[i]) << (8 * i)
+		}
+	}
+	return p
+}
+
+// channel extracts one color component from a pixel value and scales it
+// to 8 bits
+type channel struct {
+	mask  uint32
+	shift int
+	max   uint32
+}
+
+func newChannel(mask uint32) channel {
+	if mask == 0 {
+		return channel{}
+	}
+	shift := bits.TrailingZeros32(mask)
+	return channel{mask: mask, shift: shift, max: mask >> shift}
+}
+
+func (c channel) value(p uint32) uint8 {
+	if c.max == 0 {
+		return 0
+	}
+	return uint8(((p & c.mask) >> c.shift) * 255 / c.max)
+}
+
+// pixel scales an 8 bit component to the channel and moves it in place
+func (c channel) pixel(v uint8) uint32 {
+	return (uint32(v)*c.max + 127) / 255 << c.shift
+}
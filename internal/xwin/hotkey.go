@@ -0,0 +1,168 @@
+package xwin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+// Key is a key combination grabbed as a global hotkey
+type Key struct {
+	// Sym is the X keysym, Mods the modifiers held with it
+	Sym  xproto.Keysym
+	Mods uint16
+
+	name string
+}
+
+// String returns the combination as it was given
+func (k Key) String() string {
+	return k.name
+}
+
+// keyModifiers are the modifier names ParseKey accepts
+var keyModifiers = map[string]uint16{
+	"ctrl":    xproto.ModMaskControl,
+	"control": xproto.ModMaskControl,
+	"alt":     xproto.ModMask1,
+	"shift":   xproto.ModMaskShift,
+	"super":   xproto.ModMask4,
+	"win":     xproto.ModMask4,
+}
+
+// keyNames are the keysyms of the named keys ParseKey accepts, besides
+// letters, digits and F1-F24
+var keyNames = map[string]xproto.Keysym{
+	"escape":     0xff1b,
+	"esc":        0xff1b,
+	"pause":      0xff13,
+	"scrolllock": 0xff14,
+	"print":      0xff61,
+	"delete":     0xffff,
+	"backspace":  0xff08,
+	"space":      0x0020,
+	"tab":        0xff09,
+	"enter":      0xff0d,
+	"return":     0xff0d,
+	"home":       0xff50,
+	"end":        0xff57,
+	"insert":     0xff63,
+}
+
+// ParseKey parses a key combination such as ctrl+alt+shift+p or
+// super+Pause: modifiers (ctrl, alt, shift, super) and one key, a letter,
+// digit, F1-F24 or a named key (Escape, Pause, ScrollLock, Print, ...),
+// ignoring case
+func ParseKey(s string) (Key, error) {
+	k := Key{name: s}
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(s)), "+")
+	for _, p := range parts[:len(parts)-1] {
+		mod, ok := keyModifiers[strings.TrimSpace(p)]
+		if !ok {
+			return k, fmt.Errorf("invalid key %q: unknown modifier %q (expected ctrl, alt, shift or super)", s, p)
+		}
+		k.Mods |= mod
+	}
+
+	key := strings.ReplaceAll(strings.TrimSpace(parts[len(parts)-1]), "_", "")
+	switch {
+	case len(key) == 1 && (key[0] >= 'a' && key[0] <= 'z' || key[0] >= '0' && key[0] <= '9'):
+		k.Sym = xproto.Keysym(key[0])
+	case len(key) > 1 && key[0] == 'f':
+		n, err := strconv.Atoi(key[1:])
+		if err != nil || n < 1 || n > 24 {
+			return k, fmt.Errorf("invalid key %q: unknown key %q", s, key)
+		}
+		k.Sym = 0xffbe + xproto.Keysym(n-1)
+	default:
+		sym, ok := keyNames[key]
+		if !ok {
+			return k, fmt.Errorf("invalid key %q: unknown key %q", s, key)
+		}
+		k.Sym = sym
+	}
+	return k, nil
+}
+
+// KeyWatcher delivers presses of a global hotkey
+type KeyWatcher struct {
+	x *xgb.Conn
+
+	// C receives a value for each press; presses while one is pending
+	// are dropped
+	C <-chan struct{}
+}
+
+// WatchKey grabs a key combination on the given display, so pressing it
+// anywhere reaches C instead of the focused window. An empty display
+// uses $DISPLAY.
+func WatchKey(display string, k Key) (*KeyWatcher, error) {
+	x, err := dial(display)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to X server: %w", err)
+	}
+
+	setup := xproto.Setup(x)
+	root := setup.DefaultScreen(x).Root
+	code, err := keycode(x, setup, k.Sym)
+	if err != nil {
+		x.Close()
+		return nil, fmt.Errorf("cannot grab %s: %w", k, err)
+	}
+
+	// Caps Lock and Num Lock count as modifiers: grab the key with and
+	// without them, or it stops working while either is on
+	for _, locks := range []uint16{0, xproto.ModMaskLock, xproto.ModMask2, xproto.ModMaskLock | xproto.ModMask2} {
+		err := xproto.GrabKeyChecked(x, true, root, k.Mods|locks, code, xproto.GrabModeAsync, xproto.GrabModeAsync).Check()
+		if err != nil {
+			x.Close()
+			return nil, fmt.Errorf("failed to grab %s (is another program using it?): %w", k, err)
+		}
+	}
+
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer close(ch)
+		for {
+			ev, err := x.WaitForEvent()
+			if ev == nil && err == nil {
+				// Connection closed
+				return
+			}
+			if e, ok := ev.(xproto.KeyPressEvent); ok && e.Detail == code {
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return &KeyWatcher{x: x, C: ch}, nil
+}
+
+// Close releases the key and closes the connection
+func (w *KeyWatcher) Close() {
+	w.x.Close()
+}
+
+// keycode returns the keycode that types sym in the current keyboard
+// mapping
+func keycode(x *xgb.Conn, setup *xproto.SetupInfo, sym xproto.Keysym) (xproto.Keycode, error) {
+	first := setup.MinKeycode
+	count := byte(setup.MaxKeycode - first + 1)
+	reply, err := xproto.GetKeyboardMapping(x, first, count).Reply()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the keyboard mapping: %w", err)
+	}
+	per := int(reply.KeysymsPerKeycode)
+	for i, s := range reply.Keysyms {
+		if s == sym {
+			return first + xproto.Keycode(i/per), nil
+		}
+	}
+	return 0, fmt.Errorf("no key on the keyboard types it")
+}
@@ -0,0 +1,23 @@
+package xwin
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jezek/xgb/screensaver"
+	"github.com/jezek/xgb/xproto"
+)
+
+// IdleTime returns how long ago the X server last saw keyboard or pointer
+// input, from the MIT-SCREEN-SAVER extension. Under XWayland only input
+// to X11 clients counts.
+func (c *Conn) IdleTime() (time.Duration, error) {
+	if err := screensaver.Init(c.x); err != nil {
+		return 0, fmt.Errorf("MIT-SCREEN-SAVER extension not available: %w", err)
+	}
+	reply, err := screensaver.QueryInfo(c.x, xproto.Drawable(c.root)).Reply()
+	if err != nil {
+		return 0, fmt.Errorf("failed to query idle time: %w", err)
+	}
+	return time.Duration(reply.MsSinceUserInput) * time.Millisecond, nil
+}
@@ -0,0 +1,94 @@
+package xwin
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+
+	"github.com/jezek/xgb/xproto"
+)
+
+// Image reads a window's own contents. Unlike a capture of its screen
+// area, the result is not covered by overlapping windows when a
+// compositor is running, and ARGB (depth 32) windows keep their alpha
+// channel, so translucent terminals come out translucent.
+func (c *Conn) Image(id uint32) (*image.RGBA, error) {
+	win := xproto.Window(id)
+	geom, err := xproto.GetGeometry(c.x, xproto.Drawable(win)).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get window geometry: %w", err)
+	}
+
+	setup := xproto.Setup(c.x)
+	if setup.ImageByteOrder != xproto.ImageOrderLSBFirst {
+		return nil, fmt.Errorf("unsupported image byte order (MSB first)")
+	}
+	bpp := 0
+	for _, f := range setup.PixmapFormats {
+		if f.Depth == geom.Depth {
+			bpp = int(f.BitsPerPixel)
+		}
+	}
+	if bpp != 32 {
+		return nil, fmt.Errorf("unsupported window depth %d (%d bits per pixel)", geom.Depth, bpp)
+	}
+
+	w, h := int(geom.Width), int(geom.Height)
+	reply, err := xproto.GetImage(c.x, xproto.ImageFormatZPixmap, xproto.Drawable(win),
+		0, 0, geom.Width, geom.Height, 0xffffffff).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read window contents: %w", err)
+	}
+	if len(reply.Data) < w*h*4 {
+		return nil, fmt.Errorf("short window image (%d bytes for %dx%d)", len(reply.Data), w, h)
+	}
+
+	// Pixels are BGRA; depth 32 windows carry premultiplied alpha, which
+	// is what image.RGBA stores
+	alpha := geom.Depth == 32
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < w*h*4; i += 4 {
+		img.Pix[i] = reply.Data[i+2]
+		img.Pix[i+1] = reply.Data[i+1]
+		img.Pix[i+2] = reply.Data[i]
+		img.Pix[i+3] = 255
+		if alpha {
+			img.Pix[i+3] = reply.Data[i+3]
+		}
+	}
+	return img, nil
+}
+
+// Desktop paints the mapped top-level windows, bottom to top, onto an
+// opaque black canvas covering area, reading each window's own contents.
+// It stands in for reading the root window on rootless X servers such as
+// XWayland under ChromeOS's sommelier, where the root has no contents of
+// its own. Windows that can't be read (unusual depths) are skipped.
+func (c *Conn) Desktop(area image.Rectangle) (*image.RGBA, error) {
+	tree, err := xproto.QueryTree(c.x, c.root).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list windows: %w", err)
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, area.Dx(), area.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), image.Black, image.Point{}, draw.Src)
+
+	// Children are listed in stacking order, bottom first
+	for _, win := range tree.Children {
+		attrs, err := xproto.GetWindowAttributes(c.x, win).Reply()
+		if err != nil || attrs.MapState != xproto.MapStateViewable || attrs.Class != xproto.WindowClassInputOutput {
+			continue
+		}
+		bounds, err := c.bounds(win)
+		if err != nil || !bounds.Overlaps(area) {
+			continue
+		}
+		img, err := c.Image(uint32(win))
+		if err != nil {
+			continue
+		}
+		r := bounds.Sub(area.Min)
+		draw.Draw(canvas, r, img, image.Point{}, draw.Over)
+	}
+	return canvas, nil
+}
@@ -0,0 +1,136 @@
+package xwin
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/randr"
+	"github.com/jezek/xgb/xproto"
+)
+
+// LayoutWatcher delivers a notification whenever the X server reports a
+// RandR screen, CRTC, or output change (monitor hotplug, dock/undock,
+// resolution or arrangement change)
+type LayoutWatcher struct {
+	x *xgb.Conn
+
+	// C receives a value after one or more layout changes. Notifications
+	// are coalesced: a pending value is never duplicated.
+	C <-chan struct{}
+}
+
+// WatchLayout subscribes to RandR change events on the given display.
+// An empty display uses $DISPLAY.
+func WatchLayout(display string) (*LayoutWatcher, error) {
+	x, err := dial(display)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to X server: %w", err)
+	}
+
+	if err := randr.Init(x); err != nil {
+		x.Close()
+		return nil, fmt.Errorf("RandR extension not available: %w", err)
+	}
+	if _, err := randr.QueryVersion(x, 1, 2).Reply(); err != nil {
+		x.Close()
+		return nil, fmt.Errorf("RandR version query failed: %w", err)
+	}
+
+	root := xproto.Setup(x).DefaultScreen(x).Root
+	mask := uint16(randr.NotifyMaskScreenChange | randr.NotifyMaskCrtcChange | randr.NotifyMaskOutputChange)
+	if err := randr.SelectInputChecked(x, root, mask).Check(); err != nil {
+		x.Close()
+		return nil, fmt.Errorf("failed to subscribe to RandR events: %w", err)
+	}
+
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer close(ch)
+		for {
+			ev, err := x.WaitForEvent()
+			if ev == nil && err == nil {
+				// Connection closed
+				return
+			}
+			switch ev.(type) {
+			case randr.ScreenChangeNotifyEvent, randr.NotifyEvent:
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return &LayoutWatcher{x: x, C: ch}, nil
+}
+
+// Close stops watching and closes the connection
+func (w *LayoutWatcher) Close() {
+	w.x.Close()
+}
+
+// Output is an active RandR output (a connected monitor with a CRTC)
+type Output struct {
+	Name    string
+	Bounds  image.Rectangle
+	Primary bool
+
+	// WidthMM is the physical width as laid out (after rotation), 0 if
+	// the monitor doesn't report it
+	WidthMM int
+}
+
+// Outputs returns the active RandR outputs on the given display.
+// An empty display uses $DISPLAY.
+func Outputs(display string) ([]Output, error) {
+	x, err := dial(display)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to X server: %w", err)
+	}
+	defer x.Close()
+
+	if err := randr.Init(x); err != nil {
+		return nil, fmt.Errorf("RandR extension not available: %w", err)
+	}
+	if _, err := randr.QueryVersion(x, 1, 3).Reply(); err != nil {
+		return nil, fmt.Errorf("RandR version query failed: %w", err)
+	}
+
+	root := xproto.Setup(x).DefaultScreen(x).Root
+	res, err := randr.GetScreenResourcesCurrent(x, root).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read screen resources: %w", err)
+	}
+
+	var primary randr.Output
+	if reply, err := randr.GetOutputPrimary(x, root).Reply(); err == nil {
+		primary = reply.Output
+	}
+
+	var outputs []Output
+	for _, id := range res.Outputs {
+		info, err := randr.GetOutputInfo(x, id, res.ConfigTimestamp).Reply()
+		if err != nil || info.Connection != randr.ConnectionConnected || info.Crtc == 0 {
+			continue
+		}
+		crtc, err := randr.GetCrtcInfo(x, info.Crtc, res.ConfigTimestamp).Reply()
+		if err != nil || crtc.Width == 0 || crtc.Height == 0 {
+			continue
+		}
+
+		widthMM := int(info.MmWidth)
+		if crtc.Rotation&(randr.RotationRotate90|randr.RotationRotate270) != 0 {
+			widthMM = int(info.MmHeight)
+		}
+
+		outputs = append(outputs, Output{
+			Name:    string(info.Name),
+			Bounds:  image.Rect(int(crtc.X), int(crtc.Y), int(crtc.X)+int(crtc.Width), int(crtc.Y)+int(crtc.Height)),
+			Primary: id == primary,
+			WidthMM: widthMM,
+		})
+	}
+	return outputs, nil
+}
@@ -0,0 +1,257 @@
+package xwin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jezek/xgb"
+)
+
+// DialTimeout bounds connecting to a display over TCP, which otherwise
+// hangs for minutes on a host that drops the packets
+const DialTimeout = 5 * time.Second
+
+// Address families of Xauthority entries, from X11/Xauth.h
+const (
+	familyInternet  = 0
+	familyInternet6 = 6
+	familyLocal     = 256
+	familyWild      = 65535
+)
+
+// cookieFile is the Xauthority file written by AuthorizeRemote, with the
+// cookie found in cookieSource
+var cookieFile, cookieSource string
+
+// Display is a parsed display name such as :0, remote:10.0 or
+// tcp/remote:10
+type Display struct {
+	Name     string
+	Protocol string
+	Host     string
+	Number   int
+}
+
+// ParseDisplay parses a display name the way X clients do. An empty name
+// uses $DISPLAY.
+func ParseDisplay(name string) (Display, error) {
+	if name == "" {
+		name = os.Getenv("DISPLAY")
+	}
+	d := Display{Name: name}
+	colon := strings.LastIndex(name, ":")
+	if colon < 0 {
+		return d, fmt.Errorf("invalid display %q", name)
+	}
+	if !strings.HasPrefix(name, "/") {
+		d.Host = name[:colon]
+		if slash := strings.LastIndex(d.Host, "/"); slash >= 0 {
+			d.Protocol, d.Host = d.Host[:slash], d.Host[slash+1:]
+		}
+	}
+	number, _, _ := strings.Cut(name[colon+1:], ".")
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 0 {
+		return d, fmt.Errorf("invalid display %q", name)
+	}
+	d.Number = n
+	return d, nil
+}
+
+// Remote reports whether the display is reached over the network (TCP),
+// as remote X sessions and ssh -X forwarded displays (localhost:10) are
+func (d Display) Remote() bool {
+	return d.Host != "" && d.Host != "unix"
+}
+
+// Addr returns the TCP address of a remote display
+func (d Display) Addr() string {
+	return net.JoinHostPort(d.Host, strconv.Itoa(6000+d.Number))
+}
+
+// dial connects to a display. Remote displays are dialed with a timeout,
+// and a refusal explains where the cookie was looked for.
+func dial(display string) (*xgb.Conn, error) {
+	d, err := ParseDisplay(display)
+	if err != nil || !d.Remote() {
+		return xgb.NewConnDisplay(display)
+	}
+	if d.Protocol != "" && d.Protocol != "tcp" {
+		return nil, fmt.Errorf("unsupported protocol %q in display %s", d.Protocol, d.Name)
+	}
+
+	c, err := net.DialTimeout("tcp", d.Addr(), DialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("cannot reach X display %s at %s: %w (X servers usually don't listen on TCP unless started without -nolisten tcp; ssh -X forwards a display instead)", d.Name, d.Addr(), err)
+	}
+	x, err := xgb.NewConnNet(c)
+	if err != nil {
+		c.Close()
+		if strings.Contains(err.Error(), "refused") {
+			hint := fmt.Sprintf("is there a cookie for it in %s? Copy it with xauth", xauthorityPath())
+			if cookieFile != "" && cookieFile == os.Getenv("XAUTHORITY") {
+				hint = fmt.Sprintf("the cookie for it in %s may be stale", cookieSource)
+			}
+			return nil, fmt.Errorf("X display %s refused the connection: %w (%s)", d.Name, err, hint)
+		}
+		return nil, fmt.Errorf("failed to connect to X display %s: %w", d.Name, err)
+	}
+	return x, nil
+}
+
+// AuthorizeRemote makes the cookie of a remote display usable. Cookies
+// for TCP displays are filed under the host's IP address, and those of
+// ssh -X displays under the local host name and display number, neither
+// of which every client matches. The cookie is written as the only entry
+// of a private Xauthority file that $XAUTHORITY points to, for this
+// process and the commands it runs; call the returned function to remove
+// it. Local displays, and remote ones without a cookie, are left alone.
+func AuthorizeRemote(display string) (func(), error) {
+	none := func() {}
+	d, err := ParseDisplay(display)
+	if err != nil || !d.Remote() {
+		return none, nil
+	}
+	name, data, err := findCookie(d)
+	if err != nil || name == "" {
+		return none, err
+	}
+
+	f, err := os.CreateTemp("", "screenshot-xauth-")
+	if err != nil {
+		return none, fmt.Errorf("failed to create Xauthority file: %w", err)
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint16(familyWild))
+	for _, field := range [][]byte{nil, nil, []byte(name), data} {
+		binary.Write(&buf, binary.BigEndian, uint16(len(field)))
+		buf.Write(field)
+	}
+	_, err = f.Write(buf.Bytes())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return none, fmt.Errorf("failed to write Xauthority file: %w", err)
+	}
+
+	previous, had := os.LookupEnv("XAUTHORITY")
+	cookieFile, cookieSource = f.Name(), xauthorityPath()
+	os.Setenv("XAUTHORITY", f.Name())
+	return func() {
+		cookieFile = ""
+		if had {
+			os.Setenv("XAUTHORITY", previous)
+		} else {
+			os.Unsetenv("XAUTHORITY")
+		}
+		os.Remove(f.Name())
+	}, nil
+}
+
+// xauthorityPath returns the Xauthority file clients read
+func xauthorityPath() string {
+	if p := os.Getenv("XAUTHORITY"); p != "" {
+		return p
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".Xauthority")
+}
+
+// findCookie returns the first Xauthority entry for a remote display, as
+// libXau picks it: matching the host's addresses, or the local host name
+// for localhost, and the display number. It returns an empty name if
+// there is none.
+func findCookie(d Display) (string, []byte, error) {
+	f, err := os.Open(xauthorityPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read Xauthority: %w", err)
+	}
+	defer f.Close()
+
+	var ips []net.IP
+	local := d.Host == "localhost"
+	if ip := net.ParseIP(d.Host); ip != nil {
+		ips = []net.IP{ip}
+		local = ip.IsLoopback()
+	} else if resolved, err := net.LookupIP(d.Host); err == nil {
+		ips = resolved
+	}
+	hostname, _ := os.Hostname()
+	number := strconv.Itoa(d.Number)
+
+	for {
+		family, fields, err := readEntry(f)
+		if err == io.EOF {
+			return "", nil, nil
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid Xauthority %s: %w", f.Name(), err)
+		}
+		addr, disp, name, data := fields[0], fields[1], fields[2], fields[3]
+		if len(disp) > 0 && string(disp) != number {
+			continue
+		}
+		switch family {
+		case familyWild:
+		case familyLocal:
+			if !local || string(addr) != hostname {
+				continue
+			}
+		case familyInternet, familyInternet6:
+			if !containsIP(ips, addr) {
+				continue
+			}
+		default:
+			continue
+		}
+		return string(name), data, nil
+	}
+}
+
+// readEntry reads one Xauthority entry: the family, then the address,
+// display number, auth name and data, each prefixed by its length
+func readEntry(r io.Reader) (uint16, [4][]byte, error) {
+	var family uint16
+	var fields [4][]byte
+	if err := binary.Read(r, binary.BigEndian, &family); err != nil {
+		return 0, fields, err
+	}
+	for i := range fields {
+		var n uint16
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return 0, fields, io.ErrUnexpectedEOF
+		}
+		fields[i] = make([]byte, n)
+		if _, err := io.ReadFull(r, fields[i]); err != nil {
+			return 0, fields, io.ErrUnexpectedEOF
+		}
+	}
+	return family, fields, nil
+}
+
+// containsIP reports whether addr, in network byte order, is one of ips
+func containsIP(ips []net.IP, addr []byte) bool {
+	for _, ip := range ips {
+		if v4 := ip.To4(); v4 != nil && len(addr) == net.IPv4len {
+			ip = v4
+		}
+		if bytes.Equal(ip, addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package xwin
+
+import (
+	"fmt"
+	"image"
+	"time"
+
+	"github.com/jezek/xgb/xproto"
+)
+
+// Overlay is an image shown on screen by ShowImage
+type Overlay struct {
+	c   *Conn
+	win xproto.Window
+}
+
+// ShowImage puts img on screen at pos in an override-redirect window,
+// above everything else and unmanaged by the window manager, until the
+// overlay is closed. The image is the window's background pixmap, so the
+// server repaints it by itself whenever it is exposed. Colors are encoded
+// with the root visual's masks, the inverse of Grab.
+func (c *Conn) ShowImage(img *image.RGBA, pos image.Point) (*Overlay, error) {
+	f, err := c.rootFormat()
+	if err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= 0 || h <= 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+
+	pix, err := xproto.NewPixmapId(c.x)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate pixmap: %w", err)
+	}
+	if err := xproto.CreatePixmapChecked(c.x, f.depth, pix, xproto.Drawable(c.root), uint16(w), uint16(h)).Check(); err != nil {
+		return nil, fmt.Errorf("failed to create pixmap: %w", err)
+	}
+	defer xproto.FreePixmap(c.x, pix)
+
+	gc, err := xproto.NewGcontextId(c.x)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate graphics context: %w", err)
+	}
+	if err := xproto.CreateGCChecked(c.x, gc, xproto.Drawable(pix), 0, nil).Check(); err != nil {
+		return nil, fmt.Errorf("failed to create graphics context: %w", err)
+	}
+	defer xproto.FreeGC(c.x, gc)
+
+	// Upload in bands that fit in one request (24 bytes of header)
+	stride := f.stride(w)
+	maxRequest := int(xproto.Setup(c.x).MaximumRequestLength)*4 - 24
+	band := max(1, min(h, maxRequest/stride))
+	data := make([]byte, stride*band)
+	for y0 := 0; y0 < h; y0 += band {
+		bh := min(band, h-y0)
+		for y := 0; y < bh; y++ {
+			row := data[y*stride:]
+			in := img.Pix[img.PixOffset(b.Min.X, b.Min.Y+y0+y):]
+			for x := 0; x < w; x++ {
+				p := f.red.pixel(in[x*4]) | f.green.pixel(in[x*4+1]) | f.blue.pixel(in[x*4+2])
+				putPixel(row[x*f.bytesPP:x*f.bytesPP+f.bytesPP], p, f.msb)
+			}
+		}
+		err := xproto.PutImageChecked(c.x, xproto.ImageFormatZPixmap, xproto.Drawable(pix), gc,
+			uint16(w), uint16(bh), 0, int16(y0), 0, f.depth, data[:stride*bh]).Check()
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload image: %w", err)
+		}
+	}
+
+	screen := xproto.Setup(c.x).DefaultScreen(c.x)
+	win, err := xproto.NewWindowId(c.x)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate window: %w", err)
+	}
+	err = xproto.CreateWindowChecked(c.x, screen.RootDepth, win, c.root,
+		int16(pos.X), int16(pos.Y), uint16(w), uint16(h), 0,
+		xproto.WindowClassInputOutput, screen.RootVisual,
+		xproto.CwBackPixmap|xproto.CwOverrideRedirect,
+		[]uint32{uint32(pix), 1}).Check()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create window: %w", err)
+	}
+	if err := xproto.MapWindowChecked(c.x, win).Check(); err != nil {
+		xproto.DestroyWindow(c.x, win)
+		return nil, fmt.Errorf("failed to map window: %w", err)
+	}
+
+	return &Overlay{c: c, win: win}, nil
+}
+
+// Raise puts the overlay back on top of windows mapped after it, such as
+// menus and other override-redirect windows
+func (o *Overlay) Raise() error {
+	return xproto.ConfigureWindowChecked(o.c.x, o.win, xproto.ConfigWindowStackMode,
+		[]uint32{xproto.StackModeAbove}).Check()
+}
+
+// WaitClick waits up to d for a mouse button press on the overlay and
+// reports whether there was one. Events are read until the connection is
+// closed, so the overlay should have a connection of its own.
+func (o *Overlay) WaitClick(d time.Duration) (bool, error) {
+	err := xproto.ChangeWindowAttributesChecked(o.c.x, o.win, xproto.CwEventMask,
+		[]uint32{xproto.EventMaskButtonPress}).Check()
+	if err != nil {
+		return false, fmt.Errorf("failed to listen for clicks: %w", err)
+	}
+
+	clicked := make(chan struct{}, 1)
+	go func() {
+		for {
+			ev, err := o.c.x.WaitForEvent()
+			if ev == nil && err == nil {
+				// Connection closed
+				return
+			}
+			if e, ok := ev.(xproto.ButtonPressEvent); ok && e.Event == o.win {
+				clicked <- struct{}{}
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-clicked:
+		return true, nil
+	case <-time.After(d):
+		return false, nil
+	}
+}
+
+// Close removes the overlay from the screen
+func (o *Overlay) Close() {
+	// Make sure the window is gone before returning
+	xproto.DestroyWindow(o.c.x, o.win)
+	xproto.GetInputFocus(o.c.x).Reply()
+}
+
+// putPixel stores a pixel value in the server's byte order, the inverse
+// of pixel
+func putPixel(b []byte, p uint32, msb bool) {
+	for i := range b {
+		if msb {
+			b[len(b)-1-i] = byte(p >> (8 * i))
+		} else {
+			b[i] = byte(p >> (8 * i))
+		}
+	}
+}
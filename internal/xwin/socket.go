@@ -0,0 +1,110 @@
+package xwin
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// socketNumberRe finds the display number in a socket name (X5 is :5)
+var socketNumberRe = regexp.MustCompile(`X(\d+)$`)
+
+// Socket exposes an X server's unix socket under a display name, for X
+// servers that are only reachable by socket: one in a container whose
+// /tmp/.X11-unix is mounted elsewhere, or one listening on an abstract
+// socket (@/tmp/.X11-unix/X5). The display name has the form DIR/X:N,
+// which X clients dial as the socket DIR/X:N.
+type Socket struct {
+	dir      string
+	display  string
+	listener net.Listener
+}
+
+// OpenSocket makes the X server listening on socket reachable through a
+// display name. A socket file is linked into a private directory; an
+// abstract socket (starting with @) is relayed, as it can't be linked.
+func OpenSocket(socket string) (*Socket, error) {
+	c, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to X socket %s: %w", socket, err)
+	}
+	c.Close()
+
+	// Keep the display number, under which Xauthority files list the
+	// server's cookie
+	number := "0"
+	if m := socketNumberRe.FindStringSubmatch(socket); m != nil {
+		number = m[1]
+	}
+
+	dir, err := os.MkdirTemp("", "screenshot-x11-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create X socket directory: %w", err)
+	}
+	s := &Socket{dir: dir, display: filepath.Join(dir, "X") + ":" + number}
+	path := filepath.Join(dir, "X:"+number)
+
+	if !strings.HasPrefix(socket, "@") {
+		target, err := filepath.Abs(socket)
+		if err == nil {
+			err = os.Symlink(target, path)
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("failed to link X socket: %w", err)
+		}
+		return s, nil
+	}
+
+	s.listener, err = net.Listen("unix", path)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to relay X socket: %w", err)
+	}
+	go s.relay(socket)
+	return s, nil
+}
+
+// Display returns the display name to connect to, e.g. for $DISPLAY
+func (s *Socket) Display() string {
+	return s.display
+}
+
+// Close stops relaying and removes the display name
+func (s *Socket) Close() {
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	os.RemoveAll(s.dir)
+}
+
+// relay forwards each connection to the display name to socket
+func (s *Socket) relay(socket string) {
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer c.Close()
+			server, err := net.Dial("unix", socket)
+			if err != nil {
+				return
+			}
+			defer server.Close()
+			done := make(chan struct{})
+			go func() {
+				io.Copy(server, c)
+				server.(*net.UnixConn).CloseWrite()
+				close(done)
+			}()
+			io.Copy(c, server)
+			c.(*net.UnixConn).CloseWrite()
+			<-done
+		}()
+	}
+}
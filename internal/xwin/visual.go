@@ -0,0 +1,29 @@
+package xwin
+
+import (
+	"fmt"
+
+	"github.com/jezek/xgb/xproto"
+)
+
+// SwapsRedBlue reports whether the root window's visual stores red in the
+// low byte and blue in the high byte of each pixel (BGR). Capture code
+// that assumes the common 0xRRGGBB layout returns such frames with red and
+// blue swapped. An empty display uses $DISPLAY.
+func SwapsRedBlue(display string) (bool, error) {
+	x, err := dial(display)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to X server: %w", err)
+	}
+	defer x.Close()
+
+	screen := xproto.Setup(x).DefaultScreen(x)
+	for _, depth := range screen.AllowedDepths {
+		for _, v := range depth.Visuals {
+			if v.VisualId == screen.RootVisual {
+				return v.RedMask == 0x0000ff && v.BlueMask == 0xff0000, nil
+			}
+		}
+	}
+	return false, fmt.Errorf("root visual %d not found", screen.RootVisual)
+}
@@ -0,0 +1,236 @@
+// Package xwin queries X11 window information (EWMH/ICCCM properties)
+package xwin
+
+import (
+	"fmt"
+	"image"
+	"strings"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+// Window describes a top-level X11 window
+type Window struct {
+	ID       uint32          `json:"id"`
+	Title    string          `json:"title"`
+	Class    string          `json:"class"`
+	Instance string          `json:"instance,omitempty"`
+	Bounds   image.Rectangle `json:"bounds"`
+	PID      uint32          `json:"pid,omitempty"`
+
+	// Type is the EWMH window type in lower case (normal, dialog, dock,
+	// desktop, ...), empty if unset
+	Type string `json:"type,omitempty"`
+
+	// Hidden is set for unmapped (minimized) windows
+	Hidden bool `json:"hidden,omitempty"`
+}
+
+// Conn is a connection to an X server used for window queries
+type Conn struct {
+	x     *xgb.Conn
+	root  xproto.Window
+	atoms map[string]xproto.Atom
+}
+
+// Connect opens a connection to the given display.
+// An empty display uses $DISPLAY.
+func Connect(display string) (*Conn, error) {
+	x, err := dial(display)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to X server: %w", err)
+	}
+
+	return &Conn{
+		x:     x,
+		root:  xproto.Setup(x).DefaultScreen(x).Root,
+		atoms: map[string]xproto.Atom{},
+	}, nil
+}
+
+// Close closes the connection
+func (c *Conn) Close() {
+	c.x.Close()
+}
+
+// atom interns an atom name, caching the result
+func (c *Conn) atom(name string) (xproto.Atom, error) {
+	if a, ok := c.atoms[name]; ok {
+		return a, nil
+	}
+
+	reply, err := xproto.InternAtom(c.x, false, uint16(len(name)), name).Reply()
+	if err != nil {
+		return 0, fmt.Errorf("failed to intern atom %s: %w", name, err)
+	}
+
+	c.atoms[name] = reply.Atom
+	return reply.Atom, nil
+}
+
+// property reads a window property of any type
+func (c *Conn) property(win xproto.Window, name string) (*xproto.GetPropertyReply, error) {
+	a, err := c.atom(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return xproto.GetProperty(c.x, false, win, a, xproto.GetPropertyTypeAny, 0, 1<<16).Reply()
+}
+
+// windowList reads a property holding a list of window IDs
+func (c *Conn) windowList(win xproto.Window, name string) ([]xproto.Window, error) {
+	reply, err := c.property(win, name)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Format != 32 {
+		return nil, nil
+	}
+
+	ids := make([]xproto.Window, reply.ValueLen)
+	for i := range ids {
+		ids[i] = xproto.Window(xgb.Get32(reply.Value[i*4:]))
+	}
+	return ids, nil
+}
+
+// ActiveWindow returns the window that currently has focus, as reported by
+// the window manager (_NET_ACTIVE_WINDOW). Returns nil if there is none.
+func (c *Conn) ActiveWindow() (*Window, error) {
+	ids, err := c.windowList(c.root, "_NET_ACTIVE_WINDOW")
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 || ids[0] == 0 {
+		return nil, nil
+	}
+
+	return c.Window(uint32(ids[0]))
+}
+
+// Pointer returns the pointer position in root window coordinates
+func (c *Conn) Pointer() (image.Point, error) {
+	reply, err := xproto.QueryPointer(c.x, c.root).Reply()
+	if err != nil {
+		return image.Point{}, fmt.Errorf("failed to query pointer: %w", err)
+	}
+	return image.Pt(int(reply.RootX), int(reply.RootY)), nil
+}
+
+// Windows returns all managed top-level windows in stacking order
+// (bottom to top), as reported by _NET_CLIENT_LIST_STACKING.
+func (c *Conn) Windows() ([]Window, error) {
+	ids, err := c.windowList(c.root, "_NET_CLIENT_LIST_STACKING")
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		// Fall back to the unordered list for WMs that don't track stacking
+		if ids, err = c.windowList(c.root, "_NET_CLIENT_LIST"); err != nil {
+			return nil, err
+		}
+	}
+
+	windows := make([]Window, 0, len(ids))
+	for _, id := range ids {
+		w, err := c.Window(uint32(id))
+		if err != nil {
+			// Windows can disappear between listing and querying
+			continue
+		}
+		windows = append(windows, *w)
+	}
+	return windows, nil
+}
+
+// Window returns information about a single window
+func (c *Conn) Window(id uint32) (*Window, error) {
+	win := xproto.Window(id)
+
+	bounds, err := c.bounds(win)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Window{ID: id, Bounds: bounds}
+	w.Title = c.title(win)
+	w.Instance, w.Class = c.class(win)
+	w.PID = c.pid(win)
+	w.Type = c.windowType(win)
+	if attrs, err := xproto.GetWindowAttributes(c.x, win).Reply(); err == nil {
+		w.Hidden = attrs.MapState != xproto.MapStateViewable
+	}
+	return w, nil
+}
+
+// bounds returns the window geometry in root coordinates
+func (c *Conn) bounds(win xproto.Window) (image.Rectangle, error) {
+	geom, err := xproto.GetGeometry(c.x, xproto.Drawable(win)).Reply()
+	if err != nil {
+		return image.Rectangle{}, fmt.Errorf("failed to get window geometry: %w", err)
+	}
+
+	pos, err := xproto.TranslateCoordinates(c.x, win, c.root, 0, 0).Reply()
+	if err != nil {
+		return image.Rectangle{}, fmt.Errorf("failed to translate window coordinates: %w", err)
+	}
+
+	x, y := int(pos.DstX), int(pos.DstY)
+	return image.Rect(x, y, x+int(geom.Width), y+int(geom.Height)), nil
+}
+
+// title returns _NET_WM_NAME, falling back to WM_NAME
+func (c *Conn) title(win xproto.Window) string {
+	for _, name := range []string{"_NET_WM_NAME", "WM_NAME"} {
+		reply, err := c.property(win, name)
+		if err == nil && reply.ValueLen > 0 {
+			return string(reply.Value)
+		}
+	}
+	return ""
+}
+
+// pid returns _NET_WM_PID, or 0 if the client doesn't set it
+func (c *Conn) pid(win xproto.Window) uint32 {
+	reply, err := c.property(win, "_NET_WM_PID")
+	if err != nil || reply.Format != 32 || reply.ValueLen == 0 {
+		return 0
+	}
+	return xgb.Get32(reply.Value)
+}
+
+// class returns the instance and class parts of WM_CLASS
+func (c *Conn) class(win xproto.Window) (string, string) {
+	reply, err := c.property(win, "WM_CLASS")
+	if err != nil || reply.ValueLen == 0 {
+		return "", ""
+	}
+
+	parts := strings.Split(strings.TrimRight(string(reply.Value), "\x00"), "\x00")
+	if len(parts) < 2 {
+		return parts[0], parts[0]
+	}
+	return parts[0], parts[1]
+}
+
+// Find returns the topmost window whose title, class or instance contains
+// pattern (case-insensitive), or nil if none matches
+func (c *Conn) Find(pattern string) (*Window, error) {
+	windows, err := c.Windows()
+	if err != nil {
+		return nil, err
+	}
+
+	pattern = strings.ToLower(pattern)
+	for i := len(windows) - 1; i >= 0; i-- {
+		w := windows[i]
+		for _, s := range []string{w.Title, w.Class, w.Instance} {
+			if s != "" && strings.Contains(strings.ToLower(s), pattern) {
+				return &w, nil
+			}
+		}
+	}
+	return nil, nil
+}
@@ -1,6 +1,11 @@
 package main
 
-import "github.com/robotin/screenshot/cmd"
+import (
+	"github.com/robotin/screenshot/cmd"
+
+	// Console backends (kms, fbdev, dispmanx), registered after X11
+	_ "github.com/robotin/screenshot/internal/strategy/console"
+)
 
 func main() {
 	cmd.Execute()